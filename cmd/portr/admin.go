@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
@@ -38,6 +39,10 @@ type adminAddUserOptions struct {
 	Role  string
 }
 
+// apiTokenEnv holds an admin API token to use in place of the config's
+// secret key, which servers accept only with PORTR_ADMIN_SECRET_KEY_AUTH.
+const apiTokenEnv = "PORTR_API_TOKEN"
+
 type adminErrorResponse struct {
 	Error string `json:"error"`
 }
@@ -84,8 +89,16 @@ func addAdminUser(c *cli.Context) error {
 	if err != nil {
 		return fmt.Errorf("load config: %w", err)
 	}
-	if strings.TrimSpace(cfg.SecretKey) == "" {
-		return fmt.Errorf("secret_key is required in the selected config")
+	credential := strings.TrimSpace(os.Getenv(apiTokenEnv))
+	usingSecretKey := credential == ""
+	if usingSecretKey {
+		credential = strings.TrimSpace(cfg.SecretKey)
+	}
+	if credential == "" {
+		return fmt.Errorf("secret_key is required in the selected config, or set %s", apiTokenEnv)
+	}
+	if usingSecretKey {
+		fmt.Fprintf(c.App.ErrWriter, "Using the config's secret key is deprecated; set %s to an API token with the users:manage scope.\n", apiTokenEnv)
 	}
 
 	payload, err := json.Marshal(adminAddUserRequest{
@@ -102,7 +115,7 @@ func addAdminUser(c *cli.Context) error {
 	if err != nil {
 		return fmt.Errorf("create request: %w", err)
 	}
-	req.Header.Set("Authorization", "Bearer "+cfg.SecretKey)
+	req.Header.Set("Authorization", "Bearer "+credential)
 	req.Header.Set("Content-Type", "application/json")
 
 	client := &http.Client{Timeout: 15 * time.Second}
@@ -116,6 +129,9 @@ func addAdminUser(c *cli.Context) error {
 	if err != nil {
 		return fmt.Errorf("read response: %w", err)
 	}
+	if resp.StatusCode == http.StatusUnauthorized && usingSecretKey {
+		return fmt.Errorf("the server does not accept secret keys for user management; set %s to an API token with the users:manage scope", apiTokenEnv)
+	}
 	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
 		var serverError adminErrorResponse
 		if json.Unmarshal(body, &serverError) == nil && serverError.Error != "" {
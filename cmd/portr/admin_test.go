@@ -120,6 +120,20 @@ func TestAdminUsersAddSurfacesServerError(t *testing.T) {
 	}
 }
 
+func TestAdminUsersAddExplainsRefusedSecretKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":"Unauthorized"}`)
+	}))
+	defer server.Close()
+
+	_, err := runAdminCommand(t, server.URL, "admin", "users", "add", "new@example.com")
+	if err == nil || !strings.Contains(err.Error(), apiTokenEnv) {
+		t.Fatalf("expected a hint to set %s, got %v", apiTokenEnv, err)
+	}
+}
+
 func TestAdminUsersAddRequiresConfiguredSecret(t *testing.T) {
 	configPath := filepath.Join(t.TempDir(), "config.yaml")
 	if err := os.WriteFile(configPath, []byte("server_url: example.com\n"), 0o600); err != nil {
@@ -136,6 +150,22 @@ func TestAdminUsersAddRequiresConfiguredSecret(t *testing.T) {
 	}
 }
 
+func TestAdminUsersAddPrefersAPITokenFromEnv(t *testing.T) {
+	t.Setenv(apiTokenEnv, "portr_pat_test")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer portr_pat_test" {
+			t.Fatalf("unexpected authorization header %q", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"team_user":{"user":{"id":2,"email":"new@example.com"},"role":"member"},"team":{"id":1,"name":"Default Team","slug":"default-team"}}`)
+	}))
+	defer server.Close()
+
+	if _, err := runAdminCommand(t, server.URL, "admin", "users", "add", "new@example.com"); err != nil {
+		t.Fatalf("run command: %v", err)
+	}
+}
+
 func TestAdminUsersAddHelpWorksAfterEmail(t *testing.T) {
 	var out bytes.Buffer
 	app := &cli.App{
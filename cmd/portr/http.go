@@ -24,6 +24,7 @@ func httpCmd() *cli.Command {
 				Usage: "Host header to send to the local server ('rewrite' to use the local address)",
 			},
 			basicAuthFlag(),
+			expiresInFlag(),
 		},
 		Action: func(c *cli.Context) error {
 			portStr := c.Args().First()
@@ -39,6 +40,7 @@ func httpCmd() *cli.Command {
 				Type:       constants.Http,
 				HostHeader: c.String("host-header"),
 				BasicAuth:  c.String("basic-auth"),
+				ExpiresIn:  c.Duration("expires-in"),
 			})
 		},
 	}
@@ -12,6 +12,7 @@ import (
 	"github.com/amalshaji/portr/internal/client/dashboard"
 	"github.com/amalshaji/portr/internal/client/db"
 	config "github.com/amalshaji/portr/internal/clientconfig"
+	"github.com/amalshaji/portr/internal/tracing"
 	"github.com/urfave/cli/v2"
 )
 
@@ -26,6 +27,15 @@ func basicAuthFlag() cli.Flag {
 	}
 }
 
+// expiresInFlag closes the tunnel after a while, so it cannot be left public
+// by accident.
+func expiresInFlag() cli.Flag {
+	return &cli.DurationFlag{
+		Name:  "expires-in",
+		Usage: "Close the tunnel after this long, as 30m or 2h",
+	}
+}
+
 func startTunnels(c *cli.Context, tunnelFromCli *config.Tunnel) error {
 	cfg, err := config.Load(c.String("config"))
 	if err != nil {
@@ -50,6 +60,16 @@ func startTunnels(c *cli.Context, tunnelFromCli *config.Tunnel) error {
 		return err
 	}
 
+	stopTracing, err := tracing.Start(c.Context, "portr", version, cfg.OTLPEndpoint)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer flushCancel()
+		_ = stopTracing(flushCtx)
+	}()
+
 	db := db.New(&cfg)
 	_c := client.NewClient(&cfg, db)
 	var dash *dashboard.Dashboard
@@ -13,6 +13,9 @@ func tcpCmd() *cli.Command {
 	return &cli.Command{
 		Name:  "tcp",
 		Usage: "Expose tcp port",
+		Flags: []cli.Flag{
+			expiresInFlag(),
+		},
 		Action: func(c *cli.Context) error {
 			portStr := c.Args().First()
 
@@ -25,6 +28,7 @@ func tcpCmd() *cli.Command {
 				Port:      port,
 				Subdomain: "",
 				Type:      constants.Tcp,
+				ExpiresIn: c.Duration("expires-in"),
 			})
 		},
 	}
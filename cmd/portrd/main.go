@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"net"
 	"os"
 	"os/signal"
 	"strings"
@@ -11,13 +12,22 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/amalshaji/portr/internal/server/accesslog"
 	"github.com/amalshaji/portr/internal/server/admin"
+	"github.com/amalshaji/portr/internal/server/bandwidth"
 	"github.com/amalshaji/portr/internal/server/config"
 	"github.com/amalshaji/portr/internal/server/cron"
 	"github.com/amalshaji/portr/internal/server/db"
+	"github.com/amalshaji/portr/internal/server/edgecache"
+	"github.com/amalshaji/portr/internal/server/errorpage"
+	"github.com/amalshaji/portr/internal/server/handoff"
+	"github.com/amalshaji/portr/internal/server/mirror"
 	"github.com/amalshaji/portr/internal/server/proxy"
 	"github.com/amalshaji/portr/internal/server/service"
+	"github.com/amalshaji/portr/internal/server/split"
 	sshd "github.com/amalshaji/portr/internal/server/ssh"
+	"github.com/amalshaji/portr/internal/server/visitorwarning"
+	"github.com/amalshaji/portr/internal/tracing"
 	"github.com/charmbracelet/log"
 	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
@@ -184,7 +194,13 @@ func runAutoMigrations(cfg *config.Config) error {
 }
 
 func startTunnel(configFilePath string) {
+	listeners, err := handoff.Inherit()
+	if err != nil {
+		log.Fatal("Failed to inherit listeners", "error", err)
+	}
+
 	config := config.Load(configFilePath)
+	defer startTracing(config)()
 
 	// Run auto-migrations if enabled
 	if err := runAutoMigrations(config); err != nil {
@@ -195,36 +211,77 @@ func startTunnel(configFilePath string) {
 	_db.Connect()
 
 	tunnelService := service.New(_db)
-	reconcileTunnelConnections(tunnelService)
-
 	proxyServer := proxy.New(config)
+	proxyServer.SetErrorPages(errorpage.New(tunnelService))
+	mirrors := mirror.New(tunnelService)
+	proxyServer.SetMirrors(mirrors)
+	proxyServer.SetSplits(split.New(tunnelService))
+	proxyServer.SetVisitorWarnings(visitorwarning.New(tunnelService))
 	sshServer := sshd.New(&config.Ssh, proxyServer, tunnelService)
-	cron := cron.New(config, tunnelService)
+	cron := cron.New(sshServer, sshServer, mirrors, startBandwidth(tunnelService, proxyServer, sshServer), startAccessLog(config, tunnelService, proxyServer, sshServer), startCache(config, tunnelService, proxyServer))
+	inheritTunnels(tunnelService, proxyServer)
 
-	go proxyServer.Start()
-	go sshServer.Start()
+	if err := sshServer.Prepare(); err != nil {
+		log.Fatal("Failed to prepare SSH server", "error", err)
+	}
+	proxyListener, err := listeners.Listen("proxy", proxyServer.GetServerAddr())
+	if err != nil {
+		log.Fatal("Failed to listen for proxy server", "error", err)
+	}
+	sshListener, err := listeners.Listen("ssh", sshServer.GetServerAddr())
+	if err != nil {
+		log.Fatal("Failed to listen for SSH server", "error", err)
+	}
+	listeners.CloseUnused()
+
+	go proxyServer.Start(proxyListener)
+	go sshServer.Start(sshListener)
 	go cron.Start()
+	reportReady()
+
+	reloadCtx, stopReload := context.WithCancel(context.Background())
+	defer stopReload()
+	watchReloadSignal(reloadCtx, configReloader(config))
 
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-
-	<-done
-
-	log.Info("Shutting down tunnel server...")
-
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	cron.Shutdown()
-	proxyServer.Shutdown(shutdownCtx)
-	sshServer.Shutdown(shutdownCtx)
+	upgrade := upgradeSignal()
+
+	for {
+		select {
+		case <-done:
+			log.Info("Shutting down tunnel server...")
+
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			cron.Shutdown()
+			proxyServer.Shutdown(shutdownCtx)
+			sshServer.Shutdown(shutdownCtx)
+			return
+		case <-upgrade:
+			fallback := handOff(listeners)
+			if fallback == nil {
+				continue
+			}
+			cron.Shutdown()
+			drainTunnels(config, proxyServer, sshServer, fallback)
+			return
+		}
+	}
 }
 
 func startAdmin() error {
+	listeners, err := handoff.Inherit()
+	if err != nil {
+		return fmt.Errorf("failed to inherit listeners: %w", err)
+	}
+
 	// Load configuration
 	fullConfig := config.Load("")
 	cfg := &fullConfig.Admin
 	cfg.Version = version
+	defer startTracing(fullConfig)()
 
 	// Run auto-migrations if enabled
 	if err := runAutoMigrations(fullConfig); err != nil {
@@ -235,28 +292,58 @@ func startAdmin() error {
 	_db.Connect()
 
 	adminServer := admin.NewServer(cfg, _db.Conn)
+	reload := configReloader(fullConfig)
+	adminServer.SetConfigReloader(reload)
+
+	adminListener, err := listeners.Listen("admin", adminServer.GetServerAddr())
+	if err != nil {
+		return fmt.Errorf("failed to listen for admin server: %w", err)
+	}
+	listeners.CloseUnused()
+
+	reloadCtx, stopReload := context.WithCancel(context.Background())
+	defer stopReload()
+	watchReloadSignal(reloadCtx, reload)
 
 	// Handle shutdown
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	upgrade := upgradeSignal()
 
 	go func() {
-		if err := adminServer.Start(); err != nil {
+		if err := adminServer.Start(adminListener); err != nil {
 			log.Fatal("Failed to start admin server", "error", err)
 		}
 	}()
-
-	<-done
-
-	log.Info("Shutting down admin server...")
-	return adminServer.Shutdown()
+	reportReady()
+
+	for {
+		select {
+		case <-done:
+			log.Info("Shutting down admin server...")
+			return adminServer.Shutdown()
+		case <-upgrade:
+			if err := listeners.Upgrade(context.Background(), config.Environ(), ""); err != nil {
+				log.Error("Failed to hand listeners to a new process", "error", err)
+				continue
+			}
+			log.Info("Handed listeners to a new process, shutting down admin server...")
+			return adminServer.Shutdown()
+		}
+	}
 }
 
 func startAll(configFilePath string) error {
+	listeners, err := handoff.Inherit()
+	if err != nil {
+		return fmt.Errorf("failed to inherit listeners: %w", err)
+	}
+
 	// Load configurations
 	tunnelConfig := config.Load(configFilePath)
 	adminCfg := &tunnelConfig.Admin
 	adminCfg.Version = version
+	defer startTracing(tunnelConfig)()
 
 	// Run auto-migrations if enabled
 	if err := runAutoMigrations(tunnelConfig); err != nil {
@@ -267,26 +354,52 @@ func startAll(configFilePath string) error {
 	_db.Connect()
 
 	tunnelService := service.New(_db)
-	reconcileTunnelConnections(tunnelService)
 	proxyServer := proxy.New(tunnelConfig)
+	proxyServer.SetErrorPages(errorpage.New(tunnelService))
+	mirrors := mirror.New(tunnelService)
+	proxyServer.SetMirrors(mirrors)
+	proxyServer.SetSplits(split.New(tunnelService))
+	proxyServer.SetVisitorWarnings(visitorwarning.New(tunnelService))
 	sshServer := sshd.New(&tunnelConfig.Ssh, proxyServer, tunnelService)
-	cronJob := cron.New(tunnelConfig, tunnelService)
+	inheritTunnels(tunnelService, proxyServer)
+	cronJob := cron.New(sshServer, sshServer, mirrors, startBandwidth(tunnelService, proxyServer, sshServer), startAccessLog(tunnelConfig, tunnelService, proxyServer, sshServer), startCache(tunnelConfig, tunnelService, proxyServer))
 	adminServer := admin.NewServer(adminCfg, _db.Conn)
+	sshServer.SetLoginThrottle(adminServer.Throttle())
+	reload := configReloader(tunnelConfig)
+	adminServer.SetConfigReloader(reload)
+
+	if err := sshServer.Prepare(); err != nil {
+		return fmt.Errorf("failed to prepare SSH server: %w", err)
+	}
+	proxyListener, err := listeners.Listen("proxy", proxyServer.GetServerAddr())
+	if err != nil {
+		return fmt.Errorf("failed to listen for proxy server: %w", err)
+	}
+	sshListener, err := listeners.Listen("ssh", sshServer.GetServerAddr())
+	if err != nil {
+		return fmt.Errorf("failed to listen for SSH server: %w", err)
+	}
+	adminListener, err := listeners.Listen("admin", adminServer.GetServerAddr())
+	if err != nil {
+		return fmt.Errorf("failed to listen for admin server: %w", err)
+	}
+	listeners.CloseUnused()
 
 	// Use WaitGroup to track all servers
 	var wg sync.WaitGroup
 	ctx, cancel := context.WithCancel(context.Background())
+	watchReloadSignal(ctx, reload)
 
 	// Start tunnel components
 	wg.Add(3)
 	go func() {
 		defer wg.Done()
-		proxyServer.Start()
+		proxyServer.Start(proxyListener)
 	}()
 
 	go func() {
 		defer wg.Done()
-		sshServer.Start()
+		sshServer.Start(sshListener)
 	}()
 
 	go func() {
@@ -298,20 +411,32 @@ func startAll(configFilePath string) error {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := adminServer.Start(); err != nil {
+		if err := adminServer.Start(adminListener); err != nil {
 			log.Error("Admin server error", "error", err)
 			cancel()
 		}
 	}()
+	reportReady()
 
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-
-	select {
-	case <-done:
-		log.Info("Received shutdown signal")
-	case <-ctx.Done():
-		log.Info("Context cancelled due to error")
+	upgrade := upgradeSignal()
+
+	var fallback net.Listener
+waitLoop:
+	for {
+		select {
+		case <-done:
+			log.Info("Received shutdown signal")
+			break waitLoop
+		case <-ctx.Done():
+			log.Info("Context cancelled due to error")
+			break waitLoop
+		case <-upgrade:
+			if fallback = handOff(listeners); fallback != nil {
+				break waitLoop
+			}
+		}
 	}
 
 	// Shutdown all services
@@ -330,8 +455,12 @@ func startAll(configFilePath string) error {
 
 	// Shutdown tunnel components
 	cronJob.Shutdown()
-	proxyServer.Shutdown(shutdownCtx)
-	sshServer.Shutdown(shutdownCtx)
+	if fallback != nil {
+		drainTunnels(tunnelConfig, proxyServer, sshServer, fallback)
+	} else {
+		proxyServer.Shutdown(shutdownCtx)
+		sshServer.Shutdown(shutdownCtx)
+	}
 
 	// Wait for all goroutines to finish
 	cancel()
@@ -345,6 +474,154 @@ func startAll(configFilePath string) error {
 	return nil
 }
 
+// startTracing exports spans when PORTR_OTEL_ENDPOINT is set, and returns
+// the function that flushes them on shutdown.
+func startTracing(cfg *config.Config) func() {
+	shutdown, err := tracing.Start(context.Background(), "portrd", version, cfg.OTLPEndpoint)
+	if err != nil {
+		log.Fatal("Failed to start tracing", "error", err)
+	}
+	if cfg.OTLPEndpoint != "" {
+		log.Info("Exporting traces", "endpoint", cfg.OTLPEndpoint)
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			log.Warn("Failed to flush traces", "error", err)
+		}
+	}
+}
+
+// startBandwidth meters tunnel traffic against the quotas set in the admin
+// API, and returns the meter for the cron job that saves usage and reloads
+// limits.
+func startBandwidth(tunnelService *service.Service, proxyServer *proxy.Proxy, sshServer *sshd.SshServer) cron.BandwidthMeter {
+	meter := bandwidth.New(tunnelService)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	meter.Refresh(ctx)
+	sshServer.SetBandwidth(meter)
+	proxyServer.SetBandwidthQuotas(sshServer)
+	return meter
+}
+
+// startAccessLog makes the proxy record the requests it serves when the
+// access log is enabled, and returns the log for the cron jobs to flush and
+// prune. It returns nil when the access log is disabled.
+func startAccessLog(cfg *config.Config, tunnelService *service.Service, proxyServer *proxy.Proxy, sshServer *sshd.SshServer) cron.AccessLogWriter {
+	if !cfg.AccessLog.Enabled {
+		return nil
+	}
+	accessLog := accesslog.New(tunnelService, sshServer, cfg.AccessLog.Retention)
+	proxyServer.SetAccessLog(accessLog)
+	return accessLog
+}
+
+// startCache makes the proxy cache the responses tunnels mark cacheable when
+// PORTR_PROXY_CACHE_MB is set, and returns the cache for the cron job that
+// applies purges. It returns nil when the cache is off.
+func startCache(cfg *config.Config, tunnelService *service.Service, proxyServer *proxy.Proxy) cron.CachePurger {
+	if cfg.Proxy.CacheMaxBytes == 0 {
+		return nil
+	}
+	cache := edgecache.New(tunnelService, cfg.Proxy.CacheMaxBytes)
+	proxyServer.SetCache(cache)
+	log.Info("Caching tunnel responses", "max_mb", cfg.Proxy.CacheMaxBytes>>20)
+	return cache
+}
+
+// inheritTunnels points the proxy at the process this one replaced, which
+// keeps serving its tunnels until they reconnect here. Without a predecessor,
+// any connection still marked active is stale and gets closed.
+func inheritTunnels(tunnelService *service.Service, proxyServer *proxy.Proxy) {
+	if predecessor := handoff.Predecessor(); predecessor != "" {
+		proxyServer.SetPredecessor(predecessor)
+		return
+	}
+	reconcileTunnelConnections(tunnelService)
+}
+
+func reportReady() {
+	if err := handoff.Ready(); err != nil {
+		log.Warn("Failed to report readiness", "error", err)
+	}
+}
+
+// upgradeSignal returns a channel receiving SIGUSR2, which asks portrd to
+// hand its listeners to a new copy of itself and drain.
+func upgradeSignal() chan os.Signal {
+	upgrade := make(chan os.Signal, 1)
+	signal.Notify(upgrade, syscall.SIGUSR2)
+	return upgrade
+}
+
+// handOff starts a new portrd with the listeners of this one. It returns the
+// loopback listener on which this process keeps serving the tunnels still
+// attached to it, or nil when the new process failed and this one carries on.
+func handOff(listeners *handoff.Listeners) net.Listener {
+	fallback, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Error("Failed to listen for handoff proxy", "error", err)
+		return nil
+	}
+	log.Info("Handing listeners to a new process")
+	if err := listeners.Upgrade(context.Background(), config.Environ(), fallback.Addr().String()); err != nil {
+		log.Error("Failed to hand listeners to a new process", "error", err)
+		_ = fallback.Close()
+		return nil
+	}
+	log.Info("New process is ready")
+	return fallback
+}
+
+// drainTunnels keeps serving the tunnels of this process on fallback until
+// their clients reconnect to the new process or the drain timeout passes.
+func drainTunnels(cfg *config.Config, proxyServer *proxy.Proxy, sshServer *sshd.SshServer, fallback net.Listener) {
+	proxyServer.Retire(fallback)
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), cfg.Ssh.DrainTimeout)
+	defer cancel()
+	sshServer.Drain(drainCtx, "server restart")
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer shutdownCancel()
+	proxyServer.Shutdown(shutdownCtx)
+}
+
+// configReloader returns the reload function for a running portrd. Every
+// component shares cfg, so applying the reloaded settings to it reaches the
+// proxy, sshd, cron and admin server at once.
+func configReloader(cfg *config.Config) config.ReloadFunc {
+	return func() (config.ReloadReport, error) {
+		next, err := config.Reload()
+		if err != nil {
+			log.Error("Failed to reload configuration", "error", err)
+			return config.ReloadReport{}, err
+		}
+		report := cfg.Apply(next)
+		log.Info("Reloaded configuration", "applied", report.Applied, "requires_restart", report.RequiresRestart)
+		return report, nil
+	}
+}
+
+// watchReloadSignal reloads the configuration on every SIGHUP until ctx is done.
+func watchReloadSignal(ctx context.Context, reload config.ReloadFunc) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hangup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangup:
+				_, _ = reload()
+			}
+		}
+	}()
+}
+
 func reconcileTunnelConnections(tunnelService *service.Service) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -51,4 +51,14 @@ func TestMigrationsUpgradeFromPreviousRelease(t *testing.T) {
 	if count != 1 {
 		t.Fatalf("expected one auto-signup settings row, got %d", count)
 	}
+
+	if _, err := database.Exec("INSERT INTO audit_log (action, created_at) VALUES ('auth.login', CURRENT_TIMESTAMP)"); err != nil {
+		t.Fatalf("insert audit log entry: %v", err)
+	}
+	if _, err := database.Exec("UPDATE audit_log SET action = 'auth.logout'"); err == nil {
+		t.Fatal("expected the audit log to reject updates")
+	}
+	if _, err := database.Exec("DELETE FROM audit_log"); err == nil {
+		t.Fatal("expected the audit log to reject deletes")
+	}
 }
@@ -403,6 +403,8 @@ func (m *Manager) handleSSHEvent(id string, event sshclient.Event) {
 		stoppedAt := now
 		tunnel.status.Status = statusStopped
 		tunnel.status.StoppedAt = &stoppedAt
+	case sshclient.EventClosed:
+		tunnel.status.LastError = event.Error
 	case sshclient.EventFailed:
 		if tunnel.status.Status == statusFailed && tunnel.status.LastError == event.Error {
 			shouldRecord = false
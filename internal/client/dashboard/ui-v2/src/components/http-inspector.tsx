@@ -74,7 +74,7 @@ export function RequestSidebar({
 
   const filtered = React.useMemo(() => {
     return requests.filter((r) => {
-      if (query && !r.Url.toLowerCase().includes(query.toLowerCase())) return false
+      if (query && !r.Url.toLowerCase().includes(query.toLowerCase()) && r.ID !== query.trim()) return false
       if (methodFilter.size > 0 && !methodFilter.has(r.Method.toUpperCase())) return false
       if (statusFilter !== "all") {
         const bucket = `${Math.floor(r.ResponseStatusCode / 100)}xx` as StatusFilter
@@ -98,7 +98,7 @@ export function RequestSidebar({
           />
           <input
             ref={searchRef}
-            placeholder="filter path..."
+            placeholder="filter path or request id..."
             value={query}
             onChange={(e) => setQuery(e.target.value)}
             className="h-7 w-full rounded-[4px] border border-border bg-background pl-6 font-mono text-xs outline-none focus:border-foreground/40"
@@ -419,6 +419,10 @@ export function RequestDetailPane({
           <span style={{ color: "var(--tm-muted-2)" }}>host </span>
           <span style={{ color: "var(--tm-ink-2)" }}>{request.Host}</span>
         </span>
+        <span>
+          <span style={{ color: "var(--tm-muted-2)" }}>id </span>
+          <span style={{ color: "var(--tm-ink-2)" }}>{request.ID}</span>
+        </span>
         {request.IsReplayed ? (
           <span
             className="rounded-[3px] px-1.5"
@@ -148,7 +148,9 @@ func (s *Store) List(subdomain string, opts QueryOptions) ([]clientdb.Request, e
 	}
 
 	if normalized.Filter != "" {
-		query = query.Where("LOWER(url) LIKE ? ESCAPE '\\'", likePattern(normalized.Filter))
+		// The filter matches a path fragment or a whole request ID, which
+		// the server and visitors see in X-Portr-Request-Id.
+		query = query.Where("(LOWER(url) LIKE ? ESCAPE '\\' OR id = ?)", likePattern(normalized.Filter), normalized.Filter)
 	}
 
 	var requests []clientdb.Request
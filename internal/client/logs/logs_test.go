@@ -155,6 +155,11 @@ func TestStoreListAppliesCountSinceAndFilter(t *testing.T) {
 	if requests[0].ID != "req-3" {
 		t.Fatalf("expected req-3, got %s", requests[0].ID)
 	}
+
+	requests, err = store.List("demo", QueryOptions{Filter: "req-1"})
+	if err != nil || len(requests) != 1 || requests[0].ID != "req-1" {
+		t.Fatalf("expected the filter to find a request by ID, got %v %v", requests, err)
+	}
 }
 
 func TestStoreListRejectsInvalidCount(t *testing.T) {
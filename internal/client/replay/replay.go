@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/amalshaji/portr/internal/client/db"
+	"github.com/amalshaji/portr/internal/utils"
 	"github.com/go-resty/resty/v2"
 	"gorm.io/datatypes"
 )
@@ -162,6 +163,8 @@ func buildHeaders(requestID string, raw datatypes.JSON, opts EditOptions) (map[s
 		deleteHeader(headers, key)
 	}
 
+	// A replay is a new request and gets its own ID.
+	deleteHeader(headers, utils.RequestIDHeader)
 	setHeader(headers, "X-Portr-Replayed-Request-Id", requestID)
 	return headers, nil
 }
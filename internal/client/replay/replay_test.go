@@ -24,6 +24,7 @@ func TestExecuteUsesOriginalRequestAndInjectsReplayHeader(t *testing.T) {
 		Path          string
 		Authorization string
 		ReplayID      string
+		RequestID     string
 		ContentLength string
 		Body          string
 	}
@@ -40,6 +41,7 @@ func TestExecuteUsesOriginalRequestAndInjectsReplayHeader(t *testing.T) {
 			Path:          r.URL.RequestURI(),
 			Authorization: r.Header.Get("Authorization"),
 			ReplayID:      r.Header.Get("X-Portr-Replayed-Request-Id"),
+			RequestID:     r.Header.Get("X-Portr-Request-Id"),
 			ContentLength: r.Header.Get("Content-Length"),
 			Body:          string(payload),
 		}
@@ -54,7 +56,7 @@ func TestExecuteUsesOriginalRequestAndInjectsReplayHeader(t *testing.T) {
 		Host:    strings.TrimPrefix(server.URL, "https://"),
 		Url:     "/submit?x=1",
 		Method:  "POST",
-		Headers: mustJSONHeaders(t, map[string][]string{"Authorization": {"Bearer token"}, "Content-Length": {"999"}}),
+		Headers: mustJSONHeaders(t, map[string][]string{"Authorization": {"Bearer token"}, "Content-Length": {"999"}, "X-Portr-Request-Id": {"req-1"}}),
 		Body:    []byte("hello"),
 	}
 
@@ -75,6 +77,9 @@ func TestExecuteUsesOriginalRequestAndInjectsReplayHeader(t *testing.T) {
 	if observed.ReplayID != "req-1" {
 		t.Fatalf("expected replay id req-1, got %q", observed.ReplayID)
 	}
+	if observed.RequestID != "" {
+		t.Fatalf("expected the original request id to be dropped, got %q", observed.RequestID)
+	}
 	if observed.ContentLength == "999" {
 		t.Fatalf("expected content-length to be recomputed, got %q", observed.ContentLength)
 	}
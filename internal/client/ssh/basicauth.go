@@ -5,8 +5,6 @@ import (
 	"crypto/subtle"
 	"io"
 	"net/http"
-
-	"github.com/oklog/ulid/v2"
 )
 
 // basicAuthChallenge is the WWW-Authenticate value sent with every 401. Without
@@ -84,7 +82,7 @@ func (s *SshClient) rejectUnauthorized(writer http.ResponseWriter, request *http
 	}
 
 	s.submitCapture(httpCaptureTask{
-		id:      ulid.Make().String(),
+		id:      captureID(request),
 		request: cloneRequestForLog(request),
 		response: &http.Response{
 			StatusCode: http.StatusUnauthorized,
@@ -98,7 +98,13 @@ type httpCaptureTask struct {
 }
 
 func (t httpCaptureTask) persist(client *SshClient) {
-	client.logHttpRequestSized(
+	t.store(client)
+}
+
+// store saves the capture and returns the ID it was stored under, which
+// differs from t.id when a visitor reused a request ID.
+func (t httpCaptureTask) store(client *SshClient) string {
+	return client.logHttpRequestSized(
 		t.id,
 		t.request,
 		t.requestBody,
@@ -124,8 +130,11 @@ type websocketOpenCaptureTask struct {
 }
 
 func (t websocketOpenCaptureTask) persist(client *SshClient) {
-	t.handshake.persist(client)
-	client.logWebSocketSessionWithID(t.sessionID, t.handshake.id, t.request, t.response)
+	handshakeID := t.handshake.store(client)
+	if handshakeID == "" {
+		handshakeID = t.handshake.id
+	}
+	client.logWebSocketSessionWithID(t.sessionID, handshakeID, t.request, t.response)
 }
 
 func (t websocketEventCaptureTask) persist(client *SshClient) {
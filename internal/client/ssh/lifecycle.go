@@ -114,9 +114,28 @@ func (s *SshClient) Start(ctx context.Context) error {
 		if lifecycleCtx.Err() != nil || atomic.LoadInt32(&s.shutdown) == 1 || errors.Is(err, errClientShuttingDown) {
 			return nil
 		}
-		s.announceTransportLost(err)
+		// The server closed the tunnel under one of its policies; reconnecting
+		// would only open it again.
+		var closed *errTunnelClosed
+		if errors.As(err, &closed) {
+			s.announceTransportClosed(closed)
+			return fmt.Errorf("tunnel '%s' was closed by the server: %w", s.config.Tunnel.DisplayName(), closed)
+		}
+		// A goaway is a planned reconnect: wait as long as the server asked,
+		// and keep retrying outside the retry budget while it comes back.
+		budget := reconnectBudget{maxRetries: maxRetries}
+		var goAway *errServerGoingAway
+		if errors.As(err, &goAway) {
+			s.announceTransportMoving(goAway)
+			if !waitForReconnect(lifecycleCtx, goAwayDelay(goAway.notice)) {
+				return nil
+			}
+			budget.plannedUntil = time.Now().Add(plannedReconnectWindow(goAway.notice))
+		} else {
+			s.announceTransportLost(err)
+		}
 
-		for attempt := 1; ; attempt++ {
+		for {
 			transport, err = s.establishWithTimeout(lifecycleCtx)
 			if err == nil && s.installTransport(lifecycleCtx, transport) {
 				s.announceTransportReady(false)
@@ -125,10 +144,18 @@ func (s *SshClient) Start(ctx context.Context) error {
 			if lifecycleCtx.Err() != nil || atomic.LoadInt32(&s.shutdown) == 1 {
 				return nil
 			}
+			if errors.Is(err, ErrTunnelExpired) {
+				return fmt.Errorf("tunnel '%s' expired", s.config.Tunnel.DisplayName())
+			}
+			attempt, planned, exhausted := budget.fail(time.Now())
 			if s.config.Debug {
-				s.logDebug(fmt.Sprintf("Failed to reconnect to ssh tunnel (attempt %d)", attempt), err)
+				if planned {
+					s.logDebug(fmt.Sprintf("Failed to reconnect to ssh tunnel during a planned reconnect (attempt %d)", attempt), err)
+				} else {
+					s.logDebug(fmt.Sprintf("Failed to reconnect to ssh tunnel (attempt %d)", attempt), err)
+				}
 			}
-			if attempt >= maxRetries {
+			if exhausted {
 				return fmt.Errorf("failed to reconnect tunnel '%s' after %d attempts: %w", s.config.Tunnel.DisplayName(), attempt, err)
 			}
 			if !waitForReconnect(lifecycleCtx, reconnectBackoff(attempt)) {
@@ -144,6 +171,44 @@ func (s *SshClient) establishWithTimeout(ctx context.Context) (*tunnelTransport,
 	return s.establishTransport(setupCtx)
 }
 
+// goAwayDelay is the wait before a planned reconnect: the server's hint plus
+// jitter, so clients of a restarting server don't all reconnect at once.
+func goAwayDelay(notice goAwayNotice) time.Duration {
+	return time.Duration(notice.RetryAfter)*time.Second + time.Duration(rand.IntN(1000))*time.Millisecond
+}
+
+// plannedReconnectGrace is how long, after the delay a goaway asks for,
+// failed reconnects are expected while the server comes back and do not
+// count against health_check_max_retries.
+const plannedReconnectGrace = 30 * time.Second
+
+// plannedReconnectWindow is how long after the goaway wait reconnects are
+// still part of the planned reconnect.
+func plannedReconnectWindow(notice goAwayNotice) time.Duration {
+	return time.Duration(notice.RetryAfter)*time.Second + plannedReconnectGrace
+}
+
+// reconnectBudget counts the failed reconnects of one outage. Failures
+// before plannedUntil are counted on their own and never exhaust it.
+type reconnectBudget struct {
+	maxRetries   int
+	plannedUntil time.Time
+	planned      int
+	attempts     int
+}
+
+// fail records a reconnect that failed at now. It returns the attempt number
+// to back off by, whether the attempt was part of a planned reconnect, and
+// whether the retry budget is used up.
+func (b *reconnectBudget) fail(now time.Time) (attempt int, planned bool, exhausted bool) {
+	if now.Before(b.plannedUntil) {
+		b.planned++
+		return b.planned, true, false
+	}
+	b.attempts++
+	return b.attempts, false, b.attempts >= b.maxRetries
+}
+
 func waitForReconnect(ctx context.Context, delay time.Duration) bool {
 	timer := time.NewTimer(delay)
 	defer timer.Stop()
@@ -180,6 +245,14 @@ func (s *SshClient) monitorTransport(ctx context.Context, transport *tunnelTrans
 			return errClientShuttingDown
 		case err := <-serveErr:
 			return err
+		case notice := <-transport.goAway:
+			_ = transport.Close()
+			<-serveErr
+			return &errServerGoingAway{notice: notice}
+		case notice := <-transport.closed:
+			_ = transport.Close()
+			<-serveErr
+			return &errTunnelClosed{notice: notice}
 		case <-ticker.C:
 			if err := checkSSHKeepAlive(transport.client, 5*time.Second); err != nil {
 				_ = transport.Close()
@@ -229,6 +302,46 @@ func (s *SshClient) announceTransportLost(err error) {
 	s.emitEvent(EventUnhealthy, err)
 }
 
+// announceTransportMoving reports a reconnect requested by the server. Unlike
+// a lost transport it is expected, so the tunnel is shown as reconnecting
+// rather than unhealthy.
+func (s *SshClient) announceTransportMoving(goAway *errServerGoingAway) {
+	cfg := s.ConfigSnapshot()
+	if s.config.Debug {
+		s.logDebug("Server asked the tunnel to reconnect", goAway)
+	}
+	if s.tui != nil {
+		s.tui.Send(tui.UpdateConnCountMsg{Port: cfg.Tunnel.StatusKey(), Delta: -1})
+		s.tui.Send(tui.ReconnectingMsg{Port: cfg.Tunnel.StatusKey()})
+	} else if !cfg.DisableTerminalLogs {
+		fmt.Printf("🔄 Tunnel reconnecting: %s (%s)\n", cfg.GetTunnelAddr(), goAway.reason())
+	}
+	s.emitEvent(EventReconnecting, goAway)
+}
+
+// announceTransportClosed reports a tunnel the server closed for good.
+func (s *SshClient) announceTransportClosed(closed *errTunnelClosed) {
+	cfg := s.ConfigSnapshot()
+	if s.tui != nil {
+		s.tui.Send(tui.UpdateConnCountMsg{Port: cfg.Tunnel.StatusKey(), Delta: -1})
+		s.tui.Send(tui.UpdateHealthMsg{Port: cfg.Tunnel.StatusKey(), Healthy: false})
+	} else if !cfg.DisableTerminalLogs {
+		fmt.Printf("⏹️  Tunnel closed: %s (%s)\n", cfg.GetTunnelAddr(), closed)
+	}
+	s.emitEvent(EventClosed, closed)
+}
+
+// announceServerNotice shows a message the server sent about the tunnel,
+// such as a bandwidth quota warning.
+func (s *SshClient) announceServerNotice(message string) {
+	cfg := s.ConfigSnapshot()
+	if s.tui != nil {
+		s.tui.Send(tui.ServerNoticeMsg{Message: message})
+	} else if !cfg.DisableTerminalLogs {
+		fmt.Printf("⚠️  %s: %s\n", cfg.GetTunnelAddr(), message)
+	}
+}
+
 func (s *SshClient) HealthCheck() error {
 	s.mu.RLock()
 	transport := s.transport
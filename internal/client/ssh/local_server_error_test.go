@@ -160,3 +160,12 @@ func TestHTTPTunnelReusesForwardedConnection(t *testing.T) {
 		t.Fatalf("expected two persisted requests, got %d", persisted)
 	}
 }
+
+func TestHTTPTunnelReturnsJSONErrorWhenAccepted(t *testing.T) {
+	response := runTunnelRequest(t, startClosingTCPServer(t), "GET / HTTP/1.1\r\nHost: test.example\r\nAccept: application/json\r\nConnection: close\r\n\r\n")
+	assertLocalServerUnavailable(t, response)
+	if !strings.Contains(response, "Content-Type: application/json") ||
+		!strings.Contains(response, `{"code":"local-server-not-online","message":"The tunnel's local server is not responding","subdomain":"test"}`) {
+		t.Fatalf("expected a JSON error, got %q", response)
+	}
+}
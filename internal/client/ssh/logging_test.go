@@ -10,6 +10,7 @@ import (
 
 	clientdb "github.com/amalshaji/portr/internal/client/db"
 	clientcfg "github.com/amalshaji/portr/internal/clientconfig"
+	"github.com/amalshaji/portr/internal/utils"
 	"github.com/glebarez/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -293,3 +294,32 @@ func TestLogWebSocketSessionPersistsWhenRequestLoggingEnabled(t *testing.T) {
 		t.Fatalf("expected 1 stored websocket event, got %d", eventCount)
 	}
 }
+
+func TestLogHttpRequestUsesTheServerRequestID(t *testing.T) {
+	store := newTestRequestStore(t)
+	client := newLoggingTestClient(store, true)
+	request, response := newHTTPLogFixtures()
+	request.Header.Set(utils.RequestIDHeader, "trace-1")
+
+	first := client.logHttpRequestSized(captureID(request), request, nil, response, nil, 1, 0, 0)
+	second := client.logHttpRequestSized(captureID(request), request, nil, response, nil, 1, 0, 0)
+	if first != "trace-1" {
+		t.Fatalf("expected the capture to be stored under the server's ID, got %q", first)
+	}
+	if second == "" || second == first {
+		t.Fatalf("expected a reused ID to be stored under a fresh one, got %q", second)
+	}
+
+	var count int64
+	if err := store.Conn.Model(&clientdb.Request{}).Count(&count).Error; err != nil {
+		t.Fatalf("count requests: %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("expected both requests stored, got %d", count)
+	}
+
+	request.Header.Set(utils.RequestIDHeader, "not valid")
+	if id := captureID(request); id == "not valid" || !utils.ValidRequestID(id) {
+		t.Fatalf("expected an invalid ID to be replaced, got %q", id)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/amalshaji/portr/internal/constants"
+	"golang.org/x/crypto/ssh"
 )
 
 type captureTaskFunc func()
@@ -65,6 +66,76 @@ func TestCheckSSHKeepAliveTimesOut(t *testing.T) {
 	}
 }
 
+func TestFilterGoAwayDeliversNoticeAndPassesOtherRequests(t *testing.T) {
+	requests := make(chan *ssh.Request, 2)
+	requests <- &ssh.Request{Type: "keepalive@openssh.com"}
+	requests <- &ssh.Request{
+		Type:    goAwayRequestType,
+		Payload: ssh.Marshal(&goAwayNotice{Reason: "server restart", RetryAfter: 2}),
+	}
+	close(requests)
+
+	passed, goAway, _ := filterGoAway(requests, nil)
+	var passedTypes []string
+	for request := range passed {
+		passedTypes = append(passedTypes, request.Type)
+	}
+	if len(passedTypes) != 1 || passedTypes[0] != "keepalive@openssh.com" {
+		t.Fatalf("expected only keepalive to pass through, got %v", passedTypes)
+	}
+	select {
+	case notice := <-goAway:
+		if notice.Reason != "server restart" || notice.RetryAfter != 2 {
+			t.Fatalf("unexpected notice %+v", notice)
+		}
+	default:
+		t.Fatal("expected goaway notice")
+	}
+}
+
+func TestFilterGoAwayAnnouncesServerNotices(t *testing.T) {
+	requests := make(chan *ssh.Request, 1)
+	requests <- &ssh.Request{
+		Type:    noticeRequestType,
+		Payload: ssh.Marshal(&serverNotice{Message: "Your tunnels have used 80% of your monthly bandwidth"}),
+	}
+	close(requests)
+
+	var notices []string
+	passed, _, _ := filterGoAway(requests, func(message string) {
+		notices = append(notices, message)
+	})
+	for request := range passed {
+		t.Fatalf("expected the notice to be consumed, got %s", request.Type)
+	}
+	if len(notices) != 1 || notices[0] != "Your tunnels have used 80% of your monthly bandwidth" {
+		t.Fatalf("unexpected notices %v", notices)
+	}
+}
+
+func TestFilterGoAwayReportsClosedTunnels(t *testing.T) {
+	requests := make(chan *ssh.Request, 1)
+	requests <- &ssh.Request{
+		Type:    closedRequestType,
+		Payload: ssh.Marshal(&closedNotice{Reason: "idle_timeout", Message: "Tunnel closed after 30m without traffic"}),
+	}
+	close(requests)
+
+	passed, _, closed := filterGoAway(requests, nil)
+	for request := range passed {
+		t.Fatalf("expected the closed notice to be consumed, got %s", request.Type)
+	}
+	select {
+	case notice := <-closed:
+		err := &errTunnelClosed{notice: notice}
+		if notice.Reason != "idle_timeout" || err.Error() != "Tunnel closed after 30m without traffic" {
+			t.Fatalf("unexpected notice %+v", notice)
+		}
+	default:
+		t.Fatal("expected closed notice")
+	}
+}
+
 func TestBodyCaptureIsBounded(t *testing.T) {
 	capture := &bodyCapture{}
 	capture.Write(bytes.Repeat([]byte("x"), maxCapturedBodyBytes+1024))
@@ -216,6 +287,25 @@ func TestReconnectBackoffIsBounded(t *testing.T) {
 	}
 }
 
+func TestReconnectBudgetExcludesPlannedReconnects(t *testing.T) {
+	now := time.Now()
+	budget := reconnectBudget{maxRetries: 2, plannedUntil: now.Add(plannedReconnectWindow(goAwayNotice{RetryAfter: 5}))}
+	for i := 1; i <= 10; i++ {
+		attempt, planned, exhausted := budget.fail(now.Add(time.Duration(i) * time.Second))
+		if attempt != i || !planned || exhausted {
+			t.Fatalf("planned failure %d: got attempt %d, planned %t, exhausted %t", i, attempt, planned, exhausted)
+		}
+	}
+
+	after := now.Add(time.Minute)
+	if attempt, planned, exhausted := budget.fail(after); attempt != 1 || planned || exhausted {
+		t.Fatalf("first failure after the window: got attempt %d, planned %t, exhausted %t", attempt, planned, exhausted)
+	}
+	if attempt, _, exhausted := budget.fail(after); attempt != 2 || !exhausted {
+		t.Fatalf("expected the budget to be used up on attempt %d, got exhausted %t", attempt, exhausted)
+	}
+}
+
 func TestHTTPRemotePortsRemainLegacyServerCompatible(t *testing.T) {
 	for _, port := range remotePortCandidates(constants.Http) {
 		if port == 0 || port < 20000 || port > 30000 {
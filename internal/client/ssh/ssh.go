@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net"
 	"net/http"
 	"net/http/httputil"
@@ -17,9 +18,11 @@ import (
 
 	"github.com/amalshaji/portr/internal/client/db"
 	config "github.com/amalshaji/portr/internal/clientconfig"
+	"github.com/amalshaji/portr/internal/tracing"
 	"github.com/amalshaji/portr/internal/utils"
 	"github.com/charmbracelet/log"
 	"github.com/go-resty/resty/v2"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/datatypes"
 
 	"github.com/amalshaji/portr/internal/client/tui"
@@ -30,6 +33,7 @@ import (
 var (
 	ErrLocalSetupIncomplete = fmt.Errorf("local setup incomplete")
 	ErrReservedSubdomain    = errors.New("This is a reserved subdomain")
+	ErrTunnelExpired        = errors.New("tunnel expired")
 	errClientShuttingDown   = errors.New("client is shutting down")
 	newRestyClient          = resty.New
 	tunnelStartTimeout      = 20 * time.Second
@@ -53,11 +57,13 @@ type SshClient struct {
 type EventType string
 
 const (
-	EventStarted     EventType = "started"
-	EventStopped     EventType = "stopped"
-	EventUnhealthy   EventType = "unhealthy"
-	EventReconnected EventType = "reconnected"
-	EventFailed      EventType = "failed"
+	EventStarted      EventType = "started"
+	EventStopped      EventType = "stopped"
+	EventUnhealthy    EventType = "unhealthy"
+	EventReconnecting EventType = "reconnecting"
+	EventReconnected  EventType = "reconnected"
+	EventFailed       EventType = "failed"
+	EventClosed       EventType = "closed"
 )
 
 type Event struct {
@@ -184,6 +190,13 @@ func CreateNewConnectionWithContext(ctx context.Context, cfg config.ClientConfig
 	if cfg.Tunnel.Type.IsHTTPLike() {
 		payload["subdomain"] = cfg.Tunnel.Subdomain
 	}
+	if !cfg.ExpiresAt.IsZero() {
+		remaining := time.Until(cfg.ExpiresAt)
+		if remaining <= 0 {
+			return "", ErrTunnelExpired
+		}
+		payload["expires_in"] = int64(math.Ceil(remaining.Seconds()))
+	}
 
 	resp, err := request.SetContext(ctx).SetBody(payload).Post(cfg.GetServerAddr() + "/api/v1/connections/")
 
@@ -214,8 +227,37 @@ func (s *SshClient) httpTunnel(src net.Conn, localEndpoint string) {
 	s.httpTunnelReverseProxy(src, localEndpoint)
 }
 
-func writeLocalServerUnavailable(writer io.Writer, localEndpoint string) error {
-	htmlContent := []byte(utils.LocalServerNotOnline(localEndpoint))
+// localServerUnavailablePage returns the local-server-not-online error in the
+// form the visitor asked for.
+func (s *SshClient) localServerUnavailablePage(request *http.Request, localEndpoint string) (string, []byte) {
+	requestID := forwardedRequestID(request)
+	if utils.WantsJSON(request.Header.Get("Accept")) {
+		return "application/json", utils.ErrorJSON(utils.ErrorReasonLocalServerNotOnline, s.config.Tunnel.Subdomain, requestID)
+	}
+	return "text/html", []byte(utils.LocalServerNotOnline(localEndpoint, requestID))
+}
+
+// forwardedRequestID returns the ID the portr server assigned to the
+// request, or "" from servers that predate request IDs.
+func forwardedRequestID(request *http.Request) string {
+	requestID := request.Header.Get(utils.RequestIDHeader)
+	if !utils.ValidRequestID(requestID) {
+		return ""
+	}
+	return requestID
+}
+
+// captureID is the ID a request is stored under in the inspector: the
+// server's request ID, so the two can be matched, or a fresh one.
+func captureID(request *http.Request) string {
+	if requestID := forwardedRequestID(request); requestID != "" {
+		return requestID
+	}
+	return ulid.Make().String()
+}
+
+func (s *SshClient) writeLocalServerUnavailable(writer io.Writer, request *http.Request, localEndpoint string) error {
+	contentType, content := s.localServerUnavailablePage(request, localEndpoint)
 	response := &http.Response{
 		Status:        "503 Service Unavailable",
 		StatusCode:    http.StatusServiceUnavailable,
@@ -223,12 +265,12 @@ func writeLocalServerUnavailable(writer io.Writer, localEndpoint string) error {
 		ProtoMajor:    1,
 		ProtoMinor:    1,
 		Header:        make(http.Header),
-		ContentLength: int64(len(htmlContent)),
-		Body:          io.NopCloser(bytes.NewReader(htmlContent)),
+		ContentLength: int64(len(content)),
+		Body:          io.NopCloser(bytes.NewReader(content)),
 	}
-	response.Header.Set("Content-Type", "text/html")
+	response.Header.Set("Content-Type", contentType)
 	response.Header.Set("X-Portr-Error", "true")
-	response.Header.Set("X-Portr-Error-Reason", "local-server-not-online")
+	response.Header.Set("X-Portr-Error-Reason", utils.ErrorReasonLocalServerNotOnline)
 	return response.Write(writer)
 }
 
@@ -270,6 +312,7 @@ func (s *SshClient) httpTunnelReverseProxy(src net.Conn, localEndpoint string) {
 	}
 
 	proxy.ModifyResponse = func(response *http.Response) error {
+		tracing.SetHTTPStatus(trace.SpanFromContext(response.Request.Context()), response.StatusCode)
 		logData, ok := response.Request.Context().Value(requestLogContextKey{}).(*requestLogData)
 		if !ok || logData == nil || logData.request == nil {
 			return nil
@@ -305,12 +348,16 @@ func (s *SshClient) httpTunnelReverseProxy(src net.Conn, localEndpoint string) {
 			s.logDebug("HTTP reverse proxy failed", err)
 		}
 
-		htmlContent := utils.LocalServerNotOnline(localEndpoint)
+		span := trace.SpanFromContext(request.Context())
+		span.RecordError(err)
+		tracing.SetHTTPStatus(span, http.StatusServiceUnavailable)
+
+		contentType, content := s.localServerUnavailablePage(request, localEndpoint)
 		writer.Header().Set("X-Portr-Error", "true")
-		writer.Header().Set("X-Portr-Error-Reason", "local-server-not-online")
-		writer.Header().Set("Content-Type", "text/html")
+		writer.Header().Set("X-Portr-Error-Reason", utils.ErrorReasonLocalServerNotOnline)
+		writer.Header().Set("Content-Type", contentType)
 		writer.WriteHeader(http.StatusServiceUnavailable)
-		_, _ = writer.Write([]byte(htmlContent))
+		_, _ = writer.Write(content)
 	}
 
 	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
@@ -319,14 +366,18 @@ func (s *SshClient) httpTunnelReverseProxy(src net.Conn, localEndpoint string) {
 			return
 		}
 
+		request, span := s.traceTunnelRequest(request)
+		defer span.End()
+
 		// The gate sits above the websocket branch so upgrades are covered by
 		// the same check, and because writer is still an ordinary
 		// ResponseWriter here rather than a hijacked connection.
 		//
 		// Pings stay above the gate on purpose: they never reach the local
-		// server, and the portr server answers them itself whenever it has a
-		// backend, so gating them would only break the reconciliation cron.
+		// server, and older portr servers probe tunnels with them, so gating
+		// them would only break those servers' reconciliation cron.
 		if !authGate.allow(request) {
+			tracing.SetHTTPStatus(span, http.StatusUnauthorized)
 			s.rejectUnauthorized(writer, request)
 			return
 		}
@@ -365,7 +416,7 @@ func (s *SshClient) httpTunnelReverseProxy(src net.Conn, localEndpoint string) {
 		}
 
 		logCtx := context.WithValue(request.Context(), requestLogContextKey{}, &requestLogData{
-			id:        ulid.Make().String(),
+			id:        captureID(request),
 			request:   requestForLog,
 			body:      requestCapture,
 			startTime: time.Now(),
@@ -441,13 +492,13 @@ func (s *SshClient) logHttpRequestSized(
 	durationMs int64,
 	bytesIn int64,
 	bytesOut int64,
-) {
+) string {
 	if !s.requestLoggingEnabled() {
-		return
+		return ""
 	}
 
 	if request.Header.Get("X-Portr-Ping-Request") == "true" {
-		return
+		return ""
 	}
 
 	var replayedRequestId string
@@ -465,7 +516,7 @@ func (s *SshClient) logHttpRequestSized(
 		if s.config.Debug {
 			s.logDebug("Failed to marshal request headers", err)
 		}
-		return
+		return ""
 	}
 
 	responseHeaders := redactHeaderValues(response.Header, s.config.RedactHeaders)
@@ -475,7 +526,7 @@ func (s *SshClient) logHttpRequestSized(
 		if s.config.Debug {
 			s.logDebug("Failed to marshal request headers", err)
 		}
-		return
+		return ""
 	}
 
 	req := db.Request{
@@ -499,30 +550,38 @@ func (s *SshClient) logHttpRequestSized(
 		Protocol:           request.Proto,
 	}
 	result := s.db.Conn.Create(&req)
+	if result.Error != nil && forwardedRequestID(request) == id {
+		// Visitors can send their own request ID, and may send one twice.
+		req.ID = ulid.Make().String()
+		result = s.db.Conn.Create(&req)
+	}
 	if result.Error != nil {
 		if s.config.Debug {
 			s.logDebug("Failed to log request", result.Error)
 		}
-		return
+		return ""
 	}
 
 	tunnelName := s.config.Tunnel.DisplayName()
 
 	if s.tui != nil {
 		s.tui.Send(tui.AddLogMsg{
-			Time:   req.LoggedAt.Local().Format("15:04:05"),
-			Name:   tunnelName,
-			Method: req.Method,
-			Status: req.ResponseStatusCode,
-			URL:    req.Url,
+			Time:      req.LoggedAt.Local().Format("15:04:05"),
+			Name:      tunnelName,
+			Method:    req.Method,
+			Status:    req.ResponseStatusCode,
+			URL:       req.Url,
+			RequestID: req.ID,
 		})
 	} else if !s.config.DisableTerminalLogs {
-		fmt.Printf("[%s] %s %s → %d\n",
+		fmt.Printf("[%s] %s %s → %d (%s)\n",
 			req.LoggedAt.Local().Format("15:04:05"),
 			req.Method,
 			req.Url,
-			req.ResponseStatusCode)
+			req.ResponseStatusCode,
+			req.ID)
 	}
+	return req.ID
 }
 
 func (s *SshClient) tcpTunnel(src, dst net.Conn) {
@@ -0,0 +1,29 @@
+package ssh
+
+import (
+	"net/http"
+
+	"github.com/amalshaji/portr/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceTunnelRequest starts the span of a request arriving through the
+// tunnel, as a child of the server's span, and returns the request carrying
+// it. The trace context is sent on to the local service even when tracing
+// is off, so its spans join the visitor's trace either way.
+func (s *SshClient) traceTunnelRequest(request *http.Request) (*http.Request, trace.Span) {
+	ctx, span := tracing.Tracer().Start(tracing.Extract(request.Context(), request.Header), "portr.tunnel.request",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", request.Method),
+			attribute.String("url.path", request.URL.Path),
+			attribute.String("portr.subdomain", s.config.Tunnel.Subdomain),
+			attribute.Int("portr.local_port", s.config.Tunnel.Port),
+			attribute.String("portr.request_id", forwardedRequestID(request)),
+		),
+	)
+	request = request.WithContext(ctx)
+	tracing.Inject(ctx, request.Header)
+	return request, span
+}
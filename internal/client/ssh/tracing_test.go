@@ -0,0 +1,68 @@
+package ssh
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	clientcfg "github.com/amalshaji/portr/internal/clientconfig"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const serverTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// traceparentSeenByBackend runs one traced request through the HTTP tunnel
+// and returns the traceparent the local server received.
+func traceparentSeenByBackend(t *testing.T) string {
+	t.Helper()
+
+	received := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get("Traceparent")
+	}))
+	defer backend.Close()
+
+	client := &SshClient{config: clientcfg.ClientConfig{Tunnel: clientcfg.Tunnel{
+		Name: "test", Subdomain: "test", Port: 3000,
+	}}}
+	runRawRequest(t, client, strings.TrimPrefix(backend.URL, "http://"),
+		"GET / HTTP/1.1\r\nHost: test.example\r\nTraceparent: "+serverTraceparent+"\r\nConnection: close\r\n\r\n")
+
+	select {
+	case traceparent := <-received:
+		return traceparent
+	case <-time.After(2 * time.Second):
+		t.Fatal("backend did not receive a request")
+		return ""
+	}
+}
+
+func TestHTTPTunnelPassesTraceContextWithoutTracing(t *testing.T) {
+	if got := traceparentSeenByBackend(t); got != serverTraceparent {
+		t.Fatalf("expected the server's traceparent to reach the local server, got %q", got)
+	}
+}
+
+func TestHTTPTunnelTracesRequestsInTheServersTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	got := traceparentSeenByBackend(t)
+	spans := recorder.Ended()
+	if len(spans) != 1 || spans[0].Name() != "portr.tunnel.request" {
+		t.Fatalf("expected one tunnel span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("expected the span to continue the server's trace, got parent %v", span.Parent())
+	}
+	if want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + span.SpanContext().SpanID().String() + "-01"; got != want {
+		t.Fatalf("expected the local server to get the tunnel span as parent, got %q want %q", got, want)
+	}
+}
@@ -18,8 +18,126 @@ type tunnelTransport struct {
 	client     *ssh.Client
 	listener   net.Listener
 	remotePort int
-	closeOnce  sync.Once
-	closeErr   error
+	// goAway receives the server's request to reconnect, sent before the
+	// server restarts or hands over to a new process.
+	goAway <-chan goAwayNotice
+	// closed receives the server's notice that it closed the tunnel for good,
+	// for example after an idle timeout.
+	closed    <-chan closedNotice
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// goAwayRequestType is the global request portrd sends before closing a
+// session it wants the client to re-establish.
+const goAwayRequestType = "portr-goaway@portr"
+
+type goAwayNotice struct {
+	Reason     string
+	RetryAfter uint32
+}
+
+// noticeRequestType is the global request portrd sends to show the user a
+// message, such as a bandwidth quota warning.
+const noticeRequestType = "portr-notice@portr"
+
+type serverNotice struct {
+	Message string
+}
+
+// closedRequestType is the global request portrd sends before closing a
+// tunnel that must not reconnect, such as one that expired.
+const closedRequestType = "portr-closed@portr"
+
+type closedNotice struct {
+	Reason  string
+	Message string
+}
+
+// errServerGoingAway is returned by monitorTransport when the server asked
+// the client to reconnect.
+type errServerGoingAway struct {
+	notice goAwayNotice
+}
+
+func (e *errServerGoingAway) Error() string {
+	return fmt.Sprintf("server asked the tunnel to reconnect: %s", e.reason())
+}
+
+func (e *errServerGoingAway) reason() string {
+	if e.notice.Reason == "" {
+		return "no reason given"
+	}
+	return e.notice.Reason
+}
+
+// errTunnelClosed is returned by monitorTransport when the server closed the
+// tunnel and asked the client not to reconnect.
+type errTunnelClosed struct {
+	notice closedNotice
+}
+
+func (e *errTunnelClosed) Error() string {
+	if e.notice.Message == "" {
+		return fmt.Sprintf("tunnel closed by the server (%s)", e.notice.Reason)
+	}
+	return e.notice.Message
+}
+
+// filterGoAway passes global requests through to the ssh client, except for
+// goaway and closed requests, which are delivered on the returned channels
+// instead, and notices, which are handed to onNotice.
+func filterGoAway(requests <-chan *ssh.Request, onNotice func(message string)) (<-chan *ssh.Request, <-chan goAwayNotice, <-chan closedNotice) {
+	passed := make(chan *ssh.Request)
+	goAway := make(chan goAwayNotice, 1)
+	closed := make(chan closedNotice, 1)
+	go func() {
+		defer close(passed)
+		for request := range requests {
+			if request.Type == closedRequestType {
+				var notice closedNotice
+				accepted := ssh.Unmarshal(request.Payload, &notice) == nil
+				if request.WantReply {
+					_ = request.Reply(accepted, nil)
+				}
+				if accepted {
+					select {
+					case closed <- notice:
+					default:
+					}
+				}
+				continue
+			}
+			if request.Type == noticeRequestType {
+				var notice serverNotice
+				accepted := ssh.Unmarshal(request.Payload, &notice) == nil
+				if request.WantReply {
+					_ = request.Reply(accepted, nil)
+				}
+				if accepted && onNotice != nil {
+					onNotice(notice.Message)
+				}
+				continue
+			}
+			if request.Type != goAwayRequestType {
+				passed <- request
+				continue
+			}
+			var notice goAwayNotice
+			accepted := ssh.Unmarshal(request.Payload, &notice) == nil
+			if request.WantReply {
+				_ = request.Reply(accepted, nil)
+			}
+			if !accepted {
+				continue
+			}
+			select {
+			case goAway <- notice:
+			default:
+			}
+		}
+	}()
+	return passed, goAway, closed
 }
 
 func (t *tunnelTransport) Close() error {
@@ -84,6 +202,7 @@ func (s *SshClient) establishTransport(ctx context.Context) (*tunnelTransport, e
 		return nil, err
 	}
 
+	requests, goAway, closed := filterGoAway(requests, s.announceServerNotice)
 	client := ssh.NewClient(cc, channels, requests)
 	setupDone := make(chan struct{})
 	go func() {
@@ -108,7 +227,7 @@ func (s *SshClient) establishTransport(ctx context.Context) (*tunnelTransport, e
 			listenErr = err
 			continue
 		}
-		return &tunnelTransport{client: client, listener: listener, remotePort: port}, nil
+		return &tunnelTransport{client: client, listener: listener, remotePort: port, goAway: goAway, closed: closed}, nil
 	}
 
 	_ = client.Close()
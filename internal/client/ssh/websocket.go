@@ -404,7 +404,7 @@ func (s *SshClient) handleWebSocketRequest(
 	defer cancelDial()
 	dst, err := (&net.Dialer{KeepAlive: 30 * time.Second}).DialContext(dialCtx, "tcp", localEndpoint)
 	if err != nil {
-		if writeErr := writeLocalServerUnavailable(srcWriter, localEndpoint); writeErr != nil {
+		if writeErr := s.writeLocalServerUnavailable(srcWriter, request, localEndpoint); writeErr != nil {
 			return writeErr
 		}
 		return srcWriter.Flush()
@@ -436,20 +436,20 @@ func (s *SshClient) handleWebSocketRequest(
 	}
 
 	if err := outbound.Write(dstWriter); err != nil {
-		_ = writeLocalServerUnavailable(srcWriter, localEndpoint)
+		_ = s.writeLocalServerUnavailable(srcWriter, request, localEndpoint)
 		_ = srcWriter.Flush()
 		return err
 	}
 	requestBody := requestCapture.Bytes()
 	if err := dstWriter.Flush(); err != nil {
-		_ = writeLocalServerUnavailable(srcWriter, localEndpoint)
+		_ = s.writeLocalServerUnavailable(srcWriter, request, localEndpoint)
 		_ = srcWriter.Flush()
 		return err
 	}
 
 	response, err := http.ReadResponse(dstReader, request)
 	if err != nil {
-		_ = writeLocalServerUnavailable(srcWriter, localEndpoint)
+		_ = s.writeLocalServerUnavailable(srcWriter, request, localEndpoint)
 		_ = srcWriter.Flush()
 		return err
 	}
@@ -466,9 +466,8 @@ func (s *SshClient) handleWebSocketRequest(
 		}
 
 		responseBody := responseCapture.Bytes()
-		requestID := ulid.Make().String()
 		s.submitCapture(httpCaptureTask{
-			id:           requestID,
+			id:           captureID(request),
 			request:      request,
 			requestBody:  requestBody,
 			response:     response,
@@ -486,7 +485,7 @@ func (s *SshClient) handleWebSocketRequest(
 		return err
 	}
 
-	handshakeRequestID := ulid.Make().String()
+	handshakeRequestID := captureID(request)
 	sessionID := ulid.Make().String()
 	if !s.submitCapture(websocketOpenCaptureTask{
 		handshake: httpCaptureTask{
@@ -30,6 +30,18 @@ type UpdateHealthMsg struct {
 	Healthy bool
 }
 
+// ReconnectingMsg marks a tunnel as reconnecting at the server's request, for
+// example while the server restarts. It clears once the pool is back.
+type ReconnectingMsg struct {
+	Port string
+}
+
+// ServerNoticeMsg shows a message from the server above the tunnels, such as
+// a bandwidth quota warning. A newer notice replaces it.
+type ServerNoticeMsg struct {
+	Message string
+}
+
 // UpdateConnCountMsg adjusts the active connection count for a tunnel (Delta can be +1 or -1)
 type UpdateConnCountMsg struct {
 	Port  string
@@ -37,11 +49,12 @@ type UpdateConnCountMsg struct {
 }
 
 type AddLogMsg struct {
-	Time   string
-	Name   string
-	Method string
-	Status int
-	URL    string
+	Time      string
+	Name      string
+	Method    string
+	Status    int
+	URL       string
+	RequestID string
 }
 
 // Add new message type for debug logs
@@ -99,6 +112,7 @@ type tunnelStatus struct {
 	healthy      bool
 	active       int
 	poolSize     int
+	reconnecting bool
 }
 
 // Add debug table to model
@@ -118,6 +132,8 @@ type model struct {
 	qrEnabled              bool
 	showQR                 bool
 	qrPanel                string
+	// notice is the latest message from the server, shown above the tunnels.
+	notice string
 }
 
 // applyLayout resizes the tables for the given terminal size. The QR panel is
@@ -135,6 +151,9 @@ func (m *model) applyLayout(width, height int) {
 	if m.qrPanel != "" {
 		availableHeight -= lipgloss.Height(m.qrPanel) + 1
 	}
+	if m.notice != "" {
+		availableHeight -= 2
+	}
 	availableHeight = max(availableHeight, 8)
 
 	if m.debug {
@@ -153,8 +172,9 @@ func (m *model) applyLayout(width, height int) {
 	tunnelWidth := 15
 	methodWidth := 8
 	statusWidth := 8
-	mainCellPadding := 2 * 5 // table default style adds left/right padding to each cell
-	urlWidth := totalWidth - (timeWidth + tunnelWidth + methodWidth + statusWidth + mainCellPadding + 1)
+	requestIDWidth := 26
+	mainCellPadding := 2 * 6 // table default style adds left/right padding to each cell
+	urlWidth := totalWidth - (timeWidth + tunnelWidth + methodWidth + statusWidth + requestIDWidth + mainCellPadding + 1)
 
 	urlWidth = max(urlWidth, 10)
 
@@ -165,6 +185,7 @@ func (m *model) applyLayout(width, height int) {
 		{Title: "Method", Width: methodWidth},
 		{Title: "Status", Width: statusWidth},
 		{Title: "URL", Width: urlWidth},
+		{Title: "Request ID", Width: requestIDWidth},
 	}
 	m.table.SetColumns(cols)
 
@@ -206,11 +227,12 @@ func New(debug bool, dashboardURL string, dashboardDisabledLabel string, enableQ
 
 	// Initial default widths
 	const (
-		timeWidth   = 12
-		tunnelWidth = 15
-		methodWidth = 8
-		statusWidth = 8
-		urlWidth    = 50
+		timeWidth      = 12
+		tunnelWidth    = 15
+		methodWidth    = 8
+		statusWidth    = 8
+		urlWidth       = 50
+		requestIDWidth = 26
 	)
 
 	// Regular table setup with minimum widths
@@ -220,6 +242,7 @@ func New(debug bool, dashboardURL string, dashboardDisabledLabel string, enableQ
 		{Title: "Method", Width: methodWidth},
 		{Title: "Status", Width: statusWidth},
 		{Title: "URL", Width: urlWidth},
+		{Title: "Request ID", Width: requestIDWidth},
 	}
 
 	t := table.New(
@@ -347,6 +370,16 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			tunnel.healthy = msg.Healthy
 		}
 
+	case ReconnectingMsg:
+		if tunnel, exists := m.tunnels[msg.Port]; exists {
+			tunnel.reconnecting = true
+		}
+
+	case ServerNoticeMsg:
+		m.notice = msg.Message
+		m.applyLayout(m.width, m.height)
+		return m, nil
+
 	case UpdateConnCountMsg:
 		if tunnel, exists := m.tunnels[msg.Port]; exists {
 			tunnel.active += msg.Delta
@@ -354,6 +387,9 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				tunnel.active = 0
 			}
 			tunnel.active = min(tunnel.active, max(1, tunnel.poolSize))
+			if tunnel.active == max(1, tunnel.poolSize) {
+				tunnel.reconnecting = false
+			}
 		}
 
 	case tea.WindowSizeMsg:
@@ -403,6 +439,9 @@ func (m model) View() string {
 	} else {
 		s += subtitleStyle.Render("Local Dashboard: "+m.dashboardURL) + "\n\n"
 	}
+	if m.notice != "" {
+		s += unhealthyStyle.MarginLeft(2).MaxWidth(max(m.width-2, 20)).Render("⚠️  "+m.notice) + "\n\n"
+	}
 
 	if len(m.tunnels) == 0 {
 		s += subtitleStyle.Render("Waiting for tunnels to connect...") + "\n"
@@ -444,10 +483,14 @@ func (m model) View() string {
 		var statusText string
 
 		// Health coloring:
+		// - Reconnecting at the server's request => yellow
 		// - No active connections => red (unhealthy)
 		// - Active < poolSize => yellow (partially unhealthy)
 		// - Active >= poolSize => green (healthy)
-		if tunnel.active == 0 {
+		if tunnel.reconnecting && tunnel.active < max(1, tunnel.poolSize) {
+			tunnelStyle = unhealthyStyle
+			statusText = "🔄 Reconnecting (" + fmt.Sprint(tunnel.active) + "/" + fmt.Sprint(max(1, tunnel.poolSize)) + ")"
+		} else if tunnel.active == 0 {
 			tunnelStyle = redStyle
 			statusText = "🔴 Unhealthy (0/" + fmt.Sprint(max(1, tunnel.poolSize)) + ")"
 		} else if tunnel.active < max(1, tunnel.poolSize) {
@@ -504,7 +547,7 @@ func (m model) View() string {
 	// Add waiting message if no logs
 	if len(m.table.Rows()) == 0 {
 		// Create empty table with just headers
-		m.table.SetRows([]table.Row{{"", "", "", "", "Waiting for logs..."}})
+		m.table.SetRows([]table.Row{{"", "", "", "", "Waiting for logs...", ""}})
 	}
 	s += tableStyle.Render(m.table.View()) + "\n"
 
@@ -541,6 +584,7 @@ func (m *model) AddLog(msg AddLogMsg) {
 		msg.Method,
 		fmt.Sprintf("%d", msg.Status),
 		msg.URL,
+		msg.RequestID,
 	}}
 
 	// Get existing rows and prepend new row
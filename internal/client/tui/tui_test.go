@@ -6,6 +6,7 @@ import (
 
 	config "github.com/amalshaji/portr/internal/clientconfig"
 	"github.com/amalshaji/portr/internal/constants"
+	tea "github.com/charmbracelet/bubbletea"
 )
 
 func TestViewRendersStatusIcons(t *testing.T) {
@@ -86,6 +87,41 @@ func TestUpdateConnCountClampsToPoolSize(t *testing.T) {
 	}
 }
 
+func TestReconnectingTunnelIsNotShownAsUnhealthy(t *testing.T) {
+	tunnel := testTunnel()
+	m := model{
+		tunnels: map[string]*tunnelStatus{
+			"8765": {
+				config:       &tunnel,
+				clientConfig: testClientConfig(tunnel),
+				active:       2,
+				poolSize:     2,
+			},
+		},
+		width: 200,
+	}
+
+	for _, msg := range []tea.Msg{
+		UpdateConnCountMsg{Port: "8765", Delta: -1},
+		UpdateConnCountMsg{Port: "8765", Delta: -1},
+		ReconnectingMsg{Port: "8765"},
+	} {
+		updated, _ := m.Update(msg)
+		m = updated.(model)
+	}
+	if view := m.View(); !strings.Contains(view, "Reconnecting (0/2)") || strings.Contains(view, "Unhealthy") {
+		t.Fatalf("expected reconnecting status, got %q", view)
+	}
+
+	for i := 0; i < 2; i++ {
+		updated, _ := m.Update(UpdateConnCountMsg{Port: "8765", Delta: 1})
+		m = updated.(model)
+	}
+	if m.tunnels["8765"].reconnecting {
+		t.Fatal("expected reconnecting to clear once the pool is back")
+	}
+}
+
 func TestViewRendersStubTunnelWithoutLocalPort(t *testing.T) {
 	tunnel := config.Tunnel{
 		Name:      "yaml",
@@ -8,8 +8,10 @@ import (
 	"path/filepath"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/amalshaji/portr/internal/constants"
+	"github.com/amalshaji/portr/internal/tracing"
 	"github.com/amalshaji/portr/internal/utils"
 	"gopkg.in/yaml.v3"
 )
@@ -28,6 +30,9 @@ type Tunnel struct {
 	PoolSize             int    `yaml:"pool_size"`
 	HostHeader           string `yaml:"host_header"`
 	BasicAuth            string `yaml:"basic_auth"`
+	// ExpiresIn closes the tunnel this long after it starts. The server may
+	// close it sooner under its own policies.
+	ExpiresIn time.Duration `yaml:"expires_in"`
 }
 
 // HostHeaderRewrite sets the outbound Host header to the local address.
@@ -67,6 +72,10 @@ func (t *Tunnel) Validate() error {
 		return err
 	}
 
+	if t.ExpiresIn < 0 || (t.ExpiresIn > 0 && t.ExpiresIn < time.Second) {
+		return fmt.Errorf("expires_in must be at least 1s")
+	}
+
 	if t.Type == constants.Stub && strings.TrimSpace(t.Subdomain) == "" {
 		return fmt.Errorf("subdomain is required for stub tunnels")
 	}
@@ -283,6 +292,7 @@ type Config struct {
 	EnableQRCode                    *bool               `yaml:"enable_qr_code"`
 	DisableUpdateCheck              bool                `yaml:"disable_update_check"`
 	InsecureSkipHostKeyVerification *bool               `yaml:"insecure_skip_host_key_verification"`
+	OTLPEndpoint                    string              `yaml:"otel_endpoint"`
 }
 
 func (c *Config) SetDefaults() {
@@ -343,6 +353,10 @@ func (c Config) Validate() error {
 		return fmt.Errorf("dashboard_port must be between 1 and 65535")
 	}
 
+	if _, err := tracing.ParseEndpoint(c.OTLPEndpoint); err != nil {
+		return fmt.Errorf("otel_endpoint: %w", err)
+	}
+
 	tunnelNames := make(map[string]bool, len(c.Tunnels))
 	for _, tunnel := range c.Tunnels {
 		if err := tunnel.Validate(); err != nil {
@@ -560,6 +574,9 @@ type ClientConfig struct {
 	DisableTUI                      bool
 	DisableTerminalLogs             bool
 	InsecureSkipHostKeyVerification bool
+	// ExpiresAt is when the tunnel should close, from Tunnel.ExpiresIn. Every
+	// connection the tunnel opens, including after a reconnect, expires then.
+	ExpiresAt time.Time
 }
 
 // ClientConfigForTunnel builds the per-tunnel config handed to the tunnel
@@ -569,6 +586,10 @@ type ClientConfig struct {
 // even when a custom redact_headers list omits it, so captures can never
 // persist the tunnel's own credential.
 func (c *Config) ClientConfigForTunnel(tunnel Tunnel) ClientConfig {
+	var expiresAt time.Time
+	if tunnel.ExpiresIn > 0 {
+		expiresAt = time.Now().Add(tunnel.ExpiresIn)
+	}
 	return ClientConfig{
 		ServerUrl:                       c.ServerUrl,
 		SshUrl:                          c.SshUrl,
@@ -583,6 +604,7 @@ func (c *Config) ClientConfigForTunnel(tunnel Tunnel) ClientConfig {
 		HealthCheckMaxRetries:           c.HealthCheckMaxRetries,
 		DisableTUI:                      c.DisableTUI,
 		InsecureSkipHostKeyVerification: *c.InsecureSkipHostKeyVerification,
+		ExpiresAt:                       expiresAt,
 	}
 }
 
@@ -6,6 +6,7 @@ import (
 	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/amalshaji/portr/internal/constants"
 )
@@ -49,6 +50,30 @@ func TestValidateRejectsUnderscoreSubdomain(t *testing.T) {
 	}
 }
 
+func TestValidateRejectsSubSecondExpiresIn(t *testing.T) {
+	for _, expiresIn := range []time.Duration{-time.Minute, 500 * time.Millisecond} {
+		cfg := Config{Tunnels: []Tunnel{{Type: constants.Http, Subdomain: "app", ExpiresIn: expiresIn}}}
+		cfg.SetDefaults()
+
+		if err := cfg.Validate(); err == nil {
+			t.Fatalf("expected expires_in %s to be rejected", expiresIn)
+		}
+	}
+}
+
+func TestClientConfigForTunnelSetsExpiry(t *testing.T) {
+	cfg := Config{Tunnels: []Tunnel{{Type: constants.Http, Subdomain: "app", ExpiresIn: time.Hour}}}
+	cfg.SetDefaults()
+
+	expiresAt := cfg.ClientConfigForTunnel(cfg.Tunnels[0]).ExpiresAt
+	if remaining := time.Until(expiresAt); remaining <= 59*time.Minute || remaining > time.Hour {
+		t.Fatalf("expected the tunnel to expire in an hour, got %s", remaining)
+	}
+	if cfg.ClientConfigForTunnel(Tunnel{Type: constants.Http}).ExpiresAt != (time.Time{}) {
+		t.Fatal("expected tunnels without expires_in to never expire")
+	}
+}
+
 func TestSetDefaultsEnablesRequestLoggingByDefault(t *testing.T) {
 	cfg := Config{}
 
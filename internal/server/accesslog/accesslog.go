@@ -0,0 +1,106 @@
+// Package accesslog records the requests the proxy serves from tunnels in
+// the database, for review after incidents.
+package accesslog
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/proxy"
+	"github.com/charmbracelet/log"
+)
+
+// maxPending bounds the entries buffered between flushes. Entries past it
+// are dropped, so a slow database never holds up or exhausts the proxy.
+const maxPending = 50_000
+
+type Store interface {
+	SaveAccessLogs(ctx context.Context, entries []models.AccessLog) error
+	PruneAccessLogs(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Connections maps the proxy's tunnel backends to their connections.
+type Connections interface {
+	ConnectionForBackend(backend string) (string, bool)
+}
+
+type Log struct {
+	store       Store
+	connections Connections
+	retention   time.Duration
+
+	mu      sync.Mutex
+	pending []models.AccessLog
+	dropped int
+}
+
+func New(store Store, connections Connections, retention time.Duration) *Log {
+	return &Log{
+		store:       store,
+		connections: connections,
+		retention:   retention,
+	}
+}
+
+var _ proxy.AccessLog = (*Log)(nil)
+
+// Record buffers an entry until the next flush. The connection is looked up
+// now, while the backend still belongs to it.
+func (l *Log) Record(entry proxy.AccessEntry) {
+	connectionID, ok := l.connections.ConnectionForBackend(entry.Backend)
+	if !ok {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.pending) >= maxPending {
+		l.dropped++
+		return
+	}
+	l.pending = append(l.pending, models.AccessLog{
+		ConnectionID: connectionID,
+		RequestID:    entry.RequestID,
+		Subdomain:    entry.Subdomain,
+		Method:       entry.Method,
+		Path:         entry.Path,
+		Status:       entry.Status,
+		LatencyMs:    entry.Latency.Milliseconds(),
+		BytesIn:      entry.BytesIn,
+		BytesOut:     entry.BytesOut,
+		VisitorIP:    entry.VisitorIP,
+		CreatedAt:    entry.Time.UTC(),
+	})
+}
+
+// Flush saves the entries recorded since the last flush. Entries that fail
+// to save are dropped rather than retried, to keep memory bounded.
+func (l *Log) Flush(ctx context.Context) {
+	l.mu.Lock()
+	pending, dropped := l.pending, l.dropped
+	l.pending, l.dropped = nil, 0
+	l.mu.Unlock()
+
+	if dropped != 0 {
+		log.Warn("Dropped access log entries", "count", dropped)
+	}
+	if len(pending) == 0 {
+		return
+	}
+	if err := l.store.SaveAccessLogs(ctx, pending); err != nil {
+		log.Error("Failed to save access log entries", "count", len(pending), "error", err)
+	}
+}
+
+// Prune deletes the entries older than the retention.
+func (l *Log) Prune(ctx context.Context) {
+	deleted, err := l.store.PruneAccessLogs(ctx, time.Now().Add(-l.retention))
+	if err != nil {
+		log.Error("Failed to prune access log", "error", err)
+		return
+	}
+	if deleted != 0 {
+		log.Info("Pruned access log", "deleted", deleted)
+	}
+}
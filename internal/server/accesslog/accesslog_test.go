@@ -0,0 +1,55 @@
+package accesslog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/proxy"
+)
+
+type fakeStore struct {
+	saved       []models.AccessLog
+	prunedUntil time.Time
+}
+
+func (f *fakeStore) SaveAccessLogs(_ context.Context, entries []models.AccessLog) error {
+	f.saved = append(f.saved, entries...)
+	return nil
+}
+
+func (f *fakeStore) PruneAccessLogs(_ context.Context, before time.Time) (int64, error) {
+	f.prunedUntil = before
+	return 0, nil
+}
+
+type fakeConnections map[string]string
+
+func (f fakeConnections) ConnectionForBackend(backend string) (string, bool) {
+	connectionID, ok := f[backend]
+	return connectionID, ok
+}
+
+func TestLogFlushesEntriesOfKnownBackends(t *testing.T) {
+	store := &fakeStore{}
+	l := New(store, fakeConnections{"127.0.0.1:20001": "conn-1"}, 24*time.Hour)
+
+	started := time.Date(2026, 9, 1, 12, 0, 0, 0, time.UTC)
+	l.Record(proxy.AccessEntry{Time: started, RequestID: "req-1", Subdomain: "orders", Backend: "127.0.0.1:20001", Method: "GET", Path: "/", Status: 200, Latency: 15 * time.Millisecond})
+	l.Record(proxy.AccessEntry{Time: started, Subdomain: "orders", Backend: "127.0.0.1:29999", Method: "GET", Path: "/", Status: 200})
+	l.Flush(context.Background())
+	l.Flush(context.Background())
+
+	if len(store.saved) != 1 {
+		t.Fatalf("expected one entry saved once, got %+v", store.saved)
+	}
+	if entry := store.saved[0]; entry.ConnectionID != "conn-1" || entry.RequestID != "req-1" || entry.LatencyMs != 15 || !entry.CreatedAt.Equal(started) {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+
+	l.Prune(context.Background())
+	if age := time.Since(store.prunedUntil); age < 24*time.Hour || age > 25*time.Hour {
+		t.Fatalf("expected pruning at the retention, got entries before %v", store.prunedUntil)
+	}
+}
@@ -0,0 +1,174 @@
+package apitoken
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/api/audit"
+	"github.com/amalshaji/portr/internal/server/admin/middleware"
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// maxExpiresInDays bounds how far ahead a token's expiry can be set.
+const maxExpiresInDays = 366
+
+type Handler struct {
+	db      *gorm.DB
+	service *services.APITokenService
+}
+
+type createInput struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresInDays is the token's lifetime; 0 or unset never expires.
+	ExpiresInDays int `json:"expires_in_days"`
+}
+
+type apiTokenResponse struct {
+	ID         uint     `json:"id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	CreatedAt  string   `json:"created_at"`
+	ExpiresAt  *string  `json:"expires_at"`
+	LastUsedAt *string  `json:"last_used_at"`
+	RevokedAt  *string  `json:"revoked_at"`
+	// Token is only set in the response to creating the token.
+	Token string `json:"token,omitempty"`
+}
+
+func NewHandler(db *gorm.DB) *Handler {
+	return &Handler{db: db, service: services.NewAPITokenService(db)}
+}
+
+func (h *Handler) List(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Team context required"})
+	}
+
+	tokens, err := h.service.List(c.UserContext(), teamUser.ID)
+	if err != nil {
+		return apiError(c, fiber.StatusInternalServerError, "api_token_load_failed", "Failed to load API tokens")
+	}
+
+	data := make([]apiTokenResponse, 0, len(tokens))
+	for _, token := range tokens {
+		data = append(data, responseFor(token))
+	}
+	return c.JSON(fiber.Map{"data": data, "count": len(data), "scopes": models.APITokenScopes})
+}
+
+func (h *Handler) Create(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Team context required"})
+	}
+
+	var input createInput
+	if err := c.BodyParser(&input); err != nil {
+		return apiError(c, fiber.StatusBadRequest, "invalid_input", "Invalid input")
+	}
+	if input.ExpiresInDays < 0 || input.ExpiresInDays > maxExpiresInDays {
+		return apiError(c, fiber.StatusBadRequest, "invalid_expiry", "expires_in_days must be between 0 and "+strconv.Itoa(maxExpiresInDays))
+	}
+	var expiresAt *time.Time
+	if input.ExpiresInDays > 0 {
+		at := time.Now().UTC().AddDate(0, 0, input.ExpiresInDays)
+		expiresAt = &at
+	}
+
+	token, secret, err := h.service.Create(c.UserContext(), teamUser, services.CreateAPITokenInput{
+		Name:      input.Name,
+		Scopes:    input.Scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return handleServiceError(c, err)
+	}
+	audit.Record(c, h.db, auditLogFor(models.AuditActionAPITokenCreated, token))
+
+	response := responseFor(*token)
+	response.Token = secret
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+func (h *Handler) Revoke(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Team context required"})
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return apiError(c, fiber.StatusBadRequest, "invalid_id", "Invalid API token id")
+	}
+	token, err := h.service.Revoke(c.UserContext(), teamUser.ID, uint(id))
+	if err != nil {
+		return handleServiceError(c, err)
+	}
+	audit.Record(c, h.db, auditLogFor(models.AuditActionAPITokenRevoked, token))
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func handleServiceError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrAPITokenNameRequired):
+		return apiError(c, fiber.StatusBadRequest, "name_required", "Name the token")
+	case errors.Is(err, services.ErrAPITokenScopesRequired):
+		return apiError(c, fiber.StatusBadRequest, "scopes_required", "Choose at least one scope")
+	case errors.Is(err, services.ErrInvalidAPITokenScope):
+		return apiError(c, fiber.StatusBadRequest, "invalid_scope", "Unknown scope")
+	case errors.Is(err, services.ErrAPITokenScopeNotAllowed):
+		return apiError(c, fiber.StatusForbidden, "scope_not_allowed", "Only team admins can create tokens that manage users or templates")
+	case errors.Is(err, services.ErrInvalidAPITokenExpiry):
+		return apiError(c, fiber.StatusBadRequest, "invalid_expiry", "The expiry must be in the future")
+	case errors.Is(err, services.ErrAPITokenNotFound):
+		return apiError(c, fiber.StatusNotFound, "api_token_not_found", "API token not found")
+	default:
+		return apiError(c, fiber.StatusInternalServerError, "api_token_failed", "Failed to update API tokens")
+	}
+}
+
+func auditLogFor(action string, token *models.APIToken) models.AuditLog {
+	return models.AuditLog{
+		Action:     action,
+		TargetType: models.AuditTargetAPIToken,
+		TargetID:   strconv.FormatUint(uint64(token.ID), 10),
+		Target:     token.Name,
+		Detail:     "scopes: " + token.Scopes,
+	}
+}
+
+func responseFor(token models.APIToken) apiTokenResponse {
+	return apiTokenResponse{
+		ID:         token.ID,
+		Name:       token.Name,
+		Prefix:     token.Prefix,
+		Scopes:     token.ScopeList(),
+		CreatedAt:  formatTime(token.CreatedAt),
+		ExpiresAt:  formatOptionalTime(token.ExpiresAt),
+		LastUsedAt: formatOptionalTime(token.LastUsedAt),
+		RevokedAt:  formatOptionalTime(token.RevokedAt),
+	}
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+func formatOptionalTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := formatTime(*t)
+	return &formatted
+}
+
+func apiError(c *fiber.Ctx, status int, code, message string) error {
+	return c.Status(status).JSON(fiber.Map{"code": code, "message": message})
+}
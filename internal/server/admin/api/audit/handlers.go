@@ -0,0 +1,254 @@
+// Package audit records administrative and security-relevant actions and
+// serves the audit log to team admins and superusers.
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/middleware"
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Record appends entry to the audit log, filling in the signed-in actor, their
+// team and the client IP unless entry sets them, and noting the API token the
+// request was made with. A failure is logged rather than failing the request,
+// which has already taken effect.
+func Record(c *fiber.Ctx, db *gorm.DB, entry models.AuditLog) {
+	if user := middleware.GetCurrentUser(c); user != nil && entry.ActorID == nil && entry.ActorEmail == "" {
+		entry.ActorID = &user.ID
+		entry.ActorEmail = user.Email
+	}
+	if teamUser := middleware.GetCurrentTeamUser(c); teamUser != nil && entry.TeamID == nil {
+		entry.TeamID = &teamUser.TeamID
+	}
+	if entry.IP == "" {
+		entry.IP = c.IP()
+	}
+	if token := middleware.GetCurrentAPIToken(c); token != nil {
+		via := fmt.Sprintf("via API token %q (%s)", token.Name, token.Prefix)
+		if entry.Detail == "" {
+			entry.Detail = via
+		} else {
+			entry.Detail += "; " + via
+		}
+	}
+	if err := services.NewAuditLogService(db).Record(c.UserContext(), entry); err != nil {
+		log.Error("Failed to record audit log entry", "action", entry.Action, "error", err)
+	}
+}
+
+type Handler struct {
+	db *gorm.DB
+}
+
+func NewHandler(db *gorm.DB) *Handler {
+	return &Handler{db: db}
+}
+
+type AuditLogResponse struct {
+	ID         uint64          `json:"id"`
+	Timestamp  string          `json:"timestamp"`
+	TeamID     *uint           `json:"team_id"`
+	ActorID    *uint           `json:"actor_id"`
+	ActorEmail string          `json:"actor_email"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Target     string          `json:"target"`
+	IP         string          `json:"ip"`
+	Diff       json.RawMessage `json:"diff"`
+	Detail     string          `json:"detail"`
+}
+
+// List returns a page of the audit log, newest first.
+func (h *Handler) List(c *fiber.Ctx) error {
+	filter, filterErr := filterFor(c)
+	if filterErr != nil {
+		return c.Status(filterErr.Code).JSON(fiber.Map{
+			"error": filterErr.Message,
+		})
+	}
+
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	pageSize := c.QueryInt("page_size", 50)
+	if pageSize < 1 {
+		pageSize = 50
+	}
+	if pageSize > 500 {
+		pageSize = 500
+	}
+
+	logs, total, err := services.NewAuditLogService(h.db).List(c.UserContext(), filter, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load audit log",
+		})
+	}
+
+	items := make([]AuditLogResponse, 0, len(logs))
+	for _, entry := range logs {
+		items = append(items, responseFor(entry))
+	}
+	return c.JSON(fiber.Map{
+		"count": total,
+		"data":  items,
+	})
+}
+
+var csvHeader = []string{"id", "timestamp", "team_id", "actor_id", "actor_email", "action", "target_type", "target_id", "target", "ip", "diff", "detail"}
+
+// Export streams every matching entry, oldest first, as CSV or JSON lines.
+func (h *Handler) Export(c *fiber.Ctx) error {
+	filter, filterErr := filterFor(c)
+	if filterErr != nil {
+		return c.Status(filterErr.Code).JSON(fiber.Map{
+			"error": filterErr.Message,
+		})
+	}
+
+	format := c.Query("format", "csv")
+	switch format {
+	case "csv":
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	case "jsonl":
+		c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "format must be csv or jsonl",
+		})
+	}
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="audit-log.%s"`, format))
+
+	// The body is written after the handler returns, so the export cannot
+	// use the request's context.
+	service := services.NewAuditLogService(h.db)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		var write func(models.AuditLog) error
+		if format == "csv" {
+			records := csv.NewWriter(w)
+			defer records.Flush()
+			if err := records.Write(csvHeader); err != nil {
+				return
+			}
+			write = func(entry models.AuditLog) error {
+				return records.Write(csvRecordFor(entry))
+			}
+		} else {
+			encoder := json.NewEncoder(w)
+			write = func(entry models.AuditLog) error {
+				return encoder.Encode(responseFor(entry))
+			}
+		}
+		if err := service.Export(context.Background(), filter, write); err != nil {
+			log.Error("Failed to export audit log", "error", err)
+		}
+	})
+	return nil
+}
+
+// filterFor reads the audit log filter from the query. Team admins see their
+// team's entries; superusers may ask for every entry with scope=all.
+func filterFor(c *fiber.Ctx) (services.AuditLogFilter, *fiber.Error) {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return services.AuditLogFilter{}, fiber.NewError(fiber.StatusBadRequest, "Team context required")
+	}
+
+	filter := services.AuditLogFilter{
+		TeamID:     teamUser.TeamID,
+		Action:     strings.TrimSpace(c.Query("action")),
+		ActorEmail: strings.TrimSpace(c.Query("actor")),
+		TargetType: strings.TrimSpace(c.Query("target_type")),
+		TargetID:   strings.TrimSpace(c.Query("target_id")),
+	}
+	switch c.Query("scope", "team") {
+	case "team":
+	case "all":
+		if !teamUser.User.IsSuperuser {
+			return filter, fiber.NewError(fiber.StatusForbidden, "Superuser access required")
+		}
+		filter.AllTeams = true
+	default:
+		return filter, fiber.NewError(fiber.StatusBadRequest, "scope must be team or all")
+	}
+
+	for param, at := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := strings.TrimSpace(c.Query(param))
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, fiber.NewError(fiber.StatusBadRequest, param+" must be an RFC 3339 timestamp")
+		}
+		*at = parsed
+	}
+	return filter, nil
+}
+
+func responseFor(entry models.AuditLog) AuditLogResponse {
+	diff := json.RawMessage("null")
+	if entry.Diff != "" {
+		diff = json.RawMessage(entry.Diff)
+	}
+	return AuditLogResponse{
+		ID:         entry.ID,
+		Timestamp:  entry.CreatedAt.UTC().Format("2006-01-02T15:04:05.000Z"),
+		TeamID:     entry.TeamID,
+		ActorID:    entry.ActorID,
+		ActorEmail: entry.ActorEmail,
+		Action:     entry.Action,
+		TargetType: entry.TargetType,
+		TargetID:   entry.TargetID,
+		Target:     entry.Target,
+		IP:         entry.IP,
+		Diff:       diff,
+		Detail:     entry.Detail,
+	}
+}
+
+func csvRecordFor(entry models.AuditLog) []string {
+	optional := func(id *uint) string {
+		if id == nil {
+			return ""
+		}
+		return strconv.FormatUint(uint64(*id), 10)
+	}
+	return []string{
+		strconv.FormatUint(entry.ID, 10),
+		entry.CreatedAt.UTC().Format("2006-01-02T15:04:05.000Z"),
+		optional(entry.TeamID),
+		optional(entry.ActorID),
+		csvText(entry.ActorEmail),
+		entry.Action,
+		entry.TargetType,
+		csvText(entry.TargetID),
+		csvText(entry.Target),
+		entry.IP,
+		csvText(entry.Diff),
+		csvText(entry.Detail),
+	}
+}
+
+// csvText keeps spreadsheets from evaluating a cell as a formula. Failed
+// logins record whatever email was typed, so cells can be attacker-chosen.
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
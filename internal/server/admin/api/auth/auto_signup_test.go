@@ -431,6 +431,7 @@ func newAuthTestDB(t *testing.T) (*gorm.DB, func()) {
 		&models.Session{},
 		&models.AutoSignupSettings{},
 		&models.AutoSignupDomain{},
+		&models.RecoveryCode{},
 	); err != nil {
 		t.Fatalf("failed to auto migrate auth test models: %v", err)
 	}
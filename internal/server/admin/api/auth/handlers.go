@@ -6,8 +6,12 @@ import (
 	"encoding/hex"
 	"errors"
 	"net/mail"
+	"strconv"
 	"strings"
+	"sync"
 
+	"github.com/amalshaji/portr/internal/server/admin/api/audit"
+	"github.com/amalshaji/portr/internal/server/admin/middleware"
 	"github.com/amalshaji/portr/internal/server/admin/models"
 	"github.com/amalshaji/portr/internal/server/admin/services"
 	serverConfig "github.com/amalshaji/portr/internal/server/config"
@@ -27,24 +31,39 @@ type githubOAuthService interface {
 }
 
 type Handler struct {
-	db            *gorm.DB
-	store         *session.Store
+	db    *gorm.DB
+	store *session.Store
+	// githubService overrides the config-backed GitHub client; tests use it
+	// to stand in for GitHub.
 	githubService githubOAuthService
 	config        *serverConfig.AdminConfig
+	throttle      *middleware.LoginThrottle
+
+	oidcMu      sync.Mutex
+	oidcService *services.OIDCService
+	// oidcConfig is the configuration oidcService was discovered with.
+	oidcConfig serverConfig.OIDCConfig
 }
 
-func NewHandler(db *gorm.DB, store *session.Store, cfg *serverConfig.AdminConfig) *Handler {
-	var githubService githubOAuthService
-	if service := services.NewGitHubService(cfg); service != nil {
-		githubService = service
+func NewHandler(db *gorm.DB, store *session.Store, cfg *serverConfig.AdminConfig, throttle *middleware.LoginThrottle) *Handler {
+	return &Handler{
+		db:       db,
+		store:    store,
+		config:   cfg,
+		throttle: throttle,
 	}
+}
 
-	return &Handler{
-		db:            db,
-		store:         store,
-		githubService: githubService,
-		config:        cfg,
+// github returns the GitHub OAuth client for the current credentials, which
+// can change on a config reload, or nil when GitHub login is not configured.
+func (h *Handler) github() githubOAuthService {
+	if h.githubService != nil {
+		return h.githubService
+	}
+	if service := services.NewGitHubService(h.config); service != nil {
+		return service
 	}
+	return nil
 }
 
 type LoginInput struct {
@@ -71,11 +90,17 @@ func (h *Handler) GetAuthConfig(c *fiber.Ctx) error {
 	var userCount int64
 	h.db.Model(&models.User{}).Count(&userCount)
 
-	githubEnabled := h.githubService != nil && h.githubService.IsEnabled()
+	github := h.github()
+	githubEnabled := github != nil && github.IsEnabled()
+
+	oidc := h.config.OIDCSettings()
 
 	return c.JSON(fiber.Map{
-		"is_first_signup":     userCount == 0,
-		"github_auth_enabled": githubEnabled,
+		"is_first_signup":        userCount == 0,
+		"github_auth_enabled":    githubEnabled,
+		"oidc_auth_enabled":      oidc.Enabled(),
+		"oidc_name":              oidc.Name,
+		"password_login_enabled": h.config.PasswordLoginEnabled(),
 	})
 }
 
@@ -110,6 +135,19 @@ func (h *Handler) Login(c *fiber.Ctx) error {
 		})
 	}
 
+	// The first user still signs up with a password: there is no one yet
+	// for the OpenID Connect provider to sign in.
+	if userCount != 0 && !h.config.PasswordLoginEnabled() {
+		audit.Record(c, h.db, models.AuditLog{
+			ActorEmail: input.Email,
+			Action:     models.AuditActionLoginFailed,
+			Detail:     "password login disabled",
+		})
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"password": "Password login is turned off for this server",
+		})
+	}
+
 	var user *models.User
 	var err error
 
@@ -155,10 +193,30 @@ func (h *Handler) Login(c *fiber.Ctx) error {
 		}
 
 		log.Info("Created first superuser", "email", input.Email)
+		audit.Record(c, h.db, models.AuditLog{
+			TeamID:     &team.ID,
+			ActorID:    &user.ID,
+			ActorEmail: user.Email,
+			Action:     models.AuditActionSignup,
+			TargetType: models.AuditTargetUser,
+			TargetID:   strconv.FormatUint(uint64(user.ID), 10),
+			Target:     user.Email,
+			Detail:     "first superuser",
+		})
 	} else {
+		if wait := h.throttle.LoginWait(c.IP(), input.Email); wait > 0 {
+			return middleware.TooManyAttempts(c, wait, "password")
+		}
+
 		// Find existing user
 		err = h.db.Where("email = ?", input.Email).First(&user).Error
 		if err != nil {
+			audit.Record(c, h.db, models.AuditLog{
+				ActorEmail: input.Email,
+				Action:     models.AuditActionLoginFailed,
+				Detail:     "unknown user",
+			})
+			h.loginFailed(c, input.Email, nil)
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"email": "User does not exist",
 			})
@@ -166,28 +224,31 @@ func (h *Handler) Login(c *fiber.Ctx) error {
 
 		// Check password
 		if !user.CheckPassword(input.Password) {
+			audit.Record(c, h.db, loginAuditLog(user, models.AuditActionLoginFailed, "wrong password"))
+			h.loginFailed(c, user.Email, user)
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"password": "Password is incorrect",
 			})
 		}
+
+		if user.TwoFactorEnabled() {
+			return h.requestSecondFactor(c, user)
+		}
 	}
 
-	// Create session
-	session := models.NewSession(user.ID)
-	if err := h.db.Create(session).Error; err != nil {
+	return h.finishPasswordLogin(c, user, "password")
+}
+
+// finishPasswordLogin signs in a user who passed every factor of a password
+// login and tells the login page where to go.
+func (h *Handler) finishPasswordLogin(c *fiber.Ctx, user *models.User, detail string) error {
+	if err := h.startSession(c, user.ID); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create session",
 		})
 	}
-
-	c.Cookie(&fiber.Cookie{
-		Name:     "portr_session",
-		Value:    session.Token,
-		HTTPOnly: true,
-		Secure:   true,
-		MaxAge:   7 * 24 * 60 * 60,
-		SameSite: "Lax",
-	})
+	audit.Record(c, h.db, loginAuditLog(user, models.AuditActionLogin, detail))
+	h.throttle.LoginSucceeded(user.Email)
 
 	// Get first team for redirect
 	var team models.Team
@@ -201,6 +262,10 @@ func (h *Handler) Login(c *fiber.Ctx) error {
 }
 
 func (h *Handler) Logout(c *fiber.Ctx) error {
+	if user := middleware.GetCurrentUser(c); user != nil {
+		audit.Record(c, h.db, loginAuditLog(user, models.AuditActionLogout, ""))
+	}
+
 	token := c.Cookies("portr_session")
 	if token != "" {
 		h.db.Where("token = ?", token).Delete(&models.Session{})
@@ -217,7 +282,8 @@ func (h *Handler) Logout(c *fiber.Ctx) error {
 }
 
 func (h *Handler) GitHubLogin(c *fiber.Ctx) error {
-	if h.githubService == nil || !h.githubService.IsEnabled() {
+	github := h.github()
+	if github == nil || !github.IsEnabled() {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "GitHub authentication is not enabled",
 		})
@@ -255,26 +321,27 @@ func (h *Handler) GitHubLogin(c *fiber.Ctx) error {
 		}
 	}
 
-	authURL := h.githubService.GetAuthURL(state)
+	authURL := github.GetAuthURL(state)
 
 	// Return redirect response like Python implementation
 	return c.Redirect(authURL, fiber.StatusFound)
 }
 
 func (h *Handler) GitHubCallback(c *fiber.Ctx) error {
-	if h.githubService == nil || !h.githubService.IsEnabled() {
+	github := h.github()
+	if github == nil || !github.IsEnabled() {
 		return c.Redirect("/?code=github-disabled", fiber.StatusFound)
 	}
 
 	// Verify state parameter
 	sess, err := h.store.Get(c)
 	if err != nil {
-		return c.Redirect("/?code=invalid-session", fiber.StatusFound)
+		return h.githubLoginFailed(c, "invalid-session", nil)
 	}
 
 	storedState := sess.Get("oauth_state")
 	if storedState == nil || storedState != c.Query("state") {
-		return c.Redirect("/?code=invalid-state", fiber.StatusFound)
+		return h.githubLoginFailed(c, "invalid-state", nil)
 	}
 
 	// Clear the state from session
@@ -283,47 +350,60 @@ func (h *Handler) GitHubCallback(c *fiber.Ctx) error {
 	// Get authorization code
 	code := c.Query("code")
 	if code == "" {
-		return c.Redirect("/?code=no-code", fiber.StatusFound)
+		return h.githubLoginFailed(c, "no-code", nil)
 	}
 
 	// Exchange code for token
 	ctx := context.Background()
-	token, err := h.githubService.ExchangeCode(ctx, code)
+	token, err := github.ExchangeCode(ctx, code)
 	if err != nil {
 		log.Error("Failed to exchange GitHub code", "error", err)
-		return c.Redirect("/?code=token-exchange-failed", fiber.StatusFound)
+		return h.githubLoginFailed(c, "token-exchange-failed", nil)
 	}
 
 	// Get user info from GitHub
-	githubUser, err := h.githubService.GetUser(ctx, token)
+	githubUser, err := github.GetUser(ctx, token)
 	if err != nil {
 		log.Error("Failed to get GitHub user", "error", err)
-		return c.Redirect("/?code=user-fetch-failed", fiber.StatusFound)
+		return h.githubLoginFailed(c, "user-fetch-failed", nil)
 	}
 
-	loginResult, err := newGitHubLoginResolver(h.db).resolve(ctx, h.githubService, githubUser, token)
+	loginResult, err := newGitHubLoginResolver(h.db).resolve(ctx, github, githubUser, token)
 	if err != nil {
 		var deniedErr githubLoginDeniedError
 		if errors.As(err, &deniedErr) {
-			return c.Redirect("/?code="+deniedErr.Code(), fiber.StatusFound)
+			return h.githubLoginFailed(c, deniedErr.Code(), githubUser)
 		}
 		var verificationErr githubEmailVerificationError
 		if errors.As(err, &verificationErr) {
 			log.Error("Failed to get verified GitHub email", "error", err)
-			return c.Redirect("/?code=email-verification-failed", fiber.StatusFound)
+			return h.githubLoginFailed(c, "email-verification-failed", githubUser)
 		}
 
 		log.Error("Database error during GitHub login", "error", err)
-		return c.Redirect("/?code=database-error", fiber.StatusFound)
+		return h.githubLoginFailed(c, "database-error", githubUser)
 	}
 
-	// Create session
-	session := models.NewSession(loginResult.User.ID)
+	if err := h.startSession(c, loginResult.User.ID); err != nil {
+		return h.githubLoginFailed(c, "session-creation-failed", githubUser)
+	}
+	audit.Record(c, h.db, loginAuditLog(&loginResult.User, models.AuditActionLogin, "github"))
+	return h.redirectAfterLogin(c, sess, loginResult.User.ID, loginResult.RedirectTeamSlug)
+}
+
+// startSession signs the user in, setting the session cookie, and keeps the
+// number of failed sign-ins since their last one for the dashboard to show.
+func (h *Handler) startSession(c *fiber.Ctx, userID uint) error {
+	session := models.NewSession(userID)
+	failures, err := services.NewLoginAttemptService(h.db).TakeFailures(c.UserContext(), userID)
+	if err != nil {
+		log.Error("Failed to read failed sign-ins", "error", err)
+	}
+	session.FailedLogins = failures
 	if err := h.db.Create(session).Error; err != nil {
-		return c.Redirect("/?code=session-creation-failed", fiber.StatusFound)
+		return err
 	}
 
-	// Set authentication cookie (same as regular login)
 	c.Cookie(&fiber.Cookie{
 		Name:     "portr_session",
 		Value:    session.Token,
@@ -332,7 +412,13 @@ func (h *Handler) GitHubCallback(c *fiber.Ctx) error {
 		MaxAge:   7 * 24 * 60 * 60,
 		SameSite: "Lax",
 	})
+	return nil
+}
 
+// redirectAfterLogin sends a user who signed in through an identity provider
+// to the page they started from, else to the team they were just signed up
+// into, else to their first team.
+func (h *Handler) redirectAfterLogin(c *fiber.Ctx, sess *session.Session, userID uint, redirectTeamSlug string) error {
 	// Get next URL or default redirect
 	nextURL := sess.Get("portr_next_url")
 	sess.Delete("portr_next_url")
@@ -346,14 +432,14 @@ func (h *Handler) GitHubCallback(c *fiber.Ctx) error {
 		}
 	}
 
-	if loginResult.RedirectTeamSlug != "" {
-		return c.Redirect("/"+loginResult.RedirectTeamSlug+"/overview", fiber.StatusFound)
+	if redirectTeamSlug != "" {
+		return c.Redirect("/"+redirectTeamSlug+"/overview", fiber.StatusFound)
 	}
 
 	// Get first team for redirect (same as regular login)
 	var team models.Team
 	h.db.Joins("JOIN team_users ON team_users.team_id = team.id").
-		Where("team_users.user_id = ?", loginResult.User.ID).
+		Where("team_users.user_id = ?", userID).
 		First(&team)
 
 	if team.ID != 0 {
@@ -364,6 +450,34 @@ func (h *Handler) GitHubCallback(c *fiber.Ctx) error {
 	return c.Redirect("/", fiber.StatusFound)
 }
 
+// githubLoginFailed records a failed GitHub login and redirects to the login
+// page with its code. githubUser is nil when GitHub has not named the user yet.
+func (h *Handler) githubLoginFailed(c *fiber.Ctx, code string, githubUser *services.GitHubUser) error {
+	entry := models.AuditLog{
+		Action: models.AuditActionLoginFailed,
+		Detail: "github: " + code,
+	}
+	if githubUser != nil {
+		entry.ActorEmail = models.NormalizeEmail(githubUser.Email)
+		entry.Target = githubUser.Login
+	}
+	audit.Record(c, h.db, entry)
+	return c.Redirect("/?code="+code, fiber.StatusFound)
+}
+
+// loginAuditLog is the audit log entry of a user signing in or out.
+func loginAuditLog(user *models.User, action, detail string) models.AuditLog {
+	return models.AuditLog{
+		ActorID:    &user.ID,
+		ActorEmail: user.Email,
+		Action:     action,
+		TargetType: models.AuditTargetUser,
+		TargetID:   strconv.FormatUint(uint64(user.ID), 10),
+		Target:     user.Email,
+		Detail:     detail,
+	}
+}
+
 // generateRandomString generates a random string of the specified length
 func generateRandomString(length int) (string, error) {
 	bytes := make([]byte, length)
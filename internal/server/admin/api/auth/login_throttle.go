@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"github.com/amalshaji/portr/internal/server/admin/api/audit"
+	"github.com/amalshaji/portr/internal/server/admin/middleware"
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+)
+
+// loginFailed counts a wrong password or two-factor code against the account
+// and the client IP, and records the lockout it starts, if any. user is nil
+// when no account has the email.
+func (h *Handler) loginFailed(c *fiber.Ctx, email string, user *models.User) {
+	if user != nil {
+		if err := services.NewLoginAttemptService(h.db).RecordFailure(c.UserContext(), user.ID); err != nil {
+			log.Error("Failed to count failed sign-in", "error", err)
+		}
+	}
+
+	lockout := h.throttle.LoginFailed(c.IP(), email)
+	if lockout == 0 {
+		return
+	}
+	detail := "sign-ins locked out for " + middleware.FormatWait(lockout)
+	if user != nil {
+		audit.Record(c, h.db, loginAuditLog(user, models.AuditActionLoginLocked, detail))
+		return
+	}
+	audit.Record(c, h.db, models.AuditLog{
+		ActorEmail: email,
+		Action:     models.AuditActionLoginLocked,
+		Detail:     detail,
+	})
+}
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"errors"
+
+	"github.com/amalshaji/portr/internal/server/admin/api/audit"
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/oauth2"
+)
+
+// oidc returns the client of the configured OpenID Connect provider, or nil
+// when OpenID Connect login is not configured. The provider's discovery
+// document is read once per configuration, which can change on a reload.
+func (h *Handler) oidc(c *fiber.Ctx) (*services.OIDCService, error) {
+	settings := h.config.OIDCSettings()
+	if !settings.Enabled() {
+		return nil, nil
+	}
+
+	h.oidcMu.Lock()
+	defer h.oidcMu.Unlock()
+	if h.oidcService != nil && h.oidcConfig == settings {
+		return h.oidcService, nil
+	}
+	service, err := services.DiscoverOIDC(c.UserContext(), settings, h.config.DomainAddress()+"/api/v1/auth/oidc/callback")
+	if err != nil {
+		return nil, err
+	}
+	h.oidcService, h.oidcConfig = service, settings
+	return service, nil
+}
+
+func (h *Handler) OIDCLogin(c *fiber.Ctx) error {
+	if !h.config.OIDCSettings().Enabled() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "OpenID Connect authentication is not enabled",
+		})
+	}
+	provider, err := h.oidc(c)
+	if err != nil {
+		log.Error("Failed to discover the OpenID Connect provider", "error", err)
+		return h.oidcLoginFailed(c, "oidc-unavailable", "")
+	}
+
+	state, err := generateRandomString(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate state",
+		})
+	}
+	nonce, err := generateRandomString(32)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate nonce",
+		})
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	sess, err := h.store.Get(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get session",
+		})
+	}
+	sess.Set("oidc_state", state)
+	sess.Set("oidc_nonce", nonce)
+	sess.Set("oidc_verifier", verifier)
+	if nextURL, ok := safeNextPath(c.Query("next")); ok {
+		sess.Set("portr_next_url", nextURL)
+	}
+	if err := sess.Save(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save session",
+		})
+	}
+
+	return c.Redirect(provider.GetAuthURL(state, nonce, verifier), fiber.StatusFound)
+}
+
+func (h *Handler) OIDCCallback(c *fiber.Ctx) error {
+	if !h.config.OIDCSettings().Enabled() {
+		return c.Redirect("/?code=oidc-disabled", fiber.StatusFound)
+	}
+	provider, err := h.oidc(c)
+	if err != nil {
+		log.Error("Failed to discover the OpenID Connect provider", "error", err)
+		return h.oidcLoginFailed(c, "oidc-unavailable", "")
+	}
+
+	sess, err := h.store.Get(c)
+	if err != nil {
+		return h.oidcLoginFailed(c, "invalid-session", "")
+	}
+	storedState := sess.Get("oidc_state")
+	nonce, _ := sess.Get("oidc_nonce").(string)
+	verifier, _ := sess.Get("oidc_verifier").(string)
+	sess.Delete("oidc_state")
+	sess.Delete("oidc_nonce")
+	sess.Delete("oidc_verifier")
+	if storedState == nil || storedState != c.Query("state") {
+		return h.oidcLoginFailed(c, "invalid-state", "")
+	}
+	if providerError := c.Query("error"); providerError != "" {
+		log.Warn("OpenID Connect provider refused the login", "error", providerError, "description", c.Query("error_description"))
+		return h.oidcLoginFailed(c, "oidc-provider-error", "")
+	}
+	code := c.Query("code")
+	if code == "" {
+		return h.oidcLoginFailed(c, "no-code", "")
+	}
+
+	identity, err := provider.Exchange(c.UserContext(), code, nonce, verifier)
+	if err != nil {
+		if errors.Is(err, services.ErrOIDCUnverifiedEmail) {
+			return h.oidcLoginFailed(c, "oidc-unverified-email", "")
+		}
+		log.Error("Failed to verify the OpenID Connect login", "error", err)
+		return h.oidcLoginFailed(c, "token-exchange-failed", "")
+	}
+
+	result, err := services.NewAutoSignupService(h.db).ProvisionUser(identity.Email)
+	if err != nil {
+		var deniedErr services.AutoSignupDeniedError
+		if errors.As(err, &deniedErr) {
+			log.Warn("OpenID Connect user has no account and cannot be signed up", "email", identity.Email, "reason", deniedErr.Reason)
+			return h.oidcLoginFailed(c, string(githubLoginDeniedAutoSignupReason(deniedErr.Reason)), identity.Email)
+		}
+		log.Error("Database error during OpenID Connect login", "error", err)
+		return h.oidcLoginFailed(c, "database-error", identity.Email)
+	}
+
+	if err := h.startSession(c, result.User.ID); err != nil {
+		return h.oidcLoginFailed(c, "session-creation-failed", identity.Email)
+	}
+	audit.Record(c, h.db, loginAuditLog(&result.User, models.AuditActionLogin, "oidc"))
+	return h.redirectAfterLogin(c, sess, result.User.ID, result.Team.Slug)
+}
+
+// oidcLoginFailed records a failed OpenID Connect login and redirects to the
+// login page with its code. email is empty when the provider has not named
+// the user yet.
+func (h *Handler) oidcLoginFailed(c *fiber.Ctx, code, email string) error {
+	audit.Record(c, h.db, models.AuditLog{
+		ActorEmail: models.NormalizeEmail(email),
+		Action:     models.AuditActionLoginFailed,
+		Detail:     "oidc: " + code,
+	})
+	return c.Redirect("/?code="+code, fiber.StatusFound)
+}
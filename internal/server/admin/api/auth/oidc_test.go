@@ -0,0 +1,394 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	serverConfig "github.com/amalshaji/portr/internal/server/config"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+	"gorm.io/gorm"
+)
+
+// fakeOIDCProvider is a local stand-in for an OpenID Connect provider. It
+// issues one authorization code per login, for claims set by the test.
+type fakeOIDCProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	// claims are put in the ID token, after the nonce of the login.
+	claims map[string]any
+	// userInfo, if set, is served from the userinfo endpoint.
+	userInfo map[string]any
+
+	nonce         string
+	codeChallenge string
+}
+
+func newFakeOIDCProvider(t *testing.T) *fakeOIDCProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate signing key: %v", err)
+	}
+	p := &fakeOIDCProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"issuer":                 p.server.URL,
+			"authorization_endpoint": p.server.URL + "/authorize",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/jwks",
+			"userinfo_endpoint":      p.server.URL + "/userinfo",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"keys": []map[string]any{{
+			"kty": "RSA",
+			"kid": "test-key",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("code") != "ok" {
+			http.Error(w, "bad code", http.StatusBadRequest)
+			return
+		}
+		verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(verifier[:]) != p.codeChallenge {
+			http.Error(w, "bad code verifier", http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, map[string]any{
+			"access_token": "oidc-token",
+			"token_type":   "Bearer",
+			"id_token":     p.idToken(t),
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if p.userInfo == nil || r.Header.Get("Authorization") != "Bearer oidc-token" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, p.userInfo)
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+
+	p.claims = map[string]any{
+		"iss": p.server.URL,
+		"aud": "portr-client",
+		"sub": "subject-1",
+	}
+	return p
+}
+
+func (p *fakeOIDCProvider) idToken(t *testing.T) string {
+	claims := map[string]any{
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": p.nonce,
+	}
+	for name, value := range p.claims {
+		claims[name] = value
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test-key", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Errorf("failed to sign ID token: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestOIDCCallbackSignsInExistingUser(t *testing.T) {
+	db, cleanup := newAuthTestDB(t)
+	defer cleanup()
+
+	team := &models.Team{Name: "Engineering"}
+	if err := db.Create(team).Error; err != nil {
+		t.Fatalf("failed to create team: %v", err)
+	}
+	user := &models.User{Email: "member@example.com"}
+	if err := db.Session(&gorm.Session{SkipHooks: true}).Create(user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if err := db.Create(&models.TeamUser{UserID: user.ID, TeamID: team.ID, Role: models.RoleMember}).Error; err != nil {
+		t.Fatalf("failed to create team membership: %v", err)
+	}
+
+	provider := newFakeOIDCProvider(t)
+	provider.claims["email"] = "Member@Example.com"
+	provider.claims["email_verified"] = true
+	app := newOIDCTestApp(db, provider)
+
+	resp := performOIDCCallback(t, app, provider)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("expected status 302 Found, got %d", resp.StatusCode)
+	}
+	if location := resp.Header.Get("Location"); location != "/engineering/overview" {
+		t.Fatalf("expected redirect to the user's team, got %q", location)
+	}
+	if !hasSessionCookie(resp) {
+		t.Fatalf("expected a session cookie to be set")
+	}
+}
+
+func TestOIDCCallbackAutoSignupUsesUserInfoEmail(t *testing.T) {
+	db, cleanup := newAuthTestDB(t)
+	defer cleanup()
+
+	team := &models.Team{Name: "Engineering"}
+	if err := db.Create(team).Error; err != nil {
+		t.Fatalf("failed to create team: %v", err)
+	}
+	createAutoSignupSettings(t, db, models.AutoSignupDomain{Domain: "example.com", TeamID: team.ID})
+
+	provider := newFakeOIDCProvider(t)
+	provider.userInfo = map[string]any{
+		"sub":            "subject-1",
+		"email":          "new-user@example.com",
+		"email_verified": "true",
+	}
+	app := newOIDCTestApp(db, provider)
+
+	resp := performOIDCCallback(t, app, provider)
+	defer resp.Body.Close()
+
+	if location := resp.Header.Get("Location"); location != "/engineering/overview" {
+		t.Fatalf("expected redirect to auto signup team overview, got %q", location)
+	}
+
+	var user models.User
+	if err := db.Where("email = ?", "new-user@example.com").First(&user).Error; err != nil {
+		t.Fatalf("expected auto signup user to be created: %v", err)
+	}
+	var teamUser models.TeamUser
+	if err := db.Where("team_id = ? AND user_id = ?", team.ID, user.ID).First(&teamUser).Error; err != nil {
+		t.Fatalf("expected team membership to be created: %v", err)
+	}
+}
+
+func TestOIDCCallbackAutoSignupRejectsUntrustedDomain(t *testing.T) {
+	db, cleanup := newAuthTestDB(t)
+	defer cleanup()
+
+	team := &models.Team{Name: "Engineering"}
+	if err := db.Create(team).Error; err != nil {
+		t.Fatalf("failed to create team: %v", err)
+	}
+	createAutoSignupSettings(t, db, models.AutoSignupDomain{Domain: "example.com", TeamID: team.ID})
+
+	provider := newFakeOIDCProvider(t)
+	provider.claims["email"] = "new-user@other.example"
+	provider.claims["email_verified"] = true
+	app := newOIDCTestApp(db, provider)
+
+	resp := performOIDCCallback(t, app, provider)
+	defer resp.Body.Close()
+
+	if location := resp.Header.Get("Location"); location != "/?code=auto-signup-domain-denied" {
+		t.Fatalf("expected domain denied redirect, got %q", location)
+	}
+	assertNoUsers(t, db)
+}
+
+func TestOIDCCallbackRejectsUnverifiedEmail(t *testing.T) {
+	db, cleanup := newAuthTestDB(t)
+	defer cleanup()
+
+	team := &models.Team{Name: "Engineering"}
+	if err := db.Create(team).Error; err != nil {
+		t.Fatalf("failed to create team: %v", err)
+	}
+	createAutoSignupSettings(t, db, models.AutoSignupDomain{Domain: "example.com", TeamID: team.ID})
+
+	provider := newFakeOIDCProvider(t)
+	provider.claims["email"] = "new-user@example.com"
+	provider.claims["email_verified"] = false
+	app := newOIDCTestApp(db, provider)
+
+	resp := performOIDCCallback(t, app, provider)
+	defer resp.Body.Close()
+
+	if location := resp.Header.Get("Location"); location != "/?code=oidc-unverified-email" {
+		t.Fatalf("expected unverified email redirect, got %q", location)
+	}
+	assertNoUsers(t, db)
+}
+
+func TestOIDCCallbackRejectsInvalidIDTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims map[string]any
+	}{
+		{name: "wrong nonce", claims: map[string]any{"nonce": "replayed"}},
+		{name: "wrong audience", claims: map[string]any{"aud": "another-client"}},
+		{name: "wrong issuer", claims: map[string]any{"iss": "https://issuer.example"}},
+		{name: "expired", claims: map[string]any{"exp": time.Now().Add(-time.Hour).Unix()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, cleanup := newAuthTestDB(t)
+			defer cleanup()
+
+			team := &models.Team{Name: "Engineering"}
+			if err := db.Create(team).Error; err != nil {
+				t.Fatalf("failed to create team: %v", err)
+			}
+			createAutoSignupSettings(t, db, models.AutoSignupDomain{Domain: "example.com", TeamID: team.ID})
+
+			provider := newFakeOIDCProvider(t)
+			provider.claims["email"] = "new-user@example.com"
+			provider.claims["email_verified"] = true
+			for name, value := range tt.claims {
+				provider.claims[name] = value
+			}
+			app := newOIDCTestApp(db, provider)
+
+			resp := performOIDCCallback(t, app, provider)
+			defer resp.Body.Close()
+
+			if location := resp.Header.Get("Location"); location != "/?code=token-exchange-failed" {
+				t.Fatalf("expected token exchange failure redirect, got %q", location)
+			}
+			assertNoUsers(t, db)
+		})
+	}
+}
+
+func TestLoginRefusesPasswordsWhenPasswordLoginIsDisabled(t *testing.T) {
+	db, cleanup := newAuthTestDB(t)
+	defer cleanup()
+
+	user := &models.User{Email: "member@example.com"}
+	if err := db.Session(&gorm.Session{SkipHooks: true}).Create(user).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	provider := newFakeOIDCProvider(t)
+	app := newOIDCTestApp(db, provider)
+
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(`{"email":"member@example.com","password":"password"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("login request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected status 403 Forbidden, got %d", resp.StatusCode)
+	}
+}
+
+func newOIDCTestApp(db *gorm.DB, provider *fakeOIDCProvider) *fiber.App {
+	app := fiber.New()
+	handler := &Handler{
+		db:    db,
+		store: session.New(),
+		config: &serverConfig.AdminConfig{
+			Domain: "localhost:8000",
+			Debug:  true,
+			OIDC: serverConfig.OIDCConfig{
+				Issuer:       provider.server.URL,
+				ClientID:     "portr-client",
+				ClientSecret: "portr-secret",
+				Name:         "Test SSO",
+			},
+			PasswordLoginDisabled: true,
+		},
+	}
+
+	app.Post("/login", handler.Login)
+	app.Get("/oidc", handler.OIDCLogin)
+	app.Get("/oidc/callback", handler.OIDCCallback)
+
+	return app
+}
+
+// performOIDCCallback starts a login, plays the provider's part of it and
+// returns the response to the callback.
+func performOIDCCallback(t *testing.T, app *fiber.App, provider *fakeOIDCProvider) *http.Response {
+	t.Helper()
+
+	loginResp, err := app.Test(httptest.NewRequest("GET", "/oidc", nil), -1)
+	if err != nil {
+		t.Fatalf("login request failed: %v", err)
+	}
+	defer loginResp.Body.Close()
+
+	if loginResp.StatusCode != http.StatusFound {
+		t.Fatalf("expected login status 302 Found, got %d", loginResp.StatusCode)
+	}
+	authURL, err := url.Parse(loginResp.Header.Get("Location"))
+	if err != nil || !strings.HasPrefix(authURL.String(), provider.server.URL+"/authorize") {
+		t.Fatalf("expected redirect to the provider, got %q", loginResp.Header.Get("Location"))
+	}
+	query := authURL.Query()
+	if query.Get("client_id") != "portr-client" || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization request %q", authURL.RawQuery)
+	}
+	provider.codeChallenge = query.Get("code_challenge")
+	if _, overridden := provider.claims["nonce"]; !overridden {
+		provider.nonce = query.Get("nonce")
+	}
+
+	callbackReq := httptest.NewRequest("GET", "/oidc/callback?state="+url.QueryEscape(query.Get("state"))+"&code=ok", nil)
+	for _, cookie := range loginResp.Cookies() {
+		callbackReq.AddCookie(cookie)
+	}
+	callbackResp, err := app.Test(callbackReq, -1)
+	if err != nil {
+		t.Fatalf("callback request failed: %v", err)
+	}
+	return callbackResp
+}
+
+func hasSessionCookie(resp *http.Response) bool {
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "portr_session" && cookie.Value != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func assertNoUsers(t *testing.T, db *gorm.DB) {
+	t.Helper()
+
+	var count int64
+	if err := db.Model(&models.User{}).Count(&count).Error; err != nil {
+		t.Fatalf("failed to count users: %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("expected no user to be created, got %d", count)
+	}
+}
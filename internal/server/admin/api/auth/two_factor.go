@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/api/audit"
+	"github.com/amalshaji/portr/internal/server/admin/middleware"
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+)
+
+const (
+	// twoFactorLoginTimeout is how long a user has to give their second
+	// factor after their password.
+	twoFactorLoginTimeout = 5 * time.Minute
+	// twoFactorMaxAttempts is how many wrong codes end a login, so codes
+	// cannot be guessed after a single correct password.
+	twoFactorMaxAttempts = 5
+)
+
+type TwoFactorLoginInput struct {
+	Code string `json:"code"`
+}
+
+// requestSecondFactor remembers a user whose password was correct and asks
+// the login page for their TOTP or recovery code.
+func (h *Handler) requestSecondFactor(c *fiber.Ctx, user *models.User) error {
+	sess, err := h.store.Get(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get session",
+		})
+	}
+	sess.Set("two_factor_user_id", user.ID)
+	sess.Set("two_factor_expires_at", time.Now().Add(twoFactorLoginTimeout).Unix())
+	sess.Set("two_factor_attempts", 0)
+	if err := sess.Save(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save session",
+		})
+	}
+
+	return c.JSON(fiber.Map{"two_factor_required": true})
+}
+
+// LoginTwoFactor finishes a password login with the user's TOTP or recovery
+// code.
+func (h *Handler) LoginTwoFactor(c *fiber.Ctx) error {
+	var input TwoFactorLoginInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	sess, err := h.store.Get(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to get session",
+		})
+	}
+	userID, _ := sess.Get("two_factor_user_id").(uint)
+	expiresAt, _ := sess.Get("two_factor_expires_at").(int64)
+	attempts, _ := sess.Get("two_factor_attempts").(int)
+	if userID == 0 || time.Now().Unix() > expiresAt {
+		h.endTwoFactorLogin(sess)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"code": "Your sign-in expired. Enter your password again.",
+		})
+	}
+
+	var user models.User
+	if err := h.db.First(&user, userID).Error; err != nil {
+		h.endTwoFactorLogin(sess)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"code": "Your sign-in expired. Enter your password again.",
+		})
+	}
+	if wait := h.throttle.LoginWait(c.IP(), user.Email); wait > 0 {
+		return middleware.TooManyAttempts(c, wait, "code")
+	}
+
+	method, err := services.NewTwoFactorService(h.db).Verify(c.UserContext(), user.ID, input.Code)
+	switch {
+	case errors.Is(err, services.ErrInvalidTwoFactorCode):
+		h.loginFailed(c, user.Email, &user)
+		attempts++
+		if attempts >= twoFactorMaxAttempts {
+			h.endTwoFactorLogin(sess)
+			audit.Record(c, h.db, loginAuditLog(&user, models.AuditActionLoginFailed, "too many two-factor attempts"))
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"code": "Too many wrong codes. Enter your password again.",
+			})
+		}
+		sess.Set("two_factor_attempts", attempts)
+		if err := sess.Save(); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to save session",
+			})
+		}
+		audit.Record(c, h.db, loginAuditLog(&user, models.AuditActionLoginFailed, "wrong two-factor code"))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"code": "Code is incorrect",
+		})
+	case errors.Is(err, services.ErrTwoFactorNotEnabled):
+		// Two-factor authentication was reset since the password was
+		// checked; the password alone is what the user now needs.
+	case err != nil:
+		log.Error("Failed to verify two-factor code", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to verify code",
+		})
+	}
+
+	h.endTwoFactorLogin(sess)
+	detail := "password"
+	if method != "" {
+		detail = "password, " + string(method)
+	}
+	return h.finishPasswordLogin(c, &user, detail)
+}
+
+// endTwoFactorLogin forgets the pending login, so the password must be
+// given again.
+func (h *Handler) endTwoFactorLogin(sess *session.Session) {
+	sess.Delete("two_factor_user_id")
+	sess.Delete("two_factor_expires_at")
+	sess.Delete("two_factor_attempts")
+	if err := sess.Save(); err != nil {
+		log.Error("Failed to save session", "error", err)
+	}
+}
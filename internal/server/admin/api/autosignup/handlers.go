@@ -2,7 +2,9 @@ package autosignup
 
 import (
 	"errors"
+	"fmt"
 
+	"github.com/amalshaji/portr/internal/server/admin/api/audit"
 	"github.com/amalshaji/portr/internal/server/admin/models"
 	"github.com/amalshaji/portr/internal/server/admin/services"
 	serverConfig "github.com/amalshaji/portr/internal/server/config"
@@ -11,12 +13,14 @@ import (
 )
 
 type Handler struct {
+	db         *gorm.DB
 	autoSignup *services.AutoSignupService
 	config     *serverConfig.AdminConfig
 }
 
 func NewHandler(db *gorm.DB, cfg *serverConfig.AdminConfig) *Handler {
 	return &Handler{
+		db:         db,
 		autoSignup: services.NewAutoSignupService(db),
 		config:     cfg,
 	}
@@ -24,6 +28,7 @@ func NewHandler(db *gorm.DB, cfg *serverConfig.AdminConfig) *Handler {
 
 type Response struct {
 	GitHubAuthEnabled bool                       `json:"github_auth_enabled"`
+	OIDCAuthEnabled   bool                       `json:"oidc_auth_enabled"`
 	AutoSignupEnabled bool                       `json:"auto_signup_enabled"`
 	AutoSignupDomains []AutoSignupDomainResponse `json:"auto_signup_domains"`
 }
@@ -70,9 +75,16 @@ func (h *Handler) Update(c *fiber.Ctx) error {
 		})
 	}
 
-	if input.AutoSignupEnabled && !h.githubAuthEnabled() {
+	if input.AutoSignupEnabled && !h.githubAuthEnabled() && !h.oidcAuthEnabled() {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "GitHub authentication must be configured before enabling auto signup",
+			"error": "GitHub or OpenID Connect authentication must be configured before enabling auto signup",
+		})
+	}
+
+	before, err := h.autoSignup.GetSettings()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load auto signup settings",
 		})
 	}
 
@@ -89,12 +101,38 @@ func (h *Handler) Update(c *fiber.Ctx) error {
 			"error": "Failed to update auto signup settings",
 		})
 	}
+	audit.Record(c, h.db, models.AuditLog{
+		Action:     models.AuditActionAutoSignupUpdated,
+		TargetType: models.AuditTargetServer,
+		Diff:       services.AuditDiff(auditFields(before), auditFields(settings)),
+	})
 
 	return c.JSON(h.response(settings))
 }
 
+// auditFields are the settings compared in the audit log, with each domain
+// written as "domain -> team id".
+func auditFields(settings *services.AutoSignupSettings) map[string]any {
+	domains := make([]string, 0, len(settings.Domains))
+	for _, domain := range settings.Domains {
+		domains = append(domains, fmt.Sprintf("%s -> %d", domain.Domain, domain.TeamID))
+	}
+	return map[string]any{
+		"auto_signup_enabled": settings.Settings.AutoSignupEnabled,
+		"auto_signup_domains": domains,
+	}
+}
+
 func (h *Handler) githubAuthEnabled() bool {
-	return h.config != nil && h.config.GithubClientID != "" && h.config.GithubSecret != ""
+	if h.config == nil {
+		return false
+	}
+	clientID, secret := h.config.GitHubCredentials()
+	return clientID != "" && secret != ""
+}
+
+func (h *Handler) oidcAuthEnabled() bool {
+	return h.config != nil && h.config.OIDCSettings().Enabled()
 }
 
 func autoSignupDomainInputs(input []AutoSignupDomainInput) []services.AutoSignupDomainInput {
@@ -111,6 +149,7 @@ func autoSignupDomainInputs(input []AutoSignupDomainInput) []services.AutoSignup
 func (h *Handler) response(settings *services.AutoSignupSettings) Response {
 	return Response{
 		GitHubAuthEnabled: h.githubAuthEnabled(),
+		OIDCAuthEnabled:   h.oidcAuthEnabled(),
 		AutoSignupEnabled: settings.Settings.AutoSignupEnabled,
 		AutoSignupDomains: autoSignupDomainResponses(settings.Domains),
 	}
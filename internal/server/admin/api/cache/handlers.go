@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"errors"
+
+	"github.com/amalshaji/portr/internal/server/admin/middleware"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type Handler struct {
+	service *services.CacheService
+}
+
+type purgeInput struct {
+	Subdomain string `json:"subdomain"`
+}
+
+type purgeResponse struct {
+	ID          uint64 `json:"id"`
+	Subdomain   string `json:"subdomain"`
+	RequestedAt string `json:"requested_at"`
+}
+
+func NewHandler(db *gorm.DB) *Handler {
+	return &Handler{service: services.NewCacheService(db)}
+}
+
+// Purge drops a subdomain's cached responses. Tunnel servers apply it
+// within a few seconds, hence 202.
+func (h *Handler) Purge(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Team context required"})
+	}
+
+	var input purgeInput
+	if err := c.BodyParser(&input); err != nil {
+		return apiError(c, fiber.StatusBadRequest, "invalid_input", "Invalid input")
+	}
+
+	purge, err := h.service.Purge(c.UserContext(), teamUser.TeamID, input.Subdomain)
+	if errors.Is(err, services.ErrCacheSubdomainNotFound) {
+		return apiError(c, fiber.StatusNotFound, "subdomain_not_found", "The subdomain must be reserved or used by a member of this team")
+	}
+	if err != nil {
+		return apiError(c, fiber.StatusInternalServerError, "cache_purge_failed", "Failed to purge the cache")
+	}
+	return c.Status(fiber.StatusAccepted).JSON(purgeResponse{
+		ID:          purge.ID,
+		Subdomain:   purge.Subdomain,
+		RequestedAt: purge.CreatedAt.UTC().Format("2006-01-02T15:04:05Z"),
+	})
+}
+
+func apiError(c *fiber.Ctx, status int, code, message string) error {
+	return c.Status(status).JSON(fiber.Map{"code": code, "message": message})
+}
@@ -1,14 +1,17 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"runtime"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/amalshaji/portr/internal/server/admin/api/audit"
 	"github.com/amalshaji/portr/internal/server/admin/middleware"
 	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
 	serverConfig "github.com/amalshaji/portr/internal/server/config"
 	"github.com/elastic/go-sysinfo"
 	"github.com/elastic/go-sysinfo/types"
@@ -75,14 +78,16 @@ type Handler struct {
 	store          *session.Store
 	config         *serverConfig.AdminConfig
 	statsCollector *serverStats.StatsCollector
+	reload         serverConfig.ReloadFunc
 }
 
-func NewHandler(db *gorm.DB, store *session.Store, cfg *serverConfig.AdminConfig, statsCollector *serverStats.StatsCollector) *Handler {
+func NewHandler(db *gorm.DB, store *session.Store, cfg *serverConfig.AdminConfig, statsCollector *serverStats.StatsCollector, reload serverConfig.ReloadFunc) *Handler {
 	return &Handler{
 		db:             db,
 		store:          store,
 		config:         cfg,
 		statsCollector: statsCollector,
+		reload:         reload,
 	}
 }
 
@@ -104,17 +109,19 @@ func (h *Handler) DownloadConfig(c *fiber.Ctx) error {
 		})
 	}
 
-	var teamUser models.TeamUser
-	err := h.db.Preload("Team").Where("secret_key = ?", input.SecretKey).First(&teamUser).Error
+	// The config carries the key it was downloaded with, so a device key
+	// stays that device's key and CI keeps its tunnel credential.
+	teamUser, err := h.teamUserForKey(c, input.SecretKey)
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Invalid secret key",
 		})
 	}
 
+	serverURL, sshURL := h.config.ClientURLs()
 	configContent := fmt.Sprintf(`server_url: %s
 ssh_url: %s
-secret_key: %s`, stripScheme(h.config.ServerURL), h.config.SshURL, teamUser.SecretKey)
+secret_key: %s`, stripScheme(serverURL), sshURL, input.SecretKey)
 
 	if h.config.SshHostKeyVerification {
 		configContent += "\ninsecure_skip_host_key_verification: false"
@@ -133,6 +140,20 @@ secret_key: %s`, stripScheme(h.config.ServerURL), h.config.SshURL, teamUser.Secr
 	})
 }
 
+// teamUserForKey returns the team user of a secret key, device key or tunnel
+// credential.
+func (h *Handler) teamUserForKey(c *fiber.Ctx, key string) (*models.TeamUser, error) {
+	if strings.HasPrefix(key, models.TunnelCredentialPrefix) {
+		credential, err := services.NewTunnelCredentialService(h.db).Authenticate(c.UserContext(), key)
+		if err != nil {
+			return nil, err
+		}
+		return &credential.TeamUser, nil
+	}
+	teamUser, _, err := services.NewDeviceKeyService(h.db).ResolveSecretKey(c.UserContext(), key, c.IP())
+	return teamUser, err
+}
+
 func (h *Handler) GetSetupScript(c *fiber.Ctx) error {
 	teamUser := middleware.GetCurrentTeamUser(c)
 	if teamUser == nil {
@@ -141,8 +162,9 @@ func (h *Handler) GetSetupScript(c *fiber.Ctx) error {
 		})
 	}
 
+	serverURL, _ := h.config.ClientURLs()
 	setupScript := fmt.Sprintf(`portr auth set --token %s --remote %s`,
-		teamUser.SecretKey, h.config.ServerURL)
+		teamUser.SecretKey, serverURL)
 
 	return c.JSON(fiber.Map{
 		"message": setupScript,
@@ -272,6 +294,41 @@ func (h *Handler) GetStats(c *fiber.Ctx) error {
 	})
 }
 
+// ReloadConfig re-reads the server configuration, applies the settings that
+// can change live and reports the ones that need a restart.
+func (h *Handler) ReloadConfig(c *fiber.Ctx) error {
+	report, err := h.reload()
+	if err != nil {
+		if errors.Is(err, serverConfig.ErrReloadUnavailable) {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error": "Config reload is not available",
+			})
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	audit.Record(c, h.db, models.AuditLog{
+		Action:     models.AuditActionConfigReloaded,
+		TargetType: models.AuditTargetServer,
+		Detail:     reloadDetail(report),
+	})
+
+	return c.JSON(report)
+}
+
+// reloadDetail summarizes a reload for the audit log.
+func reloadDetail(report serverConfig.ReloadReport) string {
+	detail := "applied: none"
+	if len(report.Applied) > 0 {
+		detail = "applied: " + strings.Join(report.Applied, ", ")
+	}
+	if len(report.RequiresRestart) > 0 {
+		detail += "; requires restart: " + strings.Join(report.RequiresRestart, ", ")
+	}
+	return detail
+}
+
 func stripScheme(value string) string {
 	return strings.TrimPrefix(strings.TrimPrefix(value, "https://"), "http://")
 }
@@ -1,11 +1,14 @@
 package config
 
 import (
+	"strconv"
 	"strings"
 
 	clientConfig "github.com/amalshaji/portr/internal/clientconfig"
+	"github.com/amalshaji/portr/internal/server/admin/api/audit"
 	"github.com/amalshaji/portr/internal/server/admin/middleware"
 	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -46,11 +49,22 @@ func (h *Handler) UpdateClientTemplate(c *fiber.Ctx) error {
 		})
 	}
 
+	previous := teamUser.Team.ClientTemplate
 	if err := h.db.Model(&teamUser.Team).Update("client_template", template).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to save client template",
 		})
 	}
+	audit.Record(c, h.db, models.AuditLog{
+		Action:     models.AuditActionClientTemplateUpdated,
+		TargetType: models.AuditTargetTeam,
+		TargetID:   strconv.FormatUint(uint64(teamUser.TeamID), 10),
+		Target:     teamUser.Team.Slug,
+		Diff: services.AuditDiff(
+			map[string]any{"client_template": previous},
+			map[string]any{"client_template": template},
+		),
+	})
 
 	return c.JSON(clientTemplateResponse(teamUser.Team))
 }
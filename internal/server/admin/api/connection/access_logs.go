@@ -0,0 +1,125 @@
+package connection
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/amalshaji/portr/internal/server/admin/middleware"
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"github.com/amalshaji/portr/internal/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+type AccessLogResponse struct {
+	ID           uint64 `json:"id"`
+	ConnectionID string `json:"connection_id"`
+	RequestID    string `json:"request_id"`
+	Timestamp    string `json:"timestamp"`
+	Subdomain    string `json:"subdomain"`
+	Owner        string `json:"owner"`
+	Method       string `json:"method"`
+	Path         string `json:"path"`
+	Status       int    `json:"status"`
+	LatencyMs    int64  `json:"latency_ms"`
+	BytesIn      int64  `json:"bytes_in"`
+	BytesOut     int64  `json:"bytes_out"`
+	VisitorIP    string `json:"visitor_ip"`
+}
+
+// GetAccessLogs returns a page of the requests a team connection served,
+// newest first.
+func (h *Handler) GetAccessLogs(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Team context required",
+		})
+	}
+
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	pageSize := c.QueryInt("page_size", 50)
+	if pageSize < 1 {
+		pageSize = 50
+	}
+	if pageSize > 500 {
+		pageSize = 500
+	}
+
+	logs, total, err := services.NewAccessLogService(h.db).
+		ListForConnection(c.UserContext(), teamUser.TeamID, c.Params("id"), pageSize, (page-1)*pageSize)
+	if errors.Is(err, services.ErrConnectionNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Connection not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load access logs",
+		})
+	}
+
+	items := make([]AccessLogResponse, 0, len(logs))
+	for _, entry := range logs {
+		items = append(items, accessLogResponseFor(entry))
+	}
+	return c.JSON(fiber.Map{
+		"count": total,
+		"data":  items,
+	})
+}
+
+// SearchAccessLogs finds the team's requests with the request_id a visitor
+// reported, across all connections.
+func (h *Handler) SearchAccessLogs(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Team context required",
+		})
+	}
+
+	requestID := strings.TrimSpace(c.Query("request_id"))
+	if !utils.ValidRequestID(requestID) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "A valid request_id is required",
+		})
+	}
+
+	logs, err := services.NewAccessLogService(h.db).FindByRequestID(c.UserContext(), teamUser.TeamID, requestID, 50)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load access logs",
+		})
+	}
+
+	items := make([]AccessLogResponse, 0, len(logs))
+	for _, entry := range logs {
+		items = append(items, accessLogResponseFor(entry))
+	}
+	return c.JSON(fiber.Map{
+		"count": len(items),
+		"data":  items,
+	})
+}
+
+func accessLogResponseFor(entry models.AccessLog) AccessLogResponse {
+	return AccessLogResponse{
+		ID:           entry.ID,
+		ConnectionID: entry.ConnectionID,
+		RequestID:    entry.RequestID,
+		Timestamp:    entry.CreatedAt.UTC().Format("2006-01-02T15:04:05.000Z"),
+		Subdomain:    entry.Subdomain,
+		Owner:        entry.Owner,
+		Method:       entry.Method,
+		Path:         entry.Path,
+		Status:       entry.Status,
+		LatencyMs:    entry.LatencyMs,
+		BytesIn:      entry.BytesIn,
+		BytesOut:     entry.BytesOut,
+		VisitorIP:    entry.VisitorIP,
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/amalshaji/portr/internal/server/admin/api/audit"
 	"github.com/amalshaji/portr/internal/server/admin/middleware"
 	"github.com/amalshaji/portr/internal/server/admin/models"
 	"github.com/amalshaji/portr/internal/server/admin/services"
@@ -16,37 +17,52 @@ import (
 )
 
 type Handler struct {
-	db          *gorm.DB
-	store       *session.Store
-	connections *services.ConnectionService
+	db                *gorm.DB
+	store             *session.Store
+	connections       *services.ConnectionService
+	deviceKeys        *services.DeviceKeyService
+	tunnelCredentials *services.TunnelCredentialService
+	throttle          *middleware.LoginThrottle
 }
 
-func NewHandler(db *gorm.DB, store *session.Store) *Handler {
+func NewHandler(db *gorm.DB, store *session.Store, throttle *middleware.LoginThrottle) *Handler {
 	return &Handler{
-		db:          db,
-		store:       store,
-		connections: services.NewConnectionService(db),
+		db:                db,
+		store:             store,
+		connections:       services.NewConnectionService(db),
+		deviceKeys:        services.NewDeviceKeyService(db),
+		tunnelCredentials: services.NewTunnelCredentialService(db),
+		throttle:          throttle,
 	}
 }
 
+// maxExpiresIn bounds the expires_in of a connection, in seconds.
+const maxExpiresIn = 365 * 24 * 60 * 60
+
 type CreateConnectionInput struct {
 	SecretKey      string  `json:"secret_key" validate:"required"`
 	ConnectionType string  `json:"connection_type" validate:"required,oneof=http tcp"`
 	Subdomain      *string `json:"subdomain"`
+	// ExpiresIn is how many seconds the tunnel may stay open.
+	ExpiresIn *int64 `json:"expires_in"`
 }
 
 type ConnectionResponse struct {
-	ID        string           `json:"id"`
-	Type      string           `json:"type"`
-	Subdomain *string          `json:"subdomain"`
-	Port      *uint32          `json:"port"`
-	Status    string           `json:"status"`
-	CreatedAt string           `json:"created_at"`
-	StartedAt *string          `json:"started_at"`
-	ClosedAt  *string          `json:"closed_at"`
-	CreatedBy TeamUserResponse `json:"created_by"`
-	Team      TeamResponse     `json:"team"`
-	Duration  *string          `json:"duration"`
+	ID               string           `json:"id"`
+	Type             string           `json:"type"`
+	Subdomain        *string          `json:"subdomain"`
+	Port             *uint32          `json:"port"`
+	Status           string           `json:"status"`
+	CreatedAt        string           `json:"created_at"`
+	StartedAt        *string          `json:"started_at"`
+	ClosedAt         *string          `json:"closed_at"`
+	ExpiresAt        *string          `json:"expires_at"`
+	CloseReason      *string          `json:"close_reason"`
+	CreatedBy        TeamUserResponse `json:"created_by"`
+	DeviceKey        *string          `json:"device_key"`
+	TunnelCredential *string          `json:"tunnel_credential"`
+	Team             TeamResponse     `json:"team"`
+	Duration         *string          `json:"duration"`
 }
 
 type TeamUserResponse struct {
@@ -104,7 +120,7 @@ func (h *Handler) GetConnections(c *fiber.Ctx) error {
 	query.Count(&total)
 
 	var connections []models.Connection
-	err := query.Preload("CreatedBy").Preload("CreatedBy.User").Preload("Team").
+	err := query.Preload("CreatedBy").Preload("CreatedBy.User").Preload("DeviceKey").Preload("TunnelCredential").Preload("Team").
 		Order("created_at DESC").
 		Limit(pageSize).Offset(offset).
 		Find(&connections).Error
@@ -119,12 +135,13 @@ func (h *Handler) GetConnections(c *fiber.Ctx) error {
 	var items []ConnectionResponse
 	for _, conn := range connections {
 		item := ConnectionResponse{
-			ID:        conn.ID,
-			Type:      conn.Type,
-			Subdomain: conn.Subdomain,
-			Port:      conn.Port,
-			Status:    conn.Status,
-			CreatedAt: conn.CreatedAt.Format("2006-01-02T15:04:05Z"),
+			ID:          conn.ID,
+			Type:        conn.Type,
+			Subdomain:   conn.Subdomain,
+			Port:        conn.Port,
+			Status:      conn.Status,
+			CreatedAt:   conn.CreatedAt.Format("2006-01-02T15:04:05Z"),
+			CloseReason: conn.CloseReason,
 			CreatedBy: TeamUserResponse{
 				ID: conn.CreatedBy.ID,
 				User: UserResponse{
@@ -142,6 +159,13 @@ func (h *Handler) GetConnections(c *fiber.Ctx) error {
 			},
 		}
 
+		if conn.DeviceKey != nil {
+			item.DeviceKey = &conn.DeviceKey.Name
+		}
+		if conn.TunnelCredential != nil {
+			item.TunnelCredential = &conn.TunnelCredential.Name
+		}
+
 		if conn.StartedAt != nil {
 			startedAtStr := conn.StartedAt.Format("2006-01-02T15:04:05Z")
 			item.StartedAt = &startedAtStr
@@ -152,6 +176,11 @@ func (h *Handler) GetConnections(c *fiber.Ctx) error {
 			item.ClosedAt = &closedAtStr
 		}
 
+		if conn.ExpiresAt != nil {
+			expiresAtStr := conn.ExpiresAt.UTC().Format("2006-01-02T15:04:05Z")
+			item.ExpiresAt = &expiresAtStr
+		}
+
 		// Calculate duration if connection was started
 		if duration := conn.Duration(); duration != nil {
 			durationStr := formatDuration(*duration)
@@ -202,17 +231,67 @@ func (h *Handler) CreateConnection(c *fiber.Ctx) error {
 		}
 		input.Subdomain = &subdomain
 	}
+	var expiresAt *time.Time
+	if input.ExpiresIn != nil {
+		if *input.ExpiresIn <= 0 || *input.ExpiresIn > maxExpiresIn {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "expires_in must be between 1 second and 365 days",
+			})
+		}
+		at := time.Now().UTC().Add(time.Duration(*input.ExpiresIn) * time.Second)
+		expiresAt = &at
+	}
+
+	if wait := h.throttle.SecretKeyWait(c.IP()); wait > 0 {
+		return middleware.TooManyAttempts(c, wait, "message")
+	}
+
+	if strings.HasPrefix(secretKey, models.TunnelCredentialPrefix) {
+		return h.createWithTunnelCredential(c, secretKey, input, expiresAt)
+	}
+
+	// Find team user by secret key or device key
+	teamUser, deviceKey, err := h.deviceKeys.ResolveSecretKey(c.UserContext(), secretKey, c.IP())
+	if err != nil {
+		return h.invalidSecretKey(c, err)
+	}
+	var key services.ConnectionKey
+	if deviceKey != nil {
+		key.DeviceKeyID = &deviceKey.ID
+	}
+
+	connection, err := h.connections.Create(c.UserContext(), teamUser, input.ConnectionType, input.Subdomain, expiresAt, key)
+	if err != nil {
+		return handleCreateConnectionError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"connection_id": connection.ID,
+	})
+}
 
-	// Find team user by secret key
-	var teamUser models.TeamUser
-	err := h.db.Preload("Team").Where("secret_key = ?", secretKey).First(&teamUser).Error
+// createWithTunnelCredential opens a tunnel with an ephemeral tunnel
+// credential, within the connection type, subdomain pattern and lifetime it
+// was minted with.
+func (h *Handler) createWithTunnelCredential(c *fiber.Ctx, secret string, input CreateConnectionInput, expiresAt *time.Time) error {
+	credential, err := h.tunnelCredentials.Authenticate(c.UserContext(), secret)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"message": "Invalid secret key",
+		return h.invalidSecretKey(c, err)
+	}
+	expiresAt, err = h.tunnelCredentials.Allow(credential, input.ConnectionType, input.Subdomain, expiresAt)
+	if err != nil {
+		message := "This credential only opens " + credential.ConnectionType + " tunnels"
+		if credential.ConnectionType == models.ConnectionTypeHTTP {
+			message += " on subdomains matching " + credential.SubdomainPattern
+		}
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"code":    "credential_not_allowed",
+			"message": message,
 		})
 	}
 
-	connection, err := h.connections.Create(c.UserContext(), &teamUser, input.ConnectionType, input.Subdomain)
+	key := services.ConnectionKey{TunnelCredentialID: &credential.ID}
+	connection, err := h.connections.Create(c.UserContext(), &credential.TeamUser, input.ConnectionType, input.Subdomain, expiresAt, key)
 	if err != nil {
 		return handleCreateConnectionError(c, err)
 	}
@@ -222,6 +301,17 @@ func (h *Handler) CreateConnection(c *fiber.Ctx) error {
 	})
 }
 
+// invalidSecretKey answers a request whose key could not be resolved,
+// counting unknown keys against the client's address.
+func (h *Handler) invalidSecretKey(c *fiber.Ctx, err error) error {
+	if errors.Is(err, services.ErrInvalidSecretKey) {
+		middleware.RecordSecretKeyFailure(c, h.db, h.throttle)
+	}
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"message": "Invalid secret key",
+	})
+}
+
 func handleCreateConnectionError(c *fiber.Ctx, err error) error {
 	switch {
 	case errors.Is(err, services.ErrSubdomainReserved):
@@ -265,3 +355,41 @@ func formatDuration(d time.Duration) string {
 	}
 	return fmt.Sprintf("%dh %dm", hours, minutes)
 }
+
+// CloseConnection force-closes a tunnel. The tunnel server serving it tears
+// it down on its next reconcile, whether or not it runs in this process.
+func (h *Handler) CloseConnection(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Team context required",
+		})
+	}
+
+	err := h.connections.ForceClose(c.UserContext(), teamUser, c.Params("id"))
+	switch {
+	case errors.Is(err, services.ErrConnectionNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Connection not found",
+		})
+	case errors.Is(err, services.ErrAdminAccessRequired):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Only team admins can close other members' connections",
+		})
+	case errors.Is(err, services.ErrConnectionClosed):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Connection is already closed",
+		})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to close connection",
+		})
+	}
+	audit.Record(c, h.db, models.AuditLog{
+		Action:     models.AuditActionConnectionClosed,
+		TargetType: models.AuditTargetConnection,
+		TargetID:   c.Params("id"),
+	})
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,169 @@
+package devicekey
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/api/audit"
+	"github.com/amalshaji/portr/internal/server/admin/middleware"
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	serverConfig "github.com/amalshaji/portr/internal/server/config"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// maxExpiresInDays bounds how far ahead a key's expiry can be set.
+const maxExpiresInDays = 366
+
+type Handler struct {
+	db      *gorm.DB
+	config  *serverConfig.AdminConfig
+	service *services.DeviceKeyService
+}
+
+type createInput struct {
+	Name string `json:"name"`
+	// ExpiresInDays is the key's lifetime; 0 or unset never expires.
+	ExpiresInDays int `json:"expires_in_days"`
+}
+
+type deviceKeyResponse struct {
+	ID         uint    `json:"id"`
+	Name       string  `json:"name"`
+	Prefix     string  `json:"prefix"`
+	CreatedAt  string  `json:"created_at"`
+	ExpiresAt  *string `json:"expires_at"`
+	LastUsedAt *string `json:"last_used_at"`
+	LastUsedIP *string `json:"last_used_ip"`
+	RevokedAt  *string `json:"revoked_at"`
+	// Key and SetupCommand are only set in the response to creating the key.
+	Key          string `json:"key,omitempty"`
+	SetupCommand string `json:"setup_command,omitempty"`
+}
+
+func NewHandler(db *gorm.DB, config *serverConfig.AdminConfig) *Handler {
+	return &Handler{db: db, config: config, service: services.NewDeviceKeyService(db)}
+}
+
+func (h *Handler) List(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Team context required"})
+	}
+
+	keys, err := h.service.List(c.UserContext(), teamUser.ID)
+	if err != nil {
+		return apiError(c, fiber.StatusInternalServerError, "device_key_load_failed", "Failed to load device keys")
+	}
+
+	data := make([]deviceKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		data = append(data, responseFor(key))
+	}
+	return c.JSON(fiber.Map{"data": data, "count": len(data)})
+}
+
+func (h *Handler) Create(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Team context required"})
+	}
+
+	var input createInput
+	if err := c.BodyParser(&input); err != nil {
+		return apiError(c, fiber.StatusBadRequest, "invalid_input", "Invalid input")
+	}
+	if input.ExpiresInDays < 0 || input.ExpiresInDays > maxExpiresInDays {
+		return apiError(c, fiber.StatusBadRequest, "invalid_expiry", "expires_in_days must be between 0 and "+strconv.Itoa(maxExpiresInDays))
+	}
+	var expiresAt *time.Time
+	if input.ExpiresInDays > 0 {
+		at := time.Now().UTC().AddDate(0, 0, input.ExpiresInDays)
+		expiresAt = &at
+	}
+
+	key, secret, err := h.service.Create(c.UserContext(), teamUser.ID, input.Name, expiresAt)
+	if err != nil {
+		return handleServiceError(c, err)
+	}
+	audit.Record(c, h.db, auditLogFor(models.AuditActionDeviceKeyCreated, key))
+
+	serverURL, _ := h.config.ClientURLs()
+	response := responseFor(*key)
+	response.Key = secret
+	response.SetupCommand = fmt.Sprintf("portr auth set --token %s --remote %s", secret, serverURL)
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+func (h *Handler) Revoke(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Team context required"})
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return apiError(c, fiber.StatusBadRequest, "invalid_id", "Invalid device key id")
+	}
+	key, err := h.service.Revoke(c.UserContext(), teamUser.ID, uint(id))
+	if err != nil {
+		return handleServiceError(c, err)
+	}
+	audit.Record(c, h.db, auditLogFor(models.AuditActionDeviceKeyRevoked, key))
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func handleServiceError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrDeviceKeyNameRequired):
+		return apiError(c, fiber.StatusBadRequest, "name_required", "Name the key")
+	case errors.Is(err, services.ErrInvalidDeviceKeyExpiry):
+		return apiError(c, fiber.StatusBadRequest, "invalid_expiry", "The expiry must be in the future")
+	case errors.Is(err, services.ErrDeviceKeyNotFound):
+		return apiError(c, fiber.StatusNotFound, "device_key_not_found", "Device key not found")
+	default:
+		return apiError(c, fiber.StatusInternalServerError, "device_key_failed", "Failed to update device keys")
+	}
+}
+
+func auditLogFor(action string, key *models.DeviceKey) models.AuditLog {
+	return models.AuditLog{
+		Action:     action,
+		TargetType: models.AuditTargetDeviceKey,
+		TargetID:   strconv.FormatUint(uint64(key.ID), 10),
+		Target:     key.Name,
+		Detail:     "prefix: " + key.Prefix,
+	}
+}
+
+func responseFor(key models.DeviceKey) deviceKeyResponse {
+	return deviceKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		CreatedAt:  formatTime(key.CreatedAt),
+		ExpiresAt:  formatOptionalTime(key.ExpiresAt),
+		LastUsedAt: formatOptionalTime(key.LastUsedAt),
+		LastUsedIP: key.LastUsedIP,
+		RevokedAt:  formatOptionalTime(key.RevokedAt),
+	}
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+func formatOptionalTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := formatTime(*t)
+	return &formatted
+}
+
+func apiError(c *fiber.Ctx, status int, code, message string) error {
+	return c.Status(status).JSON(fiber.Map{"code": code, "message": message})
+}
@@ -0,0 +1,117 @@
+package errorpage
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/amalshaji/portr/internal/server/admin/middleware"
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type Handler struct {
+	service *services.ErrorPageService
+}
+
+type saveInput struct {
+	HTML      string `json:"html"`
+	Subdomain string `json:"subdomain"`
+}
+
+type errorPageResponse struct {
+	Kind      string  `json:"kind"`
+	Subdomain *string `json:"subdomain"`
+	HTML      string  `json:"html"`
+	UpdatedAt string  `json:"updated_at"`
+}
+
+func NewHandler(db *gorm.DB) *Handler {
+	return &Handler{service: services.NewErrorPageService(db)}
+}
+
+func (h *Handler) List(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Team context required"})
+	}
+
+	pages, err := h.service.List(c.UserContext(), teamUser.TeamID)
+	if err != nil {
+		return apiError(c, fiber.StatusInternalServerError, "error_page_load_failed", "Failed to load error pages")
+	}
+
+	data := make([]errorPageResponse, 0, len(pages))
+	for _, page := range pages {
+		data = append(data, responseFor(page))
+	}
+	return c.JSON(fiber.Map{"data": data, "count": len(data)})
+}
+
+func (h *Handler) Save(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Team context required"})
+	}
+
+	var input saveInput
+	if err := c.BodyParser(&input); err != nil {
+		return apiError(c, fiber.StatusBadRequest, "invalid_input", "Invalid input")
+	}
+
+	page, err := h.service.Save(c.UserContext(), teamUser.TeamID, c.Params("kind"), input.Subdomain, input.HTML)
+	if err != nil {
+		return handleServiceError(c, err)
+	}
+	if page.ReservationID != nil {
+		subdomain := strings.ToLower(strings.TrimSpace(input.Subdomain))
+		page.Reservation = &models.SubdomainReservation{Subdomain: subdomain}
+	}
+	return c.JSON(responseFor(*page))
+}
+
+func (h *Handler) Delete(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Team context required"})
+	}
+
+	if err := h.service.Delete(c.UserContext(), teamUser.TeamID, c.Params("kind"), c.Query("subdomain")); err != nil {
+		return handleServiceError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func handleServiceError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidErrorPageKind):
+		return apiError(c, fiber.StatusBadRequest, "invalid_kind", "Kind must be unregistered-subdomain, connection-lost or local-server-not-online")
+	case errors.Is(err, services.ErrErrorPageEmpty):
+		return apiError(c, fiber.StatusBadRequest, "empty_error_page", "Error page HTML is required")
+	case errors.Is(err, services.ErrErrorPageTooLarge):
+		return apiError(c, fiber.StatusRequestEntityTooLarge, "error_page_too_large", "Error pages are limited to 64 KB")
+	case errors.Is(err, services.ErrReservationNotFound):
+		return apiError(c, fiber.StatusNotFound, "reservation_not_found", "The subdomain is not reserved by this team")
+	case errors.Is(err, services.ErrErrorPageNotFound):
+		return apiError(c, fiber.StatusNotFound, "error_page_not_found", "Error page not found")
+	default:
+		return apiError(c, fiber.StatusInternalServerError, "error_page_failed", "Failed to update error pages")
+	}
+}
+
+func responseFor(page models.ErrorPage) errorPageResponse {
+	response := errorPageResponse{
+		Kind:      page.Kind,
+		HTML:      page.Body,
+		UpdatedAt: page.UpdatedAt.UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	if page.Reservation != nil {
+		response.Subdomain = &page.Reservation.Subdomain
+	}
+	return response
+}
+
+func apiError(c *fiber.Ctx, status int, code, message string) error {
+	return c.Status(status).JSON(fiber.Map{"code": code, "message": message})
+}
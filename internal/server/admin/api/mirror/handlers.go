@@ -0,0 +1,120 @@
+package mirror
+
+import (
+	"errors"
+
+	"github.com/amalshaji/portr/internal/server/admin/middleware"
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type Handler struct {
+	service *services.MirrorService
+}
+
+type createInput struct {
+	Source       string `json:"source"`
+	Target       string `json:"target"`
+	MaxBodyBytes int64  `json:"max_body_bytes"`
+}
+
+type mirrorResponse struct {
+	ID            uint   `json:"id"`
+	Source        string `json:"source"`
+	Target        string `json:"target"`
+	MaxBodyBytes  int64  `json:"max_body_bytes"`
+	MirroredCount int64  `json:"mirrored_count"`
+	FailedCount   int64  `json:"failed_count"`
+	CreatedAt     string `json:"created_at"`
+}
+
+func NewHandler(db *gorm.DB) *Handler {
+	return &Handler{service: services.NewMirrorService(db)}
+}
+
+func (h *Handler) List(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Team context required"})
+	}
+
+	rules, err := h.service.List(c.UserContext(), teamUser.TeamID)
+	if err != nil {
+		return apiError(c, fiber.StatusInternalServerError, "mirror_load_failed", "Failed to load mirror rules")
+	}
+
+	data := make([]mirrorResponse, 0, len(rules))
+	for _, rule := range rules {
+		data = append(data, responseFor(rule))
+	}
+	return c.JSON(fiber.Map{"data": data, "count": len(data)})
+}
+
+func (h *Handler) Create(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Team context required"})
+	}
+
+	var input createInput
+	if err := c.BodyParser(&input); err != nil {
+		return apiError(c, fiber.StatusBadRequest, "invalid_input", "Invalid input")
+	}
+
+	rule, err := h.service.Create(c.UserContext(), teamUser.TeamID, input.Source, input.Target, input.MaxBodyBytes)
+	if err != nil {
+		return handleServiceError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(responseFor(*rule))
+}
+
+func (h *Handler) Delete(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Team context required"})
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return apiError(c, fiber.StatusBadRequest, "invalid_id", "Invalid mirror rule id")
+	}
+	if err := h.service.Delete(c.UserContext(), teamUser.TeamID, uint(id)); err != nil {
+		return handleServiceError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func handleServiceError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrMirrorSameSubdomain):
+		return apiError(c, fiber.StatusBadRequest, "mirror_same_subdomain", "A subdomain cannot be mirrored to itself")
+	case errors.Is(err, services.ErrMirrorBodyLimit):
+		return apiError(c, fiber.StatusBadRequest, "invalid_body_limit", "max_body_bytes must be between 0 and 10 MB")
+	case errors.Is(err, services.ErrReservationNotFound):
+		return apiError(c, fiber.StatusNotFound, "reservation_not_found", "Both subdomains must be reserved by members of this team")
+	case errors.Is(err, services.ErrMirrorExists):
+		return apiError(c, fiber.StatusConflict, "mirror_exists", "This subdomain is already mirrored")
+	case errors.Is(err, services.ErrMirrorNotFound):
+		return apiError(c, fiber.StatusNotFound, "mirror_not_found", "Mirror rule not found")
+	default:
+		return apiError(c, fiber.StatusInternalServerError, "mirror_failed", "Failed to update mirror rules")
+	}
+}
+
+func responseFor(rule models.MirrorRule) mirrorResponse {
+	return mirrorResponse{
+		ID:            rule.ID,
+		Source:        rule.SourceReservation.Subdomain,
+		Target:        rule.TargetReservation.Subdomain,
+		MaxBodyBytes:  rule.MaxBodyBytes,
+		MirroredCount: rule.MirroredCount,
+		FailedCount:   rule.FailedCount,
+		CreatedAt:     rule.CreatedAt.UTC().Format("2006-01-02T15:04:05Z"),
+	}
+}
+
+func apiError(c *fiber.Ctx, status int, code, message string) error {
+	return c.Status(status).JSON(fiber.Map{"code": code, "message": message})
+}
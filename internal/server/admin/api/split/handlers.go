@@ -0,0 +1,156 @@
+package split
+
+import (
+	"errors"
+
+	"github.com/amalshaji/portr/internal/server/admin/middleware"
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// defaultPrimaryWeight splits traffic evenly when a route does not say.
+const defaultPrimaryWeight = 50
+
+type Handler struct {
+	service *services.SplitService
+}
+
+type createInput struct {
+	Subdomain     string `json:"subdomain"`
+	Primary       string `json:"primary"`
+	Secondary     string `json:"secondary"`
+	PrimaryWeight *int   `json:"primary_weight"`
+	Sticky        bool   `json:"sticky"`
+}
+
+type updateInput struct {
+	PrimaryWeight *int  `json:"primary_weight"`
+	Sticky        *bool `json:"sticky"`
+}
+
+type splitResponse struct {
+	ID            uint   `json:"id"`
+	Subdomain     string `json:"subdomain"`
+	Primary       string `json:"primary"`
+	Secondary     string `json:"secondary"`
+	PrimaryWeight int    `json:"primary_weight"`
+	Sticky        bool   `json:"sticky"`
+	CreatedAt     string `json:"created_at"`
+}
+
+func NewHandler(db *gorm.DB) *Handler {
+	return &Handler{service: services.NewSplitService(db)}
+}
+
+func (h *Handler) List(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Team context required"})
+	}
+
+	routes, err := h.service.List(c.UserContext(), teamUser.TeamID)
+	if err != nil {
+		return apiError(c, fiber.StatusInternalServerError, "split_load_failed", "Failed to load split routes")
+	}
+
+	data := make([]splitResponse, 0, len(routes))
+	for _, route := range routes {
+		data = append(data, responseFor(route))
+	}
+	return c.JSON(fiber.Map{"data": data, "count": len(data)})
+}
+
+func (h *Handler) Create(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Team context required"})
+	}
+
+	var input createInput
+	if err := c.BodyParser(&input); err != nil {
+		return apiError(c, fiber.StatusBadRequest, "invalid_input", "Invalid input")
+	}
+	weight := defaultPrimaryWeight
+	if input.PrimaryWeight != nil {
+		weight = *input.PrimaryWeight
+	}
+
+	route, err := h.service.Create(c.UserContext(), teamUser.TeamID, input.Subdomain, input.Primary, input.Secondary, weight, input.Sticky)
+	if err != nil {
+		return handleServiceError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(responseFor(*route))
+}
+
+func (h *Handler) Update(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Team context required"})
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return apiError(c, fiber.StatusBadRequest, "invalid_id", "Invalid split route id")
+	}
+	var input updateInput
+	if err := c.BodyParser(&input); err != nil {
+		return apiError(c, fiber.StatusBadRequest, "invalid_input", "Invalid input")
+	}
+
+	route, err := h.service.Update(c.UserContext(), teamUser.TeamID, uint(id), input.PrimaryWeight, input.Sticky)
+	if err != nil {
+		return handleServiceError(c, err)
+	}
+	return c.JSON(responseFor(*route))
+}
+
+func (h *Handler) Delete(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Team context required"})
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return apiError(c, fiber.StatusBadRequest, "invalid_id", "Invalid split route id")
+	}
+	if err := h.service.Delete(c.UserContext(), teamUser.TeamID, uint(id)); err != nil {
+		return handleServiceError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func handleServiceError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrSplitSubdomains):
+		return apiError(c, fiber.StatusBadRequest, "split_subdomains", "The split, primary and secondary subdomains must be different")
+	case errors.Is(err, services.ErrSplitWeight):
+		return apiError(c, fiber.StatusBadRequest, "invalid_weight", "primary_weight must be between 0 and 100")
+	case errors.Is(err, services.ErrReservationNotFound):
+		return apiError(c, fiber.StatusNotFound, "reservation_not_found", "All subdomains must be reserved by members of this team")
+	case errors.Is(err, services.ErrSplitExists):
+		return apiError(c, fiber.StatusConflict, "split_exists", "This subdomain is already split")
+	case errors.Is(err, services.ErrSplitNotFound):
+		return apiError(c, fiber.StatusNotFound, "split_not_found", "Split route not found")
+	default:
+		return apiError(c, fiber.StatusInternalServerError, "split_failed", "Failed to update split routes")
+	}
+}
+
+func responseFor(route models.SplitRoute) splitResponse {
+	return splitResponse{
+		ID:            route.ID,
+		Subdomain:     route.Reservation.Subdomain,
+		Primary:       route.PrimaryReservation.Subdomain,
+		Secondary:     route.SecondaryReservation.Subdomain,
+		PrimaryWeight: route.PrimaryWeight,
+		Sticky:        route.Sticky,
+		CreatedAt:     route.CreatedAt.UTC().Format("2006-01-02T15:04:05Z"),
+	}
+}
+
+func apiError(c *fiber.Ctx, status int, code, message string) error {
+	return c.Status(status).JSON(fiber.Map{"code": code, "message": message})
+}
@@ -0,0 +1,117 @@
+package sshkey
+
+import (
+	"errors"
+
+	"github.com/amalshaji/portr/internal/server/admin/middleware"
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type Handler struct {
+	service *services.SshKeyService
+}
+
+type createInput struct {
+	Name      string `json:"name"`
+	PublicKey string `json:"public_key"`
+}
+
+type sshKeyResponse struct {
+	ID          uint    `json:"id"`
+	Name        string  `json:"name"`
+	PublicKey   string  `json:"public_key"`
+	Fingerprint string  `json:"fingerprint"`
+	CreatedAt   string  `json:"created_at"`
+	LastUsedAt  *string `json:"last_used_at"`
+}
+
+func NewHandler(db *gorm.DB) *Handler {
+	return &Handler{service: services.NewSshKeyService(db)}
+}
+
+func (h *Handler) List(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Team context required"})
+	}
+
+	keys, err := h.service.List(c.UserContext(), teamUser.ID)
+	if err != nil {
+		return apiError(c, fiber.StatusInternalServerError, "ssh_key_load_failed", "Failed to load SSH keys")
+	}
+
+	data := make([]sshKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		data = append(data, responseFor(key))
+	}
+	return c.JSON(fiber.Map{"data": data, "count": len(data)})
+}
+
+func (h *Handler) Create(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Team context required"})
+	}
+
+	var input createInput
+	if err := c.BodyParser(&input); err != nil {
+		return apiError(c, fiber.StatusBadRequest, "invalid_input", "Invalid input")
+	}
+
+	key, err := h.service.Add(c.UserContext(), teamUser.ID, input.Name, input.PublicKey)
+	if err != nil {
+		return handleServiceError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(responseFor(*key))
+}
+
+func (h *Handler) Delete(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Team context required"})
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return apiError(c, fiber.StatusBadRequest, "invalid_id", "Invalid SSH key id")
+	}
+	if err := h.service.Delete(c.UserContext(), teamUser.ID, uint(id)); err != nil {
+		return handleServiceError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func handleServiceError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidSshKey):
+		return apiError(c, fiber.StatusBadRequest, "invalid_public_key", "Paste a public key in authorized_keys format")
+	case errors.Is(err, services.ErrSshKeyExists):
+		return apiError(c, fiber.StatusConflict, "ssh_key_exists", "This SSH key is already registered")
+	case errors.Is(err, services.ErrSshKeyNotFound):
+		return apiError(c, fiber.StatusNotFound, "ssh_key_not_found", "SSH key not found")
+	default:
+		return apiError(c, fiber.StatusInternalServerError, "ssh_key_failed", "Failed to update SSH keys")
+	}
+}
+
+func responseFor(key models.SshKey) sshKeyResponse {
+	response := sshKeyResponse{
+		ID:          key.ID,
+		Name:        key.Name,
+		PublicKey:   key.PublicKey,
+		Fingerprint: key.Fingerprint,
+		CreatedAt:   key.CreatedAt.UTC().Format("2006-01-02T15:04:05Z"),
+	}
+	if key.LastUsedAt != nil {
+		lastUsedAt := key.LastUsedAt.UTC().Format("2006-01-02T15:04:05Z")
+		response.LastUsedAt = &lastUsedAt
+	}
+	return response
+}
+
+func apiError(c *fiber.Ctx, status int, code, message string) error {
+	return c.Status(status).JSON(fiber.Map{"code": code, "message": message})
+}
@@ -3,8 +3,12 @@ package subdomain
 import (
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
+	"github.com/amalshaji/portr/internal/server/admin/api/audit"
 	"github.com/amalshaji/portr/internal/server/admin/middleware"
+	"github.com/amalshaji/portr/internal/server/admin/models"
 	"github.com/amalshaji/portr/internal/server/admin/services"
 	serverConfig "github.com/amalshaji/portr/internal/server/config"
 	"github.com/amalshaji/portr/internal/utils"
@@ -14,23 +18,43 @@ import (
 
 const invalidSubdomainMessage = "Use 1-63 lowercase letters, numbers, or internal hyphens"
 
+// A reservation's owner is either the member who holds it or the team.
+const (
+	ownerMember = "member"
+	ownerTeam   = "team"
+)
+
 type Handler struct {
+	db      *gorm.DB
 	service *services.SubdomainService
 	config  *serverConfig.AdminConfig
 }
 
 type createInput struct {
 	Subdomain string `json:"subdomain"`
+	Owner     string `json:"owner"`
+}
+
+type transferInput struct {
+	Owner      string `json:"owner"`
+	TeamUserID *uint  `json:"team_user_id"`
+}
+
+type membersInput struct {
+	TeamUserIDs []uint `json:"team_user_ids"`
 }
 
 type reservationResponse struct {
-	Subdomain   string                        `json:"subdomain"`
-	CreatedAt   string                        `json:"created_at"`
-	ClaimStatus services.SubdomainClaimStatus `json:"claim_status"`
+	Subdomain      string                        `json:"subdomain"`
+	CreatedAt      string                        `json:"created_at"`
+	ClaimStatus    services.SubdomainClaimStatus `json:"claim_status"`
+	Owner          string                        `json:"owner"`
+	AllowedMembers []string                      `json:"allowed_members"`
+	CanRelease     bool                          `json:"can_release"`
 }
 
 func NewHandler(db *gorm.DB, config *serverConfig.AdminConfig) *Handler {
-	return &Handler{service: services.NewSubdomainService(db), config: config}
+	return &Handler{db: db, service: services.NewSubdomainService(db), config: config}
 }
 
 func (h *Handler) List(c *fiber.Ctx) error {
@@ -39,7 +63,7 @@ func (h *Handler) List(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Team context required"})
 	}
 
-	reservations, err := h.service.List(c.UserContext(), teamUser.ID)
+	reservations, err := h.service.List(c.UserContext(), teamUser)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"code":    "reservation_load_failed",
@@ -49,13 +73,13 @@ func (h *Handler) List(c *fiber.Ctx) error {
 
 	data := make([]reservationResponse, 0, len(reservations))
 	for _, item := range reservations {
-		data = append(data, responseFor(item))
+		data = append(data, responseFor(item, teamUser))
 	}
 
 	return c.JSON(fiber.Map{
 		"data":        data,
 		"count":       len(data),
-		"limit":       h.config.ReservedSubdomainLimit,
+		"limit":       h.config.ReservationLimit(),
 		"base_domain": h.config.TunnelDomain,
 	})
 }
@@ -76,12 +100,24 @@ func (h *Handler) Create(c *fiber.Ctx) error {
 		return apiError(c, fiber.StatusBadRequest, "invalid_subdomain", invalidSubdomainMessage)
 	}
 
-	reservation, err := h.service.Reserve(c.UserContext(), teamUser.ID, subdomain, h.config.ReservedSubdomainLimit)
+	var reservation *services.ReservedSubdomain
+	var err error
+	switch input.Owner {
+	case "", ownerMember:
+		reservation, err = h.service.Reserve(c.UserContext(), teamUser.ID, subdomain, h.config.ReservationLimit())
+	case ownerTeam:
+		if !teamUser.CanManageTeam() {
+			return apiError(c, fiber.StatusForbidden, "admin_required", "Only team admins can reserve subdomains for the team")
+		}
+		reservation, err = h.service.ReserveForTeam(c.UserContext(), teamUser.ID, subdomain)
+	default:
+		return apiError(c, fiber.StatusBadRequest, "invalid_owner", "owner must be either 'member' or 'team'")
+	}
 	if err != nil {
 		return h.handleServiceError(c, err)
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(responseFor(*reservation))
+	return c.Status(fiber.StatusCreated).JSON(responseFor(*reservation, teamUser))
 }
 
 func (h *Handler) Delete(c *fiber.Ctx) error {
@@ -95,34 +131,133 @@ func (h *Handler) Delete(c *fiber.Ctx) error {
 		return apiError(c, fiber.StatusBadRequest, "invalid_subdomain", invalidSubdomainMessage)
 	}
 
-	if err := h.service.Release(c.UserContext(), teamUser.ID, subdomain); err != nil {
+	if err := h.service.Release(c.UserContext(), teamUser, subdomain); err != nil {
 		return h.handleServiceError(c, err)
 	}
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
+// Transfer moves a reservation between the team's members and the team
+// itself, so a name stays usable while the member holding it is away.
+func (h *Handler) Transfer(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Team context required"})
+	}
+
+	subdomain := utils.NormalizeSubdomain(c.Params("subdomain"))
+	if err := utils.ValidateSubdomain(subdomain); err != nil {
+		return apiError(c, fiber.StatusBadRequest, "invalid_subdomain", invalidSubdomainMessage)
+	}
+	var input transferInput
+	if err := c.BodyParser(&input); err != nil {
+		return apiError(c, fiber.StatusBadRequest, "invalid_input", "Invalid input")
+	}
+	if input.Owner == ownerTeam {
+		input.TeamUserID = nil
+	} else if input.Owner != ownerMember || input.TeamUserID == nil {
+		return apiError(c, fiber.StatusBadRequest, "invalid_owner", "owner must be 'team', or 'member' with a team_user_id")
+	}
+
+	limit := h.config.ReservationLimit()
+	before, after, err := h.service.Transfer(c.UserContext(), teamUser.TeamID, subdomain, input.TeamUserID, limit)
+	if errors.Is(err, services.ErrReservationLimit) {
+		return apiError(c, fiber.StatusConflict, "reservation_limit_reached", fmt.Sprintf("Members can reserve up to %d subdomains", limit))
+	}
+	if err != nil {
+		return h.handleServiceError(c, err)
+	}
+	audit.Record(c, h.db, models.AuditLog{
+		Action:     models.AuditActionReservationMoved,
+		TargetType: models.AuditTargetSubdomain,
+		TargetID:   strconv.FormatUint(uint64(before.ID), 10),
+		Target:     before.Subdomain,
+		Detail:     describeOwner(before) + " -> " + describeOwner(&after.Reservation),
+	})
+	return c.JSON(responseFor(*after, teamUser))
+}
+
+// SetMembers replaces the members allowed to claim a team reservation
+// besides the team's admins.
+func (h *Handler) SetMembers(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Team context required"})
+	}
+
+	subdomain := utils.NormalizeSubdomain(c.Params("subdomain"))
+	if err := utils.ValidateSubdomain(subdomain); err != nil {
+		return apiError(c, fiber.StatusBadRequest, "invalid_subdomain", invalidSubdomainMessage)
+	}
+	var input membersInput
+	if err := c.BodyParser(&input); err != nil {
+		return apiError(c, fiber.StatusBadRequest, "invalid_input", "Invalid input")
+	}
+
+	reservation, err := h.service.SetAllowedMembers(c.UserContext(), teamUser.TeamID, subdomain, input.TeamUserIDs)
+	if err != nil {
+		return h.handleServiceError(c, err)
+	}
+	detail := "admins only"
+	if len(reservation.AllowedMembers) > 0 {
+		detail = strings.Join(reservation.AllowedMembers, ", ")
+	}
+	audit.Record(c, h.db, models.AuditLog{
+		Action:     models.AuditActionReservationMembers,
+		TargetType: models.AuditTargetSubdomain,
+		TargetID:   strconv.FormatUint(uint64(reservation.Reservation.ID), 10),
+		Target:     reservation.Reservation.Subdomain,
+		Detail:     detail,
+	})
+	return c.JSON(responseFor(*reservation, teamUser))
+}
+
+// describeOwner names a reservation's owner for the audit log: the
+// member's email, or "team".
+func describeOwner(reservation *models.SubdomainReservation) string {
+	if reservation.TeamUser == nil {
+		return ownerTeam
+	}
+	return reservation.TeamUser.User.Email
+}
+
 func (h *Handler) handleServiceError(c *fiber.Ctx, err error) error {
 	switch {
 	case errors.Is(err, services.ErrReservationExists):
 		return apiError(c, fiber.StatusConflict, "already_reserved", "You already reserved this subdomain")
 	case errors.Is(err, services.ErrReservationLimit):
-		return apiError(c, fiber.StatusConflict, "reservation_limit_reached", fmt.Sprintf("You can reserve up to %d subdomains", h.config.ReservedSubdomainLimit))
+		return apiError(c, fiber.StatusConflict, "reservation_limit_reached", fmt.Sprintf("You can reserve up to %d subdomains", h.config.ReservationLimit()))
 	case errors.Is(err, services.ErrSubdomainUnavailable):
 		return apiError(c, fiber.StatusConflict, "subdomain_unavailable", "This subdomain is unavailable")
 	case errors.Is(err, services.ErrReservationNotFound):
 		return apiError(c, fiber.StatusNotFound, "reservation_not_found", "Reserved subdomain not found")
 	case errors.Is(err, services.ErrReservationUnavailable):
 		return apiError(c, fiber.StatusServiceUnavailable, "reservation_busy", "Reservations are busy; try again")
+	case errors.Is(err, services.ErrNotTeamReservation):
+		return apiError(c, fiber.StatusConflict, "not_team_reservation", "Only team reservations have allowed members")
+	case errors.Is(err, services.ErrTeamUserNotFound):
+		return apiError(c, fiber.StatusBadRequest, "team_user_not_found", "Every member must belong to this team")
 	default:
 		return apiError(c, fiber.StatusInternalServerError, "reservation_failed", "Failed to update reserved subdomains")
 	}
 }
 
-func responseFor(reservation services.ReservedSubdomain) reservationResponse {
+func responseFor(reservation services.ReservedSubdomain, teamUser *models.TeamUser) reservationResponse {
+	owner := ownerMember
+	if reservation.Reservation.TeamOwned() {
+		owner = ownerTeam
+	}
+	allowedMembers := reservation.AllowedMembers
+	if allowedMembers == nil {
+		allowedMembers = []string{}
+	}
 	return reservationResponse{
-		Subdomain:   reservation.Reservation.Subdomain,
-		CreatedAt:   reservation.Reservation.CreatedAt.UTC().Format("2006-01-02T15:04:05Z"),
-		ClaimStatus: reservation.ClaimStatus,
+		Subdomain:      reservation.Reservation.Subdomain,
+		CreatedAt:      reservation.Reservation.CreatedAt.UTC().Format("2006-01-02T15:04:05Z"),
+		ClaimStatus:    reservation.ClaimStatus,
+		Owner:          owner,
+		AllowedMembers: allowedMembers,
+		CanRelease:     !reservation.Reservation.TeamOwned() || teamUser.CanManageTeam(),
 	}
 }
 
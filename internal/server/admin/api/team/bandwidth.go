@@ -0,0 +1,184 @@
+package team
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/api/audit"
+	"github.com/amalshaji/portr/internal/server/admin/middleware"
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+type BandwidthLimitsInput struct {
+	MonthlyBytes *int64 `json:"monthly_bytes"`
+	RateBytes    *int64 `json:"rate_bytes"`
+}
+
+type BandwidthAccountResponse struct {
+	MonthlyBytes int64 `json:"monthly_bytes"`
+	RateBytes    int64 `json:"rate_bytes"`
+	UsedBytes    int64 `json:"used_bytes"`
+}
+
+type BandwidthUserResponse struct {
+	TeamUserID uint   `json:"team_user_id"`
+	Email      string `json:"email"`
+	BandwidthAccountResponse
+}
+
+type BandwidthResponse struct {
+	Period   string                   `json:"period"`
+	ResetsAt string                   `json:"resets_at"`
+	Team     BandwidthAccountResponse `json:"team"`
+	Users    []BandwidthUserResponse  `json:"users"`
+}
+
+func (h *Handler) GetBandwidth(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Team context required",
+		})
+	}
+
+	status, err := services.NewBandwidthService(h.db).Status(c.UserContext(), teamUser.TeamID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load bandwidth usage",
+		})
+	}
+
+	return c.JSON(bandwidthResponseFor(status))
+}
+
+// UpdateBandwidth sets the limits of the whole team. Only superusers may,
+// since the limits share the server between teams.
+func (h *Handler) UpdateBandwidth(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Team context required",
+		})
+	}
+
+	if !teamUser.User.IsSuperuser {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Superuser access required",
+		})
+	}
+
+	limits, ok := parseBandwidthLimits(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	err := services.NewBandwidthService(h.db).SetTeamLimits(c.UserContext(), teamUser.TeamID, limits)
+	if err != nil {
+		return bandwidthError(c, err)
+	}
+	audit.Record(c, h.db, teamAuditLog(teamUser, models.AuditActionTeamBandwidth, bandwidthDiff(teamUser.Team.BandwidthLimits, limits)))
+
+	return h.GetBandwidth(c)
+}
+
+// UpdateUserBandwidth sets the limits of one member's tunnels, within those
+// of the team.
+func (h *Handler) UpdateUserBandwidth(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Team context required",
+		})
+	}
+
+	teamUserID, paramErr := c.ParamsInt("id")
+	if paramErr != nil || teamUserID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid team user ID",
+		})
+	}
+
+	limits, ok := parseBandwidthLimits(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	var target models.TeamUser
+	if err := h.db.Preload("User").Where("id = ? AND team_id = ?", teamUserID, teamUser.TeamID).First(&target).Error; err != nil {
+		return bandwidthError(c, services.ErrTeamUserNotFound)
+	}
+
+	err := services.NewBandwidthService(h.db).SetUserLimits(c.UserContext(), teamUser.TeamID, uint(teamUserID), limits)
+	if err != nil {
+		return bandwidthError(c, err)
+	}
+	audit.Record(c, h.db, models.AuditLog{
+		Action:     models.AuditActionTeamUserBandwidth,
+		TargetType: models.AuditTargetTeamUser,
+		TargetID:   strconv.FormatUint(uint64(target.ID), 10),
+		Target:     target.User.Email,
+		Diff:       bandwidthDiff(target.BandwidthLimits, limits),
+	})
+
+	return h.GetBandwidth(c)
+}
+
+func bandwidthDiff(before, after models.BandwidthLimits) string {
+	return services.AuditDiff(
+		map[string]any{"monthly_bytes": before.MonthlyBytes, "rate_bytes": before.RateBytes},
+		map[string]any{"monthly_bytes": after.MonthlyBytes, "rate_bytes": after.RateBytes},
+	)
+}
+
+func parseBandwidthLimits(c *fiber.Ctx) (models.BandwidthLimits, bool) {
+	var input BandwidthLimitsInput
+	if err := c.BodyParser(&input); err != nil || input.MonthlyBytes == nil || input.RateBytes == nil {
+		return models.BandwidthLimits{}, false
+	}
+	return models.BandwidthLimits{MonthlyBytes: *input.MonthlyBytes, RateBytes: *input.RateBytes}, true
+}
+
+func bandwidthError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidBandwidthLimit):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Bandwidth limits cannot be negative"})
+	case errors.Is(err, services.ErrTeamUserNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found in team"})
+	case errors.Is(err, services.ErrTeamNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Team not found"})
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to save bandwidth limits"})
+	}
+}
+
+func bandwidthResponseFor(status *services.BandwidthStatus) BandwidthResponse {
+	response := BandwidthResponse{
+		Period:   status.Period,
+		ResetsAt: status.ResetsAt.Format(time.RFC3339),
+		Team:     bandwidthAccountResponseFor(status.Team),
+		Users:    make([]BandwidthUserResponse, 0, len(status.Users)),
+	}
+	for _, user := range status.Users {
+		response.Users = append(response.Users, BandwidthUserResponse{
+			TeamUserID:               user.TeamUserID,
+			Email:                    user.Email,
+			BandwidthAccountResponse: bandwidthAccountResponseFor(user.BandwidthAccount),
+		})
+	}
+	return response
+}
+
+func bandwidthAccountResponseFor(account services.BandwidthAccount) BandwidthAccountResponse {
+	return BandwidthAccountResponse{
+		MonthlyBytes: account.MonthlyBytes,
+		RateBytes:    account.RateBytes,
+		UsedBytes:    account.UsedBytes,
+	}
+}
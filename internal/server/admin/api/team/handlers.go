@@ -2,8 +2,10 @@ package team
 
 import (
 	"errors"
+	"strconv"
 	"strings"
 
+	"github.com/amalshaji/portr/internal/server/admin/api/audit"
 	"github.com/amalshaji/portr/internal/server/admin/middleware"
 	"github.com/amalshaji/portr/internal/server/admin/models"
 	"github.com/amalshaji/portr/internal/server/admin/services"
@@ -63,6 +65,9 @@ type UserResponse struct {
 	LastName    *string             `json:"last_name"`
 	IsSuperuser bool                `json:"is_superuser"`
 	GithubUser  *GithubUserResponse `json:"github_user,omitempty"`
+	// TwoFactorEnabled is whether the user has set up two-factor
+	// authentication.
+	TwoFactorEnabled bool `json:"two_factor_enabled"`
 }
 
 type GithubUserResponse struct {
@@ -204,6 +209,13 @@ func (h *Handler) CreateTeam(c *fiber.Ctx) error {
 	log.Info("CreateTeam: Transaction committed successfully",
 		"team_name", team.Name,
 		"team_id", team.ID)
+	audit.Record(c, h.db, models.AuditLog{
+		TeamID:     &team.ID,
+		Action:     models.AuditActionTeamCreated,
+		TargetType: models.AuditTargetTeam,
+		TargetID:   strconv.FormatUint(uint64(team.ID), 10),
+		Target:     team.Slug,
+	})
 
 	response := TeamResponse{
 		ID:   team.ID,
@@ -286,7 +298,7 @@ func (h *Handler) AddUser(c *fiber.Ctx) error {
 		TeamSlug:     actor.Team.Slug,
 		Role:         input.Role,
 		SetSuperuser: input.SetSuperuser,
-	})
+	}, "")
 }
 
 func (h *Handler) AddUserWithAPIKey(c *fiber.Ctx) error {
@@ -300,18 +312,36 @@ func (h *Handler) AddUserWithAPIKey(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
 	}
 
+	detail := "added with a secret key"
+	if middleware.GetCurrentAPIToken(c) != nil {
+		detail = ""
+	}
 	return h.inviteUser(c, actor.ID, services.InviteUserInput{
 		Email:    input.Email,
 		TeamSlug: input.TeamSlug,
 		Role:     input.Role,
-	})
+	}, detail)
 }
 
-func (h *Handler) inviteUser(c *fiber.Ctx, actorTeamUserID uint, input services.InviteUserInput) error {
+// inviteUser adds a user to a team. detail, if set, is recorded in the audit
+// log with the addition.
+func (h *Handler) inviteUser(c *fiber.Ctx, actorTeamUserID uint, input services.InviteUserInput, detail string) error {
 	result, err := h.teamUsers.Invite(c.UserContext(), actorTeamUserID, input)
 	if err != nil {
 		return inviteUserError(c, err)
 	}
+	audit.Record(c, h.db, models.AuditLog{
+		TeamID:     &result.TeamUser.TeamID,
+		Action:     models.AuditActionTeamUserAdded,
+		TargetType: models.AuditTargetTeamUser,
+		TargetID:   strconv.FormatUint(uint64(result.TeamUser.ID), 10),
+		Target:     result.TeamUser.User.Email,
+		Diff: services.AuditDiff(nil, map[string]any{
+			"role":         result.TeamUser.Role,
+			"is_superuser": result.TeamUser.User.IsSuperuser,
+		}),
+		Detail: detail,
+	})
 
 	teamUser := teamUserListResponseFor(result.TeamUser)
 	return c.JSON(AddUserResponse{
@@ -346,11 +376,12 @@ func inviteUserError(c *fiber.Ctx, err error) error {
 
 func teamUserListResponseFor(teamUser models.TeamUser) TeamUserListResponse {
 	user := UserResponse{
-		ID:          teamUser.User.ID,
-		Email:       teamUser.User.Email,
-		FirstName:   teamUser.User.FirstName,
-		LastName:    teamUser.User.LastName,
-		IsSuperuser: teamUser.User.IsSuperuser,
+		ID:               teamUser.User.ID,
+		Email:            teamUser.User.Email,
+		FirstName:        teamUser.User.FirstName,
+		LastName:         teamUser.User.LastName,
+		IsSuperuser:      teamUser.User.IsSuperuser,
+		TwoFactorEnabled: teamUser.User.TwoFactorEnabled(),
 	}
 	if teamUser.User.GithubUser != nil {
 		user.GithubUser = &GithubUserResponse{GithubAvatarURL: teamUser.User.GithubUser.GithubAvatarURL}
@@ -380,59 +411,34 @@ func (h *Handler) RemoveUser(c *fiber.Ctx) error {
 	}
 
 	teamUserID, paramErr := c.ParamsInt("id")
-	if paramErr != nil || teamUserID == 0 {
+	if paramErr != nil || teamUserID <= 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid team user ID",
 		})
 	}
 
-	// Find team user to delete
-	var teamUserToDelete models.TeamUser
-	err := h.db.Preload("User").Where("id = ? AND team_id = ?", teamUserID, teamUser.TeamID).First(&teamUserToDelete).Error
-	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "User not found in team",
-		})
-	}
-
-	// Check if trying to remove superuser (only superuser can do this)
-	if teamUserToDelete.User.IsSuperuser && !teamUser.User.IsSuperuser {
+	removed, err := h.teamUsers.Remove(c.UserContext(), teamUser, uint(teamUserID))
+	if errors.Is(err, services.ErrSuperuserAccessRequired) {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
 			"error": "Only superuser can remove superuser from team",
 		})
 	}
-
-	// Start transaction
-	tx := h.db.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
-	// Delete team user
-	if err := tx.Delete(&teamUserToDelete).Error; err != nil {
-		tx.Rollback()
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to remove user from team",
-		})
+	if err != nil {
+		return membershipError(c, err)
 	}
 
-	// Check if user has any other team memberships
-	var otherTeamCount int64
-	tx.Model(&models.TeamUser{}).Where("user_id = ?", teamUserToDelete.UserID).Count(&otherTeamCount)
-
-	// If user has no other teams, delete the user entirely
-	if otherTeamCount == 0 {
-		if err := tx.Delete(&teamUserToDelete.User).Error; err != nil {
-			tx.Rollback()
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"error": "Failed to delete user",
-			})
-		}
+	detail := ""
+	if removed.UserDeleted {
+		detail = "user deleted, as they were in no other team"
 	}
-
-	tx.Commit()
+	audit.Record(c, h.db, models.AuditLog{
+		Action:     models.AuditActionTeamUserRemoved,
+		TargetType: models.AuditTargetTeamUser,
+		TargetID:   strconv.FormatUint(uint64(removed.TeamUser.ID), 10),
+		Target:     removed.TeamUser.User.Email,
+		Diff:       services.AuditDiff(map[string]any{"role": removed.TeamUser.Role}, nil),
+		Detail:     detail,
+	})
 
 	return c.JSON(fiber.Map{"status": "ok"})
 }
@@ -499,8 +505,26 @@ func (h *Handler) ResetUserPassword(c *fiber.Ctx) error {
 	}
 
 	tx.Commit()
+	audit.Record(c, h.db, models.AuditLog{
+		Action:     models.AuditActionPasswordReset,
+		TargetType: models.AuditTargetUser,
+		TargetID:   strconv.FormatUint(uint64(targetTeamUser.User.ID), 10),
+		Target:     targetTeamUser.User.Email,
+	})
 
 	return c.JSON(ResetPasswordResponse{
 		Password: newPassword,
 	})
 }
+
+// teamAuditLog is the audit log entry of a change to the current team's
+// settings.
+func teamAuditLog(teamUser *models.TeamUser, action, diff string) models.AuditLog {
+	return models.AuditLog{
+		Action:     action,
+		TargetType: models.AuditTargetTeam,
+		TargetID:   strconv.FormatUint(uint64(teamUser.TeamID), 10),
+		Target:     teamUser.Team.Slug,
+		Diff:       diff,
+	}
+}
@@ -0,0 +1,201 @@
+package team
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/amalshaji/portr/internal/server/admin/api/audit"
+	"github.com/amalshaji/portr/internal/server/admin/middleware"
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+type UpdateTeamInput struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+type ChangeRoleInput struct {
+	Role string `json:"role"`
+}
+
+type TransferAdminInput struct {
+	TeamUserID uint `json:"team_user_id"`
+}
+
+// UpdateTeam renames the current team and optionally changes its slug.
+func (h *Handler) UpdateTeam(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Team context required",
+		})
+	}
+
+	var input UpdateTeamInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+	before, after, err := services.NewTeamService(h.db).Update(c.UserContext(), teamUser.TeamID, services.UpdateTeamInput{
+		Name: input.Name,
+		Slug: input.Slug,
+	})
+	if err != nil {
+		return membershipError(c, err)
+	}
+	if diff := services.AuditDiff(
+		map[string]any{"name": before.Name, "slug": before.Slug},
+		map[string]any{"name": after.Name, "slug": after.Slug},
+	); diff != "" {
+		entry := teamAuditLog(teamUser, models.AuditActionTeamUpdated, diff)
+		entry.Target = after.Slug
+		audit.Record(c, h.db, entry)
+	}
+
+	return c.JSON(TeamResponse{ID: after.ID, Name: after.Name, Slug: after.Slug})
+}
+
+// DeleteTeam deletes a team with its members' tunnels, reservations and keys.
+// Only superusers may.
+func (h *Handler) DeleteTeam(c *fiber.Ctx) error {
+	teamID, paramErr := c.ParamsInt("id")
+	if paramErr != nil || teamID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid team ID"})
+	}
+
+	deleted, err := services.NewTeamService(h.db).Delete(c.UserContext(), uint(teamID))
+	if err != nil {
+		return membershipError(c, err)
+	}
+	audit.Record(c, h.db, models.AuditLog{
+		TeamID:     &deleted.Team.ID,
+		Action:     models.AuditActionTeamDeleted,
+		TargetType: models.AuditTargetTeam,
+		TargetID:   strconv.FormatUint(uint64(deleted.Team.ID), 10),
+		Target:     deleted.Team.Slug,
+		Detail:     fmt.Sprintf("%d members removed, %d users deleted", deleted.Members, deleted.DeletedUsers),
+	})
+
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// ChangeUserRole makes a member of the current team an admin or a member.
+func (h *Handler) ChangeUserRole(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Team context required",
+		})
+	}
+
+	teamUserID, paramErr := c.ParamsInt("id")
+	if paramErr != nil || teamUserID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid team user ID"})
+	}
+	var input ChangeRoleInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	before, err := h.teamUsers.ChangeRole(c.UserContext(), teamUser, uint(teamUserID), input.Role)
+	if err != nil {
+		return membershipError(c, err)
+	}
+	if before.Role != input.Role {
+		audit.Record(c, h.db, models.AuditLog{
+			Action:     models.AuditActionTeamUserRoleChanged,
+			TargetType: models.AuditTargetTeamUser,
+			TargetID:   strconv.FormatUint(uint64(before.ID), 10),
+			Target:     before.User.Email,
+			Diff:       services.AuditDiff(map[string]any{"role": before.Role}, map[string]any{"role": input.Role}),
+		})
+	}
+
+	before.Role = input.Role
+	return c.JSON(teamUserListResponseFor(*before))
+}
+
+// TransferAdmin hands the acting admin's role to another member of the
+// team, leaving the acting admin a member.
+func (h *Handler) TransferAdmin(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Team context required",
+		})
+	}
+
+	var input TransferAdminInput
+	if err := c.BodyParser(&input); err != nil || input.TeamUserID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
+	}
+
+	target, err := h.teamUsers.TransferAdmin(c.UserContext(), teamUser, input.TeamUserID)
+	if err != nil {
+		return membershipError(c, err)
+	}
+	audit.Record(c, h.db, models.AuditLog{
+		Action:     models.AuditActionAdminTransferred,
+		TargetType: models.AuditTargetTeamUser,
+		TargetID:   strconv.FormatUint(uint64(target.ID), 10),
+		Target:     target.User.Email,
+		Diff:       services.AuditDiff(map[string]any{"role": target.Role}, map[string]any{"role": models.RoleAdmin}),
+		Detail:     fmt.Sprintf("%s is now a member", teamUser.User.Email),
+	})
+
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// LeaveTeam removes the current user from the current team.
+func (h *Handler) LeaveTeam(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Team context required",
+		})
+	}
+
+	if err := h.teamUsers.Leave(c.UserContext(), teamUser); err != nil {
+		return membershipError(c, err)
+	}
+	audit.Record(c, h.db, models.AuditLog{
+		Action:     models.AuditActionTeamUserLeft,
+		TargetType: models.AuditTargetTeamUser,
+		TargetID:   strconv.FormatUint(uint64(teamUser.ID), 10),
+		Target:     teamUser.User.Email,
+		Diff:       services.AuditDiff(map[string]any{"role": teamUser.Role}, nil),
+	})
+
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+func membershipError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrTeamNameRequired):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Team name is required"})
+	case errors.Is(err, services.ErrInvalidTeamSlug):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Slug may only contain lowercase letters, digits and hyphens"})
+	case errors.Is(err, services.ErrInvalidRole):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Role must be either 'admin' or 'member'"})
+	case errors.Is(err, services.ErrTransferToSelf):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Choose another member to transfer admin to"})
+	case errors.Is(err, services.ErrTeamNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Team not found"})
+	case errors.Is(err, services.ErrTeamUserNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found in team"})
+	case errors.Is(err, services.ErrSuperuserAccessRequired):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only superuser can change a superuser's membership"})
+	case errors.Is(err, services.ErrDefaultTeamProtected):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "The default team cannot be deleted or have its slug changed"})
+	case errors.Is(err, services.ErrTeamExists):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "A team with this name or slug already exists"})
+	case errors.Is(err, services.ErrLastTeamAdmin):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "The team must keep at least one admin"})
+	case errors.Is(err, services.ErrOnlyTeam):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "You cannot leave your only team"})
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update team membership"})
+	}
+}
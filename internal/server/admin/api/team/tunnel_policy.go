@@ -0,0 +1,75 @@
+package team
+
+import (
+	"errors"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/api/audit"
+	"github.com/amalshaji/portr/internal/server/admin/middleware"
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+type TunnelPolicyInput struct {
+	MaxLifetimeSeconds *int64 `json:"max_lifetime_seconds"`
+}
+
+func (h *Handler) GetTunnelPolicy(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Team context required",
+		})
+	}
+
+	return c.JSON(fiber.Map{"max_lifetime_seconds": teamUser.Team.MaxTunnelLifetime})
+}
+
+// UpdateTunnelPolicy caps how long the team's tunnels may stay open. Only
+// superusers may, like the team's bandwidth limits.
+func (h *Handler) UpdateTunnelPolicy(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Team context required",
+		})
+	}
+
+	if !teamUser.User.IsSuperuser {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Superuser access required",
+		})
+	}
+
+	var input TunnelPolicyInput
+	if err := c.BodyParser(&input); err != nil || input.MaxLifetimeSeconds == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	lifetime := time.Duration(*input.MaxLifetimeSeconds) * time.Second
+	err := services.NewTunnelPolicyService(h.db).SetMaxLifetime(c.UserContext(), teamUser.TeamID, lifetime)
+	switch {
+	case errors.Is(err, services.ErrInvalidTunnelLifetime):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Tunnel lifetime cannot be negative",
+		})
+	case errors.Is(err, services.ErrTeamNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Team not found",
+		})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save tunnel policy",
+		})
+	}
+
+	audit.Record(c, h.db, teamAuditLog(teamUser, models.AuditActionTunnelPolicy, services.AuditDiff(
+		map[string]any{"max_lifetime_seconds": teamUser.Team.MaxTunnelLifetime},
+		map[string]any{"max_lifetime_seconds": *input.MaxLifetimeSeconds},
+	)))
+
+	return c.JSON(fiber.Map{"max_lifetime_seconds": *input.MaxLifetimeSeconds})
+}
@@ -0,0 +1,107 @@
+package team
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/amalshaji/portr/internal/server/admin/api/audit"
+	"github.com/amalshaji/portr/internal/server/admin/middleware"
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+type TwoFactorPolicyInput struct {
+	Required *bool `json:"required"`
+}
+
+func (h *Handler) GetTwoFactorPolicy(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Team context required",
+		})
+	}
+
+	return c.JSON(fiber.Map{"required": teamUser.Team.RequireTwoFactor})
+}
+
+// UpdateTwoFactorPolicy makes two-factor authentication required, or not,
+// for the team's members. Only superusers may, and only once they have it
+// on themselves, so they are not locked out of the team.
+func (h *Handler) UpdateTwoFactorPolicy(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Team context required",
+		})
+	}
+
+	if !teamUser.User.IsSuperuser {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Superuser access required",
+		})
+	}
+
+	var input TwoFactorPolicyInput
+	if err := c.BodyParser(&input); err != nil || input.Required == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+	if *input.Required && !teamUser.User.TwoFactorEnabled() {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Turn on two-factor authentication for your own account first",
+		})
+	}
+
+	err := services.NewTwoFactorService(h.db).SetTeamRequirement(c.UserContext(), teamUser.TeamID, *input.Required)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save two-factor policy",
+		})
+	}
+	audit.Record(c, h.db, teamAuditLog(teamUser, models.AuditActionTwoFactorPolicy, services.AuditDiff(
+		map[string]any{"required": teamUser.Team.RequireTwoFactor},
+		map[string]any{"required": *input.Required},
+	)))
+
+	return c.JSON(fiber.Map{"required": *input.Required})
+}
+
+// ResetUserTwoFactor turns off two-factor authentication for a member who
+// lost their authenticator, so they can sign in with their password and set
+// it up again.
+func (h *Handler) ResetUserTwoFactor(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Team context required",
+		})
+	}
+
+	teamUserID, paramErr := c.ParamsInt("id")
+	if paramErr != nil || teamUserID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid team user ID"})
+	}
+
+	target, err := services.NewTwoFactorService(h.db).Reset(c.UserContext(), teamUser, uint(teamUserID))
+	switch {
+	case errors.Is(err, services.ErrTeamUserNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found in team"})
+	case errors.Is(err, services.ErrSuperuserAccessRequired):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only superuser can reset a superuser's two-factor authentication"})
+	case errors.Is(err, services.ErrTwoFactorNotEnabled):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "User has not turned on two-factor authentication"})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to reset two-factor authentication"})
+	}
+	audit.Record(c, h.db, models.AuditLog{
+		Action:     models.AuditActionTwoFactorReset,
+		TargetType: models.AuditTargetTeamUser,
+		TargetID:   strconv.FormatUint(uint64(target.ID), 10),
+		Target:     target.User.Email,
+	})
+
+	return c.JSON(fiber.Map{"status": "ok"})
+}
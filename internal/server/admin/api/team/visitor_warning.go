@@ -0,0 +1,53 @@
+package team
+
+import (
+	"github.com/amalshaji/portr/internal/server/admin/api/audit"
+	"github.com/amalshaji/portr/internal/server/admin/middleware"
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+type VisitorWarningInput struct {
+	Enabled *bool `json:"enabled"`
+}
+
+func (h *Handler) GetVisitorWarning(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Team context required",
+		})
+	}
+
+	return c.JSON(fiber.Map{"enabled": teamUser.Team.VisitorWarning})
+}
+
+func (h *Handler) UpdateVisitorWarning(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Team context required",
+		})
+	}
+
+	var input VisitorWarningInput
+	if err := c.BodyParser(&input); err != nil || input.Enabled == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+
+	err := services.NewVisitorWarningService(h.db).SetEnabled(c.UserContext(), teamUser.TeamID, *input.Enabled)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to save visitor warning",
+		})
+	}
+	audit.Record(c, h.db, teamAuditLog(teamUser, models.AuditActionVisitorWarning, services.AuditDiff(
+		map[string]any{"enabled": teamUser.Team.VisitorWarning},
+		map[string]any{"enabled": *input.Enabled},
+	)))
+
+	return c.JSON(fiber.Map{"enabled": *input.Enabled})
+}
@@ -0,0 +1,134 @@
+package tunnelcredential
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/api/audit"
+	"github.com/amalshaji/portr/internal/server/admin/middleware"
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	serverConfig "github.com/amalshaji/portr/internal/server/config"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// defaultMaxLifetime is how long a credential lasts when the request does
+// not say.
+const defaultMaxLifetime = time.Hour
+
+type Handler struct {
+	db      *gorm.DB
+	config  *serverConfig.AdminConfig
+	service *services.TunnelCredentialService
+}
+
+type mintInput struct {
+	Name             string `json:"name"`
+	ConnectionType   string `json:"connection_type"`
+	SubdomainPattern string `json:"subdomain_pattern"`
+	// MaxLifetime is how many seconds the credential, and every tunnel it
+	// opens, may last.
+	MaxLifetime int64 `json:"max_lifetime"`
+}
+
+type tunnelCredentialResponse struct {
+	ID               uint   `json:"id"`
+	Name             string `json:"name"`
+	Prefix           string `json:"prefix"`
+	ConnectionType   string `json:"connection_type"`
+	SubdomainPattern string `json:"subdomain_pattern,omitempty"`
+	CreatedAt        string `json:"created_at"`
+	ExpiresAt        string `json:"expires_at"`
+	Credential       string `json:"credential"`
+	SetupCommand     string `json:"setup_command"`
+}
+
+func NewHandler(db *gorm.DB, config *serverConfig.AdminConfig) *Handler {
+	return &Handler{db: db, config: config, service: services.NewTunnelCredentialService(db)}
+}
+
+// Mint issues a short-lived credential that opens tunnels as the caller,
+// within the connection type, subdomain pattern and lifetime requested.
+func (h *Handler) Mint(c *fiber.Ctx) error {
+	teamUser := middleware.GetCurrentTeamUser(c)
+	if teamUser == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Team context required"})
+	}
+
+	var input mintInput
+	if err := c.BodyParser(&input); err != nil {
+		return apiError(c, fiber.StatusBadRequest, "invalid_input", "Invalid input")
+	}
+	maxLifetime := defaultMaxLifetime
+	if input.MaxLifetime != 0 {
+		maxLifetime = time.Duration(input.MaxLifetime) * time.Second
+	}
+	var apiTokenID *uint
+	if token := middleware.GetCurrentAPIToken(c); token != nil {
+		apiTokenID = &token.ID
+	}
+
+	credential, secret, err := h.service.Mint(c.UserContext(), teamUser.ID, services.MintTunnelCredentialInput{
+		Name:             input.Name,
+		ConnectionType:   input.ConnectionType,
+		SubdomainPattern: input.SubdomainPattern,
+		MaxLifetime:      maxLifetime,
+		APITokenID:       apiTokenID,
+	})
+	if err != nil {
+		return handleServiceError(c, err)
+	}
+	audit.Record(c, h.db, auditLogFor(credential, maxLifetime))
+
+	serverURL, _ := h.config.ClientURLs()
+	return c.Status(fiber.StatusCreated).JSON(tunnelCredentialResponse{
+		ID:               credential.ID,
+		Name:             credential.Name,
+		Prefix:           credential.Prefix,
+		ConnectionType:   credential.ConnectionType,
+		SubdomainPattern: credential.SubdomainPattern,
+		CreatedAt:        formatTime(credential.CreatedAt),
+		ExpiresAt:        formatTime(credential.ExpiresAt),
+		Credential:       secret,
+		SetupCommand:     fmt.Sprintf("portr auth set --token %s --remote %s", secret, serverURL),
+	})
+}
+
+func handleServiceError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidCredentialType):
+		return apiError(c, fiber.StatusBadRequest, "invalid_connection_type", "connection_type must be either 'http' or 'tcp'")
+	case errors.Is(err, services.ErrInvalidSubdomainPattern):
+		return apiError(c, fiber.StatusBadRequest, "invalid_subdomain_pattern", "subdomain_pattern must be a subdomain, with * for any characters")
+	case errors.Is(err, services.ErrInvalidCredentialLifetime):
+		return apiError(c, fiber.StatusBadRequest, "invalid_max_lifetime", fmt.Sprintf("max_lifetime must be between %d and %d seconds",
+			int(services.MinTunnelCredentialLifetime.Seconds()), int(services.MaxTunnelCredentialLifetime.Seconds())))
+	default:
+		return apiError(c, fiber.StatusInternalServerError, "tunnel_credential_failed", "Failed to create tunnel credential")
+	}
+}
+
+func auditLogFor(credential *models.TunnelCredential, maxLifetime time.Duration) models.AuditLog {
+	detail := credential.ConnectionType
+	if credential.SubdomainPattern != "" {
+		detail += " " + credential.SubdomainPattern
+	}
+	return models.AuditLog{
+		Action:     models.AuditActionTunnelCredential,
+		TargetType: models.AuditTargetCredential,
+		TargetID:   strconv.FormatUint(uint64(credential.ID), 10),
+		Target:     credential.Name,
+		Detail:     detail + ", for " + maxLifetime.String(),
+	}
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+func apiError(c *fiber.Ctx, status int, code, message string) error {
+	return c.Status(status).JSON(fiber.Map{"code": code, "message": message})
+}
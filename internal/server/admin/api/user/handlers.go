@@ -1,10 +1,14 @@
 package user
 
 import (
+	"strconv"
 	"strings"
 
+	"github.com/amalshaji/portr/internal/server/admin/api/audit"
 	"github.com/amalshaji/portr/internal/server/admin/middleware"
 	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"github.com/charmbracelet/log"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/session"
 	"gorm.io/gorm"
@@ -38,6 +42,10 @@ type TeamUserResponse struct {
 	Role      string       `json:"role"`
 	SecretKey string       `json:"secret_key"`
 	CreatedAt string       `json:"created_at"`
+	// FailedLogins is the number of failed sign-ins to the user's account
+	// before this session started. It is returned once, for the dashboard to
+	// warn the user.
+	FailedLogins int `json:"failed_logins,omitempty"`
 }
 
 type UserResponse struct {
@@ -47,6 +55,9 @@ type UserResponse struct {
 	LastName    *string             `json:"last_name"`
 	IsSuperuser bool                `json:"is_superuser"`
 	GithubUser  *GithubUserResponse `json:"github_user,omitempty"`
+	// TwoFactorEnabled is whether the user must give a TOTP or recovery
+	// code when signing in with a password.
+	TwoFactorEnabled bool `json:"two_factor_enabled"`
 }
 
 type GithubUserResponse struct {
@@ -54,9 +65,10 @@ type GithubUserResponse struct {
 }
 
 type TeamResponse struct {
-	ID   uint   `json:"id"`
-	Name string `json:"name"`
-	Slug string `json:"slug"`
+	ID               uint   `json:"id"`
+	Name             string `json:"name"`
+	Slug             string `json:"slug"`
+	RequireTwoFactor bool   `json:"require_two_factor"`
 }
 
 // GetCurrentUser returns current user info with team context
@@ -77,11 +89,12 @@ func (h *Handler) GetCurrentUser(c *fiber.Ctx) error {
 
 	// Build user response with optional GitHub data
 	userResponse := UserResponse{
-		ID:          teamUser.User.ID,
-		Email:       teamUser.User.Email,
-		FirstName:   teamUser.User.FirstName,
-		LastName:    teamUser.User.LastName,
-		IsSuperuser: teamUser.User.IsSuperuser,
+		ID:               teamUser.User.ID,
+		Email:            teamUser.User.Email,
+		FirstName:        teamUser.User.FirstName,
+		LastName:         teamUser.User.LastName,
+		IsSuperuser:      teamUser.User.IsSuperuser,
+		TwoFactorEnabled: teamUser.User.TwoFactorEnabled(),
 	}
 
 	// Add GitHub user data if it exists
@@ -95,15 +108,25 @@ func (h *Handler) GetCurrentUser(c *fiber.Ctx) error {
 		ID:   teamUser.ID,
 		User: userResponse,
 		Team: TeamResponse{
-			ID:   teamUser.Team.ID,
-			Name: teamUser.Team.Name,
-			Slug: teamUser.Team.Slug,
+			ID:               teamUser.Team.ID,
+			Name:             teamUser.Team.Name,
+			Slug:             teamUser.Team.Slug,
+			RequireTwoFactor: teamUser.Team.RequireTwoFactor,
 		},
 		Role:      teamUser.Role,
 		SecretKey: teamUser.SecretKey,
 		CreatedAt: teamUser.CreatedAt.Format("2006-01-02T15:04:05Z"),
 	}
 
+	if session := middleware.GetCurrentSession(c); session != nil && session.FailedLogins > 0 {
+		failedLogins := session.FailedLogins
+		if err := h.db.Model(session).UpdateColumn("failed_logins", 0).Error; err != nil {
+			log.Error("Failed to clear failed sign-in notice", "error", err)
+		} else {
+			response.FailedLogins = failedLogins
+		}
+	}
+
 	return c.JSON(response)
 }
 
@@ -130,9 +153,10 @@ func (h *Handler) GetUserTeams(c *fiber.Ctx) error {
 	var response []TeamResponse
 	for _, team := range teams {
 		response = append(response, TeamResponse{
-			ID:   team.ID,
-			Name: team.Name,
-			Slug: team.Slug,
+			ID:               team.ID,
+			Name:             team.Name,
+			Slug:             team.Slug,
+			RequireTwoFactor: team.RequireTwoFactor,
 		})
 	}
 
@@ -155,6 +179,8 @@ func (h *Handler) UpdateUser(c *fiber.Ctx) error {
 		})
 	}
 
+	before := nameFields(user)
+
 	// Update user fields
 	if input.FirstName != nil {
 		user.FirstName = input.FirstName
@@ -171,13 +197,17 @@ func (h *Handler) UpdateUser(c *fiber.Ctx) error {
 			"error": "Failed to update user",
 		})
 	}
+	if diff := services.AuditDiff(before, nameFields(user)); diff != "" {
+		audit.Record(c, h.db, userAuditLog(user, models.AuditActionUserUpdated, diff))
+	}
 
 	response := UserResponse{
-		ID:          user.ID,
-		Email:       user.Email,
-		FirstName:   user.FirstName,
-		LastName:    user.LastName,
-		IsSuperuser: user.IsSuperuser,
+		ID:               user.ID,
+		Email:            user.Email,
+		FirstName:        user.FirstName,
+		LastName:         user.LastName,
+		IsSuperuser:      user.IsSuperuser,
+		TwoFactorEnabled: user.TwoFactorEnabled(),
 	}
 
 	return c.JSON(response)
@@ -217,13 +247,15 @@ func (h *Handler) ChangePassword(c *fiber.Ctx) error {
 			"error": "Failed to update password",
 		})
 	}
+	audit.Record(c, h.db, userAuditLog(user, models.AuditActionPasswordChanged, ""))
 
 	response := UserResponse{
-		ID:          user.ID,
-		Email:       user.Email,
-		FirstName:   user.FirstName,
-		LastName:    user.LastName,
-		IsSuperuser: user.IsSuperuser,
+		ID:               user.ID,
+		Email:            user.Email,
+		FirstName:        user.FirstName,
+		LastName:         user.LastName,
+		IsSuperuser:      user.IsSuperuser,
+		TwoFactorEnabled: user.TwoFactorEnabled(),
 	}
 
 	return c.JSON(response)
@@ -246,8 +278,36 @@ func (h *Handler) RotateSecretKey(c *fiber.Ctx) error {
 			"error": "Failed to rotate secret key",
 		})
 	}
+	audit.Record(c, h.db, models.AuditLog{
+		Action:     models.AuditActionSecretKeyRotated,
+		TargetType: models.AuditTargetTeamUser,
+		TargetID:   strconv.FormatUint(uint64(teamUser.ID), 10),
+		Target:     teamUser.User.Email,
+	})
 
 	return c.JSON(fiber.Map{
 		"secret_key": teamUser.SecretKey,
 	})
 }
+
+// userAuditLog is the audit log entry of a change to the current user.
+func userAuditLog(user *models.User, action, diff string) models.AuditLog {
+	return models.AuditLog{
+		Action:     action,
+		TargetType: models.AuditTargetUser,
+		TargetID:   strconv.FormatUint(uint64(user.ID), 10),
+		Target:     user.Email,
+		Diff:       diff,
+	}
+}
+
+func nameFields(user *models.User) map[string]any {
+	fields := map[string]any{"first_name": "", "last_name": ""}
+	if user.FirstName != nil {
+		fields["first_name"] = *user.FirstName
+	}
+	if user.LastName != nil {
+		fields["last_name"] = *user.LastName
+	}
+	return fields
+}
@@ -0,0 +1,143 @@
+package user
+
+import (
+	"errors"
+
+	"github.com/amalshaji/portr/internal/server/admin/api/audit"
+	"github.com/amalshaji/portr/internal/server/admin/middleware"
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"github.com/gofiber/fiber/v2"
+)
+
+// twoFactorIssuer names the server in authenticator apps.
+const twoFactorIssuer = "Portr"
+
+type TwoFactorCodeInput struct {
+	Code string `json:"code"`
+}
+
+// GetTwoFactor returns whether the current user has two-factor
+// authentication on.
+func (h *Handler) GetTwoFactor(c *fiber.Ctx) error {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	status, err := services.NewTwoFactorService(h.db).Status(c.UserContext(), user)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load two-factor authentication",
+		})
+	}
+	return c.JSON(status)
+}
+
+// SetupTwoFactor starts enrollment, returning the secret to add to an
+// authenticator app.
+func (h *Handler) SetupTwoFactor(c *fiber.Ctx) error {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	enrollment, err := services.NewTwoFactorService(h.db).BeginEnrollment(c.UserContext(), user, twoFactorIssuer)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+	return c.JSON(enrollment)
+}
+
+// EnableTwoFactor finishes enrollment with a code from the authenticator app
+// and returns the user's recovery codes.
+func (h *Handler) EnableTwoFactor(c *fiber.Ctx) error {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var input TwoFactorCodeInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+	codes, err := services.NewTwoFactorService(h.db).Enable(c.UserContext(), user, input.Code)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+	audit.Record(c, h.db, userAuditLog(user, models.AuditActionTwoFactorEnabled, ""))
+
+	return c.JSON(fiber.Map{"recovery_codes": codes})
+}
+
+// RegenerateRecoveryCodes replaces the current user's recovery codes.
+func (h *Handler) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var input TwoFactorCodeInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+	codes, err := services.NewTwoFactorService(h.db).RegenerateRecoveryCodes(c.UserContext(), user, input.Code)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+	audit.Record(c, h.db, userAuditLog(user, models.AuditActionRecoveryCodesRenewed, ""))
+
+	return c.JSON(fiber.Map{"recovery_codes": codes})
+}
+
+// DisableTwoFactor turns off the current user's two-factor authentication.
+func (h *Handler) DisableTwoFactor(c *fiber.Ctx) error {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var input TwoFactorCodeInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid input",
+		})
+	}
+	if err := services.NewTwoFactorService(h.db).Disable(c.UserContext(), user, input.Code); err != nil {
+		return twoFactorError(c, err)
+	}
+	audit.Record(c, h.db, userAuditLog(user, models.AuditActionTwoFactorDisabled, ""))
+
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+func twoFactorError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidTwoFactorCode):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Code is incorrect"})
+	case errors.Is(err, services.ErrTwoFactorNotStarted):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Start two-factor setup first"})
+	case errors.Is(err, services.ErrTwoFactorAlreadyEnabled):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Two-factor authentication is already on"})
+	case errors.Is(err, services.ErrTwoFactorNotEnabled):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Two-factor authentication is not on"})
+	case errors.Is(err, services.ErrTwoFactorRequiredByTeam):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "One of your teams requires two-factor authentication"})
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update two-factor authentication"})
+	}
+}
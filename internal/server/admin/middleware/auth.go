@@ -1,48 +1,123 @@
 package middleware
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"github.com/amalshaji/portr/internal/server/config"
+	"github.com/charmbracelet/log"
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 )
 
 type AuthMiddleware struct {
-	db *gorm.DB
+	db       *gorm.DB
+	config   *config.AdminConfig
+	throttle *LoginThrottle
 }
 
-func NewAuthMiddleware(db *gorm.DB) *AuthMiddleware {
+func NewAuthMiddleware(db *gorm.DB, cfg *config.AdminConfig) *AuthMiddleware {
 	return &AuthMiddleware{
-		db: db,
+		db:       db,
+		config:   cfg,
+		throttle: NewLoginThrottle(),
 	}
 }
 
+// Throttle returns the limiter of sign-ins and secret key lookups, which the
+// login and connection handlers share with the middleware.
+func (m *AuthMiddleware) Throttle() *LoginThrottle {
+	return m.throttle
+}
+
+// apiTokenScopeKey holds the scope an API token needs to authenticate the
+// current route.
+const apiTokenScopeKey = "api_token_scope"
+
+var errAPITokenScope = errors.New("api token lacks the route's scope")
+
+var errTwoFactorRequired = errors.New("team requires two-factor authentication")
+
+// twoFactorOptionalKey marks routes that members of a team requiring
+// two-factor authentication may use before they have set it up.
+const twoFactorOptionalKey = "two_factor_optional"
+
 func (m *AuthMiddleware) RequireAuth(c *fiber.Ctx) error {
 	if err := m.checkAuth(c); err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		return authError(c, err)
+	}
+	return c.Next()
+}
+
+// AllowAPIToken lets API tokens with scope authenticate the handlers after it
+// in place of a dashboard session. Routes without it do not accept tokens.
+func (m *AuthMiddleware) AllowAPIToken(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals(apiTokenScopeKey, scope)
+		return c.Next()
 	}
+}
+
+// AllowWithoutTwoFactor lets members who have not set up two-factor
+// authentication use the handlers after it in a team that requires it, so
+// the dashboard can load enough to let them set it up.
+func (m *AuthMiddleware) AllowWithoutTwoFactor(c *fiber.Ctx) error {
+	c.Locals(twoFactorOptionalKey, true)
 	return c.Next()
 }
 
+// RequireAPIAuth accepts an API token, on routes that allow them, as a
+// bearer token, or a tunnel secret key while PORTR_ADMIN_SECRET_KEY_AUTH is
+// on. Device keys only open tunnels, so they are not accepted here.
 func (m *AuthMiddleware) RequireAPIAuth(c *fiber.Ctx) error {
 	authorization := strings.Fields(c.Get("Authorization"))
 	if len(authorization) != 2 || !strings.EqualFold(authorization[0], "Bearer") || authorization[1] == "" {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
 	}
+	if strings.HasPrefix(authorization[1], models.APITokenPrefix) {
+		if err := m.checkAPIToken(c, authorization[1]); err != nil {
+			return authError(c, err)
+		}
+		return c.Next()
+	}
+	if !m.config.SecretKeyAuthEnabled() {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
 
+	if wait := m.throttle.SecretKeyWait(c.IP()); wait > 0 {
+		return TooManyAttempts(c, wait, "error")
+	}
 	var teamUser models.TeamUser
 	if err := m.db.Preload("User").Preload("Team").Where("secret_key = ?", authorization[1]).First(&teamUser).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			RecordSecretKeyFailure(c, m.db, m.throttle)
+		}
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
 	}
+	if lacksRequiredTwoFactor(c, &teamUser) {
+		return twoFactorRequiredError(c)
+	}
+	log.Warn("Secret key used as a bearer token; this is deprecated, use an API token instead", "path", c.Path(), "team_user_id", teamUser.ID)
 
 	c.Locals("user", &teamUser.User)
 	c.Locals("team_user", &teamUser)
 	return c.Next()
 }
 
+// RequireTeamUserOrAPIAuth accepts a dashboard session with a team slug or
+// an API token as RequireTeamUser does, or a secret key as RequireAPIAuth
+// does.
+func (m *AuthMiddleware) RequireTeamUserOrAPIAuth(c *fiber.Ctx) error {
+	if _, ok := bearerAPIToken(c); !ok && c.Get("Authorization") != "" {
+		return m.RequireAPIAuth(c)
+	}
+	return m.RequireTeamUser(c)
+}
+
 func (m *AuthMiddleware) RequireAuthRedirect(c *fiber.Ctx) error {
 	err := m.checkAuth(c)
 	if err != nil {
@@ -75,6 +150,10 @@ func (m *AuthMiddleware) RequireAuthRedirect(c *fiber.Ctx) error {
 }
 
 func (m *AuthMiddleware) checkAuth(c *fiber.Ctx) error {
+	if secret, ok := bearerAPIToken(c); ok {
+		return m.checkAPIToken(c, secret)
+	}
+
 	token := c.Cookies("portr_session")
 	if token == "" {
 		return fmt.Errorf("no session token provided")
@@ -86,13 +165,81 @@ func (m *AuthMiddleware) checkAuth(c *fiber.Ctx) error {
 	}
 
 	c.Locals("user", &session.User)
+	c.Locals("session", &session)
+	return nil
+}
+
+// checkAPIToken authenticates the request as the owner of an API token, if
+// the route allows tokens with one of its scopes.
+func (m *AuthMiddleware) checkAPIToken(c *fiber.Ctx, secret string) error {
+	scope, _ := c.Locals(apiTokenScopeKey).(string)
+	if scope == "" {
+		return fmt.Errorf("route does not accept api tokens")
+	}
+	token, err := services.NewAPITokenService(m.db).Authenticate(c.UserContext(), secret)
+	if err != nil {
+		return err
+	}
+	if !token.HasScope(scope) {
+		return errAPITokenScope
+	}
+	if lacksRequiredTwoFactor(c, &token.TeamUser) {
+		return errTwoFactorRequired
+	}
+
+	c.Locals("user", &token.TeamUser.User)
+	c.Locals("team_user", &token.TeamUser)
+	c.Locals("api_token", token)
 	return nil
 }
 
+// bearerAPIToken returns the API token in the Authorization header, if any.
+func bearerAPIToken(c *fiber.Ctx) (string, bool) {
+	authorization := strings.Fields(c.Get("Authorization"))
+	if len(authorization) != 2 || !strings.EqualFold(authorization[0], "Bearer") {
+		return "", false
+	}
+	return authorization[1], strings.HasPrefix(authorization[1], models.APITokenPrefix)
+}
+
+func authError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, errTwoFactorRequired) {
+		return twoFactorRequiredError(c)
+	}
+	if errors.Is(err, errAPITokenScope) {
+		scope, _ := c.Locals(apiTokenScopeKey).(string)
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "API token lacks the " + scope + " scope",
+		})
+	}
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+}
+
+// requireTokenTeam finishes authorizing a request made with an API token.
+// Tokens belong to one team user, so they need no team slug; a slug that is
+// sent must be that team's.
+func requireTokenTeam(c *fiber.Ctx, requireAdmin bool) error {
+	teamUser := GetCurrentTeamUser(c)
+	if slug := c.Get("X-Team-Slug"); slug != "" && slug != teamUser.Team.Slug {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Access denied",
+		})
+	}
+	if requireAdmin && !teamUser.IsAdmin() && !teamUser.User.IsSuperuser {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Admin access required",
+		})
+	}
+	return c.Next()
+}
+
 func (m *AuthMiddleware) RequireTeamUser(c *fiber.Ctx) error {
 	// First check if user is authenticated
 	if err := m.checkAuth(c); err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		return authError(c, err)
+	}
+	if GetCurrentAPIToken(c) != nil {
+		return requireTokenTeam(c, false)
 	}
 
 	user, ok := c.Locals("user").(*models.User)
@@ -122,6 +269,9 @@ func (m *AuthMiddleware) RequireTeamUser(c *fiber.Ctx) error {
 			"error": "Access denied",
 		})
 	}
+	if lacksRequiredTwoFactor(c, &teamUser) {
+		return twoFactorRequiredError(c)
+	}
 
 	// Store team user in context
 	c.Locals("team_user", &teamUser)
@@ -131,7 +281,10 @@ func (m *AuthMiddleware) RequireTeamUser(c *fiber.Ctx) error {
 func (m *AuthMiddleware) RequireAdmin(c *fiber.Ctx) error {
 	// First check authentication
 	if err := m.checkAuth(c); err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		return authError(c, err)
+	}
+	if GetCurrentAPIToken(c) != nil {
+		return requireTokenTeam(c, true)
 	}
 
 	user, ok := c.Locals("user").(*models.User)
@@ -161,6 +314,10 @@ func (m *AuthMiddleware) RequireAdmin(c *fiber.Ctx) error {
 		})
 	}
 
+	if lacksRequiredTwoFactor(c, &teamUser) {
+		return twoFactorRequiredError(c)
+	}
+
 	// Check admin permissions
 	if !teamUser.IsAdmin() && !user.IsSuperuser {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
@@ -176,7 +333,7 @@ func (m *AuthMiddleware) RequireAdmin(c *fiber.Ctx) error {
 func (m *AuthMiddleware) RequireSuperuser(c *fiber.Ctx) error {
 	// First check if user is authenticated
 	if err := m.checkAuth(c); err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+		return authError(c, err)
 	}
 
 	user, ok := c.Locals("user").(*models.User)
@@ -195,6 +352,21 @@ func (m *AuthMiddleware) RequireSuperuser(c *fiber.Ctx) error {
 	return c.Next()
 }
 
+// lacksRequiredTwoFactor reports whether the team requires two-factor
+// authentication that the member has not set up. Tokens and secret keys are
+// checked too, since they may predate the requirement.
+func lacksRequiredTwoFactor(c *fiber.Ctx, teamUser *models.TeamUser) bool {
+	optional, _ := c.Locals(twoFactorOptionalKey).(bool)
+	return teamUser.Team.RequireTwoFactor && !teamUser.User.TwoFactorEnabled() && !optional
+}
+
+func twoFactorRequiredError(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"error": "This team requires two-factor authentication. Set it up in your account settings.",
+		"code":  "two_factor_required",
+	})
+}
+
 func GetCurrentUser(c *fiber.Ctx) *models.User {
 	user, ok := c.Locals("user").(*models.User)
 	if !ok {
@@ -210,3 +382,23 @@ func GetCurrentTeamUser(c *fiber.Ctx) *models.TeamUser {
 	}
 	return teamUser
 }
+
+// GetCurrentAPIToken returns the API token the request authenticated with, or
+// nil for a session or secret key.
+func GetCurrentAPIToken(c *fiber.Ctx) *models.APIToken {
+	token, ok := c.Locals("api_token").(*models.APIToken)
+	if !ok {
+		return nil
+	}
+	return token
+}
+
+// GetCurrentSession returns the dashboard session the request authenticated
+// with, or nil for an API token or secret key.
+func GetCurrentSession(c *fiber.Ctx) *models.Session {
+	session, ok := c.Locals("session").(*models.Session)
+	if !ok {
+		return nil
+	}
+	return session
+}
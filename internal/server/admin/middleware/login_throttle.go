@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"github.com/amalshaji/portr/internal/server/throttle"
+	"github.com/charmbracelet/log"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// maxThrottledKeys bounds the accounts and addresses each limiter tracks.
+const maxThrottledKeys = 10000
+
+var (
+	// accountPolicy locks out an account after 5 wrong passwords or codes,
+	// for 30s, doubling to 15m.
+	accountPolicy = throttle.Policy{
+		Free:       5,
+		Backoff:    30 * time.Second,
+		MaxBackoff: 15 * time.Minute,
+		Forget:     time.Hour,
+	}
+	// addressPolicy allows more failures per client IP than per account, as
+	// a whole office may share one.
+	addressPolicy = throttle.Policy{
+		Free:       20,
+		Backoff:    30 * time.Second,
+		MaxBackoff: 15 * time.Minute,
+		Forget:     time.Hour,
+	}
+)
+
+// LoginThrottle slows down guessing of passwords, two-factor codes and tunnel
+// secret keys, per account and per client IP. Failures are counted in memory,
+// so a restart forgets them.
+//
+// A nil LoginThrottle throttles nothing.
+type LoginThrottle struct {
+	accounts   *throttle.Limiter
+	addresses  *throttle.Limiter
+	secretKeys *throttle.Limiter
+}
+
+func NewLoginThrottle() *LoginThrottle {
+	return &LoginThrottle{
+		accounts:   throttle.New(accountPolicy, maxThrottledKeys),
+		addresses:  throttle.New(addressPolicy, maxThrottledKeys),
+		secretKeys: throttle.New(addressPolicy, maxThrottledKeys),
+	}
+}
+
+// LoginWait returns how long sign-ins to email from ip are locked out.
+func (t *LoginThrottle) LoginWait(ip, email string) time.Duration {
+	if t == nil {
+		return 0
+	}
+	return max(t.accounts.Wait(models.NormalizeEmail(email)), t.addresses.Wait(ip))
+}
+
+// LoginFailed records a wrong password or code for email from ip, and returns
+// the lockout it started, if any.
+func (t *LoginThrottle) LoginFailed(ip, email string) time.Duration {
+	if t == nil {
+		return 0
+	}
+	return max(t.accounts.Fail(models.NormalizeEmail(email)), t.addresses.Fail(ip))
+}
+
+// LoginSucceeded clears email's failures. The IP's stay, so an attacker who
+// knows one password cannot use it to keep guessing others.
+func (t *LoginThrottle) LoginSucceeded(email string) {
+	if t == nil {
+		return
+	}
+	t.accounts.Reset(models.NormalizeEmail(email))
+}
+
+// SecretKeyWait returns how long secret key lookups from ip are locked out.
+func (t *LoginThrottle) SecretKeyWait(ip string) time.Duration {
+	if t == nil {
+		return 0
+	}
+	return t.secretKeys.Wait(ip)
+}
+
+// SecretKeyFailed records an unknown secret key from ip.
+func (t *LoginThrottle) SecretKeyFailed(ip string) time.Duration {
+	if t == nil {
+		return 0
+	}
+	return t.secretKeys.Fail(ip)
+}
+
+// TooManyAttempts answers a locked out request with 429 and a Retry-After
+// header, putting the message under key, as the caller's clients expect.
+func TooManyAttempts(c *fiber.Ctx, wait time.Duration, key string) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		key: fmt.Sprintf("Too many failed attempts. Try again in %s.", FormatWait(wait)),
+	})
+}
+
+// FormatWait rounds a lockout up to whole seconds or minutes for people.
+func FormatWait(wait time.Duration) string {
+	if wait <= time.Minute {
+		seconds := int(math.Ceil(wait.Seconds()))
+		if seconds == 1 {
+			return "1 second"
+		}
+		return fmt.Sprintf("%d seconds", seconds)
+	}
+	minutes := int(math.Ceil(wait.Minutes()))
+	return fmt.Sprintf("%d minutes", minutes)
+}
+
+// RecordSecretKeyFailure counts an unknown secret key from the client, and
+// records the lockout it starts, if any, in the audit log.
+func RecordSecretKeyFailure(c *fiber.Ctx, db *gorm.DB, t *LoginThrottle) {
+	lockout := t.SecretKeyFailed(c.IP())
+	if lockout == 0 {
+		return
+	}
+	entry := models.AuditLog{
+		Action: models.AuditActionLoginLocked,
+		IP:     c.IP(),
+		Detail: "secret keys locked out for " + FormatWait(lockout),
+	}
+	if err := services.NewAuditLogService(db).Record(c.UserContext(), entry); err != nil {
+		log.Error("Failed to record audit log entry", "action", entry.Action, "error", err)
+	}
+}
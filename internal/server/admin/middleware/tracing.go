@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/amalshaji/portr/internal/tracing"
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing starts a span for each API request, named after its route, and
+// hands it to handlers through c.UserContext.
+func Tracing(c *fiber.Ctx) error {
+	header := make(http.Header)
+	for _, field := range tracing.Propagator.Fields() {
+		if value := c.Get(field); value != "" {
+			header.Set(field, value)
+		}
+	}
+	ctx, span := tracing.Tracer().Start(tracing.Extract(c.UserContext(), header), c.Method(),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", c.Method()),
+			attribute.String("url.path", c.Path()),
+		),
+	)
+	defer span.End()
+	c.SetUserContext(ctx)
+
+	err := c.Next()
+	route := c.Route().Path
+	span.SetName(c.Method() + " " + route)
+	span.SetAttributes(attribute.String("http.route", route))
+	status := c.Response().StatusCode()
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		status = fiberErr.Code
+	} else if err != nil {
+		span.RecordError(err)
+		status = fiber.StatusInternalServerError
+	}
+	tracing.SetHTTPStatus(span, status)
+	return err
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// AccessLog is a request the proxy served from a tunnel. CreatedAt is when
+// the request arrived.
+type AccessLog struct {
+	ID           uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	ConnectionID string    `gorm:"not null;index:idx_access_log_connection" json:"connection_id"`
+	TeamID       uint      `gorm:"not null;index:idx_access_log_request_id" json:"team_id"`
+	RequestID    string    `gorm:"not null;default:'';index:idx_access_log_request_id" json:"request_id"`
+	Subdomain    string    `gorm:"not null" json:"subdomain"`
+	Owner        string    `gorm:"not null" json:"owner"`
+	Method       string    `gorm:"not null" json:"method"`
+	Path         string    `gorm:"not null" json:"path"`
+	Status       int       `gorm:"not null" json:"status"`
+	LatencyMs    int64     `gorm:"not null" json:"latency_ms"`
+	BytesIn      int64     `gorm:"not null" json:"bytes_in"`
+	BytesOut     int64     `gorm:"not null" json:"bytes_out"`
+	VisitorIP    string    `gorm:"not null" json:"visitor_ip"`
+	CreatedAt    time.Time `gorm:"not null;index:idx_access_log_connection;index" json:"created_at"`
+}
+
+func (AccessLog) TableName() string {
+	return "access_log"
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strings"
+	"time"
+)
+
+// APITokenPrefix starts every API token, telling them apart from tunnel
+// secret keys in an Authorization header.
+const APITokenPrefix = "portr_pat_"
+
+// API token scopes. Each admin API route that accepts tokens names the scope
+// it needs; the rest accept only dashboard sessions.
+const (
+	APITokenScopeConnectionsRead    = "connections:read"
+	APITokenScopeUsersManage        = "users:manage"
+	APITokenScopeReservationsManage = "reservations:manage"
+	APITokenScopeTemplatesManage    = "templates:manage"
+	APITokenScopeTunnelCredentials  = "tunnel_credentials:create"
+)
+
+var APITokenScopes = []string{
+	APITokenScopeConnectionsRead,
+	APITokenScopeUsersManage,
+	APITokenScopeReservationsManage,
+	APITokenScopeTemplatesManage,
+	APITokenScopeTunnelCredentials,
+}
+
+func IsValidAPITokenScope(scope string) bool {
+	return slices.Contains(APITokenScopes, scope)
+}
+
+// APIToken is a named token a team user created to call the admin API as
+// themselves, limited to its scopes. Only the token's SHA-256 hash is stored.
+type APIToken struct {
+	ID         uint     `gorm:"primaryKey;autoIncrement" json:"id"`
+	TeamUserID uint     `gorm:"not null;index" json:"team_user_id"`
+	TeamUser   TeamUser `json:"-"`
+	Name       string   `gorm:"not null" json:"name"`
+	// Prefix is the start of the token, shown so users can tell tokens apart.
+	Prefix    string `gorm:"not null" json:"prefix"`
+	TokenHash string `gorm:"not null;uniqueIndex" json:"-"`
+	// Scopes is the space-separated list of the token's scopes.
+	Scopes     string     `gorm:"not null" json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (APIToken) TableName() string {
+	return "api_token"
+}
+
+func (t *APIToken) ScopeList() []string {
+	return strings.Fields(t.Scopes)
+}
+
+func (t *APIToken) HasScope(scope string) bool {
+	return slices.Contains(t.ScopeList(), scope)
+}
+
+// Usable reports whether the token is neither revoked nor expired at now.
+func (t *APIToken) Usable(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+}
+
+func GenerateAPIToken() string {
+	bytes := make([]byte, 24)
+	if _, err := rand.Read(bytes); err != nil {
+		panic(err)
+	}
+	return APITokenPrefix + hex.EncodeToString(bytes)
+}
+
+// HashAPIToken returns the hash an API token is stored and looked up by.
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
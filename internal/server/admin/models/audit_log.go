@@ -0,0 +1,91 @@
+package models
+
+import "time"
+
+// Audit log actions.
+const (
+	AuditActionLogin                 = "auth.login"
+	AuditActionLoginFailed           = "auth.login_failed"
+	AuditActionLogout                = "auth.logout"
+	AuditActionLoginLocked           = "auth.login_locked"
+	AuditActionSignup                = "auth.signup"
+	AuditActionTeamCreated           = "team.created"
+	AuditActionTeamUpdated           = "team.updated"
+	AuditActionTeamDeleted           = "team.deleted"
+	AuditActionAdminTransferred      = "team.admin_transferred"
+	AuditActionTeamUserAdded         = "team_user.added"
+	AuditActionTeamUserRemoved       = "team_user.removed"
+	AuditActionTeamUserRoleChanged   = "team_user.role_changed"
+	AuditActionTeamUserLeft          = "team_user.left"
+	AuditActionPasswordReset         = "user.password_reset"
+	AuditActionPasswordChanged       = "user.password_changed"
+	AuditActionUserUpdated           = "user.updated"
+	AuditActionTwoFactorEnabled      = "user.two_factor_enabled"
+	AuditActionTwoFactorDisabled     = "user.two_factor_disabled"
+	AuditActionRecoveryCodesRenewed  = "user.recovery_codes_regenerated"
+	AuditActionTwoFactorReset        = "team_user.two_factor_reset"
+	AuditActionSecretKeyRotated      = "team_user.secret_key_rotated"
+	AuditActionTeamUserBandwidth     = "team_user.bandwidth_updated"
+	AuditActionVisitorWarning        = "team.visitor_warning_updated"
+	AuditActionTeamBandwidth         = "team.bandwidth_updated"
+	AuditActionTunnelPolicy          = "team.tunnel_policy_updated"
+	AuditActionTwoFactorPolicy       = "team.two_factor_policy_updated"
+	AuditActionClientTemplateUpdated = "team.client_template_updated"
+	AuditActionAutoSignupUpdated     = "auto_signup.updated"
+	AuditActionConfigReloaded        = "config.reloaded"
+	AuditActionConnectionClosed      = "connection.force_closed"
+	AuditActionAPITokenCreated       = "api_token.created"
+	AuditActionAPITokenRevoked       = "api_token.revoked"
+	AuditActionDeviceKeyCreated      = "device_key.created"
+	AuditActionDeviceKeyRevoked      = "device_key.revoked"
+	AuditActionTunnelCredential      = "tunnel_credential.created"
+	AuditActionReservationMoved      = "reservation.transferred"
+	AuditActionReservationMembers    = "reservation.members_updated"
+)
+
+// Audit log target types.
+const (
+	AuditTargetUser       = "user"
+	AuditTargetTeam       = "team"
+	AuditTargetTeamUser   = "team_user"
+	AuditTargetConnection = "connection"
+	AuditTargetServer     = "server"
+	AuditTargetAPIToken   = "api_token"
+	AuditTargetDeviceKey  = "device_key"
+	AuditTargetCredential = "tunnel_credential"
+	AuditTargetSubdomain  = "reserved_subdomain"
+)
+
+// AuditLog records an administrative or security-relevant action. Rows are
+// never updated or deleted; the migrations reject both.
+//
+// TeamID is nil for actions outside any team, such as logins and auto-signup
+// settings. ActorID is nil when nobody is signed in, as on a failed login,
+// and ActorEmail keeps the actor's email after the user is deleted.
+type AuditLog struct {
+	ID         uint64 `gorm:"primaryKey;autoIncrement" json:"id"`
+	TeamID     *uint  `gorm:"index:idx_audit_log_team" json:"team_id"`
+	ActorID    *uint  `json:"actor_id"`
+	ActorEmail string `gorm:"not null;default:''" json:"actor_email"`
+	Action     string `gorm:"not null;index" json:"action"`
+	TargetType string `gorm:"not null;default:''" json:"target_type"`
+	TargetID   string `gorm:"not null;default:''" json:"target_id"`
+	// Target names the target for people, such as an email or team slug.
+	Target string `gorm:"not null;default:''" json:"target"`
+	IP     string `gorm:"not null;default:''" json:"ip"`
+	// Diff is the JSON object of changed fields, each {"from": ..., "to": ...}.
+	Diff string `gorm:"type:text;not null;default:''" json:"diff"`
+	// Detail says more about the action, such as why a login failed.
+	Detail    string    `gorm:"not null;default:''" json:"detail"`
+	CreatedAt time.Time `gorm:"not null;index:idx_audit_log_team;index" json:"created_at"`
+}
+
+func (AuditLog) TableName() string {
+	return "audit_log"
+}
+
+// AuditChange is the before and after value of a changed field.
+type AuditChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// BandwidthLimits caps the traffic of tunnels, counting both directions.
+// Zero means unlimited.
+type BandwidthLimits struct {
+	// MonthlyBytes is the traffic allowed per calendar month (UTC).
+	MonthlyBytes int64 `gorm:"column:bandwidth_monthly_bytes;not null;default:0" json:"bandwidth_monthly_bytes"`
+	// RateBytes is the throughput allowed per second.
+	RateBytes int64 `gorm:"column:bandwidth_rate_bytes;not null;default:0" json:"bandwidth_rate_bytes"`
+}
+
+// BandwidthUsage is the traffic of a team user's tunnels in a month.
+type BandwidthUsage struct {
+	ID         uint64 `gorm:"primaryKey;autoIncrement" json:"id"`
+	TeamID     uint   `gorm:"not null;index:idx_bandwidth_usage_team_period" json:"team_id"`
+	TeamUserID uint   `gorm:"not null;uniqueIndex:idx_bandwidth_usage_team_user_period" json:"team_user_id"`
+	// Period is the month the traffic was counted in, as YYYY-MM.
+	Period    string    `gorm:"not null;uniqueIndex:idx_bandwidth_usage_team_user_period;index:idx_bandwidth_usage_team_period" json:"period"`
+	Bytes     int64     `gorm:"not null;default:0" json:"bytes"`
+	UpdatedAt time.Time `gorm:"not null" json:"updated_at"`
+}
+
+func (BandwidthUsage) TableName() string {
+	return "bandwidth_usage"
+}
+
+// BandwidthPeriod names the month t falls in, in UTC.
+func BandwidthPeriod(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// BandwidthResetsAt is the start of the month after t, in UTC, when monthly
+// quotas reset.
+func BandwidthResetsAt(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
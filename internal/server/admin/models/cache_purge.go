@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// CachePurge asks every tunnel server to drop its cached responses for a
+// subdomain. Tunnel servers apply purges by polling for new rows.
+type CachePurge struct {
+	ID        uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	TeamID    uint      `gorm:"not null" json:"team_id"`
+	Subdomain string    `gorm:"not null" json:"subdomain"`
+	CreatedAt time.Time `gorm:"not null;index" json:"created_at"`
+}
+
+func (CachePurge) TableName() string {
+	return "cache_purge"
+}
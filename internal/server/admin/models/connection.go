@@ -18,10 +18,21 @@ type Connection struct {
 	CreatedAt   time.Time  `json:"created_at"`
 	StartedAt   *time.Time `json:"started_at"`
 	ClosedAt    *time.Time `json:"closed_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	CloseReason *string    `json:"close_reason"`
 	CreatedByID uint       `json:"created_by_id"`
 	CreatedBy   TeamUser   `json:"created_by,omitempty"`
 	TeamID      uint       `json:"team_id"`
 	Team        Team       `json:"team,omitempty"`
+
+	// DeviceKeyID is the device key that opened the connection, or nil when
+	// it was opened with the team user's secret key or an SSH key.
+	DeviceKeyID *uint      `json:"device_key_id"`
+	DeviceKey   *DeviceKey `json:"device_key,omitempty"`
+	// TunnelCredentialID is the ephemeral tunnel credential that opened the
+	// connection, kept after the credential is deleted.
+	TunnelCredentialID *uint             `json:"tunnel_credential_id"`
+	TunnelCredential   *TunnelCredential `json:"tunnel_credential,omitempty"`
 }
 
 func (Connection) TableName() string {
@@ -41,6 +52,30 @@ const (
 	ConnectionStatusClosed   = "closed"
 )
 
+// Connection close reasons
+const (
+	ConnectionCloseReasonDisconnected  = "disconnected"
+	ConnectionCloseReasonServerRestart = "server_restart"
+	ConnectionCloseReasonIdle          = "idle_timeout"
+	ConnectionCloseReasonMaxLifetime   = "max_lifetime"
+	ConnectionCloseReasonExpired       = "expired"
+	ConnectionCloseReasonForceClosed   = "force_closed"
+	ConnectionCloseReasonMemberRemoved = "member_removed"
+	ConnectionCloseReasonKeyRevoked    = "key_revoked"
+)
+
+// ClosedPermanently reports whether a connection closed for reason must not
+// be opened again: it was closed by a tunnel policy, force-closed, its owner
+// is no longer a member of the team or its device key was revoked.
+func ClosedPermanently(reason string) bool {
+	switch reason {
+	case ConnectionCloseReasonIdle, ConnectionCloseReasonMaxLifetime, ConnectionCloseReasonExpired,
+		ConnectionCloseReasonForceClosed, ConnectionCloseReasonMemberRemoved, ConnectionCloseReasonKeyRevoked:
+		return true
+	}
+	return false
+}
+
 // GenerateConnectionID generates a new ULID for connection
 func GenerateConnectionID() string {
 	t := time.Now()
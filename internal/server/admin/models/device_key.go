@@ -0,0 +1,53 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// DeviceKeyPrefix starts every device key, telling them apart from a team
+// user's secret key wherever either is accepted.
+const DeviceKeyPrefix = "portr_dk_"
+
+// DeviceKey is a named key that opens tunnels as its team user, in place of
+// their secret key, until it expires or is revoked. Only its SHA-256 hash is
+// stored.
+type DeviceKey struct {
+	ID         uint     `gorm:"primaryKey;autoIncrement" json:"id"`
+	TeamUserID uint     `gorm:"not null;index" json:"team_user_id"`
+	TeamUser   TeamUser `json:"-"`
+	Name       string   `gorm:"not null" json:"name"`
+	// Prefix is the start of the key, shown so users can tell keys apart.
+	Prefix     string     `gorm:"not null" json:"prefix"`
+	KeyHash    string     `gorm:"not null;uniqueIndex" json:"-"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP *string    `json:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (DeviceKey) TableName() string {
+	return "device_key"
+}
+
+// Usable reports whether the key is neither revoked nor expired at now.
+func (k *DeviceKey) Usable(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+func GenerateDeviceKey() string {
+	bytes := make([]byte, 24)
+	if _, err := rand.Read(bytes); err != nil {
+		panic(err)
+	}
+	return DeviceKeyPrefix + hex.EncodeToString(bytes)
+}
+
+// HashDeviceKey returns the hash a device key is stored and looked up by.
+func HashDeviceKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// Error page kinds, named after the X-Portr-Error-Reason of the response they
+// replace.
+const (
+	ErrorPageUnregisteredSubdomain = "unregistered-subdomain"
+	ErrorPageConnectionLost        = "connection-lost"
+	ErrorPageLocalServerNotOnline  = "local-server-not-online"
+	ErrorPageBandwidthExceeded     = "bandwidth-exceeded"
+)
+
+func IsValidErrorPageKind(kind string) bool {
+	switch kind {
+	case ErrorPageUnregisteredSubdomain, ErrorPageConnectionLost, ErrorPageLocalServerNotOnline, ErrorPageBandwidthExceeded:
+		return true
+	}
+	return false
+}
+
+// ErrorPage is an HTML template a team serves to visitors instead of portr's
+// built-in error page. Pages with a ReservationID override the team's page
+// for that reserved subdomain.
+type ErrorPage struct {
+	ID            uint                  `gorm:"primaryKey;autoIncrement" json:"id"`
+	TeamID        uint                  `gorm:"not null" json:"team_id"`
+	ReservationID *uint                 `gorm:"index" json:"reservation_id"`
+	Reservation   *SubdomainReservation `json:"-"`
+	Kind          string                `gorm:"not null" json:"kind"`
+	Body          string                `gorm:"type:text;not null" json:"body"`
+	CreatedAt     time.Time             `json:"created_at"`
+	UpdatedAt     time.Time             `json:"updated_at"`
+}
+
+func (ErrorPage) TableName() string {
+	return "error_page"
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// MirrorRule copies requests for a reserved subdomain to the tunnels of
+// another reserved subdomain of the same team. The counts are flushed
+// periodically by the tunnel server.
+type MirrorRule struct {
+	ID                  uint                 `gorm:"primaryKey;autoIncrement" json:"id"`
+	TeamID              uint                 `gorm:"not null;index" json:"team_id"`
+	SourceReservationID uint                 `gorm:"not null;uniqueIndex" json:"source_reservation_id"`
+	SourceReservation   SubdomainReservation `json:"-"`
+	TargetReservationID uint                 `gorm:"not null;index" json:"target_reservation_id"`
+	TargetReservation   SubdomainReservation `json:"-"`
+	MaxBodyBytes        int64                `gorm:"not null" json:"max_body_bytes"`
+	MirroredCount       int64                `gorm:"not null;default:0" json:"mirrored_count"`
+	FailedCount         int64                `gorm:"not null;default:0" json:"failed_count"`
+	CreatedAt           time.Time            `json:"created_at"`
+}
+
+func (MirrorRule) TableName() string {
+	return "mirror_rule"
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// RecoveryCodeCount is how many recovery codes a user gets when they turn on
+// two-factor authentication or regenerate their codes.
+const RecoveryCodeCount = 10
+
+// RecoveryCode is a single-use code that stands in for a TOTP code when a
+// user has lost their authenticator. Only the code's SHA-256 hash is stored.
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (RecoveryCode) TableName() string {
+	return "recovery_code"
+}
+
+// GenerateRecoveryCode returns a code of ten hex digits, grouped in two for
+// reading aloud or typing.
+func GenerateRecoveryCode() string {
+	bytes := make([]byte, 5)
+	if _, err := rand.Read(bytes); err != nil {
+		panic(err)
+	}
+	code := hex.EncodeToString(bytes)
+	return code[:5] + "-" + code[5:]
+}
+
+// HashRecoveryCode returns the hash a recovery code is stored and looked up
+// by. Case, spaces and dashes are ignored.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
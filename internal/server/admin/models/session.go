@@ -13,6 +13,10 @@ type Session struct {
 	User      User      `json:"user,omitempty"`
 	Token     string    `gorm:"uniqueIndex;not null" json:"token"`
 	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
+	// FailedLogins is the number of failed sign-ins to the user's account
+	// between their previous sign-in and this one, until the dashboard has
+	// shown it.
+	FailedLogins int `gorm:"not null;default:0" json:"-"`
 }
 
 func (Session) TableName() string {
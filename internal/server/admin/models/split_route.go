@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// SplitRoute serves a reserved subdomain from the tunnels of two others,
+// sending PrimaryWeight percent of visitors to the primary. Sticky routes
+// keep a visitor on the side they first got with a cookie.
+type SplitRoute struct {
+	ID                     uint                 `gorm:"primaryKey;autoIncrement" json:"id"`
+	TeamID                 uint                 `gorm:"not null;index" json:"team_id"`
+	ReservationID          uint                 `gorm:"not null;uniqueIndex" json:"reservation_id"`
+	Reservation            SubdomainReservation `json:"-"`
+	PrimaryReservationID   uint                 `gorm:"not null" json:"primary_reservation_id"`
+	PrimaryReservation     SubdomainReservation `json:"-"`
+	SecondaryReservationID uint                 `gorm:"not null" json:"secondary_reservation_id"`
+	SecondaryReservation   SubdomainReservation `json:"-"`
+	PrimaryWeight          int                  `gorm:"not null" json:"primary_weight"`
+	Sticky                 bool                 `gorm:"not null;default:false" json:"sticky"`
+	CreatedAt              time.Time            `json:"created_at"`
+	UpdatedAt              time.Time            `json:"updated_at"`
+}
+
+func (SplitRoute) TableName() string {
+	return "split_route"
+}
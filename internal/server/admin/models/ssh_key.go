@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// SshKey is a public key a team user registered to open tunnels with a stock
+// ssh client.
+type SshKey struct {
+	ID          uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	TeamUserID  uint       `gorm:"not null;index" json:"team_user_id"`
+	TeamUser    TeamUser   `json:"-"`
+	Name        string     `gorm:"not null" json:"name"`
+	PublicKey   string     `gorm:"not null" json:"public_key"`
+	Fingerprint string     `gorm:"not null;uniqueIndex" json:"fingerprint"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+}
+
+func (SshKey) TableName() string {
+	return "ssh_key"
+}
@@ -2,14 +2,60 @@ package models
 
 import "time"
 
+// SubdomainReservation holds a subdomain for a team. A reservation with a
+// TeamUserID belongs to that member and only they can claim it. One without
+// belongs to the team: those who manage the team and the members on its
+// allowed list may claim it.
 type SubdomainReservation struct {
-	ID         uint      `gorm:"primaryKey;autoIncrement" json:"id"`
-	Subdomain  string    `gorm:"not null" json:"subdomain"`
-	TeamUserID uint      `gorm:"not null;index" json:"team_user_id"`
-	TeamUser   TeamUser  `json:"-"`
-	CreatedAt  time.Time `json:"created_at"`
+	ID         uint                         `gorm:"primaryKey;autoIncrement" json:"id"`
+	Subdomain  string                       `gorm:"not null" json:"subdomain"`
+	TeamID     uint                         `gorm:"not null;index" json:"team_id"`
+	TeamUserID *uint                        `gorm:"index" json:"team_user_id"`
+	TeamUser   *TeamUser                    `json:"-"`
+	Members    []SubdomainReservationMember `gorm:"foreignKey:ReservationID" json:"-"`
+	CreatedAt  time.Time                    `json:"created_at"`
 }
 
 func (SubdomainReservation) TableName() string {
 	return "subdomain_reservation"
 }
+
+// TeamOwned reports whether the reservation belongs to its team rather than
+// to one member.
+func (r *SubdomainReservation) TeamOwned() bool {
+	return r.TeamUserID == nil
+}
+
+// AllowsClaim reports whether the team user may start tunnels on the
+// reserved subdomain. Members must be loaded for team reservations.
+func (r *SubdomainReservation) AllowsClaim(teamUser *TeamUser) bool {
+	if !r.TeamOwned() {
+		return *r.TeamUserID == teamUser.ID
+	}
+	if r.TeamID != teamUser.TeamID {
+		return false
+	}
+	if teamUser.CanManageTeam() {
+		return true
+	}
+	for _, member := range r.Members {
+		if member.TeamUserID == teamUser.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// SubdomainReservationMember allows a team user to claim a team
+// reservation.
+type SubdomainReservationMember struct {
+	ID            uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	ReservationID uint      `gorm:"not null;uniqueIndex:idx_subdomain_reservation_member_unique" json:"reservation_id"`
+	TeamUserID    uint      `gorm:"not null;uniqueIndex:idx_subdomain_reservation_member_unique;index" json:"team_user_id"`
+	TeamUser      TeamUser  `json:"-"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func (SubdomainReservationMember) TableName() string {
+	return "subdomain_reservation_member"
+}
@@ -19,6 +19,17 @@ type Team struct {
 	// ClientTemplate is the team-managed tunnels/groups fragment served to the
 	// cli. Served only by the config template endpoint, never in team payloads.
 	ClientTemplate string `gorm:"type:text;not null;default:''" json:"-"`
+	// VisitorWarning makes the proxy show first-time browser visitors of the
+	// team's tunnels an interstitial naming the tunnel's owner.
+	VisitorWarning bool `gorm:"not null;default:false" json:"visitor_warning"`
+	// BandwidthLimits cap the traffic of all the team's tunnels together.
+	BandwidthLimits
+	// MaxTunnelLifetime is how long, in seconds, a tunnel of the team may stay
+	// open. Zero leaves tunnels open until they disconnect.
+	MaxTunnelLifetime int64 `gorm:"column:max_tunnel_lifetime_seconds;not null;default:0" json:"max_tunnel_lifetime_seconds"`
+	// RequireTwoFactor keeps members without two-factor authentication out
+	// of the team's dashboard until they set it up.
+	RequireTwoFactor bool `gorm:"not null;default:false" json:"require_two_factor"`
 }
 
 func (Team) TableName() string {
@@ -32,6 +43,12 @@ func (t *Team) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// IsValidTeamSlug reports whether slug is already in the form team slugs are
+// generated in: lowercase letters, digits and single inner hyphens.
+func IsValidTeamSlug(slug string) bool {
+	return slug != "" && makeSlug(slug) == slug
+}
+
 func makeSlug(s string) string {
 	s = strings.ToLower(s)
 	s = strings.ReplaceAll(s, " ", "-")
@@ -56,6 +73,8 @@ type TeamUser struct {
 	Team      Team   `json:"team,omitempty"`
 	UserID    uint   `gorm:"uniqueIndex:idx_team_users_team_user_unique" json:"user_id"`
 	User      User   `json:"user,omitempty"`
+	// BandwidthLimits cap the traffic of the team user's own tunnels.
+	BandwidthLimits
 }
 
 func (TeamUser) TableName() string {
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"strings"
+	"time"
+)
+
+// TunnelCredentialPrefix starts every tunnel credential, telling them apart
+// from secret keys and device keys.
+const TunnelCredentialPrefix = "portr_tc_"
+
+// TunnelCredential is a short-lived key that opens tunnels as the team user
+// who minted it, but only of its connection type and on subdomains matching
+// its pattern. Only its SHA-256 hash is stored.
+type TunnelCredential struct {
+	ID         uint     `gorm:"primaryKey;autoIncrement" json:"id"`
+	TeamUserID uint     `gorm:"not null;index" json:"team_user_id"`
+	TeamUser   TeamUser `json:"-"`
+	// APITokenID is the API token the credential was minted with, if any.
+	// Revoking the token revokes the credential too, setting RevokedAt.
+	APITokenID       *uint      `json:"api_token_id"`
+	Name             string     `gorm:"not null" json:"name"`
+	Prefix           string     `gorm:"not null" json:"prefix"`
+	KeyHash          string     `gorm:"not null;uniqueIndex" json:"-"`
+	ConnectionType   string     `gorm:"not null" json:"connection_type"`
+	SubdomainPattern string     `gorm:"not null;default:''" json:"subdomain_pattern"`
+	ExpiresAt        time.Time  `gorm:"not null;index" json:"expires_at"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+	LastUsedAt       *time.Time `json:"last_used_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+func (TunnelCredential) TableName() string {
+	return "tunnel_credential"
+}
+
+// Usable reports whether the credential can still open tunnels at now.
+func (c *TunnelCredential) Usable(now time.Time) bool {
+	return c.RevokedAt == nil && now.Before(c.ExpiresAt)
+}
+
+// AllowsSubdomain reports whether the credential may open a tunnel on
+// subdomain. In the pattern, * stands for any run of characters.
+func (c *TunnelCredential) AllowsSubdomain(subdomain string) bool {
+	matched, err := path.Match(c.SubdomainPattern, strings.ToLower(subdomain))
+	return err == nil && matched
+}
+
+func GenerateTunnelCredential() string {
+	bytes := make([]byte, 24)
+	if _, err := rand.Read(bytes); err != nil {
+		panic(err)
+	}
+	return TunnelCredentialPrefix + hex.EncodeToString(bytes)
+}
+
+// HashTunnelCredential returns the hash a tunnel credential is stored and
+// looked up by.
+func HashTunnelCredential(credential string) string {
+	sum := sha256.Sum256([]byte(credential))
+	return hex.EncodeToString(sum[:])
+}
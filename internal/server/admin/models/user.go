@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"time"
 
 	"golang.org/x/crypto/argon2"
 	"gorm.io/gorm"
@@ -23,6 +24,16 @@ type User struct {
 	Teams       []Team      `gorm:"many2many:team_users;" json:"teams,omitempty"`
 	TeamUsers   []TeamUser  `json:"-"`
 	Sessions    []Session   `json:"-"`
+	// TOTPSecret is the base32 secret of the user's authenticator. It is set
+	// when enrollment starts and used for logins once TOTPEnabledAt is set.
+	TOTPSecret    *string    `gorm:"column:totp_secret" json:"-"`
+	TOTPEnabledAt *time.Time `gorm:"column:totp_enabled_at" json:"-"`
+	// TOTPLastStep is the time step of the last code accepted, so that a
+	// code cannot be used twice.
+	TOTPLastStep int64 `gorm:"column:totp_last_step;not null;default:0" json:"-"`
+	// FailedLoginCount is the number of wrong passwords and two-factor codes
+	// since the user last signed in, which they are told about when they do.
+	FailedLoginCount int `gorm:"not null;default:0" json:"-"`
 }
 
 func (User) TableName() string {
@@ -42,6 +53,12 @@ func (GithubUser) TableName() string {
 	return "githubuser"
 }
 
+// TwoFactorEnabled reports whether the user must give a TOTP or recovery
+// code after their password.
+func (u *User) TwoFactorEnabled() bool {
+	return u.TOTPEnabledAt != nil
+}
+
 func NormalizeEmail(email string) string {
 	return strings.ToLower(strings.TrimSpace(email))
 }
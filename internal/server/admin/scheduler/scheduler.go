@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
 	"github.com/charmbracelet/log"
 	"gorm.io/gorm"
 )
@@ -35,6 +36,16 @@ func New(db *gorm.DB) *Scheduler {
 				Interval: 10 * time.Second,
 				Function: (*Scheduler).clearUnclaimedConnections,
 			},
+			{
+				Name:     "Clear applied cache purges",
+				Interval: 1 * time.Hour,
+				Function: (*Scheduler).clearAppliedCachePurges,
+			},
+			{
+				Name:     "Clear expired tunnel credentials",
+				Interval: 1 * time.Minute,
+				Function: (*Scheduler).clearExpiredTunnelCredentials,
+			},
 		},
 	}
 }
@@ -108,3 +119,33 @@ func (s *Scheduler) clearUnclaimedConnections() error {
 
 	return nil
 }
+
+func (s *Scheduler) clearAppliedCachePurges() error {
+	// Tunnel servers poll for purges every few seconds, so a day old purge
+	// has been applied everywhere
+	cutoff := time.Now().Add(-24 * time.Hour)
+
+	deleted, err := services.NewCacheService(s.db).Prune(context.Background(), cutoff)
+	if err != nil {
+		return err
+	}
+
+	if deleted > 0 {
+		log.Info("Cleared applied cache purges", "count", deleted)
+	}
+
+	return nil
+}
+
+func (s *Scheduler) clearExpiredTunnelCredentials() error {
+	deleted, err := services.NewTunnelCredentialService(s.db).Prune(context.Background(), time.Now())
+	if err != nil {
+		return err
+	}
+
+	if deleted > 0 {
+		log.Info("Cleared expired tunnel credentials", "count", deleted)
+	}
+
+	return nil
+}
@@ -4,19 +4,30 @@ import (
 	"embed"
 	"fmt"
 	"html/template"
+	"net"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/amalshaji/portr/internal/server/admin/api/apitoken"
+	"github.com/amalshaji/portr/internal/server/admin/api/audit"
 	"github.com/amalshaji/portr/internal/server/admin/api/auth"
 	"github.com/amalshaji/portr/internal/server/admin/api/autosignup"
+	"github.com/amalshaji/portr/internal/server/admin/api/cache"
 	"github.com/amalshaji/portr/internal/server/admin/api/config"
 	"github.com/amalshaji/portr/internal/server/admin/api/connection"
+	"github.com/amalshaji/portr/internal/server/admin/api/devicekey"
+	"github.com/amalshaji/portr/internal/server/admin/api/errorpage"
+	"github.com/amalshaji/portr/internal/server/admin/api/mirror"
+	"github.com/amalshaji/portr/internal/server/admin/api/split"
+	"github.com/amalshaji/portr/internal/server/admin/api/sshkey"
 	"github.com/amalshaji/portr/internal/server/admin/api/subdomain"
 	"github.com/amalshaji/portr/internal/server/admin/api/team"
+	"github.com/amalshaji/portr/internal/server/admin/api/tunnelcredential"
 	"github.com/amalshaji/portr/internal/server/admin/api/user"
 	"github.com/amalshaji/portr/internal/server/admin/db"
 	"github.com/amalshaji/portr/internal/server/admin/middleware"
+	"github.com/amalshaji/portr/internal/server/admin/models"
 	"github.com/amalshaji/portr/internal/server/admin/scheduler"
 	"github.com/amalshaji/portr/internal/server/admin/utils"
 	serverConfig "github.com/amalshaji/portr/internal/server/config"
@@ -47,17 +58,26 @@ type Server struct {
 	store          *session.Store
 	startTime      time.Time
 	statsCollector *stats.StatsCollector
+	reloader       serverConfig.ReloadFunc
 }
 
 func NewServer(cfg *serverConfig.AdminConfig, database *gorm.DB) *Server {
 	engine := html.NewFileSystem(http.FS(templateFS), ".html")
 	engine.Reload(cfg.Debug)
 
-	app := fiber.New(fiber.Config{
+	appConfig := fiber.Config{
 		Views:             engine,
 		PassLocalsToViews: true,
 		ErrorHandler:      errorHandler,
-	})
+	}
+	if len(cfg.TrustedProxies) > 0 {
+		// Behind a reverse proxy every request comes from the proxy, which
+		// would make the login throttle lock out every client at once.
+		appConfig.EnableTrustedProxyCheck = true
+		appConfig.TrustedProxies = cfg.TrustedProxies
+		appConfig.ProxyHeader = fiber.HeaderXForwardedFor
+	}
+	app := fiber.New(appConfig)
 
 	app.Use(recover.New())
 	app.Use(logger.New(logger.Config{
@@ -78,7 +98,7 @@ func NewServer(cfg *serverConfig.AdminConfig, database *gorm.DB) *Server {
 		app:            app,
 		config:         cfg,
 		db:             db.New(database),
-		auth:           middleware.NewAuthMiddleware(database),
+		auth:           middleware.NewAuthMiddleware(database, cfg),
 		scheduler:      scheduler.New(database),
 		store:          store,
 		startTime:      time.Now(),
@@ -96,7 +116,7 @@ func NewServer(cfg *serverConfig.AdminConfig, database *gorm.DB) *Server {
 }
 
 func (s *Server) setupRoutes() {
-	api := s.app.Group("/api")
+	api := s.app.Group("/api", middleware.Tracing)
 	v1 := api.Group("/v1")
 
 	v1.Get("/healthcheck", func(c *fiber.Ctx) error {
@@ -115,8 +135,17 @@ func (s *Server) setupRoutes() {
 	s.setupTeamRoutes(v1)
 	s.setupConnectionRoutes(v1)
 	s.setupSubdomainRoutes(v1)
+	s.setupSshKeyRoutes(v1)
+	s.setupAPITokenRoutes(v1)
+	s.setupDeviceKeyRoutes(v1)
+	s.setupTunnelCredentialRoutes(v1)
+	s.setupErrorPageRoutes(v1)
+	s.setupMirrorRoutes(v1)
+	s.setupSplitRoutes(v1)
+	s.setupCacheRoutes(v1)
 	s.setupConfigRoutes(v1)
 	s.setupAutoSignupRoutes(v1)
+	s.setupAuditRoutes(v1)
 	s.setupAdminRoutes(v1)
 
 	s.app.Use("/static", filesystem.New(filesystem.Config{
@@ -135,26 +164,34 @@ func (s *Server) setupRoutes() {
 }
 
 func (s *Server) setupAuthRoutes(v1 fiber.Router) {
-	authHandler := auth.NewHandler(s.db.DB, s.store, s.config)
+	authHandler := auth.NewHandler(s.db.DB, s.store, s.config, s.auth.Throttle())
 	authGroup := v1.Group("/auth")
 
 	authGroup.Get("/auth-config", authHandler.GetAuthConfig)
 	authGroup.Post("/login", authHandler.Login)
+	authGroup.Post("/login/two-factor", authHandler.LoginTwoFactor)
 	authGroup.Post("/logout", s.auth.RequireAuth, authHandler.Logout)
 
 	authGroup.Get("/github", authHandler.GitHubLogin)
 	authGroup.Get("/github/callback", authHandler.GitHubCallback)
+	authGroup.Get("/oidc", authHandler.OIDCLogin)
+	authGroup.Get("/oidc/callback", authHandler.OIDCCallback)
 }
 
 func (s *Server) setupUserRoutes(v1 fiber.Router) {
 	userHandler := user.NewHandler(s.db.DB, s.store)
 	userGroup := v1.Group("/user")
 
-	userGroup.Get("/me", s.auth.RequireTeamUser, userHandler.GetCurrentUser)
+	userGroup.Get("/me", s.auth.AllowWithoutTwoFactor, s.auth.RequireTeamUser, userHandler.GetCurrentUser)
 	userGroup.Get("/me/teams", s.auth.RequireAuth, userHandler.GetUserTeams)
 	userGroup.Patch("/me/update", s.auth.RequireAuth, userHandler.UpdateUser)
 	userGroup.Patch("/me/change-password", s.auth.RequireAuth, userHandler.ChangePassword)
 	userGroup.Patch("/me/rotate-secret-key", s.auth.RequireTeamUser, userHandler.RotateSecretKey)
+	userGroup.Get("/me/two-factor", s.auth.RequireAuth, userHandler.GetTwoFactor)
+	userGroup.Post("/me/two-factor/setup", s.auth.RequireAuth, userHandler.SetupTwoFactor)
+	userGroup.Post("/me/two-factor/enable", s.auth.RequireAuth, userHandler.EnableTwoFactor)
+	userGroup.Post("/me/two-factor/recovery-codes", s.auth.RequireAuth, userHandler.RegenerateRecoveryCodes)
+	userGroup.Post("/me/two-factor/disable", s.auth.RequireAuth, userHandler.DisableTwoFactor)
 }
 
 func (s *Server) setupTeamRoutes(v1 fiber.Router) {
@@ -163,38 +200,131 @@ func (s *Server) setupTeamRoutes(v1 fiber.Router) {
 
 	teamGroup.Get("/", s.auth.RequireSuperuser, teamHandler.ListTeams)
 	teamGroup.Post("/", s.auth.RequireSuperuser, teamHandler.CreateTeam)
-	teamGroup.Get("/users", s.auth.RequireTeamUser, teamHandler.GetTeamUsers)
-	teamGroup.Post("/add", s.auth.RequireAdmin, teamHandler.AddUser)
-	teamGroup.Delete("/users/:id", s.auth.RequireAdmin, teamHandler.RemoveUser)
-	teamGroup.Post("/users/:id/reset-password", s.auth.RequireAdmin, teamHandler.ResetUserPassword)
+	teamGroup.Patch("/", s.auth.RequireAdmin, teamHandler.UpdateTeam)
+	teamGroup.Delete("/:id", s.auth.RequireSuperuser, teamHandler.DeleteTeam)
+	teamGroup.Post("/leave", s.auth.RequireTeamUser, teamHandler.LeaveTeam)
+	teamGroup.Post("/transfer", s.auth.RequireAdmin, teamHandler.TransferAdmin)
+	manageUsers := s.auth.AllowAPIToken(models.APITokenScopeUsersManage)
+	teamGroup.Get("/users", manageUsers, s.auth.RequireTeamUser, teamHandler.GetTeamUsers)
+	teamGroup.Post("/add", manageUsers, s.auth.RequireAdmin, teamHandler.AddUser)
+	teamGroup.Delete("/users/:id", manageUsers, s.auth.RequireAdmin, teamHandler.RemoveUser)
+	teamGroup.Put("/users/:id/role", manageUsers, s.auth.RequireAdmin, teamHandler.ChangeUserRole)
+	teamGroup.Post("/users/:id/reset-password", manageUsers, s.auth.RequireAdmin, teamHandler.ResetUserPassword)
+	teamGroup.Delete("/users/:id/two-factor", manageUsers, s.auth.RequireAdmin, teamHandler.ResetUserTwoFactor)
+	teamGroup.Get("/visitor-warning", s.auth.RequireTeamUser, teamHandler.GetVisitorWarning)
+	teamGroup.Put("/visitor-warning", s.auth.RequireAdmin, teamHandler.UpdateVisitorWarning)
+	teamGroup.Get("/bandwidth", s.auth.RequireTeamUser, teamHandler.GetBandwidth)
+	teamGroup.Put("/bandwidth", s.auth.RequireAdmin, teamHandler.UpdateBandwidth)
+	teamGroup.Put("/users/:id/bandwidth", s.auth.RequireAdmin, teamHandler.UpdateUserBandwidth)
+	teamGroup.Get("/tunnel-policy", s.auth.RequireTeamUser, teamHandler.GetTunnelPolicy)
+	teamGroup.Put("/tunnel-policy", s.auth.RequireAdmin, teamHandler.UpdateTunnelPolicy)
+	teamGroup.Get("/two-factor", s.auth.RequireTeamUser, teamHandler.GetTwoFactorPolicy)
+	teamGroup.Put("/two-factor", s.auth.RequireAdmin, teamHandler.UpdateTwoFactorPolicy)
 }
 
 func (s *Server) setupConnectionRoutes(v1 fiber.Router) {
-	connHandler := connection.NewHandler(s.db.DB, s.store)
+	connHandler := connection.NewHandler(s.db.DB, s.store, s.auth.Throttle())
 	connGroup := v1.Group("/connections")
 
-	connGroup.Get("/", s.auth.RequireTeamUser, connHandler.GetConnections)
+	readConnections := s.auth.AllowAPIToken(models.APITokenScopeConnectionsRead)
+	connGroup.Get("/", readConnections, s.auth.RequireTeamUser, connHandler.GetConnections)
 	connGroup.Post("/", connHandler.CreateConnection)
+	connGroup.Delete("/:id", s.auth.RequireTeamUser, connHandler.CloseConnection)
+	connGroup.Get("/:id/access-logs", readConnections, s.auth.RequireTeamUser, connHandler.GetAccessLogs)
+	v1.Get("/access-logs", readConnections, s.auth.RequireTeamUser, connHandler.SearchAccessLogs)
 }
 
 func (s *Server) setupSubdomainRoutes(v1 fiber.Router) {
 	handler := subdomain.NewHandler(s.db.DB, s.config)
-	group := v1.Group("/reserved-subdomains", s.auth.RequireTeamUser)
+	group := v1.Group("/reserved-subdomains", s.auth.AllowAPIToken(models.APITokenScopeReservationsManage), s.auth.RequireTeamUser)
 
 	group.Get("/", handler.List)
 	group.Post("/", handler.Create)
 	group.Delete("/:subdomain", handler.Delete)
+	group.Put("/:subdomain/owner", s.auth.RequireAdmin, handler.Transfer)
+	group.Put("/:subdomain/members", s.auth.RequireAdmin, handler.SetMembers)
+}
+
+func (s *Server) setupSshKeyRoutes(v1 fiber.Router) {
+	handler := sshkey.NewHandler(s.db.DB)
+	group := v1.Group("/ssh-keys", s.auth.AllowAPIToken(models.APITokenScopeUsersManage), s.auth.RequireTeamUserOrAPIAuth)
+
+	group.Get("/", handler.List)
+	group.Post("/", handler.Create)
+	group.Delete("/:id", handler.Delete)
+}
+
+func (s *Server) setupAPITokenRoutes(v1 fiber.Router) {
+	handler := apitoken.NewHandler(s.db.DB)
+	group := v1.Group("/api-tokens", s.auth.RequireTeamUser)
+
+	group.Get("/", handler.List)
+	group.Post("/", handler.Create)
+	group.Delete("/:id", handler.Revoke)
+}
+
+func (s *Server) setupDeviceKeyRoutes(v1 fiber.Router) {
+	handler := devicekey.NewHandler(s.db.DB, s.config)
+	group := v1.Group("/device-keys", s.auth.RequireTeamUser)
+
+	group.Get("/", handler.List)
+	group.Post("/", handler.Create)
+	group.Delete("/:id", handler.Revoke)
+}
+
+func (s *Server) setupTunnelCredentialRoutes(v1 fiber.Router) {
+	handler := tunnelcredential.NewHandler(s.db.DB, s.config)
+	group := v1.Group("/tunnel-credentials", s.auth.AllowAPIToken(models.APITokenScopeTunnelCredentials), s.auth.RequireTeamUser)
+
+	group.Post("/", handler.Mint)
+}
+
+func (s *Server) setupErrorPageRoutes(v1 fiber.Router) {
+	handler := errorpage.NewHandler(s.db.DB)
+	group := v1.Group("/error-pages")
+
+	group.Get("/", s.auth.RequireTeamUser, handler.List)
+	group.Put("/:kind", s.auth.RequireAdmin, handler.Save)
+	group.Delete("/:kind", s.auth.RequireAdmin, handler.Delete)
+}
+
+func (s *Server) setupMirrorRoutes(v1 fiber.Router) {
+	handler := mirror.NewHandler(s.db.DB)
+	group := v1.Group("/mirrors")
+
+	group.Get("/", s.auth.RequireTeamUser, handler.List)
+	group.Post("/", s.auth.RequireAdmin, handler.Create)
+	group.Delete("/:id", s.auth.RequireAdmin, handler.Delete)
+}
+
+func (s *Server) setupSplitRoutes(v1 fiber.Router) {
+	handler := split.NewHandler(s.db.DB)
+	group := v1.Group("/splits")
+
+	group.Get("/", s.auth.RequireTeamUser, handler.List)
+	group.Post("/", s.auth.RequireAdmin, handler.Create)
+	group.Patch("/:id", s.auth.RequireAdmin, handler.Update)
+	group.Delete("/:id", s.auth.RequireAdmin, handler.Delete)
+}
+
+func (s *Server) setupCacheRoutes(v1 fiber.Router) {
+	handler := cache.NewHandler(s.db.DB)
+	group := v1.Group("/cache")
+
+	group.Post("/purge", s.auth.RequireAdmin, handler.Purge)
 }
 
 func (s *Server) setupConfigRoutes(v1 fiber.Router) {
-	configHandler := config.NewHandler(s.db.DB, s.store, s.config, s.statsCollector)
+	configHandler := config.NewHandler(s.db.DB, s.store, s.config, s.statsCollector, s.reloadConfig)
 	configGroup := v1.Group("/config")
 
 	configGroup.Post("/download", configHandler.DownloadConfig)
 	configGroup.Get("/setup-script", s.auth.RequireTeamUser, configHandler.GetSetupScript)
 	configGroup.Get("/stats", s.auth.RequireTeamUser, configHandler.GetStats)
-	configGroup.Get("/template", s.auth.RequireTeamUser, configHandler.GetClientTemplate)
-	configGroup.Put("/template", s.auth.RequireAdmin, configHandler.UpdateClientTemplate)
+	manageTemplates := s.auth.AllowAPIToken(models.APITokenScopeTemplatesManage)
+	configGroup.Get("/template", manageTemplates, s.auth.RequireTeamUser, configHandler.GetClientTemplate)
+	configGroup.Put("/template", manageTemplates, s.auth.RequireAdmin, configHandler.UpdateClientTemplate)
+	configGroup.Post("/reload", s.auth.RequireSuperuser, configHandler.ReloadConfig)
 }
 
 func (s *Server) setupAutoSignupRoutes(v1 fiber.Router) {
@@ -205,9 +335,17 @@ func (s *Server) setupAutoSignupRoutes(v1 fiber.Router) {
 	autoSignupGroup.Patch("/", s.auth.RequireSuperuser, autoSignupHandler.Update)
 }
 
+func (s *Server) setupAuditRoutes(v1 fiber.Router) {
+	handler := audit.NewHandler(s.db.DB)
+	group := v1.Group("/audit-logs", s.auth.RequireAdmin)
+
+	group.Get("/", handler.List)
+	group.Get("/export", handler.Export)
+}
+
 func (s *Server) setupAdminRoutes(v1 fiber.Router) {
 	teamHandler := team.NewHandler(s.db.DB, s.store)
-	adminGroup := v1.Group("/admin", s.auth.RequireAPIAuth)
+	adminGroup := v1.Group("/admin", s.auth.AllowAPIToken(models.APITokenScopeUsersManage), s.auth.RequireTeamUserOrAPIAuth)
 
 	adminGroup.Post("/users", teamHandler.AddUserWithAPIKey)
 }
@@ -245,13 +383,36 @@ func (s *Server) Store() *session.Store {
 	return s.store
 }
 
-func (s *Server) Start() error {
+// Throttle returns the login throttle, for the SSH server to share when both
+// run in one process.
+func (s *Server) Throttle() *middleware.LoginThrottle {
+	return s.auth.Throttle()
+}
+
+// SetConfigReloader installs the function behind the config reload endpoint.
+// portrd sets it so an API-triggered reload reaches every component running
+// in the process, not just the admin server.
+func (s *Server) SetConfigReloader(reload serverConfig.ReloadFunc) {
+	s.reloader = reload
+}
+
+func (s *Server) reloadConfig() (serverConfig.ReloadReport, error) {
+	if s.reloader == nil {
+		return serverConfig.ReloadReport{}, serverConfig.ErrReloadUnavailable
+	}
+	return s.reloader()
+}
+
+func (s *Server) GetServerAddr() string {
+	return fmt.Sprintf(":%d", s.config.Port)
+}
+
+func (s *Server) Start(listener net.Listener) error {
 	s.scheduler.Start()
 	s.statsCollector.Start()
 
-	addr := fmt.Sprintf(":%d", s.config.Port)
-	log.Info("Starting admin server", "address", addr)
-	return s.app.Listen(addr)
+	log.Info("Starting admin server", "address", s.GetServerAddr())
+	return s.app.Listener(listener)
 }
 
 func (s *Server) Shutdown() error {
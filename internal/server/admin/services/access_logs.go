@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"gorm.io/gorm"
+)
+
+var ErrConnectionNotFound = errors.New("connection not found")
+
+const accessLogBatchSize = 500
+
+type AccessLogService struct {
+	db *gorm.DB
+}
+
+func NewAccessLogService(db *gorm.DB) *AccessLogService {
+	return &AccessLogService{db: db}
+}
+
+// Save stores entries, filling in the team and owner of their connections.
+// Entries of connections that no longer exist are dropped.
+func (s *AccessLogService) Save(ctx context.Context, entries []models.AccessLog) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(entries))
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if !seen[entry.ConnectionID] {
+			seen[entry.ConnectionID] = true
+			ids = append(ids, entry.ConnectionID)
+		}
+	}
+
+	var connections []models.Connection
+	if err := s.db.WithContext(ctx).Preload("CreatedBy.User").Where("id IN ?", ids).Find(&connections).Error; err != nil {
+		return err
+	}
+	owners := make(map[string]models.Connection, len(connections))
+	for _, connection := range connections {
+		owners[connection.ID] = connection
+	}
+
+	logs := make([]models.AccessLog, 0, len(entries))
+	for _, entry := range entries {
+		connection, ok := owners[entry.ConnectionID]
+		if !ok {
+			continue
+		}
+		entry.TeamID = connection.TeamID
+		entry.Owner = connection.CreatedBy.User.Email
+		logs = append(logs, entry)
+	}
+	if len(logs) == 0 {
+		return nil
+	}
+	return s.db.WithContext(ctx).CreateInBatches(logs, accessLogBatchSize).Error
+}
+
+// Prune deletes entries older than before and returns how many it deleted.
+func (s *AccessLogService) Prune(ctx context.Context, before time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).Where("created_at < ?", before).Delete(&models.AccessLog{})
+	return result.RowsAffected, result.Error
+}
+
+// ListForConnection returns a page of a team connection's entries, newest
+// first, with the total number of entries.
+func (s *AccessLogService) ListForConnection(ctx context.Context, teamID uint, connectionID string, limit, offset int) ([]models.AccessLog, int64, error) {
+	var connection models.Connection
+	err := s.db.WithContext(ctx).Where("id = ? AND team_id = ?", connectionID, teamID).First(&connection).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, 0, ErrConnectionNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := s.db.WithContext(ctx).Model(&models.AccessLog{}).Where("connection_id = ?", connectionID)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	logs := []models.AccessLog{}
+	err = query.Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&logs).Error
+	return logs, total, err
+}
+
+// FindByRequestID returns a team's entries for a request ID, newest first.
+// IDs visitors send themselves are not unique, so there may be several.
+func (s *AccessLogService) FindByRequestID(ctx context.Context, teamID uint, requestID string, limit int) ([]models.AccessLog, error) {
+	logs := []models.AccessLog{}
+	err := s.db.WithContext(ctx).
+		Where("team_id = ? AND request_id = ?", teamID, requestID).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Find(&logs).Error
+	return logs, err
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAPITokenNameRequired    = errors.New("api token name is required")
+	ErrAPITokenScopesRequired  = errors.New("api token needs at least one scope")
+	ErrInvalidAPITokenScope    = errors.New("invalid api token scope")
+	ErrAPITokenScopeNotAllowed = errors.New("api token scope needs team admin access")
+	ErrInvalidAPITokenExpiry   = errors.New("api token expiry must be in the future")
+	ErrAPITokenNotFound        = errors.New("api token not found")
+	ErrAPITokenInvalid         = errors.New("invalid, expired or revoked api token")
+)
+
+const (
+	// apiTokenPrefixLength is how much of a token is kept to tell it apart.
+	apiTokenPrefixLength = len(models.APITokenPrefix) + 6
+	// apiTokenLastUsedInterval limits how often a token's last use is
+	// written, so busy automation does not write on every request.
+	apiTokenLastUsedInterval = time.Minute
+)
+
+// adminAPITokenScopes are the scopes of routes only team admins can call.
+var adminAPITokenScopes = map[string]bool{
+	models.APITokenScopeUsersManage:     true,
+	models.APITokenScopeTemplatesManage: true,
+}
+
+type APITokenService struct {
+	db *gorm.DB
+}
+
+func NewAPITokenService(db *gorm.DB) *APITokenService {
+	return &APITokenService{db: db}
+}
+
+type CreateAPITokenInput struct {
+	Name   string
+	Scopes []string
+	// ExpiresAt is nil for a token that never expires.
+	ExpiresAt *time.Time
+}
+
+// List returns the team user's tokens, newest first, including revoked and
+// expired ones.
+func (s *APITokenService) List(ctx context.Context, teamUserID uint) ([]models.APIToken, error) {
+	tokens := []models.APIToken{}
+	err := s.db.WithContext(ctx).
+		Where("team_user_id = ?", teamUserID).
+		Order("created_at DESC, id DESC").
+		Find(&tokens).Error
+	return tokens, err
+}
+
+// Create issues a token for the team user and returns it with the token
+// itself, which is not stored and cannot be shown again.
+func (s *APITokenService) Create(ctx context.Context, teamUser *models.TeamUser, input CreateAPITokenInput) (*models.APIToken, string, error) {
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		return nil, "", ErrAPITokenNameRequired
+	}
+	scopes, err := s.validScopes(teamUser, input.Scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return nil, "", ErrInvalidAPITokenExpiry
+	}
+
+	secret := models.GenerateAPIToken()
+	token := &models.APIToken{
+		TeamUserID: teamUser.ID,
+		Name:       name,
+		Prefix:     secret[:apiTokenPrefixLength],
+		TokenHash:  models.HashAPIToken(secret),
+		Scopes:     strings.Join(scopes, " "),
+		ExpiresAt:  input.ExpiresAt,
+	}
+	if err := s.db.WithContext(ctx).Create(token).Error; err != nil {
+		return nil, "", err
+	}
+	return token, secret, nil
+}
+
+// validScopes checks the requested scopes and returns them deduplicated, in
+// the order of models.APITokenScopes.
+func (s *APITokenService) validScopes(teamUser *models.TeamUser, requested []string) ([]string, error) {
+	wanted := map[string]bool{}
+	for _, scope := range requested {
+		scope = strings.TrimSpace(scope)
+		if !models.IsValidAPITokenScope(scope) {
+			return nil, ErrInvalidAPITokenScope
+		}
+		if adminAPITokenScopes[scope] && !teamUser.IsAdmin() && !teamUser.User.IsSuperuser {
+			return nil, ErrAPITokenScopeNotAllowed
+		}
+		wanted[scope] = true
+	}
+	if len(wanted) == 0 {
+		return nil, ErrAPITokenScopesRequired
+	}
+	scopes := make([]string, 0, len(wanted))
+	for _, scope := range models.APITokenScopes {
+		if wanted[scope] {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+// Revoke stops one of the team user's tokens from working, along with the
+// tunnel credentials minted with it and their tunnels. Revoking a token twice
+// returns ErrAPITokenNotFound.
+func (s *APITokenService) Revoke(ctx context.Context, teamUserID, id uint) (*models.APIToken, error) {
+	var token models.APIToken
+	err := s.db.WithContext(ctx).
+		Where("id = ? AND team_user_id = ? AND revoked_at IS NULL", id, teamUserID).
+		First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAPITokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.APIToken{}).
+			Where("id = ? AND revoked_at IS NULL", token.ID).
+			Update("revoked_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrAPITokenNotFound
+		}
+		return revokeTunnelCredentials(tx, token.ID, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	token.RevokedAt = &now
+	return &token, nil
+}
+
+// Authenticate returns the usable token matching secret, with its team user,
+// and records that it was used.
+func (s *APITokenService) Authenticate(ctx context.Context, secret string) (*models.APIToken, error) {
+	if !strings.HasPrefix(secret, models.APITokenPrefix) {
+		return nil, ErrAPITokenInvalid
+	}
+	var token models.APIToken
+	err := s.db.WithContext(ctx).
+		Preload("TeamUser.User").
+		Preload("TeamUser.Team").
+		Where("token_hash = ?", models.HashAPIToken(secret)).
+		First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAPITokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if !token.Usable(now) {
+		return nil, ErrAPITokenInvalid
+	}
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= apiTokenLastUsedInterval {
+		if err := s.db.WithContext(ctx).Model(&token).UpdateColumn("last_used_at", now).Error; err != nil {
+			return nil, err
+		}
+		token.LastUsedAt = &now
+	}
+	return &token, nil
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"gorm.io/gorm"
+)
+
+const auditLogExportBatchSize = 500
+
+type AuditLogService struct {
+	db *gorm.DB
+}
+
+func NewAuditLogService(db *gorm.DB) *AuditLogService {
+	return &AuditLogService{db: db}
+}
+
+// AuditLogFilter narrows the audit log. Zero fields match everything.
+type AuditLogFilter struct {
+	// TeamID limits entries to one team's. AllTeams lifts the limit, and
+	// includes entries outside any team.
+	TeamID   uint
+	AllTeams bool
+	// Action matches an action exactly, or a group of them with a trailing
+	// dot, as "auth.".
+	Action     string
+	ActorEmail string
+	TargetType string
+	TargetID   string
+	Since      time.Time
+	Until      time.Time
+}
+
+// Record appends an entry to the audit log.
+func (s *AuditLogService) Record(ctx context.Context, entry models.AuditLog) error {
+	entry.ID = 0
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now().UTC()
+	}
+	return s.db.WithContext(ctx).Create(&entry).Error
+}
+
+// List returns a page of matching entries, newest first, with the total
+// number of matching entries.
+func (s *AuditLogService) List(ctx context.Context, filter AuditLogFilter, limit, offset int) ([]models.AuditLog, int64, error) {
+	query := s.query(ctx, filter)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	logs := []models.AuditLog{}
+	err := query.Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&logs).Error
+	return logs, total, err
+}
+
+// Export calls fn with every matching entry, oldest first, reading them in
+// batches so exports of any size use bounded memory.
+func (s *AuditLogService) Export(ctx context.Context, filter AuditLogFilter, fn func(models.AuditLog) error) error {
+	var lastID uint64
+	for {
+		var batch []models.AuditLog
+		err := s.query(ctx, filter).
+			Where("id > ?", lastID).
+			Order("id ASC").
+			Limit(auditLogExportBatchSize).
+			Find(&batch).Error
+		if err != nil {
+			return err
+		}
+		for _, entry := range batch {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		if len(batch) < auditLogExportBatchSize {
+			return nil
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+}
+
+func (s *AuditLogService) query(ctx context.Context, filter AuditLogFilter) *gorm.DB {
+	query := s.db.WithContext(ctx).Model(&models.AuditLog{})
+	if !filter.AllTeams {
+		query = query.Where("team_id = ?", filter.TeamID)
+	}
+	if filter.Action != "" {
+		if filter.Action[len(filter.Action)-1] == '.' {
+			query = query.Where("action LIKE ?", filter.Action+"%")
+		} else {
+			query = query.Where("action = ?", filter.Action)
+		}
+	}
+	if filter.ActorEmail != "" {
+		query = query.Where("actor_email = ?", models.NormalizeEmail(filter.ActorEmail))
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until.UTC())
+	}
+	return query
+}
+
+// AuditDiff returns the JSON diff of the fields whose value differs between
+// before and after, or "" when none does. Fields missing from one side are
+// compared as nil.
+func AuditDiff(before, after map[string]any) string {
+	changes := make(map[string]models.AuditChange)
+	for _, fields := range []map[string]any{before, after} {
+		for key := range fields {
+			if !reflect.DeepEqual(before[key], after[key]) {
+				changes[key] = models.AuditChange{From: before[key], To: after[key]}
+			}
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+	diff, err := json.Marshal(changes)
+	if err != nil {
+		return ""
+	}
+	return string(diff)
+}
@@ -29,7 +29,9 @@ type GitHubAutoSignupInput struct {
 	GithubAvatarURL   string
 }
 
-type GitHubAutoSignupResult struct {
+// AutoSignupResult is a user signed in through an identity provider. Team
+// is set when the user was just signed up into it.
+type AutoSignupResult struct {
 	User models.User
 	Team models.Team
 }
@@ -113,9 +115,24 @@ func (s *AutoSignupService) UpdateSettings(enabled bool, input []AutoSignupDomai
 	return s.GetSettings()
 }
 
-func (s *AutoSignupService) ProvisionGitHubUser(input GitHubAutoSignupInput) (*GitHubAutoSignupResult, error) {
-	input.Email = models.NormalizeEmail(input.Email)
-	var result GitHubAutoSignupResult
+func (s *AutoSignupService) ProvisionGitHubUser(input GitHubAutoSignupInput) (*AutoSignupResult, error) {
+	return s.provision(input.Email, func(tx *gorm.DB, userID uint) error {
+		return createGitHubUser(tx, input, userID)
+	})
+}
+
+// ProvisionUser signs in the user with a verified email, signing them up
+// under the auto signup rules if they have no account yet.
+func (s *AutoSignupService) ProvisionUser(email string) (*AutoSignupResult, error) {
+	return s.provision(email, nil)
+}
+
+// provision returns the user with email, or signs them up into the team
+// their email domain maps to. link, if set, links the user to their identity
+// provider account in the same transaction.
+func (s *AutoSignupService) provision(email string, link func(tx *gorm.DB, userID uint) error) (*AutoSignupResult, error) {
+	email = models.NormalizeEmail(email)
+	var result AutoSignupResult
 
 	err := s.db.Transaction(func(tx *gorm.DB) error {
 		settings, err := autoSignupSettingsForUpdate(tx)
@@ -124,10 +141,12 @@ func (s *AutoSignupService) ProvisionGitHubUser(input GitHubAutoSignupInput) (*G
 		}
 
 		var existingUser models.User
-		err = tx.Where("LOWER(email) = ?", input.Email).First(&existingUser).Error
+		err = tx.Where("LOWER(email) = ?", email).First(&existingUser).Error
 		if err == nil {
-			if err := createGitHubUser(tx, input, existingUser.ID); err != nil {
-				return err
+			if link != nil {
+				if err := link(tx, existingUser.ID); err != nil {
+					return err
+				}
 			}
 			result.User = existingUser
 			return nil
@@ -136,18 +155,20 @@ func (s *AutoSignupService) ProvisionGitHubUser(input GitHubAutoSignupInput) (*G
 			return err
 		}
 
-		team, err := autoSignupTeamForEmail(tx, settings, input.Email)
+		team, err := autoSignupTeamForEmail(tx, settings, email)
 		if err != nil {
 			return err
 		}
 
-		user := models.User{Email: input.Email}
+		user := models.User{Email: email}
 		if err := tx.Create(&user).Error; err != nil {
 			return err
 		}
 
-		if err := createGitHubUser(tx, input, user.ID); err != nil {
-			return err
+		if link != nil {
+			if err := link(tx, user.ID); err != nil {
+				return err
+			}
 		}
 
 		teamUser := models.TeamUser{
@@ -159,7 +180,7 @@ func (s *AutoSignupService) ProvisionGitHubUser(input GitHubAutoSignupInput) (*G
 			return err
 		}
 
-		result = GitHubAutoSignupResult{User: user, Team: *team}
+		result = AutoSignupResult{User: user, Team: *team}
 		return nil
 	})
 	if err != nil {
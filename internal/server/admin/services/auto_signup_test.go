@@ -109,6 +109,7 @@ func newAutoSignupServiceTestDB(t *testing.T) *gorm.DB {
 		&models.TeamUser{},
 		&models.AutoSignupSettings{},
 		&models.AutoSignupDomain{},
+		&models.RecoveryCode{},
 	); err != nil {
 		t.Fatalf("failed to migrate test database: %v", err)
 	}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidBandwidthLimit = errors.New("bandwidth limits cannot be negative")
+	ErrTeamUserNotFound      = errors.New("team user not found")
+)
+
+type BandwidthService struct {
+	db *gorm.DB
+}
+
+func NewBandwidthService(db *gorm.DB) *BandwidthService {
+	return &BandwidthService{db: db}
+}
+
+// BandwidthAccount is the limits of a team or team user and its traffic in
+// the current month.
+type BandwidthAccount struct {
+	models.BandwidthLimits
+	UsedBytes int64
+}
+
+// BandwidthUserStatus is a team user's bandwidth account.
+type BandwidthUserStatus struct {
+	TeamUserID uint
+	Email      string
+	BandwidthAccount
+}
+
+// BandwidthStatus is a team's bandwidth account and those of its users.
+type BandwidthStatus struct {
+	Period   string
+	ResetsAt time.Time
+	Team     BandwidthAccount
+	Users    []BandwidthUserStatus
+}
+
+// BandwidthSnapshot is what tunnel servers need to enforce limits: the
+// accounts of every team and team user with a limit, keyed by ID.
+type BandwidthSnapshot struct {
+	Period string
+	Teams  map[uint]BandwidthAccount
+	Users  map[uint]BandwidthAccount
+}
+
+// SetTeamLimits caps the traffic of all a team's tunnels together.
+func (s *BandwidthService) SetTeamLimits(ctx context.Context, teamID uint, limits models.BandwidthLimits) error {
+	if limits.MonthlyBytes < 0 || limits.RateBytes < 0 {
+		return ErrInvalidBandwidthLimit
+	}
+	result := s.db.WithContext(ctx).Model(&models.Team{}).
+		Where("id = ?", teamID).
+		Updates(map[string]any{
+			"bandwidth_monthly_bytes": limits.MonthlyBytes,
+			"bandwidth_rate_bytes":    limits.RateBytes,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTeamNotFound
+	}
+	return nil
+}
+
+// SetUserLimits caps the traffic of a team user's own tunnels.
+func (s *BandwidthService) SetUserLimits(ctx context.Context, teamID, teamUserID uint, limits models.BandwidthLimits) error {
+	if limits.MonthlyBytes < 0 || limits.RateBytes < 0 {
+		return ErrInvalidBandwidthLimit
+	}
+	result := s.db.WithContext(ctx).Model(&models.TeamUser{}).
+		Where("id = ? AND team_id = ?", teamUserID, teamID).
+		Updates(map[string]any{
+			"bandwidth_monthly_bytes": limits.MonthlyBytes,
+			"bandwidth_rate_bytes":    limits.RateBytes,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTeamUserNotFound
+	}
+	return nil
+}
+
+// Status returns a team's limits and its traffic this month, in total and
+// per team user.
+func (s *BandwidthService) Status(ctx context.Context, teamID uint) (*BandwidthStatus, error) {
+	var team models.Team
+	if err := s.db.WithContext(ctx).Where("id = ?", teamID).First(&team).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTeamNotFound
+		}
+		return nil, err
+	}
+	var teamUsers []models.TeamUser
+	err := s.db.WithContext(ctx).Preload("User").
+		Where("team_id = ?", teamID).
+		Order("id").
+		Find(&teamUsers).Error
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	period := models.BandwidthPeriod(now)
+	var usage []models.BandwidthUsage
+	err = s.db.WithContext(ctx).
+		Where("team_id = ? AND period = ?", teamID, period).
+		Find(&usage).Error
+	if err != nil {
+		return nil, err
+	}
+	used := make(map[uint]int64, len(usage))
+	status := &BandwidthStatus{
+		Period:   period,
+		ResetsAt: models.BandwidthResetsAt(now),
+		Team:     BandwidthAccount{BandwidthLimits: team.BandwidthLimits},
+	}
+	for _, row := range usage {
+		used[row.TeamUserID] += row.Bytes
+		status.Team.UsedBytes += row.Bytes
+	}
+	for _, teamUser := range teamUsers {
+		status.Users = append(status.Users, BandwidthUserStatus{
+			TeamUserID: teamUser.ID,
+			Email:      teamUser.User.Email,
+			BandwidthAccount: BandwidthAccount{
+				BandwidthLimits: teamUser.BandwidthLimits,
+				UsedBytes:       used[teamUser.ID],
+			},
+		})
+	}
+	return status, nil
+}
+
+// Snapshot returns the accounts of the teams and team users with a limit,
+// with their traffic in the month of now.
+func (s *BandwidthService) Snapshot(ctx context.Context, now time.Time) (*BandwidthSnapshot, error) {
+	limited := "bandwidth_monthly_bytes > 0 OR bandwidth_rate_bytes > 0"
+	var teams []models.Team
+	if err := s.db.WithContext(ctx).Where(limited).Find(&teams).Error; err != nil {
+		return nil, err
+	}
+	var teamUsers []models.TeamUser
+	if err := s.db.WithContext(ctx).Where(limited).Find(&teamUsers).Error; err != nil {
+		return nil, err
+	}
+	snapshot := &BandwidthSnapshot{
+		Period: models.BandwidthPeriod(now),
+		Teams:  make(map[uint]BandwidthAccount, len(teams)),
+		Users:  make(map[uint]BandwidthAccount, len(teamUsers)),
+	}
+	if len(teams) == 0 && len(teamUsers) == 0 {
+		return snapshot, nil
+	}
+
+	var usage []models.BandwidthUsage
+	if err := s.db.WithContext(ctx).Where("period = ?", snapshot.Period).Find(&usage).Error; err != nil {
+		return nil, err
+	}
+	teamUsed := map[uint]int64{}
+	userUsed := map[uint]int64{}
+	for _, row := range usage {
+		teamUsed[row.TeamID] += row.Bytes
+		userUsed[row.TeamUserID] += row.Bytes
+	}
+	for _, team := range teams {
+		snapshot.Teams[team.ID] = BandwidthAccount{BandwidthLimits: team.BandwidthLimits, UsedBytes: teamUsed[team.ID]}
+	}
+	for _, teamUser := range teamUsers {
+		snapshot.Users[teamUser.ID] = BandwidthAccount{BandwidthLimits: teamUser.BandwidthLimits, UsedBytes: userUsed[teamUser.ID]}
+	}
+	return snapshot, nil
+}
+
+// RecordUsage adds traffic to a team user's count for a month.
+func (s *BandwidthService) RecordUsage(ctx context.Context, usage models.BandwidthUsage) error {
+	usage.ID = 0
+	usage.UpdatedAt = time.Now().UTC()
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "team_user_id"}, {Name: "period"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"bytes":      gorm.Expr(`"bandwidth_usage"."bytes" + excluded."bytes"`),
+			"updated_at": gorm.Expr(`excluded."updated_at"`),
+		}),
+	}).Create(&usage).Error
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"gorm.io/gorm"
+)
+
+var ErrCacheSubdomainNotFound = errors.New("subdomain not used by team")
+
+// maxPurgesPerPoll bounds the purges a tunnel server reads at once; the rest
+// are read on its next poll.
+const maxPurgesPerPoll = 500
+
+type CacheService struct {
+	db *gorm.DB
+}
+
+func NewCacheService(db *gorm.DB) *CacheService {
+	return &CacheService{db: db}
+}
+
+// Purge asks the tunnel servers to drop their cached responses for a
+// subdomain the team reserved or last tunneled on.
+func (s *CacheService) Purge(ctx context.Context, teamID uint, subdomain string) (*models.CachePurge, error) {
+	subdomain = strings.ToLower(strings.TrimSpace(subdomain))
+	if subdomain == "" {
+		return nil, ErrCacheSubdomainNotFound
+	}
+	owner, err := findSubdomainOwner(ctx, s.db, subdomain)
+	if err != nil {
+		return nil, err
+	}
+	if owner == nil || owner.TeamID != teamID {
+		return nil, ErrCacheSubdomainNotFound
+	}
+
+	purge := &models.CachePurge{TeamID: teamID, Subdomain: subdomain, CreatedAt: time.Now().UTC()}
+	if err := s.db.WithContext(ctx).Create(purge).Error; err != nil {
+		return nil, err
+	}
+	return purge, nil
+}
+
+// PurgesAfter returns the purges with an ID above afterID, oldest first.
+func (s *CacheService) PurgesAfter(ctx context.Context, afterID uint64) ([]models.CachePurge, error) {
+	purges := []models.CachePurge{}
+	err := s.db.WithContext(ctx).
+		Where("id > ?", afterID).
+		Order("id ASC").
+		Limit(maxPurgesPerPoll).
+		Find(&purges).Error
+	return purges, err
+}
+
+// Prune deletes purges older than before, which every tunnel server has
+// long applied, and returns how many it deleted.
+func (s *CacheService) Prune(ctx context.Context, before time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).Where("created_at < ?", before).Delete(&models.CachePurge{})
+	return result.RowsAffected, result.Error
+}
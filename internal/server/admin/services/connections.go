@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/amalshaji/portr/internal/server/admin/models"
 	"gorm.io/gorm"
@@ -10,6 +11,8 @@ import (
 
 const activeConnectionSubdomainIndex = "idx_connection_active_subdomain_unique"
 
+var ErrConnectionClosed = errors.New("connection is already closed")
+
 type ConnectionService struct {
 	db *gorm.DB
 }
@@ -18,25 +21,43 @@ func NewConnectionService(db *gorm.DB) *ConnectionService {
 	return &ConnectionService{db: db}
 }
 
-func (s *ConnectionService) Create(ctx context.Context, teamUser *models.TeamUser, connectionType string, subdomain *string) (*models.Connection, error) {
+// ConnectionKey is the key a connection is opened with, when it is not the
+// team user's own secret key. Only the key that opened a connection can
+// resume it.
+type ConnectionKey struct {
+	// DeviceKeyID is set for a device key; revoking it closes the connection.
+	DeviceKeyID *uint
+	// TunnelCredentialID is set for an ephemeral tunnel credential.
+	TunnelCredentialID *uint
+}
+
+// Create reserves a connection for the team user. expiresAt, when set, is
+// when the server closes the tunnel.
+func (s *ConnectionService) Create(ctx context.Context, teamUser *models.TeamUser, connectionType string, subdomain *string, expiresAt *time.Time, key ConnectionKey) (*models.Connection, error) {
 	if connectionType == models.ConnectionTypeHTTP {
-		return s.createHTTP(ctx, teamUser, *subdomain)
+		return s.createHTTP(ctx, teamUser, *subdomain, expiresAt, key)
 	}
 
 	connection := models.NewConnection(connectionType, subdomain, teamUser)
+	connection.ExpiresAt = expiresAt
+	connection.DeviceKeyID = key.DeviceKeyID
+	connection.TunnelCredentialID = key.TunnelCredentialID
 	if err := s.db.WithContext(ctx).Create(connection).Error; err != nil {
 		return nil, err
 	}
 	return connection, nil
 }
 
-func (s *ConnectionService) createHTTP(ctx context.Context, teamUser *models.TeamUser, subdomain string) (*models.Connection, error) {
+func (s *ConnectionService) createHTTP(ctx context.Context, teamUser *models.TeamUser, subdomain string, expiresAt *time.Time, key ConnectionKey) (*models.Connection, error) {
 	connection := models.NewConnection(models.ConnectionTypeHTTP, &subdomain, teamUser)
+	connection.ExpiresAt = expiresAt
+	connection.DeviceKeyID = key.DeviceKeyID
+	connection.TunnelCredentialID = key.TunnelCredentialID
 	err := withSubdomainRetry(ctx, s.db, func(tx *gorm.DB) error {
 		var reservation models.SubdomainReservation
-		err := tx.WithContext(ctx).Where("LOWER(subdomain) = ?", subdomain).First(&reservation).Error
+		err := tx.WithContext(ctx).Preload("Members").Where("LOWER(subdomain) = ?", subdomain).First(&reservation).Error
 		switch {
-		case err == nil && reservation.TeamUserID != teamUser.ID:
+		case err == nil && !reservation.AllowsClaim(teamUser):
 			return ErrSubdomainReserved
 		case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
 			return err
@@ -63,3 +84,31 @@ func (s *ConnectionService) createHTTP(ctx context.Context, teamUser *models.Tea
 	}
 	return connection, nil
 }
+
+// ForceClose marks a connection of the actor's team closed so the tunnel
+// server serving it tears it down. Team admins may close any of the team's
+// connections, members only their own.
+func (s *ConnectionService) ForceClose(ctx context.Context, actor *models.TeamUser, connectionID string) error {
+	var connection models.Connection
+	err := s.db.WithContext(ctx).Where("id = ? AND team_id = ?", connectionID, actor.TeamID).First(&connection).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrConnectionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !actor.IsAdmin() && !actor.User.IsSuperuser && connection.CreatedByID != actor.ID {
+		return ErrAdminAccessRequired
+	}
+	// A connection closed by a disconnect may still be reopened by its
+	// client, so only a permanent close makes this a no-op.
+	if connection.CloseReason != nil && models.ClosedPermanently(*connection.CloseReason) {
+		return ErrConnectionClosed
+	}
+
+	return s.db.WithContext(ctx).Model(&connection).Updates(map[string]any{
+		"status":       models.ConnectionStatusClosed,
+		"closed_at":    time.Now().UTC(),
+		"close_reason": models.ConnectionCloseReasonForceClosed,
+	}).Error
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrDeviceKeyNameRequired  = errors.New("device key name is required")
+	ErrInvalidDeviceKeyExpiry = errors.New("device key expiry must be in the future")
+	ErrDeviceKeyNotFound      = errors.New("device key not found")
+	ErrInvalidSecretKey       = errors.New("invalid secret key")
+)
+
+const (
+	// deviceKeyPrefixLength is how much of a key is kept to tell it apart.
+	deviceKeyPrefixLength = len(models.DeviceKeyPrefix) + 6
+	// deviceKeyLastUsedInterval limits how often a key's last use is written
+	// while it keeps being used from the same address.
+	deviceKeyLastUsedInterval = time.Minute
+)
+
+type DeviceKeyService struct {
+	db *gorm.DB
+}
+
+func NewDeviceKeyService(db *gorm.DB) *DeviceKeyService {
+	return &DeviceKeyService{db: db}
+}
+
+// List returns the team user's device keys, newest first, including revoked
+// and expired ones.
+func (s *DeviceKeyService) List(ctx context.Context, teamUserID uint) ([]models.DeviceKey, error) {
+	keys := []models.DeviceKey{}
+	err := s.db.WithContext(ctx).
+		Where("team_user_id = ?", teamUserID).
+		Order("created_at DESC, id DESC").
+		Find(&keys).Error
+	return keys, err
+}
+
+// Create issues a device key for the team user and returns it with the key
+// itself, which is not stored and cannot be shown again. A nil expiresAt
+// never expires.
+func (s *DeviceKeyService) Create(ctx context.Context, teamUserID uint, name string, expiresAt *time.Time) (*models.DeviceKey, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", ErrDeviceKeyNameRequired
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, "", ErrInvalidDeviceKeyExpiry
+	}
+
+	secret := models.GenerateDeviceKey()
+	key := &models.DeviceKey{
+		TeamUserID: teamUserID,
+		Name:       name,
+		Prefix:     secret[:deviceKeyPrefixLength],
+		KeyHash:    models.HashDeviceKey(secret),
+		ExpiresAt:  expiresAt,
+	}
+	if err := s.db.WithContext(ctx).Create(key).Error; err != nil {
+		return nil, "", err
+	}
+	return key, secret, nil
+}
+
+// Revoke stops one of the team user's device keys from working and closes
+// the tunnels it opened, which the tunnel server then tears down. Revoking a
+// key twice returns ErrDeviceKeyNotFound.
+func (s *DeviceKeyService) Revoke(ctx context.Context, teamUserID, id uint) (*models.DeviceKey, error) {
+	var key models.DeviceKey
+	err := s.db.WithContext(ctx).
+		Where("id = ? AND team_user_id = ? AND revoked_at IS NULL", id, teamUserID).
+		First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrDeviceKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.DeviceKey{}).
+			Where("id = ? AND revoked_at IS NULL", key.ID).
+			Update("revoked_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrDeviceKeyNotFound
+		}
+		return tx.Model(&models.Connection{}).
+			Where("device_key_id = ? AND status IN ?", key.ID, []string{models.ConnectionStatusReserved, models.ConnectionStatusActive}).
+			Updates(map[string]any{
+				"status":       models.ConnectionStatusClosed,
+				"closed_at":    now,
+				"close_reason": models.ConnectionCloseReasonKeyRevoked,
+			}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	key.RevokedAt = &now
+	return &key, nil
+}
+
+// Authenticate returns the usable device key matching secret, with its team
+// user, and records that it was used from ip.
+func (s *DeviceKeyService) Authenticate(ctx context.Context, secret, ip string) (*models.DeviceKey, error) {
+	if !strings.HasPrefix(secret, models.DeviceKeyPrefix) {
+		return nil, ErrInvalidSecretKey
+	}
+	var key models.DeviceKey
+	err := s.db.WithContext(ctx).
+		Preload("TeamUser.User").
+		Preload("TeamUser.Team").
+		Where("key_hash = ?", models.HashDeviceKey(secret)).
+		First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidSecretKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if !key.Usable(now) {
+		return nil, ErrInvalidSecretKey
+	}
+	sameAddress := key.LastUsedIP != nil && *key.LastUsedIP == ip
+	if key.LastUsedAt == nil || !sameAddress || now.Sub(*key.LastUsedAt) >= deviceKeyLastUsedInterval {
+		err := s.db.WithContext(ctx).Model(&key).UpdateColumns(map[string]any{
+			"last_used_at": now,
+			"last_used_ip": ip,
+		}).Error
+		if err != nil {
+			return nil, err
+		}
+		key.LastUsedAt = &now
+		key.LastUsedIP = &ip
+	}
+	return &key, nil
+}
+
+// ResolveSecretKey returns the team user a tunnel secret key belongs to,
+// accepting both device keys and the team user's own secret key. For a
+// device key, it returns the key too. Unknown, expired and revoked keys
+// return ErrInvalidSecretKey.
+func (s *DeviceKeyService) ResolveSecretKey(ctx context.Context, secret, ip string) (*models.TeamUser, *models.DeviceKey, error) {
+	if secret == "" {
+		return nil, nil, ErrInvalidSecretKey
+	}
+	if strings.HasPrefix(secret, models.DeviceKeyPrefix) {
+		key, err := s.Authenticate(ctx, secret, ip)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &key.TeamUser, key, nil
+	}
+
+	var teamUser models.TeamUser
+	err := s.db.WithContext(ctx).
+		Preload("User").
+		Preload("Team").
+		Where("secret_key = ?", secret).
+		First(&teamUser).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrInvalidSecretKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return &teamUser, nil, nil
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidErrorPageKind = errors.New("invalid error page kind")
+	ErrErrorPageEmpty       = errors.New("error page is empty")
+	ErrErrorPageTooLarge    = errors.New("error page is too large")
+	ErrErrorPageNotFound    = errors.New("error page not found")
+)
+
+// MaxErrorPageSize bounds uploaded templates; the proxy keeps them in memory.
+const MaxErrorPageSize = 64 * 1024
+
+type ErrorPageService struct {
+	db *gorm.DB
+}
+
+func NewErrorPageService(db *gorm.DB) *ErrorPageService {
+	return &ErrorPageService{db: db}
+}
+
+// ResolvedErrorPage is the template a subdomain's visitors see, with the
+// details its placeholders are filled from.
+type ResolvedErrorPage struct {
+	Body  string
+	Owner string
+	// LastSeen is when a tunnel on the subdomain last closed, or started if
+	// it is still open. Nil when the subdomain never had one.
+	LastSeen *time.Time
+}
+
+// List returns the team's pages, team-wide pages first, with their
+// reservations loaded.
+func (s *ErrorPageService) List(ctx context.Context, teamID uint) ([]models.ErrorPage, error) {
+	pages := []models.ErrorPage{}
+	err := s.db.WithContext(ctx).
+		Preload("Reservation").
+		Where("team_id = ?", teamID).
+		Order("reservation_id IS NOT NULL, kind").
+		Find(&pages).Error
+	return pages, err
+}
+
+// Save creates or replaces the team's page of the given kind, or its
+// override for a subdomain reserved by a member of the team.
+func (s *ErrorPageService) Save(ctx context.Context, teamID uint, kind, subdomain, body string) (*models.ErrorPage, error) {
+	if !models.IsValidErrorPageKind(kind) {
+		return nil, ErrInvalidErrorPageKind
+	}
+	if strings.TrimSpace(body) == "" {
+		return nil, ErrErrorPageEmpty
+	}
+	if len(body) > MaxErrorPageSize {
+		return nil, ErrErrorPageTooLarge
+	}
+
+	reservationID, err := s.teamReservationID(ctx, teamID, subdomain)
+	if err != nil {
+		return nil, err
+	}
+
+	var page models.ErrorPage
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := scopeQuery(tx.WithContext(ctx), teamID, reservationID, kind).First(&page).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			page = models.ErrorPage{TeamID: teamID, ReservationID: reservationID, Kind: kind, Body: body}
+			return tx.WithContext(ctx).Create(&page).Error
+		case err != nil:
+			return err
+		}
+		page.Body = body
+		return tx.WithContext(ctx).Save(&page).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func (s *ErrorPageService) Delete(ctx context.Context, teamID uint, kind, subdomain string) error {
+	reservationID, err := s.teamReservationID(ctx, teamID, subdomain)
+	if errors.Is(err, ErrReservationNotFound) {
+		return ErrErrorPageNotFound
+	}
+	if err != nil {
+		return err
+	}
+	result := scopeQuery(s.db.WithContext(ctx), teamID, reservationID, kind).Delete(&models.ErrorPage{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrErrorPageNotFound
+	}
+	return nil
+}
+
+// Resolve returns the page of the given kind for a subdomain's visitors: the
+// override for its reservation, else the page of the team that reserved it
+// or last tunneled on it. It returns nil when neither configured one.
+func (s *ErrorPageService) Resolve(ctx context.Context, kind, subdomain string) (*ResolvedErrorPage, error) {
+	subdomain = strings.ToLower(subdomain)
+	if subdomain == "" {
+		return nil, nil
+	}
+	owner, err := findSubdomainOwner(ctx, s.db, subdomain)
+	if err != nil || owner == nil {
+		return nil, err
+	}
+	resolved := &ResolvedErrorPage{Owner: owner.Email, LastSeen: owner.LastSeen}
+	teamID, reservationID := owner.TeamID, owner.ReservationID
+
+	var pages []models.ErrorPage
+	query := s.db.WithContext(ctx).Where("team_id = ? AND kind = ?", teamID, kind)
+	if reservationID != nil {
+		query = query.Where("reservation_id IS NULL OR reservation_id = ?", *reservationID)
+	} else {
+		query = query.Where("reservation_id IS NULL")
+	}
+	if err := query.Find(&pages).Error; err != nil {
+		return nil, err
+	}
+	for _, page := range pages {
+		if page.ReservationID != nil || resolved.Body == "" {
+			resolved.Body = page.Body
+		}
+	}
+	if resolved.Body == "" {
+		return nil, nil
+	}
+	return resolved, nil
+}
+
+// teamReservationID returns the reservation of a subdomain held by a member
+// of the team, or nil for an empty subdomain.
+func (s *ErrorPageService) teamReservationID(ctx context.Context, teamID uint, subdomain string) (*uint, error) {
+	subdomain = strings.ToLower(strings.TrimSpace(subdomain))
+	if subdomain == "" {
+		return nil, nil
+	}
+	reservation, err := findTeamReservation(ctx, s.db, teamID, subdomain)
+	if err != nil {
+		return nil, err
+	}
+	return &reservation.ID, nil
+}
+
+func scopeQuery(db *gorm.DB, teamID uint, reservationID *uint, kind string) *gorm.DB {
+	query := db.Where("team_id = ? AND kind = ?", teamID, kind)
+	if reservationID == nil {
+		return query.Where("reservation_id IS NULL")
+	}
+	return query.Where("reservation_id = ?", *reservationID)
+}
@@ -25,13 +25,14 @@ type GitHubUser struct {
 }
 
 func NewGitHubService(cfg *serverConfig.AdminConfig) *GitHubService {
-	if cfg.GithubClientID == "" || cfg.GithubSecret == "" {
+	clientID, secret := cfg.GitHubCredentials()
+	if clientID == "" || secret == "" {
 		return nil
 	}
 
 	oauthConfig := &oauth2.Config{
-		ClientID:     cfg.GithubClientID,
-		ClientSecret: cfg.GithubSecret,
+		ClientID:     clientID,
+		ClientSecret: secret,
 		RedirectURL:  cfg.DomainAddress() + "/api/v1/auth/github/callback",
 		Scopes:       []string{"user:email"},
 		Endpoint:     github.Endpoint,
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"gorm.io/gorm"
+)
+
+// LoginAttemptService counts failed sign-ins to each account, so the owner
+// learns of them the next time they sign in.
+type LoginAttemptService struct {
+	db *gorm.DB
+}
+
+func NewLoginAttemptService(db *gorm.DB) *LoginAttemptService {
+	return &LoginAttemptService{db: db}
+}
+
+// RecordFailure counts a wrong password or two-factor code for the user.
+func (s *LoginAttemptService) RecordFailure(ctx context.Context, userID uint) error {
+	return s.db.WithContext(ctx).
+		Model(&models.User{}).
+		Where("id = ?", userID).
+		UpdateColumn("failed_login_count", gorm.Expr("failed_login_count + 1")).Error
+}
+
+// TakeFailures returns the user's failed sign-ins since they last signed in,
+// and starts the count over.
+func (s *LoginAttemptService) TakeFailures(ctx context.Context, userID uint) (int, error) {
+	var failures int
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Select("id", "failed_login_count").First(&user, userID).Error; err != nil {
+			return err
+		}
+		if user.FailedLoginCount == 0 {
+			return nil
+		}
+		// Failures recorded since the read stay for the next sign-in.
+		result := tx.Model(&models.User{}).
+			Where("id = ?", userID).
+			UpdateColumn("failed_login_count", gorm.Expr("failed_login_count - ?", user.FailedLoginCount))
+		if result.Error != nil {
+			return result.Error
+		}
+		failures = user.FailedLoginCount
+		return nil
+	})
+	return failures, err
+}
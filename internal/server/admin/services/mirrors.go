@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrMirrorSameSubdomain = errors.New("mirror source and target are the same")
+	ErrMirrorExists        = errors.New("subdomain is already mirrored")
+	ErrMirrorBodyLimit     = errors.New("invalid mirror body limit")
+	ErrMirrorNotFound      = errors.New("mirror rule not found")
+)
+
+const (
+	// DefaultMirrorBodyBytes is how much of a request body is buffered for
+	// the mirror when a rule does not say.
+	DefaultMirrorBodyBytes = 1 << 20
+	MaxMirrorBodyBytes     = 10 << 20
+)
+
+const mirrorSourceIndex = "idx_mirror_rule_source_unique"
+
+type MirrorService struct {
+	db *gorm.DB
+}
+
+func NewMirrorService(db *gorm.DB) *MirrorService {
+	return &MirrorService{db: db}
+}
+
+// ResolvedMirror is what the proxy needs to mirror a subdomain's requests.
+type ResolvedMirror struct {
+	ID           uint
+	Target       string
+	MaxBodyBytes int64
+}
+
+func (s *MirrorService) List(ctx context.Context, teamID uint) ([]models.MirrorRule, error) {
+	rules := []models.MirrorRule{}
+	err := s.db.WithContext(ctx).
+		Preload("SourceReservation").
+		Preload("TargetReservation").
+		Where("team_id = ?", teamID).
+		Order("created_at DESC").
+		Find(&rules).Error
+	return rules, err
+}
+
+// Create mirrors requests for source to target. Both must be reserved by
+// members of the team, so traffic is never copied to or from another team.
+func (s *MirrorService) Create(ctx context.Context, teamID uint, source, target string, maxBodyBytes int64) (*models.MirrorRule, error) {
+	if maxBodyBytes == 0 {
+		maxBodyBytes = DefaultMirrorBodyBytes
+	}
+	if maxBodyBytes < 0 || maxBodyBytes > MaxMirrorBodyBytes {
+		return nil, ErrMirrorBodyLimit
+	}
+	source = strings.ToLower(strings.TrimSpace(source))
+	target = strings.ToLower(strings.TrimSpace(target))
+	if source == target {
+		return nil, ErrMirrorSameSubdomain
+	}
+
+	sourceReservation, err := findTeamReservation(ctx, s.db, teamID, source)
+	if err != nil {
+		return nil, err
+	}
+	targetReservation, err := findTeamReservation(ctx, s.db, teamID, target)
+	if err != nil {
+		return nil, err
+	}
+
+	rule := &models.MirrorRule{
+		TeamID:              teamID,
+		SourceReservationID: sourceReservation.ID,
+		SourceReservation:   *sourceReservation,
+		TargetReservationID: targetReservation.ID,
+		TargetReservation:   *targetReservation,
+		MaxBodyBytes:        maxBodyBytes,
+	}
+	if err := s.db.WithContext(ctx).Omit("SourceReservation", "TargetReservation").Create(rule).Error; err != nil {
+		if isConstraintError(err, mirrorSourceIndex) || isConstraintError(err, "mirror_rule.source_reservation_id") {
+			return nil, ErrMirrorExists
+		}
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (s *MirrorService) Delete(ctx context.Context, teamID, id uint) error {
+	result := s.db.WithContext(ctx).
+		Where("id = ? AND team_id = ?", id, teamID).
+		Delete(&models.MirrorRule{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrMirrorNotFound
+	}
+	return nil
+}
+
+// Resolve returns the rule mirroring a subdomain, or nil when there is none.
+func (s *MirrorService) Resolve(ctx context.Context, subdomain string) (*ResolvedMirror, error) {
+	var rule models.MirrorRule
+	err := s.db.WithContext(ctx).
+		Preload("TargetReservation").
+		Joins("JOIN subdomain_reservation AS source ON source.id = mirror_rule.source_reservation_id").
+		Where("LOWER(source.subdomain) = ?", strings.ToLower(subdomain)).
+		First(&rule).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ResolvedMirror{
+		ID:           rule.ID,
+		Target:       strings.ToLower(rule.TargetReservation.Subdomain),
+		MaxBodyBytes: rule.MaxBodyBytes,
+	}, nil
+}
+
+// RecordDeliveries adds to a rule's delivery counts.
+func (s *MirrorService) RecordDeliveries(ctx context.Context, id uint, mirrored, failed int64) error {
+	return s.db.WithContext(ctx).Model(&models.MirrorRule{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"mirrored_count": gorm.Expr("mirrored_count + ?", mirrored),
+			"failed_count":   gorm.Expr("failed_count + ?", failed),
+		}).Error
+}
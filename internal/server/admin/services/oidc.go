@@ -0,0 +1,427 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	serverConfig "github.com/amalshaji/portr/internal/server/config"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrOIDCInvalidIDToken  = errors.New("invalid OpenID Connect ID token")
+	ErrOIDCUnverifiedEmail = errors.New("OpenID Connect provider returned no verified email")
+)
+
+const (
+	// oidcClockSkew is how far the provider's clock may be ahead of or
+	// behind the server's when checking ID token times.
+	oidcClockSkew = time.Minute
+	// oidcKeyRefreshInterval limits how often an ID token signed with an
+	// unknown key makes the provider's keys be fetched again.
+	oidcKeyRefreshInterval = time.Minute
+)
+
+// OIDCService signs users in with an OpenID Connect provider.
+type OIDCService struct {
+	issuer      string
+	config      *oauth2.Config
+	client      *http.Client
+	jwksURL     string
+	userInfoURL string
+
+	mu            sync.Mutex
+	keys          []oidcKey
+	keysFetchedAt time.Time
+}
+
+// OIDCIdentity is a user the provider vouched for.
+type OIDCIdentity struct {
+	Subject string
+	Email   string
+	Name    string
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+// DiscoverOIDC reads the discovery document of the configured issuer and
+// returns a client for it that redirects back to redirectURL.
+func DiscoverOIDC(ctx context.Context, cfg serverConfig.OIDCConfig, redirectURL string) (*OIDCService, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	var discovery oidcDiscovery
+	if err := getJSON(ctx, client, cfg.Issuer+"/.well-known/openid-configuration", "", &discovery); err != nil {
+		return nil, fmt.Errorf("failed to read OpenID Connect discovery document: %w", err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != cfg.Issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %q, not %q", discovery.Issuer, cfg.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("discovery document lacks the authorization, token or jwks endpoint")
+	}
+
+	return &OIDCService{
+		issuer: discovery.Issuer,
+		config: &oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       []string{"openid", "email", "profile"},
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  discovery.AuthorizationEndpoint,
+				TokenURL: discovery.TokenEndpoint,
+			},
+		},
+		client:      client,
+		jwksURL:     discovery.JWKSURI,
+		userInfoURL: discovery.UserInfoEndpoint,
+	}, nil
+}
+
+// GetAuthURL returns the provider's login page for a login with the given
+// state, nonce and PKCE verifier.
+func (s *OIDCService) GetAuthURL(state, nonce, verifier string) string {
+	return s.config.AuthCodeURL(state,
+		oauth2.SetAuthURLParam("nonce", nonce),
+		oauth2.S256ChallengeOption(verifier))
+}
+
+// Exchange redeems an authorization code and returns the identity in the ID
+// token it came with. The user's email must be verified by the provider.
+func (s *OIDCService) Exchange(ctx context.Context, code, nonce, verifier string) (*OIDCIdentity, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, s.client)
+	token, err := s.config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken == "" {
+		return nil, fmt.Errorf("%w: token response has no id_token", ErrOIDCInvalidIDToken)
+	}
+
+	claims, err := s.verifyIDToken(ctx, rawIDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+	// Providers may leave the email out of the ID token and serve it from
+	// the userinfo endpoint only.
+	if claims.Email == "" && s.userInfoURL != "" {
+		var userInfo oidcClaims
+		if err := getJSON(ctx, s.client, s.userInfoURL, token.AccessToken, &userInfo); err != nil {
+			return nil, fmt.Errorf("failed to read userinfo: %w", err)
+		}
+		if userInfo.Subject != claims.Subject {
+			return nil, fmt.Errorf("%w: userinfo is for another subject", ErrOIDCInvalidIDToken)
+		}
+		claims.Email, claims.EmailVerified = userInfo.Email, userInfo.EmailVerified
+		if claims.Name == "" {
+			claims.Name = userInfo.Name
+		}
+	}
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, ErrOIDCUnverifiedEmail
+	}
+
+	return &OIDCIdentity{Subject: claims.Subject, Email: claims.Email, Name: claims.Name}, nil
+}
+
+type oidcClaims struct {
+	Issuer          string       `json:"iss"`
+	Subject         string       `json:"sub"`
+	Audience        oidcAudience `json:"aud"`
+	AuthorizedParty string       `json:"azp"`
+	Expiry          float64      `json:"exp"`
+	IssuedAt        float64      `json:"iat"`
+	Nonce           string       `json:"nonce"`
+	Email           string       `json:"email"`
+	EmailVerified   oidcBool     `json:"email_verified"`
+	Name            string       `json:"name"`
+}
+
+// oidcAudience is an aud claim, which may be a string or a list of them.
+type oidcAudience []string
+
+func (a *oidcAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = oidcAudience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// oidcBool is a boolean claim, which some providers send as a string.
+type oidcBool bool
+
+func (b *oidcBool) UnmarshalJSON(data []byte) error {
+	var value bool
+	if err := json.Unmarshal(data, &value); err == nil {
+		*b = oidcBool(value)
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	*b = oidcBool(text == "true")
+	return nil
+}
+
+// verifyIDToken checks the signature, issuer, audience, lifetime and nonce of
+// an ID token and returns its claims.
+func (s *OIDCService) verifyIDToken(ctx context.Context, rawIDToken, nonce string) (*oidcClaims, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrOIDCInvalidIDToken)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrOIDCInvalidIDToken)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrOIDCInvalidIDToken)
+	}
+	if err := s.verifySignature(ctx, header.Alg, header.Kid, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims oidcClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims", ErrOIDCInvalidIDToken)
+	}
+	now := time.Now()
+	switch {
+	case claims.Issuer != s.issuer:
+		return nil, fmt.Errorf("%w: issued by %q", ErrOIDCInvalidIDToken, claims.Issuer)
+	case !claims.Audience.contains(s.config.ClientID):
+		return nil, fmt.Errorf("%w: issued for another client", ErrOIDCInvalidIDToken)
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != "" && claims.AuthorizedParty != s.config.ClientID:
+		return nil, fmt.Errorf("%w: authorized for another client", ErrOIDCInvalidIDToken)
+	case claims.Expiry == 0 || now.After(unixTime(claims.Expiry).Add(oidcClockSkew)):
+		return nil, fmt.Errorf("%w: expired", ErrOIDCInvalidIDToken)
+	case claims.IssuedAt != 0 && unixTime(claims.IssuedAt).After(now.Add(oidcClockSkew)):
+		return nil, fmt.Errorf("%w: issued in the future", ErrOIDCInvalidIDToken)
+	case claims.Nonce != nonce:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrOIDCInvalidIDToken)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: no subject", ErrOIDCInvalidIDToken)
+	}
+	return &claims, nil
+}
+
+func (a oidcAudience) contains(clientID string) bool {
+	for _, audience := range a {
+		if audience == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+func unixTime(seconds float64) time.Time {
+	return time.Unix(int64(seconds), 0)
+}
+
+// oidcAlgorithms are the ID token signature algorithms accepted, by name.
+var oidcAlgorithms = map[string]struct {
+	hash crypto.Hash
+	ec   bool
+}{
+	"RS256": {crypto.SHA256, false},
+	"RS384": {crypto.SHA384, false},
+	"RS512": {crypto.SHA512, false},
+	"ES256": {crypto.SHA256, true},
+	"ES384": {crypto.SHA384, true},
+	"ES512": {crypto.SHA512, true},
+}
+
+func (s *OIDCService) verifySignature(ctx context.Context, alg, kid, signed string, signature []byte) error {
+	algorithm, ok := oidcAlgorithms[alg]
+	if !ok {
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrOIDCInvalidIDToken, alg)
+	}
+	digest := algorithm.hash.New()
+	digest.Write([]byte(signed))
+	sum := digest.Sum(nil)
+
+	keys, err := s.signingKeys(ctx, kid)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		switch publicKey := key.key.(type) {
+		case *rsa.PublicKey:
+			if !algorithm.ec && rsa.VerifyPKCS1v15(publicKey, algorithm.hash, sum, signature) == nil {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			size := (publicKey.Curve.Params().BitSize + 7) / 8
+			if algorithm.ec && len(signature) == 2*size {
+				r := new(big.Int).SetBytes(signature[:size])
+				sig := new(big.Int).SetBytes(signature[size:])
+				if ecdsa.Verify(publicKey, sum, r, sig) {
+					return nil
+				}
+			}
+		}
+	}
+	return fmt.Errorf("%w: bad signature", ErrOIDCInvalidIDToken)
+}
+
+type oidcKey struct {
+	id  string
+	key crypto.PublicKey
+}
+
+// signingKeys returns the provider's keys with the given id, or all of them
+// when the token names none. Keys are fetched again when the id is unknown,
+// as the provider may have rotated them.
+func (s *OIDCService) signingKeys(ctx context.Context, kid string) ([]oidcKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	matching := matchingKeys(s.keys, kid)
+	if len(matching) != 0 || time.Since(s.keysFetchedAt) < oidcKeyRefreshInterval {
+		return matching, nil
+	}
+	keys, err := fetchOIDCKeys(ctx, s.client, s.jwksURL)
+	if err != nil {
+		return nil, err
+	}
+	s.keys, s.keysFetchedAt = keys, time.Now()
+	return matchingKeys(keys, kid), nil
+}
+
+func matchingKeys(keys []oidcKey, kid string) []oidcKey {
+	if kid == "" {
+		return keys
+	}
+	for _, key := range keys {
+		if key.id == kid {
+			return []oidcKey{key}
+		}
+	}
+	return nil
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+var oidcCurves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+// fetchOIDCKeys reads the provider's signing keys. Keys of unsupported types
+// are skipped.
+func fetchOIDCKeys(ctx context.Context, client *http.Client, jwksURL string) ([]oidcKey, error) {
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, client, jwksURL, "", &jwks); err != nil {
+		return nil, fmt.Errorf("failed to read OpenID Connect signing keys: %w", err)
+	}
+
+	keys := make([]oidcKey, 0, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch jwk.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+			if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+				continue
+			}
+			exponent := int(new(big.Int).SetBytes(e).Int64())
+			keys = append(keys, oidcKey{id: jwk.Kid, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}})
+		case "EC":
+			curve, ok := oidcCurves[jwk.Crv]
+			if !ok {
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+			y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+			size := (curve.Params().BitSize + 7) / 8
+			if errX != nil || errY != nil || len(x) != size || len(y) != size {
+				continue
+			}
+			point := append(append([]byte{4}, x...), y...)
+			publicKey, err := ecdsa.ParseUncompressedPublicKey(curve, point)
+			if err != nil {
+				continue
+			}
+			keys = append(keys, oidcKey{id: jwk.Kid, key: publicKey})
+		}
+	}
+	return keys, nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// getJSON fetches url, with accessToken as a bearer token if set, and decodes
+// its JSON body into v.
+func getJSON(ctx context.Context, client *http.Client, url, accessToken string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
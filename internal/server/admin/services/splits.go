@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSplitSubdomains = errors.New("split subdomains must be distinct")
+	ErrSplitWeight     = errors.New("split weight must be between 0 and 100")
+	ErrSplitExists     = errors.New("subdomain is already split")
+	ErrSplitNotFound   = errors.New("split route not found")
+)
+
+const splitReservationIndex = "idx_split_route_reservation_unique"
+
+type SplitService struct {
+	db *gorm.DB
+}
+
+func NewSplitService(db *gorm.DB) *SplitService {
+	return &SplitService{db: db}
+}
+
+// ResolvedSplit is what the proxy needs to split a subdomain's traffic.
+type ResolvedSplit struct {
+	ID            uint
+	Primary       string
+	Secondary     string
+	PrimaryWeight int
+	Sticky        bool
+}
+
+func (s *SplitService) List(ctx context.Context, teamID uint) ([]models.SplitRoute, error) {
+	routes := []models.SplitRoute{}
+	err := s.preloaded(ctx).
+		Where("team_id = ?", teamID).
+		Order("created_at DESC").
+		Find(&routes).Error
+	return routes, err
+}
+
+// Create splits subdomain between primary and secondary. All three must be
+// reserved by members of the team, so a split can neither take over another
+// team's name nor send its visitors to another team's tunnel.
+func (s *SplitService) Create(ctx context.Context, teamID uint, subdomain, primary, secondary string, primaryWeight int, sticky bool) (*models.SplitRoute, error) {
+	if primaryWeight < 0 || primaryWeight > 100 {
+		return nil, ErrSplitWeight
+	}
+	names := []string{subdomain, primary, secondary}
+	for index := range names {
+		names[index] = strings.ToLower(strings.TrimSpace(names[index]))
+	}
+	if names[0] == names[1] || names[0] == names[2] || names[1] == names[2] {
+		return nil, ErrSplitSubdomains
+	}
+
+	reservations := make([]*models.SubdomainReservation, len(names))
+	for index, name := range names {
+		reservation, err := findTeamReservation(ctx, s.db, teamID, name)
+		if err != nil {
+			return nil, err
+		}
+		reservations[index] = reservation
+	}
+
+	route := &models.SplitRoute{
+		TeamID:                 teamID,
+		ReservationID:          reservations[0].ID,
+		PrimaryReservationID:   reservations[1].ID,
+		SecondaryReservationID: reservations[2].ID,
+		PrimaryWeight:          primaryWeight,
+		Sticky:                 sticky,
+	}
+	if err := s.db.WithContext(ctx).Create(route).Error; err != nil {
+		if isConstraintError(err, splitReservationIndex) || isConstraintError(err, "split_route.reservation_id") {
+			return nil, ErrSplitExists
+		}
+		return nil, err
+	}
+	route.Reservation = *reservations[0]
+	route.PrimaryReservation = *reservations[1]
+	route.SecondaryReservation = *reservations[2]
+	return route, nil
+}
+
+// Update changes a route's weight or stickiness; nil leaves a field as is.
+func (s *SplitService) Update(ctx context.Context, teamID, id uint, primaryWeight *int, sticky *bool) (*models.SplitRoute, error) {
+	if primaryWeight != nil && (*primaryWeight < 0 || *primaryWeight > 100) {
+		return nil, ErrSplitWeight
+	}
+	var route models.SplitRoute
+	if err := s.preloaded(ctx).Where("id = ? AND team_id = ?", id, teamID).First(&route).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSplitNotFound
+		}
+		return nil, err
+	}
+	updates := map[string]any{}
+	if primaryWeight != nil {
+		route.PrimaryWeight = *primaryWeight
+		updates["primary_weight"] = *primaryWeight
+	}
+	if sticky != nil {
+		route.Sticky = *sticky
+		updates["sticky"] = *sticky
+	}
+	if len(updates) == 0 {
+		return &route, nil
+	}
+	if err := s.db.WithContext(ctx).Model(&route).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return &route, nil
+}
+
+func (s *SplitService) Delete(ctx context.Context, teamID, id uint) error {
+	result := s.db.WithContext(ctx).
+		Where("id = ? AND team_id = ?", id, teamID).
+		Delete(&models.SplitRoute{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSplitNotFound
+	}
+	return nil
+}
+
+// Resolve returns every split route, keyed by the lowercased subdomain it
+// splits. The proxy loads them all at once, so unknown subdomains never cost
+// a query.
+func (s *SplitService) Resolve(ctx context.Context) (map[string]ResolvedSplit, error) {
+	var routes []models.SplitRoute
+	if err := s.preloaded(ctx).Find(&routes).Error; err != nil {
+		return nil, err
+	}
+	resolved := make(map[string]ResolvedSplit, len(routes))
+	for _, route := range routes {
+		resolved[strings.ToLower(route.Reservation.Subdomain)] = ResolvedSplit{
+			ID:            route.ID,
+			Primary:       strings.ToLower(route.PrimaryReservation.Subdomain),
+			Secondary:     strings.ToLower(route.SecondaryReservation.Subdomain),
+			PrimaryWeight: route.PrimaryWeight,
+			Sticky:        route.Sticky,
+		}
+	}
+	return resolved, nil
+}
+
+func (s *SplitService) preloaded(ctx context.Context) *gorm.DB {
+	return s.db.WithContext(ctx).
+		Preload("Reservation").
+		Preload("PrimaryReservation").
+		Preload("SecondaryReservation")
+}
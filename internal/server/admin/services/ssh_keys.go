@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	gossh "golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidSshKey  = errors.New("invalid ssh public key")
+	ErrSshKeyExists   = errors.New("ssh key already registered")
+	ErrSshKeyNotFound = errors.New("ssh key not found")
+)
+
+const sshKeyFingerprintIndex = "idx_ssh_key_fingerprint_unique"
+
+type SshKeyService struct {
+	db *gorm.DB
+}
+
+func NewSshKeyService(db *gorm.DB) *SshKeyService {
+	return &SshKeyService{db: db}
+}
+
+func (s *SshKeyService) List(ctx context.Context, teamUserID uint) ([]models.SshKey, error) {
+	keys := []models.SshKey{}
+	err := s.db.WithContext(ctx).
+		Where("team_user_id = ?", teamUserID).
+		Order("created_at DESC").
+		Find(&keys).Error
+	return keys, err
+}
+
+// Add registers an authorized_keys style public key for the team user. The
+// key's comment is used as its name when name is empty.
+func (s *SshKeyService) Add(ctx context.Context, teamUserID uint, name, authorizedKey string) (*models.SshKey, error) {
+	publicKey, comment, _, _, err := gossh.ParseAuthorizedKey([]byte(strings.TrimSpace(authorizedKey)))
+	if err != nil {
+		return nil, ErrInvalidSshKey
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = comment
+	}
+	if name == "" {
+		name = publicKey.Type()
+	}
+
+	key := &models.SshKey{
+		TeamUserID:  teamUserID,
+		Name:        name,
+		PublicKey:   strings.TrimSpace(string(gossh.MarshalAuthorizedKey(publicKey))),
+		Fingerprint: gossh.FingerprintSHA256(publicKey),
+	}
+	if err := s.db.WithContext(ctx).Create(key).Error; err != nil {
+		if isConstraintError(err, sshKeyFingerprintIndex) || isConstraintError(err, "ssh_key.fingerprint") {
+			return nil, ErrSshKeyExists
+		}
+		return nil, err
+	}
+	return key, nil
+}
+
+func (s *SshKeyService) Delete(ctx context.Context, teamUserID, id uint) error {
+	result := s.db.WithContext(ctx).
+		Where("id = ? AND team_user_id = ?", id, teamUserID).
+		Delete(&models.SshKey{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSshKeyNotFound
+	}
+	return nil
+}
@@ -21,6 +21,7 @@ var (
 	ErrReservationLimit       = errors.New("reservation limit reached")
 	ErrReservationNotFound    = errors.New("reservation not found")
 	ErrReservationUnavailable = errors.New("reservation service is busy")
+	ErrNotTeamReservation     = errors.New("reservation is not owned by the team")
 )
 
 const transactionAttempts = 3
@@ -40,6 +41,9 @@ var sqliteSubdomainTransactions sync.Mutex
 type ReservedSubdomain struct {
 	Reservation models.SubdomainReservation
 	ClaimStatus SubdomainClaimStatus
+	// AllowedMembers are the emails of the members allowed to claim a team
+	// reservation besides those who manage the team.
+	AllowedMembers []string
 }
 
 type SubdomainService struct {
@@ -50,14 +54,30 @@ func NewSubdomainService(db *gorm.DB) *SubdomainService {
 	return &SubdomainService{db: db}
 }
 
-func (s *SubdomainService) List(ctx context.Context, teamUserID uint) ([]ReservedSubdomain, error) {
-	var reservations []models.SubdomainReservation
+// List returns the team user's own reservations and the team reservations
+// they may claim, or all of the team's reservations for those who manage
+// the team.
+func (s *SubdomainService) List(ctx context.Context, teamUser *models.TeamUser) ([]ReservedSubdomain, error) {
+	var candidates []models.SubdomainReservation
 	if err := s.db.WithContext(ctx).
-		Where("team_user_id = ?", teamUserID).
+		Preload("Members.TeamUser.User").
+		Where("team_user_id = ? OR (team_id = ? AND team_user_id IS NULL)", teamUser.ID, teamUser.TeamID).
 		Order("created_at DESC").
-		Find(&reservations).Error; err != nil {
+		Find(&candidates).Error; err != nil {
 		return nil, err
 	}
+	reservations := make([]models.SubdomainReservation, 0, len(candidates))
+	for _, reservation := range candidates {
+		if reservation.AllowsClaim(teamUser) || teamUser.CanManageTeam() {
+			reservations = append(reservations, reservation)
+		}
+	}
+	return s.withClaimStatuses(ctx, reservations)
+}
+
+// withClaimStatuses pairs each reservation with how its subdomain is being
+// used, in one query.
+func (s *SubdomainService) withClaimStatuses(ctx context.Context, reservations []models.SubdomainReservation) ([]ReservedSubdomain, error) {
 	if len(reservations) == 0 {
 		return []ReservedSubdomain{}, nil
 	}
@@ -92,13 +112,29 @@ func (s *SubdomainService) List(ctx context.Context, teamUserID uint) ([]Reserve
 		if status == "" {
 			status = SubdomainClaimIdle
 		}
-		items = append(items, ReservedSubdomain{Reservation: reservation, ClaimStatus: status})
+		items = append(items, ReservedSubdomain{
+			Reservation:    reservation,
+			ClaimStatus:    status,
+			AllowedMembers: allowedMembers(reservation),
+		})
 	}
 
 	return items, nil
 }
 
+// Reserve reserves a subdomain for the team user, within their limit.
 func (s *SubdomainService) Reserve(ctx context.Context, teamUserID uint, subdomain string, limit int) (*ReservedSubdomain, error) {
+	return s.reserve(ctx, teamUserID, subdomain, limit, false)
+}
+
+// ReserveForTeam reserves a subdomain for the team user's team. Only those
+// who manage the team may claim it until members are allowed to. It does not
+// count towards anyone's limit.
+func (s *SubdomainService) ReserveForTeam(ctx context.Context, teamUserID uint, subdomain string) (*ReservedSubdomain, error) {
+	return s.reserve(ctx, teamUserID, subdomain, 0, true)
+}
+
+func (s *SubdomainService) reserve(ctx context.Context, teamUserID uint, subdomain string, limit int, forTeam bool) (*ReservedSubdomain, error) {
 	reservation := &ReservedSubdomain{ClaimStatus: SubdomainClaimIdle}
 	err := withSubdomainRetry(ctx, s.db, func(tx *gorm.DB) error {
 		reservation.ClaimStatus = SubdomainClaimIdle
@@ -114,7 +150,9 @@ func (s *SubdomainService) Reserve(ctx context.Context, teamUserID uint, subdoma
 		var existing models.SubdomainReservation
 		err := tx.WithContext(ctx).Where("LOWER(subdomain) = ?", subdomain).First(&existing).Error
 		switch {
-		case err == nil && existing.TeamUserID == teamUserID:
+		case err == nil && forTeam && existing.TeamOwned() && existing.TeamID == teamUser.TeamID:
+			return ErrReservationExists
+		case err == nil && !forTeam && !existing.TeamOwned() && *existing.TeamUserID == teamUserID:
 			return ErrReservationExists
 		case err == nil:
 			return ErrSubdomainUnavailable
@@ -127,7 +165,9 @@ func (s *SubdomainService) Reserve(ctx context.Context, teamUserID uint, subdoma
 			Where("LOWER(subdomain) = ? AND status IN (?, ?)", subdomain, models.ConnectionStatusReserved, models.ConnectionStatusActive).
 			First(&openConnection).Error
 		switch {
-		case err == nil && openConnection.CreatedByID != teamUserID:
+		case err == nil && forTeam && openConnection.TeamID != teamUser.TeamID:
+			return ErrSubdomainUnavailable
+		case err == nil && !forTeam && openConnection.CreatedByID != teamUserID:
 			return ErrSubdomainUnavailable
 		case err == nil:
 			reservation.ClaimStatus = claimStatusForConnection(openConnection.Status)
@@ -135,17 +175,14 @@ func (s *SubdomainService) Reserve(ctx context.Context, teamUserID uint, subdoma
 			return err
 		}
 
-		var count int64
-		if err := tx.WithContext(ctx).Model(&models.SubdomainReservation{}).
-			Where("team_user_id = ?", teamUserID).
-			Count(&count).Error; err != nil {
-			return err
-		}
-		if limit == 0 || count >= int64(limit) {
-			return ErrReservationLimit
+		created := models.SubdomainReservation{Subdomain: subdomain, TeamID: teamUser.TeamID}
+		if !forTeam {
+			if err := checkReservationLimit(tx.WithContext(ctx), teamUserID, limit); err != nil {
+				return err
+			}
+			created.TeamUserID = &teamUserID
 		}
 
-		created := models.SubdomainReservation{Subdomain: subdomain, TeamUserID: teamUserID}
 		if err := tx.WithContext(ctx).Create(&created).Error; err != nil {
 			return err
 		}
@@ -161,19 +198,267 @@ func (s *SubdomainService) Reserve(ctx context.Context, teamUserID uint, subdoma
 	return reservation, nil
 }
 
-func (s *SubdomainService) Release(ctx context.Context, teamUserID uint, subdomain string) error {
-	result := s.db.WithContext(ctx).
-		Where("team_user_id = ? AND LOWER(subdomain) = ?", teamUserID, subdomain).
-		Delete(&models.SubdomainReservation{})
-	if result.Error != nil {
-		return result.Error
+// checkReservationLimit returns ErrReservationLimit when the team user holds
+// as many reservations as limit allows.
+func checkReservationLimit(tx *gorm.DB, teamUserID uint, limit int) error {
+	var count int64
+	if err := tx.Model(&models.SubdomainReservation{}).
+		Where("team_user_id = ?", teamUserID).
+		Count(&count).Error; err != nil {
+		return err
 	}
-	if result.RowsAffected == 0 {
-		return ErrReservationNotFound
+	if limit == 0 || count >= int64(limit) {
+		return ErrReservationLimit
 	}
 	return nil
 }
 
+// Release deletes the team user's own reservation of a subdomain, or the
+// team's reservation of it when the team user manages the team.
+func (s *SubdomainService) Release(ctx context.Context, teamUser *models.TeamUser, subdomain string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("LOWER(subdomain) = ? AND team_user_id = ?", subdomain, teamUser.ID)
+		if teamUser.CanManageTeam() {
+			query = tx.Where("LOWER(subdomain) = ? AND (team_user_id = ? OR (team_id = ? AND team_user_id IS NULL))", subdomain, teamUser.ID, teamUser.TeamID)
+		}
+		var reservation models.SubdomainReservation
+		err := query.First(&reservation).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrReservationNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("reservation_id = ?", reservation.ID).Delete(&models.SubdomainReservationMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&reservation).Error
+	})
+}
+
+// Transfer moves a reservation of the team to another member, or to the
+// team itself when toTeamUserID is nil, and returns it as it was before and
+// is now. A member's reservation moved to the team keeps them allowed to
+// claim it. Moving it to a member drops its allowed list, which only team
+// reservations have, and counts towards their limit like Reserve.
+func (s *SubdomainService) Transfer(ctx context.Context, teamID uint, subdomain string, toTeamUserID *uint, limit int) (*models.SubdomainReservation, *ReservedSubdomain, error) {
+	var before models.SubdomainReservation
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Preload("TeamUser.User").
+			Where("team_id = ? AND LOWER(subdomain) = ?", teamID, subdomain).
+			First(&before).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrReservationNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if toTeamUserID != nil {
+			if err := requireTeamMembers(tx, teamID, []uint{*toTeamUserID}); err != nil {
+				return err
+			}
+			if before.TeamUserID == nil || *before.TeamUserID != *toTeamUserID {
+				// Lock the member as Reserve does, so concurrent
+				// reservations cannot both pass the limit.
+				if tx.Dialector.Name() == "postgres" {
+					if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.TeamUser{}, *toTeamUserID).Error; err != nil {
+						return err
+					}
+				}
+				if err := checkReservationLimit(tx, *toTeamUserID, limit); err != nil {
+					return err
+				}
+			}
+			if err := tx.Where("reservation_id = ?", before.ID).Delete(&models.SubdomainReservationMember{}).Error; err != nil {
+				return err
+			}
+		} else if before.TeamUserID != nil {
+			member := models.SubdomainReservationMember{ReservationID: before.ID, TeamUserID: *before.TeamUserID}
+			if err := tx.Create(&member).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.SubdomainReservation{}).
+			Where("id = ?", before.ID).
+			Update("team_user_id", toTeamUserID).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	after, err := s.get(ctx, before.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &before, after, nil
+}
+
+// SetAllowedMembers replaces the members allowed to claim a team
+// reservation besides those who manage the team.
+func (s *SubdomainService) SetAllowedMembers(ctx context.Context, teamID uint, subdomain string, teamUserIDs []uint) (*ReservedSubdomain, error) {
+	var reservation models.SubdomainReservation
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("team_id = ? AND LOWER(subdomain) = ?", teamID, subdomain).First(&reservation).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrReservationNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if !reservation.TeamOwned() {
+			return ErrNotTeamReservation
+		}
+		if err := requireTeamMembers(tx, teamID, teamUserIDs); err != nil {
+			return err
+		}
+		if err := tx.Where("reservation_id = ?", reservation.ID).Delete(&models.SubdomainReservationMember{}).Error; err != nil {
+			return err
+		}
+		seen := make(map[uint]bool, len(teamUserIDs))
+		for _, teamUserID := range teamUserIDs {
+			if seen[teamUserID] {
+				continue
+			}
+			seen[teamUserID] = true
+			member := models.SubdomainReservationMember{ReservationID: reservation.ID, TeamUserID: teamUserID}
+			if err := tx.Create(&member).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.get(ctx, reservation.ID)
+}
+
+// get loads a reservation with its owner, allowed members and claim status.
+func (s *SubdomainService) get(ctx context.Context, id uint) (*ReservedSubdomain, error) {
+	var reservation models.SubdomainReservation
+	if err := s.db.WithContext(ctx).
+		Preload("TeamUser.User").
+		Preload("Members.TeamUser.User").
+		First(&reservation, id).Error; err != nil {
+		return nil, err
+	}
+	items, err := s.withClaimStatuses(ctx, []models.SubdomainReservation{reservation})
+	if err != nil {
+		return nil, err
+	}
+	return &items[0], nil
+}
+
+// requireTeamMembers returns ErrTeamUserNotFound unless every ID is a team
+// user of the team.
+func requireTeamMembers(tx *gorm.DB, teamID uint, teamUserIDs []uint) error {
+	if len(teamUserIDs) == 0 {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(&models.TeamUser{}).
+		Where("team_id = ? AND id IN ?", teamID, teamUserIDs).
+		Distinct("id").
+		Count(&count).Error; err != nil {
+		return err
+	}
+	distinct := make(map[uint]bool, len(teamUserIDs))
+	for _, id := range teamUserIDs {
+		distinct[id] = true
+	}
+	if count != int64(len(distinct)) {
+		return ErrTeamUserNotFound
+	}
+	return nil
+}
+
+// allowedMembers returns the emails of the members on a team reservation's
+// allowed list, in the order they were added.
+func allowedMembers(reservation models.SubdomainReservation) []string {
+	emails := make([]string, 0, len(reservation.Members))
+	for _, member := range reservation.Members {
+		emails = append(emails, member.TeamUser.User.Email)
+	}
+	return emails
+}
+
+// findTeamReservation returns the reservation of a subdomain held by the
+// team or any of its members.
+func findTeamReservation(ctx context.Context, db *gorm.DB, teamID uint, subdomain string) (*models.SubdomainReservation, error) {
+	var reservation models.SubdomainReservation
+	err := db.WithContext(ctx).
+		Where("team_id = ? AND LOWER(subdomain) = ?", teamID, subdomain).
+		First(&reservation).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrReservationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &reservation, nil
+}
+
+// subdomainOwner is the team a subdomain's visitors are dealing with.
+type subdomainOwner struct {
+	TeamID        uint
+	ReservationID *uint
+	// Email is empty for a team reservation nobody has tunneled on yet.
+	Email string
+	// LastSeen is when a tunnel on the subdomain last closed, or started if
+	// it is still open. Nil when the subdomain never had one.
+	LastSeen *time.Time
+}
+
+// findSubdomainOwner returns the team that reserved the subdomain, else the
+// team that last tunneled on it, or nil when neither did.
+func findSubdomainOwner(ctx context.Context, db *gorm.DB, subdomain string) (*subdomainOwner, error) {
+	owner := &subdomainOwner{}
+
+	var reservation models.SubdomainReservation
+	err := db.WithContext(ctx).
+		Preload("TeamUser.User").
+		Where("LOWER(subdomain) = ?", subdomain).
+		First(&reservation).Error
+	switch {
+	case err == nil:
+		owner.TeamID = reservation.TeamID
+		owner.ReservationID = &reservation.ID
+		if reservation.TeamUser != nil {
+			owner.Email = reservation.TeamUser.User.Email
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+
+	var connection models.Connection
+	err = db.WithContext(ctx).
+		Preload("CreatedBy.User").
+		Where("LOWER(subdomain) = ?", subdomain).
+		Order("created_at DESC").
+		First(&connection).Error
+	switch {
+	case err == nil:
+		if connection.ClosedAt != nil {
+			owner.LastSeen = connection.ClosedAt
+		} else {
+			owner.LastSeen = connection.StartedAt
+		}
+		if owner.TeamID == 0 {
+			owner.TeamID = connection.TeamID
+		}
+		// A team reservation is presented as the member who last
+		// tunneled on it.
+		if owner.Email == "" && connection.TeamID == owner.TeamID {
+			owner.Email = connection.CreatedBy.User.Email
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+	if owner.TeamID == 0 {
+		return nil, nil
+	}
+	return owner, nil
+}
+
 func withSubdomainRetry(ctx context.Context, db *gorm.DB, operation func(*gorm.DB) error) error {
 	if db.Dialector.Name() == "sqlite" {
 		sqliteSubdomainTransactions.Lock()
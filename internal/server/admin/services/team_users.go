@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"strings"
+	"time"
 
 	"github.com/amalshaji/portr/internal/server/admin/models"
 	"gorm.io/gorm"
@@ -17,6 +18,9 @@ var (
 	ErrAdminAccessRequired     = errors.New("admin access required")
 	ErrSuperuserAccessRequired = errors.New("superuser access required")
 	ErrUserAlreadyInTeam       = errors.New("user is already in team")
+	ErrLastTeamAdmin           = errors.New("team must keep at least one admin")
+	ErrOnlyTeam                = errors.New("cannot leave your only team")
+	ErrTransferToSelf          = errors.New("cannot transfer admin to yourself")
 )
 
 type TeamUserService struct {
@@ -35,6 +39,14 @@ type InviteUserResult struct {
 	Password string
 }
 
+// RemovedTeamUser is a team user removed from their team.
+type RemovedTeamUser struct {
+	TeamUser models.TeamUser
+	// UserDeleted is whether the user was deleted for being in no other
+	// team.
+	UserDeleted bool
+}
+
 func NewTeamUserService(db *gorm.DB) *TeamUserService {
 	return &TeamUserService{db: db}
 }
@@ -177,3 +189,213 @@ func findOrCreateInvitedUser(tx *gorm.DB, input InviteUserInput, autoSignupEnabl
 	}
 	return &user, "", nil
 }
+
+// ChangeRole changes the role of a member of the actor's team, returning the
+// member as they were before the change. Only superusers may change the role
+// of a superuser, and the team's last admin may not be demoted.
+func (s *TeamUserService) ChangeRole(ctx context.Context, actor *models.TeamUser, teamUserID uint, role string) (*models.TeamUser, error) {
+	role = strings.TrimSpace(role)
+	if !models.IsValidTeamRole(role) {
+		return nil, ErrInvalidRole
+	}
+
+	var target models.TeamUser
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockTeam(tx, actor.TeamID, &models.Team{}); err != nil {
+			return err
+		}
+		if err := findTeamUser(tx, actor.TeamID, teamUserID, &target); err != nil {
+			return err
+		}
+		if target.User.IsSuperuser && !actor.User.IsSuperuser {
+			return ErrSuperuserAccessRequired
+		}
+		if target.Role == role {
+			return nil
+		}
+		if target.IsAdmin() {
+			if err := ensureOtherAdmin(tx, target); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.TeamUser{}).Where("id = ?", target.ID).Update("role", role).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+// TransferAdmin makes a member of the actor's team an admin and the actor a
+// member, returning the new admin.
+func (s *TeamUserService) TransferAdmin(ctx context.Context, actor *models.TeamUser, teamUserID uint) (*models.TeamUser, error) {
+	if actor.ID == teamUserID {
+		return nil, ErrTransferToSelf
+	}
+
+	var target models.TeamUser
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockTeam(tx, actor.TeamID, &models.Team{}); err != nil {
+			return err
+		}
+		if err := findTeamUser(tx, actor.TeamID, teamUserID, &target); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.TeamUser{}).Where("id = ?", target.ID).Update("role", models.RoleAdmin).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.TeamUser{}).Where("id = ?", actor.ID).Update("role", models.RoleMember).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+// Remove removes a member from the actor's team. Only superusers may remove
+// a superuser, and the team's last admin may not be removed.
+func (s *TeamUserService) Remove(ctx context.Context, actor *models.TeamUser, teamUserID uint) (*RemovedTeamUser, error) {
+	removed := &RemovedTeamUser{}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockTeam(tx, actor.TeamID, &models.Team{}); err != nil {
+			return err
+		}
+		if err := findTeamUser(tx, actor.TeamID, teamUserID, &removed.TeamUser); err != nil {
+			return err
+		}
+		if removed.TeamUser.User.IsSuperuser && !actor.User.IsSuperuser {
+			return ErrSuperuserAccessRequired
+		}
+		if removed.TeamUser.IsAdmin() {
+			if err := ensureOtherAdmin(tx, removed.TeamUser); err != nil {
+				return err
+			}
+		}
+		userDeleted, err := removeTeamUser(tx, &removed.TeamUser, true)
+		removed.UserDeleted = userDeleted
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+// Leave removes a team user from their own team. Users may not leave their
+// only team, nor a team they are the last admin of.
+func (s *TeamUserService) Leave(ctx context.Context, teamUser *models.TeamUser) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockTeam(tx, teamUser.TeamID, &models.Team{}); err != nil {
+			return err
+		}
+		var member models.TeamUser
+		if err := findTeamUser(tx, teamUser.TeamID, teamUser.ID, &member); err != nil {
+			return err
+		}
+		var otherTeams int64
+		if err := tx.Model(&models.TeamUser{}).Where("user_id = ? AND id <> ?", member.UserID, member.ID).Count(&otherTeams).Error; err != nil {
+			return err
+		}
+		if otherTeams == 0 {
+			return ErrOnlyTeam
+		}
+		if member.IsAdmin() {
+			if err := ensureOtherAdmin(tx, member); err != nil {
+				return err
+			}
+		}
+		_, err := removeTeamUser(tx, &member, false)
+		return err
+	})
+}
+
+func findTeamUser(tx *gorm.DB, teamID, teamUserID uint, teamUser *models.TeamUser) error {
+	err := tx.Preload("User").Where("id = ? AND team_id = ?", teamUserID, teamID).First(teamUser).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrTeamUserNotFound
+	}
+	return err
+}
+
+// ensureOtherAdmin returns ErrLastTeamAdmin unless the team has an admin
+// besides the given team user.
+func ensureOtherAdmin(tx *gorm.DB, teamUser models.TeamUser) error {
+	var admins int64
+	err := tx.Model(&models.TeamUser{}).
+		Where("team_id = ? AND role = ? AND id <> ?", teamUser.TeamID, models.RoleAdmin, teamUser.ID).
+		Count(&admins).Error
+	if err != nil {
+		return err
+	}
+	if admins == 0 {
+		return ErrLastTeamAdmin
+	}
+	return nil
+}
+
+// removeTeamUser deletes a team user along with their reservations, places
+// on team reservations' allowed lists, SSH keys, API tokens, device keys and
+// tunnel credentials, and closes their tunnels. Team reservations stay with
+// the team. If deleteOrphan is set, the user is deleted too when they are in
+// no other team; it reports whether they were.
+//
+// The server's sqlite database does not enforce foreign keys, so rows that
+// belong to a team user or team are deleted explicitly rather than by
+// cascade, here and when a team is deleted.
+func removeTeamUser(tx *gorm.DB, teamUser *models.TeamUser, deleteOrphan bool) (bool, error) {
+	err := tx.Model(&models.Connection{}).
+		Where("created_by_id = ? AND status IN ?", teamUser.ID, []string{models.ConnectionStatusReserved, models.ConnectionStatusActive}).
+		Updates(map[string]any{
+			"status":       models.ConnectionStatusClosed,
+			"closed_at":    time.Now().UTC(),
+			"close_reason": models.ConnectionCloseReasonMemberRemoved,
+		}).Error
+	if err != nil {
+		return false, err
+	}
+
+	reservations := tx.Model(&models.SubdomainReservation{}).Select("id").Where("team_user_id = ?", teamUser.ID)
+	if err := tx.Where("reservation_id IN (?)", reservations).Delete(&models.ErrorPage{}).Error; err != nil {
+		return false, err
+	}
+	if err := tx.Where("source_reservation_id IN (?) OR target_reservation_id IN (?)", reservations, reservations).Delete(&models.MirrorRule{}).Error; err != nil {
+		return false, err
+	}
+	if err := tx.Where("reservation_id IN (?) OR primary_reservation_id IN (?) OR secondary_reservation_id IN (?)", reservations, reservations, reservations).Delete(&models.SplitRoute{}).Error; err != nil {
+		return false, err
+	}
+	for _, model := range []any{
+		&models.SubdomainReservation{},
+		&models.SubdomainReservationMember{},
+		&models.SshKey{},
+		&models.TunnelCredential{},
+		&models.APIToken{},
+		&models.DeviceKey{},
+		&models.BandwidthUsage{},
+	} {
+		if err := tx.Where("team_user_id = ?", teamUser.ID).Delete(model).Error; err != nil {
+			return false, err
+		}
+	}
+	if err := tx.Delete(&models.TeamUser{}, teamUser.ID).Error; err != nil {
+		return false, err
+	}
+
+	if !deleteOrphan {
+		return false, nil
+	}
+	var otherTeams int64
+	if err := tx.Model(&models.TeamUser{}).Where("user_id = ?", teamUser.UserID).Count(&otherTeams).Error; err != nil {
+		return false, err
+	}
+	if otherTeams != 0 {
+		return false, nil
+	}
+	if err := tx.Where("user_id = ?", teamUser.UserID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return false, err
+	}
+	if err := tx.Delete(&models.User{}, teamUser.UserID).Error; err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTeamNameRequired     = errors.New("team name is required")
+	ErrInvalidTeamSlug      = errors.New("invalid team slug")
+	ErrTeamExists           = errors.New("team already exists")
+	ErrDefaultTeamProtected = errors.New("default team cannot be deleted or have its slug changed")
+)
+
+type TeamService struct {
+	db *gorm.DB
+}
+
+type UpdateTeamInput struct {
+	Name string
+	// Slug, when empty, keeps the team's slug.
+	Slug string
+}
+
+// DeletedTeam is what deleting a team removed.
+type DeletedTeam struct {
+	Team models.Team
+	// Members is how many team users the team had.
+	Members int
+	// DeletedUsers is how many users were deleted for being in no other
+	// team.
+	DeletedUsers int
+}
+
+func NewTeamService(db *gorm.DB) *TeamService {
+	return &TeamService{db: db}
+}
+
+// Update renames a team and, unless it is the default team, changes its
+// slug. It returns the team before and after the change.
+func (s *TeamService) Update(ctx context.Context, teamID uint, input UpdateTeamInput) (*models.Team, *models.Team, error) {
+	input.Name = strings.TrimSpace(input.Name)
+	input.Slug = strings.TrimSpace(input.Slug)
+	if input.Name == "" {
+		return nil, nil, ErrTeamNameRequired
+	}
+	if input.Slug != "" && !models.IsValidTeamSlug(input.Slug) {
+		return nil, nil, ErrInvalidTeamSlug
+	}
+
+	var before, after models.Team
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockTeam(tx, teamID, &before); err != nil {
+			return err
+		}
+		after = before
+		after.Name = input.Name
+		if input.Slug != "" && input.Slug != before.Slug {
+			if before.Slug == models.DefaultTeamSlug {
+				return ErrDefaultTeamProtected
+			}
+			after.Slug = input.Slug
+		}
+
+		var conflicts int64
+		err := tx.Model(&models.Team{}).
+			Where("id <> ? AND (LOWER(name) = LOWER(?) OR slug = ?)", teamID, after.Name, after.Slug).
+			Count(&conflicts).Error
+		if err != nil {
+			return err
+		}
+		if conflicts != 0 {
+			return ErrTeamExists
+		}
+		return tx.Model(&models.Team{}).Where("id = ?", teamID).
+			Updates(map[string]any{"name": after.Name, "slug": after.Slug}).Error
+	})
+	if err != nil {
+		// Name and slug are the team's only unique columns, so a concurrent
+		// update that took either fails here.
+		if isConstraintError(err, "unique") {
+			return nil, nil, ErrTeamExists
+		}
+		return nil, nil, err
+	}
+	return &before, &after, nil
+}
+
+// Delete deletes a team with everything it owns except its audit log. Its
+// members' tunnels are closed, and members in no other team are deleted,
+// unless they are superusers.
+func (s *TeamService) Delete(ctx context.Context, teamID uint) (*DeletedTeam, error) {
+	deleted := &DeletedTeam{}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := lockTeam(tx, teamID, &deleted.Team); err != nil {
+			return err
+		}
+		if deleted.Team.Slug == models.DefaultTeamSlug {
+			return ErrDefaultTeamProtected
+		}
+
+		var teamUsers []models.TeamUser
+		if err := tx.Preload("User").Where("team_id = ?", teamID).Find(&teamUsers).Error; err != nil {
+			return err
+		}
+		deleted.Members = len(teamUsers)
+		for i := range teamUsers {
+			userDeleted, err := removeTeamUser(tx, &teamUsers[i], !teamUsers[i].User.IsSuperuser)
+			if err != nil {
+				return err
+			}
+			if userDeleted {
+				deleted.DeletedUsers++
+			}
+		}
+
+		// See removeTeamUser for why the team's rows are deleted one
+		// table at a time. Tunnels still served for the team are torn
+		// down once their connection rows are gone.
+		teamReservations := tx.Model(&models.SubdomainReservation{}).Select("id").Where("team_id = ?", teamID)
+		if err := tx.Where("reservation_id IN (?)", teamReservations).Delete(&models.SubdomainReservationMember{}).Error; err != nil {
+			return err
+		}
+		for _, model := range []any{
+			&models.Connection{},
+			&models.AccessLog{},
+			&models.AutoSignupDomain{},
+			&models.ErrorPage{},
+			&models.MirrorRule{},
+			&models.SplitRoute{},
+			&models.SubdomainReservation{},
+			&models.CachePurge{},
+			&models.BandwidthUsage{},
+		} {
+			if err := tx.Where("team_id = ?", teamID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&models.Team{}, teamID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// lockTeam loads a team, locking its row for the rest of the transaction so
+// membership changes to it are serialized.
+func lockTeam(tx *gorm.DB, teamID uint, team *models.Team) error {
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(team, teamID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrTeamNotFound
+	}
+	return err
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/utils"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidCredentialType     = errors.New("tunnel credential connection type must be http or tcp")
+	ErrInvalidSubdomainPattern   = errors.New("invalid tunnel credential subdomain pattern")
+	ErrInvalidCredentialLifetime = errors.New("tunnel credential lifetime out of range")
+	ErrCredentialNotAllowed      = errors.New("tunnel credential does not allow this tunnel")
+)
+
+const (
+	// MinTunnelCredentialLifetime and MaxTunnelCredentialLifetime bound how
+	// long a tunnel credential, and the tunnels it opens, may last.
+	MinTunnelCredentialLifetime = time.Minute
+	MaxTunnelCredentialLifetime = 24 * time.Hour
+
+	// tunnelCredentialPrefixLength is how much of a credential is kept to
+	// tell it apart.
+	tunnelCredentialPrefixLength = len(models.TunnelCredentialPrefix) + 6
+)
+
+type TunnelCredentialService struct {
+	db *gorm.DB
+}
+
+func NewTunnelCredentialService(db *gorm.DB) *TunnelCredentialService {
+	return &TunnelCredentialService{db: db}
+}
+
+type MintTunnelCredentialInput struct {
+	Name           string
+	ConnectionType string
+	// SubdomainPattern limits the subdomains of http tunnels; * stands for
+	// any run of characters. It is ignored for tcp tunnels.
+	SubdomainPattern string
+	MaxLifetime      time.Duration
+	// APITokenID is the API token minting the credential, if any.
+	APITokenID *uint
+}
+
+// Mint issues a tunnel credential for the team user and returns it with the
+// credential itself, which is not stored and cannot be shown again.
+func (s *TunnelCredentialService) Mint(ctx context.Context, teamUserID uint, input MintTunnelCredentialInput) (*models.TunnelCredential, string, error) {
+	if input.ConnectionType != models.ConnectionTypeHTTP && input.ConnectionType != models.ConnectionTypeTCP {
+		return nil, "", ErrInvalidCredentialType
+	}
+	pattern := ""
+	if input.ConnectionType == models.ConnectionTypeHTTP {
+		pattern = strings.ToLower(strings.TrimSpace(input.SubdomainPattern))
+		if !validSubdomainPattern(pattern) {
+			return nil, "", ErrInvalidSubdomainPattern
+		}
+	}
+	if input.MaxLifetime < MinTunnelCredentialLifetime || input.MaxLifetime > MaxTunnelCredentialLifetime {
+		return nil, "", ErrInvalidCredentialLifetime
+	}
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		name = "ci"
+	}
+
+	secret := models.GenerateTunnelCredential()
+	credential := &models.TunnelCredential{
+		TeamUserID:       teamUserID,
+		APITokenID:       input.APITokenID,
+		Name:             name,
+		Prefix:           secret[:tunnelCredentialPrefixLength],
+		KeyHash:          models.HashTunnelCredential(secret),
+		ConnectionType:   input.ConnectionType,
+		SubdomainPattern: pattern,
+		ExpiresAt:        time.Now().UTC().Add(input.MaxLifetime),
+	}
+	if err := s.db.WithContext(ctx).Create(credential).Error; err != nil {
+		return nil, "", err
+	}
+	return credential, secret, nil
+}
+
+// validSubdomainPattern reports whether pattern is a subdomain in which any
+// character may be replaced by *.
+func validSubdomainPattern(pattern string) bool {
+	if strings.ContainsAny(pattern, "?[]\\") {
+		return false
+	}
+	return utils.ValidateSubdomain(strings.ReplaceAll(pattern, "*", "a")) == nil
+}
+
+// Authenticate returns the usable credential matching secret, with its team
+// user, and records that it was used. Credentials minted with an API token
+// stop working when the token does.
+func (s *TunnelCredentialService) Authenticate(ctx context.Context, secret string) (*models.TunnelCredential, error) {
+	if !strings.HasPrefix(secret, models.TunnelCredentialPrefix) {
+		return nil, ErrInvalidSecretKey
+	}
+	var credential models.TunnelCredential
+	err := s.db.WithContext(ctx).
+		Preload("TeamUser.User").
+		Preload("TeamUser.Team").
+		Where("key_hash = ?", models.HashTunnelCredential(secret)).
+		First(&credential).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidSecretKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if !credential.Usable(now) {
+		return nil, ErrInvalidSecretKey
+	}
+	if credential.APITokenID != nil {
+		var token models.APIToken
+		err := s.db.WithContext(ctx).First(&token, *credential.APITokenID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && !token.Usable(now)) {
+			return nil, ErrInvalidSecretKey
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := s.db.WithContext(ctx).Model(&credential).UpdateColumn("last_used_at", now).Error; err != nil {
+		return nil, err
+	}
+	credential.LastUsedAt = &now
+	return &credential, nil
+}
+
+// Allow checks that the credential may open a tunnel of connectionType on
+// subdomain, and returns when that tunnel must close: at expiresAt, if
+// requested, but no later than the credential's own expiry.
+func (s *TunnelCredentialService) Allow(credential *models.TunnelCredential, connectionType string, subdomain *string, expiresAt *time.Time) (*time.Time, error) {
+	if connectionType != credential.ConnectionType {
+		return nil, ErrCredentialNotAllowed
+	}
+	if connectionType == models.ConnectionTypeHTTP && (subdomain == nil || !credential.AllowsSubdomain(*subdomain)) {
+		return nil, ErrCredentialNotAllowed
+	}
+	if expiresAt != nil && expiresAt.Before(credential.ExpiresAt) {
+		return expiresAt, nil
+	}
+	limit := credential.ExpiresAt
+	return &limit, nil
+}
+
+// Prune deletes the credentials that expired before now without opening a
+// tunnel. Those that opened one are kept as long as its connection, which
+// records the credential it was opened with.
+func (s *TunnelCredentialService) Prune(ctx context.Context, now time.Time) (int64, error) {
+	used := s.db.Model(&models.Connection{}).Select("tunnel_credential_id").Where("tunnel_credential_id IS NOT NULL")
+	result := s.db.WithContext(ctx).
+		Where("expires_at < ? AND id NOT IN (?)", now, used).
+		Delete(&models.TunnelCredential{})
+	return result.RowsAffected, result.Error
+}
+
+// revokeTunnelCredentials stops the credentials minted with an API token and
+// closes the tunnels they opened, which the tunnel server then tears down.
+func revokeTunnelCredentials(tx *gorm.DB, apiTokenID uint, now time.Time) error {
+	err := tx.Model(&models.TunnelCredential{}).
+		Where("api_token_id = ? AND revoked_at IS NULL", apiTokenID).
+		Update("revoked_at", now).Error
+	if err != nil {
+		return err
+	}
+	credentials := tx.Model(&models.TunnelCredential{}).Select("id").Where("api_token_id = ?", apiTokenID)
+	return tx.Model(&models.Connection{}).
+		Where("tunnel_credential_id IN (?) AND status IN ?", credentials, []string{models.ConnectionStatusReserved, models.ConnectionStatusActive}).
+		Updates(map[string]any{
+			"status":       models.ConnectionStatusClosed,
+			"closed_at":    now,
+			"close_reason": models.ConnectionCloseReasonKeyRevoked,
+		}).Error
+}
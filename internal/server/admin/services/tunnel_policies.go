@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidTunnelLifetime = errors.New("tunnel lifetime cannot be negative")
+
+type TunnelPolicyService struct {
+	db *gorm.DB
+}
+
+func NewTunnelPolicyService(db *gorm.DB) *TunnelPolicyService {
+	return &TunnelPolicyService{db: db}
+}
+
+// SetMaxLifetime caps how long each tunnel of a team may stay open. Zero
+// removes the cap.
+func (s *TunnelPolicyService) SetMaxLifetime(ctx context.Context, teamID uint, lifetime time.Duration) error {
+	if lifetime < 0 {
+		return ErrInvalidTunnelLifetime
+	}
+	result := s.db.WithContext(ctx).Model(&models.Team{}).
+		Where("id = ?", teamID).
+		Update("max_tunnel_lifetime_seconds", int64(lifetime/time.Second))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTeamNotFound
+	}
+	return nil
+}
+
+// MaxLifetime returns how long each tunnel of a team may stay open, or zero
+// when there is no cap.
+func (s *TunnelPolicyService) MaxLifetime(ctx context.Context, teamID uint) (time.Duration, error) {
+	var team models.Team
+	err := s.db.WithContext(ctx).Select("max_tunnel_lifetime_seconds").Where("id = ?", teamID).First(&team).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, ErrTeamNotFound
+		}
+		return 0, err
+	}
+	return time.Duration(team.MaxTunnelLifetime) * time.Second, nil
+}
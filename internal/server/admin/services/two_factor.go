@@ -0,0 +1,344 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrUserNotFound            = errors.New("user not found")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotStarted     = errors.New("two-factor enrollment has not been started")
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrTwoFactorRequiredByTeam = errors.New("a team of the user requires two-factor authentication")
+)
+
+const (
+	// totpPeriod and totpDigits are the RFC 6238 defaults, which every
+	// authenticator app supports.
+	totpPeriod = 30 * time.Second
+	totpDigits = 6
+	// totpSkew is how many time steps before or after the current one a
+	// code is accepted for, allowing for clock drift.
+	totpSkew = 1
+)
+
+// TwoFactorMethod is how a user passed their second factor.
+type TwoFactorMethod string
+
+const (
+	TwoFactorMethodTOTP         TwoFactorMethod = "totp"
+	TwoFactorMethodRecoveryCode TwoFactorMethod = "recovery_code"
+)
+
+type TwoFactorService struct {
+	db *gorm.DB
+	// now is the clock codes are checked against; tests replace it.
+	now func() time.Time
+}
+
+func NewTwoFactorService(db *gorm.DB) *TwoFactorService {
+	return &TwoFactorService{db: db, now: time.Now}
+}
+
+// TwoFactorStatus is a user's two-factor setup, without its secrets.
+type TwoFactorStatus struct {
+	Enabled           bool       `json:"enabled"`
+	EnabledAt         *time.Time `json:"enabled_at"`
+	RecoveryCodesLeft int64      `json:"recovery_codes_left"`
+}
+
+// TwoFactorEnrollment is a new authenticator secret for the user to add to
+// their app, as text and as an otpauth:// URI for QR codes.
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// Status returns whether the user has two-factor authentication on and how
+// many unused recovery codes they have.
+func (s *TwoFactorService) Status(ctx context.Context, user *models.User) (*TwoFactorStatus, error) {
+	status := &TwoFactorStatus{Enabled: user.TwoFactorEnabled(), EnabledAt: user.TOTPEnabledAt}
+	if !status.Enabled {
+		return status, nil
+	}
+	err := s.db.WithContext(ctx).Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", user.ID).
+		Count(&status.RecoveryCodesLeft).Error
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// BeginEnrollment gives the user a new authenticator secret. It takes effect
+// once Enable confirms the user's app produces codes for it; starting again
+// replaces a secret that was never confirmed.
+func (s *TwoFactorService) BeginEnrollment(ctx context.Context, user *models.User, issuer string) (*TwoFactorEnrollment, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	encoded := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current models.User
+		if err := lockUser(tx, user.ID, &current); err != nil {
+			return err
+		}
+		if current.TwoFactorEnabled() {
+			return ErrTwoFactorAlreadyEnabled
+		}
+		return tx.Model(&models.User{}).Where("id = ?", user.ID).
+			Updates(map[string]any{"totp_secret": encoded, "totp_last_step": 0}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	label := url.PathEscape(issuer + ":" + user.Email)
+	query := url.Values{}
+	query.Set("secret", encoded)
+	query.Set("issuer", issuer)
+	return &TwoFactorEnrollment{
+		Secret: encoded,
+		URI:    "otpauth://totp/" + label + "?" + query.Encode(),
+	}, nil
+}
+
+// Enable turns on two-factor authentication once code shows the user's app
+// holds the secret from BeginEnrollment. It returns the user's recovery
+// codes, which are not stored and cannot be shown again.
+func (s *TwoFactorService) Enable(ctx context.Context, user *models.User, code string) ([]string, error) {
+	var codes []string
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current models.User
+		if err := lockUser(tx, user.ID, &current); err != nil {
+			return err
+		}
+		if current.TwoFactorEnabled() {
+			return ErrTwoFactorAlreadyEnabled
+		}
+		if current.TOTPSecret == nil {
+			return ErrTwoFactorNotStarted
+		}
+		step, ok := s.matchTOTP(*current.TOTPSecret, code, 0)
+		if !ok {
+			return ErrInvalidTwoFactorCode
+		}
+
+		err := tx.Model(&models.User{}).Where("id = ?", user.ID).
+			Updates(map[string]any{"totp_enabled_at": s.now().UTC(), "totp_last_step": step}).Error
+		if err != nil {
+			return err
+		}
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify checks a TOTP or recovery code of a user with two-factor
+// authentication on. Each code is accepted once.
+func (s *TwoFactorService) Verify(ctx context.Context, userID uint, code string) (TwoFactorMethod, error) {
+	var method TwoFactorMethod
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		method, err = s.verify(tx, userID, code)
+		return err
+	})
+	return method, err
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes, after checking
+// a current code.
+func (s *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, user *models.User, code string) ([]string, error) {
+	var codes []string
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := s.verify(tx, user.ID, code); err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable turns off the user's two-factor authentication after checking a
+// current code, unless one of their teams requires it.
+func (s *TwoFactorService) Disable(ctx context.Context, user *models.User, code string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := s.verify(tx, user.ID, code); err != nil {
+			return err
+		}
+		var requiring int64
+		err := tx.Model(&models.TeamUser{}).
+			Joins("JOIN team ON team.id = team_users.team_id").
+			Where("team_users.user_id = ? AND team.require_two_factor = ?", user.ID, true).
+			Count(&requiring).Error
+		if err != nil {
+			return err
+		}
+		if requiring != 0 {
+			return ErrTwoFactorRequiredByTeam
+		}
+		return clearTwoFactor(tx, user.ID)
+	})
+}
+
+// Reset turns off two-factor authentication for a member of the actor's
+// team who lost their authenticator and recovery codes. Only superusers may
+// reset a superuser.
+func (s *TwoFactorService) Reset(ctx context.Context, actor *models.TeamUser, teamUserID uint) (*models.TeamUser, error) {
+	var target models.TeamUser
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Preload("User").Where("id = ? AND team_id = ?", teamUserID, actor.TeamID).First(&target).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTeamUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if target.User.IsSuperuser && !actor.User.IsSuperuser {
+			return ErrSuperuserAccessRequired
+		}
+		if !target.User.TwoFactorEnabled() {
+			return ErrTwoFactorNotEnabled
+		}
+		return clearTwoFactor(tx, target.UserID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+// SetTeamRequirement turns the team's two-factor requirement on or off.
+func (s *TwoFactorService) SetTeamRequirement(ctx context.Context, teamID uint, required bool) error {
+	return s.db.WithContext(ctx).Model(&models.Team{}).
+		Where("id = ?", teamID).
+		Update("require_two_factor", required).Error
+}
+
+// verify checks code within tx, marking it used.
+func (s *TwoFactorService) verify(tx *gorm.DB, userID uint, code string) (TwoFactorMethod, error) {
+	var user models.User
+	if err := lockUser(tx, userID, &user); err != nil {
+		return "", err
+	}
+	if !user.TwoFactorEnabled() || user.TOTPSecret == nil {
+		return "", ErrTwoFactorNotEnabled
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totpDigits {
+		step, ok := s.matchTOTP(*user.TOTPSecret, code, user.TOTPLastStep)
+		if !ok {
+			return "", ErrInvalidTwoFactorCode
+		}
+		err := tx.Model(&models.User{}).Where("id = ?", userID).Update("totp_last_step", step).Error
+		return TwoFactorMethodTOTP, err
+	}
+
+	result := tx.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, models.HashRecoveryCode(code)).
+		Update("used_at", s.now().UTC())
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return "", ErrInvalidTwoFactorCode
+	}
+	return TwoFactorMethodRecoveryCode, nil
+}
+
+// matchTOTP returns the time step code is valid for, if it is valid for one
+// near the current time and after lastStep.
+func (s *TwoFactorService) matchTOTP(secret, code string, lastStep int64) (int64, bool) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := s.now().Unix() / int64(totpPeriod/time.Second)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode is the RFC 6238 code of key for a time step.
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1_000_000)
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and issues new ones.
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, models.RecoveryCodeCount)
+	rows := make([]models.RecoveryCode, models.RecoveryCodeCount)
+	for i := range codes {
+		codes[i] = models.GenerateRecoveryCode()
+		rows[i] = models.RecoveryCode{UserID: userID, CodeHash: models.HashRecoveryCode(codes[i])}
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// clearTwoFactor turns off the user's two-factor authentication and deletes
+// their recovery codes.
+func clearTwoFactor(tx *gorm.DB, userID uint) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.User{}).Where("id = ?", userID).
+		Updates(map[string]any{"totp_secret": nil, "totp_enabled_at": nil, "totp_last_step": 0}).Error
+}
+
+// lockUser loads a user, locking their row for the rest of the transaction
+// so that concurrent uses of one code cannot both succeed.
+func lockUser(tx *gorm.DB, userID uint, user *models.User) error {
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(user, userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrUserNotFound
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"context"
+	"encoding/base32"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+)
+
+func TestTOTPCodeMatchesRFC6238(t *testing.T) {
+	// The SHA-1 test vectors of RFC 6238, cut to six digits.
+	key := []byte("12345678901234567890")
+	for unix, want := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		if got := totpCode(key, unix/30); got != want {
+			t.Fatalf("at %d: expected %s, got %s", unix, want, got)
+		}
+	}
+}
+
+func TestTwoFactorVerifyAcceptsEachCodeOnce(t *testing.T) {
+	db := newAutoSignupServiceTestDB(t)
+	user := &models.User{Email: "totp@example.com"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	now := time.Unix(1_700_000_000, 0)
+	service := NewTwoFactorService(db)
+	service.now = func() time.Time { return now }
+	enrollment, err := service.BeginEnrollment(context.Background(), user, "Portr")
+	if err != nil {
+		t.Fatalf("begin enrollment: %v", err)
+	}
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatalf("decode secret: %v", err)
+	}
+	codeAt := func(at time.Time) string { return totpCode(key, at.Unix()/30) }
+
+	if _, err := service.Enable(context.Background(), user, codeAt(now)); err != nil {
+		t.Fatalf("enable: %v", err)
+	}
+	if _, err := service.Verify(context.Background(), user.ID, codeAt(now)); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("expected the enrollment code to be spent, got %v", err)
+	}
+
+	// A code from the next step is accepted early, for clock drift, and
+	// then spends every earlier code.
+	next := now.Add(30 * time.Second)
+	if method, err := service.Verify(context.Background(), user.ID, codeAt(next)); err != nil || method != TwoFactorMethodTOTP {
+		t.Fatalf("expected the next code to be accepted, got %q %v", method, err)
+	}
+	now = next
+	if _, err := service.Verify(context.Background(), user.ID, codeAt(next)); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("expected a replayed code to be refused, got %v", err)
+	}
+	if _, err := service.Verify(context.Background(), user.ID, codeAt(now.Add(2*time.Minute))); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Fatalf("expected a code far from now to be refused, got %v", err)
+	}
+}
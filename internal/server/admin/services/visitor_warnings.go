@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"gorm.io/gorm"
+)
+
+type VisitorWarningService struct {
+	db *gorm.DB
+}
+
+func NewVisitorWarningService(db *gorm.DB) *VisitorWarningService {
+	return &VisitorWarningService{db: db}
+}
+
+// ResolvedVisitorWarning names who runs a tunnel on the interstitial.
+type ResolvedVisitorWarning struct {
+	Owner string
+	Team  string
+}
+
+// SetEnabled turns the interstitial on or off for the team's tunnels.
+func (s *VisitorWarningService) SetEnabled(ctx context.Context, teamID uint, enabled bool) error {
+	return s.db.WithContext(ctx).Model(&models.Team{}).
+		Where("id = ?", teamID).
+		Update("visitor_warning", enabled).Error
+}
+
+// Resolve returns the interstitial for a subdomain's visitors, or nil when
+// the team that reserved it or last tunneled on it has not turned it on.
+func (s *VisitorWarningService) Resolve(ctx context.Context, subdomain string) (*ResolvedVisitorWarning, error) {
+	subdomain = strings.ToLower(subdomain)
+	if subdomain == "" {
+		return nil, nil
+	}
+	owner, err := findSubdomainOwner(ctx, s.db, subdomain)
+	if err != nil || owner == nil {
+		return nil, err
+	}
+	var team models.Team
+	err = s.db.WithContext(ctx).Where("id = ?", owner.TeamID).First(&team).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !team.VisitorWarning {
+		return nil, nil
+	}
+	return &ResolvedVisitorWarning{Owner: owner.Email, Team: team.Name}, nil
+}
@@ -0,0 +1,91 @@
+import Panel from "@/components/Panel"
+import { formatBytes } from "@/lib/humanize"
+import { cn } from "@/lib/utils"
+import type { BandwidthAccount, BandwidthStatus } from "@/types"
+
+/** Owners are warned at this share of a quota; the bar turns with them. */
+const WARN_RATIO = 0.8
+
+function limited(account: BandwidthAccount) {
+  return account.monthly_bytes > 0 || account.rate_bytes > 0
+}
+
+function QuotaRow({
+  label,
+  account,
+}: {
+  label: string
+  account: BandwidthAccount
+}) {
+  const ratio =
+    account.monthly_bytes > 0
+      ? Math.min(account.used_bytes / account.monthly_bytes, 1)
+      : 0
+
+  return (
+    <li className="space-y-1.5 px-4 py-3">
+      <div className="flex items-baseline justify-between gap-3 text-sm">
+        <span className="min-w-0 truncate font-medium">{label}</span>
+        <span className="data shrink-0 text-xs text-muted-foreground">
+          {formatBytes(account.used_bytes)}
+          {account.monthly_bytes > 0 &&
+            ` of ${formatBytes(account.monthly_bytes)}`}
+          {account.rate_bytes > 0 &&
+            ` · ${formatBytes(account.rate_bytes)}/s`}
+        </span>
+      </div>
+      {account.monthly_bytes > 0 && (
+        <div
+          role="progressbar"
+          aria-label={`${label} bandwidth`}
+          aria-valuemin={0}
+          aria-valuemax={100}
+          aria-valuenow={Math.round(ratio * 100)}
+          className="h-1.5 overflow-hidden rounded-full bg-muted"
+        >
+          <div
+            className={cn(
+              "h-full rounded-full",
+              ratio >= 1
+                ? "bg-destructive"
+                : ratio >= WARN_RATIO
+                  ? "bg-destructive/60"
+                  : "bg-signal-live",
+            )}
+            style={{ width: `${ratio * 100}%` }}
+          />
+        </div>
+      )}
+    </li>
+  )
+}
+
+/**
+ * Quota status for the team and the members with limits or traffic. Limits
+ * are set through the admin API; this only reports them.
+ */
+export default function BandwidthPanel({ status }: { status: BandwidthStatus }) {
+  const users = status.users.filter(
+    (user) => limited(user) || user.used_bytes > 0,
+  )
+  const resets = new Date(status.resets_at).toLocaleDateString(undefined, {
+    month: "long",
+    day: "numeric",
+    timeZone: "UTC",
+  })
+
+  return (
+    <Panel
+      title="Bandwidth this month"
+      description={`Tunnel traffic in both directions. Quotas reset on ${resets}.`}
+      flush
+    >
+      <ul className="divide-y divide-border">
+        <QuotaRow label="Team" account={status.team} />
+        {users.map((user) => (
+          <QuotaRow key={user.team_user_id} label={user.email} account={user} />
+        ))}
+      </ul>
+    </Panel>
+  )
+}
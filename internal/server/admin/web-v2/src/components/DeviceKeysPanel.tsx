@@ -0,0 +1,245 @@
+import { useCallback, useEffect, useState } from "react"
+import { Copy, LoaderCircle, MonitorSmartphone } from "lucide-react"
+import { toast } from "sonner"
+import DateField from "@/components/DateField"
+import Panel from "@/components/Panel"
+import {
+  AlertDialog,
+  AlertDialogAction,
+  AlertDialogCancel,
+  AlertDialogContent,
+  AlertDialogDescription,
+  AlertDialogFooter,
+  AlertDialogHeader,
+  AlertDialogTitle,
+  AlertDialogTrigger,
+} from "@/components/ui/alert-dialog"
+import { Button } from "@/components/ui/button"
+import { Input } from "@/components/ui/input"
+import { Label } from "@/components/ui/label"
+import { copyCodeToClipboard } from "@/lib/utils"
+import type { DeviceKey } from "@/types"
+
+/**
+ * The signed-in user's device keys: one per machine, each usable in place of
+ * the secret key and revocable on its own. A new key is shown once, with the
+ * command that sets it up.
+ */
+export default function DeviceKeysPanel({ team }: { team: string }) {
+  const [keys, setKeys] = useState<DeviceKey[] | null>(null)
+  const [name, setName] = useState("")
+  const [expiresInDays, setExpiresInDays] = useState("")
+  const [created, setCreated] = useState<DeviceKey | null>(null)
+  const [error, setError] = useState("")
+  const [busy, setBusy] = useState(false)
+
+  const loadKeys = useCallback(async () => {
+    try {
+      const res = await fetch("/api/v1/device-keys/", {
+        headers: { "x-team-slug": team },
+      })
+      if (res.ok) setKeys((await res.json()).data)
+    } catch (err) {
+      console.error("Failed to load device keys:", err)
+    }
+  }, [team])
+
+  useEffect(() => {
+    loadKeys()
+  }, [loadKeys])
+
+  const createKey = async () => {
+    setBusy(true)
+    setError("")
+    try {
+      const res = await fetch("/api/v1/device-keys/", {
+        method: "POST",
+        headers: {
+          "Content-Type": "application/json",
+          "x-team-slug": team,
+        },
+        body: JSON.stringify({
+          name,
+          expires_in_days: Number(expiresInDays) || 0,
+        }),
+      })
+      const data = await res.json()
+      if (!res.ok) {
+        setError(data.message ?? "Something went wrong")
+        return
+      }
+      toast.success("Device key created")
+      setCreated(data)
+      setName("")
+      setExpiresInDays("")
+      await loadKeys()
+    } catch (err) {
+      console.error(err)
+      setError("Something went wrong")
+    } finally {
+      setBusy(false)
+    }
+  }
+
+  const revokeKey = async (key: DeviceKey) => {
+    try {
+      const res = await fetch(`/api/v1/device-keys/${key.id}`, {
+        method: "DELETE",
+        headers: { "x-team-slug": team },
+      })
+      if (!res.ok) {
+        const data = await res.json()
+        toast.error(data.message ?? "Failed to revoke device key")
+        return
+      }
+      toast.success(`Revoked ${key.name}`)
+      if (created?.id === key.id) setCreated(null)
+      await loadKeys()
+    } catch (err) {
+      console.error(err)
+      toast.error("Failed to revoke device key")
+    }
+  }
+
+  const copySetupCommand = () => {
+    copyCodeToClipboard(created?.setup_command ?? "")
+    toast.success("Command copied to clipboard")
+  }
+
+  return (
+    <Panel
+      icon={<MonitorSmartphone className="size-4" />}
+      title="Device keys"
+      description="Give each machine its own key, so losing one only means revoking that key."
+    >
+      {created?.setup_command && (
+        <div className="space-y-2 rounded-md border border-border p-3">
+          <p className="text-sm">
+            Run this on {created.name}. The key is not shown again.
+          </p>
+          <Input
+            readOnly
+            aria-label="Setup command"
+            value={created.setup_command}
+            className="data text-sm"
+          />
+          <Button variant="outline" size="sm" onClick={copySetupCommand}>
+            <Copy className="size-4" />
+            Copy command
+          </Button>
+        </div>
+      )}
+
+      <div className="flex flex-wrap items-end gap-3">
+        <div className="space-y-2">
+          <Label htmlFor="device_key_name">Name</Label>
+          <Input
+            id="device_key_name"
+            placeholder="laptop"
+            className="max-w-48"
+            value={name}
+            onChange={(e) => setName(e.target.value)}
+            aria-invalid={error ? true : undefined}
+            aria-describedby={error ? "device-key-error" : undefined}
+          />
+        </div>
+        <div className="space-y-2">
+          <Label htmlFor="device_key_expiry">Expires in days</Label>
+          <Input
+            id="device_key_expiry"
+            type="number"
+            min={0}
+            max={366}
+            placeholder="Never"
+            className="data max-w-32"
+            value={expiresInDays}
+            onChange={(e) => setExpiresInDays(e.target.value)}
+          />
+        </div>
+        <Button size="sm" disabled={busy || !name.trim()} onClick={createKey}>
+          {busy && <LoaderCircle className="size-4 animate-spin" />}
+          Create key
+        </Button>
+      </div>
+      {error && (
+        <p
+          id="device-key-error"
+          role="alert"
+          className="text-xs text-destructive"
+        >
+          {error}
+        </p>
+      )}
+
+      {keys === null ? (
+        <LoaderCircle className="size-4 animate-spin text-muted-foreground" />
+      ) : keys.length === 0 ? (
+        <p className="text-sm text-muted-foreground">
+          No device keys yet. Machines use your secret key until you add one.
+        </p>
+      ) : (
+        <ul className="divide-y divide-border">
+          {keys.map((key) => (
+            <li
+              key={key.id}
+              className="flex flex-wrap items-center justify-between gap-3 py-2"
+            >
+              <div className="space-y-1">
+                <p className="text-sm">
+                  {key.name}{" "}
+                  <span className="data text-xs text-muted-foreground">
+                    {key.prefix}…
+                  </span>
+                </p>
+                <p className="text-xs text-muted-foreground">
+                  {key.revoked_at ? (
+                    <>
+                      Revoked <DateField date={key.revoked_at} />
+                    </>
+                  ) : key.last_used_at ? (
+                    <>
+                      Last used <DateField date={key.last_used_at} />
+                      {key.last_used_ip && ` from ${key.last_used_ip}`}
+                    </>
+                  ) : (
+                    "Never used"
+                  )}
+                  {!key.revoked_at && key.expires_at && (
+                    <>
+                      {" · "}Expires <DateField date={key.expires_at} />
+                    </>
+                  )}
+                </p>
+              </div>
+              {!key.revoked_at && (
+                <AlertDialog>
+                  <AlertDialogTrigger asChild>
+                    <Button variant="outline" size="sm">
+                      Revoke
+                    </Button>
+                  </AlertDialogTrigger>
+                  <AlertDialogContent>
+                    <AlertDialogHeader>
+                      <AlertDialogTitle>Revoke {key.name}?</AlertDialogTitle>
+                      <AlertDialogDescription>
+                        The key stops working right away, and tunnels it opened
+                        close within a few seconds. Your other keys keep
+                        working.
+                      </AlertDialogDescription>
+                    </AlertDialogHeader>
+                    <AlertDialogFooter>
+                      <AlertDialogCancel>Cancel</AlertDialogCancel>
+                      <AlertDialogAction onClick={() => revokeKey(key)}>
+                        Revoke
+                      </AlertDialogAction>
+                    </AlertDialogFooter>
+                  </AlertDialogContent>
+                </AlertDialog>
+              )}
+            </li>
+          ))}
+        </ul>
+      )}
+    </Panel>
+  )
+}
@@ -0,0 +1,238 @@
+import { useCallback, useEffect, useState } from "react"
+import { Copy, LoaderCircle, ShieldCheck } from "lucide-react"
+import { toast } from "sonner"
+import Panel from "@/components/Panel"
+import { Button } from "@/components/ui/button"
+import { Input } from "@/components/ui/input"
+import { Label } from "@/components/ui/label"
+import { copyCodeToClipboard } from "@/lib/utils"
+import type { TwoFactorEnrollment, TwoFactorStatus } from "@/types"
+
+/**
+ * Enrollment and upkeep of the signed-in user's TOTP second factor. Every
+ * change past enrollment asks for a current code, so a session left open on
+ * someone else's screen cannot turn it off.
+ */
+export default function TwoFactorPanel({
+  team,
+  onChange,
+}: {
+  team: string
+  onChange: () => void
+}) {
+  const [status, setStatus] = useState<TwoFactorStatus | null>(null)
+  const [enrollment, setEnrollment] = useState<TwoFactorEnrollment | null>(
+    null,
+  )
+  const [recoveryCodes, setRecoveryCodes] = useState<string[]>([])
+  const [code, setCode] = useState("")
+  const [error, setError] = useState("")
+  const [busy, setBusy] = useState(false)
+
+  const loadStatus = useCallback(async () => {
+    try {
+      const res = await fetch("/api/v1/user/me/two-factor", {
+        headers: { "x-team-slug": team },
+      })
+      if (res.ok) setStatus(await res.json())
+    } catch (err) {
+      console.error("Failed to load two-factor status:", err)
+    }
+  }, [team])
+
+  useEffect(() => {
+    loadStatus()
+  }, [loadStatus])
+
+  const post = async (path: string, body?: object) => {
+    setBusy(true)
+    setError("")
+    try {
+      const res = await fetch(`/api/v1/user/me/two-factor/${path}`, {
+        method: "POST",
+        headers: {
+          "Content-Type": "application/json",
+          "x-team-slug": team,
+        },
+        body: body ? JSON.stringify(body) : undefined,
+      })
+      const data = await res.json()
+      if (!res.ok) {
+        setError(data.error ?? "Something went wrong")
+        return null
+      }
+      return data
+    } catch (err) {
+      console.error(err)
+      setError("Something went wrong")
+      return null
+    } finally {
+      setBusy(false)
+    }
+  }
+
+  const startSetup = async () => {
+    const data = await post("setup")
+    if (data) {
+      setEnrollment(data)
+      setRecoveryCodes([])
+      setCode("")
+    }
+  }
+
+  const enable = async () => {
+    const data = await post("enable", { code })
+    if (data) {
+      toast.success("Two-factor authentication is on")
+      setEnrollment(null)
+      setRecoveryCodes(data.recovery_codes)
+      setCode("")
+      await loadStatus()
+      onChange()
+    }
+  }
+
+  const regenerate = async () => {
+    const data = await post("recovery-codes", { code })
+    if (data) {
+      toast.success("New recovery codes generated")
+      setRecoveryCodes(data.recovery_codes)
+      setCode("")
+      await loadStatus()
+    }
+  }
+
+  const disable = async () => {
+    const data = await post("disable", { code })
+    if (data) {
+      toast.success("Two-factor authentication is off")
+      setRecoveryCodes([])
+      setCode("")
+      await loadStatus()
+      onChange()
+    }
+  }
+
+  const copyRecoveryCodes = () => {
+    copyCodeToClipboard(recoveryCodes.join("\n"))
+    toast.success("Recovery codes copied to clipboard")
+  }
+
+  const codeField = (
+    <div className="space-y-2">
+      <Label htmlFor="two_factor_code">
+        {status?.enabled ? "Authenticator or recovery code" : "Code from your app"}
+      </Label>
+      <Input
+        id="two_factor_code"
+        autoComplete="one-time-code"
+        className="data max-w-48"
+        value={code}
+        onChange={(e) => setCode(e.target.value)}
+        aria-invalid={error ? true : undefined}
+        aria-describedby={error ? "two-factor-error" : undefined}
+      />
+      {error && (
+        <p id="two-factor-error" role="alert" className="text-xs text-destructive">
+          {error}
+        </p>
+      )}
+    </div>
+  )
+
+  return (
+    <Panel
+      icon={<ShieldCheck className="size-4" />}
+      title="Two-factor authentication"
+      description="Asks for a code from an authenticator app after your password."
+    >
+      {recoveryCodes.length > 0 && (
+        <div className="space-y-2 rounded-md border border-border p-3">
+          <p className="text-sm">
+            Save these recovery codes somewhere safe. Each one signs you in once
+            if you lose your authenticator, and they are not shown again.
+          </p>
+          <ul className="data grid grid-cols-2 gap-1 text-sm">
+            {recoveryCodes.map((recoveryCode) => (
+              <li key={recoveryCode}>{recoveryCode}</li>
+            ))}
+          </ul>
+          <Button variant="outline" size="sm" onClick={copyRecoveryCodes}>
+            <Copy className="size-4" />
+            Copy codes
+          </Button>
+        </div>
+      )}
+
+      {status === null ? (
+        <LoaderCircle className="size-4 animate-spin text-muted-foreground" />
+      ) : status.enabled ? (
+        <>
+          <p className="text-sm text-muted-foreground">
+            On. {status.recovery_codes_left} recovery{" "}
+            {status.recovery_codes_left === 1 ? "code" : "codes"} left.
+          </p>
+          {codeField}
+          <div className="flex flex-wrap gap-3">
+            <Button
+              variant="outline"
+              size="sm"
+              disabled={busy || !code}
+              onClick={regenerate}
+            >
+              New recovery codes
+            </Button>
+            <Button
+              variant="destructive"
+              size="sm"
+              disabled={busy || !code}
+              onClick={disable}
+            >
+              Turn off
+            </Button>
+          </div>
+        </>
+      ) : enrollment ? (
+        <>
+          <p className="text-sm text-muted-foreground">
+            Add this key to your authenticator app, or open the link on the
+            device that has it, then enter the code it shows.
+          </p>
+          <Input
+            readOnly
+            aria-label="Authenticator key"
+            value={enrollment.secret}
+            className="data text-sm"
+          />
+          <a
+            href={enrollment.uri}
+            className="block text-xs text-muted-foreground underline"
+          >
+            Open in authenticator app
+          </a>
+          {codeField}
+          <Button size="sm" disabled={busy || !code} onClick={enable}>
+            {busy && <LoaderCircle className="size-4 animate-spin" />}
+            Turn on
+          </Button>
+        </>
+      ) : (
+        <>
+          <p className="text-sm text-muted-foreground">
+            Off. Accounts that sign in with GitHub or single sign-on rely on
+            that provider's second factor instead.
+          </p>
+          {error && (
+            <p role="alert" className="text-xs text-destructive">
+              {error}
+            </p>
+          )}
+          <Button size="sm" disabled={busy} onClick={startSetup}>
+            {busy && <LoaderCircle className="size-4 animate-spin" />}
+            Set up
+          </Button>
+        </>
+      )}
+    </Panel>
+  )
+}
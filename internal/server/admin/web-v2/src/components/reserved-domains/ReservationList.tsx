@@ -31,6 +31,11 @@ function statusClasses(status: SubdomainClaimStatus) {
   return "bg-signal-unbound"
 }
 
+function teamAccess(reservation: ReservedSubdomain) {
+  if (reservation.allowed_members.length === 0) return "open to admins"
+  return `open to admins and ${reservation.allowed_members.join(", ")}`
+}
+
 export function ReservationList({
   reservations,
   baseDomain,
@@ -99,6 +104,8 @@ export function ReservationList({
                 </p>
                 <p className="mt-1 text-xs text-muted-foreground">
                   Reserved {dateFormatter.format(new Date(reservation.created_at))}
+                  {reservation.owner === "team" &&
+                    ` · Team reservation, ${teamAccess(reservation)}`}
                 </p>
               </div>
               <div className="flex items-center justify-between gap-5 sm:justify-end">
@@ -109,15 +116,17 @@ export function ReservationList({
                   />
                   {statusLabel(reservation.claim_status)}
                 </span>
-                <Button
-                  variant="ghost"
-                  size="sm"
-                  className="text-muted-foreground hover:text-destructive"
-                  onClick={() => onRelease(reservation)}
-                >
-                  <Trash2 />
-                  Release
-                </Button>
+                {reservation.can_release && (
+                  <Button
+                    variant="ghost"
+                    size="sm"
+                    className="text-muted-foreground hover:text-destructive"
+                    onClick={() => onRelease(reservation)}
+                  >
+                    <Trash2 />
+                    Release
+                  </Button>
+                )}
               </div>
             </li>
           ))}
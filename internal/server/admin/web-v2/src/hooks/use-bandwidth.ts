@@ -0,0 +1,37 @@
+import { useEffect, useState } from "react"
+import type { BandwidthStatus } from "@/types"
+
+/** The team's bandwidth quotas and what its tunnels used this month. */
+export function useBandwidth(team?: string) {
+  const [status, setStatus] = useState<BandwidthStatus | null>(null)
+  const [loading, setLoading] = useState(true)
+
+  useEffect(() => {
+    if (!team) return
+
+    const controller = new AbortController()
+    setLoading(true)
+
+    const load = async () => {
+      try {
+        const res = await fetch("/api/v1/team/bandwidth", {
+          headers: { "x-team-slug": team },
+          signal: controller.signal,
+        })
+        if (!res.ok) throw new Error("bandwidth request failed")
+        const data = await res.json()
+        setStatus(Array.isArray(data?.users) ? data : null)
+      } catch (error) {
+        if (controller.signal.aborted) return
+        console.error("Failed to load bandwidth:", error)
+        setStatus(null)
+      }
+      setLoading(false)
+    }
+
+    void load()
+    return () => controller.abort()
+  }, [team])
+
+  return { status, loading }
+}
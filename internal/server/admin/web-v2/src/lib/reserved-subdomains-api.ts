@@ -22,10 +22,18 @@ function parseReservation(value: unknown): ReservedSubdomain {
     throw new Error("The server returned an invalid reservation")
   }
 
+  // Servers before team reservations only return the member's own.
   return {
     subdomain: value.subdomain,
     created_at: value.created_at,
     claim_status: value.claim_status,
+    owner: value.owner === "team" ? "team" : "member",
+    allowed_members: Array.isArray(value.allowed_members)
+      ? value.allowed_members.filter(
+          (email): email is string => typeof email === "string",
+        )
+      : [],
+    can_release: value.can_release !== false,
   }
 }
 
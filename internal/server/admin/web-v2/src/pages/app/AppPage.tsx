@@ -20,6 +20,7 @@ import {
   User,
   Users,
 } from "lucide-react"
+import { toast } from "sonner"
 import AppLayout from "@/components/AppLayout"
 import NewTeamDialog from "@/components/NewTeamDialog"
 import SidebarLink from "@/components/SidebarLink"
@@ -88,6 +89,22 @@ export default function AppPage() {
         if (response.ok) {
           const userData = await response.json()
           setCurrentUser(userData)
+          if (userData.failed_logins) {
+            toast.warning(
+              `${userData.failed_logins} failed ${
+                userData.failed_logins === 1 ? "sign-in" : "sign-ins"
+              } to your account since you last signed in. If that was not you, change your password.`,
+              { duration: 15000 },
+            )
+          }
+          // Every other team API refuses this session until two-factor
+          // authentication is on, so send the user to where they set it up.
+          if (
+            userData.team?.require_two_factor &&
+            !userData.user?.two_factor_enabled
+          ) {
+            navigate(`/${team}/my-account`)
+          }
         }
       } catch (err) {
         console.error("Failed to get user:", err)
@@ -95,7 +112,7 @@ export default function AppPage() {
     }
 
     getLoggedInUser()
-  }, [team, setCurrentUser])
+  }, [team, setCurrentUser, navigate])
 
   const handleLogout = async () => {
     try {
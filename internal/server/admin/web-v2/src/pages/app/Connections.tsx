@@ -17,6 +17,17 @@ import {
   TableRow,
 } from "@/components/ui/table";
 import { Button } from "@/components/ui/button";
+import {
+  AlertDialog,
+  AlertDialogAction,
+  AlertDialogCancel,
+  AlertDialogContent,
+  AlertDialogDescription,
+  AlertDialogFooter,
+  AlertDialogHeader,
+  AlertDialogTitle,
+  AlertDialogTrigger,
+} from "@/components/ui/alert-dialog";
 import ConnectionType from "@/components/ConnectionType";
 import DateField from "@/components/DateField";
 import Panel from "@/components/Panel";
@@ -28,8 +39,10 @@ import SegmentedControl from "@/components/SegmentedControl";
 import { Pagination } from "@/components/ui/pagination";
 import { Skeleton } from "@/components/ui/skeleton";
 import { formatDuration } from "@/lib/humanize";
+import { useUserStore } from "@/lib/store";
 import { updateQueryParam } from "@/lib/utils";
-import type { Connection } from "@/types";
+import { toast } from "sonner";
+import type { Connection, ConnectionCloseReason } from "@/types";
 
 const filters = [
   { value: "recent" as const, label: "All" },
@@ -38,10 +51,23 @@ const filters = [
 
 type ConnectionFilter = (typeof filters)[number]["value"];
 
+// Tunnels closed by a server policy or by hand say why; plain disconnects
+// need no note.
+const policyCloseReasons: Partial<Record<ConnectionCloseReason, string>> = {
+  idle_timeout: "Closed when idle",
+  max_lifetime: "Reached team lifetime",
+  expired: "Expired",
+  force_closed: "Force-closed",
+  member_removed: "Owner left team",
+  key_revoked: "Device key revoked",
+};
+
 export default function Connections() {
   const { team } = useParams<{ team: string }>();
+  const { currentUser } = useUserStore();
   const [connections, setConnections] = useState<Connection[]>([]);
   const [connectionsLoading, setConnectionsLoading] = useState(true);
+  const [closeLoading, setCloseLoading] = useState<string | null>(null);
 
   const urlParams = new URLSearchParams(window.location.search);
   const [connectionType, setConnectionType] = useState<ConnectionFilter>(
@@ -94,7 +120,54 @@ export default function Connections() {
     getConnections(connectionType, pageNo.toString(), pageSize.toString());
   }, [connectionType, pageNo, pageSize, team]);
 
-  const columns = ["Type", "Route", "Opened", "Duration", "Opened by"];
+  // The tunnel server tears a force-closed tunnel down on its next
+  // reconcile, so the row is marked closed here without waiting for it.
+  const handleCloseConnection = async (connectionId: string) => {
+    if (!team) return;
+
+    setCloseLoading(connectionId);
+    try {
+      const response = await fetch(`/api/v1/connections/${connectionId}`, {
+        method: "DELETE",
+        headers: {
+          "x-team-slug": team,
+        },
+      });
+
+      if (response.ok) {
+        setConnections((prev) =>
+          prev.map((connection) =>
+            connection.id === connectionId
+              ? {
+                  ...connection,
+                  status: "closed",
+                  closed_at: new Date().toISOString(),
+                  close_reason: "force_closed",
+                }
+              : connection
+          )
+        );
+        toast.success("Tunnel closed");
+      } else {
+        toast.error("Failed to close tunnel");
+      }
+    } catch (error) {
+      console.error("Error closing connection:", error);
+      toast.error("Failed to close tunnel");
+    } finally {
+      setCloseLoading(null);
+    }
+  };
+
+  const canCloseConnection = (connection: Connection) => {
+    if (!currentUser || connection.status === "closed") return false;
+    if (currentUser.role === "admin" || currentUser.user.is_superuser) {
+      return true;
+    }
+    return connection.created_by.id === currentUser.id;
+  };
+
+  const columns = ["Type", "Route", "Opened", "Duration", "Opened by", ""];
 
   return (
     <div className="space-y-5">
@@ -210,13 +283,63 @@ export default function Connections() {
                     <TableCell>
                       <DateField date={connection.created_at} />
                     </TableCell>
-                    <TableCell className="data text-xs">{duration}</TableCell>
+                    <TableCell className="data text-xs">
+                      {duration}
+                      {connection.status === "closed" &&
+                        connection.close_reason &&
+                        policyCloseReasons[connection.close_reason] && (
+                          <span className="block text-muted-foreground">
+                            {policyCloseReasons[connection.close_reason]}
+                          </span>
+                        )}
+                    </TableCell>
                     <TableCell className="text-sm">
                       {connection.created_by.user.first_name
                         ? `${connection.created_by.user.first_name} ${
                             connection.created_by.user.last_name || ""
                           }`
                         : connection.created_by.user.email}
+                      {(connection.device_key ??
+                        connection.tunnel_credential) && (
+                        <span className="block text-xs text-muted-foreground">
+                          {connection.device_key ??
+                            connection.tunnel_credential}
+                        </span>
+                      )}
+                    </TableCell>
+                    <TableCell className="text-right">
+                      {canCloseConnection(connection) && (
+                        <AlertDialog>
+                          <AlertDialogTrigger asChild>
+                            <Button
+                              variant="outline"
+                              size="sm"
+                              disabled={closeLoading === connection.id}
+                            >
+                              Close
+                            </Button>
+                          </AlertDialogTrigger>
+                          <AlertDialogContent>
+                            <AlertDialogHeader>
+                              <AlertDialogTitle>Close this tunnel?</AlertDialogTitle>
+                              <AlertDialogDescription>
+                                The tunnel stops serving within a few seconds
+                                and its client is told not to reconnect.
+                              </AlertDialogDescription>
+                            </AlertDialogHeader>
+                            <AlertDialogFooter>
+                              <AlertDialogCancel>Cancel</AlertDialogCancel>
+                              <AlertDialogAction
+                                onClick={() =>
+                                  handleCloseConnection(connection.id)
+                                }
+                              >
+                                Close tunnel
+                              </AlertDialogAction>
+                            </AlertDialogFooter>
+                          </AlertDialogContent>
+                        </AlertDialog>
+                      )}
                     </TableCell>
                   </TableRow>
                 );
@@ -14,7 +14,9 @@ import {
 } from "@/components/ui/alert-dialog";
 import { Input } from "@/components/ui/input";
 import { Label } from "@/components/ui/label";
+import DeviceKeysPanel from "@/components/DeviceKeysPanel";
 import Panel from "@/components/Panel";
+import TwoFactorPanel from "@/components/TwoFactorPanel";
 import { useUserStore } from "@/lib/store";
 import {
   Copy,
@@ -258,6 +260,8 @@ export default function MyAccount() {
         </Button>
       </Panel>
 
+      {team && <TwoFactorPanel team={team} onChange={refetchCurrentUser} />}
+
       <Panel
         icon={<KeyRound className="size-4" />}
         title="Client secret key"
@@ -321,7 +325,7 @@ export default function MyAccount() {
                 <AlertDialogDescription>
                   The current key stops working immediately. Every machine using
                   it has to be re-authenticated with the new key before it can
-                  open a tunnel.
+                  open a tunnel. Device keys keep working.
                 </AlertDialogDescription>
               </AlertDialogHeader>
               <AlertDialogFooter>
@@ -337,6 +341,8 @@ export default function MyAccount() {
           </p>
         </div>
       </Panel>
+
+      {team && <DeviceKeysPanel team={team} />}
     </div>
   );
 }
@@ -19,13 +19,14 @@ function renderPage() {
   )
 }
 
-/** Overview calls three endpoints; route by URL so each test can describe the
+/** Overview calls four endpoints; route by URL so each test can describe the
  *  server state it cares about. */
 function stubFetch({
   setupScript = "portr auth set test-token",
   setupStatus = 200,
   connections = [] as unknown[],
   count = 0,
+  bandwidth = null as unknown,
 }) {
   vi.stubGlobal(
     "fetch",
@@ -43,6 +44,17 @@ function stubFetch({
         )
       }
 
+      if (url.includes("/team/bandwidth")) {
+        return Promise.resolve(
+          bandwidth
+            ? new Response(JSON.stringify(bandwidth), {
+                status: 200,
+                headers: { "Content-Type": "application/json" },
+              })
+            : new Response(null, { status: 500 }),
+        )
+      }
+
       if (url.includes("/connections/")) {
         return Promise.resolve(
           new Response(JSON.stringify({ data: connections, count }), {
@@ -74,6 +86,8 @@ const httpConnection = {
   created_at: new Date().toISOString(),
   started_at: new Date().toISOString(),
   closed_at: null,
+  expires_at: null,
+  close_reason: null,
   status: "active",
   created_by: { user: { email: "ada@example.com" } },
 }
@@ -143,4 +157,33 @@ describe("Overview", () => {
       screen.getByText("curl -sSf https://install.portr.dev | sh"),
     ).toBeInTheDocument()
   })
+
+  it("shows how much of its bandwidth quota the team has used", async () => {
+    stubFetch({
+      connections: [httpConnection],
+      count: 1,
+      bandwidth: {
+        period: "2026-10",
+        resets_at: "2026-11-01T00:00:00Z",
+        team: { monthly_bytes: 10 * 1024 ** 3, rate_bytes: 0, used_bytes: 9 * 1024 ** 3 },
+        users: [
+          { team_user_id: 1, email: "ada@example.com", monthly_bytes: 0, rate_bytes: 1024 ** 2, used_bytes: 0 },
+          { team_user_id: 2, email: "idle@example.com", monthly_bytes: 0, rate_bytes: 0, used_bytes: 0 },
+        ],
+      },
+    })
+
+    renderPage()
+
+    expect(
+      await screen.findByRole("heading", { name: "Bandwidth this month" }),
+    ).toBeInTheDocument()
+    expect(screen.getByText("9.0 GiB of 10.0 GiB")).toBeInTheDocument()
+    expect(
+      screen.getByRole("progressbar", { name: "Team bandwidth" }),
+    ).toHaveAttribute("aria-valuenow", "90")
+    // Members without limits or traffic are left out.
+    expect(screen.getByText("0 B · 1.0 MiB/s")).toBeInTheDocument()
+    expect(screen.queryByText("idle@example.com")).not.toBeInTheDocument()
+  })
 })
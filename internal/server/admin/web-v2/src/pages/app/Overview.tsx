@@ -13,12 +13,14 @@ import {
 } from "lucide-react"
 import { Button } from "@/components/ui/button"
 import { Skeleton } from "@/components/ui/skeleton"
+import BandwidthPanel from "@/components/BandwidthPanel"
 import Panel from "@/components/Panel"
 import SegmentedControl from "@/components/SegmentedControl"
 import RouteLine, {
   connectionRouteName,
   connectionRouteState,
 } from "@/components/RouteLine"
+import { useBandwidth } from "@/hooks/use-bandwidth"
 import { useSetupScript, useTeamOverview, type SetupState } from "@/hooks/use-team-overview"
 import { relativeTime } from "@/lib/humanize"
 import { cn, copyCodeToClipboard } from "@/lib/utils"
@@ -259,6 +261,7 @@ export default function Overview() {
     teamMembers,
     loading,
   } = useTeamOverview(team)
+  const { status: bandwidth } = useBandwidth(team)
   const [setupOpen, setSetupOpen] = useState(false)
 
   // Which page this is depends on whether the team has ever connected, so hold
@@ -503,6 +506,8 @@ export default function Overview() {
         )}
       </Panel>
 
+      {bandwidth && <BandwidthPanel status={bandwidth} />}
+
       <Panel flush>
         <button
           type="button"
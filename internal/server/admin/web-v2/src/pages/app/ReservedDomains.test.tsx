@@ -167,4 +167,43 @@ describe("ReservedDomains", () => {
       expect.objectContaining({ method: "DELETE" }),
     )
   })
+
+  it("shows team reservations without counting them towards the limit", async () => {
+    vi.stubGlobal(
+      "fetch",
+      vi.fn().mockResolvedValue(
+        new Response(
+          JSON.stringify({
+            data: [
+              {
+                subdomain: "api-staging",
+                created_at: "2026-09-23T12:00:00Z",
+                claim_status: "idle",
+                owner: "team",
+                allowed_members: ["sam@example.com"],
+                can_release: false,
+              },
+            ],
+            count: 1,
+            limit: 3,
+            base_domain: "example.test",
+          }),
+          { status: 200, headers: { "Content-Type": "application/json" } },
+        ),
+      ),
+    )
+
+    renderPage()
+
+    expect(
+      await screen.findByText("api-staging.example.test"),
+    ).toBeInTheDocument()
+    expect(
+      screen.getByText(/Team reservation, open to admins and sam@example.com/),
+    ).toBeInTheDocument()
+    expect(screen.getByText("0 / 3")).toBeInTheDocument()
+    expect(
+      screen.queryByRole("button", { name: "Release" }),
+    ).not.toBeInTheDocument()
+  })
 })
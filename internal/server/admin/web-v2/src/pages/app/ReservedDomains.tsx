@@ -25,6 +25,10 @@ export default function ReservedDomains() {
   } = useReservedDomains(team)
   const [releaseTarget, setReleaseTarget] =
     useState<ReservedSubdomain | null>(null)
+  // Team reservations do not count towards the member's limit.
+  const ownReservations = reservations.filter(
+    (reservation) => reservation.owner === "member",
+  )
 
   const reserveAndNotify = async (subdomain: string) => {
     const created = await reserve(subdomain)
@@ -66,7 +70,7 @@ export default function ReservedDomains() {
       <Panel flush>
         <ReservationForm
           baseDomain={baseDomain}
-          count={reservations.length}
+          count={ownReservations.length}
           limit={limit}
           loading={loading}
           submitting={submitting}
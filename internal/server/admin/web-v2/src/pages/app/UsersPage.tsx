@@ -1,6 +1,13 @@
 import { useState, useEffect } from "react";
 import { useParams } from "react-router-dom";
-import { Plus, Mail, MoreHorizontal, Trash2, LoaderCircle } from "lucide-react";
+import {
+  Plus,
+  Mail,
+  MoreHorizontal,
+  ShieldOff,
+  Trash2,
+  LoaderCircle,
+} from "lucide-react";
 import { Button } from "@/components/ui/button";
 import Panel from "@/components/Panel";
 import { Skeleton } from "@/components/ui/skeleton";
@@ -115,6 +122,39 @@ export default function UsersPage() {
     }
   };
 
+  const handleResetTwoFactor = async (teamUser: TeamUser) => {
+    if (!team) return;
+
+    try {
+      const response = await fetch(
+        `/api/v1/team/users/${teamUser.id}/two-factor`,
+        {
+          method: "DELETE",
+          headers: {
+            "x-team-slug": team,
+          },
+        }
+      );
+
+      if (response.ok) {
+        setUsers((prev) =>
+          prev.map((user) =>
+            user.id === teamUser.id
+              ? { ...user, user: { ...user.user, two_factor_enabled: false } }
+              : user
+          )
+        );
+        toast.success("Two-factor authentication reset");
+      } else {
+        const data = await response.json();
+        toast.error(data.error ?? "Failed to reset two-factor authentication");
+      }
+    } catch (error) {
+      console.error("Error resetting two-factor authentication:", error);
+      toast.error("Failed to reset two-factor authentication");
+    }
+  };
+
   const canDeleteUser = (user: TeamUser) => {
     if (!currentUser) return false;
     if (currentUser.role === "member") return false;
@@ -263,6 +303,46 @@ export default function UsersPage() {
                             </Button>
                           </DropdownMenuTrigger>
                           <DropdownMenuContent align="end">
+                            {canDeleteUser(teamUser) &&
+                              teamUser.user.two_factor_enabled && (
+                                <AlertDialog>
+                                  <AlertDialogTrigger asChild>
+                                    <DropdownMenuItem
+                                      className="cursor-pointer"
+                                      onSelect={(e) => e.preventDefault()}
+                                    >
+                                      <ShieldOff className="mr-2 size-4" />
+                                      Reset two-factor
+                                    </DropdownMenuItem>
+                                  </AlertDialogTrigger>
+                                  <AlertDialogContent>
+                                    <AlertDialogHeader>
+                                      <AlertDialogTitle>
+                                        Reset two-factor authentication for{" "}
+                                        {teamUser.user.email}?
+                                      </AlertDialogTitle>
+                                      <AlertDialogDescription>
+                                        Their authenticator and recovery codes
+                                        stop working, and their password alone
+                                        signs them in until they set it up
+                                        again.
+                                      </AlertDialogDescription>
+                                    </AlertDialogHeader>
+                                    <AlertDialogFooter>
+                                      <AlertDialogCancel>
+                                        Cancel
+                                      </AlertDialogCancel>
+                                      <AlertDialogAction
+                                        onClick={() =>
+                                          handleResetTwoFactor(teamUser)
+                                        }
+                                      >
+                                        Reset
+                                      </AlertDialogAction>
+                                    </AlertDialogFooter>
+                                  </AlertDialogContent>
+                                </AlertDialog>
+                              )}
                             {canDeleteUser(teamUser) && (
                               <AlertDialog>
                                 <AlertDialogTrigger asChild>
@@ -27,6 +27,7 @@ interface UpdateAutoSignupSettingsPayload {
 export default function AutoSignupSettings() {
   const [settings, setSettings] = useState<AutoSignupSettingsType>({
     github_auth_enabled: false,
+    oidc_auth_enabled: false,
     auto_signup_enabled: false,
     auto_signup_domains: [],
   })
@@ -64,6 +65,7 @@ export default function AutoSignupSettings() {
       }
       setSettings({
         github_auth_enabled: Boolean(settingsData.github_auth_enabled),
+        oidc_auth_enabled: Boolean(settingsData.oidc_auth_enabled),
         auto_signup_enabled: Boolean(settingsData.auto_signup_enabled),
         auto_signup_domains: Array.isArray(settingsData.auto_signup_domains)
           ? settingsData.auto_signup_domains
@@ -114,6 +116,7 @@ export default function AutoSignupSettings() {
     }))
   }
 
+  const identityProviderEnabled = settings.github_auth_enabled || settings.oidc_auth_enabled
   const completeDomainMappings = settings.auto_signup_domains.filter(
     (mapping) => mapping.domain.trim() !== '' && Boolean(mapping.team_id)
   )
@@ -193,15 +196,15 @@ export default function AutoSignupSettings() {
               <Switch
                 id="auto-signup-enabled"
                 checked={settings.auto_signup_enabled}
-                disabled={!settings.github_auth_enabled && !settings.auto_signup_enabled}
+                disabled={!identityProviderEnabled && !settings.auto_signup_enabled}
                 onCheckedChange={handleAutoSignupEnabledChange}
               />
               <Label htmlFor="auto-signup-enabled">Enable auto signup</Label>
             </div>
 
-            {!settings.github_auth_enabled && (
+            {!identityProviderEnabled && (
               <p className="text-sm text-muted-foreground">
-                GitHub authentication must be configured on the server before auto signup can be enabled.
+                GitHub or OpenID Connect authentication must be configured on the server before auto signup can be enabled.
               </p>
             )}
 
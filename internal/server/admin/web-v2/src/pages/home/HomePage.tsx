@@ -1,6 +1,6 @@
 import { useState, useEffect } from 'react'
 import { useNavigate } from 'react-router-dom'
-import { Github, LoaderCircle, Eye, EyeOff, X } from 'lucide-react'
+import { Github, KeyRound, LoaderCircle, Eye, EyeOff, X } from 'lucide-react'
 import { Button } from '@/components/ui/button'
 import { Checkbox } from '@/components/ui/checkbox'
 import { Input } from '@/components/ui/input'
@@ -13,6 +13,9 @@ import { getResponseMessage } from './auth-errors'
 export default function HomePage() {
   const [isSuperUserSignup, setIsSuperUserSignup] = useState(false)
   const [githubAuthEnabled, setGithubAuthEnabled] = useState(false)
+  const [oidcAuthEnabled, setOidcAuthEnabled] = useState(false)
+  const [oidcName, setOidcName] = useState('SSO')
+  const [passwordLoginEnabled, setPasswordLoginEnabled] = useState(true)
   const [email, setEmail] = useState('')
   const [password, setPassword] = useState('')
   const [emailError, setEmailError] = useState('')
@@ -21,6 +24,9 @@ export default function HomePage() {
   const [showPassword, setShowPassword] = useState(false)
   const [rememberMe, setRememberMe] = useState(false)
   const [message, setMessage] = useState('')
+  const [twoFactorStep, setTwoFactorStep] = useState(false)
+  const [twoFactorCode, setTwoFactorCode] = useState('')
+  const [twoFactorError, setTwoFactorError] = useState('')
 
   const navigate = useNavigate()
 
@@ -37,6 +43,9 @@ export default function HomePage() {
         const data: AuthConfig = await resp.json()
         setIsSuperUserSignup(data.is_first_signup)
         setGithubAuthEnabled(data.github_auth_enabled)
+        setOidcAuthEnabled(data.oidc_auth_enabled)
+        setOidcName(data.oidc_name || 'SSO')
+        setPasswordLoginEnabled(data.password_login_enabled)
       } catch (err) {
         console.error('Failed to get auth config:', err)
       }
@@ -74,8 +83,14 @@ export default function HomePage() {
       })
 
       if (res.ok) {
-        const { redirect_to } = await res.json()
-        navigate(redirect_to)
+        const data = await res.json()
+        if (data.two_factor_required) {
+          setTwoFactorStep(true)
+          setTwoFactorCode('')
+          setTwoFactorError('')
+        } else {
+          navigate(data.redirect_to)
+        }
       } else {
         const data = await res.json()
         setEmailError(data.email ?? '')
@@ -89,10 +104,55 @@ export default function HomePage() {
     }
   }
 
+  const handleTwoFactor = async (e: React.FormEvent) => {
+    e.preventDefault()
+    setTwoFactorError('')
+
+    if (twoFactorCode.trim() === '') {
+      setTwoFactorError('Code is required')
+      return
+    }
+
+    setLoginLoading(true)
+
+    try {
+      const res = await fetch('/api/v1/auth/login/two-factor', {
+        method: 'POST',
+        headers: {
+          'Content-Type': 'application/json',
+        },
+        body: JSON.stringify({ code: twoFactorCode.trim() }),
+      })
+      const data = await res.json()
+
+      if (res.ok) {
+        navigate(data.redirect_to)
+      } else if (res.status === 401) {
+        // The pending sign-in is gone; start again from the password.
+        setTwoFactorStep(false)
+        setPassword('')
+        setPasswordError(data.code ?? '')
+      } else {
+        setTwoFactorError(data.code ?? data.error ?? 'Code is incorrect')
+      }
+    } catch (err) {
+      console.error(err)
+      setTwoFactorError('Could not reach the server. Check that it is running.')
+    } finally {
+      setLoginLoading(false)
+    }
+  }
+
   const nextParam = new URLSearchParams(window.location.search).get('next')
   const githubHref = `/api/v1/auth/github${
     nextParam ? `?next=${encodeURIComponent(nextParam)}` : ''
   }`
+  const oidcHref = `/api/v1/auth/oidc${
+    nextParam ? `?next=${encodeURIComponent(nextParam)}` : ''
+  }`
+  // The first account is always created with a password, so the form stays
+  // for it even when password login is turned off.
+  const showPasswordForm = passwordLoginEnabled || isSuperUserSignup
 
   return (
     <div className="min-h-screen lg:grid lg:grid-cols-[1.05fr_1fr]">
@@ -185,102 +245,160 @@ export default function HomePage() {
             </div>
           )}
 
-          <form className="space-y-5" onSubmit={handleLogin} noValidate>
-            <div className="space-y-2">
-              <Label htmlFor="email">Email address</Label>
-              <Input
-                id="email"
-                type="email"
-                name="email"
-                autoComplete="email"
-                value={email}
-                onChange={(e) => setEmail(e.target.value)}
-                placeholder="name@company.com"
-                aria-invalid={emailError ? true : undefined}
-                aria-describedby={emailError ? 'email-error' : undefined}
-                required
-              />
-              {emailError && (
-                <p id="email-error" role="alert" className="text-sm text-destructive">
-                  {emailError}
+          {twoFactorStep && (
+            <form className="space-y-5" onSubmit={handleTwoFactor} noValidate>
+              <div className="space-y-2">
+                <Label htmlFor="two-factor-code">Authentication code</Label>
+                <Input
+                  id="two-factor-code"
+                  name="code"
+                  autoComplete="one-time-code"
+                  autoFocus
+                  value={twoFactorCode}
+                  onChange={(e) => setTwoFactorCode(e.target.value)}
+                  placeholder="123456"
+                  aria-invalid={twoFactorError ? true : undefined}
+                  aria-describedby="two-factor-hint"
+                  required
+                />
+                <p id="two-factor-hint" className="text-xs text-muted-foreground">
+                  Enter the code from your authenticator app, or one of your
+                  recovery codes.
                 </p>
-              )}
-            </div>
+                {twoFactorError && (
+                  <p role="alert" className="text-sm text-destructive">
+                    {twoFactorError}
+                  </p>
+                )}
+              </div>
+
+              <Button type="submit" disabled={loginLoading} className="w-full">
+                {loginLoading && <LoaderCircle className="size-4 animate-spin" />}
+                {loginLoading ? 'Verifying' : 'Verify'}
+              </Button>
+              <Button
+                type="button"
+                variant="ghost"
+                className="w-full"
+                onClick={() => {
+                  setTwoFactorStep(false)
+                  setPassword('')
+                }}
+              >
+                Back to sign in
+              </Button>
+            </form>
+          )}
 
-            <div className="space-y-2">
-              <Label htmlFor="password">Password</Label>
-              <div className="relative">
+          {showPasswordForm && !twoFactorStep && (
+            <form className="space-y-5" onSubmit={handleLogin} noValidate>
+              <div className="space-y-2">
+                <Label htmlFor="email">Email address</Label>
                 <Input
-                  id="password"
-                  name="password"
-                  type={showPassword ? 'text' : 'password'}
-                  autoComplete={
-                    isSuperUserSignup ? 'new-password' : 'current-password'
-                  }
-                  value={password}
-                  onChange={(e) => setPassword(e.target.value)}
-                  className="pr-10"
-                  aria-invalid={passwordError ? true : undefined}
-                  aria-describedby={passwordError ? 'password-error' : undefined}
+                  id="email"
+                  type="email"
+                  name="email"
+                  autoComplete="email"
+                  value={email}
+                  onChange={(e) => setEmail(e.target.value)}
+                  placeholder="name@company.com"
+                  aria-invalid={emailError ? true : undefined}
+                  aria-describedby={emailError ? 'email-error' : undefined}
                   required
                 />
-                <button
-                  type="button"
-                  aria-label={showPassword ? 'Hide password' : 'Show password'}
-                  aria-pressed={showPassword}
-                  className="absolute top-1/2 right-3 -translate-y-1/2 text-muted-foreground transition-colors hover:text-foreground"
-                  onClick={() => setShowPassword(!showPassword)}
-                >
-                  {showPassword ? (
-                    <EyeOff className="size-4" />
-                  ) : (
-                    <Eye className="size-4" />
-                  )}
-                </button>
+                {emailError && (
+                  <p id="email-error" role="alert" className="text-sm text-destructive">
+                    {emailError}
+                  </p>
+                )}
               </div>
-              {passwordError && (
-                <p
-                  id="password-error"
-                  role="alert"
-                  className="text-sm text-destructive"
-                >
-                  {passwordError}
-                </p>
-              )}
-            </div>
 
-            {!isSuperUserSignup && (
-              <div className="flex items-center gap-2">
-                <Checkbox
-                  id="remember-me"
-                  checked={rememberMe}
-                  onCheckedChange={(checked) => setRememberMe(checked === true)}
-                />
-                <Label htmlFor="remember-me" className="font-normal">
-                  Keep me signed in
-                </Label>
+              <div className="space-y-2">
+                <Label htmlFor="password">Password</Label>
+                <div className="relative">
+                  <Input
+                    id="password"
+                    name="password"
+                    type={showPassword ? 'text' : 'password'}
+                    autoComplete={
+                      isSuperUserSignup ? 'new-password' : 'current-password'
+                    }
+                    value={password}
+                    onChange={(e) => setPassword(e.target.value)}
+                    className="pr-10"
+                    aria-invalid={passwordError ? true : undefined}
+                    aria-describedby={passwordError ? 'password-error' : undefined}
+                    required
+                  />
+                  <button
+                    type="button"
+                    aria-label={showPassword ? 'Hide password' : 'Show password'}
+                    aria-pressed={showPassword}
+                    className="absolute top-1/2 right-3 -translate-y-1/2 text-muted-foreground transition-colors hover:text-foreground"
+                    onClick={() => setShowPassword(!showPassword)}
+                  >
+                    {showPassword ? (
+                      <EyeOff className="size-4" />
+                    ) : (
+                      <Eye className="size-4" />
+                    )}
+                  </button>
+                </div>
+                {passwordError && (
+                  <p
+                    id="password-error"
+                    role="alert"
+                    className="text-sm text-destructive"
+                  >
+                    {passwordError}
+                  </p>
+                )}
               </div>
-            )}
-
-            <Button type="submit" disabled={loginLoading} className="w-full">
-              {loginLoading && <LoaderCircle className="size-4 animate-spin" />}
-              {loginLoading
-                ? isSuperUserSignup
-                  ? 'Creating account'
-                  : 'Signing in'
-                : isSuperUserSignup
-                  ? 'Create account'
-                  : 'Sign in'}
-            </Button>
-          </form>
-
-          {!isSuperUserSignup && (
+
+              {!isSuperUserSignup && (
+                <div className="flex items-center gap-2">
+                  <Checkbox
+                    id="remember-me"
+                    checked={rememberMe}
+                    onCheckedChange={(checked) => setRememberMe(checked === true)}
+                  />
+                  <Label htmlFor="remember-me" className="font-normal">
+                    Keep me signed in
+                  </Label>
+                </div>
+              )}
+
+              <Button type="submit" disabled={loginLoading} className="w-full">
+                {loginLoading && <LoaderCircle className="size-4 animate-spin" />}
+                {loginLoading
+                  ? isSuperUserSignup
+                    ? 'Creating account'
+                    : 'Signing in'
+                  : isSuperUserSignup
+                    ? 'Create account'
+                    : 'Sign in'}
+              </Button>
+            </form>
+          )}
+
+          {!isSuperUserSignup && !twoFactorStep && (
             <>
-              <div className="my-6 flex items-center gap-3">
-                <span className="h-px flex-1 bg-border" />
-                <span className="eyebrow">or</span>
-                <span className="h-px flex-1 bg-border" />
-              </div>
+              {showPasswordForm && (
+                <div className="my-6 flex items-center gap-3">
+                  <span className="h-px flex-1 bg-border" />
+                  <span className="eyebrow">or</span>
+                  <span className="h-px flex-1 bg-border" />
+                </div>
+              )}
+
+              {oidcAuthEnabled && (
+                <Button variant="outline" asChild className="mb-3 w-full">
+                  <a href={oidcHref}>
+                    <KeyRound className="size-4" />
+                    Continue with {oidcName}
+                  </a>
+                </Button>
+              )}
 
               {githubAuthEnabled ? (
                 <Button variant="outline" asChild className="w-full">
@@ -311,9 +429,11 @@ export default function HomePage() {
 
               {/* There is no self-serve reset: the only reset endpoint is
                   POST /team/users/:id/reset-password, behind RequireAdmin. */}
-              <p className="mt-6 text-center text-xs text-muted-foreground">
-                Lost your password? A team admin can reset it for you.
-              </p>
+              {showPasswordForm && (
+                <p className="mt-6 text-center text-xs text-muted-foreground">
+                  Lost your password? A team admin can reset it for you.
+                </p>
+              )}
             </>
           )}
         </div>
@@ -1,6 +1,7 @@
 const FALLBACK = 'Sign in failed. Please try again.'
 
-// Every code here is emitted by internal/server/admin/api/auth/handlers.go.
+// Every code here is emitted by internal/server/admin/api/auth/handlers.go or
+// oidc.go.
 // An unmapped code used to render an empty error box, so the user saw a blank
 // panel instead of a reason — anything unrecognised now falls back.
 export const getResponseMessage = (code: string) => {
@@ -9,7 +10,7 @@ export const getResponseMessage = (code: string) => {
     'github-disabled': 'GitHub sign-in is turned off for this server.',
     'user-not-found': 'You are not a member of any team.',
     'auto-signup-disabled': 'You are not a member of any team.',
-    'auto-signup-domain-denied': 'Your GitHub email is not allowed for automatic signup.',
+    'auto-signup-domain-denied': 'Your email is not allowed for automatic signup.',
     'auto-signup-team-missing': 'Automatic signup is not fully configured.',
     'private-email': 'Your GitHub account does not have a verified email address.',
     'email-verification-failed': 'GitHub email verification is temporarily unavailable. Please try again.',
@@ -20,6 +21,10 @@ export const getResponseMessage = (code: string) => {
     'user-fetch-failed': 'Portr could not read your GitHub profile. Try again.',
     'database-error': 'The server could not complete sign-in. Check the server logs.',
     'session-creation-failed': 'The server could not start your session. Try again.',
+    'oidc-disabled': 'Single sign-on is turned off for this server.',
+    'oidc-unavailable': 'The single sign-on provider could not be reached. Try again.',
+    'oidc-provider-error': 'The single sign-on provider did not sign you in.',
+    'oidc-unverified-email': 'Your single sign-on account does not have a verified email address.',
   }
   return codes[code] ?? FALLBACK
 }
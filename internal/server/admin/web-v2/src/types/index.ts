@@ -4,6 +4,7 @@ export interface User {
   first_name?: string
   last_name?: string
   is_superuser: boolean
+  two_factor_enabled?: boolean
   github_user?: {
     github_avatar_url: string
   }
@@ -13,6 +14,7 @@ export interface Team {
   id: number
   name: string
   slug: string
+  require_two_factor?: boolean
 }
 
 export interface CurrentTeamUser {
@@ -20,6 +22,8 @@ export interface CurrentTeamUser {
   secret_key: string
   role: string
   user: User
+  team?: Team
+  failed_logins?: number
 }
 
 export interface TeamUser {
@@ -34,6 +38,7 @@ export interface TeamUser {
 
 export interface AutoSignupSettings {
   github_auth_enabled: boolean
+  oidc_auth_enabled: boolean
   auto_signup_enabled: boolean
   auto_signup_domains: AutoSignupDomain[]
 }
@@ -48,29 +53,74 @@ export interface AutoSignupDomain {
 export interface AuthConfig {
   is_first_signup: boolean
   github_auth_enabled: boolean
+  oidc_auth_enabled: boolean
+  oidc_name: string
+  password_login_enabled: boolean
+}
+
+export interface TwoFactorStatus {
+  enabled: boolean
+  enabled_at: string | null
+  recovery_codes_left: number
+}
+
+export interface TwoFactorEnrollment {
+  secret: string
+  uri: string
+}
+
+export interface DeviceKey {
+  id: number
+  name: string
+  prefix: string
+  created_at: string
+  expires_at: string | null
+  last_used_at: string | null
+  last_used_ip: string | null
+  revoked_at: string | null
+  key?: string
+  setup_command?: string
 }
 
 export type ConnectionStatus = "reserved" | "active" | "closed"
 export type ConnectionType = "http" | "tcp"
+export type ConnectionCloseReason =
+  | "disconnected"
+  | "server_restart"
+  | "idle_timeout"
+  | "max_lifetime"
+  | "expired"
+  | "force_closed"
+  | "member_removed"
+  | "key_revoked"
 
 export interface Connection {
-  id: number
+  id: string
   type: ConnectionType
   port: number
   subdomain: string
   created_at: string
   started_at: string | null
   closed_at: string | null
+  expires_at: string | null
+  close_reason: ConnectionCloseReason | null
   status: ConnectionStatus
   created_by: TeamUser
+  device_key: string | null
+  tunnel_credential: string | null
 }
 
 export type SubdomainClaimStatus = "idle" | "starting" | "active"
 
+export type ReservationOwner = "member" | "team"
+
 export interface ReservedSubdomain {
   subdomain: string
   created_at: string
   claim_status: SubdomainClaimStatus
+  owner: ReservationOwner
+  allowed_members: string[]
+  can_release: boolean
 }
 
 export interface ReservedSubdomainsResponse {
@@ -119,3 +169,22 @@ export interface ClientTemplate {
   template: string
   updated_at: string | null
 }
+
+/** Limits of 0 mean unlimited; traffic counts both directions. */
+export interface BandwidthAccount {
+  monthly_bytes: number
+  rate_bytes: number
+  used_bytes: number
+}
+
+export interface BandwidthUser extends BandwidthAccount {
+  team_user_id: number
+  email: string
+}
+
+export interface BandwidthStatus {
+  period: string
+  resets_at: string
+  team: BandwidthAccount
+  users: BandwidthUser[]
+}
@@ -0,0 +1,357 @@
+// Package bandwidth meters the traffic of tunnels against the monthly
+// quotas and throughput limits of their teams and team users.
+package bandwidth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"github.com/charmbracelet/log"
+	"golang.org/x/time/rate"
+)
+
+// ErrQuotaExceeded ends the tunnel connections of an account over its
+// monthly quota.
+var ErrQuotaExceeded = errors.New("bandwidth quota exceeded")
+
+const (
+	// warnPercent is the share of a monthly quota at which owners are
+	// warned that their tunnels are about to stop.
+	warnPercent = 80
+	// minBurst and maxBurst bound how many bytes a throttled connection
+	// moves at once.
+	minBurst = 16 << 10
+	maxBurst = 1 << 20
+)
+
+type Store interface {
+	BandwidthSnapshot(ctx context.Context, now time.Time) (*services.BandwidthSnapshot, error)
+	RecordBandwidthUsage(ctx context.Context, usage models.BandwidthUsage) error
+}
+
+// Notifier tells the owners of tunnels about their quota. teamUserID is zero
+// for messages to every member of the team.
+type Notifier interface {
+	Notify(teamID, teamUserID uint, message string)
+}
+
+// bucket holds the limits of a team or team user and the traffic counted
+// against them this month.
+type bucket struct {
+	monthly atomic.Int64
+	used    atomic.Int64
+	limiter atomic.Pointer[rate.Limiter]
+	// warned is the percentage of the quota owners were last warned at.
+	warned atomic.Int32
+}
+
+// exceeded reports whether the bucket used its monthly quota.
+func (b *bucket) exceeded() bool {
+	monthly := b.monthly.Load()
+	return monthly > 0 && b.used.Load() >= monthly
+}
+
+// level is the percentage of the quota worth warning about: 100 when it is
+// used, warnPercent when close, 0 otherwise.
+func (b *bucket) level() int32 {
+	monthly := b.monthly.Load()
+	if monthly <= 0 {
+		return 0
+	}
+	used := b.used.Load()
+	switch {
+	case used >= monthly:
+		return 100
+	case float64(used) >= float64(monthly)*warnPercent/100:
+		return warnPercent
+	}
+	return 0
+}
+
+// crossed returns the level the bucket newly reached, or 0 when owners were
+// already warned at it.
+func (b *bucket) crossed() int32 {
+	level := b.level()
+	for {
+		warned := b.warned.Load()
+		if level <= warned {
+			return 0
+		}
+		if b.warned.CompareAndSwap(warned, level) {
+			return level
+		}
+	}
+}
+
+// setLimits applies limits read from the database, keeping the limiter when
+// the throughput limit is unchanged.
+func (b *bucket) setLimits(limits models.BandwidthLimits) {
+	b.monthly.Store(limits.MonthlyBytes)
+	current := b.limiter.Load()
+	switch {
+	case limits.RateBytes <= 0:
+		b.limiter.Store(nil)
+	case current == nil || current.Limit() != rate.Limit(limits.RateBytes):
+		burst := int(min(max(limits.RateBytes, minBurst), maxBurst))
+		b.limiter.Store(rate.NewLimiter(rate.Limit(limits.RateBytes), burst))
+	}
+	// A raised limit or a new month warns owners again as they approach it.
+	for {
+		warned := b.warned.Load()
+		level := b.level()
+		if warned <= level || b.warned.CompareAndSwap(warned, level) {
+			return
+		}
+	}
+}
+
+// Account is the traffic of one team user's tunnels.
+type Account struct {
+	meter      *Meter
+	teamID     uint
+	teamUserID uint
+	team       *bucket
+	user       *bucket
+	// pending is the traffic not yet saved to the database.
+	pending atomic.Int64
+}
+
+// Exceeded reports whether the team user or their team used the month's
+// quota. A nil account has no quota.
+func (a *Account) Exceeded() bool {
+	return a != nil && (a.user.exceeded() || a.team.exceeded())
+}
+
+// Reader counts what is read from r against the account, throttles it to
+// the throughput limits, and fails once the monthly quota is used.
+func (a *Account) Reader(r io.Reader) io.Reader {
+	if a == nil {
+		return r
+	}
+	return &meteredReader{account: a, reader: r}
+}
+
+func (a *Account) count(n int) {
+	a.pending.Add(int64(n))
+	a.user.used.Add(int64(n))
+	a.team.used.Add(int64(n))
+	if level := a.user.crossed(); level != 0 {
+		a.meter.notify(a.teamID, a.teamUserID, a.user, level)
+	}
+	if level := a.team.crossed(); level != 0 {
+		a.meter.notify(a.teamID, 0, a.team, level)
+	}
+}
+
+// burst is the most a read may take at once under the throughput limits, or
+// 0 when there are none.
+func (a *Account) burst() int {
+	burst := 0
+	for _, limiter := range a.limiters() {
+		if burst == 0 || limiter.Burst() < burst {
+			burst = limiter.Burst()
+		}
+	}
+	return burst
+}
+
+func (a *Account) limiters() []*rate.Limiter {
+	var limiters []*rate.Limiter
+	if limiter := a.user.limiter.Load(); limiter != nil {
+		limiters = append(limiters, limiter)
+	}
+	if limiter := a.team.limiter.Load(); limiter != nil {
+		limiters = append(limiters, limiter)
+	}
+	return limiters
+}
+
+type meteredReader struct {
+	account *Account
+	reader  io.Reader
+}
+
+func (m *meteredReader) Read(p []byte) (int, error) {
+	if m.account.Exceeded() {
+		return 0, ErrQuotaExceeded
+	}
+	if burst := m.account.burst(); burst > 0 && len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := m.reader.Read(p)
+	if n > 0 {
+		m.account.count(n)
+		for _, limiter := range m.account.limiters() {
+			// The limiter may have been replaced with a smaller burst since
+			// the read was sized.
+			_ = limiter.WaitN(context.Background(), min(n, limiter.Burst()))
+		}
+	}
+	return n, err
+}
+
+// Meter keeps the accounts of the team users with tunnels on this server.
+// Limits and the traffic of other servers are read from the database on
+// every Sync, so changes take up to one interval to apply.
+type Meter struct {
+	store Store
+
+	mu       sync.Mutex
+	notifier Notifier
+	teams    map[uint]*bucket
+	accounts map[uint]*Account
+	// snapshot is the last state read from the database, which new accounts
+	// start from.
+	snapshot *services.BandwidthSnapshot
+}
+
+func New(store Store) *Meter {
+	return &Meter{
+		store:    store,
+		teams:    make(map[uint]*bucket),
+		accounts: make(map[uint]*Account),
+	}
+}
+
+// SetNotifier installs what tells owners they are close to or over a quota.
+func (m *Meter) SetNotifier(notifier Notifier) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notifier = notifier
+}
+
+// Account returns the account of a team user.
+func (m *Meter) Account(teamID, teamUserID uint) *Account {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if account, ok := m.accounts[teamUserID]; ok {
+		return account
+	}
+	team, ok := m.teams[teamID]
+	if !ok {
+		team = &bucket{}
+		if m.snapshot != nil {
+			team.used.Store(m.snapshot.Teams[teamID].UsedBytes)
+			team.setLimits(m.snapshot.Teams[teamID].BandwidthLimits)
+		}
+		m.teams[teamID] = team
+	}
+	account := &Account{meter: m, teamID: teamID, teamUserID: teamUserID, team: team, user: &bucket{}}
+	if m.snapshot != nil {
+		account.user.used.Store(m.snapshot.Users[teamUserID].UsedBytes)
+		account.user.setLimits(m.snapshot.Users[teamUserID].BandwidthLimits)
+	}
+	m.accounts[teamUserID] = account
+	return account
+}
+
+// Sync saves the traffic counted since the last sync, then reloads limits
+// and the traffic of the month so far.
+func (m *Meter) Sync(ctx context.Context) {
+	m.Flush(ctx)
+	m.Refresh(ctx)
+}
+
+// Flush adds the traffic counted since the last flush to the month's usage.
+// Traffic that fails to save is kept for the next flush.
+func (m *Meter) Flush(ctx context.Context) {
+	period := models.BandwidthPeriod(time.Now())
+	for _, account := range m.allAccounts() {
+		bytes := account.pending.Swap(0)
+		if bytes == 0 {
+			continue
+		}
+		err := m.store.RecordBandwidthUsage(ctx, models.BandwidthUsage{
+			TeamID:     account.teamID,
+			TeamUserID: account.teamUserID,
+			Period:     period,
+			Bytes:      bytes,
+		})
+		if err != nil {
+			log.Error("Failed to save bandwidth usage", "team_user_id", account.teamUserID, "error", err)
+			account.pending.Add(bytes)
+		}
+	}
+}
+
+// Refresh reloads limits and the month's traffic, adding the traffic not
+// yet saved. At the start of a month this resets the counts.
+func (m *Meter) Refresh(ctx context.Context) {
+	snapshot, err := m.store.BandwidthSnapshot(ctx, time.Now())
+	if err != nil {
+		log.Error("Failed to load bandwidth limits", "error", err)
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshot = snapshot
+	teamPending := make(map[uint]int64, len(m.teams))
+	for teamUserID, account := range m.accounts {
+		pending := account.pending.Load()
+		teamPending[account.teamID] += pending
+		user := snapshot.Users[teamUserID]
+		account.user.used.Store(user.UsedBytes + pending)
+		account.user.setLimits(user.BandwidthLimits)
+	}
+	for teamID, team := range m.teams {
+		account := snapshot.Teams[teamID]
+		team.used.Store(account.UsedBytes + teamPending[teamID])
+		team.setLimits(account.BandwidthLimits)
+	}
+}
+
+func (m *Meter) allAccounts() []*Account {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	accounts := make([]*Account, 0, len(m.accounts))
+	for _, account := range m.accounts {
+		accounts = append(accounts, account)
+	}
+	return accounts
+}
+
+func (m *Meter) notify(teamID, teamUserID uint, b *bucket, level int32) {
+	m.mu.Lock()
+	notifier := m.notifier
+	m.mu.Unlock()
+	if notifier == nil {
+		return
+	}
+	message := warningMessage(teamUserID == 0, level, b.monthly.Load(), time.Now())
+	log.Info("Bandwidth quota warning", "team_id", teamID, "team_user_id", teamUserID, "percent", level)
+	go notifier.Notify(teamID, teamUserID, message)
+}
+
+func warningMessage(team bool, level int32, monthly int64, now time.Time) string {
+	tunnels, quota := "Your tunnels", "your monthly bandwidth"
+	if team {
+		tunnels, quota = "Your team's tunnels", "the team's monthly bandwidth"
+	}
+	if level >= 100 {
+		return fmt.Sprintf("%s have used %s of %s and are paused until %s",
+			tunnels, quota, FormatBytes(monthly), models.BandwidthResetsAt(now).Format("January 2"))
+	}
+	return fmt.Sprintf("%s have used %d%% of %s of %s", tunnels, level, quota, FormatBytes(monthly))
+}
+
+// FormatBytes formats a byte count with binary units, as "1.5 GiB".
+func FormatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
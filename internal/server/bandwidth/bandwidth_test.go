@@ -0,0 +1,175 @@
+package bandwidth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+)
+
+type fakeStore struct {
+	snapshot *services.BandwidthSnapshot
+	recorded []models.BandwidthUsage
+	fail     bool
+}
+
+func (f *fakeStore) BandwidthSnapshot(context.Context, time.Time) (*services.BandwidthSnapshot, error) {
+	return f.snapshot, nil
+}
+
+func (f *fakeStore) RecordBandwidthUsage(_ context.Context, usage models.BandwidthUsage) error {
+	if f.fail {
+		return errors.New("database is down")
+	}
+	f.recorded = append(f.recorded, usage)
+	return nil
+}
+
+type fakeNotifier struct {
+	messages chan string
+}
+
+func (f *fakeNotifier) Notify(teamID, teamUserID uint, message string) {
+	f.messages <- message
+}
+
+func snapshot(teams, users map[uint]services.BandwidthAccount) *services.BandwidthSnapshot {
+	return &services.BandwidthSnapshot{Period: models.BandwidthPeriod(time.Now()), Teams: teams, Users: users}
+}
+
+func TestReaderStopsOnceTheMonthlyQuotaIsUsed(t *testing.T) {
+	store := &fakeStore{snapshot: snapshot(nil, map[uint]services.BandwidthAccount{
+		7: {BandwidthLimits: models.BandwidthLimits{MonthlyBytes: 1000}, UsedBytes: 900},
+	})}
+	meter := New(store)
+	meter.Refresh(context.Background())
+	account := meter.Account(1, 7)
+
+	n, err := account.Reader(strings.NewReader(strings.Repeat("x", 150))).Read(make([]byte, 150))
+	if err != nil || n != 150 {
+		t.Fatalf("expected the read that crosses the quota to finish, got %d bytes and %v", n, err)
+	}
+	if !account.Exceeded() {
+		t.Fatal("expected the account to be over quota")
+	}
+	if _, err := account.Reader(strings.NewReader("more")).Read(make([]byte, 4)); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+	// Another member of the team is not limited by this member's quota.
+	if meter.Account(1, 8).Exceeded() {
+		t.Fatal("expected only the member over quota to be stopped")
+	}
+}
+
+func TestTeamQuotaCountsEveryMember(t *testing.T) {
+	store := &fakeStore{snapshot: snapshot(map[uint]services.BandwidthAccount{
+		1: {BandwidthLimits: models.BandwidthLimits{MonthlyBytes: 100}},
+	}, nil)}
+	meter := New(store)
+	meter.Refresh(context.Background())
+
+	_, _ = io.Copy(io.Discard, meter.Account(1, 7).Reader(bytes.NewReader(make([]byte, 60))))
+	_, _ = io.Copy(io.Discard, meter.Account(1, 8).Reader(bytes.NewReader(make([]byte, 60))))
+
+	if !meter.Account(1, 9).Exceeded() {
+		t.Fatal("expected the team quota to stop every member")
+	}
+	if meter.Account(2, 10).Exceeded() {
+		t.Fatal("expected other teams to be unaffected")
+	}
+}
+
+func TestOwnersAreWarnedOnceAtEachLevel(t *testing.T) {
+	store := &fakeStore{snapshot: snapshot(nil, map[uint]services.BandwidthAccount{
+		7: {BandwidthLimits: models.BandwidthLimits{MonthlyBytes: 1 << 20}},
+	})}
+	meter := New(store)
+	notifier := &fakeNotifier{messages: make(chan string, 4)}
+	meter.SetNotifier(notifier)
+	meter.Refresh(context.Background())
+	account := meter.Account(1, 7)
+
+	read := func(n int) {
+		_, _ = io.Copy(io.Discard, account.Reader(bytes.NewReader(make([]byte, n))))
+	}
+	read(800 << 10)
+	read(30 << 10)
+	if message := <-notifier.messages; !strings.Contains(message, "80% of your monthly bandwidth of 1.0 MiB") {
+		t.Fatalf("unexpected warning %q", message)
+	}
+	read(300 << 10)
+	if message := <-notifier.messages; !strings.Contains(message, "are paused until") {
+		t.Fatalf("unexpected warning %q", message)
+	}
+	select {
+	case message := <-notifier.messages:
+		t.Fatalf("expected one warning per level, got %q", message)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestFlushKeepsUsageThatFailsToSave(t *testing.T) {
+	store := &fakeStore{snapshot: snapshot(nil, nil), fail: true}
+	meter := New(store)
+	account := meter.Account(1, 7)
+	_, _ = io.Copy(io.Discard, account.Reader(bytes.NewReader(make([]byte, 40))))
+
+	meter.Flush(context.Background())
+	store.fail = false
+	meter.Flush(context.Background())
+	meter.Flush(context.Background())
+
+	if len(store.recorded) != 1 {
+		t.Fatalf("expected one saved row, got %v", store.recorded)
+	}
+	usage := store.recorded[0]
+	if usage.TeamID != 1 || usage.TeamUserID != 7 || usage.Bytes != 40 || usage.Period != models.BandwidthPeriod(time.Now()) {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+}
+
+func TestRefreshKeepsUnsavedTrafficAndAppliesNewLimits(t *testing.T) {
+	store := &fakeStore{snapshot: snapshot(nil, nil)}
+	meter := New(store)
+	account := meter.Account(1, 7)
+	_, _ = io.Copy(io.Discard, account.Reader(bytes.NewReader(make([]byte, 40))))
+
+	store.snapshot = snapshot(nil, map[uint]services.BandwidthAccount{
+		7: {BandwidthLimits: models.BandwidthLimits{MonthlyBytes: 100, RateBytes: 1 << 30}, UsedBytes: 60},
+	})
+	meter.Refresh(context.Background())
+	if !account.Exceeded() {
+		t.Fatal("expected saved and unsaved traffic together to use the quota")
+	}
+	if account.burst() != maxBurst {
+		t.Fatalf("expected the throughput limit to apply with burst %d, got %d", maxBurst, account.burst())
+	}
+
+	store.snapshot = snapshot(nil, nil)
+	meter.Refresh(context.Background())
+	if account.Exceeded() || account.burst() != 0 {
+		t.Fatal("expected removed limits to stop applying")
+	}
+}
+
+func TestReaderThrottlesToTheRateLimit(t *testing.T) {
+	store := &fakeStore{snapshot: snapshot(nil, map[uint]services.BandwidthAccount{
+		7: {BandwidthLimits: models.BandwidthLimits{RateBytes: 64 << 10}},
+	})}
+	meter := New(store)
+	meter.Refresh(context.Background())
+
+	start := time.Now()
+	// The first 64 KiB pass in the initial burst; the next 32 KiB wait for
+	// half a second of throughput.
+	_, _ = io.Copy(io.Discard, meter.Account(1, 7).Reader(bytes.NewReader(make([]byte, 96<<10))))
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("expected the copy to be throttled, took %s", elapsed)
+	}
+}
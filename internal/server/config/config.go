@@ -2,18 +2,27 @@ package config
 
 import (
 	"fmt"
+	"net/netip"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/amalshaji/portr/internal/tracing"
 	"github.com/charmbracelet/log"
-	_ "github.com/joho/godotenv/autoload"
 )
 
 type SshConfig struct {
 	Host    string
 	Port    int
 	HostKey string
+	// DrainTimeout bounds how long a process that handed its listeners to a
+	// replacement keeps serving existing tunnels.
+	DrainTimeout time.Duration
+	// IdleTimeout closes tunnels that carried no traffic for this long. Zero
+	// leaves idle tunnels open.
+	IdleTimeout time.Duration
 }
 
 func (s SshConfig) Address() string {
@@ -23,6 +32,12 @@ func (s SshConfig) Address() string {
 type ProxyConfig struct {
 	Host string
 	Port int
+	// Compression lets the proxy gzip or brotli responses for visitors that
+	// accept them.
+	Compression bool
+	// CacheMaxBytes bounds the memory of the shared response cache. Zero
+	// leaves the cache off.
+	CacheMaxBytes int64
 }
 
 func (p ProxyConfig) Address() string {
@@ -35,6 +50,14 @@ type DatabaseConfig struct {
 	AutoMigrate bool
 }
 
+// AccessLogConfig controls the record of requests the proxy serves from
+// tunnels.
+type AccessLogConfig struct {
+	Enabled bool
+	// Retention is how long entries are kept before they are pruned.
+	Retention time.Duration
+}
+
 type AdminConfig struct {
 	Port                   int
 	Domain                 string
@@ -44,6 +67,19 @@ type AdminConfig struct {
 	UseVite                bool
 	GithubClientID         string
 	GithubSecret           string
+	// OIDC configures login with an OpenID Connect provider.
+	OIDC OIDCConfig
+	// PasswordLoginDisabled turns off email and password login, leaving only
+	// the OpenID Connect provider.
+	PasswordLoginDisabled bool
+	// SecretKeyAuth lets tunnel secret keys authenticate user and SSH key
+	// management as bearer tokens, as they did before API tokens. It is off
+	// unless PORTR_ADMIN_SECRET_KEY_AUTH is true.
+	SecretKeyAuth bool
+	// TrustedProxies are the addresses, as IPs or CIDRs, of reverse proxies
+	// whose X-Forwarded-For header names the client, for throttling and the
+	// audit log.
+	TrustedProxies         []string
 	ServerURL              string
 	SshURL                 string
 	SshHostKeyVerification bool
@@ -57,6 +93,21 @@ func (c *AdminConfig) DomainAddress() string {
 	return "https://" + c.Domain
 }
 
+// OIDCConfig is an OpenID Connect provider, found through the discovery
+// document of its issuer.
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// Name is what the login page calls the provider.
+	Name string
+}
+
+// Enabled reports whether OpenID Connect login is configured.
+func (o OIDCConfig) Enabled() bool {
+	return o.Issuer != "" && o.ClientID != ""
+}
+
 type Config struct {
 	Ssh          SshConfig
 	Proxy        ProxyConfig
@@ -65,16 +116,20 @@ type Config struct {
 	Debug        bool
 	Database     DatabaseConfig
 	Admin        AdminConfig
+	AccessLog    AccessLogConfig
+	// OTLPEndpoint is the OTLP/HTTP collector spans are exported to. Empty
+	// leaves tracing off.
+	OTLPEndpoint string
 }
 
-func new() *Config {
+func parse() (*Config, error) {
 	sshPortStr := os.Getenv("PORTR_SSH_PORT")
 	if sshPortStr == "" {
 		sshPortStr = "2222"
 	}
 	sshPort, err := strconv.Atoi(sshPortStr)
 	if err != nil {
-		log.Fatal("Invalid PORTR_SSH_PORT", "port", sshPortStr, "error", err)
+		return nil, fmt.Errorf("invalid PORTR_SSH_PORT %q: %w", sshPortStr, err)
 	}
 
 	proxyPortStr := os.Getenv("PORTR_PROXY_PORT")
@@ -83,7 +138,7 @@ func new() *Config {
 	}
 	proxyPort, err := strconv.Atoi(proxyPortStr)
 	if err != nil {
-		log.Fatal("Invalid PORTR_PROXY_PORT", "port", proxyPortStr, "error", err)
+		return nil, fmt.Errorf("invalid PORTR_PROXY_PORT %q: %w", proxyPortStr, err)
 	}
 
 	domain := os.Getenv("PORTR_DOMAIN")
@@ -93,7 +148,7 @@ func new() *Config {
 
 	dbUrl := os.Getenv("PORTR_DB_URL")
 	if dbUrl == "" {
-		log.Fatal("PORTR_DB_URL is required")
+		return nil, fmt.Errorf("PORTR_DB_URL is required")
 	}
 
 	dbDriver := strings.Split(os.Getenv("PORTR_DB_URL"), "://")[0]
@@ -105,7 +160,7 @@ func new() *Config {
 	}
 	adminPort, err := strconv.Atoi(adminPortStr)
 	if err != nil {
-		log.Fatal("Invalid PORTR_ADMIN_PORT", "port", adminPortStr, "error", err)
+		return nil, fmt.Errorf("invalid PORTR_ADMIN_PORT %q: %w", adminPortStr, err)
 	}
 
 	adminDomain := os.Getenv("PORTR_DOMAIN")
@@ -125,24 +180,97 @@ func new() *Config {
 
 	sshHostKey := os.Getenv("PORTR_SSH_HOST_KEY")
 
+	drainTimeoutStr := os.Getenv("PORTR_SSH_DRAIN_TIMEOUT")
+	if drainTimeoutStr == "" {
+		drainTimeoutStr = "5m"
+	}
+	drainTimeout, err := time.ParseDuration(drainTimeoutStr)
+	if err != nil || drainTimeout < 0 {
+		return nil, fmt.Errorf("invalid PORTR_SSH_DRAIN_TIMEOUT %q", drainTimeoutStr)
+	}
+
+	idleTimeoutStr := os.Getenv("PORTR_SSH_IDLE_TIMEOUT")
+	if idleTimeoutStr == "" {
+		idleTimeoutStr = "0"
+	}
+	idleTimeout, err := time.ParseDuration(idleTimeoutStr)
+	if err != nil || idleTimeout < 0 {
+		return nil, fmt.Errorf("invalid PORTR_SSH_IDLE_TIMEOUT %q", idleTimeoutStr)
+	}
+
+	accessLogRetentionStr := os.Getenv("PORTR_ACCESS_LOG_RETENTION")
+	if accessLogRetentionStr == "" {
+		accessLogRetentionStr = "168h"
+	}
+	accessLogRetention, err := time.ParseDuration(accessLogRetentionStr)
+	if err != nil || accessLogRetention <= 0 {
+		return nil, fmt.Errorf("invalid PORTR_ACCESS_LOG_RETENTION %q", accessLogRetentionStr)
+	}
+
+	otlpEndpoint, err := tracing.ParseEndpoint(os.Getenv("PORTR_OTEL_ENDPOINT"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PORTR_OTEL_ENDPOINT: %w", err)
+	}
+
+	cacheSizeStr := os.Getenv("PORTR_PROXY_CACHE_MB")
+	if cacheSizeStr == "" {
+		cacheSizeStr = "0"
+	}
+	cacheSize, err := strconv.ParseInt(cacheSizeStr, 10, 64)
+	if err != nil || cacheSize < 0 || cacheSize > 1<<20 {
+		return nil, fmt.Errorf("invalid PORTR_PROXY_CACHE_MB %q", cacheSizeStr)
+	}
+
 	reservedSubdomainLimitStr := os.Getenv("PORTR_RESERVED_SUBDOMAIN_LIMIT")
 	if reservedSubdomainLimitStr == "" {
 		reservedSubdomainLimitStr = "3"
 	}
 	reservedSubdomainLimit, err := strconv.Atoi(reservedSubdomainLimitStr)
 	if err != nil || reservedSubdomainLimit < 0 {
-		log.Fatal("Invalid PORTR_RESERVED_SUBDOMAIN_LIMIT", "limit", reservedSubdomainLimitStr)
+		return nil, fmt.Errorf("invalid PORTR_RESERVED_SUBDOMAIN_LIMIT %q", reservedSubdomainLimitStr)
+	}
+
+	oidc := OIDCConfig{
+		Issuer:       strings.TrimSuffix(os.Getenv("PORTR_ADMIN_OIDC_ISSUER"), "/"),
+		ClientID:     os.Getenv("PORTR_ADMIN_OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("PORTR_ADMIN_OIDC_CLIENT_SECRET"),
+		Name:         os.Getenv("PORTR_ADMIN_OIDC_NAME"),
+	}
+	if oidc.Name == "" {
+		oidc.Name = "SSO"
+	}
+	if oidc.Issuer != "" {
+		issuer, err := url.Parse(oidc.Issuer)
+		if err != nil || (issuer.Scheme != "https" && issuer.Scheme != "http") || issuer.Host == "" {
+			return nil, fmt.Errorf("invalid PORTR_ADMIN_OIDC_ISSUER %q", oidc.Issuer)
+		}
+		if oidc.ClientID == "" {
+			return nil, fmt.Errorf("PORTR_ADMIN_OIDC_CLIENT_ID is required with PORTR_ADMIN_OIDC_ISSUER")
+		}
+	}
+	passwordLoginDisabled := os.Getenv("PORTR_ADMIN_DISABLE_PASSWORD_LOGIN") == "true"
+	if passwordLoginDisabled && !oidc.Enabled() {
+		return nil, fmt.Errorf("PORTR_ADMIN_DISABLE_PASSWORD_LOGIN requires PORTR_ADMIN_OIDC_ISSUER")
+	}
+
+	trustedProxies, err := parseTrustedProxies(os.Getenv("PORTR_ADMIN_TRUSTED_PROXIES"))
+	if err != nil {
+		return nil, err
 	}
 
 	return &Config{
 		Ssh: SshConfig{
-			Host:    "localhost",
-			Port:    sshPort,
-			HostKey: sshHostKey,
+			Host:         "localhost",
+			Port:         sshPort,
+			HostKey:      sshHostKey,
+			DrainTimeout: drainTimeout,
+			IdleTimeout:  idleTimeout,
 		},
 		Proxy: ProxyConfig{
-			Host: "localhost",
-			Port: proxyPort,
+			Host:          "localhost",
+			Port:          proxyPort,
+			Compression:   os.Getenv("PORTR_PROXY_COMPRESSION") != "false",
+			CacheMaxBytes: cacheSize << 20,
 		},
 		Domain:       domain,
 		UseLocalHost: os.Getenv("PORTR_TUNNEL_USE_LOCALHOST") == "true",
@@ -161,11 +289,38 @@ func new() *Config {
 			UseVite:                os.Getenv("PORTR_ADMIN_USE_VITE") == "true",
 			GithubClientID:         os.Getenv("PORTR_ADMIN_GITHUB_CLIENT_ID"),
 			GithubSecret:           os.Getenv("PORTR_ADMIN_GITHUB_CLIENT_SECRET"),
+			OIDC:                   oidc,
+			PasswordLoginDisabled:  passwordLoginDisabled,
+			SecretKeyAuth:          os.Getenv("PORTR_ADMIN_SECRET_KEY_AUTH") == "true",
+			TrustedProxies:         trustedProxies,
 			ServerURL:              serverURL,
 			SshURL:                 sshURL,
 			SshHostKeyVerification: sshHostKey != "",
 		},
+		AccessLog: AccessLogConfig{
+			Enabled:   os.Getenv("PORTR_ACCESS_LOG") == "true",
+			Retention: accessLogRetention,
+		},
+		OTLPEndpoint: otlpEndpoint,
+	}, nil
+}
+
+// parseTrustedProxies parses a comma-separated list of IPs and CIDRs.
+func parseTrustedProxies(value string) ([]string, error) {
+	var proxies []string
+	for _, proxy := range strings.Split(value, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if _, err := netip.ParsePrefix(proxy); err != nil {
+			if _, err := netip.ParseAddr(proxy); err != nil {
+				return nil, fmt.Errorf("invalid PORTR_ADMIN_TRUSTED_PROXIES entry %q", proxy)
+			}
+		}
+		proxies = append(proxies, proxy)
 	}
+	return proxies, nil
 }
 
 func (c *Config) HttpTunnelUrl(subdomain string) string {
@@ -198,5 +353,9 @@ func (c Config) ExtractSubdomain(url string) string {
 }
 
 func Load(path string) *Config {
-	return new()
+	config, err := parse()
+	if err != nil {
+		log.Fatal("Invalid configuration", "error", err)
+	}
+	return config
 }
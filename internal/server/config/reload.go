@@ -0,0 +1,249 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/joho/godotenv"
+)
+
+// liveMu guards the settings that Apply may change while portrd is running.
+// Request handlers read them through the accessor methods below.
+var liveMu sync.RWMutex
+
+var (
+	// processEnv holds the variables set by the real environment at startup.
+	// A reload re-reads .env but never overrides these, matching the
+	// precedence godotenv.Load gives them on boot.
+	processEnv = map[string]bool{}
+	// fileEnv holds the variables most recently applied from .env, so a
+	// reload can unset the ones that were removed from the file.
+	fileEnv  = map[string]bool{}
+	reloadMu sync.Mutex
+)
+
+func init() {
+	for _, entry := range os.Environ() {
+		key, _, _ := strings.Cut(entry, "=")
+		processEnv[key] = true
+	}
+	if values, err := godotenv.Read(); err == nil {
+		applyEnvFile(values)
+	}
+}
+
+// ReloadReport lists the settings that changed on reload. Applied settings
+// are in effect immediately; the rest are picked up on the next restart.
+type ReloadReport struct {
+	Applied         []string `json:"applied"`
+	RequiresRestart []string `json:"requires_restart"`
+}
+
+// ReloadFunc reloads the configuration of the running process.
+type ReloadFunc func() (ReloadReport, error)
+
+// ErrReloadUnavailable is returned when no reload function is installed.
+var ErrReloadUnavailable = errors.New("config reload is not available")
+
+type setting struct {
+	env   string
+	value func(*Config) string
+	// apply copies the setting from src into dst. Settings without one
+	// require a restart.
+	apply func(dst, src *Config)
+}
+
+var settings = []setting{
+	{env: "PORTR_SSH_PORT", value: func(c *Config) string { return fmt.Sprint(c.Ssh.Port) }},
+	{env: "PORTR_SSH_HOST_KEY", value: func(c *Config) string { return c.Ssh.HostKey }},
+	{env: "PORTR_SSH_DRAIN_TIMEOUT", value: func(c *Config) string { return c.Ssh.DrainTimeout.String() }},
+	{env: "PORTR_SSH_IDLE_TIMEOUT", value: func(c *Config) string { return c.Ssh.IdleTimeout.String() }},
+	{env: "PORTR_PROXY_PORT", value: func(c *Config) string { return fmt.Sprint(c.Proxy.Port) }},
+	{env: "PORTR_PROXY_COMPRESSION", value: func(c *Config) string { return fmt.Sprint(c.Proxy.Compression) }},
+	{env: "PORTR_PROXY_CACHE_MB", value: func(c *Config) string { return fmt.Sprint(c.Proxy.CacheMaxBytes >> 20) }},
+	{env: "PORTR_DOMAIN", value: func(c *Config) string { return c.Domain }},
+	{env: "PORTR_TUNNEL_USE_LOCALHOST", value: func(c *Config) string { return fmt.Sprint(c.UseLocalHost) }},
+	{env: "PORTR_TUNNEL_DEBUG", value: func(c *Config) string { return fmt.Sprint(c.Debug) }},
+	{env: "PORTR_DB_URL", value: func(c *Config) string { return c.Database.Url }},
+	{env: "PORTR_AUTO_MIGRATE", value: func(c *Config) string { return fmt.Sprint(c.Database.AutoMigrate) }},
+	{env: "PORTR_ADMIN_PORT", value: func(c *Config) string { return fmt.Sprint(c.Admin.Port) }},
+	{env: "PORTR_ADMIN_DEBUG", value: func(c *Config) string { return fmt.Sprint(c.Admin.Debug) }},
+	{env: "PORTR_ADMIN_USE_VITE", value: func(c *Config) string { return fmt.Sprint(c.Admin.UseVite) }},
+	{env: "PORTR_ADMIN_TRUSTED_PROXIES", value: func(c *Config) string { return strings.Join(c.Admin.TrustedProxies, ",") }},
+	{env: "PORTR_ACCESS_LOG", value: func(c *Config) string { return fmt.Sprint(c.AccessLog.Enabled) }},
+	{env: "PORTR_ACCESS_LOG_RETENTION", value: func(c *Config) string { return c.AccessLog.Retention.String() }},
+	{env: "PORTR_OTEL_ENDPOINT", value: func(c *Config) string { return c.OTLPEndpoint }},
+	{
+		env:   "PORTR_RESERVED_SUBDOMAIN_LIMIT",
+		value: func(c *Config) string { return fmt.Sprint(c.Admin.ReservedSubdomainLimit) },
+		apply: func(dst, src *Config) { dst.Admin.ReservedSubdomainLimit = src.Admin.ReservedSubdomainLimit },
+	},
+	{
+		env:   "PORTR_ADMIN_GITHUB_CLIENT_ID",
+		value: func(c *Config) string { return c.Admin.GithubClientID },
+		apply: func(dst, src *Config) { dst.Admin.GithubClientID = src.Admin.GithubClientID },
+	},
+	{
+		env:   "PORTR_ADMIN_GITHUB_CLIENT_SECRET",
+		value: func(c *Config) string { return c.Admin.GithubSecret },
+		apply: func(dst, src *Config) { dst.Admin.GithubSecret = src.Admin.GithubSecret },
+	},
+	{
+		env:   "PORTR_ADMIN_OIDC_ISSUER",
+		value: func(c *Config) string { return c.Admin.OIDC.Issuer },
+		apply: func(dst, src *Config) { dst.Admin.OIDC.Issuer = src.Admin.OIDC.Issuer },
+	},
+	{
+		env:   "PORTR_ADMIN_OIDC_CLIENT_ID",
+		value: func(c *Config) string { return c.Admin.OIDC.ClientID },
+		apply: func(dst, src *Config) { dst.Admin.OIDC.ClientID = src.Admin.OIDC.ClientID },
+	},
+	{
+		env:   "PORTR_ADMIN_OIDC_CLIENT_SECRET",
+		value: func(c *Config) string { return c.Admin.OIDC.ClientSecret },
+		apply: func(dst, src *Config) { dst.Admin.OIDC.ClientSecret = src.Admin.OIDC.ClientSecret },
+	},
+	{
+		env:   "PORTR_ADMIN_OIDC_NAME",
+		value: func(c *Config) string { return c.Admin.OIDC.Name },
+		apply: func(dst, src *Config) { dst.Admin.OIDC.Name = src.Admin.OIDC.Name },
+	},
+	{
+		env:   "PORTR_ADMIN_DISABLE_PASSWORD_LOGIN",
+		value: func(c *Config) string { return fmt.Sprint(c.Admin.PasswordLoginDisabled) },
+		apply: func(dst, src *Config) { dst.Admin.PasswordLoginDisabled = src.Admin.PasswordLoginDisabled },
+	},
+	{
+		env:   "PORTR_ADMIN_SECRET_KEY_AUTH",
+		value: func(c *Config) string { return fmt.Sprint(c.Admin.SecretKeyAuth) },
+		apply: func(dst, src *Config) { dst.Admin.SecretKeyAuth = src.Admin.SecretKeyAuth },
+	},
+	{
+		env:   "PORTR_SERVER_URL",
+		value: func(c *Config) string { return c.Admin.ServerURL },
+		apply: func(dst, src *Config) { dst.Admin.ServerURL = src.Admin.ServerURL },
+	},
+	{
+		env:   "PORTR_SSH_URL",
+		value: func(c *Config) string { return c.Admin.SshURL },
+		apply: func(dst, src *Config) { dst.Admin.SshURL = src.Admin.SshURL },
+	},
+}
+
+// Reload re-reads the .env file and the environment and returns the
+// resulting configuration. Unlike Load it reports invalid values instead of
+// exiting, so a bad edit never takes down a running server.
+func Reload() (*Config, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	values, err := godotenv.Read()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read .env: %w", err)
+	}
+	applyEnvFile(values)
+	return parse()
+}
+
+func applyEnvFile(values map[string]string) {
+	for key := range fileEnv {
+		if _, ok := values[key]; !ok {
+			_ = os.Unsetenv(key)
+		}
+	}
+	fileEnv = make(map[string]bool, len(values))
+	for key, value := range values {
+		if processEnv[key] {
+			continue
+		}
+		_ = os.Setenv(key, value)
+		fileEnv[key] = true
+	}
+}
+
+// Environ returns the environment without the values applied from .env, so a
+// replacement process started by a handoff reads the file itself and keeps
+// the same precedence.
+func Environ() []string {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	env := make([]string, 0, len(processEnv))
+	for _, entry := range os.Environ() {
+		key, _, _ := strings.Cut(entry, "=")
+		if fileEnv[key] {
+			continue
+		}
+		env = append(env, entry)
+	}
+	return env
+}
+
+// Apply copies the live settings of next into c and reports every setting
+// that differs between the two.
+func (c *Config) Apply(next *Config) ReloadReport {
+	liveMu.Lock()
+	defer liveMu.Unlock()
+
+	report := ReloadReport{Applied: []string{}, RequiresRestart: []string{}}
+	for _, setting := range settings {
+		if setting.value(c) == setting.value(next) {
+			continue
+		}
+		if setting.apply == nil {
+			report.RequiresRestart = append(report.RequiresRestart, setting.env)
+			continue
+		}
+		setting.apply(c, next)
+		report.Applied = append(report.Applied, setting.env)
+	}
+	return report
+}
+
+// ReservationLimit returns the current reserved subdomain limit.
+func (c *AdminConfig) ReservationLimit() int {
+	liveMu.RLock()
+	defer liveMu.RUnlock()
+	return c.ReservedSubdomainLimit
+}
+
+// GitHubCredentials returns the current GitHub OAuth client ID and secret.
+func (c *AdminConfig) GitHubCredentials() (string, string) {
+	liveMu.RLock()
+	defer liveMu.RUnlock()
+	return c.GithubClientID, c.GithubSecret
+}
+
+// OIDCSettings returns the current OpenID Connect provider.
+func (c *AdminConfig) OIDCSettings() OIDCConfig {
+	liveMu.RLock()
+	defer liveMu.RUnlock()
+	return c.OIDC
+}
+
+// PasswordLoginEnabled reports whether users may currently sign in with a
+// password.
+func (c *AdminConfig) PasswordLoginEnabled() bool {
+	liveMu.RLock()
+	defer liveMu.RUnlock()
+	return !c.PasswordLoginDisabled
+}
+
+// SecretKeyAuthEnabled reports whether secret keys are currently accepted as
+// bearer tokens for user and SSH key management.
+func (c *AdminConfig) SecretKeyAuthEnabled() bool {
+	liveMu.RLock()
+	defer liveMu.RUnlock()
+	return c.SecretKeyAuth
+}
+
+// ClientURLs returns the server and ssh URLs handed out to clients.
+func (c *AdminConfig) ClientURLs() (string, string) {
+	liveMu.RLock()
+	defer liveMu.RUnlock()
+	return c.ServerURL, c.SshURL
+}
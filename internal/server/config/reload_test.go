@@ -0,0 +1,118 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyCopiesLiveSettingsAndReportsRestartOnes(t *testing.T) {
+	current := &Config{
+		Ssh:   SshConfig{Port: 2222},
+		Admin: AdminConfig{ReservedSubdomainLimit: 3, ServerURL: "https://old.example.com"},
+	}
+	next := &Config{
+		Ssh:   SshConfig{Port: 2223},
+		Admin: AdminConfig{ReservedSubdomainLimit: 5, ServerURL: "https://old.example.com"},
+	}
+
+	report := current.Apply(next)
+
+	if !slices.Equal(report.Applied, []string{"PORTR_RESERVED_SUBDOMAIN_LIMIT"}) {
+		t.Fatalf("unexpected applied settings: %v", report.Applied)
+	}
+	if !slices.Equal(report.RequiresRestart, []string{"PORTR_SSH_PORT"}) {
+		t.Fatalf("unexpected restart settings: %v", report.RequiresRestart)
+	}
+	if current.Admin.ReservationLimit() != 5 {
+		t.Fatalf("expected live limit to be applied, got %d", current.Admin.ReservationLimit())
+	}
+	if current.Ssh.Port != 2222 {
+		t.Fatalf("expected ssh port to stay until restart, got %d", current.Ssh.Port)
+	}
+}
+
+func TestApplyReportsAccessLogChangesAsRequiringRestart(t *testing.T) {
+	current := &Config{AccessLog: AccessLogConfig{Retention: 168 * time.Hour}}
+	next := &Config{AccessLog: AccessLogConfig{Enabled: true, Retention: 24 * time.Hour}}
+
+	report := current.Apply(next)
+
+	if len(report.Applied) != 0 {
+		t.Fatalf("unexpected applied settings: %v", report.Applied)
+	}
+	if !slices.Equal(report.RequiresRestart, []string{"PORTR_ACCESS_LOG", "PORTR_ACCESS_LOG_RETENTION"}) {
+		t.Fatalf("unexpected restart settings: %v", report.RequiresRestart)
+	}
+	if current.AccessLog.Enabled {
+		t.Fatal("expected the access log to stay off until restart")
+	}
+}
+
+func TestApplyReportsTracingEndpointAsRequiringRestart(t *testing.T) {
+	current := &Config{}
+	next := &Config{OTLPEndpoint: "http://collector:4318"}
+
+	report := current.Apply(next)
+
+	if !slices.Equal(report.RequiresRestart, []string{"PORTR_OTEL_ENDPOINT"}) {
+		t.Fatalf("unexpected restart settings: %v", report.RequiresRestart)
+	}
+	if current.OTLPEndpoint != "" {
+		t.Fatalf("expected tracing to stay off until restart, got %q", current.OTLPEndpoint)
+	}
+}
+
+func TestReloadRejectsInvalidValuesWithoutExiting(t *testing.T) {
+	t.Setenv("PORTR_DB_URL", "sqlite://portr.db")
+	t.Setenv("PORTR_SSH_PORT", "not-a-port")
+
+	if _, err := Reload(); err == nil {
+		t.Fatal("expected invalid ssh port to fail the reload")
+	}
+}
+
+func TestReloadRequiresOIDCToDisablePasswordLogin(t *testing.T) {
+	t.Setenv("PORTR_DB_URL", "sqlite://portr.db")
+	t.Setenv("PORTR_ADMIN_DISABLE_PASSWORD_LOGIN", "true")
+
+	if _, err := Reload(); err == nil {
+		t.Fatal("expected disabling password login without OpenID Connect to fail the reload")
+	}
+
+	t.Setenv("PORTR_ADMIN_OIDC_ISSUER", "https://login.example.com/")
+	if _, err := Reload(); err == nil {
+		t.Fatal("expected an issuer without a client ID to fail the reload")
+	}
+
+	t.Setenv("PORTR_ADMIN_OIDC_CLIENT_ID", "portr")
+	cfg, err := Reload()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if oidc := cfg.Admin.OIDCSettings(); oidc.Issuer != "https://login.example.com" || oidc.Name != "SSO" {
+		t.Fatalf("unexpected OpenID Connect settings: %+v", oidc)
+	}
+	if cfg.Admin.PasswordLoginEnabled() {
+		t.Fatal("expected password login to be disabled")
+	}
+}
+
+func TestReloadParsesTrustedProxies(t *testing.T) {
+	t.Setenv("PORTR_DB_URL", "sqlite://portr.db")
+	t.Setenv("PORTR_ADMIN_TRUSTED_PROXIES", "127.0.0.1, 10.0.0.0/8,")
+
+	cfg, err := Reload()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.Join(cfg.Admin.TrustedProxies, ","); got != "127.0.0.1,10.0.0.0/8" {
+		t.Fatalf("unexpected trusted proxies %q", got)
+	}
+
+	t.Setenv("PORTR_ADMIN_TRUSTED_PROXIES", "caddy")
+	if _, err := Reload(); err == nil {
+		t.Fatal("expected a trusted proxy that is not an IP or CIDR to fail the reload")
+	}
+}
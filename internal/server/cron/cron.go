@@ -4,24 +4,62 @@ import (
 	"context"
 	"time"
 
-	"github.com/amalshaji/portr/internal/server/config"
-	"github.com/amalshaji/portr/internal/server/service"
 	"github.com/charmbracelet/log"
-	"github.com/go-resty/resty/v2"
 )
 
+// Reconciler repairs tunnel state from the sshd lease table.
+type Reconciler interface {
+	Reconcile(ctx context.Context)
+}
+
+// TunnelPolicies closes the tunnels that were idle too long or reached their
+// deadline.
+type TunnelPolicies interface {
+	EnforcePolicies(ctx context.Context)
+}
+
+// MirrorCounter persists the delivery counts of mirroring rules.
+type MirrorCounter interface {
+	FlushCounts(ctx context.Context)
+}
+
+// BandwidthMeter saves tunnel traffic and reloads bandwidth limits.
+type BandwidthMeter interface {
+	Sync(ctx context.Context)
+	Flush(ctx context.Context)
+}
+
+// AccessLogWriter saves and prunes the access log.
+type AccessLogWriter interface {
+	Flush(ctx context.Context)
+	Prune(ctx context.Context)
+}
+
+// CachePurger applies the cache purges requested through the admin API.
+type CachePurger interface {
+	ApplyPurges(ctx context.Context)
+}
+
 type Cron struct {
-	config     *config.Config
-	service    *service.Service
+	reconciler Reconciler
+	policies   TunnelPolicies
+	mirrors    MirrorCounter
+	bandwidth  BandwidthMeter
+	accessLogs AccessLogWriter
+	cache      CachePurger
 	cancelFunc context.CancelFunc
-	httpClient *resty.Client
 }
 
-func New(config *config.Config, service *service.Service) *Cron {
+// New returns the server's cron jobs. accessLogs is nil when the access log
+// is disabled, and cache when the response cache is.
+func New(reconciler Reconciler, policies TunnelPolicies, mirrors MirrorCounter, bandwidth BandwidthMeter, accessLogs AccessLogWriter, cache CachePurger) *Cron {
 	return &Cron{
-		config:     config,
-		service:    service,
-		httpClient: resty.New().SetTimeout(5 * time.Second),
+		reconciler: reconciler,
+		policies:   policies,
+		mirrors:    mirrors,
+		bandwidth:  bandwidth,
+		accessLogs: accessLogs,
+		cache:      cache,
 	}
 }
 
@@ -51,4 +89,13 @@ func (c *Cron) Shutdown() {
 	if c.cancelFunc != nil {
 		c.cancelFunc()
 	}
+	// Save the counts of the last interval; requests mirrored and traffic
+	// sent while tunnels drain after this are not counted.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c.mirrors.FlushCounts(ctx)
+	c.bandwidth.Flush(ctx)
+	if c.accessLogs != nil {
+		c.accessLogs.Flush(ctx)
+	}
 }
@@ -15,10 +15,58 @@ type Job struct {
 
 var crons = []Job{
 	{
-		Name:     "Ping active connections",
+		Name:     "Reconcile tunnels",
 		Interval: 10 * time.Second,
 		Function: func(ctx context.Context, c *Cron) {
-			c.pingActiveConnections(ctx)
+			c.reconciler.Reconcile(ctx)
+		},
+	},
+	{
+		Name:     "Enforce tunnel policies",
+		Interval: 10 * time.Second,
+		Function: func(ctx context.Context, c *Cron) {
+			c.policies.EnforcePolicies(ctx)
+		},
+	},
+	{
+		Name:     "Flush mirror counts",
+		Interval: 10 * time.Second,
+		Function: func(ctx context.Context, c *Cron) {
+			c.mirrors.FlushCounts(ctx)
+		},
+	},
+	{
+		Name:     "Sync bandwidth usage",
+		Interval: 10 * time.Second,
+		Function: func(ctx context.Context, c *Cron) {
+			c.bandwidth.Sync(ctx)
+		},
+	},
+	{
+		Name:     "Flush access logs",
+		Interval: 5 * time.Second,
+		Function: func(ctx context.Context, c *Cron) {
+			if c.accessLogs != nil {
+				c.accessLogs.Flush(ctx)
+			}
+		},
+	},
+	{
+		Name:     "Prune access logs",
+		Interval: time.Hour,
+		Function: func(ctx context.Context, c *Cron) {
+			if c.accessLogs != nil {
+				c.accessLogs.Prune(ctx)
+			}
+		},
+	},
+	{
+		Name:     "Apply cache purges",
+		Interval: 5 * time.Second,
+		Function: func(ctx context.Context, c *Cron) {
+			if c.cache != nil {
+				c.cache.ApplyPurges(ctx)
+			}
 		},
 	},
 }
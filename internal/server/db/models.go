@@ -13,8 +13,14 @@ type Connection struct {
 	CreatedAt   time.Time
 	StartedAt   *time.Time
 	ClosedAt    *time.Time
+	ExpiresAt   *time.Time
+	CloseReason *string
 	CreatedByID uint
 	CreatedBy   TeamUser
+	DeviceKeyID *uint
+	// TunnelCredentialID is set for connections opened with an ephemeral
+	// tunnel credential.
+	TunnelCredentialID *uint
 }
 
 func (Connection) TableName() string {
@@ -34,3 +40,14 @@ type TeamUser struct {
 func (TeamUser) TableName() string {
 	return "team_users"
 }
+
+type SshKey struct {
+	ID          uint `gorm:"primarykey"`
+	TeamUserID  uint
+	Fingerprint string
+	LastUsedAt  *time.Time
+}
+
+func (SshKey) TableName() string {
+	return "ssh_key"
+}
@@ -0,0 +1,165 @@
+// Package edgecache keeps the responses tunnels mark cacheable in memory,
+// so the proxy can serve them without a round trip through the tunnel.
+package edgecache
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/proxy"
+	"github.com/charmbracelet/log"
+)
+
+const (
+	// maxEntryBytes bounds the body of one entry, so a single large asset
+	// cannot push out everything else.
+	maxEntryBytes = 8 << 20
+	// entryOverhead approximates the memory an entry takes beyond its body
+	// and headers.
+	entryOverhead = 256
+)
+
+// Store reads the purges teams request through the admin API.
+type Store interface {
+	CachePurgesAfter(ctx context.Context, afterID uint64) ([]models.CachePurge, error)
+}
+
+type entry struct {
+	subdomain string
+	key       string
+	response  *proxy.CachedResponse
+	size      int64
+}
+
+// Cache is a least recently used cache bounded by the memory of its
+// entries, indexed by subdomain so purges drop only that subdomain's.
+type Cache struct {
+	store    Store
+	maxBytes int64
+
+	mu          sync.Mutex
+	lru         *list.List
+	bySubdomain map[string]map[string]*list.Element
+	size        int64
+	// lastPurge is the ID of the last purge applied. Purges older than the
+	// process find nothing to drop, so it starts at zero.
+	lastPurge uint64
+}
+
+func New(store Store, maxBytes int64) *Cache {
+	return &Cache{
+		store:       store,
+		maxBytes:    maxBytes,
+		lru:         list.New(),
+		bySubdomain: make(map[string]map[string]*list.Element),
+	}
+}
+
+var _ proxy.ResponseCache = (*Cache)(nil)
+
+// MaxEntryBytes is the largest body the cache stores.
+func (c *Cache) MaxEntryBytes() int64 {
+	return min(maxEntryBytes, c.maxBytes/4)
+}
+
+func (c *Cache) Get(subdomain, key string) (*proxy.CachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.bySubdomain[strings.ToLower(subdomain)][key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return element.Value.(*entry).response, true
+}
+
+// Put stores a response, replacing any entry for the same key and evicting
+// the least recently used entries until the cache fits.
+func (c *Cache) Put(subdomain, key string, response *proxy.CachedResponse) {
+	subdomain = strings.ToLower(subdomain)
+	size := entrySize(key, response)
+	if int64(len(response.Body)) > c.MaxEntryBytes() || size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.bySubdomain[subdomain][key]; ok {
+		c.remove(element)
+	}
+	entries, ok := c.bySubdomain[subdomain]
+	if !ok {
+		entries = make(map[string]*list.Element)
+		c.bySubdomain[subdomain] = entries
+	}
+	entries[key] = c.lru.PushFront(&entry{subdomain: subdomain, key: key, response: response, size: size})
+	c.size += size
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+// Purge drops every entry of a subdomain and returns how many it dropped.
+func (c *Cache) Purge(subdomain string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries := c.bySubdomain[strings.ToLower(subdomain)]
+	count := len(entries)
+	for _, element := range entries {
+		c.remove(element)
+	}
+	return count
+}
+
+// ApplyPurges drops the entries of the subdomains purged since the last
+// call.
+func (c *Cache) ApplyPurges(ctx context.Context) {
+	c.mu.Lock()
+	after := c.lastPurge
+	c.mu.Unlock()
+
+	purges, err := c.store.CachePurgesAfter(ctx, after)
+	if err != nil {
+		log.Error("Failed to load cache purges", "error", err)
+		return
+	}
+	for _, purge := range purges {
+		if dropped := c.Purge(purge.Subdomain); dropped != 0 {
+			log.Info("Purged cached responses", "subdomain", purge.Subdomain, "count", dropped)
+		}
+		c.mu.Lock()
+		c.lastPurge = max(c.lastPurge, purge.ID)
+		c.mu.Unlock()
+	}
+}
+
+// Size returns the memory the entries take, as the cache accounts it.
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+func (c *Cache) remove(element *list.Element) {
+	e := c.lru.Remove(element).(*entry)
+	c.size -= e.size
+	entries := c.bySubdomain[e.subdomain]
+	delete(entries, e.key)
+	if len(entries) == 0 {
+		delete(c.bySubdomain, e.subdomain)
+	}
+}
+
+func entrySize(key string, response *proxy.CachedResponse) int64 {
+	size := int64(entryOverhead + len(key) + len(response.Body))
+	for name, values := range response.Header {
+		size += int64(len(name))
+		for _, value := range values {
+			size += int64(len(value))
+		}
+	}
+	return size
+}
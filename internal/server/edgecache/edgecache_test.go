@@ -0,0 +1,85 @@
+package edgecache
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/proxy"
+)
+
+type fakeStore struct {
+	purges []models.CachePurge
+	after  []uint64
+}
+
+func (f *fakeStore) CachePurgesAfter(_ context.Context, afterID uint64) ([]models.CachePurge, error) {
+	f.after = append(f.after, afterID)
+	var purges []models.CachePurge
+	for _, purge := range f.purges {
+		if purge.ID > afterID {
+			purges = append(purges, purge)
+		}
+	}
+	return purges, nil
+}
+
+func response(body string) *proxy.CachedResponse {
+	return &proxy.CachedResponse{Status: http.StatusOK, Header: http.Header{}, Body: []byte(body)}
+}
+
+func TestCacheEvictsLeastRecentlyUsedEntries(t *testing.T) {
+	c := New(&fakeStore{}, 3*(entryOverhead+1100))
+
+	c.Put("docs", "/a", response(strings.Repeat("a", 1000)))
+	c.Put("docs", "/b", response(strings.Repeat("b", 1000)))
+	c.Put("Blog", "/c", response(strings.Repeat("c", 1000)))
+	if _, ok := c.Get("docs", "/a"); !ok {
+		t.Fatal("expected /a to be cached")
+	}
+	c.Put("docs", "/d", response(strings.Repeat("d", 1000)))
+
+	if _, ok := c.Get("docs", "/b"); ok {
+		t.Fatal("expected the least recently used entry to be evicted")
+	}
+	for subdomain, key := range map[string]string{"docs": "/a", "blog": "/c"} {
+		if _, ok := c.Get(subdomain, key); !ok {
+			t.Fatalf("expected %s%s to stay cached", subdomain, key)
+		}
+	}
+	if c.Size() > c.maxBytes {
+		t.Fatalf("expected the cache to fit %d bytes, takes %d", c.maxBytes, c.Size())
+	}
+
+	c.Put("docs", "/huge", response(strings.Repeat("h", int(c.MaxEntryBytes())+1)))
+	if _, ok := c.Get("docs", "/huge"); ok {
+		t.Fatal("expected entries over the entry limit to be skipped")
+	}
+}
+
+func TestApplyPurgesDropsOnlyPurgedSubdomains(t *testing.T) {
+	store := &fakeStore{purges: []models.CachePurge{{ID: 7, Subdomain: "docs"}}}
+	c := New(store, 1<<20)
+	c.Put("docs", "/a", response("a"))
+	c.Put("docs", "/b", response("b"))
+	c.Put("blog", "/a", response("a"))
+
+	c.ApplyPurges(context.Background())
+	if _, ok := c.Get("docs", "/a"); ok {
+		t.Fatal("expected the purged subdomain's entries to be dropped")
+	}
+	if _, ok := c.Get("blog", "/a"); !ok {
+		t.Fatal("expected other subdomains to stay cached")
+	}
+
+	c.Put("docs", "/a", response("a"))
+	c.ApplyPurges(context.Background())
+	if _, ok := c.Get("docs", "/a"); !ok {
+		t.Fatal("expected an applied purge not to be applied again")
+	}
+	if len(store.after) != 2 || store.after[1] != 7 {
+		t.Fatalf("expected polling to continue after the last purge, got %v", store.after)
+	}
+}
@@ -0,0 +1,79 @@
+// Package errorpage renders the error pages teams configure in the admin
+// dashboard for the proxy.
+package errorpage
+
+import (
+	"context"
+	"html"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"github.com/amalshaji/portr/internal/server/ttlcache"
+	"github.com/charmbracelet/log"
+	"github.com/valyala/fasttemplate"
+)
+
+const (
+	// pageTTL is how long a page, or the lack of one, is kept per reason and
+	// subdomain. Scanners probing dead tunnels generate most error responses.
+	pageTTL        = 30 * time.Second
+	maxCachedPages = 1024
+)
+
+type Resolver interface {
+	ResolveErrorPage(ctx context.Context, reason, subdomain string) (*services.ResolvedErrorPage, error)
+}
+
+// Pages renders configured pages with their placeholders filled in:
+// {{subdomain}}, {{owner}}, {{last_seen}} and {{request_id}}.
+type Pages struct {
+	resolver Resolver
+	cache    *ttlcache.Cache[*services.ResolvedErrorPage]
+}
+
+func New(resolver Resolver) *Pages {
+	return &Pages{
+		resolver: resolver,
+		cache:    ttlcache.New[*services.ResolvedErrorPage](pageTTL, maxCachedPages),
+	}
+}
+
+// Render returns the configured page for the subdomain, or false when it
+// has none or the lookup failed, in which case the built-in page is served.
+func (p *Pages) Render(ctx context.Context, reason, subdomain, requestID string) (string, bool) {
+	subdomain = strings.ToLower(subdomain)
+	page, err := p.cache.Get(reason+"\x00"+subdomain, func() (*services.ResolvedErrorPage, error) {
+		return p.resolver.ResolveErrorPage(ctx, reason, subdomain)
+	})
+	if err != nil {
+		log.Warn("Failed to load error page", "reason", reason, "subdomain", subdomain, "error", err)
+		return "", false
+	}
+	if page == nil {
+		return "", false
+	}
+
+	lastSeen := "never"
+	if page.LastSeen != nil {
+		lastSeen = page.LastSeen.UTC().Format(time.RFC3339)
+	}
+	template, err := fasttemplate.NewTemplate(page.Body, "{{", "}}")
+	if err != nil {
+		return "", false
+	}
+	return template.ExecuteFuncString(func(w io.Writer, tag string) (int, error) {
+		switch strings.TrimSpace(tag) {
+		case "subdomain":
+			return io.WriteString(w, html.EscapeString(subdomain))
+		case "owner":
+			return io.WriteString(w, html.EscapeString(page.Owner))
+		case "last_seen":
+			return io.WriteString(w, lastSeen)
+		case "request_id":
+			return io.WriteString(w, html.EscapeString(requestID))
+		}
+		return io.WriteString(w, "{{"+tag+"}}")
+	}), true
+}
@@ -0,0 +1,57 @@
+package errorpage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/services"
+)
+
+type countingResolver struct {
+	page  *services.ResolvedErrorPage
+	calls int
+}
+
+func (r *countingResolver) ResolveErrorPage(context.Context, string, string) (*services.ResolvedErrorPage, error) {
+	r.calls++
+	return r.page, nil
+}
+
+func TestRenderFillsPlaceholders(t *testing.T) {
+	lastSeen := time.Date(2026, 8, 24, 10, 30, 0, 0, time.UTC)
+	resolver := &countingResolver{page: &services.ResolvedErrorPage{
+		Body:     "{{subdomain}} by {{ owner }} at {{last_seen}} ({{request_id}}) {{unknown}}",
+		Owner:    "<dev@example.com>",
+		LastSeen: &lastSeen,
+	}}
+	pages := New(resolver)
+
+	got, ok := pages.Render(context.Background(), "connection-lost", "Demo", "01JREQ")
+	want := "demo by &lt;dev@example.com&gt; at 2026-08-24T10:30:00Z (01JREQ) {{unknown}}"
+	if !ok || got != want {
+		t.Fatalf("Render = %q, %v; want %q", got, ok, want)
+	}
+}
+
+func TestRenderCachesLookups(t *testing.T) {
+	resolver := &countingResolver{}
+	pages := New(resolver)
+	now := time.Now()
+	pages.cache.SetClock(func() time.Time { return now })
+
+	for range 3 {
+		if _, ok := pages.Render(context.Background(), "unregistered-subdomain", "missing", ""); ok {
+			t.Fatal("expected no page")
+		}
+	}
+	if resolver.calls != 1 {
+		t.Fatalf("expected one lookup, got %d", resolver.calls)
+	}
+
+	now = now.Add(pageTTL)
+	pages.Render(context.Background(), "unregistered-subdomain", "missing", "")
+	if resolver.calls != 2 {
+		t.Fatalf("expected an expired entry to be looked up again, got %d lookups", resolver.calls)
+	}
+}
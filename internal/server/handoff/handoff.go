@@ -0,0 +1,291 @@
+// Package handoff lets a running portrd pass its listening sockets to a
+// replacement process, so deploys and upgrades never close the proxy, sshd or
+// admin listeners.
+//
+// Sockets are passed with the systemd socket activation protocol
+// (LISTEN_FDS and LISTEN_FDNAMES), so the same code path also accepts sockets
+// from a systemd .socket unit.
+package handoff
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// listenFdsStart is the first inherited descriptor, as in sd_listen_fds(3).
+	listenFdsStart = 3
+
+	readyFdEnv     = "PORTR_HANDOFF_READY_FD"
+	predecessorEnv = "PORTR_HANDOFF_PROXY"
+
+	readyMessage = "ready"
+	readyTimeout = 2 * time.Minute
+)
+
+// ErrNotReady is returned by Upgrade when the replacement process exits or
+// times out before reporting ready.
+var ErrNotReady = errors.New("replacement process did not become ready")
+
+type namedListener struct {
+	name     string
+	listener net.Listener
+}
+
+// Listeners hands out the sockets portrd serves on. Sockets inherited from a
+// previous process are reused, the rest are opened fresh.
+type Listeners struct {
+	mu         sync.Mutex
+	inherited  map[string]*os.File
+	listeners  []namedListener
+	executable string
+	args       []string
+}
+
+// Inherit collects the sockets passed in by a previous process or by systemd.
+func Inherit() (*Listeners, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve executable: %w", err)
+	}
+	l := &Listeners{
+		inherited:  make(map[string]*os.File),
+		executable: executable,
+		args:       os.Args[1:],
+	}
+
+	count := os.Getenv("LISTEN_FDS")
+	names := os.Getenv("LISTEN_FDNAMES")
+	pid := os.Getenv("LISTEN_PID")
+	_ = os.Unsetenv("LISTEN_FDS")
+	_ = os.Unsetenv("LISTEN_FDNAMES")
+	_ = os.Unsetenv("LISTEN_PID")
+	if count == "" {
+		return l, nil
+	}
+	// systemd sets LISTEN_PID; a handoff between portrd processes cannot know
+	// the child's pid up front and leaves it unset.
+	if pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return l, nil
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", count)
+	}
+
+	fdNames := strings.Split(names, ":")
+	for i := 0; i < n; i++ {
+		name := ""
+		if i < len(fdNames) {
+			name = fdNames[i]
+		}
+		file := os.NewFile(uintptr(listenFdsStart+i), name)
+		if name == "" {
+			_ = file.Close()
+			continue
+		}
+		l.inherited[name] = file
+	}
+	return l, nil
+}
+
+// Inherited reports whether any socket was passed in.
+func (l *Listeners) Inherited() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.inherited) != 0
+}
+
+// Listen returns the inherited socket called name, or listens on addr when
+// none was passed in. The listener is handed to the replacement process on
+// Upgrade.
+func (l *Listeners) Listen(name, addr string) (net.Listener, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var listener net.Listener
+	if file, ok := l.inherited[name]; ok {
+		delete(l.inherited, name)
+		inherited, err := net.FileListener(file)
+		_ = file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to use inherited %s socket: %w", name, err)
+		}
+		listener = inherited
+	} else {
+		fresh, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		listener = fresh
+	}
+	l.listeners = append(l.listeners, namedListener{name: name, listener: listener})
+	return listener, nil
+}
+
+// CloseUnused closes inherited sockets that were never claimed by Listen,
+// for example the admin socket when a process started with `start all` is
+// replaced by `start tunnel`.
+func (l *Listeners) CloseUnused() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for name, file := range l.inherited {
+		_ = file.Close()
+		delete(l.inherited, name)
+	}
+}
+
+type fileListener interface {
+	File() (*os.File, error)
+}
+
+// Upgrade starts a replacement process with the same executable and
+// arguments, hands it every listener and waits until it reports ready. The
+// caller keeps serving whether or not the upgrade succeeds; on success it
+// is expected to drain and exit. env is the environment for the replacement
+// process and predecessor the address of the proxy that keeps serving the
+// tunnels still attached to the current process.
+func (l *Listeners) Upgrade(ctx context.Context, env []string, predecessor string) error {
+	l.mu.Lock()
+	listeners := append([]namedListener(nil), l.listeners...)
+	l.mu.Unlock()
+
+	files := make([]*os.File, 0, len(listeners)+1)
+	names := make([]string, 0, len(listeners))
+	defer func() {
+		for _, file := range files {
+			_ = file.Close()
+		}
+	}()
+	for _, named := range listeners {
+		withFile, ok := named.listener.(fileListener)
+		if !ok {
+			return fmt.Errorf("%s listener cannot be passed to another process", named.name)
+		}
+		file, err := withFile.File()
+		if err != nil {
+			return fmt.Errorf("failed to duplicate %s listener: %w", named.name, err)
+		}
+		files = append(files, file)
+		names = append(names, named.name)
+	}
+
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create readiness pipe: %w", err)
+	}
+	defer readyReader.Close()
+	files = append(files, readyWriter)
+
+	cmd := exec.Command(l.executable, l.args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(withoutHandoffEnv(env),
+		"LISTEN_FDS="+strconv.Itoa(len(names)),
+		"LISTEN_FDNAMES="+strings.Join(names, ":"),
+		readyFdEnv+"="+strconv.Itoa(listenFdsStart+len(names)),
+		predecessorEnv+"="+predecessor,
+	)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start replacement process: %w", err)
+	}
+	// Only the child may hold the write end, so a crash reads as EOF.
+	_ = readyWriter.Close()
+	files = files[:len(files)-1]
+
+	exited := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(exited)
+	}()
+
+	ready := make(chan bool, 1)
+	go func() {
+		line, _ := bufio.NewReader(readyReader).ReadString('\n')
+		ready <- strings.TrimSpace(line) == readyMessage
+	}()
+
+	timer := time.NewTimer(readyTimeout)
+	defer timer.Stop()
+	select {
+	case ok := <-ready:
+		if ok {
+			return nil
+		}
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	_ = cmd.Process.Kill()
+	<-exited
+	return ErrNotReady
+}
+
+// Predecessor returns the proxy address of the process this one replaced,
+// or an empty string when it was not started by Upgrade.
+func Predecessor() string {
+	return os.Getenv(predecessorEnv)
+}
+
+func withoutHandoffEnv(env []string) []string {
+	filtered := make([]string, 0, len(env))
+	for _, entry := range env {
+		key, _, _ := strings.Cut(entry, "=")
+		switch key {
+		case "LISTEN_FDS", "LISTEN_FDNAMES", "LISTEN_PID", readyFdEnv, predecessorEnv:
+			continue
+		}
+		filtered = append(filtered, entry)
+	}
+	return filtered
+}
+
+// Ready reports that this process is serving. It unblocks the Upgrade call
+// of the process that started it and, under a systemd notify unit, makes
+// this process the service's main process.
+func Ready() error {
+	var errs []error
+	if fdString := os.Getenv(readyFdEnv); fdString != "" {
+		_ = os.Unsetenv(readyFdEnv)
+		fd, err := strconv.Atoi(fdString)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s %q", readyFdEnv, fdString))
+		} else {
+			pipe := os.NewFile(uintptr(fd), "handoff-ready")
+			if _, err := pipe.Write([]byte(readyMessage + "\n")); err != nil {
+				errs = append(errs, fmt.Errorf("failed to report readiness: %w", err))
+			}
+			_ = pipe.Close()
+		}
+	}
+	if err := notifySystemd(fmt.Sprintf("READY=1\nMAINPID=%d", os.Getpid())); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func notifySystemd(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("failed to notify systemd: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("failed to notify systemd: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package handoff
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+const helperEnv = "PORTR_HANDOFF_TEST_HELPER"
+
+// TestHelperProcess is the replacement process started by the tests below.
+func TestHelperProcess(t *testing.T) {
+	mode := os.Getenv(helperEnv)
+	if mode == "" {
+		return
+	}
+	if mode == "fail" {
+		os.Exit(1)
+	}
+
+	listeners, err := Inherit()
+	if err != nil || !listeners.Inherited() {
+		os.Exit(2)
+	}
+	listener, err := listeners.Listen("proxy", "")
+	if err != nil {
+		os.Exit(3)
+	}
+	if err := Ready(); err != nil {
+		os.Exit(4)
+	}
+	conn, err := listener.Accept()
+	if err != nil {
+		os.Exit(5)
+	}
+	_, _ = fmt.Fprintf(conn, "replacement of %s\n", Predecessor())
+	_ = conn.Close()
+	os.Exit(0)
+}
+
+func newHelperListeners(t *testing.T) *Listeners {
+	t.Helper()
+	listeners, err := Inherit()
+	if err != nil {
+		t.Fatalf("inherit: %v", err)
+	}
+	listeners.executable = os.Args[0]
+	listeners.args = []string{"-test.run=^TestHelperProcess$"}
+	return listeners
+}
+
+func TestUpgradeHandsListenerToReplacement(t *testing.T) {
+	listeners := newHelperListeners(t)
+	listener, err := listeners.Listen("proxy", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	env := append(os.Environ(), helperEnv+"=serve")
+	if err := listeners.Upgrade(context.Background(), env, "127.0.0.1:4321"); err != nil {
+		t.Fatalf("upgrade: %v", err)
+	}
+	// Only the replacement may accept once this process lets go.
+	_ = listener.Close()
+
+	conn, err := net.DialTimeout("tcp", listener.Addr().String(), 5*time.Second)
+	if err != nil {
+		t.Fatalf("dial handed over listener: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("read from replacement: %v", err)
+	}
+	if line != "replacement of 127.0.0.1:4321\n" {
+		t.Fatalf("unexpected response %q", line)
+	}
+}
+
+func TestUpgradeFailsWhenReplacementExitsEarly(t *testing.T) {
+	listeners := newHelperListeners(t)
+	listener, err := listeners.Listen("proxy", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+
+	env := append(os.Environ(), helperEnv+"=fail")
+	if err := listeners.Upgrade(context.Background(), env, ""); !errors.Is(err, ErrNotReady) {
+		t.Fatalf("expected ErrNotReady, got %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+// Package mirror supplies the proxy with the mirroring rules teams configure
+// in the admin API, and persists their delivery counts.
+package mirror
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"github.com/amalshaji/portr/internal/server/proxy"
+	"github.com/amalshaji/portr/internal/server/ttlcache"
+	"github.com/charmbracelet/log"
+)
+
+const (
+	// ruleTTL is how long a looked-up rule is reused, including the common
+	// answer that a subdomain has none.
+	ruleTTL        = 10 * time.Second
+	maxCachedRules = 4096
+)
+
+type Store interface {
+	ResolveMirror(ctx context.Context, subdomain string) (*services.ResolvedMirror, error)
+	RecordMirrorDeliveries(ctx context.Context, ruleID uint, mirrored, failed int64) error
+}
+
+type counts struct {
+	mirrored int64
+	failed   int64
+}
+
+type Mirrors struct {
+	store Store
+	cache *ttlcache.Cache[*services.ResolvedMirror]
+
+	mu     sync.Mutex
+	counts map[uint]counts
+}
+
+func New(store Store) *Mirrors {
+	return &Mirrors{
+		store:  store,
+		cache:  ttlcache.New[*services.ResolvedMirror](ruleTTL, maxCachedRules),
+		counts: make(map[uint]counts),
+	}
+}
+
+var _ proxy.Mirrors = (*Mirrors)(nil)
+
+// Rule returns the rule mirroring the subdomain. Lookup failures disable
+// mirroring for the request rather than delaying it.
+func (m *Mirrors) Rule(ctx context.Context, subdomain string) (proxy.MirrorRule, bool) {
+	subdomain = strings.ToLower(subdomain)
+	if subdomain == "" {
+		return proxy.MirrorRule{}, false
+	}
+	rule, err := m.cache.Get(subdomain, func() (*services.ResolvedMirror, error) {
+		return m.store.ResolveMirror(ctx, subdomain)
+	})
+	if err != nil {
+		log.Warn("Failed to load mirror rule", "subdomain", subdomain, "error", err)
+		return proxy.MirrorRule{}, false
+	}
+	if rule == nil {
+		return proxy.MirrorRule{}, false
+	}
+	return proxy.MirrorRule{
+		ID:           rule.ID,
+		Target:       rule.Target,
+		MaxBodyBytes: rule.MaxBodyBytes,
+	}, true
+}
+
+// Record counts a delivery until the next flush.
+func (m *Mirrors) Record(ruleID uint, delivered bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current := m.counts[ruleID]
+	if delivered {
+		current.mirrored++
+	} else {
+		current.failed++
+	}
+	m.counts[ruleID] = current
+}
+
+// FlushCounts adds the deliveries counted since the last flush to the rules'
+// stored counts. Counts that fail to save are kept for the next flush.
+func (m *Mirrors) FlushCounts(ctx context.Context) {
+	m.mu.Lock()
+	pending := m.counts
+	m.counts = make(map[uint]counts)
+	m.mu.Unlock()
+
+	for ruleID, count := range pending {
+		if err := m.store.RecordMirrorDeliveries(ctx, ruleID, count.mirrored, count.failed); err != nil {
+			log.Error("Failed to save mirror counts", "rule_id", ruleID, "error", err)
+			m.mu.Lock()
+			current := m.counts[ruleID]
+			current.mirrored += count.mirrored
+			current.failed += count.failed
+			m.counts[ruleID] = current
+			m.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/services"
+)
+
+type fakeStore struct {
+	rule      *services.ResolvedMirror
+	lookups   int
+	failSaves bool
+	saved     map[uint][2]int64
+}
+
+func (f *fakeStore) ResolveMirror(context.Context, string) (*services.ResolvedMirror, error) {
+	f.lookups++
+	return f.rule, nil
+}
+
+func (f *fakeStore) RecordMirrorDeliveries(_ context.Context, ruleID uint, mirrored, failed int64) error {
+	if f.failSaves {
+		return errors.New("database is down")
+	}
+	current := f.saved[ruleID]
+	f.saved[ruleID] = [2]int64{current[0] + mirrored, current[1] + failed}
+	return nil
+}
+
+func TestRuleCachesLookups(t *testing.T) {
+	store := &fakeStore{rule: &services.ResolvedMirror{ID: 7, Target: "shadow", MaxBodyBytes: 1024}}
+	mirrors := New(store)
+	now := time.Now()
+	mirrors.cache.SetClock(func() time.Time { return now })
+
+	for range 3 {
+		rule, ok := mirrors.Rule(context.Background(), "Primary")
+		if !ok || rule.ID != 7 || rule.Target != "shadow" || rule.MaxBodyBytes != 1024 {
+			t.Fatalf("unexpected rule %+v %v", rule, ok)
+		}
+	}
+	if store.lookups != 1 {
+		t.Fatalf("expected one lookup, got %d", store.lookups)
+	}
+
+	store.rule = nil
+	now = now.Add(ruleTTL)
+	if _, ok := mirrors.Rule(context.Background(), "primary"); ok {
+		t.Fatal("expected a deleted rule to stop applying once the cache expires")
+	}
+}
+
+func TestFlushCountsKeepsCountsThatFailToSave(t *testing.T) {
+	store := &fakeStore{saved: make(map[uint][2]int64), failSaves: true}
+	mirrors := New(store)
+	mirrors.Record(1, true)
+	mirrors.Record(1, true)
+	mirrors.Record(1, false)
+
+	mirrors.FlushCounts(context.Background())
+	if len(store.saved) != 0 {
+		t.Fatalf("expected nothing saved, got %v", store.saved)
+	}
+
+	store.failSaves = false
+	mirrors.Record(1, true)
+	mirrors.FlushCounts(context.Background())
+	if store.saved[1] != [2]int64{3, 1} {
+		t.Fatalf("expected 3 mirrored and 1 failed, got %v", store.saved[1])
+	}
+	mirrors.FlushCounts(context.Background())
+	if store.saved[1] != [2]int64{3, 1} {
+		t.Fatalf("expected a second flush to add nothing, got %v", store.saved[1])
+	}
+}
@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/amalshaji/portr/internal/utils"
+)
+
+// maxLoggedPathLength bounds the path stored per request; query strings are
+// never logged since they often carry tokens.
+const maxLoggedPathLength = 2048
+
+// AccessEntry is a request the proxy served from a tunnel. Backend is the
+// tunnel backend that served it.
+type AccessEntry struct {
+	Time      time.Time
+	RequestID string
+	Subdomain string
+	Backend   string
+	Method    string
+	Path      string
+	Status    int
+	Latency   time.Duration
+	BytesIn   int64
+	BytesOut  int64
+	VisitorIP string
+}
+
+// AccessLog records the requests served from tunnels. Record must not block.
+type AccessLog interface {
+	Record(entry AccessEntry)
+}
+
+// SetAccessLog installs the access log. Without it requests are not
+// recorded.
+func (p *Proxy) SetAccessLog(accessLog AccessLog) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.accessLog = accessLog
+}
+
+func (p *Proxy) getAccessLog() AccessLog {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.accessLog
+}
+
+// startAccessLog wraps w and the request body to measure the request, and
+// returns the function that records it once served. Both are no-ops without
+// an access log.
+func (p *Proxy) startAccessLog(w http.ResponseWriter, r *http.Request, subdomain string) (http.ResponseWriter, func(backend string)) {
+	accessLog := p.getAccessLog()
+	if accessLog == nil {
+		return w, func(string) {}
+	}
+	started := time.Now()
+	recorder := &accessRecorder{ResponseWriter: w}
+	var body *countingBody
+	if r.Body != nil && r.Body != http.NoBody {
+		body = &countingBody{ReadCloser: r.Body}
+		r.Body = body
+	}
+	path := r.URL.Path
+	if len(path) > maxLoggedPathLength {
+		path = path[:maxLoggedPathLength]
+	}
+	return recorder, func(backend string) {
+		entry := AccessEntry{
+			Time:      started,
+			RequestID: r.Header.Get(utils.RequestIDHeader),
+			Subdomain: subdomain,
+			Backend:   backend,
+			Method:    r.Method,
+			Path:      path,
+			Status:    recorder.status,
+			Latency:   time.Since(started),
+			BytesOut:  recorder.written,
+			VisitorIP: visitorIP(r),
+		}
+		if entry.Status == 0 {
+			entry.Status = http.StatusOK
+		}
+		if body != nil {
+			entry.BytesIn = body.read
+		}
+		accessLog.Record(entry)
+	}
+}
+
+type accessRecorder struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (a *accessRecorder) WriteHeader(status int) {
+	if a.status == 0 && status >= 200 {
+		a.status = status
+	}
+	a.ResponseWriter.WriteHeader(status)
+}
+
+func (a *accessRecorder) Write(data []byte) (int, error) {
+	if a.status == 0 {
+		a.status = http.StatusOK
+	}
+	n, err := a.ResponseWriter.Write(data)
+	a.written += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the connection for flushes and
+// websocket upgrades.
+func (a *accessRecorder) Unwrap() http.ResponseWriter {
+	return a.ResponseWriter
+}
+
+type countingBody struct {
+	io.ReadCloser
+	read int64
+}
+
+func (c *countingBody) Read(data []byte) (int, error) {
+	n, err := c.ReadCloser.Read(data)
+	c.read += int64(n)
+	return n, err
+}
+
+// visitorIP returns the client address, taking the one appended by the
+// reverse proxy in front of portr when the request came through one on the
+// same host or network.
+func visitorIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	forwarded := r.Header.Get("X-Forwarded-For")
+	if forwarded == "" || ip == nil || !(ip.IsLoopback() || ip.IsPrivate()) {
+		return host
+	}
+	parts := strings.Split(forwarded, ",")
+	return strings.TrimSpace(parts[len(parts)-1])
+}
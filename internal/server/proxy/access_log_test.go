@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	serverConfig "github.com/amalshaji/portr/internal/server/config"
+)
+
+type fakeAccessLog struct {
+	mu      sync.Mutex
+	entries []AccessEntry
+}
+
+func (f *fakeAccessLog) Record(entry AccessEntry) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entries = append(f.entries, entry)
+}
+
+func TestProxy_RecordsServedRequests(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, "created")
+	}))
+	defer backend.Close()
+	backendAddr := strings.TrimPrefix(backend.URL, "http://")
+
+	p := New(&serverConfig.Config{Domain: "example.test"})
+	_ = p.AddBackend("orders", backendAddr)
+	accessLog := &fakeAccessLog{}
+	p.SetAccessLog(accessLog)
+
+	request := httptest.NewRequest(http.MethodPost, "http://orders.example.test/orders?token=secret", strings.NewReader(`{"id":1}`))
+	request.RemoteAddr = "127.0.0.1:40000"
+	request.Header.Set("X-Forwarded-For", "198.51.100.9, 203.0.113.7")
+	recorder := httptest.NewRecorder()
+	p.ServeHTTP(recorder, request)
+
+	unknown := httptest.NewRequest(http.MethodGet, "http://missing.example.test/", nil)
+	p.ServeHTTP(httptest.NewRecorder(), unknown)
+
+	if len(accessLog.entries) != 1 {
+		t.Fatalf("expected only the served request to be recorded, got %+v", accessLog.entries)
+	}
+	entry := accessLog.entries[0]
+	if entry.Subdomain != "orders" || entry.Backend != backendAddr || entry.Method != http.MethodPost || entry.Path != "/orders" {
+		t.Fatalf("unexpected request details %+v", entry)
+	}
+	if entry.Status != http.StatusCreated || entry.BytesIn != 8 || entry.BytesOut != 7 || entry.Time.IsZero() {
+		t.Fatalf("unexpected response details %+v", entry)
+	}
+	if entry.VisitorIP != "203.0.113.7" {
+		t.Fatalf("expected the address appended by the local reverse proxy, got %q", entry.VisitorIP)
+	}
+}
+
+func TestVisitorIPIgnoresForwardedHeaderFromPublicPeers(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, "http://orders.example.test/", nil)
+	request.RemoteAddr = "192.0.2.10:5000"
+	request.Header.Set("X-Forwarded-For", "10.0.0.1")
+	if ip := visitorIP(request); ip != "192.0.2.10" {
+		t.Fatalf("expected the peer address, got %q", ip)
+	}
+}
@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/amalshaji/portr/internal/utils"
+)
+
+// BandwidthQuotas reports which tunnels belong to a team or team user that
+// used its monthly bandwidth quota.
+type BandwidthQuotas interface {
+	BandwidthExceeded(backend string) bool
+}
+
+// SetBandwidthQuotas installs the quota check. Without it every tunnel is
+// served.
+func (p *Proxy) SetBandwidthQuotas(quotas BandwidthQuotas) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.quotas = quotas
+}
+
+func (p *Proxy) getBandwidthQuotas() BandwidthQuotas {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.quotas
+}
+
+// withinQuota drops the backends whose tunnels are over quota.
+func (p *Proxy) withinQuota(backends []string) []string {
+	quotas := p.getBandwidthQuotas()
+	if quotas == nil {
+		return backends
+	}
+	allowed := backends[:0:0]
+	for _, backend := range backends {
+		if !quotas.BandwidthExceeded(backend) {
+			allowed = append(allowed, backend)
+		}
+	}
+	return allowed
+}
+
+func (p *Proxy) bandwidthExceededError(w http.ResponseWriter, r *http.Request, subdomain string) {
+	now := time.Now().UTC()
+	resetsOn := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	w.Header().Set("Retry-After", resetsOn.Format(http.TimeFormat))
+	p.writeError(w, r, http.StatusTooManyRequests, utils.ErrorReasonBandwidthExceeded, subdomain, func(requestID string) string {
+		return utils.BandwidthExceeded(subdomain, resetsOn.Format("January 2, 2006"), requestID)
+	})
+}
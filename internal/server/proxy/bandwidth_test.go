@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	serverConfig "github.com/amalshaji/portr/internal/server/config"
+	"github.com/amalshaji/portr/internal/utils"
+)
+
+type fakeQuotas map[string]bool
+
+func (f fakeQuotas) BandwidthExceeded(backend string) bool {
+	return f[backend]
+}
+
+func TestProxy_BandwidthExceededStopsOnlyTunnelsOverQuota(t *testing.T) {
+	p := New(&serverConfig.Config{Domain: "example.test"})
+	over := namedBackend(t, "over")
+	_ = p.AddBackend("demo", over)
+	_ = p.AddBackend("other", namedBackend(t, "other"))
+	p.SetBandwidthQuotas(fakeQuotas{over: true})
+
+	response, body := serveProxy(t, p, "demo.example.test", "")
+	if response.StatusCode != http.StatusTooManyRequests || response.Header.Get("X-Portr-Error-Reason") != utils.ErrorReasonBandwidthExceeded {
+		t.Fatalf("expected the quota error, got %d %q", response.StatusCode, body)
+	}
+	if response.Header.Get("Retry-After") == "" || !strings.Contains(body, "demo") {
+		t.Fatalf("expected when the quota resets, got %q %q", response.Header.Get("Retry-After"), body)
+	}
+
+	response, body = serveProxy(t, p, "demo.example.test", "application/json")
+	if response.Header.Get("Content-Type") != "application/json" || !strings.Contains(body, `"code":"bandwidth-exceeded"`) {
+		t.Fatalf("expected a JSON error, got %q", body)
+	}
+
+	if _, body = serveProxy(t, p, "other.example.test", ""); body != "other" {
+		t.Fatalf("expected other tunnels to be served, got %q", body)
+	}
+}
+
+func TestProxy_BandwidthExceededSkipsPooledTunnelsOverQuota(t *testing.T) {
+	p := New(&serverConfig.Config{Domain: "example.test"})
+	over := namedBackend(t, "over")
+	_ = p.AddBackend("demo", over)
+	_ = p.AddBackend("demo", namedBackend(t, "within"))
+	p.SetBandwidthQuotas(fakeQuotas{over: true})
+
+	for range 4 {
+		if _, body := serveProxy(t, p, "demo.example.test", ""); body != "within" {
+			t.Fatalf("expected the tunnel within quota to serve, got %q", body)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const cacheStatusHeader = "X-Portr-Cache"
+
+// CachedResponse is a response the proxy stored for a subdomain. Its body
+// is never content-encoded.
+type CachedResponse struct {
+	Status  int
+	Header  http.Header
+	Body    []byte
+	Stored  time.Time
+	Expires time.Time
+}
+
+// ResponseCache is the shared cache of tunnel responses. Entries are scoped
+// to the subdomain of the tunnel that served them.
+type ResponseCache interface {
+	Get(subdomain, key string) (*CachedResponse, bool)
+	Put(subdomain, key string, response *CachedResponse)
+	// MaxEntryBytes is the largest body the cache takes.
+	MaxEntryBytes() int64
+}
+
+// SetCache installs the shared response cache. Without it every request
+// goes through the tunnel.
+func (p *Proxy) SetCache(cache ResponseCache) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.cache = cache
+}
+
+func (p *Proxy) getCache() ResponseCache {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.cache
+}
+
+// cacheLookup is a request's use of the cache: the entry it found, if any,
+// and whether the response may be stored.
+type cacheLookup struct {
+	cache     ResponseCache
+	subdomain string
+	key       string
+	entry     *CachedResponse
+	store     bool
+}
+
+// lookupCache finds the cached response for a request to a tunnel. It
+// returns nil for requests the cache does not serve: anything but GET and
+// HEAD, range requests and requests carrying credentials.
+func (p *Proxy) lookupCache(r *http.Request, subdomain string) *cacheLookup {
+	cache := p.getCache()
+	if cache == nil || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return nil
+	}
+	if r.Header.Get("Authorization") != "" || r.Header.Get("Range") != "" || isUpgradeRequest(r) {
+		return nil
+	}
+	lookup := &cacheLookup{
+		cache:     cache,
+		subdomain: subdomain,
+		key:       strings.ToLower(r.Host) + r.URL.RequestURI(),
+		store:     r.Method == http.MethodGet,
+	}
+	// A visitor forcing a reload skips the entry, and refreshes it.
+	if requestDirectives := cacheDirectives(r.Header.Get("Cache-Control")); hasKey(requestDirectives, "no-cache") || hasKey(requestDirectives, "no-store") {
+		return lookup
+	}
+	lookup.entry, _ = cache.Get(subdomain, lookup.key)
+	return lookup
+}
+
+// fresh reports whether the entry can be served without asking the tunnel.
+func (l *cacheLookup) fresh() bool {
+	return l != nil && l.entry != nil && time.Now().Before(l.entry.Expires)
+}
+
+// revalidate makes the request for a stale entry conditional, so the tunnel
+// can answer 304 instead of sending the body again. Visitors' own
+// conditional requests are left alone.
+func (l *cacheLookup) revalidate(r *http.Request) {
+	if l == nil || l.entry == nil || l.fresh() {
+		return
+	}
+	if r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" {
+		l.entry = nil
+		return
+	}
+	etag := l.entry.Header.Get("ETag")
+	lastModified := l.entry.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		l.entry = nil
+		return
+	}
+	if etag != "" {
+		r.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		r.Header.Set("If-Modified-Since", lastModified)
+	}
+}
+
+// handleResponse serves a revalidated entry when the tunnel answered 304,
+// and stores a cacheable response as the visitor reads it.
+func (l *cacheLookup) handleResponse(response *http.Response) {
+	if l == nil {
+		return
+	}
+	if l.entry != nil && response.StatusCode == http.StatusNotModified {
+		entry := *l.entry
+		entry.Header = entry.Header.Clone()
+		for _, name := range []string{"Cache-Control", "Date", "ETag", "Expires", "Last-Modified"} {
+			if value := response.Header.Get(name); value != "" {
+				entry.Header.Set(name, value)
+			}
+		}
+		entry.Stored = time.Now()
+		entry.Expires = expiresAt(entry.Stored, cacheDirectives(entry.Header.Get("Cache-Control")))
+		l.cache.Put(l.subdomain, l.key, &entry)
+		_ = response.Body.Close()
+		// Only stale entries of visitors without validators of their own are
+		// revalidated, so the visitor gets the whole entry.
+		*response = *entryResponse(response.Request, &entry, "")
+		response.Header.Set(cacheStatusHeader, "REVALIDATED")
+		return
+	}
+
+	response.Header.Set(cacheStatusHeader, "MISS")
+	if !l.store || !cacheable(response) {
+		return
+	}
+	if response.ContentLength > l.cache.MaxEntryBytes() {
+		return
+	}
+	entry := &CachedResponse{
+		Status: response.StatusCode,
+		Header: response.Header.Clone(),
+		Stored: time.Now(),
+	}
+	entry.Header.Del(cacheStatusHeader)
+	entry.Expires = expiresAt(entry.Stored, cacheDirectives(entry.Header.Get("Cache-Control")))
+	response.Body = &cacheRecorder{
+		ReadCloser: response.Body,
+		limit:      l.cache.MaxEntryBytes(),
+		save: func(body []byte) {
+			entry.Body = body
+			l.cache.Put(l.subdomain, l.key, entry)
+		},
+	}
+}
+
+// cacheable reports whether a response may be stored in a cache shared by
+// all visitors: the app must mark it public or give it an s-maxage, and it
+// must not be personal to the visitor or encoded for them.
+func cacheable(response *http.Response) bool {
+	if response.StatusCode != http.StatusOK || response.Header.Get("X-Portr-Error") != "" {
+		return false
+	}
+	directives := cacheDirectives(response.Header.Get("Cache-Control"))
+	if !hasKey(directives, "public") && !hasKey(directives, "s-maxage") {
+		return false
+	}
+	if hasKey(directives, "private") || hasKey(directives, "no-store") {
+		return false
+	}
+	if len(response.Header.Values("Set-Cookie")) != 0 || response.Header.Get("Content-Encoding") != "" {
+		return false
+	}
+	for _, vary := range response.Header.Values("Vary") {
+		for _, name := range strings.Split(vary, ",") {
+			if name = strings.TrimSpace(name); name != "" && !strings.EqualFold(name, "Accept-Encoding") {
+				return false
+			}
+		}
+	}
+	// Without a lifetime the entry is stale at once and only saves the body
+	// when the app confirms it is unchanged.
+	stored := time.Now()
+	if !expiresAt(stored, directives).After(stored) {
+		return response.Header.Get("ETag") != "" || response.Header.Get("Last-Modified") != ""
+	}
+	return true
+}
+
+// expiresAt returns when an entry stored at stored goes stale. no-cache
+// entries are stale at once.
+func expiresAt(stored time.Time, directives map[string]string) time.Time {
+	if hasKey(directives, "no-cache") {
+		return stored
+	}
+	lifetime, ok := directives["s-maxage"]
+	if !ok {
+		lifetime = directives["max-age"]
+	}
+	seconds, err := strconv.ParseInt(lifetime, 10, 64)
+	if err != nil || seconds <= 0 {
+		return stored
+	}
+	return stored.Add(time.Duration(seconds) * time.Second)
+}
+
+// hasKey reports whether directives include name, with or without a value.
+func hasKey(directives map[string]string, name string) bool {
+	_, ok := directives[name]
+	return ok
+}
+
+// cacheDirectives parses a Cache-Control header into its lowercase
+// directives and their unquoted values.
+func cacheDirectives(cacheControl string) map[string]string {
+	directives := map[string]string{}
+	for _, part := range strings.Split(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if name == "" {
+			continue
+		}
+		directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+	}
+	return directives
+}
+
+// entryResponse builds the response for a cached entry, answering 304 when
+// ifNoneMatch shows the visitor already has it.
+func entryResponse(r *http.Request, entry *CachedResponse, ifNoneMatch string) *http.Response {
+	response := &http.Response{
+		Status:     http.StatusText(entry.Status),
+		StatusCode: entry.Status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     entry.Header.Clone(),
+		Request:    r,
+	}
+	response.Header.Set("Age", strconv.FormatInt(int64(time.Since(entry.Stored).Seconds()), 10))
+	if etagMatches(ifNoneMatch, entry.Header.Get("ETag")) {
+		response.StatusCode = http.StatusNotModified
+		response.Status = http.StatusText(http.StatusNotModified)
+		response.Header.Del("Content-Length")
+		response.Header.Del("Content-Type")
+		response.Body = http.NoBody
+		return response
+	}
+	response.ContentLength = int64(len(entry.Body))
+	response.Header.Set("Content-Length", strconv.Itoa(len(entry.Body)))
+	response.Body = io.NopCloser(bytes.NewReader(entry.Body))
+	if r.Method == http.MethodHead {
+		response.Body = http.NoBody
+	}
+	return response
+}
+
+// etagMatches compares an If-None-Match header with an entity tag, weakly
+// as If-None-Match requires.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// serveCached writes a fresh entry, or its 304, to the visitor.
+func (p *Proxy) serveCached(w http.ResponseWriter, r *http.Request, entry *CachedResponse, splitCookie *http.Cookie) {
+	response := entryResponse(r, entry, r.Header.Get("If-None-Match"))
+	response.Header.Set(cacheStatusHeader, "HIT")
+	if splitCookie != nil {
+		response.Header.Add("Set-Cookie", splitCookie.String())
+	}
+	p.compress(response)
+	defer response.Body.Close()
+	for name, values := range response.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(response.StatusCode)
+	_, _ = io.Copy(w, response.Body)
+}
+
+// cacheRecorder keeps a copy of the body the visitor reads, and saves it
+// once read to the end within limit.
+type cacheRecorder struct {
+	io.ReadCloser
+	limit int64
+	save  func(body []byte)
+	body  bytes.Buffer
+	done  bool
+}
+
+func (c *cacheRecorder) Read(data []byte) (int, error) {
+	n, err := c.ReadCloser.Read(data)
+	if c.done {
+		return n, err
+	}
+	if int64(c.body.Len()+n) > c.limit {
+		c.done = true
+		c.body = bytes.Buffer{}
+		return n, err
+	}
+	c.body.Write(data[:n])
+	if err == io.EOF {
+		c.done = true
+		c.save(c.body.Bytes())
+	}
+	return n, err
+}
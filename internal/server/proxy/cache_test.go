@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	serverConfig "github.com/amalshaji/portr/internal/server/config"
+)
+
+type fakeCache struct {
+	mu      sync.Mutex
+	entries map[string]*CachedResponse
+}
+
+func (f *fakeCache) Get(subdomain, key string) (*CachedResponse, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	entry, ok := f.entries[subdomain+" "+key]
+	return entry, ok
+}
+
+func (f *fakeCache) Put(subdomain, key string, response *CachedResponse) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entries[subdomain+" "+key] = response
+}
+
+func (f *fakeCache) MaxEntryBytes() int64 {
+	return 64
+}
+
+func cachingProxy(t *testing.T, handler http.HandlerFunc) (*Proxy, *fakeCache) {
+	t.Helper()
+	backend := httptest.NewServer(handler)
+	t.Cleanup(backend.Close)
+	p := New(&serverConfig.Config{Domain: "example.test"})
+	cache := &fakeCache{entries: map[string]*CachedResponse{}}
+	p.SetCache(cache)
+	if err := p.AddBackend("demo", strings.TrimPrefix(backend.URL, "http://")); err != nil {
+		t.Fatalf("add backend: %v", err)
+	}
+	return p, cache
+}
+
+func serveCachingProxy(p *Proxy, method, path string, header http.Header) (*http.Response, string) {
+	request := httptest.NewRequest(method, "http://demo.example.test"+path, nil)
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	recorder := httptest.NewRecorder()
+	p.ServeHTTP(recorder, request)
+	response := recorder.Result()
+	body, _ := io.ReadAll(response.Body)
+	return response, string(body)
+}
+
+func TestProxy_ServesFreshCachedResponses(t *testing.T) {
+	var hits atomic.Int32
+	p, _ := cachingProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.URL.Path {
+		case "/app.js":
+			w.Header().Set("Cache-Control", "public, max-age=60")
+			w.Header().Set("ETag", `"app-1"`)
+		case "/private":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		case "/cookie":
+			w.Header().Set("Cache-Control", "public, max-age=60")
+			w.Header().Set("Set-Cookie", "session=1")
+		case "/large":
+			w.Header().Set("Cache-Control", "public, max-age=60")
+			_, _ = io.WriteString(w, strings.Repeat("x", 100))
+			return
+		}
+		_, _ = io.WriteString(w, "body of "+r.URL.Path)
+	})
+
+	response, body := serveCachingProxy(p, http.MethodGet, "/app.js", nil)
+	if body != "body of /app.js" || response.Header.Get(cacheStatusHeader) != "MISS" {
+		t.Fatalf("expected a miss, got %q %v", body, response.Header)
+	}
+	response, body = serveCachingProxy(p, http.MethodGet, "/app.js", nil)
+	if body != "body of /app.js" || response.Header.Get(cacheStatusHeader) != "HIT" || hits.Load() != 1 {
+		t.Fatalf("expected a hit without reaching the tunnel, got %q %v after %d requests", body, response.Header, hits.Load())
+	}
+	if response.Header.Get("Age") == "" || response.Header.Get("ETag") != `"app-1"` {
+		t.Fatalf("expected the cached headers with an age, got %v", response.Header)
+	}
+	response, body = serveCachingProxy(p, http.MethodGet, "/app.js", http.Header{"If-None-Match": {`W/"app-1"`}})
+	if response.StatusCode != http.StatusNotModified || body != "" {
+		t.Fatalf("expected a 304 for a matching validator, got %d %q", response.StatusCode, body)
+	}
+	if response, _ = serveCachingProxy(p, http.MethodHead, "/app.js", nil); response.Header.Get(cacheStatusHeader) != "HIT" {
+		t.Fatalf("expected HEAD to be served from the GET entry, got %v", response.Header)
+	}
+	if _, _ = serveCachingProxy(p, http.MethodGet, "/app.js", http.Header{"Authorization": {"Bearer token"}}); hits.Load() != 2 {
+		t.Fatal("expected requests with credentials to bypass the cache")
+	}
+
+	for _, path := range []string{"/private", "/cookie", "/large", "/uncacheable"} {
+		before := hits.Load()
+		serveCachingProxy(p, http.MethodGet, path, nil)
+		serveCachingProxy(p, http.MethodGet, path, nil)
+		if hits.Load()-before != 2 {
+			t.Fatalf("expected %s not to be cached", path)
+		}
+	}
+}
+
+func TestProxy_RevalidatesStaleCachedResponses(t *testing.T) {
+	var full, notModified atomic.Int32
+	p, _ := cachingProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, no-cache")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full.Add(1)
+		_, _ = io.WriteString(w, "stub response")
+	})
+
+	serveCachingProxy(p, http.MethodGet, "/", nil)
+	response, body := serveCachingProxy(p, http.MethodGet, "/", nil)
+	if response.StatusCode != http.StatusOK || body != "stub response" || response.Header.Get(cacheStatusHeader) != "REVALIDATED" {
+		t.Fatalf("expected the cached body after revalidation, got %d %q %v", response.StatusCode, body, response.Header)
+	}
+	if full.Load() != 1 || notModified.Load() != 1 {
+		t.Fatalf("expected one full response and one 304 from the tunnel, got %d and %d", full.Load(), notModified.Load())
+	}
+}
@@ -0,0 +1,176 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// minCompressBytes is the smallest response worth compressing; below it the
+// encoding overhead outweighs the savings.
+const minCompressBytes = 1024
+
+var (
+	gzipWriters = sync.Pool{New: func() any {
+		writer, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+		return writer
+	}}
+	brotliWriters = sync.Pool{New: func() any {
+		return brotli.NewWriterLevel(io.Discard, 4)
+	}}
+)
+
+// compress encodes the response with the best encoding the visitor accepts.
+func (p *Proxy) compress(response *http.Response) {
+	if !p.config.Proxy.Compression || !shouldCompress(response) {
+		return
+	}
+	encoding := negotiateEncoding(response.Request.Header.Get("Accept-Encoding"))
+	if !varies(response.Header, "Accept-Encoding") {
+		response.Header.Add("Vary", "Accept-Encoding")
+	}
+	if encoding == "" {
+		return
+	}
+	response.Body = compressBody(response.Body, encoding)
+	response.ContentLength = -1
+	response.Header.Del("Content-Length")
+	response.Header.Set("Content-Encoding", encoding)
+	// A strong validator names the uncompressed bytes, not these.
+	if etag := response.Header.Get("ETag"); strings.HasPrefix(etag, `"`) {
+		response.Header.Set("ETag", "W/"+etag)
+	}
+}
+
+func shouldCompress(response *http.Response) bool {
+	if response.Request.Method == http.MethodHead || response.StatusCode == http.StatusSwitchingProtocols {
+		return false
+	}
+	switch response.StatusCode {
+	case http.StatusNoContent, http.StatusPartialContent, http.StatusNotModified:
+		return false
+	}
+	if (response.ContentLength >= 0 && response.ContentLength < minCompressBytes) || response.Header.Get("Content-Encoding") != "" {
+		return false
+	}
+	if hasKey(cacheDirectives(response.Header.Get("Cache-Control")), "no-transform") {
+		return false
+	}
+	return compressibleType(response.Header.Get("Content-Type"))
+}
+
+func compressibleType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case mediaType == "text/event-stream":
+		return false
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml",
+		"application/wasm", "application/manifest+json", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// negotiateEncoding picks br over gzip among the encodings the visitor
+// accepts, or "" for none.
+func negotiateEncoding(acceptEncoding string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+				continue
+			}
+		}
+		accepted[coding] = true
+	}
+	switch {
+	case accepted["br"]:
+		return "br"
+	case accepted["gzip"]:
+		return "gzip"
+	}
+	return ""
+}
+
+// compressBody encodes body as it is read. The encoder is flushed after
+// every read from the tunnel, so streamed responses reach the visitor as
+// soon as the tunnel sends them. Closing the returned body early stops the
+// encoder and closes body.
+func compressBody(body io.ReadCloser, encoding string) io.ReadCloser {
+	reader, writer := io.Pipe()
+	go func() {
+		defer body.Close()
+		var encoder interface {
+			io.WriteCloser
+			Flush() error
+			Reset(io.Writer)
+		}
+		if encoding == "br" {
+			encoder = brotliWriters.Get().(*brotli.Writer)
+			defer brotliWriters.Put(encoder)
+		} else {
+			encoder = gzipWriters.Get().(*gzip.Writer)
+			defer gzipWriters.Put(encoder)
+		}
+		encoder.Reset(writer)
+		err := copyFlushing(encoder, body)
+		if closeErr := encoder.Close(); err == nil {
+			err = closeErr
+		}
+		writer.CloseWithError(err)
+	}()
+	return reader
+}
+
+func copyFlushing(encoder interface {
+	io.Writer
+	Flush() error
+}, body io.Reader) error {
+	buffer := make([]byte, 32<<10)
+	for {
+		n, err := body.Read(buffer)
+		if n > 0 {
+			if _, writeErr := encoder.Write(buffer[:n]); writeErr != nil {
+				return writeErr
+			}
+			if flushErr := encoder.Flush(); flushErr != nil {
+				return flushErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// varies reports whether a response's Vary header names a request header.
+func varies(header http.Header, name string) bool {
+	for _, vary := range header.Values("Vary") {
+		for _, varied := range strings.Split(vary, ",") {
+			if strings.EqualFold(strings.TrimSpace(varied), name) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	serverConfig "github.com/amalshaji/portr/internal/server/config"
+	"github.com/andybalholm/brotli"
+)
+
+func compressingProxy(t *testing.T, handler http.HandlerFunc) *Proxy {
+	t.Helper()
+	backend := httptest.NewServer(handler)
+	t.Cleanup(backend.Close)
+	p := New(&serverConfig.Config{Domain: "example.test", Proxy: serverConfig.ProxyConfig{Compression: true}})
+	if err := p.AddBackend("demo", strings.TrimPrefix(backend.URL, "http://")); err != nil {
+		t.Fatalf("add backend: %v", err)
+	}
+	return p
+}
+
+func getWithEncoding(p *Proxy, path, acceptEncoding string) *http.Response {
+	request := httptest.NewRequest(http.MethodGet, "http://demo.example.test"+path, nil)
+	if acceptEncoding != "" {
+		request.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	recorder := httptest.NewRecorder()
+	p.ServeHTTP(recorder, request)
+	return recorder.Result()
+}
+
+func TestProxy_CompressesNegotiatedResponses(t *testing.T) {
+	page := strings.Repeat("<p>hello from the laptop</p>", 200)
+	p := compressingProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		switch r.URL.Path {
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+		case "/small":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = io.WriteString(w, "<p>tiny</p>")
+			return
+		default:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		}
+		_, _ = io.WriteString(w, page)
+	})
+
+	response := getWithEncoding(p, "/", "gzip, br;q=0.9")
+	if response.Header.Get("Content-Encoding") != "br" || response.Header.Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("expected a brotli response, got %v", response.Header)
+	}
+	if response.Header.Get("ETag") != `W/"v1"` || response.Header.Get("Content-Length") != "" {
+		t.Fatalf("expected a weak ETag and no length, got %v", response.Header)
+	}
+	body, err := io.ReadAll(brotli.NewReader(response.Body))
+	if err != nil || string(body) != page {
+		t.Fatalf("unexpected brotli body: %v", err)
+	}
+
+	response = getWithEncoding(p, "/", "gzip, br;q=0")
+	reader, err := gzip.NewReader(response.Body)
+	if err != nil || response.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected a gzip response, got %v %v", response.Header, err)
+	}
+	if body, _ = io.ReadAll(reader); string(body) != page {
+		t.Fatal("unexpected gzip body")
+	}
+
+	for _, tc := range []struct{ path, acceptEncoding string }{
+		{"/", ""},
+		{"/image", "gzip"},
+		{"/small", "gzip"},
+	} {
+		response = getWithEncoding(p, tc.path, tc.acceptEncoding)
+		if response.Header.Get("Content-Encoding") != "" {
+			t.Fatalf("expected %s with %q uncompressed, got %v", tc.path, tc.acceptEncoding, response.Header)
+		}
+	}
+}
+
+func TestProxy_LeavesResponsesUncompressedWhenDisabled(t *testing.T) {
+	p := compressingProxy(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, strings.Repeat(`{"ok":true}`, 200))
+	})
+	p.config.Proxy.Compression = false
+
+	if response := getWithEncoding(p, "/", "gzip"); response.Header.Get("Content-Encoding") != "" {
+		t.Fatalf("expected no compression, got %v", response.Header)
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	for acceptEncoding, want := range map[string]string{
+		"":                   "",
+		"identity":           "",
+		"gzip, deflate":      "gzip",
+		"gzip, deflate, br":  "br",
+		"BR;q=0.5":           "br",
+		"br;q=0, gzip;q=0.1": "gzip",
+	} {
+		if got := negotiateEncoding(acceptEncoding); got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", acceptEncoding, got, want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	serverConfig "github.com/amalshaji/portr/internal/server/config"
+	"github.com/amalshaji/portr/internal/utils"
+)
+
+type fakeErrorPages map[string]string
+
+func (f fakeErrorPages) Render(_ context.Context, reason, subdomain, requestID string) (string, bool) {
+	page, ok := f[reason]
+	page = strings.ReplaceAll(page, "{{request_id}}", requestID)
+	return strings.ReplaceAll(page, "{{subdomain}}", subdomain), ok
+}
+
+func serveProxy(t *testing.T, p *Proxy, host, accept string) (*http.Response, string) {
+	t.Helper()
+	request := httptest.NewRequest(http.MethodGet, "http://"+host+"/", nil)
+	if accept != "" {
+		request.Header.Set("Accept", accept)
+	}
+	recorder := httptest.NewRecorder()
+	p.ServeHTTP(recorder, request)
+	response := recorder.Result()
+	body, _ := io.ReadAll(response.Body)
+	return response, string(body)
+}
+
+func TestProxy_ServesCustomAndJSONErrorPages(t *testing.T) {
+	p := New(&serverConfig.Config{Domain: "example.test"})
+	p.SetErrorPages(fakeErrorPages{utils.ErrorReasonUnregisteredSubdomain: "<p>{{subdomain}} is asleep</p>"})
+
+	response, body := serveProxy(t, p, "demo.example.test", "text/html")
+	if response.StatusCode != http.StatusNotFound || body != "<p>demo is asleep</p>" {
+		t.Fatalf("unexpected custom page %d %q", response.StatusCode, body)
+	}
+	if response.Header.Get("X-Portr-Error-Reason") != utils.ErrorReasonUnregisteredSubdomain {
+		t.Fatalf("missing error reason header: %v", response.Header)
+	}
+
+	response, body = serveProxy(t, p, "demo.example.test", "application/json")
+	if response.Header.Get("Content-Type") != "application/json" || !strings.Contains(body, `"code":"unregistered-subdomain"`) {
+		t.Fatalf("expected a JSON error, got %q %q", response.Header.Get("Content-Type"), body)
+	}
+
+	p.SetErrorPages(nil)
+	response, body = serveProxy(t, p, "demo.example.test", "")
+	if body != utils.UnregisteredSubdomain("demo", response.Header.Get(utils.RequestIDHeader)) {
+		t.Fatal("expected the built-in page without configured pages")
+	}
+}
+
+func TestProxy_ReplacesLocalServerNotOnlinePage(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("X-Portr-Error", "true")
+		w.Header().Set("X-Portr-Error-Reason", utils.ErrorReasonLocalServerNotOnline)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = io.WriteString(w, "built-in page")
+	}))
+	defer backend.Close()
+
+	p := New(&serverConfig.Config{Domain: "example.test"})
+	p.SetErrorPages(fakeErrorPages{utils.ErrorReasonLocalServerNotOnline: "<p>{{subdomain}} is offline</p>"})
+	if err := p.AddBackend("demo", strings.TrimPrefix(backend.URL, "http://")); err != nil {
+		t.Fatalf("add backend: %v", err)
+	}
+
+	response, body := serveProxy(t, p, "demo.example.test", "")
+	if response.StatusCode != http.StatusServiceUnavailable || body != "<p>demo is offline</p>" {
+		t.Fatalf("unexpected response %d %q", response.StatusCode, body)
+	}
+
+	if _, body = serveProxy(t, p, "demo.example.test", "application/json"); body != "built-in page" {
+		t.Fatalf("expected JSON visitors to get the client's response, got %q", body)
+	}
+}
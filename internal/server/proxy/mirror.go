@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+const (
+	// maxConcurrentMirrors bounds the mirror requests in flight. Requests
+	// beyond it are not mirrored, so a slow mirror cannot pile up goroutines.
+	maxConcurrentMirrors = 64
+	mirrorTimeout        = 30 * time.Second
+	// maxMirrorResponseDrain is how much of a mirror's response is read so
+	// its connection can be reused; the rest is dropped with the connection.
+	maxMirrorResponseDrain = 1 << 20
+)
+
+// MirrorRule copies a subdomain's requests to the tunnels of Target.
+type MirrorRule struct {
+	ID           uint
+	Target       string
+	MaxBodyBytes int64
+}
+
+// Mirrors looks up mirroring rules and counts their deliveries.
+type Mirrors interface {
+	Rule(ctx context.Context, subdomain string) (MirrorRule, bool)
+	Record(ruleID uint, delivered bool)
+}
+
+// SetMirrors installs the mirroring rules. Without them no traffic is
+// mirrored.
+func (p *Proxy) SetMirrors(mirrors Mirrors) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.mirrors = mirrors
+}
+
+func (p *Proxy) getMirrors() Mirrors {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.mirrors
+}
+
+// mirror sends a copy of r to the subdomain's mirror target in the
+// background. The body is buffered up to the rule's limit and put back in
+// front of the unread rest, so the primary request is forwarded unchanged;
+// bodies over the limit are not mirrored and count as failed deliveries.
+func (p *Proxy) mirror(r *http.Request, subdomain string) {
+	mirrors := p.getMirrors()
+	if mirrors == nil || isUpgradeRequest(r) {
+		return
+	}
+	rule, ok := mirrors.Rule(r.Context(), subdomain)
+	if !ok {
+		return
+	}
+
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, rule.MaxBodyBytes+1))
+		r.Body = &prefixedBody{Reader: io.MultiReader(bytes.NewReader(body), r.Body), Closer: r.Body}
+		if err != nil || int64(len(body)) > rule.MaxBodyBytes {
+			mirrors.Record(rule.ID, false)
+			return
+		}
+	}
+
+	select {
+	case p.mirrorSlots <- struct{}{}:
+	default:
+		mirrors.Record(rule.ID, false)
+		return
+	}
+
+	outbound := p.mirrorRequest(r, rule.Target, subdomain, body)
+	go func() {
+		defer func() { <-p.mirrorSlots }()
+		mirrors.Record(rule.ID, p.deliverMirror(outbound, rule.Target))
+	}()
+}
+
+func (p *Proxy) mirrorRequest(r *http.Request, target, subdomain string, body []byte) *http.Request {
+	outbound := r.Clone(context.Background())
+	outbound.RequestURI = ""
+	outbound.Body = http.NoBody
+	if len(body) > 0 {
+		outbound.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	outbound.ContentLength = int64(len(body))
+	outbound.GetBody = nil
+	outbound.TransferEncoding = nil
+	if tunnelURL, err := url.Parse(p.config.HttpTunnelUrl(target)); err == nil {
+		outbound.Host = tunnelURL.Host
+	}
+	outbound.Header.Del("Expect")
+	outbound.Header.Set("X-Portr-Mirrored-From", subdomain)
+	return outbound
+}
+
+// deliverMirror sends a mirrored request and discards the response. It
+// reports false when the target has no tunnel or its local server is down.
+func (p *Proxy) deliverMirror(outbound *http.Request, target string) bool {
+	backends, err := p.nextBackends(target, 1)
+	if err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), mirrorTimeout)
+	defer cancel()
+	outbound = outbound.WithContext(ctx)
+	outbound.URL.Scheme = "http"
+	outbound.URL.Host = backends[0]
+
+	response, err := p.transport.RoundTrip(outbound)
+	if err != nil {
+		log.Debug("Failed to mirror request", "error", err, "target", target)
+		return false
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, maxMirrorResponseDrain))
+	_ = response.Body.Close()
+	return response.Header.Get("X-Portr-Error") == ""
+}
+
+type prefixedBody struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	serverConfig "github.com/amalshaji/portr/internal/server/config"
+)
+
+type recordedMirror struct {
+	body string
+	from string
+	host string
+}
+
+type fakeMirrors struct {
+	rule MirrorRule
+
+	mu        sync.Mutex
+	delivered int
+	failed    int
+	done      chan struct{}
+}
+
+func (f *fakeMirrors) Rule(_ context.Context, subdomain string) (MirrorRule, bool) {
+	return f.rule, subdomain == "primary"
+}
+
+func (f *fakeMirrors) Record(_ uint, delivered bool) {
+	f.mu.Lock()
+	if delivered {
+		f.delivered++
+	} else {
+		f.failed++
+	}
+	f.mu.Unlock()
+	f.done <- struct{}{}
+}
+
+func (f *fakeMirrors) wait(t *testing.T) {
+	t.Helper()
+	select {
+	case <-f.done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for mirror delivery")
+	}
+}
+
+func TestProxy_MirrorsRequestsWithoutAffectingPrimary(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = io.WriteString(w, "primary:"+string(body))
+	}))
+	defer primary.Close()
+	mirrored := make(chan recordedMirror, 2)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mirrored <- recordedMirror{body: string(body), from: r.Header.Get("X-Portr-Mirrored-From"), host: r.Host}
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer shadow.Close()
+
+	p := New(&serverConfig.Config{Domain: "example.test"})
+	mirrors := &fakeMirrors{rule: MirrorRule{ID: 1, Target: "shadow", MaxBodyBytes: 8}, done: make(chan struct{}, 4)}
+	p.SetMirrors(mirrors)
+	_ = p.AddBackend("primary", strings.TrimPrefix(primary.URL, "http://"))
+	_ = p.AddBackend("shadow", strings.TrimPrefix(shadow.URL, "http://"))
+
+	send := func(body string) string {
+		request := httptest.NewRequest(http.MethodPost, "http://primary.example.test/hook", strings.NewReader(body))
+		recorder := httptest.NewRecorder()
+		p.ServeHTTP(recorder, request)
+		return recorder.Body.String()
+	}
+
+	if got := send("payload"); got != "primary:payload" {
+		t.Fatalf("unexpected primary response %q", got)
+	}
+	mirrors.wait(t)
+	select {
+	case got := <-mirrored:
+		if got.body != "payload" || got.from != "primary" || got.host != "shadow.example.test" {
+			t.Fatalf("unexpected mirrored request %+v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("mirror target was not called")
+	}
+
+	if got := send("a body over the limit"); got != "primary:a body over the limit" {
+		t.Fatalf("expected the primary to get the whole body, got %q", got)
+	}
+	mirrors.wait(t)
+
+	_ = p.RemoveBackend("shadow", strings.TrimPrefix(shadow.URL, "http://"))
+	send("offline")
+	mirrors.wait(t)
+
+	mirrors.mu.Lock()
+	defer mirrors.mu.Unlock()
+	if mirrors.delivered != 1 || mirrors.failed != 2 {
+		t.Fatalf("expected 1 delivered and 2 failed, got %d and %d", mirrors.delivered, mirrors.failed)
+	}
+	if len(mirrored) != 0 {
+		t.Fatal("expected oversized and undeliverable requests not to reach the mirror")
+	}
+}
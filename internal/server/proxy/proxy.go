@@ -10,11 +10,13 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/amalshaji/portr/internal/server/config"
+	"github.com/amalshaji/portr/internal/tracing"
 	"github.com/amalshaji/portr/internal/utils"
 	"github.com/charmbracelet/log"
 )
@@ -26,12 +28,35 @@ type Proxy struct {
 	lock      sync.RWMutex
 	server    *http.Server
 	transport *http.Transport
+	listener  net.Listener
+	// predecessor is the proxy of the process this one replaced, which keeps
+	// serving the tunnels that have not reconnected yet.
+	predecessor string
+	errorPages  ErrorPages
+	mirrors     Mirrors
+	mirrorSlots chan struct{}
+	splits      Splits
+	warnings    VisitorWarnings
+	accessLog   AccessLog
+	cache       ResponseCache
+	quotas      BandwidthQuotas
+}
+
+// ErrorPages renders the page a subdomain's team configured for an error
+// reason, reporting false when it uses portr's built-in page.
+type ErrorPages interface {
+	Render(ctx context.Context, reason, subdomain, requestID string) (string, bool)
 }
 
 func (p *Proxy) GetServerAddr() string {
 	return ":" + fmt.Sprint(p.config.Proxy.Port)
 }
 
+// Config returns the server configuration the proxy routes with.
+func (p *Proxy) Config() *config.Config {
+	return p.config
+}
+
 func New(config *config.Config) *Proxy {
 	transport := &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
@@ -46,10 +71,11 @@ func New(config *config.Config) *Proxy {
 		ExpectContinueTimeout: time.Second,
 	}
 	p := &Proxy{
-		config:    config,
-		routes:    make(map[string][]string),
-		rrIdx:     make(map[string]int),
-		transport: transport,
+		config:      config,
+		routes:      make(map[string][]string),
+		rrIdx:       make(map[string]int),
+		transport:   transport,
+		mirrorSlots: make(chan struct{}, maxConcurrentMirrors),
 	}
 	p.server = &http.Server{
 		Addr:              p.GetServerAddr(),
@@ -117,42 +143,231 @@ func (p *Proxy) RemoveBackend(src, dst string) error {
 	return nil
 }
 
-func unregisteredSubdomainError(w http.ResponseWriter, subdomain string) {
-	w.Header().Set("X-Portr-Error", "true")
-	w.Header().Set("X-Portr-Error-Reason", "unregistered-subdomain")
-	w.WriteHeader(http.StatusNotFound)
-	w.Write([]byte(utils.UnregisteredSubdomain(subdomain)))
+// HasBackend reports whether dst is a backend of the subdomain src.
+func (p *Proxy) HasBackend(src, dst string) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return slices.Contains(p.routes[src], dst)
+}
+
+// Routes returns a copy of the route table, keyed by subdomain.
+func (p *Proxy) Routes() map[string][]string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	routes := make(map[string][]string, len(p.routes))
+	for subdomain, backends := range p.routes {
+		routes[subdomain] = slices.Clone(backends)
+	}
+	return routes
+}
+
+// SetErrorPages installs the team-configured error pages. Without them the
+// proxy serves portr's built-in pages.
+func (p *Proxy) SetErrorPages(pages ErrorPages) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.errorPages = pages
+}
+
+func (p *Proxy) getErrorPages() ErrorPages {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.errorPages
 }
 
-func connectionLostError(w http.ResponseWriter) {
+// customErrorPage returns the configured page for an error served as HTML.
+func (p *Proxy) customErrorPage(r *http.Request, reason, subdomain string) (string, bool) {
+	pages := p.getErrorPages()
+	if pages == nil || utils.WantsJSON(r.Header.Get("Accept")) {
+		return "", false
+	}
+	return pages.Render(r.Context(), reason, subdomain, r.Header.Get(utils.RequestIDHeader))
+}
+
+func (p *Proxy) writeError(w http.ResponseWriter, r *http.Request, status int, reason, subdomain string, builtin func(requestID string) string) {
 	w.Header().Set("X-Portr-Error", "true")
-	w.Header().Set("X-Portr-Error-Reason", "connection-lost")
-	w.WriteHeader(http.StatusServiceUnavailable)
-	w.Write([]byte(utils.ConnectionLost()))
+	w.Header().Set("X-Portr-Error-Reason", reason)
+	if utils.WantsJSON(r.Header.Get("Accept")) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(utils.ErrorJSON(reason, subdomain, r.Header.Get(utils.RequestIDHeader)))
+		return
+	}
+	page, ok := p.customErrorPage(r, reason, subdomain)
+	if !ok {
+		page = builtin(r.Header.Get(utils.RequestIDHeader))
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write([]byte(page))
+}
+
+func (p *Proxy) unregisteredSubdomainError(w http.ResponseWriter, r *http.Request, subdomain string) {
+	p.writeError(w, r, http.StatusNotFound, utils.ErrorReasonUnregisteredSubdomain, subdomain, func(requestID string) string {
+		return utils.UnregisteredSubdomain(subdomain, requestID)
+	})
+}
+
+func (p *Proxy) connectionLostError(w http.ResponseWriter, r *http.Request, subdomain string) {
+	p.writeError(w, r, http.StatusServiceUnavailable, utils.ErrorReasonConnectionLost, subdomain, utils.ConnectionLost)
+}
+
+// replaceLocalServerError swaps the tunnel client's local-server-not-online
+// page for the team's page, so clients of any version show it.
+func (p *Proxy) replaceLocalServerError(response *http.Response, subdomain string) error {
+	if response.Header.Get("X-Portr-Error-Reason") != utils.ErrorReasonLocalServerNotOnline {
+		return nil
+	}
+	page, ok := p.customErrorPage(response.Request, utils.ErrorReasonLocalServerNotOnline, subdomain)
+	if !ok {
+		return nil
+	}
+	_ = response.Body.Close()
+	response.Body = io.NopCloser(strings.NewReader(page))
+	response.ContentLength = int64(len(page))
+	response.Header.Set("Content-Length", strconv.Itoa(len(page)))
+	response.Header.Set("Content-Type", "text/html; charset=utf-8")
+	response.Header.Del("Content-Encoding")
+	return nil
+}
+
+// assignRequestID keeps the visitor's request ID when it is safe, or
+// assigns a new one, and sends it both to the tunnel and back to the
+// visitor.
+func assignRequestID(w http.ResponseWriter, r *http.Request) {
+	requestID := r.Header.Get(utils.RequestIDHeader)
+	if !utils.ValidRequestID(requestID) {
+		requestID = utils.NewRequestID()
+		r.Header.Set(utils.RequestIDHeader, requestID)
+	}
+	w.Header().Set(utils.RequestIDHeader, requestID)
 }
 
 func (p *Proxy) handleRequest(w http.ResponseWriter, r *http.Request) {
+	assignRequestID(w, r)
 	subdomain := p.config.ExtractSubdomain(r.Host)
-	backends, err := p.nextBackends(subdomain, 3)
+	w, r, endSpan := traceRequest(w, r, subdomain)
+	defer endSpan()
+	target, splitCookie := p.resolveSplit(r, subdomain)
+	backends, err := p.nextBackends(target, 3)
 	if err != nil {
-		unregisteredSubdomainError(w, subdomain)
+		if predecessor := p.getPredecessor(); predecessor != "" {
+			p.forwardToPredecessor(w, r, predecessor, subdomain)
+			return
+		}
+		p.unregisteredSubdomainError(w, r, subdomain)
+		return
+	}
+	w, logAccess := p.startAccessLog(w, r, subdomain)
+	allowed := p.withinQuota(backends)
+	if len(allowed) == 0 {
+		p.bandwidthExceededError(w, r, subdomain)
+		logAccess(backends[0])
+		return
+	}
+	backends = allowed
+	if p.warnVisitor(w, r, subdomain) {
+		logAccess(backends[0])
 		return
 	}
 	if isUpgradeRequest(r) || !isReplaySafe(r) {
 		backends = backends[:1]
 	}
+	p.mirror(r, target)
+	lookup := p.lookupCache(r, target)
+	if lookup.fresh() {
+		p.serveCached(w, r, lookup.entry, splitCookie)
+		logAccess(backends[0])
+		return
+	}
+	lookup.revalidate(r)
 
-	proxy := httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: backends[0]})
-	proxy.Transport = &backendTransport{
+	transport := &backendTransport{
 		base:      p.transport,
 		backends:  backends,
-		subdomain: subdomain,
+		subdomain: target,
 	}
-	proxy.ErrorHandler = func(res http.ResponseWriter, _ *http.Request, err error) {
+	proxy := httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: backends[0]})
+	proxy.Transport = transport
+	proxy.ModifyResponse = func(response *http.Response) error {
+		// The visitor already has the ID; an app echoing it would repeat it.
+		response.Header.Del(utils.RequestIDHeader)
+		if err := p.replaceLocalServerError(response, subdomain); err != nil {
+			return err
+		}
+		lookup.handleResponse(response)
+		if splitCookie != nil {
+			response.Header.Add("Set-Cookie", splitCookie.String())
+		}
+		p.compress(response)
+		return nil
+	}
+	proxy.ErrorHandler = func(res http.ResponseWriter, req *http.Request, err error) {
 		if !errors.Is(err, io.EOF) {
-			log.Error("Error from proxy", "error", err, "subdomain", subdomain)
+			log.Error("Error from proxy", "error", err, "subdomain", target)
+		}
+		p.connectionLostError(res, req, subdomain)
+	}
+	proxy.ServeHTTP(w, r)
+	logAccess(transport.servedBy())
+}
+
+// SetPredecessor makes the proxy forward requests for unknown subdomains to
+// the proxy of the process it replaced, until that process is gone.
+func (p *Proxy) SetPredecessor(addr string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.predecessor = addr
+}
+
+func (p *Proxy) getPredecessor() string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.predecessor
+}
+
+func (p *Proxy) clearPredecessor(addr string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.predecessor == addr {
+		p.predecessor = ""
+		log.Info("Previous process stopped serving tunnels", "address", addr)
+	}
+}
+
+// CheckPredecessor reports whether the proxy of the replaced process still
+// accepts connections, and forgets it once it does not.
+func (p *Proxy) CheckPredecessor() bool {
+	predecessor := p.getPredecessor()
+	if predecessor == "" {
+		return false
+	}
+	conn, err := net.DialTimeout("tcp", predecessor, time.Second)
+	if err != nil {
+		p.clearPredecessor(predecessor)
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
+
+func (p *Proxy) forwardToPredecessor(w http.ResponseWriter, r *http.Request, predecessor, subdomain string) {
+	proxy := httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: predecessor})
+	proxy.Transport = p.transport
+	proxy.ModifyResponse = func(response *http.Response) error {
+		response.Header.Del(utils.RequestIDHeader)
+		return nil
+	}
+	proxy.ErrorHandler = func(res http.ResponseWriter, req *http.Request, err error) {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			p.clearPredecessor(predecessor)
+			p.unregisteredSubdomainError(res, req, subdomain)
+			return
 		}
-		connectionLostError(res)
+		log.Error("Error from previous process", "error", err, "subdomain", subdomain)
+		p.connectionLostError(res, req, subdomain)
 	}
 	proxy.ServeHTTP(w, r)
 }
@@ -194,12 +409,22 @@ type backendTransport struct {
 	base      http.RoundTripper
 	backends  []string
 	subdomain string
+	served    string
+}
+
+// servedBy returns the backend that answered, or the first one tried when
+// none did.
+func (t *backendTransport) servedBy() string {
+	if t.served != "" {
+		return t.served
+	}
+	return t.backends[0]
 }
 
 func (t *backendTransport) RoundTrip(request *http.Request) (*http.Response, error) {
 	var lastErr error
 	for attempt, backend := range t.backends {
-		outbound := request.Clone(request.Context())
+		outbound, span := traceBackend(request, backend, attempt+1)
 		outboundURL := *request.URL
 		outboundURL.Scheme = "http"
 		outboundURL.Host = backend
@@ -207,8 +432,12 @@ func (t *backendTransport) RoundTrip(request *http.Request) (*http.Response, err
 
 		response, err := t.base.RoundTrip(outbound)
 		if err == nil {
+			tracing.SetHTTPStatus(span, response.StatusCode)
+			span.End()
+			t.served = backend
 			return response, nil
 		}
+		tracing.End(span, err)
 		if response != nil && response.Body != nil {
 			_ = response.Body.Close()
 		}
@@ -233,14 +462,38 @@ func isUpgradeRequest(request *http.Request) bool {
 	return false
 }
 
-func (p *Proxy) Start() {
+func (p *Proxy) Start(listener net.Listener) {
 	log.Info("Starting proxy server", "port", p.GetServerAddr())
 
-	if err := p.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	p.lock.Lock()
+	p.listener = listener
+	p.lock.Unlock()
+
+	if err := p.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
 		log.Fatal("Failed to start proxy server", "error", err)
 	}
 }
 
+// Retire stops accepting on the public listener, which now belongs to the
+// replacement process, and serves the tunnels still attached to this process
+// on fallback instead. Keep-alive connections are closed once idle so clients
+// reconnect to the replacement.
+func (p *Proxy) Retire(fallback net.Listener) {
+	p.server.SetKeepAlivesEnabled(false)
+	go func() {
+		if err := p.server.Serve(fallback); err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
+			log.Error("Failed to serve handoff proxy", "error", err)
+		}
+	}()
+
+	p.lock.RLock()
+	listener := p.listener
+	p.lock.RUnlock()
+	if listener != nil {
+		_ = listener.Close()
+	}
+}
+
 func (p *Proxy) Shutdown(_ context.Context) {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -339,3 +339,44 @@ func TestProxyPreservesResponseTrailers(t *testing.T) {
 		t.Fatalf("expected response trailer, got %q", response.Trailer.Get("X-Checksum"))
 	}
 }
+
+func TestProxyForwardsUnknownSubdomainsToPredecessor(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "served by "+r.Host)
+	}))
+	defer backend.Close()
+
+	previous := newTestProxy("old", strings.TrimPrefix(backend.URL, "http://"))
+	previousServer := httptest.NewServer(http.HandlerFunc(previous.handleRequest))
+	predecessor := strings.TrimPrefix(previousServer.URL, "http://")
+
+	p := newTestProxy("new", deadBackendAddress(t))
+	p.SetPredecessor(predecessor)
+	proxyServer := httptest.NewServer(http.HandlerFunc(p.handleRequest))
+	defer proxyServer.Close()
+
+	request, _ := http.NewRequest(http.MethodGet, proxyServer.URL, nil)
+	request.Host = "old.example.com"
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("request proxy: %v", err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || string(body) != "served by old.example.com" {
+		t.Fatalf("expected predecessor to serve request, status=%d body=%q", response.StatusCode, body)
+	}
+
+	previousServer.Close()
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("request proxy after predecessor exit: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusNotFound || response.Header.Get("X-Portr-Error-Reason") != "unregistered-subdomain" {
+		t.Fatalf("expected unregistered subdomain, status=%d reason=%q", response.StatusCode, response.Header.Get("X-Portr-Error-Reason"))
+	}
+	if p.getPredecessor() != "" {
+		t.Fatalf("expected predecessor to be cleared once it stopped accepting")
+	}
+}
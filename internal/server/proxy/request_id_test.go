@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	serverConfig "github.com/amalshaji/portr/internal/server/config"
+	"github.com/amalshaji/portr/internal/utils"
+)
+
+func TestProxy_AssignsAndForwardsRequestIDs(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(utils.RequestIDHeader, r.Header.Get(utils.RequestIDHeader))
+		_, _ = io.WriteString(w, r.Header.Get(utils.RequestIDHeader))
+	}))
+	defer backend.Close()
+	p := New(&serverConfig.Config{Domain: "example.test"})
+	_ = p.AddBackend("demo", strings.TrimPrefix(backend.URL, "http://"))
+
+	for incoming, kept := range map[string]bool{"": false, "trace-42:a.b_c": true, "not valid": false} {
+		request := httptest.NewRequest(http.MethodGet, "http://demo.example.test/", nil)
+		if incoming != "" {
+			request.Header.Set(utils.RequestIDHeader, incoming)
+		}
+		recorder := httptest.NewRecorder()
+		p.ServeHTTP(recorder, request)
+
+		ids := recorder.Result().Header.Values(utils.RequestIDHeader)
+		if len(ids) != 1 || ids[0] != recorder.Body.String() || !utils.ValidRequestID(ids[0]) {
+			t.Fatalf("expected the tunnel and visitor to see one shared ID for %q, got %v and %q", incoming, ids, recorder.Body.String())
+		}
+		if kept != (ids[0] == incoming) {
+			t.Fatalf("incoming ID %q: expected kept=%v, got %q", incoming, kept, ids[0])
+		}
+	}
+}
+
+func TestProxy_ErrorsIncludeTheRequestID(t *testing.T) {
+	p := New(&serverConfig.Config{Domain: "example.test"})
+	p.SetErrorPages(fakeErrorPages{utils.ErrorReasonUnregisteredSubdomain: "<p>{{request_id}}</p>"})
+
+	request := httptest.NewRequest(http.MethodGet, "http://demo.example.test/", nil)
+	request.Header.Set(utils.RequestIDHeader, "trace-1")
+	recorder := httptest.NewRecorder()
+	p.ServeHTTP(recorder, request)
+	if recorder.Body.String() != "<p>trace-1</p>" || recorder.Header().Get(utils.RequestIDHeader) != "trace-1" {
+		t.Fatalf("expected the custom page to show the ID, got %q", recorder.Body.String())
+	}
+
+	response, body := serveProxy(t, p, "demo.example.test", "application/json")
+	if id := response.Header.Get(utils.RequestIDHeader); id == "" || !strings.Contains(body, `"request_id":"`+id+`"`) {
+		t.Fatalf("expected the JSON error to carry %q, got %s", id, body)
+	}
+}
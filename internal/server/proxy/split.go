@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+)
+
+const (
+	splitCookieName = "portr_split"
+	splitPrimary    = "primary"
+	splitSecondary  = "secondary"
+	splitCookieAge  = 24 * 60 * 60
+)
+
+// SplitRoute serves a subdomain from the tunnels of Primary and Secondary,
+// sending PrimaryWeight percent of requests to Primary.
+type SplitRoute struct {
+	ID            uint
+	Primary       string
+	Secondary     string
+	PrimaryWeight int
+	Sticky        bool
+}
+
+// Splits looks up split routes.
+type Splits interface {
+	Split(ctx context.Context, subdomain string) (SplitRoute, bool)
+}
+
+// SetSplits installs the split routes. Without them every subdomain is served
+// by its own tunnels.
+func (p *Proxy) SetSplits(splits Splits) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.splits = splits
+}
+
+func (p *Proxy) getSplits() Splits {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.splits
+}
+
+func (p *Proxy) hasRoute(subdomain string) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return len(p.routes[subdomain]) > 0
+}
+
+// resolveSplit returns the subdomain whose tunnels serve r. For a split
+// route it picks a side by weight, or by the visitor's cookie on sticky
+// routes, and falls back to the other side when the picked one has no
+// tunnel. It also returns the cookie to set when stickiness needs one.
+func (p *Proxy) resolveSplit(r *http.Request, subdomain string) (string, *http.Cookie) {
+	splits := p.getSplits()
+	if splits == nil {
+		return subdomain, nil
+	}
+	route, ok := splits.Split(r.Context(), subdomain)
+	if !ok {
+		return subdomain, nil
+	}
+
+	side := ""
+	if route.Sticky {
+		if cookie, err := r.Cookie(splitCookieName); err == nil && (cookie.Value == splitPrimary || cookie.Value == splitSecondary) {
+			side = cookie.Value
+		}
+	}
+	pinned := side
+	if side == "" {
+		side = splitSecondary
+		if rand.IntN(100) < route.PrimaryWeight {
+			side = splitPrimary
+		}
+	}
+
+	target, other := route.Primary, route.Secondary
+	if side == splitSecondary {
+		target, other = other, target
+	}
+	if !p.hasRoute(target) && p.hasRoute(other) {
+		target = other
+		if side == splitPrimary {
+			side = splitSecondary
+		} else {
+			side = splitPrimary
+		}
+	}
+
+	if !route.Sticky || side == pinned {
+		return target, nil
+	}
+	return target, &http.Cookie{
+		Name:     splitCookieName,
+		Value:    side,
+		Path:     "/",
+		MaxAge:   splitCookieAge,
+		HttpOnly: true,
+		Secure:   !p.config.UseLocalHost,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
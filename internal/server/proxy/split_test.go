@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	serverConfig "github.com/amalshaji/portr/internal/server/config"
+)
+
+type fakeSplits map[string]SplitRoute
+
+func (f fakeSplits) Split(_ context.Context, subdomain string) (SplitRoute, bool) {
+	route, ok := f[subdomain]
+	return route, ok
+}
+
+func namedBackend(t *testing.T, name string) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, name)
+	}))
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func sendSplit(p *Proxy, cookie *http.Cookie) (string, *http.Response) {
+	request := httptest.NewRequest(http.MethodGet, "http://checkout.example.test/", nil)
+	if cookie != nil {
+		request.AddCookie(cookie)
+	}
+	recorder := httptest.NewRecorder()
+	p.ServeHTTP(recorder, request)
+	return recorder.Body.String(), recorder.Result()
+}
+
+func TestProxy_SplitRoutesByWeight(t *testing.T) {
+	p := New(&serverConfig.Config{Domain: "example.test"})
+	primary := namedBackend(t, "main")
+	_ = p.AddBackend("checkout-main", primary)
+	_ = p.AddBackend("checkout-branch", namedBackend(t, "branch"))
+	route := SplitRoute{ID: 1, Primary: "checkout-main", Secondary: "checkout-branch", PrimaryWeight: 100}
+	p.SetSplits(fakeSplits{"checkout": route})
+
+	for range 5 {
+		if body, response := sendSplit(p, nil); body != "main" || len(response.Cookies()) != 0 {
+			t.Fatalf("expected every request on main without a cookie, got %q %v", body, response.Cookies())
+		}
+	}
+
+	route.PrimaryWeight = 0
+	p.SetSplits(fakeSplits{"checkout": route})
+	if body, _ := sendSplit(p, nil); body != "branch" {
+		t.Fatalf("expected the secondary at weight 0, got %q", body)
+	}
+
+	_ = p.RemoveBackend("checkout-branch", p.Routes()["checkout-branch"][0])
+	if body, _ := sendSplit(p, nil); body != "main" {
+		t.Fatalf("expected a fallback to the primary while the secondary is down, got %q", body)
+	}
+}
+
+func TestProxy_StickySplitKeepsVisitorsOnTheirSide(t *testing.T) {
+	p := New(&serverConfig.Config{Domain: "example.test"})
+	_ = p.AddBackend("checkout-main", namedBackend(t, "main"))
+	_ = p.AddBackend("checkout-branch", namedBackend(t, "branch"))
+	p.SetSplits(fakeSplits{"checkout": {ID: 1, Primary: "checkout-main", Secondary: "checkout-branch", PrimaryWeight: 0, Sticky: true}})
+
+	body, response := sendSplit(p, nil)
+	cookies := response.Cookies()
+	if body != "branch" || len(cookies) != 1 || cookies[0].Name != splitCookieName || cookies[0].Value != splitSecondary || !cookies[0].HttpOnly {
+		t.Fatalf("expected the branch with a sticky cookie, got %q %v", body, cookies)
+	}
+
+	body, response = sendSplit(p, &http.Cookie{Name: splitCookieName, Value: splitPrimary})
+	if body != "main" || len(response.Cookies()) != 0 {
+		t.Fatalf("expected the cookie to pin the visitor to main, got %q %v", body, response.Cookies())
+	}
+}
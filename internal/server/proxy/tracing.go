@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/amalshaji/portr/internal/tracing"
+	"github.com/amalshaji/portr/internal/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceRequest starts the span of a visitor's request, continuing the trace
+// the visitor sent, and returns the writer and request that carry it. The
+// returned function ends the span. Without an exporter nothing is wrapped
+// and the visitor's traceparent passes through unchanged.
+func traceRequest(w http.ResponseWriter, r *http.Request, subdomain string) (http.ResponseWriter, *http.Request, func()) {
+	ctx, span := tracing.Tracer().Start(tracing.Extract(r.Context(), r.Header), "proxy.request",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path),
+			attribute.String("server.address", r.Host),
+			attribute.String("portr.subdomain", subdomain),
+			attribute.String("portr.request_id", r.Header.Get(utils.RequestIDHeader)),
+		),
+	)
+	if !span.IsRecording() {
+		return w, r, func() {}
+	}
+	recorder := &accessRecorder{ResponseWriter: w}
+	r = r.WithContext(ctx)
+	tracing.Inject(ctx, r.Header)
+	return recorder, r, func() {
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		tracing.SetHTTPStatus(span, status)
+		span.End()
+	}
+}
+
+// traceBackend starts the span of one attempt to reach a tunnel backend and
+// sends its trace context through the tunnel, so the local service's spans
+// join the visitor's trace.
+func traceBackend(request *http.Request, backend string, attempt int) (*http.Request, trace.Span) {
+	ctx, span := tracing.Tracer().Start(request.Context(), "proxy.backend",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("portr.backend", backend),
+			attribute.Int("portr.attempt", attempt),
+		),
+	)
+	outbound := request.Clone(ctx)
+	tracing.Inject(ctx, outbound.Header)
+	return outbound, span
+}
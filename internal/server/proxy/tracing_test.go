@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	serverConfig "github.com/amalshaji/portr/internal/server/config"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const visitorTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func traceparentBackend(t *testing.T, seen chan<- string) string {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen <- r.Header.Get("Traceparent")
+	}))
+	t.Cleanup(backend.Close)
+	return strings.TrimPrefix(backend.URL, "http://")
+}
+
+func sendTraced(p *Proxy) {
+	request := httptest.NewRequest(http.MethodGet, "http://demo.example.test/orders", nil)
+	request.Header.Set("Traceparent", visitorTraceparent)
+	p.ServeHTTP(httptest.NewRecorder(), request)
+}
+
+func TestProxy_PassesTraceContextThroughWithoutTracing(t *testing.T) {
+	seen := make(chan string, 1)
+	p := New(&serverConfig.Config{Domain: "example.test"})
+	_ = p.AddBackend("demo", traceparentBackend(t, seen))
+
+	sendTraced(p)
+	if got := <-seen; got != visitorTraceparent {
+		t.Fatalf("expected the visitor's traceparent to reach the tunnel, got %q", got)
+	}
+}
+
+func TestProxy_RecordsSpansInTheVisitorsTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	seen := make(chan string, 1)
+	p := New(&serverConfig.Config{Domain: "example.test"})
+	_ = p.AddBackend("demo", traceparentBackend(t, seen))
+	sendTraced(p)
+	forwarded := <-seen
+
+	spans := recorder.Ended()
+	if len(spans) != 2 || spans[0].Name() != "proxy.backend" || spans[1].Name() != "proxy.request" {
+		t.Fatalf("expected a request and a backend span, got %d", len(spans))
+	}
+	backend, request := spans[0], spans[1]
+	if request.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || request.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Fatalf("expected the request span to continue the visitor's trace, got parent %v", request.Parent())
+	}
+	if backend.Parent().SpanID() != request.SpanContext().SpanID() {
+		t.Fatal("expected the backend span to be a child of the request span")
+	}
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + backend.SpanContext().SpanID().String() + "-01"
+	if forwarded != want {
+		t.Fatalf("expected the tunnel to get the backend span as parent, got %q want %q", forwarded, want)
+	}
+}
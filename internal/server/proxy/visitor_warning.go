@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/amalshaji/portr/internal/utils"
+)
+
+const (
+	visitorWarningCookieName = "portr_visitor_warning"
+	visitorWarningCookieAge  = 7 * 24 * 60 * 60
+	// visitorWarningParam marks the interstitial's continue link. The proxy
+	// consumes it, so it never reaches the tunnel.
+	visitorWarningParam = "portr_warning_accepted"
+	skipWarningHeader   = "X-Portr-Skip-Warning"
+)
+
+// VisitorWarning names who runs a tunnel on the interstitial.
+type VisitorWarning struct {
+	Owner string
+	Team  string
+}
+
+// VisitorWarnings looks up the interstitial for a subdomain, reporting false
+// when its team has not turned it on.
+type VisitorWarnings interface {
+	Warning(ctx context.Context, subdomain string) (VisitorWarning, bool)
+}
+
+// SetVisitorWarnings installs the team-configured interstitials. Without them
+// visitors go straight to the tunnel.
+func (p *Proxy) SetVisitorWarnings(warnings VisitorWarnings) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.warnings = warnings
+}
+
+func (p *Proxy) getVisitorWarnings() VisitorWarnings {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.warnings
+}
+
+// warnVisitor serves the interstitial to browsers that have not accepted it
+// for the subdomain yet, and reports whether it handled the request. Following
+// the interstitial's link sets the cookie and redirects to the original URL.
+func (p *Proxy) warnVisitor(w http.ResponseWriter, r *http.Request, subdomain string) bool {
+	warnings := p.getVisitorWarnings()
+	if warnings == nil || !isBrowserNavigation(r) || r.Header.Get(skipWarningHeader) != "" {
+		return false
+	}
+	if _, err := r.Cookie(visitorWarningCookieName); err == nil {
+		return false
+	}
+	warning, ok := warnings.Warning(r.Context(), subdomain)
+	if !ok {
+		return false
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	query := r.URL.Query()
+	if query.Has(visitorWarningParam) {
+		query.Del(visitorWarningParam)
+		target := *r.URL
+		target.RawQuery = query.Encode()
+		http.SetCookie(w, &http.Cookie{
+			Name:     visitorWarningCookieName,
+			Value:    "accepted",
+			Path:     "/",
+			MaxAge:   visitorWarningCookieAge,
+			HttpOnly: true,
+			Secure:   !p.config.UseLocalHost,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, target.RequestURI(), http.StatusSeeOther)
+		return true
+	}
+
+	query.Set(visitorWarningParam, "1")
+	continueURL := *r.URL
+	continueURL.RawQuery = query.Encode()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Portr-Visitor-Warning", "true")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(utils.VisitorWarning(subdomain, warning.Owner, warning.Team, continueURL.RequestURI())))
+	return true
+}
+
+// isBrowserNavigation reports whether r looks like a browser loading a page.
+// API clients, scripts and websocket upgrades are never interrupted.
+func isBrowserNavigation(r *http.Request) bool {
+	if r.Method != http.MethodGet || isUpgradeRequest(r) {
+		return false
+	}
+	if !strings.Contains(strings.ToLower(r.Header.Get("Accept")), "text/html") {
+		return false
+	}
+	return strings.HasPrefix(r.Header.Get("User-Agent"), "Mozilla/")
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	serverConfig "github.com/amalshaji/portr/internal/server/config"
+)
+
+type fakeWarnings map[string]VisitorWarning
+
+func (f fakeWarnings) Warning(_ context.Context, subdomain string) (VisitorWarning, bool) {
+	warning, ok := f[subdomain]
+	return warning, ok
+}
+
+func browserRequest(target string) *http.Request {
+	request := httptest.NewRequest(http.MethodGet, target, nil)
+	request.Header.Set("Accept", "text/html,application/xhtml+xml")
+	request.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64)")
+	return request
+}
+
+func warningProxy(t *testing.T) *Proxy {
+	t.Helper()
+	p := New(&serverConfig.Config{Domain: "example.test"})
+	_ = p.AddBackend("demo", namedBackend(t, "app"))
+	p.SetVisitorWarnings(fakeWarnings{"demo": {Owner: "<dev>@example.com", Team: "Acme"}})
+	return p
+}
+
+func TestProxy_VisitorWarningInterruptsFirstBrowserVisit(t *testing.T) {
+	p := warningProxy(t)
+
+	recorder := httptest.NewRecorder()
+	p.ServeHTTP(recorder, browserRequest("http://demo.example.test/orders?page=2"))
+	body := recorder.Body.String()
+	if recorder.Code != http.StatusOK || recorder.Header().Get("X-Portr-Visitor-Warning") != "true" {
+		t.Fatalf("expected the interstitial, got %d %q", recorder.Code, body)
+	}
+	if !strings.Contains(body, "&lt;dev&gt;@example.com") || !strings.Contains(body, "Acme") {
+		t.Fatalf("expected the escaped owner and team in the page, got %q", body)
+	}
+	if !strings.Contains(body, `href="/orders?page=2&amp;portr_warning_accepted=1"`) {
+		t.Fatalf("expected a continue link to the original URL, got %q", body)
+	}
+
+	recorder = httptest.NewRecorder()
+	p.ServeHTTP(recorder, browserRequest("http://demo.example.test/orders?page=2&portr_warning_accepted=1"))
+	cookies := recorder.Result().Cookies()
+	if recorder.Code != http.StatusSeeOther || recorder.Header().Get("Location") != "/orders?page=2" {
+		t.Fatalf("expected a redirect to the original URL, got %d %q", recorder.Code, recorder.Header().Get("Location"))
+	}
+	if len(cookies) != 1 || cookies[0].Name != visitorWarningCookieName || !cookies[0].HttpOnly {
+		t.Fatalf("expected the acceptance cookie, got %v", cookies)
+	}
+
+	request := browserRequest("http://demo.example.test/orders?page=2")
+	request.AddCookie(cookies[0])
+	recorder = httptest.NewRecorder()
+	p.ServeHTTP(recorder, request)
+	if recorder.Body.String() != "app" {
+		t.Fatalf("expected the cookie to let the visitor through, got %q", recorder.Body.String())
+	}
+}
+
+func TestProxy_VisitorWarningSkipsNonBrowserClients(t *testing.T) {
+	p := warningProxy(t)
+
+	skipHeader := browserRequest("http://demo.example.test/")
+	skipHeader.Header.Set("X-Portr-Skip-Warning", "1")
+	curl := httptest.NewRequest(http.MethodGet, "http://demo.example.test/", nil)
+	curl.Header.Set("User-Agent", "curl/8.5.0")
+	api := browserRequest("http://demo.example.test/")
+	api.Header.Set("Accept", "application/json")
+	post := browserRequest("http://demo.example.test/")
+	post.Method = http.MethodPost
+	other := browserRequest("http://other.example.test/")
+	_ = p.AddBackend("other", namedBackend(t, "app"))
+
+	for name, request := range map[string]*http.Request{
+		"skip header": skipHeader, "curl": curl, "json": api, "post": post, "warning off": other,
+	} {
+		recorder := httptest.NewRecorder()
+		p.ServeHTTP(recorder, request)
+		if recorder.Body.String() != "app" {
+			t.Fatalf("%s: expected the tunnel, got %d %q", name, recorder.Code, recorder.Body.String())
+		}
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
 	"github.com/amalshaji/portr/internal/server/db"
 	"github.com/charmbracelet/log"
 	"gorm.io/gorm"
@@ -34,6 +36,179 @@ func (s *Service) GetReservedConnectionById(ctx context.Context, connectionId st
 	return &connection, nil
 }
 
+// GetTeamUserBySecretKey returns the team user a tunnel secret key or device
+// key belongs to, and the device key's id for a device key. ip is where the
+// key is used from.
+func (s *Service) GetTeamUserBySecretKey(ctx context.Context, secretKey, ip string) (*db.TeamUser, *uint, error) {
+	if secretKey == "" {
+		return nil, nil, fmt.Errorf("secret key is required")
+	}
+	resolved, deviceKey, err := services.NewDeviceKeyService(s.db.Conn).ResolveSecretKey(ctx, secretKey, ip)
+	if err != nil {
+		return nil, nil, err
+	}
+	var teamUser db.TeamUser
+	if err := s.db.Conn.WithContext(ctx).First(&teamUser, resolved.ID).Error; err != nil {
+		return nil, nil, err
+	}
+	if deviceKey == nil {
+		return &teamUser, nil, nil
+	}
+	return &teamUser, &deviceKey.ID, nil
+}
+
+// GetTeamUserByTunnelCredential returns the team user a tunnel credential
+// belongs to, and the credential, which limits the tunnels it may open.
+func (s *Service) GetTeamUserByTunnelCredential(ctx context.Context, secret string) (*db.TeamUser, *models.TunnelCredential, error) {
+	credential, err := services.NewTunnelCredentialService(s.db.Conn).Authenticate(ctx, secret)
+	if err != nil {
+		return nil, nil, err
+	}
+	var teamUser db.TeamUser
+	if err := s.db.Conn.WithContext(ctx).First(&teamUser, credential.TeamUserID).Error; err != nil {
+		return nil, nil, err
+	}
+	return &teamUser, credential, nil
+}
+
+// ConnectionKeyMatches reports whether secretKey may open the reserved
+// connection: the usable device key or tunnel credential it was reserved
+// with, or its owner's secret key if it was reserved with neither.
+func (s *Service) ConnectionKeyMatches(ctx context.Context, connection *db.Connection, secretKey, ip string) bool {
+	var matches bool
+	var err error
+	switch {
+	case connection.DeviceKeyID != nil:
+		var key *models.DeviceKey
+		key, err = services.NewDeviceKeyService(s.db.Conn).Authenticate(ctx, secretKey, ip)
+		matches = err == nil && key.ID == *connection.DeviceKeyID
+	case connection.TunnelCredentialID != nil:
+		var credential *models.TunnelCredential
+		credential, err = services.NewTunnelCredentialService(s.db.Conn).Authenticate(ctx, secretKey)
+		matches = err == nil && credential.ID == *connection.TunnelCredentialID
+	default:
+		return connection.CreatedBy.SecretKey == secretKey
+	}
+	if err != nil && !errors.Is(err, services.ErrInvalidSecretKey) {
+		log.Error("Failed to authenticate connection key", "connection_id", connection.ID, "error", err)
+	}
+	return matches
+}
+
+// GetTeamUserBySshKey returns the team user that registered the public key
+// with the given SHA256 fingerprint, and records that the key was used.
+func (s *Service) GetTeamUserBySshKey(ctx context.Context, fingerprint string) (*db.TeamUser, error) {
+	var key db.SshKey
+	if err := s.db.Conn.WithContext(ctx).Where("fingerprint = ?", fingerprint).First(&key).Error; err != nil {
+		return nil, err
+	}
+	var teamUser db.TeamUser
+	if err := s.db.Conn.WithContext(ctx).First(&teamUser, key.TeamUserID).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Conn.WithContext(ctx).Model(&key).Update("last_used_at", time.Now().UTC()).Error; err != nil {
+		log.Warn("Failed to record SSH key use", "fingerprint", fingerprint, "error", err)
+	}
+	return &teamUser, nil
+}
+
+// CreateConnection reserves a connection for the team user with the same
+// subdomain checks as the admin API, for tunnels opened without the portr
+// client. deviceKeyID and credential are the key the team user signed in
+// with, if not their secret key; a credential also limits the tunnel.
+func (s *Service) CreateConnection(ctx context.Context, teamUser *db.TeamUser, deviceKeyID *uint, credential *models.TunnelCredential, connectionType string, subdomain *string) (*db.Connection, error) {
+	key := services.ConnectionKey{DeviceKeyID: deviceKeyID}
+	var expiresAt *time.Time
+	if credential != nil {
+		var err error
+		expiresAt, err = services.NewTunnelCredentialService(s.db.Conn).Allow(credential, connectionType, subdomain, nil)
+		if err != nil {
+			return nil, err
+		}
+		key.TunnelCredentialID = &credential.ID
+	}
+	// Reservation and policy checks look at the member's role and user.
+	var createdBy models.TeamUser
+	if err := s.db.Conn.WithContext(ctx).Preload("User").First(&createdBy, teamUser.ID).Error; err != nil {
+		return nil, err
+	}
+	connection, err := services.NewConnectionService(s.db.Conn).Create(ctx, &createdBy, connectionType, subdomain, expiresAt, key)
+	if err != nil {
+		return nil, err
+	}
+	return &db.Connection{
+		ID:                 connection.ID,
+		Type:               connection.Type,
+		Subdomain:          connection.Subdomain,
+		Status:             connection.Status,
+		CreatedAt:          connection.CreatedAt,
+		ExpiresAt:          connection.ExpiresAt,
+		CreatedByID:        teamUser.ID,
+		CreatedBy:          *teamUser,
+		DeviceKeyID:        deviceKeyID,
+		TunnelCredentialID: key.TunnelCredentialID,
+	}, nil
+}
+
+// ResolveErrorPage returns the error page a subdomain's team configured for
+// the reason, or nil when visitors get portr's built-in page.
+func (s *Service) ResolveErrorPage(ctx context.Context, reason, subdomain string) (*services.ResolvedErrorPage, error) {
+	return services.NewErrorPageService(s.db.Conn).Resolve(ctx, reason, subdomain)
+}
+
+// ResolveMirror returns the rule mirroring a subdomain's requests, or nil.
+func (s *Service) ResolveMirror(ctx context.Context, subdomain string) (*services.ResolvedMirror, error) {
+	return services.NewMirrorService(s.db.Conn).Resolve(ctx, subdomain)
+}
+
+// RecordMirrorDeliveries adds to a mirror rule's delivery counts.
+func (s *Service) RecordMirrorDeliveries(ctx context.Context, ruleID uint, mirrored, failed int64) error {
+	return services.NewMirrorService(s.db.Conn).RecordDeliveries(ctx, ruleID, mirrored, failed)
+}
+
+// ResolveSplits returns every split route, keyed by the subdomain it splits.
+func (s *Service) ResolveSplits(ctx context.Context) (map[string]services.ResolvedSplit, error) {
+	return services.NewSplitService(s.db.Conn).Resolve(ctx)
+}
+
+// ResolveVisitorWarning returns the interstitial for a subdomain's visitors,
+// or nil when its team has not turned it on.
+func (s *Service) ResolveVisitorWarning(ctx context.Context, subdomain string) (*services.ResolvedVisitorWarning, error) {
+	return services.NewVisitorWarningService(s.db.Conn).Resolve(ctx, subdomain)
+}
+
+// RecordAuditLog adds an entry to the audit log.
+func (s *Service) RecordAuditLog(ctx context.Context, entry models.AuditLog) error {
+	return services.NewAuditLogService(s.db.Conn).Record(ctx, entry)
+}
+
+// SaveAccessLogs stores access log entries of tunnel connections.
+func (s *Service) SaveAccessLogs(ctx context.Context, entries []models.AccessLog) error {
+	return services.NewAccessLogService(s.db.Conn).Save(ctx, entries)
+}
+
+// PruneAccessLogs deletes the access log entries older than before.
+func (s *Service) PruneAccessLogs(ctx context.Context, before time.Time) (int64, error) {
+	return services.NewAccessLogService(s.db.Conn).Prune(ctx, before)
+}
+
+// CachePurgesAfter returns the cache purges requested after the one with
+// afterID, oldest first.
+func (s *Service) CachePurgesAfter(ctx context.Context, afterID uint64) ([]models.CachePurge, error) {
+	return services.NewCacheService(s.db.Conn).PurgesAfter(ctx, afterID)
+}
+
+// BandwidthSnapshot returns the limited teams and team users with their
+// traffic in the month of now.
+func (s *Service) BandwidthSnapshot(ctx context.Context, now time.Time) (*services.BandwidthSnapshot, error) {
+	return services.NewBandwidthService(s.db.Conn).Snapshot(ctx, now)
+}
+
+// RecordBandwidthUsage adds tunnel traffic to a team user's monthly count.
+func (s *Service) RecordBandwidthUsage(ctx context.Context, usage models.BandwidthUsage) error {
+	return services.NewBandwidthService(s.db.Conn).RecordUsage(ctx, usage)
+}
+
 func (s *Service) MarkConnectionAsActive(ctx context.Context, connectionId string) error {
 	return s.activateConnection(ctx, connectionId, nil)
 }
@@ -43,7 +218,7 @@ func (s *Service) MarkTCPConnectionAsActive(ctx context.Context, connectionId st
 }
 
 func (s *Service) activateConnection(ctx context.Context, connectionId string, port *uint32) error {
-	updates := map[string]any{"status": "active", "started_at": time.Now().UTC(), "closed_at": nil}
+	updates := map[string]any{"status": "active", "started_at": time.Now().UTC(), "closed_at": nil, "close_reason": nil}
 	if port != nil {
 		updates["port"] = *port
 	}
@@ -52,16 +227,58 @@ func (s *Service) activateConnection(ctx context.Context, connectionId string, p
 		Updates(updates).Error
 }
 
-func (s *Service) MarkConnectionAsClosed(ctx context.Context, connectionId string) error {
+// MarkConnectionAsClosed records that a connection closed and why, as one
+// of the models.ConnectionCloseReason values.
+func (s *Service) MarkConnectionAsClosed(ctx context.Context, connectionId string, reason string) error {
 	return s.db.Conn.WithContext(ctx).Model(&db.Connection{}).
 		Where("id = ?", connectionId).
-		Updates(map[string]any{"status": "closed", "closed_at": time.Now().UTC()}).Error
+		Updates(map[string]any{"status": "closed", "closed_at": time.Now().UTC(), "close_reason": reason}).Error
 }
 
 func (s *Service) CloseAllActiveConnections(ctx context.Context) error {
 	return s.db.Conn.WithContext(ctx).Model(&db.Connection{}).
 		Where("status = ?", "active").
-		Updates(map[string]any{"status": "closed", "closed_at": time.Now().UTC()}).Error
+		Updates(map[string]any{
+			"status":       "closed",
+			"closed_at":    time.Now().UTC(),
+			"close_reason": models.ConnectionCloseReasonServerRestart,
+		}).Error
+}
+
+// TeamTunnelLifetime returns how long the tunnels of a team may stay open,
+// or zero when they may stay open indefinitely.
+func (s *Service) TeamTunnelLifetime(ctx context.Context, teamID uint) (time.Duration, error) {
+	return services.NewTunnelPolicyService(s.db.Conn).MaxLifetime(ctx, teamID)
+}
+
+// RevokedConnections returns the close reason of each given connection the
+// admin API closed for good. A connection whose row is gone was deleted with
+// its owner's membership.
+func (s *Service) RevokedConnections(ctx context.Context, connectionIDs []string) (map[string]string, error) {
+	var rows []db.Connection
+	err := s.db.Conn.WithContext(ctx).Select("id", "close_reason").
+		Where("id IN ?", connectionIDs).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	revoked := make(map[string]string)
+	found := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		found[row.ID] = true
+		if row.CloseReason == nil {
+			continue
+		}
+		switch *row.CloseReason {
+		case models.ConnectionCloseReasonForceClosed, models.ConnectionCloseReasonMemberRemoved, models.ConnectionCloseReasonKeyRevoked:
+			revoked[row.ID] = *row.CloseReason
+		}
+	}
+	for _, id := range connectionIDs {
+		if !found[id] {
+			revoked[id] = models.ConnectionCloseReasonMemberRemoved
+		}
+	}
+	return revoked, nil
 }
 
 func (s *Service) GetAllActiveConnections(ctx context.Context) ([]db.Connection, error) {
@@ -0,0 +1,61 @@
+// Package split supplies the proxy with the split routes teams configure in
+// the admin API.
+package split
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"github.com/amalshaji/portr/internal/server/proxy"
+	"github.com/amalshaji/portr/internal/server/ttlcache"
+	"github.com/charmbracelet/log"
+)
+
+// routesTTL is how long the route table is reused. It is loaded whole, so a
+// subdomain without a route never costs a query of its own.
+const routesTTL = 10 * time.Second
+
+const routesKey = "routes"
+
+type Store interface {
+	ResolveSplits(ctx context.Context) (map[string]services.ResolvedSplit, error)
+}
+
+type Splits struct {
+	store Store
+	cache *ttlcache.Cache[map[string]services.ResolvedSplit]
+}
+
+func New(store Store) *Splits {
+	return &Splits{
+		store: store,
+		cache: ttlcache.New[map[string]services.ResolvedSplit](routesTTL, 1),
+	}
+}
+
+var _ proxy.Splits = (*Splits)(nil)
+
+// Split returns the route splitting the subdomain. Lookup failures serve the
+// subdomain's own tunnels rather than failing the request.
+func (s *Splits) Split(ctx context.Context, subdomain string) (proxy.SplitRoute, bool) {
+	routes, err := s.cache.Get(routesKey, func() (map[string]services.ResolvedSplit, error) {
+		return s.store.ResolveSplits(ctx)
+	})
+	if err != nil {
+		log.Warn("Failed to load split routes", "error", err)
+		return proxy.SplitRoute{}, false
+	}
+	route, ok := routes[strings.ToLower(subdomain)]
+	if !ok {
+		return proxy.SplitRoute{}, false
+	}
+	return proxy.SplitRoute{
+		ID:            route.ID,
+		Primary:       route.Primary,
+		Secondary:     route.Secondary,
+		PrimaryWeight: route.PrimaryWeight,
+		Sticky:        route.Sticky,
+	}, true
+}
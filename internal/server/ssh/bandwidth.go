@@ -0,0 +1,96 @@
+package sshd
+
+import (
+	"github.com/amalshaji/portr/internal/server/bandwidth"
+	"github.com/amalshaji/portr/internal/server/proxy"
+	"github.com/charmbracelet/log"
+	"github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// noticeRequestType is the global request that shows a message to the user
+// of a portr client, such as a bandwidth quota warning.
+const noticeRequestType = "portr-notice@portr"
+
+type noticeRequest struct {
+	Message string
+}
+
+// SetBandwidth meters the traffic of every forward opened after it is
+// called, and sends the meter's warnings to the sessions they concern.
+func (s *SshServer) SetBandwidth(meter *bandwidth.Meter) {
+	s.bandwidth = meter
+	meter.SetNotifier(s)
+}
+
+var _ proxy.BandwidthQuotas = (*SshServer)(nil)
+
+// bandwidthAccount returns the account of the team user a session
+// authenticated as, or nil when traffic is not metered.
+func (s *SshServer) bandwidthAccount(ctx ssh.Context) *bandwidth.Account {
+	if s.bandwidth == nil {
+		return nil
+	}
+	if session := stockSessionFromContext(ctx); session != nil {
+		return s.bandwidth.Account(uint(session.teamUser.TeamID), session.teamUser.ID)
+	}
+	reservedConnection, err := s.GetReservedConnectionFromSshContext(ctx)
+	if err != nil {
+		return nil
+	}
+	return s.bandwidth.Account(uint(reservedConnection.CreatedBy.TeamID), reservedConnection.CreatedBy.ID)
+}
+
+// BandwidthExceeded reports whether the connection serving a proxy backend
+// belongs to a team or team user over its monthly quota.
+func (s *SshServer) BandwidthExceeded(backend string) bool {
+	if s.bandwidth == nil {
+		return false
+	}
+	connectionID, ok := s.ConnectionForBackend(backend)
+	if !ok {
+		return false
+	}
+	s.leaseMu.Lock()
+	leases := s.forwards[connectionID]
+	s.leaseMu.Unlock()
+	if leases == nil {
+		return false
+	}
+	leases.mu.Lock()
+	teamID, teamUserID := leases.teamID, leases.teamUserID
+	leases.mu.Unlock()
+	return s.bandwidth.Account(teamID, teamUserID).Exceeded()
+}
+
+// Notify shows a message on the tunnels of a team user, or of the whole team
+// when teamUserID is zero.
+func (s *SshServer) Notify(teamID, teamUserID uint, message string) {
+	payload := gossh.Marshal(&noticeRequest{Message: message})
+
+	s.leaseMu.Lock()
+	var conns []gossh.Conn
+	stockSessions := map[*stockSession]bool{}
+	for _, leases := range s.forwards {
+		leases.mu.Lock()
+		if len(leases.forwards) != 0 && leases.teamID == teamID && (teamUserID == 0 || leases.teamUserID == teamUserID) {
+			switch {
+			case leases.stock != nil:
+				stockSessions[leases.stock] = true
+			case leases.conn != nil:
+				conns = append(conns, leases.conn)
+			}
+		}
+		leases.mu.Unlock()
+	}
+	s.leaseMu.Unlock()
+
+	for session := range stockSessions {
+		session.announce("%s", message)
+	}
+	for _, conn := range conns {
+		if _, _, err := conn.SendRequest(noticeRequestType, false, payload); err != nil {
+			log.Debug("Failed to send notice", "remote_addr", conn.RemoteAddr(), "error", err)
+		}
+	}
+}
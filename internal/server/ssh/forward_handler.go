@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"sync"
 
+	"github.com/amalshaji/portr/internal/server/bandwidth"
 	"github.com/charmbracelet/log"
 	sshserver "github.com/gliderlabs/ssh"
 	gossh "golang.org/x/crypto/ssh"
@@ -42,8 +43,17 @@ type boundForward struct {
 type forwardedTCPHandler struct {
 	mu       sync.Mutex
 	forwards map[string]*boundForward
+	// bind opens the listener for a forward request and returns the host the
+	// forward is registered under. When nil, the requested address is bound.
+	bind     func(sshserver.Context, remoteForwardRequest) (net.Listener, string, error)
 	onBound  func(sshserver.Context, string, uint32) error
 	onClosed func(sshserver.Context, string, uint32)
+	// account returns the bandwidth account a session's traffic counts
+	// against. When nil, or when it returns nil, traffic is not metered.
+	account func(sshserver.Context) *bandwidth.Account
+	// activity returns what records the traffic of the forward bound on host
+	// and port, for the idle timeout. When nil, traffic is not recorded.
+	activity func(ctx sshserver.Context, host string, port uint32) *activity
 }
 
 func (h *forwardedTCPHandler) HandleSSHRequest(ctx sshserver.Context, _ *sshserver.Server, req *gossh.Request) (bool, []byte) {
@@ -66,8 +76,11 @@ func (h *forwardedTCPHandler) open(ctx sshserver.Context, req *gossh.Request) (b
 		return false, []byte("port forwarding is disabled")
 	}
 
-	requestedAddr := net.JoinHostPort(payload.BindAddr, strconv.Itoa(int(payload.BindPort)))
-	listener, err := net.Listen("tcp", requestedAddr)
+	bind := h.bind
+	if bind == nil {
+		bind = bindRequestedAddr
+	}
+	listener, boundHost, err := bind(ctx, payload)
 	if err != nil {
 		return false, nil
 	}
@@ -83,9 +96,15 @@ func (h *forwardedTCPHandler) open(ctx sshserver.Context, req *gossh.Request) (b
 		return false, nil
 	}
 	boundPort := uint32(port)
-	boundAddr := net.JoinHostPort(payload.BindAddr, portString)
+	// Channels and cancel requests refer to the forward as the client asked
+	// for it, which differs from the bound port when bind picks another one.
+	forwardPort := payload.BindPort
+	if forwardPort == 0 {
+		forwardPort = boundPort
+	}
+	boundAddr := net.JoinHostPort(payload.BindAddr, strconv.Itoa(int(forwardPort)))
 
-	if err := h.onBound(ctx, payload.BindAddr, boundPort); err != nil {
+	if err := h.onBound(ctx, boundHost, boundPort); err != nil {
 		_ = listener.Close()
 		log.Error("Failed to register bound SSH forward", "address", boundAddr, "error", err)
 		return false, nil
@@ -109,7 +128,7 @@ func (h *forwardedTCPHandler) open(ctx sshserver.Context, req *gossh.Request) (b
 			}
 			h.mu.Unlock()
 			if current == forward && h.onClosed != nil {
-				h.onClosed(ctx, payload.BindAddr, boundPort)
+				h.onClosed(ctx, boundHost, boundPort)
 			}
 		})
 	}
@@ -119,9 +138,21 @@ func (h *forwardedTCPHandler) open(ctx sshserver.Context, req *gossh.Request) (b
 		<-ctx.Done()
 		closeForward()
 	}()
-	go h.accept(ctx, listener, payload.BindAddr, boundPort, closeForward)
+	var forwardActivity *activity
+	if h.activity != nil {
+		forwardActivity = h.activity(ctx, boundHost, boundPort)
+	}
+	go h.accept(ctx, listener, payload.BindAddr, forwardPort, closeForward, forwardActivity)
 
-	return true, gossh.Marshal(&remoteForwardSuccess{BindPort: boundPort})
+	return true, gossh.Marshal(&remoteForwardSuccess{BindPort: forwardPort})
+}
+
+func bindRequestedAddr(_ sshserver.Context, payload remoteForwardRequest) (net.Listener, string, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(payload.BindAddr, strconv.Itoa(int(payload.BindPort))))
+	if err != nil {
+		return nil, "", err
+	}
+	return listener, payload.BindAddr, nil
 }
 
 func (h *forwardedTCPHandler) cancel(req *gossh.Request) (bool, []byte) {
@@ -147,12 +178,17 @@ func (h *forwardedTCPHandler) accept(
 	destAddr string,
 	destPort uint32,
 	closeForward func(),
+	activity *activity,
 ) {
 	defer closeForward()
 	connection, ok := ctx.Value(sshserver.ContextKeyConn).(*gossh.ServerConn)
 	if !ok || connection == nil {
 		return
 	}
+	var account *bandwidth.Account
+	if h.account != nil {
+		account = h.account(ctx)
+	}
 
 	for {
 		localConn, err := listener.Accept()
@@ -177,11 +213,20 @@ func (h *forwardedTCPHandler) accept(
 			OriginAddr: originHost,
 			OriginPort: uint32(originPort),
 		})
-		go proxyForwardedConnection(connection, localConn, payload)
+		go proxyForwardedConnection(connection, localConn, payload, account, activity)
 	}
 }
 
-func proxyForwardedConnection(connection *gossh.ServerConn, localConn net.Conn, payload []byte) {
+// proxyForwardedConnection copies a connection accepted on a forward's
+// listener through a new channel to the client. Traffic in both directions
+// counts against account, which closes both ends once its quota is used, and
+// is recorded in activity.
+func proxyForwardedConnection(connection *gossh.ServerConn, localConn net.Conn, payload []byte, account *bandwidth.Account, activity *activity) {
+	if account.Exceeded() {
+		_ = localConn.Close()
+		return
+	}
+	activity.touch()
 	channel, requests, err := connection.OpenChannel(forwardedTCPChannelType, payload)
 	if err != nil {
 		_ = localConn.Close()
@@ -191,12 +236,12 @@ func proxyForwardedConnection(connection *gossh.ServerConn, localConn net.Conn,
 
 	results := make(chan error, 2)
 	go func() {
-		_, copyErr := io.Copy(channel, localConn)
+		_, copyErr := io.Copy(channel, activity.Reader(account.Reader(localConn)))
 		_ = channel.CloseWrite()
 		results <- copyErr
 	}()
 	go func() {
-		_, copyErr := io.Copy(localConn, channel)
+		_, copyErr := io.Copy(localConn, activity.Reader(account.Reader(channel)))
 		if tcp, ok := localConn.(*net.TCPConn); ok {
 			_ = tcp.CloseWrite()
 		}
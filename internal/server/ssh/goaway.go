@@ -0,0 +1,16 @@
+package sshd
+
+// goAwayRequestType is the global request sent to clients before their
+// session is closed, asking them to reconnect.
+const goAwayRequestType = "portr-goaway@portr"
+
+// shutdownRetryAfter is the delay, in seconds, suggested to clients when the
+// server shuts down, long enough for a typical restart.
+const shutdownRetryAfter = 5
+
+type goAwayRequest struct {
+	Reason string
+	// RetryAfter is the number of seconds the client should wait before
+	// reconnecting.
+	RetryAfter uint32
+}
@@ -2,11 +2,14 @@ package sshd
 
 import (
 	"testing"
+	"time"
 
 	serverconfig "github.com/amalshaji/portr/internal/server/config"
 	serverdb "github.com/amalshaji/portr/internal/server/db"
 	"github.com/amalshaji/portr/internal/server/proxy"
 	"github.com/amalshaji/portr/internal/server/service"
+	sshserver "github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -20,7 +23,13 @@ func newLeaseTestServer(t *testing.T) (*SshServer, *gorm.DB, *fakeSSHContext) {
 	if err := database.AutoMigrate(&serverdb.TeamUser{}, &serverdb.Connection{}); err != nil {
 		t.Fatalf("migrate database: %v", err)
 	}
-	teamUser := serverdb.TeamUser{SecretKey: "secret"}
+	if err := database.Exec("CREATE TABLE team (id INTEGER PRIMARY KEY, max_tunnel_lifetime_seconds BIGINT NOT NULL DEFAULT 0)").Error; err != nil {
+		t.Fatalf("create team table: %v", err)
+	}
+	if err := database.Exec("INSERT INTO team (id) VALUES (1)").Error; err != nil {
+		t.Fatalf("create team: %v", err)
+	}
+	teamUser := serverdb.TeamUser{SecretKey: "secret", TeamID: 1}
 	if err := database.Create(&teamUser).Error; err != nil {
 		t.Fatalf("create team user: %v", err)
 	}
@@ -74,6 +83,21 @@ func TestPooledConnectionClosesOnlyAfterLastForward(t *testing.T) {
 	}
 }
 
+func TestConnectionForBackendFollowsForwards(t *testing.T) {
+	server, _, ctx := newLeaseTestServer(t)
+	if err := server.activateForward(ctx, "127.0.0.1", 20001); err != nil {
+		t.Fatalf("activate forward: %v", err)
+	}
+	if connectionID, ok := server.ConnectionForBackend("127.0.0.1:20001"); !ok || connectionID != "connection" {
+		t.Fatalf("expected the backend to map to its connection, got %q %v", connectionID, ok)
+	}
+
+	server.closeForward(ctx, "127.0.0.1", 20001)
+	if connectionID, ok := server.ConnectionForBackend("127.0.0.1:20001"); ok {
+		t.Fatalf("expected the closed forward to be forgotten, got %q", connectionID)
+	}
+}
+
 func TestReactivatedConnectionClearsClosedTimestamp(t *testing.T) {
 	server, database, ctx := newLeaseTestServer(t)
 	if err := server.activateForward(ctx, "127.0.0.1", 20001); err != nil {
@@ -92,3 +116,43 @@ func TestReactivatedConnectionClearsClosedTimestamp(t *testing.T) {
 		t.Fatalf("expected clean active state, status=%q closed_at=%v", connection.Status, connection.ClosedAt)
 	}
 }
+
+type recordingConn struct {
+	gossh.Conn
+	requests chan string
+}
+
+func (c *recordingConn) SendRequest(name string, _ bool, payload []byte) (bool, []byte, error) {
+	var request goAwayRequest
+	if err := gossh.Unmarshal(payload, &request); err != nil {
+		return false, nil, err
+	}
+	c.requests <- name + ":" + request.Reason
+	return true, nil, nil
+}
+
+func TestSendGoAwayNotifiesSessionsWithActiveForwards(t *testing.T) {
+	server, _, ctx := newLeaseTestServer(t)
+	conn := &recordingConn{requests: make(chan string, 1)}
+	ctx.values[sshserver.ContextKeyConn] = conn
+	if err := server.activateForward(ctx, "127.0.0.1", 20001); err != nil {
+		t.Fatalf("activate forward: %v", err)
+	}
+
+	if notified := server.sendGoAway(goAwayRequest{Reason: "server restart"}); notified != 1 {
+		t.Fatalf("expected one session notified, got %d", notified)
+	}
+	select {
+	case request := <-conn.requests:
+		if request != goAwayRequestType+":server restart" {
+			t.Fatalf("unexpected request %q", request)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for goaway")
+	}
+
+	server.closeForward(ctx, "127.0.0.1", 20001)
+	if notified := server.sendGoAway(goAwayRequest{Reason: "server restart"}); notified != 0 {
+		t.Fatalf("expected closed session to be skipped, got %d", notified)
+	}
+}
@@ -0,0 +1,257 @@
+package sshd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/db"
+	"github.com/charmbracelet/log"
+	"github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Tunnel policies close connections that should not stay public: those that
+// carried no traffic for the server's idle timeout, those older than their
+// team's maximum lifetime, and those past the expiry their owner asked for.
+// EnforcePolicies runs on a cron, so a tunnel closes up to one interval late.
+
+// closedRequestType is the global request sent to portr clients before the
+// server closes a tunnel under a policy, asking them not to reconnect.
+const closedRequestType = "portr-closed@portr"
+
+type closedRequest struct {
+	Reason  string
+	Message string
+}
+
+const (
+	// closeNoticeTimeout bounds how long a client has to acknowledge that its
+	// tunnel is closing before the session is closed anyway.
+	closeNoticeTimeout = 5 * time.Second
+	// stockCloseDelay gives stock sessions time to print why they are closed.
+	stockCloseDelay = time.Second
+)
+
+// activity records when a connection last carried traffic.
+type activity struct {
+	last atomic.Int64
+}
+
+// touch records traffic now. A nil activity records nothing.
+func (a *activity) touch() {
+	if a != nil {
+		a.last.Store(time.Now().UnixNano())
+	}
+}
+
+func (a *activity) lastActive() time.Time {
+	return time.Unix(0, a.last.Load())
+}
+
+// Reader records traffic whenever something is read from r.
+func (a *activity) Reader(r io.Reader) io.Reader {
+	if a == nil {
+		return r
+	}
+	return &activityReader{activity: a, reader: r}
+}
+
+type activityReader struct {
+	activity *activity
+	reader   io.Reader
+}
+
+func (r *activityReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.activity.touch()
+	}
+	return n, err
+}
+
+// connectionDeadline is when a connection must close regardless of traffic,
+// and why. A zero at means never.
+type connectionDeadline struct {
+	at      time.Time
+	reason  string
+	message string
+}
+
+// deadlineFor returns the earlier of the connection's expiry and the end of
+// its team's maximum lifetime, counted from when the connection was
+// reserved so reconnects of the same connection do not extend it.
+func (s *SshServer) deadlineFor(ctx context.Context, connection *db.Connection) connectionDeadline {
+	var deadline connectionDeadline
+	lifetime, err := s.service.TeamTunnelLifetime(ctx, uint(connection.CreatedBy.TeamID))
+	if err != nil {
+		log.Warn("Failed to load the team's tunnel lifetime", "connection_id", connection.ID, "error", err)
+	} else if lifetime > 0 {
+		deadline = connectionDeadline{
+			at:      connection.CreatedAt.Add(lifetime),
+			reason:  models.ConnectionCloseReasonMaxLifetime,
+			message: fmt.Sprintf("Tunnel closed after reaching your team's maximum tunnel lifetime of %s", formatPolicyDuration(lifetime)),
+		}
+	}
+	if connection.ExpiresAt != nil && (deadline.at.IsZero() || connection.ExpiresAt.Before(deadline.at)) {
+		deadline = connectionDeadline{
+			at:      *connection.ExpiresAt,
+			reason:  models.ConnectionCloseReasonExpired,
+			message: "Tunnel closed because it reached the expiry it was opened with",
+		}
+	}
+	return deadline
+}
+
+// permanentlyClosed returns why a connection must not be opened again, or ""
+// when it may be.
+func permanentlyClosed(connection *db.Connection, now time.Time) string {
+	if connection.CloseReason != nil && models.ClosedPermanently(*connection.CloseReason) {
+		return *connection.CloseReason
+	}
+	if connection.ExpiresAt != nil && !now.Before(*connection.ExpiresAt) {
+		return models.ConnectionCloseReasonExpired
+	}
+	return ""
+}
+
+// forwardActivity returns the activity of the connection a forward was
+// registered under.
+func (s *SshServer) forwardActivity(ctx ssh.Context, host string, port uint32) *activity {
+	var connectionID string
+	if session := stockSessionFromContext(ctx); session != nil {
+		id, ok := session.connectionID(forwardKey(host, port))
+		if !ok {
+			return nil
+		}
+		connectionID = id
+	} else {
+		id, _, err := connectionCredentials(ctx)
+		if err != nil {
+			return nil
+		}
+		connectionID = id
+	}
+	s.leaseMu.Lock()
+	defer s.leaseMu.Unlock()
+	if leases := s.forwards[connectionID]; leases != nil {
+		return leases.activity
+	}
+	return nil
+}
+
+// EnforcePolicies closes the connections that were idle for the idle
+// timeout or reached their deadline.
+func (s *SshServer) EnforcePolicies(ctx context.Context) {
+	now := time.Now()
+	s.leaseMu.Lock()
+	connections := make(map[string]*connectionLeases, len(s.forwards))
+	for connectionID, leases := range s.forwards {
+		connections[connectionID] = leases
+	}
+	s.leaseMu.Unlock()
+
+	for connectionID, leases := range connections {
+		if ctx.Err() != nil {
+			return
+		}
+		leases.mu.Lock()
+		reason, message := leases.violation(now, s.config.IdleTimeout)
+		leases.mu.Unlock()
+		if reason != "" {
+			s.closeConnection(connectionID, reason, message)
+		}
+	}
+}
+
+// violation returns the policy an open connection breaks, with the message
+// for its owner, or "" when it breaks none.
+func (l *connectionLeases) violation(now time.Time, idleTimeout time.Duration) (string, string) {
+	if len(l.forwards) == 0 || l.closeReason != "" {
+		return "", ""
+	}
+	if !l.deadline.at.IsZero() && !now.Before(l.deadline.at) {
+		return l.deadline.reason, l.deadline.message
+	}
+	if idleTimeout > 0 && now.Sub(l.activity.lastActive()) >= idleTimeout {
+		return models.ConnectionCloseReasonIdle, fmt.Sprintf("Tunnel closed after %s without traffic", formatPolicyDuration(idleTimeout))
+	}
+	return "", ""
+}
+
+// closeConnection tells the sessions serving a connection why it is closing
+// and closes them. Their forwards then close as on a disconnect, and the
+// reason is recorded on the connection's row.
+func (s *SshServer) closeConnection(connectionID, reason, message string) {
+	s.leaseMu.Lock()
+	leases := s.forwards[connectionID]
+	s.leaseMu.Unlock()
+	if leases == nil {
+		return
+	}
+	leases.mu.Lock()
+	if leases.pruned || len(leases.forwards) == 0 || leases.closeReason != "" {
+		leases.mu.Unlock()
+		return
+	}
+	leases.closeReason = reason
+	stock := leases.stock
+	conns := map[gossh.Conn]bool{}
+	for _, lease := range leases.forwards {
+		if lease.conn != nil {
+			conns[lease.conn] = true
+		}
+	}
+	leases.mu.Unlock()
+
+	log.Info("Closing tunnel", "connection_id", connectionID, "reason", reason)
+	if stock != nil {
+		stock.announce("%s", message)
+	}
+	payload := gossh.Marshal(&closedRequest{Reason: reason, Message: message})
+	for conn := range conns {
+		go func(conn gossh.Conn) {
+			if stock != nil {
+				time.Sleep(stockCloseDelay)
+			} else {
+				sendClosedRequest(conn, payload)
+			}
+			_ = conn.Close()
+		}(conn)
+	}
+}
+
+// sendClosedRequest waits for the client to acknowledge the closed request,
+// so it knows not to reconnect before the session closes.
+func sendClosedRequest(conn gossh.Conn, payload []byte) {
+	acknowledged := make(chan struct{})
+	go func() {
+		defer close(acknowledged)
+		if _, _, err := conn.SendRequest(closedRequestType, true, payload); err != nil {
+			log.Debug("Failed to send tunnel closed notice", "remote_addr", conn.RemoteAddr(), "error", err)
+		}
+	}()
+	timer := time.NewTimer(closeNoticeTimeout)
+	defer timer.Stop()
+	select {
+	case <-acknowledged:
+	case <-timer.C:
+	}
+}
+
+// formatPolicyDuration formats a policy duration without trailing zero
+// units, as "30m" or "1h30m".
+func formatPolicyDuration(d time.Duration) string {
+	formatted := d.Round(time.Second).String()
+	if strings.HasSuffix(formatted, "m0s") {
+		formatted = strings.TrimSuffix(formatted, "0s")
+	}
+	if strings.HasSuffix(formatted, "h0m") {
+		formatted = strings.TrimSuffix(formatted, "0m")
+	}
+	return formatted
+}
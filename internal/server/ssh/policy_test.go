@@ -0,0 +1,184 @@
+package sshd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	serverdb "github.com/amalshaji/portr/internal/server/db"
+	sshserver "github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+type closingConn struct {
+	gossh.Conn
+	requests chan closedRequest
+	closed   chan struct{}
+}
+
+func newClosingConn() *closingConn {
+	return &closingConn{requests: make(chan closedRequest, 1), closed: make(chan struct{})}
+}
+
+func (c *closingConn) SendRequest(name string, _ bool, payload []byte) (bool, []byte, error) {
+	var request closedRequest
+	if name == closedRequestType {
+		if err := gossh.Unmarshal(payload, &request); err != nil {
+			return false, nil, err
+		}
+		c.requests <- request
+	}
+	return true, nil, nil
+}
+
+func (c *closingConn) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func waitForClose(t *testing.T, conn *closingConn) closedRequest {
+	t.Helper()
+	var request closedRequest
+	select {
+	case request = <-conn.requests:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the closed notice")
+	}
+	select {
+	case <-conn.closed:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the session to close")
+	}
+	return request
+}
+
+func TestEnforcePoliciesClosesIdleConnections(t *testing.T) {
+	server, database, ctx := newLeaseTestServer(t)
+	server.config.IdleTimeout = 30 * time.Minute
+	conn := newClosingConn()
+	ctx.values[sshserver.ContextKeyConn] = conn
+	if err := server.activateForward(ctx, "127.0.0.1", 20001); err != nil {
+		t.Fatalf("activate forward: %v", err)
+	}
+
+	server.EnforcePolicies(context.Background())
+	select {
+	case <-conn.requests:
+		t.Fatal("expected a fresh connection to stay open")
+	default:
+	}
+
+	server.forwards["connection"].activity.last.Store(time.Now().Add(-31 * time.Minute).UnixNano())
+	server.EnforcePolicies(context.Background())
+	request := waitForClose(t, conn)
+	if request.Reason != models.ConnectionCloseReasonIdle || request.Message != "Tunnel closed after 30m without traffic" {
+		t.Fatalf("unexpected closed notice %+v", request)
+	}
+
+	server.closeForward(ctx, "127.0.0.1", 20001)
+	var connection serverdb.Connection
+	if err := database.First(&connection, "id = ?", "connection").Error; err != nil {
+		t.Fatalf("load connection: %v", err)
+	}
+	if connection.Status != "closed" || connection.CloseReason == nil || *connection.CloseReason != models.ConnectionCloseReasonIdle {
+		t.Fatalf("expected the idle close to be recorded, status=%q close_reason=%v", connection.Status, connection.CloseReason)
+	}
+}
+
+func TestEnforcePoliciesClosesExpiredConnections(t *testing.T) {
+	server, database, ctx := newLeaseTestServer(t)
+	expiresAt := time.Now().Add(50 * time.Millisecond)
+	if err := database.Model(&serverdb.Connection{}).Where("id = ?", "connection").Update("expires_at", expiresAt).Error; err != nil {
+		t.Fatalf("expire connection: %v", err)
+	}
+	conn := newClosingConn()
+	ctx.values[sshserver.ContextKeyConn] = conn
+	if err := server.activateForward(ctx, "127.0.0.1", 20001); err != nil {
+		t.Fatalf("activate forward: %v", err)
+	}
+
+	server.EnforcePolicies(context.Background())
+	select {
+	case <-conn.requests:
+		t.Fatal("expected the connection to stay open until it expires")
+	default:
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	server.EnforcePolicies(context.Background())
+	if request := waitForClose(t, conn); request.Reason != models.ConnectionCloseReasonExpired {
+		t.Fatalf("unexpected closed notice %+v", request)
+	}
+
+	server.closeForward(ctx, "127.0.0.1", 20001)
+	var connection serverdb.Connection
+	if err := database.First(&connection, "id = ?", "connection").Error; err != nil {
+		t.Fatalf("load connection: %v", err)
+	}
+	if reason := permanentlyClosed(&connection, time.Now()); reason != models.ConnectionCloseReasonExpired {
+		t.Fatalf("expected the expired connection to stay closed, got %q", reason)
+	}
+}
+
+func TestEnforcePoliciesCapsTunnelLifetime(t *testing.T) {
+	server, database, ctx := newLeaseTestServer(t)
+	if err := database.Exec("UPDATE team SET max_tunnel_lifetime_seconds = 3600").Error; err != nil {
+		t.Fatalf("set team lifetime: %v", err)
+	}
+	if err := database.Model(&serverdb.Connection{}).Where("id = ?", "connection").Update("created_at", time.Now().Add(-2*time.Hour)).Error; err != nil {
+		t.Fatalf("age connection: %v", err)
+	}
+	conn := newClosingConn()
+	ctx.values[sshserver.ContextKeyConn] = conn
+	if err := server.activateForward(ctx, "127.0.0.1", 20001); err != nil {
+		t.Fatalf("activate forward: %v", err)
+	}
+
+	server.EnforcePolicies(context.Background())
+	request := waitForClose(t, conn)
+	if request.Reason != models.ConnectionCloseReasonMaxLifetime || request.Message != "Tunnel closed after reaching your team's maximum tunnel lifetime of 1h" {
+		t.Fatalf("unexpected closed notice %+v", request)
+	}
+}
+
+func TestPermanentlyClosed(t *testing.T) {
+	now := time.Now()
+	disconnected := models.ConnectionCloseReasonDisconnected
+	idle := models.ConnectionCloseReasonIdle
+	future := now.Add(time.Hour)
+	past := now.Add(-time.Hour)
+
+	tests := []struct {
+		name       string
+		connection serverdb.Connection
+		want       string
+	}{
+		{name: "open", connection: serverdb.Connection{}, want: ""},
+		{name: "disconnected", connection: serverdb.Connection{CloseReason: &disconnected}, want: ""},
+		{name: "idle", connection: serverdb.Connection{CloseReason: &idle}, want: models.ConnectionCloseReasonIdle},
+		{name: "not yet expired", connection: serverdb.Connection{ExpiresAt: &future}, want: ""},
+		{name: "expired", connection: serverdb.Connection{ExpiresAt: &past}, want: models.ConnectionCloseReasonExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := permanentlyClosed(&tt.connection, now); got != tt.want {
+				t.Fatalf("permanentlyClosed() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatPolicyDuration(t *testing.T) {
+	for duration, want := range map[time.Duration]string{
+		30 * time.Minute:        "30m",
+		2 * time.Hour:           "2h",
+		90 * time.Minute:        "1h30m",
+		45 * time.Second:        "45s",
+		time.Hour + time.Second: "1h0m1s",
+	} {
+		if got := formatPolicyDuration(duration); got != want {
+			t.Fatalf("formatPolicyDuration(%s) = %q, want %q", duration, got, want)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package sshd
+
+import (
+	"context"
+
+	"github.com/amalshaji/portr/internal/constants"
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/charmbracelet/log"
+)
+
+// Reconcile repairs the proxy route table and the connection rows in the
+// database from the lease table, which is the only record of the forwards
+// this process is serving:
+//
+//   - connections force-closed through the admin API, or whose owner is no
+//     longer a member of their team, are torn down, and their backends
+//     removed from the proxy;
+//   - other connections with forwards are marked active again if their row
+//     says otherwise, and their backends are added back to the proxy;
+//   - proxy backends no forward owns are removed;
+//   - active rows without forwards are marked closed, unless the process this
+//     one replaced is still serving tunnels.
+func (s *SshServer) Reconcile(ctx context.Context) {
+	// Snapshot the routes before walking the leases: a backend added after the
+	// snapshot belongs to a lease the walk will see.
+	routes := s.proxy.Routes()
+	activeConnections, err := s.service.GetAllActiveConnections(ctx)
+	if err != nil {
+		log.Error("Failed to get active connections", "error", err)
+		return
+	}
+	active := make(map[string]bool, len(activeConnections))
+	for _, connection := range activeConnections {
+		active[connection.ID] = true
+	}
+
+	s.leaseMu.Lock()
+	connectionIDs := make([]string, 0, len(s.forwards))
+	for connectionID := range s.forwards {
+		connectionIDs = append(connectionIDs, connectionID)
+	}
+	s.leaseMu.Unlock()
+	// Reactivating a revoked row would undo the close, so do nothing until it
+	// is known which rows were.
+	revoked, err := s.revokedConnections(ctx, connectionIDs, active)
+	if err != nil {
+		log.Error("Failed to get revoked connections", "error", err)
+		return
+	}
+
+	expected := make(map[string]bool)
+	var reactivated, restored, removed, closed int
+	for _, connectionID := range connectionIDs {
+		if ctx.Err() != nil {
+			return
+		}
+		if reason, ok := revoked[connectionID]; ok {
+			s.closeConnection(connectionID, reason, revokedMessages[reason])
+			continue
+		}
+		r, a := s.reconcileLeases(ctx, connectionID, active[connectionID], expected)
+		reactivated += r
+		restored += a
+		delete(active, connectionID)
+	}
+
+	for subdomain, backends := range routes {
+		for _, backend := range backends {
+			if expected[routeKey(subdomain, backend)] {
+				continue
+			}
+			if err := s.proxy.RemoveBackend(subdomain, backend); err == nil {
+				removed++
+			}
+		}
+	}
+
+	if len(active) != 0 && !s.proxy.CheckPredecessor() {
+		for connectionID := range active {
+			if ctx.Err() != nil {
+				return
+			}
+			if s.closeIfUnleased(ctx, connectionID) {
+				closed++
+			}
+		}
+	}
+	s.pruneLeases()
+
+	if reactivated+restored+removed+closed != 0 {
+		log.Info("Reconciled tunnels", "reactivated", reactivated, "restored_routes", restored, "removed_routes", removed, "closed", closed)
+	} else {
+		log.Debug("Reconciled tunnels", "connections", len(connectionIDs))
+	}
+}
+
+// revokedMessages are what the owner of a revoked tunnel is told, by close
+// reason.
+var revokedMessages = map[string]string{
+	models.ConnectionCloseReasonForceClosed:   "Tunnel was force-closed by a member of your team",
+	models.ConnectionCloseReasonMemberRemoved: "Tunnel closed because you are no longer a member of its team",
+	models.ConnectionCloseReasonKeyRevoked:    "Tunnel closed because the device key that opened it was revoked",
+}
+
+// revokedConnections returns why leased connections were revoked, by
+// connection id. Only rows no longer marked active can be.
+func (s *SshServer) revokedConnections(ctx context.Context, connectionIDs []string, active map[string]bool) (map[string]string, error) {
+	var inactive []string
+	for _, connectionID := range connectionIDs {
+		if !active[connectionID] {
+			inactive = append(inactive, connectionID)
+		}
+	}
+	if len(inactive) == 0 {
+		return nil, nil
+	}
+	return s.service.RevokedConnections(ctx, inactive)
+}
+
+// reconcileLeases repairs the database row and proxy routes of one
+// connection and records its backends in expected. It returns whether the
+// row was marked active again and how many routes were restored.
+func (s *SshServer) reconcileLeases(ctx context.Context, connectionID string, markedActive bool, expected map[string]bool) (int, int) {
+	leases := s.lockLeases(connectionID)
+	defer leases.mu.Unlock()
+	if len(leases.forwards) == 0 {
+		return 0, 0
+	}
+
+	reactivated := 0
+	if !markedActive {
+		if err := s.markLeasesActive(ctx, connectionID, leases); err != nil {
+			log.Error("Failed to mark connection as active", "connection_id", connectionID, "error", err)
+		} else {
+			reactivated = 1
+		}
+	}
+
+	restored := 0
+	for backend, lease := range leases.forwards {
+		if lease.connectionType == string(constants.Tcp) {
+			continue
+		}
+		expected[routeKey(lease.subdomain, backend)] = true
+		if s.proxy.HasBackend(lease.subdomain, backend) {
+			continue
+		}
+		if err := s.proxy.AddBackend(lease.subdomain, backend); err != nil {
+			log.Error("Failed to restore tunnel backend", "connection_id", connectionID, "backend", backend, "error", err)
+			continue
+		}
+		restored++
+	}
+	return reactivated, restored
+}
+
+func (s *SshServer) markLeasesActive(ctx context.Context, connectionID string, leases *connectionLeases) error {
+	// A tcp connection holds a single forward, whose port is the public one.
+	for _, lease := range leases.forwards {
+		if lease.connectionType == string(constants.Tcp) {
+			return s.service.MarkTCPConnectionAsActive(ctx, connectionID, lease.port)
+		}
+	}
+	return s.service.MarkConnectionAsActive(ctx, connectionID)
+}
+
+// closeIfUnleased marks an active connection closed when this process holds
+// no forward for it.
+func (s *SshServer) closeIfUnleased(ctx context.Context, connectionID string) bool {
+	leases := s.lockLeases(connectionID)
+	defer leases.mu.Unlock()
+	if len(leases.forwards) != 0 {
+		return false
+	}
+	if err := s.service.MarkConnectionAsClosed(ctx, connectionID, models.ConnectionCloseReasonDisconnected); err != nil {
+		log.Error("Failed to mark connection as closed", "connection_id", connectionID, "error", err)
+		return false
+	}
+	return true
+}
+
+// pruneLeases drops the lease sets of connections without forwards.
+func (s *SshServer) pruneLeases() {
+	s.leaseMu.Lock()
+	defer s.leaseMu.Unlock()
+	for connectionID, leases := range s.forwards {
+		leases.mu.Lock()
+		if len(leases.forwards) == 0 {
+			leases.pruned = true
+			delete(s.forwards, connectionID)
+		}
+		leases.mu.Unlock()
+	}
+}
+
+func routeKey(subdomain, backend string) string {
+	return subdomain + "\x00" + backend
+}
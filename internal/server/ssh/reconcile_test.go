@@ -0,0 +1,138 @@
+package sshd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	serverdb "github.com/amalshaji/portr/internal/server/db"
+	sshserver "github.com/gliderlabs/ssh"
+)
+
+func TestReconcileRepairsStateFromLeases(t *testing.T) {
+	server, database, ctx := newLeaseTestServer(t)
+	if err := server.activateForward(ctx, "127.0.0.1", 20001); err != nil {
+		t.Fatalf("activate forward: %v", err)
+	}
+	stale := serverdb.Connection{ID: "stale", Type: "http", Status: "active", CreatedByID: 1}
+	if err := database.Create(&stale).Error; err != nil {
+		t.Fatalf("create stale connection: %v", err)
+	}
+	if err := database.Model(&serverdb.Connection{}).Where("id = ?", "connection").Update("status", "closed").Error; err != nil {
+		t.Fatalf("close leased connection: %v", err)
+	}
+	if err := server.proxy.RemoveBackend("pooled", "127.0.0.1:20001"); err != nil {
+		t.Fatalf("remove route: %v", err)
+	}
+	if err := server.proxy.AddBackend("orphan", "127.0.0.1:20009"); err != nil {
+		t.Fatalf("add orphan route: %v", err)
+	}
+
+	server.Reconcile(context.Background())
+
+	var connection serverdb.Connection
+	if err := database.First(&connection, "id = ?", "connection").Error; err != nil {
+		t.Fatalf("load connection: %v", err)
+	}
+	if connection.Status != "active" {
+		t.Fatalf("expected leased connection to be active, got %q", connection.Status)
+	}
+	if err := database.First(&stale, "id = ?", "stale").Error; err != nil {
+		t.Fatalf("load stale connection: %v", err)
+	}
+	if stale.Status != "closed" || stale.ClosedAt == nil {
+		t.Fatalf("expected stale connection to close, status=%q closed_at=%v", stale.Status, stale.ClosedAt)
+	}
+	if !server.proxy.HasBackend("pooled", "127.0.0.1:20001") {
+		t.Fatal("expected leased backend to be routed again")
+	}
+	if routes := server.proxy.Routes(); len(routes["orphan"]) != 0 {
+		t.Fatalf("expected orphan route to be removed, got %v", routes["orphan"])
+	}
+}
+
+func TestReconcilePrunesClosedLeasesWithoutLosingNewForwards(t *testing.T) {
+	server, database, ctx := newLeaseTestServer(t)
+	if err := server.activateForward(ctx, "127.0.0.1", 20001); err != nil {
+		t.Fatalf("activate forward: %v", err)
+	}
+	server.closeForward(ctx, "127.0.0.1", 20001)
+
+	server.Reconcile(context.Background())
+	server.leaseMu.Lock()
+	remaining := len(server.forwards)
+	server.leaseMu.Unlock()
+	if remaining != 0 {
+		t.Fatalf("expected empty lease set to be pruned, got %d", remaining)
+	}
+
+	if err := server.activateForward(ctx, "127.0.0.1", 20002); err != nil {
+		t.Fatalf("reactivate forward: %v", err)
+	}
+	server.Reconcile(context.Background())
+	var connection serverdb.Connection
+	if err := database.First(&connection, "id = ?", "connection").Error; err != nil {
+		t.Fatalf("load connection: %v", err)
+	}
+	if connection.Status != "active" {
+		t.Fatalf("expected reactivated connection to stay active, got %q", connection.Status)
+	}
+	if !server.proxy.HasBackend("pooled", "127.0.0.1:20002") {
+		t.Fatal("expected reactivated backend to stay routed")
+	}
+}
+
+func TestReconcileTearsDownForceClosedConnections(t *testing.T) {
+	server, database, ctx := newLeaseTestServer(t)
+	conn := newClosingConn()
+	ctx.values[sshserver.ContextKeyConn] = conn
+	if err := server.activateForward(ctx, "127.0.0.1", 20001); err != nil {
+		t.Fatalf("activate forward: %v", err)
+	}
+	err := database.Model(&serverdb.Connection{}).Where("id = ?", "connection").Updates(map[string]any{
+		"status":       "closed",
+		"close_reason": models.ConnectionCloseReasonForceClosed,
+	}).Error
+	if err != nil {
+		t.Fatalf("force-close connection: %v", err)
+	}
+
+	server.Reconcile(context.Background())
+	if server.proxy.HasBackend("pooled", "127.0.0.1:20001") {
+		t.Fatal("expected the force-closed backend to be removed")
+	}
+	if request := waitForClose(t, conn); request.Reason != models.ConnectionCloseReasonForceClosed {
+		t.Fatalf("unexpected closed notice %+v", request)
+	}
+
+	server.closeForward(ctx, "127.0.0.1", 20001)
+	var connection serverdb.Connection
+	if err := database.First(&connection, "id = ?", "connection").Error; err != nil {
+		t.Fatalf("load connection: %v", err)
+	}
+	if connection.Status != "closed" || permanentlyClosed(&connection, time.Now()) != models.ConnectionCloseReasonForceClosed {
+		t.Fatalf("expected the connection to stay force-closed, status=%q close_reason=%v", connection.Status, connection.CloseReason)
+	}
+}
+
+func TestReconcileTearsDownConnectionsOfRemovedMembers(t *testing.T) {
+	server, database, ctx := newLeaseTestServer(t)
+	conn := newClosingConn()
+	ctx.values[sshserver.ContextKeyConn] = conn
+	if err := server.activateForward(ctx, "127.0.0.1", 20001); err != nil {
+		t.Fatalf("activate forward: %v", err)
+	}
+	// Removing a member deletes their connections where foreign keys cascade.
+	if err := database.Delete(&serverdb.Connection{}, "id = ?", "connection").Error; err != nil {
+		t.Fatalf("delete connection: %v", err)
+	}
+
+	server.Reconcile(context.Background())
+	if server.proxy.HasBackend("pooled", "127.0.0.1:20001") {
+		t.Fatal("expected the removed member's backend to be removed")
+	}
+	if request := waitForClose(t, conn); request.Reason != models.ConnectionCloseReasonMemberRemoved {
+		t.Fatalf("unexpected closed notice %+v", request)
+	}
+}
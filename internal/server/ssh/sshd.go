@@ -4,18 +4,25 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/amalshaji/portr/internal/constants"
+	"github.com/amalshaji/portr/internal/server/admin/middleware"
+	"github.com/amalshaji/portr/internal/server/admin/models"
 	"github.com/charmbracelet/log"
 
+	"github.com/amalshaji/portr/internal/server/bandwidth"
 	"github.com/amalshaji/portr/internal/server/config"
 	"github.com/amalshaji/portr/internal/server/db"
 	"github.com/amalshaji/portr/internal/server/proxy"
 	"github.com/amalshaji/portr/internal/server/service"
+	"github.com/amalshaji/portr/internal/tracing"
 	"github.com/gliderlabs/ssh"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	gossh "golang.org/x/crypto/ssh"
 )
 
@@ -26,16 +33,45 @@ type SshServer struct {
 	server   *ssh.Server
 	leaseMu  sync.Mutex
 	forwards map[string]*connectionLeases
+	// backends maps the proxy backends of http forwards to their connection.
+	// It has its own lock because it is updated with a lease set locked.
+	backendMu sync.RWMutex
+	backends  map[string]string
+	// bandwidth meters tunnel traffic; nil leaves it unmetered.
+	bandwidth *bandwidth.Meter
+	// throttle locks out addresses guessing secret keys at stock logins.
+	throttle *middleware.LoginThrottle
 }
 
 type forwardLease struct {
 	connectionType string
 	subdomain      string
+	port           uint32
+	// conn is the session that opened the forward. Pooled http tunnels
+	// open one forward per session on the same connection.
+	conn gossh.Conn
 }
 
 type connectionLeases struct {
 	mu       sync.Mutex
+	conn     gossh.Conn
 	forwards map[string]forwardLease
+	// teamID and teamUserID own the connection, so bandwidth notices reach
+	// the tunnels they concern. stock is set for stock ssh sessions, which
+	// get notices on stdout.
+	teamID     uint
+	teamUserID uint
+	stock      *stockSession
+	// activity, deadline and closeReason enforce the tunnel policies; see
+	// policy.go.
+	activity *activity
+	deadline connectionDeadline
+	// closeReason is set when the server closes the connection, and recorded
+	// on its row once the last forward is gone.
+	closeReason string
+	// pruned is set when the empty lease set is dropped from SshServer.forwards;
+	// holders of a stale pointer must look the connection up again.
+	pruned bool
 }
 
 type reservedConnectionContextKey struct{}
@@ -46,9 +82,17 @@ func New(config *config.SshConfig, proxy *proxy.Proxy, service *service.Service)
 		proxy:    proxy,
 		service:  service,
 		forwards: make(map[string]*connectionLeases),
+		backends: make(map[string]string),
+		throttle: middleware.NewLoginThrottle(),
 	}
 }
 
+// SetLoginThrottle shares the admin server's login throttle, so secret keys
+// guessed over ssh and over the admin API count against the same lockout.
+func (s *SshServer) SetLoginThrottle(throttle *middleware.LoginThrottle) {
+	s.throttle = throttle
+}
+
 func (s *SshServer) GetServerAddr() string {
 	return ":" + fmt.Sprint(s.config.Port)
 }
@@ -77,14 +121,28 @@ func (s *SshServer) authenticateConnection(ctx ssh.Context) (*db.Connection, err
 		return nil, fmt.Errorf("failed to get reserved connection")
 	}
 
-	if reservedConnection.CreatedBy.SecretKey != secretKey {
+	if !s.service.ConnectionKeyMatches(ctx, reservedConnection, secretKey, remoteIP(ctx)) {
 		log.Error("Connection not created by the user", "connection_id", connectionID)
 		return nil, fmt.Errorf("connection not created by the user")
 	}
 
+	if reason := permanentlyClosed(reservedConnection, time.Now()); reason != "" {
+		log.Info("Refused a permanently closed connection", "connection_id", connectionID, "reason", reason)
+		return nil, fmt.Errorf("connection was closed: %s", reason)
+	}
+
 	return reservedConnection, nil
 }
 
+// remoteIP returns the address a client connected from, without its port.
+func remoteIP(ctx ssh.Context) string {
+	addr := ctx.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
 func connectionCredentials(ctx ssh.Context) (string, string, error) {
 	userSplit := strings.SplitN(ctx.User(), ":", 2)
 	if len(userSplit) != 2 {
@@ -94,13 +152,25 @@ func connectionCredentials(ctx ssh.Context) (string, string, error) {
 }
 
 func (s *SshServer) activateForward(ctx ssh.Context, host string, port uint32) error {
+	if session := stockSessionFromContext(ctx); session != nil {
+		return s.activateStockForward(ctx, session, host, port)
+	}
 	reservedConnection, err := s.GetReservedConnectionFromSshContext(ctx)
 	if err != nil {
 		return err
 	}
+	return s.activateConnectionForward(ctx, reservedConnection, host, port)
+}
 
+func (s *SshServer) activateConnectionForward(ctx ssh.Context, reservedConnection *db.Connection, host string, port uint32) (err error) {
 	backend := forwardKey(host, port)
-	lease := forwardLease{connectionType: reservedConnection.Type}
+	_, span := tracing.Tracer().Start(ctx, "sshd.forward.open", trace.WithAttributes(
+		attribute.String("portr.connection_id", reservedConnection.ID),
+		attribute.String("portr.connection_type", reservedConnection.Type),
+		attribute.String("portr.backend", backend),
+	))
+	defer func() { tracing.End(span, err) }()
+	lease := forwardLease{connectionType: reservedConnection.Type, port: port}
 	switch reservedConnection.Type {
 	case string(constants.Tcp):
 	case string(constants.Http):
@@ -108,18 +178,30 @@ func (s *SshServer) activateForward(ctx ssh.Context, host string, port uint32) e
 			return fmt.Errorf("http connection has no subdomain")
 		}
 		lease.subdomain = *reservedConnection.Subdomain
+		span.SetAttributes(attribute.String("portr.subdomain", lease.subdomain))
 	default:
 		return fmt.Errorf("unsupported connection type %q", reservedConnection.Type)
 	}
 
-	connectionLeases := s.leasesForConnection(reservedConnection.ID)
-	connectionLeases.mu.Lock()
+	connectionLeases := s.lockLeases(reservedConnection.ID)
 	defer connectionLeases.mu.Unlock()
 	if _, exists := connectionLeases.forwards[backend]; exists {
 		return nil
 	}
 
 	firstForward := len(connectionLeases.forwards) == 0
+	if conn, ok := ctx.Value(ssh.ContextKeyConn).(gossh.Conn); ok {
+		connectionLeases.conn = conn
+		lease.conn = conn
+	}
+	if firstForward {
+		connectionLeases.activity.touch()
+		connectionLeases.closeReason = ""
+		connectionLeases.deadline = s.deadlineFor(ctx, reservedConnection)
+	}
+	connectionLeases.teamID = uint(reservedConnection.CreatedBy.TeamID)
+	connectionLeases.teamUserID = reservedConnection.CreatedBy.ID
+	connectionLeases.stock = stockSessionFromContext(ctx)
 	if reservedConnection.Type == string(constants.Tcp) {
 		if !firstForward {
 			return fmt.Errorf("tcp connection already has an active forward")
@@ -140,26 +222,68 @@ func (s *SshServer) activateForward(ctx ssh.Context, host string, port uint32) e
 	}
 
 	connectionLeases.forwards[backend] = lease
+	if lease.connectionType != string(constants.Tcp) {
+		s.backendMu.Lock()
+		s.backends[backend] = reservedConnection.ID
+		s.backendMu.Unlock()
+	}
 	return nil
 }
 
+// ConnectionForBackend returns the connection whose http forward a proxy
+// backend is.
+func (s *SshServer) ConnectionForBackend(backend string) (string, bool) {
+	s.backendMu.RLock()
+	defer s.backendMu.RUnlock()
+	connectionID, ok := s.backends[backend]
+	return connectionID, ok
+}
+
 func (s *SshServer) leasesForConnection(connectionID string) *connectionLeases {
 	s.leaseMu.Lock()
 	defer s.leaseMu.Unlock()
 	leases := s.forwards[connectionID]
 	if leases == nil {
-		leases = &connectionLeases{forwards: make(map[string]forwardLease)}
+		leases = &connectionLeases{forwards: make(map[string]forwardLease), activity: &activity{}}
 		s.forwards[connectionID] = leases
 	}
 	return leases
 }
 
-func (s *SshServer) closeForward(ctx ssh.Context, host string, port uint32) {
-	connectionID, _, err := connectionCredentials(ctx)
-	if err != nil {
-		return
+// lockLeases returns the locked lease set of a connection, creating it when
+// needed.
+func (s *SshServer) lockLeases(connectionID string) *connectionLeases {
+	for {
+		leases := s.leasesForConnection(connectionID)
+		leases.mu.Lock()
+		if !leases.pruned {
+			return leases
+		}
+		leases.mu.Unlock()
 	}
+}
+
+func (s *SshServer) closeForward(ctx ssh.Context, host string, port uint32) {
 	backend := forwardKey(host, port)
+	var connectionID string
+	if session := stockSessionFromContext(ctx); session != nil {
+		id, ok := session.takeConnectionID(backend)
+		if !ok {
+			return
+		}
+		connectionID = id
+	} else {
+		id, _, err := connectionCredentials(ctx)
+		if err != nil {
+			return
+		}
+		connectionID = id
+	}
+	_, span := tracing.Tracer().Start(ctx, "sshd.forward.close", trace.WithAttributes(
+		attribute.String("portr.connection_id", connectionID),
+		attribute.String("portr.backend", backend),
+	))
+	defer span.End()
 
 	s.leaseMu.Lock()
 	connectionLeases := s.forwards[connectionID]
@@ -169,6 +293,9 @@ func (s *SshServer) closeForward(ctx ssh.Context, host string, port uint32) {
 	}
 	connectionLeases.mu.Lock()
 	defer connectionLeases.mu.Unlock()
+	if connectionLeases.pruned {
+		return
+	}
 	lease, exists := connectionLeases.forwards[backend]
 	if !exists {
 		return
@@ -178,57 +305,129 @@ func (s *SshServer) closeForward(ctx ssh.Context, host string, port uint32) {
 		if err := s.proxy.RemoveBackend(lease.subdomain, backend); err != nil {
 			log.Error("Failed to remove tunnel backend", "connection_id", connectionID, "backend", backend, "error", err)
 		}
+		s.backendMu.Lock()
+		if s.backends[backend] == connectionID {
+			delete(s.backends, backend)
+		}
+		s.backendMu.Unlock()
 	}
 	delete(connectionLeases.forwards, backend)
 	if len(connectionLeases.forwards) != 0 {
 		return
 	}
 
+	reason := connectionLeases.closeReason
+	if reason == "" {
+		reason = models.ConnectionCloseReasonDisconnected
+	}
 	closeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	if err := s.service.MarkConnectionAsClosed(closeCtx, connectionID); err != nil {
+	if err := s.service.MarkConnectionAsClosed(closeCtx, connectionID, reason); err != nil {
 		log.Error("Failed to mark connection as closed", "connection_id", connectionID, "error", err)
+		span.RecordError(err)
 	}
 }
 
-func (s *SshServer) Start() {
+// Prepare builds the server and loads its host key, so configuration errors
+// surface before the server reports ready.
+func (s *SshServer) Prepare() error {
 	srv := s.Build()
 
 	hostKeyOption, err := loadHostKey(s.config.HostKey)
 	if err != nil {
-		log.Fatal("Failed to load host key", "error", err)
+		return fmt.Errorf("failed to load host key: %w", err)
 	}
 	if hostKeyOption != nil {
 		hostKeyOption(srv)
 	}
 
 	s.server = srv
+	return nil
+}
+
+func (s *SshServer) Start(listener net.Listener) {
+	if s.server == nil {
+		if err := s.Prepare(); err != nil {
+			log.Fatal("Failed to start SSH server", "error", err)
+		}
+	}
 
 	log.Info("Starting SSH server", "port", s.GetServerAddr())
 
-	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, ssh.ErrServerClosed) {
+	if err := s.server.Serve(listener); err != nil && !errors.Is(err, ssh.ErrServerClosed) && !errors.Is(err, net.ErrClosed) {
 		log.Fatal("Failed to start SSH server", "error", err)
 	}
 }
 
+// Shutdown asks every connected client to reconnect once the server is back
+// and closes the sessions that are still open after 30 seconds.
 func (s *SshServer) Shutdown(_ context.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 
 	defer func() { cancel() }()
 
-	if err := s.server.Shutdown(ctx); err != nil {
-		log.Error("Failed to stop SSH server", "error", err)
-		return
-	}
+	s.drain(ctx, goAwayRequest{Reason: "server shutting down", RetryAfter: shutdownRetryAfter})
 
 	log.Info("Stopped SSH server")
 }
 
+// Drain stops accepting sessions, asks every connected client to reconnect
+// and waits for their sessions to end. Sessions still open when ctx expires
+// are closed.
+func (s *SshServer) Drain(ctx context.Context, reason string) {
+	s.drain(ctx, goAwayRequest{Reason: reason})
+	log.Info("Drained SSH sessions")
+}
+
+func (s *SshServer) drain(ctx context.Context, goAway goAwayRequest) {
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- s.server.Shutdown(ctx)
+	}()
+
+	notified := s.sendGoAway(goAway)
+	log.Info("Draining SSH sessions", "sessions", notified, "reason", goAway.Reason)
+
+	if err := <-shutdownErr; err != nil {
+		log.Warn("SSH sessions did not drain in time, closing them", "error", err)
+		_ = s.server.Close()
+	}
+}
+
+// sendGoAway sends a goaway request to every tunnel session and returns the
+// number of sessions notified.
+func (s *SshServer) sendGoAway(goAway goAwayRequest) int {
+	payload := gossh.Marshal(&goAway)
+
+	s.leaseMu.Lock()
+	conns := make([]gossh.Conn, 0, len(s.forwards))
+	for _, leases := range s.forwards {
+		leases.mu.Lock()
+		if leases.conn != nil && len(leases.forwards) != 0 {
+			conns = append(conns, leases.conn)
+		}
+		leases.mu.Unlock()
+	}
+	s.leaseMu.Unlock()
+
+	for _, conn := range conns {
+		go func(conn gossh.Conn) {
+			if _, _, err := conn.SendRequest(goAwayRequestType, false, payload); err != nil {
+				log.Debug("Failed to send goaway", "remote_addr", conn.RemoteAddr(), "error", err)
+			}
+		}(conn)
+	}
+	return len(conns)
+}
+
 // Build constructs the ssh.Server with all handlers, without starting it.
 func (s *SshServer) Build() *ssh.Server {
 	forwardHandler := &forwardedTCPHandler{
+		bind:     s.bindForward,
 		onBound:  s.activateForward,
 		onClosed: s.closeForward,
+		account:  s.bandwidthAccount,
+		activity: s.forwardActivity,
 	}
 
 	requestHandlers := map[string]ssh.RequestHandler{
@@ -244,16 +443,26 @@ func (s *SshServer) Build() *ssh.Server {
 	server := &ssh.Server{
 		Addr: s.GetServerAddr(),
 		Handler: ssh.Handler(func(sh ssh.Session) {
+			if session := stockSessionFromContext(sh.Context()); session != nil {
+				handleStockSession(sh, session)
+				return
+			}
 			<-sh.Context().Done()
 		}),
 		RequestHandlers: requestHandlers,
-		PasswordHandler: func(ctx ssh.Context, _ string) bool {
+		PasswordHandler: func(ctx ssh.Context, password string) bool {
+			if !strings.Contains(ctx.User(), ":") {
+				return s.authenticateStockPassword(ctx, password)
+			}
 			reservedConnection, err := s.authenticateConnection(ctx)
 			if err == nil {
 				ctx.SetValue(reservedConnectionContextKey{}, reservedConnection)
+				setStockSession(ctx, nil)
 			}
 			return err == nil
 		},
+		PublicKeyHandler:           s.authenticateStockPublicKey,
+		KeyboardInteractiveHandler: s.authenticateStockKeyboardInteractive,
 	}
 
 	return server
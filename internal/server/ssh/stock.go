@@ -0,0 +1,398 @@
+package sshd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/amalshaji/portr/internal/constants"
+	"github.com/amalshaji/portr/internal/server/admin/middleware"
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"github.com/amalshaji/portr/internal/server/db"
+	"github.com/amalshaji/portr/internal/utils"
+	"github.com/charmbracelet/log"
+	"github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// stockSession is a login by a plain OpenSSH client. Unlike the portr
+// client, which logs in as "<connection-id>:<secret-key>" with a connection
+// reserved through the admin API, it logs in as the team user, and sshd
+// reserves a connection for each of its remote forwards: http for ports 80
+// and 443, on the subdomain in the bind address or a generated one, and tcp
+// otherwise.
+type stockSession struct {
+	teamUser *db.TeamUser
+	// deviceKeyID is the device key the session signed in with, if any.
+	deviceKeyID *uint
+	// credential is the tunnel credential the session signed in with, if
+	// any. Every tunnel is checked against it.
+	credential *models.TunnelCredential
+
+	mu sync.Mutex
+	// pending holds bound forwards that have no connection yet, and
+	// connections the connection ids of registered ones, both keyed by
+	// backend address.
+	pending     map[string]stockForward
+	connections map[string]string
+	messages    []string
+	notify      chan struct{}
+}
+
+type stockForward struct {
+	connectionType constants.ConnectionType
+	bindAddr       string
+}
+
+type stockSessionContextKey struct{}
+
+const generatedSubdomainAttempts = 5
+
+func newStockSession(teamUser *db.TeamUser, deviceKeyID *uint) *stockSession {
+	return &stockSession{
+		teamUser:    teamUser,
+		deviceKeyID: deviceKeyID,
+		pending:     make(map[string]stockForward),
+		connections: make(map[string]string),
+		notify:      make(chan struct{}),
+	}
+}
+
+func stockSessionFromContext(ctx ssh.Context) *stockSession {
+	session, _ := ctx.Value(stockSessionContextKey{}).(*stockSession)
+	return session
+}
+
+// announce queues a line for the session's stdout.
+func (s *stockSession) announce(format string, args ...any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, fmt.Sprintf(format, args...))
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+// messagesSince returns the lines queued after the first n, and a channel
+// closed when more are queued.
+func (s *stockSession) messagesSince(n int) ([]string, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.messages[n:], s.notify
+}
+
+// setStockSession records which kind of login succeeded. Every successful
+// authentication callback calls it, so a callback that accepted a public key
+// the client then failed to sign with cannot leave its team user behind.
+func setStockSession(ctx ssh.Context, session *stockSession) {
+	ctx.SetValue(stockSessionContextKey{}, session)
+	if session != nil {
+		ctx.SetValue(reservedConnectionContextKey{}, (*db.Connection)(nil))
+	}
+}
+
+// authenticateStockPassword signs a stock session in with a secret key,
+// device key or tunnel credential. Unknown keys count against the client's
+// address in the login throttle.
+func (s *SshServer) authenticateStockPassword(ctx ssh.Context, secretKey string) bool {
+	ip := remoteIP(ctx)
+	if s.throttle.SecretKeyWait(ip) > 0 {
+		return false
+	}
+	session, err := s.resolveStockKey(ctx, secretKey, ip)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidSecretKey) {
+			s.recordSecretKeyFailure(ctx, ip)
+		}
+		return false
+	}
+	setStockSession(ctx, session)
+	return true
+}
+
+func (s *SshServer) resolveStockKey(ctx ssh.Context, secretKey, ip string) (*stockSession, error) {
+	if strings.HasPrefix(secretKey, models.TunnelCredentialPrefix) {
+		teamUser, credential, err := s.service.GetTeamUserByTunnelCredential(ctx, secretKey)
+		if err != nil {
+			return nil, err
+		}
+		session := newStockSession(teamUser, nil)
+		session.credential = credential
+		return session, nil
+	}
+	teamUser, deviceKeyID, err := s.service.GetTeamUserBySecretKey(ctx, secretKey, ip)
+	if err != nil {
+		return nil, err
+	}
+	return newStockSession(teamUser, deviceKeyID), nil
+}
+
+// recordSecretKeyFailure counts an unknown secret key from ip, and records
+// the lockout it starts in the audit log.
+func (s *SshServer) recordSecretKeyFailure(ctx ssh.Context, ip string) {
+	lockout := s.throttle.SecretKeyFailed(ip)
+	if lockout == 0 {
+		return
+	}
+	entry := models.AuditLog{
+		Action: models.AuditActionLoginLocked,
+		IP:     ip,
+		Detail: "secret keys locked out for " + middleware.FormatWait(lockout),
+	}
+	if err := s.service.RecordAuditLog(ctx, entry); err != nil {
+		log.Error("Failed to record audit log entry", "action", entry.Action, "error", err)
+	}
+}
+
+func (s *SshServer) authenticateStockPublicKey(ctx ssh.Context, key ssh.PublicKey) bool {
+	teamUser, err := s.service.GetTeamUserBySshKey(ctx, gossh.FingerprintSHA256(key))
+	if err != nil {
+		return false
+	}
+	setStockSession(ctx, newStockSession(teamUser, nil))
+	return true
+}
+
+// authenticateStockKeyboardInteractive accepts a username that is a secret
+// key without a prompt, and asks for the secret key otherwise.
+func (s *SshServer) authenticateStockKeyboardInteractive(ctx ssh.Context, challenger gossh.KeyboardInteractiveChallenge) bool {
+	if strings.Contains(ctx.User(), ":") {
+		return false
+	}
+	if wait := s.throttle.SecretKeyWait(remoteIP(ctx)); wait > 0 {
+		_, _ = challenger("", fmt.Sprintf("Too many failed attempts. Try again in %s.", middleware.FormatWait(wait)), nil, nil)
+		return false
+	}
+	if s.authenticateStockPassword(ctx, ctx.User()) {
+		return true
+	}
+	answers, err := challenger("", "Enter the secret key shown on your portr dashboard.", []string{"Secret key: "}, []bool{false})
+	if err != nil || len(answers) != 1 {
+		return false
+	}
+	return s.authenticateStockPassword(ctx, strings.TrimSpace(answers[0]))
+}
+
+// bindForward binds portr client forwards where they ask to be bound. Stock
+// forwards ask for public ports such as 80, so they are bound on a port of
+// the server's choosing instead.
+func (s *SshServer) bindForward(ctx ssh.Context, payload remoteForwardRequest) (net.Listener, string, error) {
+	session := stockSessionFromContext(ctx)
+	if session == nil {
+		return bindRequestedAddr(ctx, payload)
+	}
+
+	forward := stockForward{connectionType: constants.Tcp, bindAddr: payload.BindAddr}
+	host := "0.0.0.0"
+	var listener net.Listener
+	var err error
+	if payload.BindPort == 80 || payload.BindPort == 443 {
+		forward.connectionType = constants.Http
+		host = "127.0.0.1"
+		listener, err = net.Listen("tcp", net.JoinHostPort(host, "0"))
+	} else {
+		for _, port := range utils.GenerateRandomTcpPorts() {
+			listener, err = net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+			if err == nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		session.announce("Failed to open a tunnel for port %d: no free port", payload.BindPort)
+		return nil, "", err
+	}
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	session.mu.Lock()
+	session.pending[net.JoinHostPort(host, port)] = forward
+	session.mu.Unlock()
+	return listener, host, nil
+}
+
+func (s *SshServer) activateStockForward(ctx ssh.Context, session *stockSession, host string, port uint32) error {
+	backend := forwardKey(host, port)
+	session.mu.Lock()
+	forward, ok := session.pending[backend]
+	delete(session.pending, backend)
+	session.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown forward %s", backend)
+	}
+
+	connection, err := s.createStockConnection(ctx, session, forward)
+	if err != nil {
+		return err
+	}
+	if err := s.activateConnectionForward(ctx, connection, host, port); err != nil {
+		if closeErr := s.service.MarkConnectionAsClosed(ctx, connection.ID, models.ConnectionCloseReasonDisconnected); closeErr != nil {
+			log.Error("Failed to mark connection as closed", "connection_id", connection.ID, "error", closeErr)
+		}
+		session.announce("Failed to open a tunnel for %s", forwardDescription(forward))
+		return err
+	}
+
+	session.mu.Lock()
+	session.connections[backend] = connection.ID
+	session.mu.Unlock()
+
+	if forward.connectionType == constants.Http {
+		session.announce("Tunnel ready: %s", s.proxy.Config().HttpTunnelUrl(*connection.Subdomain))
+	} else {
+		session.announce("Tunnel ready: %s", s.proxy.Config().TcpTunnelUrl(port))
+	}
+	log.Info("Opened tunnel for stock ssh client", "connection_id", connection.ID, "team_user_id", session.teamUser.ID)
+	return nil
+}
+
+func (s *SshServer) createStockConnection(ctx ssh.Context, session *stockSession, forward stockForward) (*db.Connection, error) {
+	if forward.connectionType == constants.Tcp {
+		return s.reserveStockConnection(ctx, session, constants.Tcp, nil)
+	}
+
+	if subdomain, ok := requestedSubdomain(forward.bindAddr); ok {
+		connection, err := s.reserveStockConnection(ctx, session, constants.Http, &subdomain)
+		switch {
+		case errors.Is(err, services.ErrSubdomainInUse):
+			session.announce("Subdomain %s is already in use", subdomain)
+		case errors.Is(err, services.ErrSubdomainReserved):
+			session.announce("Subdomain %s is reserved by another user", subdomain)
+		}
+		return connection, err
+	}
+
+	var err error
+	for attempt := 0; attempt < generatedSubdomainAttempts; attempt++ {
+		subdomain := utils.GenerateTunnelSubdomain()
+		var connection *db.Connection
+		connection, err = s.reserveStockConnection(ctx, session, constants.Http, &subdomain)
+		if err == nil {
+			return connection, nil
+		}
+		if errors.Is(err, services.ErrCredentialNotAllowed) {
+			return nil, err
+		}
+		if !errors.Is(err, services.ErrSubdomainInUse) && !errors.Is(err, services.ErrSubdomainReserved) {
+			break
+		}
+	}
+	session.announce("Failed to allocate a subdomain")
+	return nil, err
+}
+
+// reserveStockConnection reserves a connection for the session, telling it
+// which tunnels its tunnel credential opens when this one is not among them.
+func (s *SshServer) reserveStockConnection(ctx ssh.Context, session *stockSession, connectionType constants.ConnectionType, subdomain *string) (*db.Connection, error) {
+	connection, err := s.service.CreateConnection(ctx, session.teamUser, session.deviceKeyID, session.credential, string(connectionType), subdomain)
+	if errors.Is(err, services.ErrCredentialNotAllowed) {
+		scope := "This credential only opens " + session.credential.ConnectionType + " tunnels"
+		if session.credential.ConnectionType == models.ConnectionTypeHTTP {
+			scope += " on subdomains matching " + session.credential.SubdomainPattern
+		}
+		session.announce("%s", scope)
+	}
+	return connection, err
+}
+
+// requestedSubdomain returns the subdomain named by a forward's bind
+// address. OpenSSH sends "localhost" or an empty address when none is given.
+func requestedSubdomain(bindAddr string) (string, bool) {
+	subdomain := utils.NormalizeSubdomain(bindAddr)
+	switch subdomain {
+	case "", "localhost", "*":
+		return "", false
+	}
+	if utils.ValidateSubdomain(subdomain) != nil {
+		return "", false
+	}
+	return subdomain, true
+}
+
+func forwardDescription(forward stockForward) string {
+	if subdomain, ok := requestedSubdomain(forward.bindAddr); ok && forward.connectionType == constants.Http {
+		return subdomain
+	}
+	return string(forward.connectionType)
+}
+
+// connectionID returns the connection a stock forward was registered under.
+func (s *stockSession) connectionID(backend string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	connectionID, ok := s.connections[backend]
+	return connectionID, ok
+}
+
+// takeConnectionID returns the connection a stock forward was registered
+// under and forgets it.
+func (s *stockSession) takeConnectionID(backend string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	connectionID, ok := s.connections[backend]
+	delete(s.connections, backend)
+	return connectionID, ok
+}
+
+// handleStockSession writes the session's tunnel addresses to stdout until
+// the client disconnects or presses Ctrl-C or Ctrl-D.
+//
+// The forwards are set up before the client sends a command, so a command
+// such as the subdomain in `ssh -R 80:localhost:3000 portr-host myapp` comes
+// too late to name a tunnel. Rather than ignore it, the session is refused
+// with a hint to pass the subdomain as the bind address, which closes the
+// client's tunnels with it.
+func handleStockSession(sh ssh.Session, session *stockSession) {
+	_, _, hasPty := sh.Pty()
+	newline := "\n"
+	if hasPty {
+		newline = "\r\n"
+	}
+
+	if command := sh.RawCommand(); command != "" {
+		_, _ = fmt.Fprintf(sh.Stderr(), "portr does not run commands, so %q was not used. Pass the subdomain as the bind address instead: ssh -R <subdomain>:80:localhost:3000 ...%s", command, newline)
+		_ = sh.Exit(1)
+		return
+	}
+
+	// With a terminal, Ctrl-C and Ctrl-D reach the server as input and end
+	// the session. Without one the client handles them itself. Either way
+	// stdin may end long before the client disconnects, for example when ssh
+	// runs in the background of a CI job.
+	quit := make(chan struct{})
+	go func() {
+		buffer := make([]byte, 256)
+		for {
+			n, err := sh.Read(buffer)
+			if err != nil {
+				return
+			}
+			if hasPty && (bytes.IndexByte(buffer[:n], 0x03) >= 0 || bytes.IndexByte(buffer[:n], 0x04) >= 0) {
+				close(quit)
+				return
+			}
+		}
+	}()
+
+	written := 0
+	for {
+		messages, notify := session.messagesSince(written)
+		for _, message := range messages {
+			_, _ = io.WriteString(sh, message+newline)
+		}
+		written += len(messages)
+
+		select {
+		case <-notify:
+		case <-quit:
+			_ = sh.Exit(0)
+			return
+		case <-sh.Context().Done():
+			return
+		}
+	}
+}
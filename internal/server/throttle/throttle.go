@@ -0,0 +1,164 @@
+// Package throttle slows down guessing: of passwords at login, and of tunnel
+// secret keys. Keys fail freely a few times, then are locked out for a
+// backoff that doubles with each further failure.
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// Policy says how quickly a key is locked out.
+type Policy struct {
+	// Free is how many failures are allowed before the first lockout.
+	Free int
+	// Backoff is the first lockout; each further failure doubles it, up to
+	// MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Forget is how long after its last failure a key starts over.
+	Forget time.Duration
+}
+
+type entry struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// Limiter tracks failures per key, such as an email or a client IP. It holds
+// at most size keys; when full, forgotten keys are dropped, and if none are,
+// the key that failed longest ago, preferring keys not locked out.
+//
+// A nil Limiter throttles nothing.
+type Limiter struct {
+	policy Policy
+	size   int
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+func New(policy Policy, size int) *Limiter {
+	return &Limiter{
+		policy:  policy,
+		size:    size,
+		now:     time.Now,
+		entries: make(map[string]*entry),
+	}
+}
+
+// Wait returns how long key stays locked out, or 0 if it may try now.
+func (l *Limiter) Wait(key string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	current := l.lookup(key, now)
+	if current == nil || !now.Before(current.lockedUntil) {
+		return 0
+	}
+	return current.lockedUntil.Sub(now)
+}
+
+// Fail records a failure for key and returns the lockout it started, or 0
+// if key still has free failures left.
+func (l *Limiter) Fail(key string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	current := l.lookup(key, now)
+	if current == nil {
+		l.makeRoom(now)
+		current = &entry{}
+		l.entries[key] = current
+	}
+	current.failures++
+	current.lastFailure = now
+
+	over := current.failures - l.policy.Free
+	if over <= 0 {
+		return 0
+	}
+	lockout := l.policy.Backoff
+	for range over - 1 {
+		if lockout >= l.policy.MaxBackoff {
+			break
+		}
+		lockout *= 2
+	}
+	lockout = min(lockout, l.policy.MaxBackoff)
+	current.lockedUntil = now.Add(lockout)
+	return lockout
+}
+
+// Reset forgets key's failures, as after a successful login.
+func (l *Limiter) Reset(key string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, key)
+}
+
+// SetClock replaces the limiter's clock, for tests.
+func (l *Limiter) SetClock(now func() time.Time) {
+	l.now = now
+}
+
+// staler reports whether a should be dropped before b.
+func staler(a, b *entry, now time.Time) bool {
+	aLocked, bLocked := now.Before(a.lockedUntil), now.Before(b.lockedUntil)
+	if aLocked != bLocked {
+		return bLocked
+	}
+	return a.lastFailure.Before(b.lastFailure)
+}
+
+// lookup returns key's entry, dropping it if it is forgotten.
+func (l *Limiter) lookup(key string, now time.Time) *entry {
+	current, ok := l.entries[key]
+	if !ok {
+		return nil
+	}
+	if l.forgotten(current, now) {
+		delete(l.entries, key)
+		return nil
+	}
+	return current
+}
+
+func (l *Limiter) forgotten(e *entry, now time.Time) bool {
+	return !now.Before(e.lastFailure.Add(l.policy.Forget)) && !now.Before(e.lockedUntil)
+}
+
+func (l *Limiter) makeRoom(now time.Time) {
+	if len(l.entries) < l.size {
+		return
+	}
+	for key, existing := range l.entries {
+		if l.forgotten(existing, now) {
+			delete(l.entries, key)
+		}
+	}
+	if len(l.entries) < l.size {
+		return
+	}
+	// Dropping everything would let a flood of new keys lift every lockout,
+	// so only the stalest key goes, one that is not locked out if any.
+	var stalest string
+	var stalestEntry *entry
+	for key, existing := range l.entries {
+		if stalestEntry == nil || staler(existing, stalestEntry, now) {
+			stalest, stalestEntry = key, existing
+		}
+	}
+	delete(l.entries, stalest)
+}
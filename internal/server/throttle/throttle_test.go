@@ -0,0 +1,93 @@
+package throttle
+
+import (
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	Free:       3,
+	Backoff:    time.Second,
+	MaxBackoff: 4 * time.Second,
+	Forget:     time.Hour,
+}
+
+func TestFailLocksOutWithDoublingBackoff(t *testing.T) {
+	limiter := New(testPolicy, 10)
+	now := time.Now()
+	limiter.SetClock(func() time.Time { return now })
+
+	for range 3 {
+		if lockout := limiter.Fail("key"); lockout != 0 {
+			t.Fatalf("expected free failures, got a %s lockout", lockout)
+		}
+	}
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		if lockout := limiter.Fail("key"); lockout != want {
+			t.Fatalf("expected a %s lockout, got %s", want, lockout)
+		}
+		if wait := limiter.Wait("key"); wait != want {
+			t.Fatalf("expected to wait %s, got %s", want, wait)
+		}
+	}
+
+	now = now.Add(4 * time.Second)
+	if wait := limiter.Wait("key"); wait != 0 {
+		t.Fatalf("expected the lockout to end, got %s", wait)
+	}
+	if wait := limiter.Wait("other"); wait != 0 {
+		t.Fatalf("expected other keys to be unaffected, got %s", wait)
+	}
+}
+
+func TestResetAndForgetStartOver(t *testing.T) {
+	limiter := New(testPolicy, 10)
+	now := time.Now()
+	limiter.SetClock(func() time.Time { return now })
+
+	for range 4 {
+		limiter.Fail("reset")
+		limiter.Fail("forget")
+	}
+	limiter.Reset("reset")
+	if lockout := limiter.Fail("reset"); lockout != 0 {
+		t.Fatalf("expected a reset key to start over, got %s", lockout)
+	}
+
+	now = now.Add(time.Hour)
+	if lockout := limiter.Fail("forget"); lockout != 0 {
+		t.Fatalf("expected a forgotten key to start over, got %s", lockout)
+	}
+}
+
+func TestFullLimiterKeepsLockouts(t *testing.T) {
+	limiter := New(testPolicy, 2)
+	now := time.Now()
+	limiter.SetClock(func() time.Time { return now })
+
+	for range 4 {
+		limiter.Fail("locked")
+	}
+	now = now.Add(time.Millisecond)
+	limiter.Fail("a")
+	now = now.Add(time.Millisecond)
+	limiter.Fail("b")
+
+	if len(limiter.entries) > 2 {
+		t.Fatalf("expected at most 2 keys, got %d", len(limiter.entries))
+	}
+	if limiter.Wait("locked") == 0 {
+		t.Fatal("expected the lockout to outlive newer keys")
+	}
+	if _, ok := limiter.entries["a"]; ok {
+		t.Fatal("expected the stalest unlocked key to be dropped")
+	}
+}
+
+func TestNilLimiterThrottlesNothing(t *testing.T) {
+	var limiter *Limiter
+	if limiter.Fail("key") != 0 || limiter.Wait("key") != 0 {
+		t.Fatal("expected a nil limiter to allow everything")
+	}
+	limiter.Reset("key")
+}
@@ -0,0 +1,71 @@
+// Package ttlcache caches the admin settings the proxy looks up per request,
+// so hot paths do not reach the database.
+package ttlcache
+
+import (
+	"sync"
+	"time"
+)
+
+type entry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// Cache maps keys to values that expire after a fixed TTL. It holds at most
+// size entries; when full, expired entries are dropped, and if none are, the
+// whole cache is.
+type Cache[V any] struct {
+	ttl  time.Duration
+	size int
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]entry[V]
+}
+
+func New[V any](ttl time.Duration, size int) *Cache[V] {
+	return &Cache[V]{
+		ttl:     ttl,
+		size:    size,
+		now:     time.Now,
+		entries: make(map[string]entry[V]),
+	}
+}
+
+// Get returns the cached value for key, or loads and caches it. Load errors
+// are returned and not cached.
+func (c *Cache[V]) Get(key string, load func() (V, error)) (V, error) {
+	now := c.now()
+	c.mu.Lock()
+	cached, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.value, nil
+	}
+
+	value, err := load()
+	if err != nil {
+		return value, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= c.size {
+		for key, existing := range c.entries {
+			if !now.Before(existing.expires) {
+				delete(c.entries, key)
+			}
+		}
+		if len(c.entries) >= c.size {
+			clear(c.entries)
+		}
+	}
+	c.entries[key] = entry[V]{value: value, expires: now.Add(c.ttl)}
+	return value, nil
+}
+
+// SetClock replaces the cache's clock, for tests.
+func (c *Cache[V]) SetClock(now func() time.Time) {
+	c.now = now
+}
@@ -0,0 +1,48 @@
+package ttlcache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGetCachesUntilExpiry(t *testing.T) {
+	cache := New[int](time.Minute, 10)
+	now := time.Now()
+	cache.SetClock(func() time.Time { return now })
+	loads := 0
+	load := func() (int, error) {
+		loads++
+		return loads, nil
+	}
+
+	for range 3 {
+		if value, _ := cache.Get("key", load); value != 1 {
+			t.Fatalf("expected the cached value, got %d", value)
+		}
+	}
+	now = now.Add(time.Minute)
+	if value, _ := cache.Get("key", load); value != 2 {
+		t.Fatalf("expected a reload after expiry, got %d", value)
+	}
+}
+
+func TestGetDoesNotCacheErrors(t *testing.T) {
+	cache := New[int](time.Minute, 10)
+	if _, err := cache.Get("key", func() (int, error) { return 0, errors.New("down") }); err == nil {
+		t.Fatal("expected the load error")
+	}
+	if value, err := cache.Get("key", func() (int, error) { return 3, nil }); err != nil || value != 3 {
+		t.Fatalf("expected a fresh load, got %d %v", value, err)
+	}
+}
+
+func TestGetBoundsSize(t *testing.T) {
+	cache := New[int](time.Minute, 2)
+	for _, key := range []string{"a", "b", "c"} {
+		_, _ = cache.Get(key, func() (int, error) { return 1, nil })
+	}
+	if len(cache.entries) > 2 {
+		t.Fatalf("expected at most 2 entries, got %d", len(cache.entries))
+	}
+}
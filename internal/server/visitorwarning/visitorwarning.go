@@ -0,0 +1,59 @@
+// Package visitorwarning supplies the proxy with the visitor interstitials
+// teams turn on in the admin API.
+package visitorwarning
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"github.com/amalshaji/portr/internal/server/proxy"
+	"github.com/amalshaji/portr/internal/server/ttlcache"
+	"github.com/charmbracelet/log"
+)
+
+const (
+	// warningTTL is how long after a team turns the interstitial on or off
+	// browsers without the acknowledgement cookie still get the old answer.
+	warningTTL        = 30 * time.Second
+	maxCachedWarnings = 4096
+)
+
+type Resolver interface {
+	ResolveVisitorWarning(ctx context.Context, subdomain string) (*services.ResolvedVisitorWarning, error)
+}
+
+type Warnings struct {
+	resolver Resolver
+	cache    *ttlcache.Cache[*services.ResolvedVisitorWarning]
+}
+
+func New(resolver Resolver) *Warnings {
+	return &Warnings{
+		resolver: resolver,
+		cache:    ttlcache.New[*services.ResolvedVisitorWarning](warningTTL, maxCachedWarnings),
+	}
+}
+
+var _ proxy.VisitorWarnings = (*Warnings)(nil)
+
+// Warning returns the interstitial for the subdomain. Lookup failures let
+// visitors through rather than failing the request.
+func (w *Warnings) Warning(ctx context.Context, subdomain string) (proxy.VisitorWarning, bool) {
+	subdomain = strings.ToLower(subdomain)
+	if subdomain == "" {
+		return proxy.VisitorWarning{}, false
+	}
+	warning, err := w.cache.Get(subdomain, func() (*services.ResolvedVisitorWarning, error) {
+		return w.resolver.ResolveVisitorWarning(ctx, subdomain)
+	})
+	if err != nil {
+		log.Warn("Failed to load visitor warning", "subdomain", subdomain, "error", err)
+		return proxy.VisitorWarning{}, false
+	}
+	if warning == nil {
+		return proxy.VisitorWarning{}, false
+	}
+	return proxy.VisitorWarning{Owner: warning.Owner, Team: warning.Team}, true
+}
@@ -0,0 +1,25 @@
+package tracing
+
+import "testing"
+
+func TestParseEndpoint(t *testing.T) {
+	cases := map[string]string{
+		"":                                   "",
+		"http://localhost:4318":              "http://localhost:4318/v1/traces",
+		"http://localhost:4318/":             "http://localhost:4318/v1/traces",
+		"https://otel.example.com/v1/traces": "https://otel.example.com/v1/traces",
+		"https://otel.example.com/custom":    "https://otel.example.com/custom",
+	}
+	for endpoint, want := range cases {
+		got, err := ParseEndpoint(endpoint)
+		if err != nil || got != want {
+			t.Errorf("ParseEndpoint(%q) = %q, %v; want %q", endpoint, got, err, want)
+		}
+	}
+
+	for _, endpoint := range []string{"localhost:4318", "grpc://localhost:4317", "http://"} {
+		if _, err := ParseEndpoint(endpoint); err == nil {
+			t.Errorf("ParseEndpoint(%q) should fail", endpoint)
+		}
+	}
+}
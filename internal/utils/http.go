@@ -2,6 +2,9 @@ package utils
 
 import (
 	_ "embed"
+	"encoding/json"
+	"html"
+	"strings"
 
 	"github.com/valyala/fasttemplate"
 )
@@ -9,21 +12,102 @@ import (
 //go:embed error-templates/local-server-not-online.html
 var LocalServerNotOnlineText string
 
-func LocalServerNotOnline(endpoint string) string {
-	return LocalServerNotOnlineText
+func LocalServerNotOnline(endpoint, requestID string) string {
+	t := fasttemplate.New(LocalServerNotOnlineText, "{{", "}}")
+	return t.ExecuteString(map[string]any{"request_id": requestIDLine(requestID)})
 }
 
 //go:embed error-templates/unregistered-subdomain.html
 var UnregisteredSubdomainText string
 
-func UnregisteredSubdomain(subdomain string) string {
+func UnregisteredSubdomain(subdomain, requestID string) string {
 	t := fasttemplate.New(UnregisteredSubdomainText, "{{", "}}")
-	return t.ExecuteString(map[string]any{"subdomain": subdomain})
+	return t.ExecuteString(map[string]any{
+		"subdomain":  subdomain,
+		"request_id": requestIDLine(requestID),
+	})
 }
 
 //go:embed error-templates/connection-lost.html
 var ConnectionLostText string
 
-func ConnectionLost() string {
-	return ConnectionLostText
+func ConnectionLost(requestID string) string {
+	t := fasttemplate.New(ConnectionLostText, "{{", "}}")
+	return t.ExecuteString(map[string]any{"request_id": requestIDLine(requestID)})
+}
+
+//go:embed error-templates/bandwidth-exceeded.html
+var BandwidthExceededText string
+
+// BandwidthExceeded is shown instead of a tunnel whose team or owner used
+// the month's bandwidth. resetsOn is the date the quota resets.
+func BandwidthExceeded(subdomain, resetsOn, requestID string) string {
+	t := fasttemplate.New(BandwidthExceededText, "{{", "}}")
+	return t.ExecuteString(map[string]any{
+		"subdomain":  html.EscapeString(subdomain),
+		"resets_on":  html.EscapeString(resetsOn),
+		"request_id": requestIDLine(requestID),
+	})
+}
+
+// requestIDLine is the footer the built-in error pages show the request ID
+// in, so visitors can quote it when reporting a problem.
+func requestIDLine(requestID string) string {
+	if requestID == "" {
+		return ""
+	}
+	return `<p class="text-center font-mono text-xs text-gray-400">Request ID: ` + html.EscapeString(requestID) + `</p>`
+}
+
+//go:embed error-templates/visitor-warning.html
+var VisitorWarningText string
+
+// VisitorWarning is the interstitial shown to first-time browser visitors of
+// a tunnel whose team turned it on.
+func VisitorWarning(subdomain, owner, team, continueURL string) string {
+	t := fasttemplate.New(VisitorWarningText, "{{", "}}")
+	return t.ExecuteString(map[string]any{
+		"subdomain":    html.EscapeString(subdomain),
+		"owner":        html.EscapeString(owner),
+		"team":         html.EscapeString(team),
+		"continue_url": html.EscapeString(continueURL),
+	})
+}
+
+// Error reasons sent in the X-Portr-Error-Reason header.
+const (
+	ErrorReasonUnregisteredSubdomain = "unregistered-subdomain"
+	ErrorReasonConnectionLost        = "connection-lost"
+	ErrorReasonLocalServerNotOnline  = "local-server-not-online"
+	ErrorReasonBandwidthExceeded     = "bandwidth-exceeded"
+)
+
+var errorMessages = map[string]string{
+	ErrorReasonUnregisteredSubdomain: "No tunnel is running on this subdomain",
+	ErrorReasonConnectionLost:        "The tunnel lost its connection to the server",
+	ErrorReasonLocalServerNotOnline:  "The tunnel's local server is not responding",
+	ErrorReasonBandwidthExceeded:     "The tunnel has used its bandwidth for this month",
+}
+
+// WantsJSON reports whether a visitor's Accept header asks for JSON rather
+// than an HTML page. Browsers list text/html, so they keep getting pages.
+func WantsJSON(accept string) bool {
+	accept = strings.ToLower(accept)
+	if strings.Contains(accept, "text/html") {
+		return false
+	}
+	return strings.Contains(accept, "application/json") || strings.Contains(accept, "+json")
+}
+
+// ErrorJSON is the JSON counterpart of the error pages, for visitors that
+// asked for JSON.
+func ErrorJSON(reason, subdomain, requestID string) []byte {
+	body := struct {
+		Code      string `json:"code"`
+		Message   string `json:"message"`
+		Subdomain string `json:"subdomain,omitempty"`
+		RequestID string `json:"request_id,omitempty"`
+	}{reason, errorMessages[reason], subdomain, requestID}
+	data, _ := json.Marshal(body)
+	return data
 }
@@ -7,7 +7,7 @@ import (
 )
 
 func TestLocalServerNotOnline(t *testing.T) {
-	result := LocalServerNotOnline("http://localhost:8080")
+	result := LocalServerNotOnline("http://localhost:8080", "")
 	if result == "" {
 		t.Error("LocalServerNotOnline returned empty string")
 	}
@@ -19,7 +19,7 @@ func TestLocalServerNotOnline(t *testing.T) {
 
 func TestUnregisteredSubdomain(t *testing.T) {
 	testSubdomain := "test-subdomain"
-	result := UnregisteredSubdomain(testSubdomain)
+	result := UnregisteredSubdomain(testSubdomain, "")
 
 	if result == "" {
 		t.Error("UnregisteredSubdomain returned empty string")
@@ -35,7 +35,7 @@ func TestUnregisteredSubdomain(t *testing.T) {
 }
 
 func TestConnectionLost(t *testing.T) {
-	result := ConnectionLost()
+	result := ConnectionLost("")
 	if result == "" {
 		t.Error("ConnectionLost returned empty string")
 	}
@@ -44,3 +44,49 @@ func TestConnectionLost(t *testing.T) {
 		t.Error("ConnectionLost should return HTML content")
 	}
 }
+
+func TestWantsJSON(t *testing.T) {
+	cases := map[string]bool{
+		"":                                  false,
+		"*/*":                               false,
+		"application/json":                  true,
+		"application/problem+json":          true,
+		"application/json, text/plain, */*": true,
+		"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8": false,
+		"text/html, application/json":                                     false,
+	}
+	for accept, want := range cases {
+		if got := WantsJSON(accept); got != want {
+			t.Errorf("WantsJSON(%q) = %v, want %v", accept, got, want)
+		}
+	}
+}
+
+func TestErrorJSON(t *testing.T) {
+	got := string(ErrorJSON(ErrorReasonUnregisteredSubdomain, "demo", ""))
+	want := `{"code":"unregistered-subdomain","message":"No tunnel is running on this subdomain","subdomain":"demo"}`
+	if got != want {
+		t.Fatalf("ErrorJSON = %s, want %s", got, want)
+	}
+}
+
+func TestErrorPagesShowTheRequestID(t *testing.T) {
+	pages := map[string]string{
+		"local-server-not-online": LocalServerNotOnline("http://localhost:8080", "01J<id>"),
+		"unregistered-subdomain":  UnregisteredSubdomain("demo", "01J<id>"),
+		"connection-lost":         ConnectionLost("01J<id>"),
+	}
+	for name, page := range pages {
+		if !strings.Contains(page, "Request ID: 01J&lt;id&gt;") {
+			t.Errorf("%s page should show the escaped request ID", name)
+		}
+	}
+	if strings.Contains(ConnectionLost(""), "{{request_id}}") || strings.Contains(ConnectionLost(""), "Request ID") {
+		t.Error("pages without a request ID should not show the line")
+	}
+
+	got := string(ErrorJSON(ErrorReasonConnectionLost, "demo", "01JREQ"))
+	if !strings.HasSuffix(got, `"subdomain":"demo","request_id":"01JREQ"}`) {
+		t.Fatalf("ErrorJSON should include the request ID, got %s", got)
+	}
+}
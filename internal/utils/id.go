@@ -2,6 +2,7 @@ package utils
 
 import (
 	gonanoid "github.com/matoous/go-nanoid/v2"
+	"github.com/oklog/ulid/v2"
 )
 
 func GenerateTunnelSubdomain() string {
@@ -23,3 +24,32 @@ func GenerateSecretKeyForUser() string {
 	id, _ := gonanoid.New(42)
 	return id
 }
+
+// RequestIDHeader carries the ID the proxy assigns to every request. The
+// tunnel client stores its captures under the same ID, so a request can be
+// followed from the server's access log to the local inspector.
+const RequestIDHeader = "X-Portr-Request-Id"
+
+const maxRequestIDLength = 128
+
+func NewRequestID() string {
+	return ulid.Make().String()
+}
+
+// ValidRequestID reports whether an incoming request ID is safe to keep:
+// short, and limited to characters that need no escaping in headers, URLs
+// or logs.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
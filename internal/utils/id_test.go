@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidRequestID(t *testing.T) {
+	cases := map[string]bool{
+		NewRequestID():           true,
+		"trace-1234_abc.def:9":   true,
+		"":                       false,
+		"has space":              false,
+		"line\nbreak":            false,
+		"<script>":               false,
+		strings.Repeat("a", 128): true,
+		strings.Repeat("a", 129): false,
+	}
+	for id, want := range cases {
+		if got := ValidRequestID(id); got != want {
+			t.Errorf("ValidRequestID(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE "error_page" (
+    "id" SERIAL PRIMARY KEY,
+    "team_id" INTEGER NOT NULL REFERENCES "team" ("id") ON DELETE CASCADE,
+    "reservation_id" INTEGER REFERENCES "subdomain_reservation" ("id") ON DELETE CASCADE,
+    "kind" TEXT NOT NULL,
+    "body" TEXT NOT NULL,
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX "idx_error_page_scope_unique"
+ON "error_page" ("team_id", COALESCE("reservation_id", 0), "kind");
+
+CREATE INDEX "idx_error_page_reservation"
+ON "error_page" ("reservation_id");
+
+-- +goose Down
+DROP TABLE IF EXISTS "error_page";
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE "team" ADD COLUMN "visitor_warning" BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE "team" DROP COLUMN "visitor_warning";
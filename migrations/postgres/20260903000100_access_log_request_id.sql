@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE "access_log" ADD COLUMN "request_id" TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX "idx_access_log_request_id"
+ON "access_log" ("team_id", "request_id");
+
+-- +goose Down
+DROP INDEX IF EXISTS "idx_access_log_request_id";
+ALTER TABLE "access_log" DROP COLUMN "request_id";
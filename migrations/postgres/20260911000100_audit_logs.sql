@@ -0,0 +1,41 @@
+-- +goose Up
+CREATE TABLE "audit_log" (
+    "id" BIGSERIAL PRIMARY KEY,
+    "team_id" INTEGER,
+    "actor_id" INTEGER,
+    "actor_email" TEXT NOT NULL DEFAULT '',
+    "action" TEXT NOT NULL,
+    "target_type" TEXT NOT NULL DEFAULT '',
+    "target_id" TEXT NOT NULL DEFAULT '',
+    "target" TEXT NOT NULL DEFAULT '',
+    "ip" TEXT NOT NULL DEFAULT '',
+    "diff" TEXT NOT NULL DEFAULT '',
+    "detail" TEXT NOT NULL DEFAULT '',
+    "created_at" TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX "idx_audit_log_team"
+ON "audit_log" ("team_id", "created_at");
+
+CREATE INDEX "idx_audit_log_created_at"
+ON "audit_log" ("created_at");
+
+CREATE INDEX "idx_audit_log_action"
+ON "audit_log" ("action");
+
+-- +goose StatementBegin
+CREATE FUNCTION "audit_log_append_only"() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER "audit_log_append_only"
+BEFORE UPDATE OR DELETE ON "audit_log"
+FOR EACH ROW EXECUTE FUNCTION "audit_log_append_only"();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS "audit_log_append_only" ON "audit_log";
+DROP FUNCTION IF EXISTS "audit_log_append_only"();
+DROP TABLE IF EXISTS "audit_log";
@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE "api_token" (
+    "id" SERIAL PRIMARY KEY,
+    "team_user_id" INTEGER NOT NULL REFERENCES "team_users" ("id") ON DELETE CASCADE,
+    "name" TEXT NOT NULL,
+    "prefix" TEXT NOT NULL,
+    "token_hash" TEXT NOT NULL,
+    "scopes" TEXT NOT NULL,
+    "expires_at" TIMESTAMPTZ,
+    "last_used_at" TIMESTAMPTZ,
+    "revoked_at" TIMESTAMPTZ,
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX "idx_api_token_token_hash_unique"
+ON "api_token" ("token_hash");
+
+CREATE INDEX "idx_api_token_team_user"
+ON "api_token" ("team_user_id");
+
+-- +goose Down
+DROP TABLE IF EXISTS "api_token";
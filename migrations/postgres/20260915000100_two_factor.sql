@@ -0,0 +1,23 @@
+-- +goose Up
+ALTER TABLE "user" ADD COLUMN "totp_secret" TEXT;
+ALTER TABLE "user" ADD COLUMN "totp_enabled_at" TIMESTAMPTZ;
+ALTER TABLE "user" ADD COLUMN "totp_last_step" BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE "team" ADD COLUMN "require_two_factor" BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE "recovery_code" (
+    "id" SERIAL PRIMARY KEY,
+    "user_id" INTEGER NOT NULL REFERENCES "user" ("id") ON DELETE CASCADE,
+    "code_hash" TEXT NOT NULL,
+    "used_at" TIMESTAMPTZ,
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX "idx_recovery_code_user"
+ON "recovery_code" ("user_id");
+
+-- +goose Down
+DROP TABLE IF EXISTS "recovery_code";
+ALTER TABLE "team" DROP COLUMN "require_two_factor";
+ALTER TABLE "user" DROP COLUMN "totp_last_step";
+ALTER TABLE "user" DROP COLUMN "totp_enabled_at";
+ALTER TABLE "user" DROP COLUMN "totp_secret";
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE "user" ADD COLUMN "failed_login_count" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "session" ADD COLUMN "failed_logins" INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE "session" DROP COLUMN "failed_logins";
+ALTER TABLE "user" DROP COLUMN "failed_login_count";
@@ -0,0 +1,29 @@
+-- +goose Up
+CREATE TABLE "tunnel_credential" (
+    "id" SERIAL PRIMARY KEY,
+    "team_user_id" INTEGER NOT NULL REFERENCES "team_users" ("id") ON DELETE CASCADE,
+    "api_token_id" INTEGER REFERENCES "api_token" ("id") ON DELETE CASCADE,
+    "name" TEXT NOT NULL,
+    "prefix" TEXT NOT NULL,
+    "key_hash" TEXT NOT NULL,
+    "connection_type" TEXT NOT NULL,
+    "subdomain_pattern" TEXT NOT NULL DEFAULT '',
+    "expires_at" TIMESTAMPTZ NOT NULL,
+    "last_used_at" TIMESTAMPTZ,
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX "idx_tunnel_credential_key_hash_unique"
+ON "tunnel_credential" ("key_hash");
+
+CREATE INDEX "idx_tunnel_credential_team_user"
+ON "tunnel_credential" ("team_user_id");
+
+CREATE INDEX "idx_tunnel_credential_expires_at"
+ON "tunnel_credential" ("expires_at");
+
+ALTER TABLE "connection" ADD COLUMN "tunnel_credential_id" INTEGER;
+
+-- +goose Down
+ALTER TABLE "connection" DROP COLUMN "tunnel_credential_id";
+DROP TABLE IF EXISTS "tunnel_credential";
@@ -0,0 +1,37 @@
+-- +goose Up
+ALTER TABLE "subdomain_reservation"
+ADD COLUMN "team_id" INTEGER REFERENCES "team" ("id") ON DELETE CASCADE;
+
+UPDATE "subdomain_reservation"
+SET "team_id" = "team_users"."team_id"
+FROM "team_users"
+WHERE "team_users"."id" = "subdomain_reservation"."team_user_id";
+
+ALTER TABLE "subdomain_reservation" ALTER COLUMN "team_id" SET NOT NULL;
+ALTER TABLE "subdomain_reservation" ALTER COLUMN "team_user_id" DROP NOT NULL;
+
+CREATE INDEX "idx_subdomain_reservation_team"
+ON "subdomain_reservation" ("team_id");
+
+CREATE TABLE "subdomain_reservation_member" (
+    "id" SERIAL PRIMARY KEY,
+    "reservation_id" INTEGER NOT NULL REFERENCES "subdomain_reservation" ("id") ON DELETE CASCADE,
+    "team_user_id" INTEGER NOT NULL REFERENCES "team_users" ("id") ON DELETE CASCADE,
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX "idx_subdomain_reservation_member_unique"
+ON "subdomain_reservation_member" ("reservation_id", "team_user_id");
+
+CREATE INDEX "idx_subdomain_reservation_member_team_user"
+ON "subdomain_reservation_member" ("team_user_id");
+
+-- +goose Down
+DROP TABLE IF EXISTS "subdomain_reservation_member";
+
+DELETE FROM "subdomain_reservation" WHERE "team_user_id" IS NULL;
+
+ALTER TABLE "subdomain_reservation" ALTER COLUMN "team_user_id" SET NOT NULL;
+
+DROP INDEX IF EXISTS "idx_subdomain_reservation_team";
+ALTER TABLE "subdomain_reservation" DROP COLUMN "team_id";
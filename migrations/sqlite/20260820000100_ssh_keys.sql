@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE "ssh_key" (
+    "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+    "team_user_id" INTEGER NOT NULL REFERENCES "team_users" ("id") ON DELETE CASCADE,
+    "name" TEXT NOT NULL,
+    "public_key" TEXT NOT NULL,
+    "fingerprint" TEXT NOT NULL,
+    "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "last_used_at" DATETIME
+);
+
+CREATE UNIQUE INDEX "idx_ssh_key_fingerprint_unique"
+ON "ssh_key" ("fingerprint");
+
+CREATE INDEX "idx_ssh_key_team_user"
+ON "ssh_key" ("team_user_id");
+
+-- +goose Down
+DROP TABLE IF EXISTS "ssh_key";
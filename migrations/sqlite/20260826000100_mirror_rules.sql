@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE "mirror_rule" (
+    "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+    "team_id" INTEGER NOT NULL REFERENCES "team" ("id") ON DELETE CASCADE,
+    "source_reservation_id" INTEGER NOT NULL REFERENCES "subdomain_reservation" ("id") ON DELETE CASCADE,
+    "target_reservation_id" INTEGER NOT NULL REFERENCES "subdomain_reservation" ("id") ON DELETE CASCADE,
+    "max_body_bytes" INTEGER NOT NULL,
+    "mirrored_count" INTEGER NOT NULL DEFAULT 0,
+    "failed_count" INTEGER NOT NULL DEFAULT 0,
+    "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX "idx_mirror_rule_source_unique"
+ON "mirror_rule" ("source_reservation_id");
+
+CREATE INDEX "idx_mirror_rule_team"
+ON "mirror_rule" ("team_id");
+
+CREATE INDEX "idx_mirror_rule_target"
+ON "mirror_rule" ("target_reservation_id");
+
+-- +goose Down
+DROP TABLE IF EXISTS "mirror_rule";
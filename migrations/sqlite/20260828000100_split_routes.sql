@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE "split_route" (
+    "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+    "team_id" INTEGER NOT NULL REFERENCES "team" ("id") ON DELETE CASCADE,
+    "reservation_id" INTEGER NOT NULL REFERENCES "subdomain_reservation" ("id") ON DELETE CASCADE,
+    "primary_reservation_id" INTEGER NOT NULL REFERENCES "subdomain_reservation" ("id") ON DELETE CASCADE,
+    "secondary_reservation_id" INTEGER NOT NULL REFERENCES "subdomain_reservation" ("id") ON DELETE CASCADE,
+    "primary_weight" INTEGER NOT NULL,
+    "sticky" BOOLEAN NOT NULL DEFAULT 0,
+    "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX "idx_split_route_reservation_unique"
+ON "split_route" ("reservation_id");
+
+CREATE INDEX "idx_split_route_team"
+ON "split_route" ("team_id");
+
+-- +goose Down
+DROP TABLE IF EXISTS "split_route";
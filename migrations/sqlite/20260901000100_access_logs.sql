@@ -0,0 +1,25 @@
+-- +goose Up
+CREATE TABLE "access_log" (
+    "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+    "connection_id" TEXT NOT NULL REFERENCES "connection" ("id") ON DELETE CASCADE,
+    "team_id" INTEGER NOT NULL REFERENCES "team" ("id") ON DELETE CASCADE,
+    "subdomain" TEXT NOT NULL,
+    "owner" TEXT NOT NULL,
+    "method" TEXT NOT NULL,
+    "path" TEXT NOT NULL,
+    "status" INTEGER NOT NULL,
+    "latency_ms" INTEGER NOT NULL,
+    "bytes_in" INTEGER NOT NULL,
+    "bytes_out" INTEGER NOT NULL,
+    "visitor_ip" TEXT NOT NULL,
+    "created_at" DATETIME NOT NULL
+);
+
+CREATE INDEX "idx_access_log_connection"
+ON "access_log" ("connection_id", "created_at");
+
+CREATE INDEX "idx_access_log_created_at"
+ON "access_log" ("created_at");
+
+-- +goose Down
+DROP TABLE IF EXISTS "access_log";
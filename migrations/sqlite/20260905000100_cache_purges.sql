@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE "cache_purge" (
+    "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+    "team_id" INTEGER NOT NULL REFERENCES "team" ("id") ON DELETE CASCADE,
+    "subdomain" TEXT NOT NULL,
+    "created_at" DATETIME NOT NULL
+);
+
+CREATE INDEX "idx_cache_purge_created_at"
+ON "cache_purge" ("created_at");
+
+-- +goose Down
+DROP TABLE IF EXISTS "cache_purge";
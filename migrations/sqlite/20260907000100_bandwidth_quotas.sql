@@ -0,0 +1,27 @@
+-- +goose Up
+ALTER TABLE "team" ADD COLUMN "bandwidth_monthly_bytes" BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE "team" ADD COLUMN "bandwidth_rate_bytes" BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE "team_users" ADD COLUMN "bandwidth_monthly_bytes" BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE "team_users" ADD COLUMN "bandwidth_rate_bytes" BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE "bandwidth_usage" (
+    "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+    "team_id" INTEGER NOT NULL REFERENCES "team" ("id") ON DELETE CASCADE,
+    "team_user_id" INTEGER NOT NULL REFERENCES "team_users" ("id") ON DELETE CASCADE,
+    "period" TEXT NOT NULL,
+    "bytes" BIGINT NOT NULL DEFAULT 0,
+    "updated_at" DATETIME NOT NULL
+);
+
+CREATE UNIQUE INDEX "idx_bandwidth_usage_team_user_period"
+ON "bandwidth_usage" ("team_user_id", "period");
+
+CREATE INDEX "idx_bandwidth_usage_team_period"
+ON "bandwidth_usage" ("team_id", "period");
+
+-- +goose Down
+DROP TABLE IF EXISTS "bandwidth_usage";
+ALTER TABLE "team_users" DROP COLUMN "bandwidth_rate_bytes";
+ALTER TABLE "team_users" DROP COLUMN "bandwidth_monthly_bytes";
+ALTER TABLE "team" DROP COLUMN "bandwidth_rate_bytes";
+ALTER TABLE "team" DROP COLUMN "bandwidth_monthly_bytes";
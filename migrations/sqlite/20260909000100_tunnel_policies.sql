@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE "team" ADD COLUMN "max_tunnel_lifetime_seconds" BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE "connection" ADD COLUMN "expires_at" TIMESTAMP;
+ALTER TABLE "connection" ADD COLUMN "close_reason" TEXT;
+
+-- +goose Down
+ALTER TABLE "connection" DROP COLUMN "close_reason";
+ALTER TABLE "connection" DROP COLUMN "expires_at";
+ALTER TABLE "team" DROP COLUMN "max_tunnel_lifetime_seconds";
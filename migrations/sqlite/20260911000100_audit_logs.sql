@@ -0,0 +1,43 @@
+-- +goose Up
+CREATE TABLE "audit_log" (
+    "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+    "team_id" INTEGER,
+    "actor_id" INTEGER,
+    "actor_email" TEXT NOT NULL DEFAULT '',
+    "action" TEXT NOT NULL,
+    "target_type" TEXT NOT NULL DEFAULT '',
+    "target_id" TEXT NOT NULL DEFAULT '',
+    "target" TEXT NOT NULL DEFAULT '',
+    "ip" TEXT NOT NULL DEFAULT '',
+    "diff" TEXT NOT NULL DEFAULT '',
+    "detail" TEXT NOT NULL DEFAULT '',
+    "created_at" DATETIME NOT NULL
+);
+
+CREATE INDEX "idx_audit_log_team"
+ON "audit_log" ("team_id", "created_at");
+
+CREATE INDEX "idx_audit_log_created_at"
+ON "audit_log" ("created_at");
+
+CREATE INDEX "idx_audit_log_action"
+ON "audit_log" ("action");
+
+-- +goose StatementBegin
+CREATE TRIGGER "audit_log_no_update" BEFORE UPDATE ON "audit_log"
+BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER "audit_log_no_delete" BEFORE DELETE ON "audit_log"
+BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TRIGGER IF EXISTS "audit_log_no_delete";
+DROP TRIGGER IF EXISTS "audit_log_no_update";
+DROP TABLE IF EXISTS "audit_log";
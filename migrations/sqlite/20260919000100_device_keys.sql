@@ -0,0 +1,29 @@
+-- +goose Up
+CREATE TABLE "device_key" (
+    "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+    "team_user_id" INTEGER NOT NULL REFERENCES "team_users" ("id") ON DELETE CASCADE,
+    "name" TEXT NOT NULL,
+    "prefix" TEXT NOT NULL,
+    "key_hash" TEXT NOT NULL,
+    "expires_at" DATETIME,
+    "last_used_at" DATETIME,
+    "last_used_ip" TEXT,
+    "revoked_at" DATETIME,
+    "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX "idx_device_key_key_hash_unique"
+ON "device_key" ("key_hash");
+
+CREATE INDEX "idx_device_key_team_user"
+ON "device_key" ("team_user_id");
+
+ALTER TABLE "connection" ADD COLUMN "device_key_id" INTEGER;
+
+CREATE INDEX "idx_connection_device_key"
+ON "connection" ("device_key_id");
+
+-- +goose Down
+DROP INDEX IF EXISTS "idx_connection_device_key";
+ALTER TABLE "connection" DROP COLUMN "device_key_id";
+DROP TABLE IF EXISTS "device_key";
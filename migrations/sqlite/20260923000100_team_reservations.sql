@@ -0,0 +1,68 @@
+-- +goose Up
+-- SQLite cannot drop NOT NULL from team_user_id in place, so the table is
+-- rebuilt. The server does not enforce foreign keys on sqlite, so the rows
+-- referencing reservations are kept as they are.
+CREATE TABLE "subdomain_reservation_new" (
+    "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+    "subdomain" TEXT NOT NULL,
+    "team_id" INTEGER NOT NULL REFERENCES "team" ("id") ON DELETE CASCADE,
+    "team_user_id" INTEGER REFERENCES "team_users" ("id") ON DELETE CASCADE,
+    "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO "subdomain_reservation_new" ("id", "subdomain", "team_id", "team_user_id", "created_at")
+SELECT "subdomain_reservation"."id", "subdomain_reservation"."subdomain", "team_users"."team_id",
+       "subdomain_reservation"."team_user_id", "subdomain_reservation"."created_at"
+FROM "subdomain_reservation"
+JOIN "team_users" ON "team_users"."id" = "subdomain_reservation"."team_user_id";
+
+DROP TABLE "subdomain_reservation";
+
+ALTER TABLE "subdomain_reservation_new" RENAME TO "subdomain_reservation";
+
+CREATE UNIQUE INDEX "idx_subdomain_reservation_name_unique"
+ON "subdomain_reservation" (LOWER("subdomain"));
+
+CREATE INDEX "idx_subdomain_reservation_team_user"
+ON "subdomain_reservation" ("team_user_id");
+
+CREATE INDEX "idx_subdomain_reservation_team"
+ON "subdomain_reservation" ("team_id");
+
+CREATE TABLE "subdomain_reservation_member" (
+    "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+    "reservation_id" INTEGER NOT NULL REFERENCES "subdomain_reservation" ("id") ON DELETE CASCADE,
+    "team_user_id" INTEGER NOT NULL REFERENCES "team_users" ("id") ON DELETE CASCADE,
+    "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX "idx_subdomain_reservation_member_unique"
+ON "subdomain_reservation_member" ("reservation_id", "team_user_id");
+
+CREATE INDEX "idx_subdomain_reservation_member_team_user"
+ON "subdomain_reservation_member" ("team_user_id");
+
+-- +goose Down
+DROP TABLE IF EXISTS "subdomain_reservation_member";
+
+CREATE TABLE "subdomain_reservation_old" (
+    "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+    "subdomain" TEXT NOT NULL,
+    "team_user_id" INTEGER NOT NULL REFERENCES "team_users" ("id") ON DELETE CASCADE,
+    "created_at" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO "subdomain_reservation_old" ("id", "subdomain", "team_user_id", "created_at")
+SELECT "id", "subdomain", "team_user_id", "created_at"
+FROM "subdomain_reservation"
+WHERE "team_user_id" IS NOT NULL;
+
+DROP TABLE "subdomain_reservation";
+
+ALTER TABLE "subdomain_reservation_old" RENAME TO "subdomain_reservation";
+
+CREATE UNIQUE INDEX "idx_subdomain_reservation_name_unique"
+ON "subdomain_reservation" (LOWER("subdomain"));
+
+CREATE INDEX "idx_subdomain_reservation_team_user"
+ON "subdomain_reservation" ("team_user_id");
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE "tunnel_credential" ADD COLUMN "revoked_at" DATETIME;
+
+-- +goose Down
+ALTER TABLE "tunnel_credential" DROP COLUMN "revoked_at";
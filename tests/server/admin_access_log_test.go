@@ -0,0 +1,109 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+)
+
+func TestAccessLogsSavePruneAndQueryPerConnection(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	owner := CreateTestUser(t, db, "access-owner@example.com", false)
+	team, ownerTeamUser := CreateTeamAndTeamUser(t, db, "Access Team", owner, models.RoleAdmin)
+	outsider := CreateTestUser(t, db, "access-outsider@example.com", false)
+	otherTeam, outsiderTeamUser := CreateTeamAndTeamUser(t, db, "Other Access Team", outsider, models.RoleAdmin)
+	ownerSession := CreateSessionForUser(t, db, owner)
+	outsiderSession := CreateSessionForUser(t, db, outsider)
+
+	subdomain := "audited"
+	connection := models.NewConnection(models.ConnectionTypeHTTP, &subdomain, ownerTeamUser)
+	otherSubdomain := "elsewhere"
+	otherConnection := models.NewConnection(models.ConnectionTypeHTTP, &otherSubdomain, outsiderTeamUser)
+	for _, c := range []*models.Connection{connection, otherConnection} {
+		if err := db.Create(c).Error; err != nil {
+			t.Fatalf("create connection: %v", err)
+		}
+	}
+
+	now := time.Now().UTC()
+	accessLogs := services.NewAccessLogService(db)
+	err := accessLogs.Save(context.Background(), []models.AccessLog{
+		{ConnectionID: connection.ID, Subdomain: subdomain, Method: "GET", Path: "/old", Status: 200, VisitorIP: "203.0.113.1", CreatedAt: now.Add(-48 * time.Hour)},
+		{ConnectionID: connection.ID, RequestID: "req-orders", Subdomain: subdomain, Method: "POST", Path: "/orders", Status: 201, LatencyMs: 12, BytesIn: 20, BytesOut: 40, VisitorIP: "203.0.113.2", CreatedAt: now.Add(-time.Minute)},
+		{ConnectionID: connection.ID, Subdomain: subdomain, Method: "GET", Path: "/orders/1", Status: 404, VisitorIP: "203.0.113.3", CreatedAt: now},
+		{ConnectionID: otherConnection.ID, RequestID: "req-orders", Subdomain: otherSubdomain, Method: "GET", Path: "/", Status: 200, VisitorIP: "203.0.113.4", CreatedAt: now},
+		{ConnectionID: "gone", Subdomain: "gone", Method: "GET", Path: "/", Status: 200, CreatedAt: now},
+	})
+	if err != nil {
+		t.Fatalf("save access logs: %v", err)
+	}
+	var stored int64
+	db.Model(&models.AccessLog{}).Count(&stored)
+	if stored != 4 {
+		t.Fatalf("expected entries of unknown connections to be dropped, got %d stored", stored)
+	}
+
+	deleted, err := accessLogs.Prune(context.Background(), now.Add(-24*time.Hour))
+	if err != nil || deleted != 1 {
+		t.Fatalf("expected one entry past retention to be pruned, got %d %v", deleted, err)
+	}
+
+	response := reservedSubdomainRequest(t, srv, ownerSession, team.Slug, http.MethodGet, "/api/v1/connections/"+connection.ID+"/access-logs?page_size=1", nil)
+	defer response.Body.Close()
+	var body struct {
+		Count int64 `json:"count"`
+		Data  []struct {
+			Owner     string `json:"owner"`
+			Method    string `json:"method"`
+			Path      string `json:"path"`
+			Status    int    `json:"status"`
+			VisitorIP string `json:"visitor_ip"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if response.StatusCode != http.StatusOK || body.Count != 2 || len(body.Data) != 1 {
+		t.Fatalf("expected the first page of two entries, got %d %+v", response.StatusCode, body)
+	}
+	if entry := body.Data[0]; entry.Path != "/orders/1" || entry.Status != 404 || entry.Owner != owner.Email || entry.VisitorIP != "203.0.113.3" {
+		t.Fatalf("expected the newest entry with its owner, got %+v", entry)
+	}
+
+	foreign := reservedSubdomainRequest(t, srv, outsiderSession, otherTeam.Slug, http.MethodGet, "/api/v1/connections/"+connection.ID+"/access-logs", nil)
+	foreign.Body.Close()
+	if foreign.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected another team's connection to be hidden, got %d", foreign.StatusCode)
+	}
+
+	search := reservedSubdomainRequest(t, srv, ownerSession, team.Slug, http.MethodGet, "/api/v1/access-logs?request_id=req-orders", nil)
+	defer search.Body.Close()
+	var found struct {
+		Count int `json:"count"`
+		Data  []struct {
+			ConnectionID string `json:"connection_id"`
+			RequestID    string `json:"request_id"`
+			Path         string `json:"path"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(search.Body).Decode(&found); err != nil {
+		t.Fatalf("decode search: %v", err)
+	}
+	if found.Count != 1 || found.Data[0].ConnectionID != connection.ID || found.Data[0].Path != "/orders" || found.Data[0].RequestID != "req-orders" {
+		t.Fatalf("expected only the team's request with the ID, got %+v", found)
+	}
+
+	invalid := reservedSubdomainRequest(t, srv, ownerSession, team.Slug, http.MethodGet, "/api/v1/access-logs?request_id=", nil)
+	invalid.Body.Close()
+	if invalid.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected a missing request ID to be rejected, got %d", invalid.StatusCode)
+	}
+}
@@ -0,0 +1,240 @@
+package server_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	serverAdmin "github.com/amalshaji/portr/internal/server/admin"
+	"github.com/amalshaji/portr/internal/server/admin/models"
+)
+
+type createdAPIToken struct {
+	ID     uint     `json:"id"`
+	Prefix string   `json:"prefix"`
+	Scopes []string `json:"scopes"`
+	Token  string   `json:"token"`
+}
+
+func createAPIToken(t *testing.T, srv *serverAdmin.Server, session *models.Session, teamSlug string, payload map[string]any) createdAPIToken {
+	t.Helper()
+	resp := reservedSubdomainRequest(t, srv, session, teamSlug, http.MethodPost, "/api/v1/api-tokens/", payload)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create api token: expected 201, got %d: %s", resp.StatusCode, readBody(t, resp))
+	}
+	var token createdAPIToken
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return token
+}
+
+func tokenRequest(t *testing.T, srv *serverAdmin.Server, token, method, path string, body io.Reader) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, body)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp := DoRequest(t, srv, req)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestAPITokens_Scopes(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	admin := CreateTestUser(t, db, "token-admin@example.com", false)
+	team, _ := CreateTeamAndTeamUser(t, db, "Token Team", admin, models.RoleAdmin)
+	member := CreateTestUser(t, db, "token-member@example.com", false)
+	createTeamMembership(t, db, member, team, models.RoleMember)
+	adminSession := CreateSessionForUser(t, db, admin)
+	memberSession := CreateSessionForUser(t, db, member)
+
+	reader := createAPIToken(t, srv, memberSession, team.Slug, map[string]any{
+		"name":   "dashboards",
+		"scopes": []string{models.APITokenScopeConnectionsRead},
+	})
+	if !strings.HasPrefix(reader.Token, models.APITokenPrefix) || !strings.HasPrefix(reader.Token, reader.Prefix) {
+		t.Fatalf("unexpected token %q with prefix %q", reader.Token, reader.Prefix)
+	}
+	var stored models.APIToken
+	if err := db.First(&stored, reader.ID).Error; err != nil {
+		t.Fatalf("load token: %v", err)
+	}
+	if stored.TokenHash != models.HashAPIToken(reader.Token) || strings.Contains(stored.TokenHash, reader.Token) {
+		t.Fatalf("expected only the token's hash to be stored, got %q", stored.TokenHash)
+	}
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		status int
+	}{
+		{"scoped route", http.MethodGet, "/api/v1/connections/", http.StatusOK},
+		{"route of another scope", http.MethodGet, "/api/v1/reserved-subdomains/", http.StatusForbidden},
+		{"route without tokens", http.MethodGet, "/api/v1/user/me", http.StatusUnauthorized},
+		{"token management", http.MethodGet, "/api/v1/api-tokens/", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if status := tokenRequest(t, srv, reader.Token, tc.method, tc.path, nil); status != tc.status {
+				t.Fatalf("expected %d, got %d", tc.status, status)
+			}
+		})
+	}
+	if err := db.First(&stored, reader.ID).Error; err != nil {
+		t.Fatalf("reload token: %v", err)
+	}
+	if stored.LastUsedAt == nil {
+		t.Fatal("expected the token's last use to be recorded")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/connections/", nil)
+	req.Header.Set("Authorization", "Bearer "+reader.Token)
+	req.Header.Set("X-Team-Slug", "another-team")
+	resp := DoRequest(t, srv, req)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected a token sent with another team's slug to be forbidden, got %d", resp.StatusCode)
+	}
+
+	resp = reservedSubdomainRequest(t, srv, memberSession, team.Slug, http.MethodPost, "/api/v1/api-tokens/", map[string]any{
+		"name":   "provisioning",
+		"scopes": []string{models.APITokenScopeUsersManage},
+	})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected members to be refused admin scopes, got %d", resp.StatusCode)
+	}
+
+	provisioner := createAPIToken(t, srv, adminSession, team.Slug, map[string]any{
+		"name":            "provisioning",
+		"scopes":          []string{models.APITokenScopeUsersManage},
+		"expires_in_days": 30,
+	})
+	body := `{"email":"token-new@example.com","team_slug":"` + team.Slug + `","role":"member"}`
+	if status := tokenRequest(t, srv, provisioner.Token, http.MethodPost, "/api/v1/admin/users", strings.NewReader(body)); status != http.StatusOK {
+		t.Fatalf("expected the token to add a user, got %d", status)
+	}
+	if status := tokenRequest(t, srv, provisioner.Token, http.MethodGet, "/api/v1/team/users", nil); status != http.StatusOK {
+		t.Fatalf("expected the token to list team users, got %d", status)
+	}
+
+	var entry models.AuditLog
+	if err := db.Where("action = ?", models.AuditActionTeamUserAdded).First(&entry).Error; err != nil {
+		t.Fatalf("load audit log entry: %v", err)
+	}
+	if entry.ActorEmail != admin.Email || !strings.Contains(entry.Detail, provisioner.Prefix) {
+		t.Fatalf("expected the audit log to name the token's owner and the token, got %+v", entry)
+	}
+}
+
+func TestAPITokens_RevokeAndExpire(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	user := CreateTestUser(t, db, "token-revoke@example.com", false)
+	team, _ := CreateTeamAndTeamUser(t, db, "Token Revoke Team", user, models.RoleMember)
+	session := CreateSessionForUser(t, db, user)
+
+	token := createAPIToken(t, srv, session, team.Slug, map[string]any{
+		"name":   "ci",
+		"scopes": []string{models.APITokenScopeReservationsManage},
+	})
+	if status := tokenRequest(t, srv, token.Token, http.MethodGet, "/api/v1/reserved-subdomains/", nil); status != http.StatusOK {
+		t.Fatalf("expected the token to work, got %d", status)
+	}
+
+	revoke := func() int {
+		resp := reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodDelete, "/api/v1/api-tokens/"+strconv.FormatUint(uint64(token.ID), 10), nil)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := revoke(); status != http.StatusNoContent {
+		t.Fatalf("expected revoke to succeed, got %d", status)
+	}
+	if status := revoke(); status != http.StatusNotFound {
+		t.Fatalf("expected a second revoke to be not found, got %d", status)
+	}
+	if status := tokenRequest(t, srv, token.Token, http.MethodGet, "/api/v1/reserved-subdomains/", nil); status != http.StatusUnauthorized {
+		t.Fatalf("expected a revoked token to be refused, got %d", status)
+	}
+
+	expiring := createAPIToken(t, srv, session, team.Slug, map[string]any{
+		"name":            "nightly",
+		"scopes":          []string{models.APITokenScopeReservationsManage},
+		"expires_in_days": 1,
+	})
+	if err := db.Model(&models.APIToken{}).Where("id = ?", expiring.ID).Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatalf("expire token: %v", err)
+	}
+	if status := tokenRequest(t, srv, expiring.Token, http.MethodGet, "/api/v1/reserved-subdomains/", nil); status != http.StatusUnauthorized {
+		t.Fatalf("expected an expired token to be refused, got %d", status)
+	}
+
+	resp := reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodGet, "/api/v1/api-tokens/", nil)
+	listBody := readBody(t, resp)
+	resp.Body.Close()
+	if strings.Contains(listBody, token.Token) || !strings.Contains(listBody, `"revoked_at":"`) {
+		t.Fatalf("expected the list to show the revoked token without its secret, got %s", listBody)
+	}
+}
+
+func TestAPITokens_ReplaceSecretKeysForUserManagement(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	admin := CreateTestUser(t, db, "secret-key-admin@example.com", false)
+	team, adminMembership := CreateTeamAndTeamUser(t, db, "Secret Key Team", admin, models.RoleAdmin)
+	session := CreateSessionForUser(t, db, admin)
+	provisioner := createAPIToken(t, srv, session, team.Slug, map[string]any{
+		"name":   "provisioning",
+		"scopes": []string{models.APITokenScopeUsersManage},
+	})
+	reader := createAPIToken(t, srv, session, team.Slug, map[string]any{
+		"name":   "dashboards",
+		"scopes": []string{models.APITokenScopeConnectionsRead},
+	})
+
+	addUser := func(credential, email string) int {
+		t.Helper()
+		return tokenRequest(t, srv, credential, http.MethodPost, "/api/v1/admin/users", strings.NewReader(`{"email":"`+email+`","team_slug":"`+team.Slug+`","role":"member"}`))
+	}
+	if status := addUser(adminMembership.SecretKey, "by-secret-key@example.com"); status != http.StatusUnauthorized {
+		t.Fatalf("expected a secret key to be refused for user management, got %d", status)
+	}
+	if status := tokenRequest(t, srv, adminMembership.SecretKey, http.MethodGet, "/api/v1/ssh-keys/", nil); status != http.StatusUnauthorized {
+		t.Fatalf("expected a secret key to be refused for SSH key management, got %d", status)
+	}
+	if status := addUser(reader.Token, "by-reader@example.com"); status != http.StatusForbidden {
+		t.Fatalf("expected a token without users:manage to be forbidden, got %d", status)
+	}
+	if status := addUser(provisioner.Token, "by-token@example.com"); status != http.StatusOK {
+		t.Fatalf("expected a users:manage token to add a user, got %d", status)
+	}
+	if status := tokenRequest(t, srv, provisioner.Token, http.MethodGet, "/api/v1/ssh-keys/", nil); status != http.StatusOK {
+		t.Fatalf("expected a users:manage token to manage SSH keys, got %d", status)
+	}
+	resp := reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodPost, "/api/v1/admin/users", map[string]string{"email": "by-session@example.com", "team_slug": team.Slug, "role": "member"})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected a dashboard session to add a user, got %d", resp.StatusCode)
+	}
+
+	legacy := NewSecretKeyAuthTestServer(t, db)
+	if status := tokenRequest(t, legacy, adminMembership.SecretKey, http.MethodPost, "/api/v1/admin/users", strings.NewReader(`{"email":"by-opt-in@example.com","team_slug":"`+team.Slug+`","role":"member"}`)); status != http.StatusOK {
+		t.Fatalf("expected PORTR_ADMIN_SECRET_KEY_AUTH to accept the secret key, got %d", status)
+	}
+}
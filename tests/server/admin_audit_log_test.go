@@ -0,0 +1,232 @@
+package server_test
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+)
+
+type auditLogEntry struct {
+	ActorEmail string                        `json:"actor_email"`
+	Action     string                        `json:"action"`
+	TargetType string                        `json:"target_type"`
+	Target     string                        `json:"target"`
+	IP         string                        `json:"ip"`
+	Diff       map[string]models.AuditChange `json:"diff"`
+	Detail     string                        `json:"detail"`
+}
+
+type auditLogPage struct {
+	Count int64           `json:"count"`
+	Data  []auditLogEntry `json:"data"`
+}
+
+func decodeAuditLogPage(t *testing.T, response *http.Response) auditLogPage {
+	t.Helper()
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", response.StatusCode, readBody(t, response))
+	}
+	var page auditLogPage
+	if err := json.NewDecoder(response.Body).Decode(&page); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return page
+}
+
+func TestAuditLog_RecordsAdministrativeActions(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	admin := CreateTestUser(t, db, "audit-admin@example.com", false)
+	team, _ := CreateTeamAndTeamUser(t, db, "Audit Team", admin, models.RoleAdmin)
+	session := CreateSessionForUser(t, db, admin)
+
+	resp := reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodPost, "/api/v1/team/add", map[string]any{
+		"email": "audit-new@example.com",
+		"role":  models.RoleMember,
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("add user: expected 200, got %d: %s", resp.StatusCode, readBody(t, resp))
+	}
+	resp.Body.Close()
+
+	var added models.TeamUser
+	if err := db.Joins("User").Where("\"User\".email = ?", "audit-new@example.com").First(&added).Error; err != nil {
+		t.Fatalf("load added team user: %v", err)
+	}
+	resp = reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodDelete, "/api/v1/team/users/"+strconv.FormatUint(uint64(added.ID), 10), nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("remove user: expected 200, got %d: %s", resp.StatusCode, readBody(t, resp))
+	}
+	resp.Body.Close()
+
+	resp = reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodPut, "/api/v1/team/visitor-warning", map[string]any{"enabled": true})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("update visitor warning: expected 200, got %d: %s", resp.StatusCode, readBody(t, resp))
+	}
+	resp.Body.Close()
+
+	page := decodeAuditLogPage(t, reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodGet, "/api/v1/audit-logs/", nil))
+	if page.Count != 3 || len(page.Data) != 3 {
+		t.Fatalf("expected 3 entries, got count=%d entries=%+v", page.Count, page.Data)
+	}
+	warning, removed, invited := page.Data[0], page.Data[1], page.Data[2]
+
+	if invited.Action != models.AuditActionTeamUserAdded || invited.Target != "audit-new@example.com" || invited.ActorEmail != admin.Email {
+		t.Fatalf("unexpected invite entry: %+v", invited)
+	}
+	if invited.IP == "" {
+		t.Fatalf("expected the invite entry to record the client IP")
+	}
+	if change, ok := invited.Diff["role"]; !ok || change.From != nil || change.To != models.RoleMember {
+		t.Fatalf("expected the invite diff to record the role, got %+v", invited.Diff)
+	}
+	if removed.Action != models.AuditActionTeamUserRemoved || removed.Target != "audit-new@example.com" || !strings.Contains(removed.Detail, "user deleted") {
+		t.Fatalf("unexpected removal entry: %+v", removed)
+	}
+	if change, ok := warning.Diff["enabled"]; warning.Action != models.AuditActionVisitorWarning || !ok || change.From != false || change.To != true {
+		t.Fatalf("unexpected visitor warning entry: %+v", warning)
+	}
+
+	filtered := decodeAuditLogPage(t, reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodGet, "/api/v1/audit-logs/?action=team_user.&page_size=1&page=2", nil))
+	if filtered.Count != 2 || len(filtered.Data) != 1 || filtered.Data[0].Action != models.AuditActionTeamUserAdded {
+		t.Fatalf("expected the second page of team_user entries to hold the invite, got %+v", filtered)
+	}
+}
+
+func TestAuditLog_RecordsFailedLogins(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	superuser := CreateTestUser(t, db, "audit-super@example.com", true)
+	team, _ := CreateTeamAndTeamUser(t, db, "Audit Login Team", superuser, models.RoleAdmin)
+	session := CreateSessionForUser(t, db, superuser)
+
+	for _, payload := range []string{
+		`{"email":"audit-super@example.com","password":"wrong-password"}`,
+		`{"email":"nobody@example.com","password":"password123"}`,
+		`{"email":"audit-super@example.com","password":"password123"}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		DoRequest(t, srv, req).Body.Close()
+	}
+
+	// Logins are outside any team, so only scope=all shows them.
+	teamPage := decodeAuditLogPage(t, reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodGet, "/api/v1/audit-logs/?action=auth.", nil))
+	if teamPage.Count != 0 {
+		t.Fatalf("expected no login entries in the team scope, got %+v", teamPage.Data)
+	}
+	page := decodeAuditLogPage(t, reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodGet, "/api/v1/audit-logs/?scope=all&action=auth.", nil))
+	if page.Count != 3 {
+		t.Fatalf("expected 3 login entries, got %+v", page.Data)
+	}
+	success, unknown, wrong := page.Data[0], page.Data[1], page.Data[2]
+	if success.Action != models.AuditActionLogin || success.ActorEmail != superuser.Email {
+		t.Fatalf("unexpected login entry: %+v", success)
+	}
+	if unknown.Action != models.AuditActionLoginFailed || unknown.ActorEmail != "nobody@example.com" || unknown.Detail != "unknown user" {
+		t.Fatalf("unexpected unknown user entry: %+v", unknown)
+	}
+	if wrong.Action != models.AuditActionLoginFailed || wrong.ActorEmail != superuser.Email || wrong.Detail != "wrong password" {
+		t.Fatalf("unexpected wrong password entry: %+v", wrong)
+	}
+
+	byActor := decodeAuditLogPage(t, reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodGet, "/api/v1/audit-logs/?scope=all&actor=NOBODY@example.com", nil))
+	if byActor.Count != 1 || byActor.Data[0].Detail != "unknown user" {
+		t.Fatalf("expected the actor filter to match case-insensitively, got %+v", byActor.Data)
+	}
+}
+
+func TestAuditLog_Access(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	admin := CreateTestUser(t, db, "audit-access-admin@example.com", false)
+	team, _ := CreateTeamAndTeamUser(t, db, "Audit Access Team", admin, models.RoleAdmin)
+	member := CreateTestUser(t, db, "audit-access-member@example.com", false)
+	createTeamMembership(t, db, member, team, models.RoleMember)
+	adminSession := CreateSessionForUser(t, db, admin)
+	memberSession := CreateSessionForUser(t, db, member)
+
+	cases := []struct {
+		name    string
+		session *models.Session
+		path    string
+		status  int
+	}{
+		{"member", memberSession, "/api/v1/audit-logs/", http.StatusForbidden},
+		{"admin all teams", adminSession, "/api/v1/audit-logs/?scope=all", http.StatusForbidden},
+		{"bad since", adminSession, "/api/v1/audit-logs/?since=yesterday", http.StatusBadRequest},
+		{"bad format", adminSession, "/api/v1/audit-logs/export?format=xml", http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := reservedSubdomainRequest(t, srv, tc.session, team.Slug, http.MethodGet, tc.path, nil)
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.status {
+				t.Fatalf("expected %d, got %d", tc.status, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestAuditLog_Export(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	admin := CreateTestUser(t, db, "audit-export@example.com", false)
+	team, _ := CreateTeamAndTeamUser(t, db, "Audit Export Team", admin, models.RoleAdmin)
+	session := CreateSessionForUser(t, db, admin)
+
+	resp := reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodPut, "/api/v1/config/template", map[string]any{
+		"template": "tunnels:\n  - name: =cmd\n    subdomain: web\n    port: 3000\n",
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("update template: expected 200, got %d: %s", resp.StatusCode, readBody(t, resp))
+	}
+	resp.Body.Close()
+
+	resp = reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodGet, "/api/v1/audit-logs/export", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("csv export: expected 200, got %d", resp.StatusCode)
+	}
+	if disposition := resp.Header.Get("Content-Disposition"); !strings.Contains(disposition, "audit-log.csv") {
+		t.Fatalf("unexpected content disposition %q", disposition)
+	}
+	records, err := csv.NewReader(strings.NewReader(readBody(t, resp))).ReadAll()
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("parse csv: %v", err)
+	}
+	if len(records) != 2 || records[0][0] != "id" || records[1][5] != models.AuditActionClientTemplateUpdated {
+		t.Fatalf("unexpected csv export: %q", records)
+	}
+
+	resp = reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodGet, "/api/v1/audit-logs/export?format=jsonl", nil)
+	body := readBody(t, resp)
+	resp.Body.Close()
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected one JSON line, got %q", body)
+	}
+	var entry auditLogEntry
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("decode json line: %v", err)
+	}
+	change, ok := entry.Diff["client_template"]
+	if entry.Action != models.AuditActionClientTemplateUpdated || !ok || change.From != "" || !strings.Contains(change.To.(string), "=cmd") {
+		t.Fatalf("unexpected template entry: %+v", entry)
+	}
+}
@@ -0,0 +1,124 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+)
+
+type bandwidthBody struct {
+	Period string `json:"period"`
+	Team   struct {
+		MonthlyBytes int64 `json:"monthly_bytes"`
+		RateBytes    int64 `json:"rate_bytes"`
+		UsedBytes    int64 `json:"used_bytes"`
+	} `json:"team"`
+	Users []struct {
+		TeamUserID   uint   `json:"team_user_id"`
+		Email        string `json:"email"`
+		MonthlyBytes int64  `json:"monthly_bytes"`
+		UsedBytes    int64  `json:"used_bytes"`
+	} `json:"users"`
+}
+
+func decodeBandwidth(t *testing.T, response *http.Response) bandwidthBody {
+	t.Helper()
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", response.StatusCode)
+	}
+	var body bandwidthBody
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return body
+}
+
+func TestBandwidthLimitsAndUsage(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	superuser := CreateTestUser(t, db, "bandwidth-root@example.com", true)
+	team, _ := CreateTeamAndTeamUser(t, db, "Bandwidth Team", superuser, models.RoleAdmin)
+	admin := CreateTestUser(t, db, "bandwidth-admin@example.com", false)
+	createTeamMembership(t, db, admin, team, models.RoleAdmin)
+	member := CreateTestUser(t, db, "bandwidth-member@example.com", false)
+	memberTeamUser := createTeamMembership(t, db, member, team, models.RoleMember)
+	outsider := CreateTestUser(t, db, "bandwidth-outsider@example.com", false)
+	_, outsiderTeamUser := CreateTeamAndTeamUser(t, db, "Other Bandwidth Team", outsider, models.RoleAdmin)
+	superuserSession := CreateSessionForUser(t, db, superuser)
+	adminSession := CreateSessionForUser(t, db, admin)
+	memberSession := CreateSessionForUser(t, db, member)
+
+	bandwidth := services.NewBandwidthService(db)
+	period := models.BandwidthPeriod(time.Now())
+	for range 2 {
+		usage := models.BandwidthUsage{TeamID: team.ID, TeamUserID: memberTeamUser.ID, Period: period, Bytes: 300}
+		if err := bandwidth.RecordUsage(context.Background(), usage); err != nil {
+			t.Fatalf("record usage: %v", err)
+		}
+	}
+	lastMonth := models.BandwidthUsage{TeamID: team.ID, TeamUserID: memberTeamUser.ID, Period: "2000-01", Bytes: 5000}
+	if err := bandwidth.RecordUsage(context.Background(), lastMonth); err != nil {
+		t.Fatalf("record usage: %v", err)
+	}
+
+	status := decodeBandwidth(t, reservedSubdomainRequest(t, srv, memberSession, team.Slug, http.MethodGet, "/api/v1/team/bandwidth", nil))
+	if status.Period != period || status.Team.UsedBytes != 600 || len(status.Users) != 3 {
+		t.Fatalf("expected this month's usage of every member, got %+v", status)
+	}
+
+	limits := map[string]any{"monthly_bytes": 1 << 30, "rate_bytes": 1 << 20}
+	for _, session := range []*models.Session{memberSession, adminSession} {
+		response := reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodPut, "/api/v1/team/bandwidth", limits)
+		response.Body.Close()
+		if response.StatusCode != http.StatusForbidden {
+			t.Fatalf("expected only superusers to set team limits, got %d", response.StatusCode)
+		}
+	}
+	invalid := reservedSubdomainRequest(t, srv, superuserSession, team.Slug, http.MethodPut, "/api/v1/team/bandwidth", map[string]any{"monthly_bytes": -1, "rate_bytes": 0})
+	invalid.Body.Close()
+	if invalid.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected negative limits to be rejected, got %d", invalid.StatusCode)
+	}
+	status = decodeBandwidth(t, reservedSubdomainRequest(t, srv, superuserSession, team.Slug, http.MethodPut, "/api/v1/team/bandwidth", limits))
+	if status.Team.MonthlyBytes != 1<<30 || status.Team.RateBytes != 1<<20 {
+		t.Fatalf("expected the team limits to be saved, got %+v", status.Team)
+	}
+
+	userLimits := map[string]any{"monthly_bytes": 500, "rate_bytes": 0}
+	forbidden := reservedSubdomainRequest(t, srv, memberSession, team.Slug, http.MethodPut, "/api/v1/team/users/1/bandwidth", userLimits)
+	forbidden.Body.Close()
+	if forbidden.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected members to be forbidden, got %d", forbidden.StatusCode)
+	}
+	missing := reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodPut, fmt.Sprintf("/api/v1/team/users/%d/bandwidth", outsiderTeamUser.ID), userLimits)
+	missing.Body.Close()
+	if missing.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected another team's user to be not found, got %d", missing.StatusCode)
+	}
+	status = decodeBandwidth(t, reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodPut, fmt.Sprintf("/api/v1/team/users/%d/bandwidth", memberTeamUser.ID), userLimits))
+	for _, user := range status.Users {
+		if user.TeamUserID == memberTeamUser.ID && (user.MonthlyBytes != 500 || user.UsedBytes != 600) {
+			t.Fatalf("expected the member's limit and usage, got %+v", user)
+		}
+	}
+
+	snapshot, err := bandwidth.Snapshot(context.Background(), time.Now())
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if snapshot.Teams[team.ID].UsedBytes != 600 || snapshot.Users[memberTeamUser.ID].MonthlyBytes != 500 {
+		t.Fatalf("expected the limited team and member in the snapshot, got %+v", snapshot)
+	}
+	if _, ok := snapshot.Users[outsiderTeamUser.ID]; ok {
+		t.Fatal("expected unlimited members to be left out of the snapshot")
+	}
+}
@@ -0,0 +1,88 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+)
+
+func TestCachePurgeRequiresAdminOfTheOwningTeam(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	admin := CreateTestUser(t, db, "cache-admin@example.com", false)
+	team, adminTeamUser := CreateTeamAndTeamUser(t, db, "Cache Team", admin, models.RoleAdmin)
+	member := CreateTestUser(t, db, "cache-member@example.com", false)
+	memberTeamUser := createTeamMembership(t, db, member, team, models.RoleMember)
+	outsider := CreateTestUser(t, db, "cache-outsider@example.com", false)
+	_, outsiderTeamUser := CreateTeamAndTeamUser(t, db, "Other Cache Team", outsider, models.RoleAdmin)
+	adminSession := CreateSessionForUser(t, db, admin)
+	memberSession := CreateSessionForUser(t, db, member)
+
+	if err := db.Create(&models.SubdomainReservation{Subdomain: "docs", TeamID: adminTeamUser.TeamID, TeamUserID: &adminTeamUser.ID}).Error; err != nil {
+		t.Fatalf("create reservation: %v", err)
+	}
+	staticSubdomain := "static-site"
+	if err := db.Create(models.NewConnection(models.ConnectionTypeHTTP, &staticSubdomain, memberTeamUser)).Error; err != nil {
+		t.Fatalf("create connection: %v", err)
+	}
+	otherSubdomain := "elsewhere"
+	if err := db.Create(models.NewConnection(models.ConnectionTypeHTTP, &otherSubdomain, outsiderTeamUser)).Error; err != nil {
+		t.Fatalf("create connection: %v", err)
+	}
+
+	forbidden := reservedSubdomainRequest(t, srv, memberSession, team.Slug, http.MethodPost, "/api/v1/cache/purge", map[string]any{"subdomain": "docs"})
+	forbidden.Body.Close()
+	if forbidden.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected members to be forbidden, got %d", forbidden.StatusCode)
+	}
+
+	for subdomain, status := range map[string]int{
+		"elsewhere": http.StatusNotFound,
+		"unused":    http.StatusNotFound,
+		"":          http.StatusNotFound,
+	} {
+		response := reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodPost, "/api/v1/cache/purge", map[string]any{"subdomain": subdomain})
+		response.Body.Close()
+		if response.StatusCode != status {
+			t.Fatalf("expected %d purging %q, got %d", status, subdomain, response.StatusCode)
+		}
+	}
+
+	for _, subdomain := range []string{"DOCS", "static-site"} {
+		response := reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodPost, "/api/v1/cache/purge", map[string]any{"subdomain": subdomain})
+		var body struct {
+			Subdomain string `json:"subdomain"`
+		}
+		if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusAccepted {
+			t.Fatalf("expected the purge of %s to be accepted, got %d", subdomain, response.StatusCode)
+		}
+		if body.Subdomain == "DOCS" {
+			t.Fatalf("expected the subdomain to be normalized, got %q", body.Subdomain)
+		}
+	}
+
+	cache := services.NewCacheService(db)
+	purges, err := cache.PurgesAfter(context.Background(), 0)
+	if err != nil || len(purges) != 2 || purges[0].Subdomain != "docs" || purges[1].Subdomain != "static-site" {
+		t.Fatalf("expected both purges in order, got %+v %v", purges, err)
+	}
+	if later, _ := cache.PurgesAfter(context.Background(), purges[0].ID); len(later) != 1 {
+		t.Fatalf("expected only the purges after the first, got %+v", later)
+	}
+
+	db.Model(&models.CachePurge{}).Where("id = ?", purges[0].ID).Update("created_at", time.Now().Add(-48*time.Hour))
+	if deleted, err := cache.Prune(context.Background(), time.Now().Add(-24*time.Hour)); err != nil || deleted != 1 {
+		t.Fatalf("expected the old purge to be pruned, got %d %v", deleted, err)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/amalshaji/portr/internal/server/admin/models"
+	serverConfig "github.com/amalshaji/portr/internal/server/config"
 )
 
 func TestDownloadConfig_ValidSecretKeyReturnsConfig(t *testing.T) {
@@ -393,3 +394,64 @@ func TestGetStats_WithTeamUser_ReturnsTeamAndSystemStats(t *testing.T) {
 		t.Fatalf("expected 'system_stats' in response, got: %v", body)
 	}
 }
+
+func TestReloadConfig_SuperuserReceivesReport(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+
+	srv := NewTestServer(t, db)
+	srv.SetConfigReloader(func() (serverConfig.ReloadReport, error) {
+		return serverConfig.ReloadReport{
+			Applied:         []string{"PORTR_RESERVED_SUBDOMAIN_LIMIT"},
+			RequiresRestart: []string{"PORTR_SSH_PORT"},
+		}, nil
+	})
+
+	user := CreateTestUser(t, db, "reload-super@example.com", true)
+	sess := CreateSessionForUser(t, db, user)
+
+	req := httptest.NewRequest("POST", "/api/v1/config/reload", nil)
+	req.Header.Set("Cookie", SessionCookieValue(sess))
+
+	resp := DoRequest(t, srv, req)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200 OK, got %d", resp.StatusCode)
+	}
+
+	var report serverConfig.ReloadReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatalf("failed to decode response body: %v", err)
+	}
+	if len(report.Applied) != 1 || report.Applied[0] != "PORTR_RESERVED_SUBDOMAIN_LIMIT" {
+		t.Fatalf("unexpected applied settings: %v", report.Applied)
+	}
+	if len(report.RequiresRestart) != 1 || report.RequiresRestart[0] != "PORTR_SSH_PORT" {
+		t.Fatalf("unexpected restart settings: %v", report.RequiresRestart)
+	}
+}
+
+func TestReloadConfig_NonSuperuserForbidden(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+
+	srv := NewTestServer(t, db)
+	srv.SetConfigReloader(func() (serverConfig.ReloadReport, error) {
+		t.Fatal("reload should not run for non-superusers")
+		return serverConfig.ReloadReport{}, nil
+	})
+
+	user := CreateTestUser(t, db, "reload-member@example.com", false)
+	sess := CreateSessionForUser(t, db, user)
+
+	req := httptest.NewRequest("POST", "/api/v1/config/reload", nil)
+	req.Header.Set("Cookie", SessionCookieValue(sess))
+
+	resp := DoRequest(t, srv, req)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected status 403 Forbidden, got %d", resp.StatusCode)
+	}
+}
@@ -586,3 +586,62 @@ func TestGetConnections_Pagination(t *testing.T) {
 		t.Fatalf("expected 5 items on second page, got %d", len(data2))
 	}
 }
+
+func TestCloseConnection(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	admin := CreateTestUser(t, db, "close-admin@example.com", false)
+	team, _ := CreateTeamAndTeamUser(t, db, "Close Team", admin, models.RoleAdmin)
+	owner := CreateTestUser(t, db, "close-owner@example.com", false)
+	ownerTeamUser := createTeamMembership(t, db, owner, team, models.RoleMember)
+	member := CreateTestUser(t, db, "close-member@example.com", false)
+	createTeamMembership(t, db, member, team, models.RoleMember)
+	outsider := CreateTestUser(t, db, "close-outsider@example.com", false)
+	otherTeam, _ := CreateTeamAndTeamUser(t, db, "Other Close Team", outsider, models.RoleAdmin)
+	adminSession := CreateSessionForUser(t, db, admin)
+	ownerSession := CreateSessionForUser(t, db, owner)
+	memberSession := CreateSessionForUser(t, db, member)
+	outsiderSession := CreateSessionForUser(t, db, outsider)
+
+	newConnection := func(subdomain string) *models.Connection {
+		conn := models.NewConnection(models.ConnectionTypeHTTP, &subdomain, ownerTeamUser)
+		conn.Status = models.ConnectionStatusActive
+		if err := db.Create(conn).Error; err != nil {
+			t.Fatalf("failed to create connection in DB: %v", err)
+		}
+		return conn
+	}
+	closeConnection := func(session *models.Session, teamSlug, id string) int {
+		resp := reservedSubdomainRequest(t, srv, session, teamSlug, http.MethodDelete, "/api/v1/connections/"+id, nil)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	first := newConnection("close-first")
+	if status := closeConnection(memberSession, team.Slug, first.ID); status != http.StatusForbidden {
+		t.Fatalf("expected members to be forbidden from closing others' connections, got %d", status)
+	}
+	if status := closeConnection(outsiderSession, otherTeam.Slug, first.ID); status != http.StatusNotFound {
+		t.Fatalf("expected another team's connection to be not found, got %d", status)
+	}
+	if status := closeConnection(ownerSession, team.Slug, first.ID); status != http.StatusNoContent {
+		t.Fatalf("expected the owner to close their connection, got %d", status)
+	}
+	var closed models.Connection
+	if err := db.First(&closed, "id = ?", first.ID).Error; err != nil {
+		t.Fatalf("load connection: %v", err)
+	}
+	if closed.Status != models.ConnectionStatusClosed || closed.ClosedAt == nil || closed.CloseReason == nil || *closed.CloseReason != models.ConnectionCloseReasonForceClosed {
+		t.Fatalf("expected the connection to be force-closed, got status=%q closed_at=%v close_reason=%v", closed.Status, closed.ClosedAt, closed.CloseReason)
+	}
+	if status := closeConnection(adminSession, team.Slug, first.ID); status != http.StatusConflict {
+		t.Fatalf("expected closing a force-closed connection to conflict, got %d", status)
+	}
+
+	second := newConnection("close-second")
+	if status := closeConnection(adminSession, team.Slug, second.ID); status != http.StatusNoContent {
+		t.Fatalf("expected team admins to close any connection, got %d", status)
+	}
+}
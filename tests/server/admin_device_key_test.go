@@ -0,0 +1,211 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	serverAdmin "github.com/amalshaji/portr/internal/server/admin"
+	"github.com/amalshaji/portr/internal/server/admin/models"
+)
+
+type createdDeviceKey struct {
+	ID     uint   `json:"id"`
+	Prefix string `json:"prefix"`
+	Key    string `json:"key"`
+}
+
+func createDeviceKey(t *testing.T, srv *serverAdmin.Server, session *models.Session, teamSlug, name string) createdDeviceKey {
+	t.Helper()
+	resp := reservedSubdomainRequest(t, srv, session, teamSlug, http.MethodPost, "/api/v1/device-keys/", map[string]any{"name": name})
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create device key: expected 201, got %d: %s", resp.StatusCode, readBody(t, resp))
+	}
+	var key createdDeviceKey
+	if err := json.NewDecoder(resp.Body).Decode(&key); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return key
+}
+
+// openTunnel reserves a tcp connection the way the portr client does, and
+// returns the response status and connection id.
+func openTunnel(t *testing.T, srv *serverAdmin.Server, secretKey string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/connections/", strings.NewReader(`{"secret_key":"`+secretKey+`","connection_type":"tcp"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := DoRequest(t, srv, req)
+	defer resp.Body.Close()
+	var body struct {
+		ConnectionID string `json:"connection_id"`
+	}
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+	}
+	return resp.StatusCode, body.ConnectionID
+}
+
+func TestDeviceKeys_OpenTunnelsAndRevoke(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewSecretKeyAuthTestServer(t, db)
+
+	user := CreateTestUser(t, db, "devices@example.com", false)
+	team, teamUser := CreateTeamAndTeamUser(t, db, "Devices Team", user, models.RoleMember)
+	session := CreateSessionForUser(t, db, user)
+
+	laptop := createDeviceKey(t, srv, session, team.Slug, "laptop")
+	ci := createDeviceKey(t, srv, session, team.Slug, "CI")
+	if !strings.HasPrefix(laptop.Key, models.DeviceKeyPrefix) || !strings.HasPrefix(laptop.Key, laptop.Prefix) {
+		t.Fatalf("unexpected key %q with prefix %q", laptop.Key, laptop.Prefix)
+	}
+	var stored models.DeviceKey
+	if err := db.First(&stored, laptop.ID).Error; err != nil {
+		t.Fatalf("load key: %v", err)
+	}
+	if stored.KeyHash != models.HashDeviceKey(laptop.Key) {
+		t.Fatalf("expected only the key's hash to be stored, got %q", stored.KeyHash)
+	}
+
+	status, laptopConnection := openTunnel(t, srv, laptop.Key)
+	if status != http.StatusOK {
+		t.Fatalf("expected the laptop key to open a tunnel, got %d", status)
+	}
+	status, ciConnection := openTunnel(t, srv, ci.Key)
+	if status != http.StatusOK {
+		t.Fatalf("expected the CI key to open a tunnel, got %d", status)
+	}
+	status, legacyConnection := openTunnel(t, srv, teamUser.SecretKey)
+	if status != http.StatusOK {
+		t.Fatalf("expected the secret key to keep working, got %d", status)
+	}
+
+	var connection models.Connection
+	if err := db.First(&connection, "id = ?", laptopConnection).Error; err != nil {
+		t.Fatalf("load connection: %v", err)
+	}
+	if connection.DeviceKeyID == nil || *connection.DeviceKeyID != laptop.ID || connection.CreatedByID != teamUser.ID {
+		t.Fatalf("expected the connection to record the laptop key, got %+v", connection)
+	}
+	if err := db.First(&stored, laptop.ID).Error; err != nil {
+		t.Fatalf("reload key: %v", err)
+	}
+	if stored.LastUsedAt == nil || stored.LastUsedIP == nil || *stored.LastUsedIP == "" {
+		t.Fatalf("expected the key's last use to be recorded, got %+v", stored)
+	}
+
+	// A device key only opens tunnels; it is not a bearer token even where
+	// secret keys are.
+	if status := tokenRequest(t, srv, laptop.Key, http.MethodGet, "/api/v1/ssh-keys/", nil); status != http.StatusUnauthorized {
+		t.Fatalf("expected the key to be refused for SSH key management, got %d", status)
+	}
+	if status := tokenRequest(t, srv, laptop.Key, http.MethodPost, "/api/v1/admin/users", strings.NewReader(`{"email":"intruder@example.com"}`)); status != http.StatusUnauthorized {
+		t.Fatalf("expected the key to be refused for user management, got %d", status)
+	}
+	if status := tokenRequest(t, srv, teamUser.SecretKey, http.MethodGet, "/api/v1/ssh-keys/", nil); status != http.StatusOK {
+		t.Fatalf("expected the secret key to keep working as a bearer token, got %d", status)
+	}
+	resp := configDownload(t, srv, laptop.Key)
+	if !strings.Contains(resp, "secret_key: "+laptop.Key) {
+		t.Fatalf("expected the downloaded config to carry the device key, got %q", resp)
+	}
+
+	db.Model(&models.Connection{}).Where("id IN ?", []string{laptopConnection, ciConnection, legacyConnection}).Update("status", models.ConnectionStatusActive)
+	revoke := reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodDelete, "/api/v1/device-keys/"+strconv.FormatUint(uint64(laptop.ID), 10), nil)
+	revoke.Body.Close()
+	if revoke.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected revoking to succeed, got %d", revoke.StatusCode)
+	}
+
+	if status, _ := openTunnel(t, srv, laptop.Key); status != http.StatusUnauthorized {
+		t.Fatalf("expected the revoked key to be refused, got %d", status)
+	}
+	if status, _ := openTunnel(t, srv, ci.Key); status != http.StatusOK {
+		t.Fatalf("expected the CI key to keep working, got %d", status)
+	}
+	for id, want := range map[string]string{
+		laptopConnection: models.ConnectionStatusClosed,
+		ciConnection:     models.ConnectionStatusActive,
+		legacyConnection: models.ConnectionStatusActive,
+	} {
+		var reloaded models.Connection
+		if err := db.First(&reloaded, "id = ?", id).Error; err != nil {
+			t.Fatalf("load connection: %v", err)
+		}
+		if reloaded.Status != want {
+			t.Fatalf("expected connection %s to be %s, got %s", id, want, reloaded.Status)
+		}
+		if id == laptopConnection && (reloaded.CloseReason == nil || *reloaded.CloseReason != models.ConnectionCloseReasonKeyRevoked) {
+			t.Fatalf("expected the laptop's tunnel to be closed as key_revoked, got %v", reloaded.CloseReason)
+		}
+	}
+
+	again := reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodDelete, "/api/v1/device-keys/"+strconv.FormatUint(uint64(laptop.ID), 10), nil)
+	again.Body.Close()
+	if again.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected revoking twice to be not found, got %d", again.StatusCode)
+	}
+
+	var actions []string
+	db.Model(&models.AuditLog{}).Where("target_type = ?", models.AuditTargetDeviceKey).Order("id").Pluck("action", &actions)
+	if strings.Join(actions, ",") != "device_key.created,device_key.created,device_key.revoked" {
+		t.Fatalf("unexpected audit log actions %v", actions)
+	}
+}
+
+func TestDeviceKeys_ExpiredAndOtherMembersKeys(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	owner := CreateTestUser(t, db, "key-owner@example.com", false)
+	team, _ := CreateTeamAndTeamUser(t, db, "Key Team", owner, models.RoleAdmin)
+	other := CreateTestUser(t, db, "key-other@example.com", false)
+	createTeamMembership(t, db, other, team, models.RoleMember)
+	ownerSession := CreateSessionForUser(t, db, owner)
+	otherSession := CreateSessionForUser(t, db, other)
+
+	key := createDeviceKey(t, srv, ownerSession, team.Slug, "home")
+
+	resp := reservedSubdomainRequest(t, srv, otherSession, team.Slug, http.MethodDelete, "/api/v1/device-keys/"+strconv.FormatUint(uint64(key.ID), 10), nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected another member's key to be not found, got %d", resp.StatusCode)
+	}
+
+	resp = reservedSubdomainRequest(t, srv, ownerSession, team.Slug, http.MethodPost, "/api/v1/device-keys/", map[string]any{"name": " "})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected a key without a name to be refused, got %d", resp.StatusCode)
+	}
+
+	db.Model(&models.DeviceKey{}).Where("id = ?", key.ID).Update("expires_at", time.Now().Add(-time.Minute))
+	if status, _ := openTunnel(t, srv, key.Key); status != http.StatusUnauthorized {
+		t.Fatalf("expected an expired key to be refused, got %d", status)
+	}
+}
+
+func configDownload(t *testing.T, srv *serverAdmin.Server, secretKey string) string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/config/download", strings.NewReader(`{"secret_key":"`+secretKey+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := DoRequest(t, srv, req)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("download config: expected 200, got %d", resp.StatusCode)
+	}
+	var body struct {
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return body.Message
+}
@@ -0,0 +1,117 @@
+package server_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+)
+
+func TestErrorPagesSaveOverrideAndResolve(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	admin := CreateTestUser(t, db, "error-pages-admin@example.com", false)
+	team, _ := CreateTeamAndTeamUser(t, db, "Error Pages Team", admin, models.RoleAdmin)
+	member := CreateTestUser(t, db, "error-pages-member@example.com", false)
+	memberTeamUser := createTeamMembership(t, db, member, team, models.RoleMember)
+	adminSession := CreateSessionForUser(t, db, admin)
+	memberSession := CreateSessionForUser(t, db, member)
+
+	reservation := models.SubdomainReservation{Subdomain: "demo", TeamID: memberTeamUser.TeamID, TeamUserID: &memberTeamUser.ID}
+	if err := db.Create(&reservation).Error; err != nil {
+		t.Fatalf("create reservation: %v", err)
+	}
+	subdomain := "adhoc"
+	connection := models.NewConnection(models.ConnectionTypeHTTP, &subdomain, memberTeamUser)
+	if err := db.Create(connection).Error; err != nil {
+		t.Fatalf("create connection: %v", err)
+	}
+
+	forbidden := reservedSubdomainRequest(t, srv, memberSession, team.Slug, http.MethodPut, "/api/v1/error-pages/connection-lost", map[string]string{
+		"html": "<p>member</p>",
+	})
+	defer forbidden.Body.Close()
+	if forbidden.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected members to be forbidden, got %d", forbidden.StatusCode)
+	}
+
+	invalid := reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodPut, "/api/v1/error-pages/teapot", map[string]string{
+		"html": "<p>teapot</p>",
+	})
+	defer invalid.Body.Close()
+	if invalid.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected unknown kind to be rejected, got %d", invalid.StatusCode)
+	}
+
+	for _, payload := range []map[string]string{
+		{"html": "<p>{{subdomain}} is offline</p>"},
+		{"html": "<p>first draft</p>", "subdomain": "Demo"},
+		{"html": "<p>{{subdomain}} by {{owner}}</p>", "subdomain": "demo"},
+	} {
+		response := reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodPut, "/api/v1/error-pages/connection-lost", payload)
+		body, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200 saving %v, got %d: %s", payload, response.StatusCode, body)
+		}
+	}
+
+	unreserved := reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodPut, "/api/v1/error-pages/connection-lost", map[string]string{
+		"html": "<p>elsewhere</p>", "subdomain": "adhoc",
+	})
+	defer unreserved.Body.Close()
+	if unreserved.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected override for unreserved subdomain to be rejected, got %d", unreserved.StatusCode)
+	}
+
+	list := reservedSubdomainRequest(t, srv, memberSession, team.Slug, http.MethodGet, "/api/v1/error-pages/", nil)
+	defer list.Body.Close()
+	var listed struct {
+		Data []struct {
+			Kind      string  `json:"kind"`
+			Subdomain *string `json:"subdomain"`
+			HTML      string  `json:"html"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(list.Body).Decode(&listed); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	if len(listed.Data) != 2 || listed.Data[0].Subdomain != nil || listed.Data[1].Subdomain == nil || *listed.Data[1].Subdomain != "demo" {
+		t.Fatalf("unexpected pages %+v", listed.Data)
+	}
+
+	pages := services.NewErrorPageService(db)
+	resolved, err := pages.Resolve(t.Context(), models.ErrorPageConnectionLost, "DEMO")
+	if err != nil || resolved == nil {
+		t.Fatalf("resolve override: page=%v err=%v", resolved, err)
+	}
+	if resolved.Body != "<p>{{subdomain}} by {{owner}}</p>" || resolved.Owner != member.Email {
+		t.Fatalf("unexpected override %+v", resolved)
+	}
+	resolved, err = pages.Resolve(t.Context(), models.ErrorPageConnectionLost, "adhoc")
+	if err != nil || resolved == nil || !strings.Contains(resolved.Body, "is offline") {
+		t.Fatalf("expected team page for an unreserved subdomain, got %+v err=%v", resolved, err)
+	}
+	if resolved, err := pages.Resolve(t.Context(), models.ErrorPageUnregisteredSubdomain, "demo"); err != nil || resolved != nil {
+		t.Fatalf("expected no page for an unconfigured kind, got %+v err=%v", resolved, err)
+	}
+	if resolved, err := pages.Resolve(t.Context(), models.ErrorPageConnectionLost, "unknown"); err != nil || resolved != nil {
+		t.Fatalf("expected no page for an unknown subdomain, got %+v err=%v", resolved, err)
+	}
+
+	deleted := reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodDelete, "/api/v1/error-pages/connection-lost?subdomain=demo", nil)
+	defer deleted.Body.Close()
+	if deleted.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", deleted.StatusCode)
+	}
+	resolved, err = pages.Resolve(t.Context(), models.ErrorPageConnectionLost, "demo")
+	if err != nil || resolved == nil || !strings.Contains(resolved.Body, "is offline") {
+		t.Fatalf("expected team page once the override is gone, got %+v err=%v", resolved, err)
+	}
+}
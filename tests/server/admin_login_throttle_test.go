@@ -0,0 +1,168 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	serverAdmin "github.com/amalshaji/portr/internal/server/admin"
+	"github.com/amalshaji/portr/internal/server/admin/models"
+)
+
+func wrongPasswordLogin(t *testing.T, srv *serverAdmin.Server, email string) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader(`{"email":"`+email+`","password":"wrong-password"}`))
+	req.Header.Set("Content-Type", "application/json")
+	return DoRequest(t, srv, req)
+}
+
+func TestLoginLocksOutAfterRepeatedFailures(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	user := CreateTestUser(t, db, "locked@example.com", false)
+	CreateTeamAndTeamUser(t, db, "Locked Team", user, models.RoleMember)
+
+	for attempt := 1; attempt <= 6; attempt++ {
+		if resp := wrongPasswordLogin(t, srv, "Locked@example.com"); resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("attempt %d: expected 400, got %d", attempt, resp.StatusCode)
+		}
+	}
+
+	resp, _ := passwordLogin(t, srv, user.Email)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected a locked out login to get 429, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Retry-After") != "30" {
+		t.Fatalf("expected Retry-After 30, got %q", resp.Header.Get("Retry-After"))
+	}
+	var body map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if body["password"] != "Too many failed attempts. Try again in 30 seconds." {
+		t.Fatalf("unexpected message %q", body["password"])
+	}
+
+	var locks []models.AuditLog
+	db.Where("action = ?", models.AuditActionLoginLocked).Find(&locks)
+	if len(locks) != 1 || locks[0].Target != user.Email || locks[0].Detail != "sign-ins locked out for 30 seconds" {
+		t.Fatalf("expected one lockout in the audit log, got %+v", locks)
+	}
+
+	// Other accounts from the same address are not locked out yet.
+	other := CreateTestUser(t, db, "other@example.com", false)
+	CreateTeamAndTeamUser(t, db, "Other Team", other, models.RoleMember)
+	if resp, _ := passwordLogin(t, srv, other.Email); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected another account to sign in, got %d", resp.StatusCode)
+	}
+}
+
+func TestLoginTellsUserAboutFailedAttempts(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	user := CreateTestUser(t, db, "notice@example.com", false)
+	team, _ := CreateTeamAndTeamUser(t, db, "Notice Team", user, models.RoleMember)
+
+	for range 2 {
+		wrongPasswordLogin(t, srv, user.Email)
+	}
+	resp, _ := passwordLogin(t, srv, user.Email)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected login to succeed, got %d", resp.StatusCode)
+	}
+	var cookie *http.Cookie
+	for _, c := range resp.Cookies() {
+		if c.Name == "portr_session" {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatal("expected a session cookie")
+	}
+
+	currentUser := func() map[string]any {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/user/me", nil)
+		req.Header.Set("X-Team-Slug", team.Slug)
+		req.AddCookie(cookie)
+		resp := DoRequest(t, srv, req)
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200, got %d", resp.StatusCode)
+		}
+		var body map[string]any
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return body
+	}
+
+	if got := currentUser()["failed_logins"]; got != float64(2) {
+		t.Fatalf("expected 2 failed logins, got %v", got)
+	}
+	if got, ok := currentUser()["failed_logins"]; ok {
+		t.Fatalf("expected the notice to be shown once, got %v", got)
+	}
+
+	var reloaded models.User
+	db.First(&reloaded, user.ID)
+	if reloaded.FailedLoginCount != 0 {
+		t.Fatalf("expected the count to start over, got %d", reloaded.FailedLoginCount)
+	}
+}
+
+func TestSecretKeyLookupsAreThrottled(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewSecretKeyAuthTestServer(t, db)
+
+	user := CreateTestUser(t, db, "keys@example.com", false)
+	_, teamUser := CreateTeamAndTeamUser(t, db, "Keys Team", user, models.RoleMember)
+
+	createConnection := func(secretKey string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/connections/", strings.NewReader(`{"secret_key":"`+secretKey+`","connection_type":"tcp"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := DoRequest(t, srv, req)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	listSSHKeys := func(secretKey string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/ssh-keys/", nil)
+		req.Header.Set("Authorization", "Bearer "+secretKey)
+		resp := DoRequest(t, srv, req)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Guesses through either route count against the same address.
+	for attempt := 1; attempt <= 21; attempt++ {
+		var status int
+		if attempt%2 == 0 {
+			status = listSSHKeys("guess")
+		} else {
+			status = createConnection("guess")
+		}
+		if status != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401, got %d", attempt, status)
+		}
+	}
+
+	if status := createConnection(teamUser.SecretKey); status != http.StatusTooManyRequests {
+		t.Fatalf("expected connections to be locked out, got %d", status)
+	}
+	if status := listSSHKeys(teamUser.SecretKey); status != http.StatusTooManyRequests {
+		t.Fatalf("expected secret key auth to be locked out, got %d", status)
+	}
+
+	var locks int64
+	db.Model(&models.AuditLog{}).Where("action = ? AND detail = ?", models.AuditActionLoginLocked, "secret keys locked out for 30 seconds").Count(&locks)
+	if locks != 1 {
+		t.Fatalf("expected one lockout in the audit log, got %d", locks)
+	}
+}
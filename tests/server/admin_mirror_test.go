@@ -0,0 +1,126 @@
+package server_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+)
+
+func TestMirrorRulesCreateListAndDelete(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	admin := CreateTestUser(t, db, "mirrors-admin@example.com", false)
+	team, adminTeamUser := CreateTeamAndTeamUser(t, db, "Mirrors Team", admin, models.RoleAdmin)
+	member := CreateTestUser(t, db, "mirrors-member@example.com", false)
+	memberTeamUser := createTeamMembership(t, db, member, team, models.RoleMember)
+	outsider := CreateTestUser(t, db, "mirrors-outsider@example.com", false)
+	_, outsiderTeamUser := CreateTeamAndTeamUser(t, db, "Other Team", outsider, models.RoleAdmin)
+	adminSession := CreateSessionForUser(t, db, admin)
+	memberSession := CreateSessionForUser(t, db, member)
+
+	for _, reservation := range []models.SubdomainReservation{
+		{Subdomain: "webhooks", TeamID: adminTeamUser.TeamID, TeamUserID: &adminTeamUser.ID},
+		{Subdomain: "webhooks-shadow", TeamID: memberTeamUser.TeamID, TeamUserID: &memberTeamUser.ID},
+		{Subdomain: "elsewhere", TeamID: outsiderTeamUser.TeamID, TeamUserID: &outsiderTeamUser.ID},
+	} {
+		if err := db.Create(&reservation).Error; err != nil {
+			t.Fatalf("create reservation: %v", err)
+		}
+	}
+
+	forbidden := reservedSubdomainRequest(t, srv, memberSession, team.Slug, http.MethodPost, "/api/v1/mirrors/", map[string]any{
+		"source": "webhooks", "target": "webhooks-shadow",
+	})
+	defer forbidden.Body.Close()
+	if forbidden.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected members to be forbidden, got %d", forbidden.StatusCode)
+	}
+
+	for _, tc := range []struct {
+		payload map[string]any
+		status  int
+	}{
+		{map[string]any{"source": "webhooks", "target": "elsewhere"}, http.StatusNotFound},
+		{map[string]any{"source": "webhooks", "target": "WEBHOOKS"}, http.StatusBadRequest},
+		{map[string]any{"source": "webhooks", "target": "webhooks-shadow", "max_body_bytes": 100 << 20}, http.StatusBadRequest},
+	} {
+		response := reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodPost, "/api/v1/mirrors/", tc.payload)
+		response.Body.Close()
+		if response.StatusCode != tc.status {
+			t.Fatalf("expected %d for %v, got %d", tc.status, tc.payload, response.StatusCode)
+		}
+	}
+
+	created := reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodPost, "/api/v1/mirrors/", map[string]any{
+		"source": "Webhooks", "target": "webhooks-shadow",
+	})
+	defer created.Body.Close()
+	if created.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(created.Body)
+		t.Fatalf("expected 201, got %d: %s", created.StatusCode, body)
+	}
+	var rule struct {
+		ID           uint   `json:"id"`
+		Source       string `json:"source"`
+		Target       string `json:"target"`
+		MaxBodyBytes int64  `json:"max_body_bytes"`
+	}
+	if err := json.NewDecoder(created.Body).Decode(&rule); err != nil {
+		t.Fatalf("decode rule: %v", err)
+	}
+	if rule.Source != "webhooks" || rule.Target != "webhooks-shadow" || rule.MaxBodyBytes != services.DefaultMirrorBodyBytes {
+		t.Fatalf("unexpected rule %+v", rule)
+	}
+
+	duplicate := reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodPost, "/api/v1/mirrors/", map[string]any{
+		"source": "webhooks", "target": "webhooks-shadow",
+	})
+	defer duplicate.Body.Close()
+	if duplicate.StatusCode != http.StatusConflict {
+		t.Fatalf("expected a second rule for the source to conflict, got %d", duplicate.StatusCode)
+	}
+
+	mirrors := services.NewMirrorService(db)
+	resolved, err := mirrors.Resolve(t.Context(), "WEBHOOKS")
+	if err != nil || resolved == nil || resolved.ID != rule.ID || resolved.Target != "webhooks-shadow" {
+		t.Fatalf("unexpected resolved rule %+v err=%v", resolved, err)
+	}
+	if err := mirrors.RecordDeliveries(t.Context(), rule.ID, 5, 2); err != nil {
+		t.Fatalf("record deliveries: %v", err)
+	}
+	if err := mirrors.RecordDeliveries(t.Context(), rule.ID, 1, 0); err != nil {
+		t.Fatalf("record deliveries: %v", err)
+	}
+
+	list := reservedSubdomainRequest(t, srv, memberSession, team.Slug, http.MethodGet, "/api/v1/mirrors/", nil)
+	defer list.Body.Close()
+	var listed struct {
+		Data []struct {
+			MirroredCount int64 `json:"mirrored_count"`
+			FailedCount   int64 `json:"failed_count"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(list.Body).Decode(&listed); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	if len(listed.Data) != 1 || listed.Data[0].MirroredCount != 6 || listed.Data[0].FailedCount != 2 {
+		t.Fatalf("unexpected rules %+v", listed.Data)
+	}
+
+	path := fmt.Sprintf("/api/v1/mirrors/%d", rule.ID)
+	deleted := reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodDelete, path, nil)
+	defer deleted.Body.Close()
+	if deleted.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", deleted.StatusCode)
+	}
+	if resolved, err := mirrors.Resolve(t.Context(), "webhooks"); err != nil || resolved != nil {
+		t.Fatalf("expected no rule after delete, got %+v err=%v", resolved, err)
+	}
+}
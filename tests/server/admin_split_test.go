@@ -0,0 +1,120 @@
+package server_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+)
+
+func TestSplitRoutesCreateUpdateAndDelete(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	admin := CreateTestUser(t, db, "splits-admin@example.com", false)
+	team, adminTeamUser := CreateTeamAndTeamUser(t, db, "Splits Team", admin, models.RoleAdmin)
+	member := CreateTestUser(t, db, "splits-member@example.com", false)
+	memberTeamUser := createTeamMembership(t, db, member, team, models.RoleMember)
+	outsider := CreateTestUser(t, db, "splits-outsider@example.com", false)
+	_, outsiderTeamUser := CreateTeamAndTeamUser(t, db, "Other Splits Team", outsider, models.RoleAdmin)
+	adminSession := CreateSessionForUser(t, db, admin)
+	memberSession := CreateSessionForUser(t, db, member)
+
+	for _, reservation := range []models.SubdomainReservation{
+		{Subdomain: "checkout", TeamID: adminTeamUser.TeamID, TeamUserID: &adminTeamUser.ID},
+		{Subdomain: "checkout-main", TeamID: adminTeamUser.TeamID, TeamUserID: &adminTeamUser.ID},
+		{Subdomain: "checkout-branch", TeamID: memberTeamUser.TeamID, TeamUserID: &memberTeamUser.ID},
+		{Subdomain: "checkout-other", TeamID: outsiderTeamUser.TeamID, TeamUserID: &outsiderTeamUser.ID},
+	} {
+		if err := db.Create(&reservation).Error; err != nil {
+			t.Fatalf("create reservation: %v", err)
+		}
+	}
+
+	forbidden := reservedSubdomainRequest(t, srv, memberSession, team.Slug, http.MethodPost, "/api/v1/splits/", map[string]any{
+		"subdomain": "checkout", "primary": "checkout-main", "secondary": "checkout-branch",
+	})
+	defer forbidden.Body.Close()
+	if forbidden.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected members to be forbidden, got %d", forbidden.StatusCode)
+	}
+
+	for _, tc := range []struct {
+		payload map[string]any
+		status  int
+	}{
+		{map[string]any{"subdomain": "checkout", "primary": "checkout-main", "secondary": "checkout-other"}, http.StatusNotFound},
+		{map[string]any{"subdomain": "checkout", "primary": "checkout-main", "secondary": "Checkout-Main"}, http.StatusBadRequest},
+		{map[string]any{"subdomain": "checkout", "primary": "checkout-main", "secondary": "checkout-branch", "primary_weight": 101}, http.StatusBadRequest},
+	} {
+		response := reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodPost, "/api/v1/splits/", tc.payload)
+		response.Body.Close()
+		if response.StatusCode != tc.status {
+			t.Fatalf("expected %d for %v, got %d", tc.status, tc.payload, response.StatusCode)
+		}
+	}
+
+	created := reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodPost, "/api/v1/splits/", map[string]any{
+		"subdomain": "checkout", "primary": "checkout-main", "secondary": "checkout-branch", "sticky": true,
+	})
+	defer created.Body.Close()
+	if created.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(created.Body)
+		t.Fatalf("expected 201, got %d: %s", created.StatusCode, body)
+	}
+	var route struct {
+		ID            uint   `json:"id"`
+		Subdomain     string `json:"subdomain"`
+		PrimaryWeight int    `json:"primary_weight"`
+		Sticky        bool   `json:"sticky"`
+	}
+	if err := json.NewDecoder(created.Body).Decode(&route); err != nil {
+		t.Fatalf("decode route: %v", err)
+	}
+	if route.Subdomain != "checkout" || route.PrimaryWeight != 50 || !route.Sticky {
+		t.Fatalf("unexpected route %+v", route)
+	}
+
+	duplicate := reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodPost, "/api/v1/splits/", map[string]any{
+		"subdomain": "checkout", "primary": "checkout-branch", "secondary": "checkout-main",
+	})
+	defer duplicate.Body.Close()
+	if duplicate.StatusCode != http.StatusConflict {
+		t.Fatalf("expected a second split of the subdomain to conflict, got %d", duplicate.StatusCode)
+	}
+
+	path := fmt.Sprintf("/api/v1/splits/%d", route.ID)
+	updated := reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodPatch, path, map[string]any{"primary_weight": 90})
+	defer updated.Body.Close()
+	if updated.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", updated.StatusCode)
+	}
+
+	routes, err := services.NewSplitService(db).Resolve(t.Context())
+	if err != nil {
+		t.Fatalf("resolve routes: %v", err)
+	}
+	resolved := routes["checkout"]
+	if len(routes) != 1 || resolved.Primary != "checkout-main" || resolved.Secondary != "checkout-branch" || resolved.PrimaryWeight != 90 || !resolved.Sticky {
+		t.Fatalf("unexpected resolved routes %+v", routes)
+	}
+
+	deleted := reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodDelete, path, nil)
+	defer deleted.Body.Close()
+	if deleted.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", deleted.StatusCode)
+	}
+	list := reservedSubdomainRequest(t, srv, memberSession, team.Slug, http.MethodGet, "/api/v1/splits/", nil)
+	defer list.Body.Close()
+	var listed struct {
+		Count int `json:"count"`
+	}
+	if err := json.NewDecoder(list.Body).Decode(&listed); err != nil || listed.Count != 0 {
+		t.Fatalf("expected no routes after delete, got %d err=%v", listed.Count, err)
+	}
+}
@@ -0,0 +1,123 @@
+package server_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestSshKeysAddListAndDelete(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	user := CreateTestUser(t, db, "ssh-keys@example.com", false)
+	team, _ := CreateTeamAndTeamUser(t, db, "SSH Keys Team", user, models.RoleMember)
+	session := CreateSessionForUser(t, db, user)
+
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	sshKey, err := gossh.NewPublicKey(publicKey)
+	if err != nil {
+		t.Fatalf("convert key: %v", err)
+	}
+	authorizedKey := string(gossh.MarshalAuthorizedKey(sshKey))
+
+	response := reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodPost, "/api/v1/ssh-keys/", map[string]string{
+		"public_key": authorizedKey[:len(authorizedKey)-1] + " me@laptop\n",
+	})
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(response.Body)
+		t.Fatalf("expected 201, got %d: %s", response.StatusCode, body)
+	}
+	var created map[string]any
+	if err := json.NewDecoder(response.Body).Decode(&created); err != nil {
+		t.Fatalf("decode create response: %v", err)
+	}
+	if created["name"] != "me@laptop" || created["fingerprint"] != gossh.FingerprintSHA256(sshKey) {
+		t.Fatalf("unexpected create response: %#v", created)
+	}
+
+	duplicate := reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodPost, "/api/v1/ssh-keys/", map[string]string{
+		"name":       "again",
+		"public_key": authorizedKey,
+	})
+	defer duplicate.Body.Close()
+	if duplicate.StatusCode != http.StatusConflict {
+		t.Fatalf("expected duplicate key to conflict, got %d", duplicate.StatusCode)
+	}
+
+	invalid := reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodPost, "/api/v1/ssh-keys/", map[string]string{
+		"public_key": "not a key",
+	})
+	defer invalid.Body.Close()
+	if invalid.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected invalid key to be rejected, got %d", invalid.StatusCode)
+	}
+
+	list := reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodGet, "/api/v1/ssh-keys/", nil)
+	defer list.Body.Close()
+	var body struct {
+		Count int `json:"count"`
+	}
+	if err := json.NewDecoder(list.Body).Decode(&body); err != nil {
+		t.Fatalf("decode list response: %v", err)
+	}
+	if body.Count != 1 {
+		t.Fatalf("expected one key, got %d", body.Count)
+	}
+
+	path := fmt.Sprintf("/api/v1/ssh-keys/%v", created["id"])
+	deleted := reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodDelete, path, nil)
+	defer deleted.Body.Close()
+	if deleted.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", deleted.StatusCode)
+	}
+	missing := reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodDelete, path, nil)
+	defer missing.Body.Close()
+	if missing.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for deleted key, got %d", missing.StatusCode)
+	}
+}
+
+func TestSshKeysAcceptSecretKeyBearerTokenWhenEnabled(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewSecretKeyAuthTestServer(t, db)
+
+	user := CreateTestUser(t, db, "ssh-keys-token@example.com", false)
+	_, teamUser := CreateTeamAndTeamUser(t, db, "SSH Keys Token Team", user, models.RoleMember)
+
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/ssh-keys/", nil)
+	request.Header.Set("Authorization", "Bearer "+teamUser.SecretKey)
+	response, err := srv.App().Test(request, -1)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", response.StatusCode)
+	}
+
+	request = httptest.NewRequest(http.MethodGet, "/api/v1/ssh-keys/", nil)
+	request.Header.Set("Authorization", "Bearer wrong")
+	response, err = srv.App().Test(request, -1)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", response.StatusCode)
+	}
+}
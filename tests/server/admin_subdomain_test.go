@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -209,10 +210,10 @@ func TestReservedSubdomainDatabaseUniquenessIsCaseInsensitive(t *testing.T) {
 
 	user := CreateTestUser(t, db, "reserve-db@example.com", false)
 	_, membership := CreateTeamAndTeamUser(t, db, "Reservation DB Team", user, models.RoleAdmin)
-	if err := db.Create(&models.SubdomainReservation{Subdomain: "Case-Test", TeamUserID: membership.ID}).Error; err != nil {
+	if err := db.Create(&models.SubdomainReservation{Subdomain: "Case-Test", TeamID: membership.TeamID, TeamUserID: &membership.ID}).Error; err != nil {
 		t.Fatalf("create first reservation: %v", err)
 	}
-	if err := db.Create(&models.SubdomainReservation{Subdomain: "case-test", TeamUserID: membership.ID}).Error; err == nil {
+	if err := db.Create(&models.SubdomainReservation{Subdomain: "case-test", TeamID: membership.TeamID, TeamUserID: &membership.ID}).Error; err == nil {
 		t.Fatal("expected case-insensitive duplicate reservation to fail")
 	}
 }
@@ -224,10 +225,17 @@ func TestReservedSubdomainListUsesBoundedQueries(t *testing.T) {
 	user := CreateTestUser(t, db, "reserve-query-count@example.com", false)
 	_, membership := CreateTeamAndTeamUser(t, db, "Reservation Query Team", user, models.RoleAdmin)
 	for _, subdomain := range []string{"query-one", "query-two", "query-three"} {
-		if err := db.Create(&models.SubdomainReservation{Subdomain: subdomain, TeamUserID: membership.ID}).Error; err != nil {
+		if err := db.Create(&models.SubdomainReservation{Subdomain: subdomain, TeamID: membership.TeamID, TeamUserID: &membership.ID}).Error; err != nil {
 			t.Fatalf("create reservation %s: %v", subdomain, err)
 		}
 	}
+	shared := models.SubdomainReservation{Subdomain: "query-shared", TeamID: membership.TeamID}
+	if err := db.Create(&shared).Error; err != nil {
+		t.Fatalf("create team reservation: %v", err)
+	}
+	if err := db.Create(&models.SubdomainReservationMember{ReservationID: shared.ID, TeamUserID: membership.ID}).Error; err != nil {
+		t.Fatalf("allow member: %v", err)
+	}
 	activeSubdomain := "query-two"
 	connection := models.NewConnection(models.ConnectionTypeHTTP, &activeSubdomain, membership)
 	connection.Status = models.ConnectionStatusActive
@@ -244,15 +252,16 @@ func TestReservedSubdomainListUsesBoundedQueries(t *testing.T) {
 	}
 	defer db.Callback().Query().Remove(callbackName)
 
-	items, err := services.NewSubdomainService(db).List(context.Background(), membership.ID)
+	items, err := services.NewSubdomainService(db).List(context.Background(), membership)
 	if err != nil {
 		t.Fatalf("list reservations: %v", err)
 	}
-	if len(items) != 3 {
-		t.Fatalf("expected 3 reservations, got %d", len(items))
+	if len(items) != 4 {
+		t.Fatalf("expected 4 reservations, got %d", len(items))
 	}
-	if queryCount != 2 {
-		t.Fatalf("expected reservation list to use 2 queries, got %d", queryCount)
+	// Reservations, their allowed members with users, and claim statuses.
+	if queryCount != 5 {
+		t.Fatalf("expected reservation list to use 5 queries, got %d", queryCount)
 	}
 }
 
@@ -309,6 +318,241 @@ func TestReservedSubdomainRaceWithConnectionHasSingleWinner(t *testing.T) {
 	}
 }
 
+func TestTeamReservationsTransferAndAllowedMembers(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	admin := CreateTestUser(t, db, "team-reserve-admin@example.com", false)
+	team, adminMembership := CreateTeamAndTeamUser(t, db, "Team Reservation Team", admin, models.RoleAdmin)
+	memberships := make(map[string]*models.TeamUser)
+	sessions := map[string]*models.Session{"admin": CreateSessionForUser(t, db, admin)}
+	for _, name := range []string{"holder", "standin"} {
+		user := CreateTestUser(t, db, "team-reserve-"+name+"@example.com", false)
+		membership := &models.TeamUser{UserID: user.ID, TeamID: team.ID, Role: models.RoleMember}
+		if err := db.Create(membership).Error; err != nil {
+			t.Fatalf("create membership: %v", err)
+		}
+		memberships[name] = membership
+		sessions[name] = CreateSessionForUser(t, db, user)
+	}
+	outsider := CreateTestUser(t, db, "team-reserve-outsider@example.com", false)
+	_, outsiderMembership := CreateTeamAndTeamUser(t, db, "Team Reservation Outsiders", outsider, models.RoleAdmin)
+
+	request := func(session, method, path string, payload any) (int, map[string]any) {
+		t.Helper()
+		response := reservedSubdomainRequest(t, srv, sessions[session], team.Slug, method, path, payload)
+		defer response.Body.Close()
+		var body map[string]any
+		_ = json.NewDecoder(response.Body).Decode(&body)
+		return response.StatusCode, body
+	}
+	claim := func(secretKey string) int {
+		t.Helper()
+		response := createHTTPConnectionRequest(t, srv, secretKey, "api-staging")
+		response.Body.Close()
+		if err := db.Where("1 = 1").Delete(&models.Connection{}).Error; err != nil {
+			t.Fatalf("clear connections: %v", err)
+		}
+		return response.StatusCode
+	}
+
+	if status, _ := request("holder", http.MethodPost, "/api/v1/reserved-subdomains/", map[string]string{"subdomain": "api-staging"}); status != http.StatusCreated {
+		t.Fatalf("expected the holder to reserve, got %d", status)
+	}
+	if status := claim(memberships["standin"].SecretKey); status != http.StatusConflict {
+		t.Fatalf("expected another member to be refused, got %d", status)
+	}
+	if status, _ := request("holder", http.MethodPut, "/api/v1/reserved-subdomains/api-staging/owner", map[string]string{"owner": "team"}); status != http.StatusForbidden {
+		t.Fatalf("expected a member not to transfer, got %d", status)
+	}
+
+	status, body := request("admin", http.MethodPut, "/api/v1/reserved-subdomains/api-staging/owner", map[string]string{"owner": "team"})
+	if status != http.StatusOK || body["owner"] != "team" {
+		t.Fatalf("expected the reservation to move to the team, got %d: %#v", status, body)
+	}
+	if members, _ := body["allowed_members"].([]any); len(members) != 1 || members[0] != "team-reserve-holder@example.com" {
+		t.Fatalf("expected the former holder to stay allowed, got %#v", body["allowed_members"])
+	}
+	if status := claim(memberships["holder"].SecretKey); status != http.StatusOK {
+		t.Fatalf("expected the former holder to claim the team reservation, got %d", status)
+	}
+	if status := claim(memberships["standin"].SecretKey); status != http.StatusConflict {
+		t.Fatalf("expected a member off the list to be refused, got %d", status)
+	}
+
+	status, body = request("admin", http.MethodPut, "/api/v1/reserved-subdomains/api-staging/members", map[string]any{
+		"team_user_ids": []uint{memberships["standin"].ID},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("expected the allowed members to change, got %d: %#v", status, body)
+	}
+	for name, want := range map[string]int{"standin": http.StatusOK, "holder": http.StatusConflict} {
+		if status := claim(memberships[name].SecretKey); status != want {
+			t.Fatalf("expected %s to get %d, got %d", name, want, status)
+		}
+	}
+	if status := claim(adminMembership.SecretKey); status != http.StatusOK {
+		t.Fatalf("expected the team admin to claim the team reservation, got %d", status)
+	}
+	if status := claim(outsiderMembership.SecretKey); status != http.StatusConflict {
+		t.Fatalf("expected another team to be refused, got %d", status)
+	}
+
+	status, body = request("standin", http.MethodGet, "/api/v1/reserved-subdomains/", nil)
+	if data, _ := body["data"].([]any); status != http.StatusOK || len(data) != 1 || data[0].(map[string]any)["can_release"] != false {
+		t.Fatalf("expected the stand-in to see the team reservation, got %d: %#v", status, body)
+	}
+	if status, _ := request("holder", http.MethodGet, "/api/v1/reserved-subdomains/", nil); status != http.StatusOK {
+		t.Fatalf("expected the holder's list to load, got %d", status)
+	}
+	if status, _ := request("standin", http.MethodDelete, "/api/v1/reserved-subdomains/api-staging", nil); status != http.StatusNotFound {
+		t.Fatalf("expected a member not to release a team reservation, got %d", status)
+	}
+	if status, _ := request("admin", http.MethodPut, "/api/v1/reserved-subdomains/api-staging/members", map[string]any{
+		"team_user_ids": []uint{outsiderMembership.ID},
+	}); status != http.StatusBadRequest {
+		t.Fatalf("expected members of other teams to be refused, got %d", status)
+	}
+
+	status, body = request("admin", http.MethodPut, "/api/v1/reserved-subdomains/api-staging/owner", map[string]any{
+		"owner":        "member",
+		"team_user_id": memberships["standin"].ID,
+	})
+	if status != http.StatusOK || body["owner"] != "member" {
+		t.Fatalf("expected the reservation to move to the stand-in, got %d: %#v", status, body)
+	}
+	if status := claim(adminMembership.SecretKey); status != http.StatusConflict {
+		t.Fatalf("expected a member's reservation to refuse the admin, got %d", status)
+	}
+	if status, _ := request("admin", http.MethodPut, "/api/v1/reserved-subdomains/api-staging/members", map[string]any{"team_user_ids": []uint{}}); status != http.StatusConflict {
+		t.Fatalf("expected a member's reservation to have no allowed list, got %d", status)
+	}
+	var members int64
+	db.Model(&models.SubdomainReservationMember{}).Count(&members)
+	if members != 0 {
+		t.Fatalf("expected the allowed list to be dropped, got %d members", members)
+	}
+
+	var entries []models.AuditLog
+	if err := db.Where("target_type = ?", models.AuditTargetSubdomain).Order("id").Find(&entries).Error; err != nil {
+		t.Fatalf("load audit log: %v", err)
+	}
+	if len(entries) != 3 ||
+		entries[0].Detail != "team-reserve-holder@example.com -> team" ||
+		entries[1].Detail != "team-reserve-standin@example.com" ||
+		entries[2].Detail != "team -> team-reserve-standin@example.com" {
+		t.Fatalf("unexpected audit log entries %+v", entries)
+	}
+}
+
+func TestTeamReservationTransferRespectsMemberLimit(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	admin := CreateTestUser(t, db, "transfer-limit-admin@example.com", false)
+	team, _ := CreateTeamAndTeamUser(t, db, "Transfer Limit Team", admin, models.RoleAdmin)
+	member := CreateTestUser(t, db, "transfer-limit-member@example.com", false)
+	membership := &models.TeamUser{UserID: member.ID, TeamID: team.ID, Role: models.RoleMember}
+	if err := db.Create(membership).Error; err != nil {
+		t.Fatalf("create membership: %v", err)
+	}
+	adminSession := CreateSessionForUser(t, db, admin)
+	memberSession := CreateSessionForUser(t, db, member)
+
+	request := func(session *models.Session, method, path string, payload any) (int, map[string]any) {
+		t.Helper()
+		response := reservedSubdomainRequest(t, srv, session, team.Slug, method, path, payload)
+		defer response.Body.Close()
+		var body map[string]any
+		_ = json.NewDecoder(response.Body).Decode(&body)
+		return response.StatusCode, body
+	}
+	for _, subdomain := range []string{"limit-one", "limit-two", "limit-three"} {
+		if status, _ := request(memberSession, http.MethodPost, "/api/v1/reserved-subdomains/", map[string]string{"subdomain": subdomain}); status != http.StatusCreated {
+			t.Fatalf("expected the member to reserve %s, got %d", subdomain, status)
+		}
+	}
+	if status, _ := request(adminSession, http.MethodPost, "/api/v1/reserved-subdomains/", map[string]string{"subdomain": "limit-shared", "owner": "team"}); status != http.StatusCreated {
+		t.Fatalf("expected the admin to reserve for the team, got %d", status)
+	}
+
+	toMember := map[string]any{"owner": "member", "team_user_id": membership.ID}
+	status, body := request(adminSession, http.MethodPut, "/api/v1/reserved-subdomains/limit-shared/owner", toMember)
+	if status != http.StatusConflict || body["code"] != "reservation_limit_reached" {
+		t.Fatalf("expected a member at their limit to be refused, got %d: %#v", status, body)
+	}
+	var reservation models.SubdomainReservation
+	if err := db.First(&reservation, "subdomain = ?", "limit-shared").Error; err != nil {
+		t.Fatalf("load reservation: %v", err)
+	}
+	if !reservation.TeamOwned() {
+		t.Fatalf("expected the reservation to stay with the team, got %+v", reservation)
+	}
+	if status, _ := request(adminSession, http.MethodPut, "/api/v1/reserved-subdomains/limit-one/owner", toMember); status != http.StatusOK {
+		t.Fatalf("expected moving a member's reservation to themselves not to count twice, got %d", status)
+	}
+
+	if status, _ := request(memberSession, http.MethodDelete, "/api/v1/reserved-subdomains/limit-three", nil); status != http.StatusNoContent {
+		t.Fatalf("expected the member to release a reservation, got %d", status)
+	}
+	if status, body := request(adminSession, http.MethodPut, "/api/v1/reserved-subdomains/limit-shared/owner", toMember); status != http.StatusOK || body["owner"] != "member" {
+		t.Fatalf("expected the reservation to move once the member is under their limit, got %d: %#v", status, body)
+	}
+}
+
+func TestTeamReservationsAreReservedByAdminsAndOutliveMembers(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	admin := CreateTestUser(t, db, "team-owned-admin@example.com", false)
+	team, _ := CreateTeamAndTeamUser(t, db, "Team Owned Team", admin, models.RoleAdmin)
+	member := CreateTestUser(t, db, "team-owned-member@example.com", false)
+	membership := &models.TeamUser{UserID: member.ID, TeamID: team.ID, Role: models.RoleMember}
+	if err := db.Create(membership).Error; err != nil {
+		t.Fatalf("create membership: %v", err)
+	}
+	adminSession := CreateSessionForUser(t, db, admin)
+	memberSession := CreateSessionForUser(t, db, member)
+
+	denied := reservedSubdomainRequest(t, srv, memberSession, team.Slug, http.MethodPost, "/api/v1/reserved-subdomains/", map[string]string{"subdomain": "shared", "owner": "team"})
+	denied.Body.Close()
+	if denied.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected a member not to reserve for the team, got %d", denied.StatusCode)
+	}
+	created := reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodPost, "/api/v1/reserved-subdomains/", map[string]string{"subdomain": "shared", "owner": "team"})
+	defer created.Body.Close()
+	var body map[string]any
+	if err := json.NewDecoder(created.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if created.StatusCode != http.StatusCreated || body["owner"] != "team" {
+		t.Fatalf("expected a team reservation, got %d: %#v", created.StatusCode, body)
+	}
+
+	var reservation models.SubdomainReservation
+	if err := db.Where("subdomain = ?", "shared").First(&reservation).Error; err != nil {
+		t.Fatalf("load reservation: %v", err)
+	}
+	if err := db.Create(&models.SubdomainReservationMember{ReservationID: reservation.ID, TeamUserID: membership.ID}).Error; err != nil {
+		t.Fatalf("allow member: %v", err)
+	}
+	removed := reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodDelete, fmt.Sprintf("/api/v1/team/users/%d", membership.ID), nil)
+	removed.Body.Close()
+	if removed.StatusCode != http.StatusOK && removed.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected the member to be removed, got %d", removed.StatusCode)
+	}
+
+	var remaining, members int64
+	db.Model(&models.SubdomainReservation{}).Where("id = ?", reservation.ID).Count(&remaining)
+	db.Model(&models.SubdomainReservationMember{}).Count(&members)
+	if remaining != 1 || members != 0 {
+		t.Fatalf("expected the team reservation to stay without the removed member, got %d reservations and %d members", remaining, members)
+	}
+}
+
 func reservedSubdomainRequest(t *testing.T, srv interface{ App() *fiber.App }, session *models.Session, teamSlug, method, path string, payload any) *http.Response {
 	t.Helper()
 	var body io.Reader
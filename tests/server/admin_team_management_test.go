@@ -0,0 +1,248 @@
+package server_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"gorm.io/gorm"
+)
+
+// memberWithTunnel gives a team user an active tunnel, a reserved subdomain,
+// an SSH key and an API token, and returns the tunnel's connection.
+func memberWithTunnel(t *testing.T, db *gorm.DB, teamUser *models.TeamUser, subdomain string) *models.Connection {
+	t.Helper()
+	connection := models.NewConnection(models.ConnectionTypeHTTP, &subdomain, teamUser)
+	connection.Status = models.ConnectionStatusActive
+	for _, row := range []any{
+		connection,
+		&models.SubdomainReservation{Subdomain: subdomain, TeamID: teamUser.TeamID, TeamUserID: &teamUser.ID},
+		&models.SshKey{TeamUserID: teamUser.ID, Name: "laptop", PublicKey: "ssh-ed25519 AAAA", Fingerprint: "SHA256:" + subdomain},
+		&models.APIToken{TeamUserID: teamUser.ID, Name: "ci", Prefix: "portr_pat_" + subdomain, TokenHash: subdomain, Scopes: models.APITokenScopeConnectionsRead},
+	} {
+		if err := db.Create(row).Error; err != nil {
+			t.Fatalf("create %T: %v", row, err)
+		}
+	}
+	return connection
+}
+
+// assertMemberRemoved checks that a removed team user's tunnel was closed
+// and their reservations, SSH keys, API tokens and device keys deleted.
+func assertMemberRemoved(t *testing.T, db *gorm.DB, teamUser *models.TeamUser, connection *models.Connection) {
+	t.Helper()
+	var reloaded models.Connection
+	if err := db.First(&reloaded, "id = ?", connection.ID).Error; err != nil {
+		t.Fatalf("load connection: %v", err)
+	}
+	if reloaded.Status != models.ConnectionStatusClosed || reloaded.CloseReason == nil || *reloaded.CloseReason != models.ConnectionCloseReasonMemberRemoved {
+		t.Fatalf("expected the tunnel to be closed as member_removed, got status=%q reason=%v", reloaded.Status, reloaded.CloseReason)
+	}
+	for _, model := range []any{&models.TeamUser{}, &models.SubdomainReservation{}, &models.SshKey{}, &models.APIToken{}, &models.DeviceKey{}} {
+		column := "team_user_id"
+		if _, ok := model.(*models.TeamUser); ok {
+			column = "id"
+		}
+		var count int64
+		if err := db.Model(model).Where(column+" = ?", teamUser.ID).Count(&count).Error; err != nil {
+			t.Fatalf("count %T: %v", model, err)
+		}
+		if count != 0 {
+			t.Fatalf("expected the removed member's %T rows to be deleted, found %d", model, count)
+		}
+	}
+}
+
+func TestTeamManagement_RenameAndDelete(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	superuser := CreateTestUser(t, db, "teams-super@example.com", true)
+	defaultTeam, _ := CreateTeamAndTeamUser(t, db, "Default Team", superuser, models.RoleAdmin)
+	team, _ := CreateTeamAndTeamUser(t, db, "Rename Team", superuser, models.RoleAdmin)
+	CreateTeamAndTeamUser(t, db, "Taken Team", superuser, models.RoleAdmin)
+	session := CreateSessionForUser(t, db, superuser)
+
+	cases := []struct {
+		name    string
+		slug    string
+		payload map[string]any
+		status  int
+	}{
+		{"invalid slug", team.Slug, map[string]any{"name": "Renamed", "slug": "Not A Slug"}, http.StatusBadRequest},
+		{"missing name", team.Slug, map[string]any{"slug": "renamed"}, http.StatusBadRequest},
+		{"taken name", team.Slug, map[string]any{"name": "taken team"}, http.StatusConflict},
+		{"default team slug", defaultTeam.Slug, map[string]any{"name": "Default Team", "slug": "main"}, http.StatusForbidden},
+		{"rename", team.Slug, map[string]any{"name": "Renamed Team", "slug": "renamed"}, http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := reservedSubdomainRequest(t, srv, session, tc.slug, http.MethodPatch, "/api/v1/team/", tc.payload)
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.status {
+				t.Fatalf("expected %d, got %d: %s", tc.status, resp.StatusCode, readBody(t, resp))
+			}
+		})
+	}
+	if err := db.First(team, team.ID).Error; err != nil {
+		t.Fatalf("reload team: %v", err)
+	}
+	if team.Name != "Renamed Team" || team.Slug != "renamed" {
+		t.Fatalf("expected the team to be renamed, got %q (%s)", team.Name, team.Slug)
+	}
+
+	member := CreateTestUser(t, db, "teams-member@example.com", false)
+	memberTeamUser := createTeamMembership(t, db, member, team, models.RoleMember)
+	connection := memberWithTunnel(t, db, memberTeamUser, "doomed")
+
+	resp := reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodDelete, "/api/v1/team/"+strconv.FormatUint(uint64(defaultTeam.ID), 10), nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected the default team to be protected, got %d", resp.StatusCode)
+	}
+	resp = reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodDelete, "/api/v1/team/"+strconv.FormatUint(uint64(team.ID), 10), nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("delete team: expected 200, got %d: %s", resp.StatusCode, readBody(t, resp))
+	}
+	resp.Body.Close()
+
+	for _, check := range []struct {
+		model any
+		query string
+		arg   any
+	}{
+		{&models.Team{}, "id = ?", team.ID},
+		{&models.TeamUser{}, "team_id = ?", team.ID},
+		{&models.Connection{}, "id = ?", connection.ID},
+		{&models.SubdomainReservation{}, "team_user_id = ?", memberTeamUser.ID},
+		{&models.User{}, "id = ?", member.ID},
+	} {
+		var count int64
+		if err := db.Model(check.model).Where(check.query, check.arg).Count(&count).Error; err != nil {
+			t.Fatalf("count %T: %v", check.model, err)
+		}
+		if count != 0 {
+			t.Fatalf("expected %T rows of the deleted team to be gone, found %d", check.model, count)
+		}
+	}
+	if err := db.First(&models.User{}, superuser.ID).Error; err != nil {
+		t.Fatalf("expected the superuser to be kept: %v", err)
+	}
+
+	var entry models.AuditLog
+	if err := db.Where("action = ?", models.AuditActionTeamDeleted).First(&entry).Error; err != nil {
+		t.Fatalf("load audit log entry: %v", err)
+	}
+	if entry.Target != "renamed" || entry.TeamID == nil || *entry.TeamID != team.ID {
+		t.Fatalf("unexpected team deletion entry: %+v", entry)
+	}
+}
+
+func TestTeamManagement_RolesTransferAndLeave(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	admin := CreateTestUser(t, db, "roles-admin@example.com", false)
+	team, adminTeamUser := CreateTeamAndTeamUser(t, db, "Roles Team", admin, models.RoleAdmin)
+	member := CreateTestUser(t, db, "roles-member@example.com", false)
+	memberTeamUser := createTeamMembership(t, db, member, team, models.RoleMember)
+	adminSession := CreateSessionForUser(t, db, admin)
+	memberSession := CreateSessionForUser(t, db, member)
+
+	request := func(session *models.Session, method, path string, payload map[string]any) int {
+		t.Helper()
+		resp := reservedSubdomainRequest(t, srv, session, team.Slug, method, path, payload)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	roleURL := func(teamUser *models.TeamUser) string {
+		return "/api/v1/team/users/" + strconv.FormatUint(uint64(teamUser.ID), 10) + "/role"
+	}
+
+	if status := request(adminSession, http.MethodPut, roleURL(adminTeamUser), map[string]any{"role": models.RoleMember}); status != http.StatusConflict {
+		t.Fatalf("expected the last admin to be kept, got %d", status)
+	}
+	if status := request(adminSession, http.MethodDelete, "/api/v1/team/users/"+strconv.FormatUint(uint64(adminTeamUser.ID), 10), nil); status != http.StatusConflict {
+		t.Fatalf("expected the last admin not to be removable, got %d", status)
+	}
+	if status := request(memberSession, http.MethodPut, roleURL(memberTeamUser), map[string]any{"role": models.RoleAdmin}); status != http.StatusForbidden {
+		t.Fatalf("expected members to be refused role changes, got %d", status)
+	}
+	if status := request(adminSession, http.MethodPut, roleURL(memberTeamUser), map[string]any{"role": "owner"}); status != http.StatusBadRequest {
+		t.Fatalf("expected an unknown role to be refused, got %d", status)
+	}
+
+	if status := request(adminSession, http.MethodPost, "/api/v1/team/transfer", map[string]any{"team_user_id": memberTeamUser.ID}); status != http.StatusOK {
+		t.Fatalf("expected the transfer to succeed, got %d", status)
+	}
+	for teamUser, role := range map[*models.TeamUser]string{adminTeamUser: models.RoleMember, memberTeamUser: models.RoleAdmin} {
+		var reloaded models.TeamUser
+		if err := db.First(&reloaded, teamUser.ID).Error; err != nil {
+			t.Fatalf("reload team user: %v", err)
+		}
+		if reloaded.Role != role {
+			t.Fatalf("expected team user %d to be %s after the transfer, got %s", teamUser.ID, role, reloaded.Role)
+		}
+	}
+
+	if status := request(adminSession, http.MethodPost, "/api/v1/team/leave", nil); status != http.StatusConflict {
+		t.Fatalf("expected leaving the only team to be refused, got %d", status)
+	}
+	CreateTeamAndTeamUser(t, db, "Other Roles Team", admin, models.RoleAdmin)
+	connection := memberWithTunnel(t, db, adminTeamUser, "leaving")
+	if status := request(adminSession, http.MethodPost, "/api/v1/team/leave", nil); status != http.StatusOK {
+		t.Fatalf("expected the former admin to leave, got %d", status)
+	}
+	assertMemberRemoved(t, db, adminTeamUser, connection)
+	if err := db.First(&models.User{}, admin.ID).Error; err != nil {
+		t.Fatalf("expected a user who left a team to be kept: %v", err)
+	}
+	if status := request(memberSession, http.MethodPost, "/api/v1/team/leave", nil); status != http.StatusConflict {
+		t.Fatalf("expected the last admin to be refused leaving, got %d", status)
+	}
+
+	var actions []string
+	if err := db.Model(&models.AuditLog{}).Order("id").Pluck("action", &actions).Error; err != nil {
+		t.Fatalf("load audit log: %v", err)
+	}
+	if len(actions) != 2 || actions[0] != models.AuditActionAdminTransferred || actions[1] != models.AuditActionTeamUserLeft {
+		t.Fatalf("unexpected audit log actions %v", actions)
+	}
+}
+
+func TestTeamManagement_RemoveClosesMemberTunnels(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	admin := CreateTestUser(t, db, "remove-admin@example.com", false)
+	team, _ := CreateTeamAndTeamUser(t, db, "Remove Team", admin, models.RoleAdmin)
+	member := CreateTestUser(t, db, "remove-member@example.com", false)
+	memberTeamUser := createTeamMembership(t, db, member, team, models.RoleAdmin)
+	session := CreateSessionForUser(t, db, admin)
+	connection := memberWithTunnel(t, db, memberTeamUser, "removed")
+
+	resp := reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodPut, "/api/v1/team/users/"+strconv.FormatUint(uint64(memberTeamUser.ID), 10)+"/role", map[string]any{"role": models.RoleMember})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("demote: expected 200, got %d: %s", resp.StatusCode, readBody(t, resp))
+	}
+	resp.Body.Close()
+
+	resp = reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodDelete, "/api/v1/team/users/"+strconv.FormatUint(uint64(memberTeamUser.ID), 10), nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("remove: expected 200, got %d: %s", resp.StatusCode, readBody(t, resp))
+	}
+	resp.Body.Close()
+	assertMemberRemoved(t, db, memberTeamUser, connection)
+
+	var entry models.AuditLog
+	if err := db.Where("action = ?", models.AuditActionTeamUserRoleChanged).First(&entry).Error; err != nil {
+		t.Fatalf("load audit log entry: %v", err)
+	}
+	if entry.Target != member.Email || entry.Diff == "" {
+		t.Fatalf("unexpected role change entry: %+v", entry)
+	}
+}
@@ -0,0 +1,205 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	serverAdmin "github.com/amalshaji/portr/internal/server/admin"
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+)
+
+type mintedTunnelCredential struct {
+	ID           uint   `json:"id"`
+	ExpiresAt    string `json:"expires_at"`
+	Credential   string `json:"credential"`
+	SetupCommand string `json:"setup_command"`
+}
+
+func mintTunnelCredential(t *testing.T, srv *serverAdmin.Server, token, body string) (int, mintedTunnelCredential) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tunnel-credentials/", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp := DoRequest(t, srv, req)
+	defer resp.Body.Close()
+	var credential mintedTunnelCredential
+	if resp.StatusCode == http.StatusCreated {
+		if err := json.NewDecoder(resp.Body).Decode(&credential); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+	}
+	return resp.StatusCode, credential
+}
+
+// openHTTPTunnel reserves an http connection the way the portr client does,
+// and returns the response status and connection id.
+func openHTTPTunnel(t *testing.T, srv *serverAdmin.Server, secretKey, subdomain string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/connections/", strings.NewReader(`{"secret_key":"`+secretKey+`","connection_type":"http","subdomain":"`+subdomain+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := DoRequest(t, srv, req)
+	defer resp.Body.Close()
+	var body struct {
+		ConnectionID string `json:"connection_id"`
+	}
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+	}
+	return resp.StatusCode, body.ConnectionID
+}
+
+func TestTunnelCredentials_OpenPreviewTunnels(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	user := CreateTestUser(t, db, "ci-owner@example.com", false)
+	team, teamUser := CreateTeamAndTeamUser(t, db, "CI Team", user, models.RoleMember)
+	session := CreateSessionForUser(t, db, user)
+	token := createAPIToken(t, srv, session, team.Slug, map[string]any{
+		"name":   "ci",
+		"scopes": []string{models.APITokenScopeTunnelCredentials},
+	})
+	reader := createAPIToken(t, srv, session, team.Slug, map[string]any{
+		"name":   "dashboards",
+		"scopes": []string{models.APITokenScopeConnectionsRead},
+	})
+
+	if status, _ := mintTunnelCredential(t, srv, reader.Token, `{"connection_type":"http","subdomain_pattern":"pr-*"}`); status != http.StatusForbidden {
+		t.Fatalf("expected a token without the scope to be refused, got %d", status)
+	}
+	for _, body := range []string{
+		`{"connection_type":"http","subdomain_pattern":"pr-?"}`,
+		`{"connection_type":"http"}`,
+		`{"connection_type":"udp"}`,
+		`{"connection_type":"tcp","max_lifetime":30}`,
+		`{"connection_type":"tcp","max_lifetime":90000}`,
+	} {
+		if status, _ := mintTunnelCredential(t, srv, token.Token, body); status != http.StatusBadRequest {
+			t.Fatalf("expected %s to be refused, got %d", body, status)
+		}
+	}
+
+	status, credential := mintTunnelCredential(t, srv, token.Token, `{"name":"preview","connection_type":"http","subdomain_pattern":"PR-*","max_lifetime":600}`)
+	if status != http.StatusCreated {
+		t.Fatalf("expected the credential to be minted, got %d", status)
+	}
+	if !strings.HasPrefix(credential.Credential, models.TunnelCredentialPrefix) || !strings.Contains(credential.SetupCommand, credential.Credential) {
+		t.Fatalf("unexpected credential %+v", credential)
+	}
+
+	status, connectionID := openHTTPTunnel(t, srv, credential.Credential, "pr-12")
+	if status != http.StatusOK {
+		t.Fatalf("expected a matching subdomain to open, got %d", status)
+	}
+	var connection models.Connection
+	if err := db.First(&connection, "id = ?", connectionID).Error; err != nil {
+		t.Fatalf("load connection: %v", err)
+	}
+	if connection.CreatedByID != teamUser.ID || connection.TunnelCredentialID == nil || *connection.TunnelCredentialID != credential.ID {
+		t.Fatalf("expected the connection to record the credential, got %+v", connection)
+	}
+	if connection.ExpiresAt == nil || connection.ExpiresAt.UTC().Format("2006-01-02T15:04:05Z") != credential.ExpiresAt {
+		t.Fatalf("expected the tunnel to expire with the credential at %s, got %v", credential.ExpiresAt, connection.ExpiresAt)
+	}
+
+	if status, _ := openHTTPTunnel(t, srv, credential.Credential, "main"); status != http.StatusForbidden {
+		t.Fatalf("expected another subdomain to be refused, got %d", status)
+	}
+	if status, _ := openTunnel(t, srv, credential.Credential); status != http.StatusForbidden {
+		t.Fatalf("expected a tcp tunnel to be refused, got %d", status)
+	}
+	if status := tokenRequest(t, srv, credential.Credential, http.MethodGet, "/api/v1/ssh-keys/", nil); status != http.StatusUnauthorized {
+		t.Fatalf("expected the credential not to work as a bearer token, got %d", status)
+	}
+	if config := configDownload(t, srv, credential.Credential); !strings.Contains(config, "secret_key: "+credential.Credential) {
+		t.Fatalf("expected the downloaded config to carry the credential, got %q", config)
+	}
+
+	var entry models.AuditLog
+	if err := db.Where("action = ?", models.AuditActionTunnelCredential).First(&entry).Error; err != nil {
+		t.Fatalf("load audit log entry: %v", err)
+	}
+	if entry.Target != "preview" || !strings.HasPrefix(entry.Detail, "http pr-*, for 10m0s") || !strings.Contains(entry.Detail, token.Prefix) {
+		t.Fatalf("unexpected audit log entry %+v", entry)
+	}
+
+	db.Model(&models.Connection{}).Where("id = ?", connectionID).Update("status", models.ConnectionStatusActive)
+	revoke := reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodDelete, "/api/v1/api-tokens/"+strconv.FormatUint(uint64(token.ID), 10), nil)
+	revoke.Body.Close()
+	if status, _ := openHTTPTunnel(t, srv, credential.Credential, "pr-13"); status != http.StatusUnauthorized {
+		t.Fatalf("expected revoking the token to stop its credentials, got %d", status)
+	}
+	var revoked models.TunnelCredential
+	if err := db.First(&revoked, credential.ID).Error; err != nil {
+		t.Fatalf("load credential: %v", err)
+	}
+	if revoked.RevokedAt == nil {
+		t.Fatal("expected revoking the token to revoke its credentials")
+	}
+	if err := db.First(&connection, "id = ?", connectionID).Error; err != nil {
+		t.Fatalf("reload connection: %v", err)
+	}
+	if connection.Status != models.ConnectionStatusClosed || connection.CloseReason == nil || *connection.CloseReason != models.ConnectionCloseReasonKeyRevoked {
+		t.Fatalf("expected the credential's tunnel to be closed as key_revoked, got %s %v", connection.Status, connection.CloseReason)
+	}
+}
+
+func TestTunnelCredentials_ExpireAndArePruned(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	user := CreateTestUser(t, db, "ci-expiry@example.com", false)
+	team, _ := CreateTeamAndTeamUser(t, db, "Expiry Team", user, models.RoleMember)
+	session := CreateSessionForUser(t, db, user)
+
+	mint := func() mintedTunnelCredential {
+		t.Helper()
+		resp := reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodPost, "/api/v1/tunnel-credentials/", map[string]any{"connection_type": "tcp"})
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("expected a session to mint a credential, got %d", resp.StatusCode)
+		}
+		var credential mintedTunnelCredential
+		if err := json.NewDecoder(resp.Body).Decode(&credential); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return credential
+	}
+	credential := mint()
+	unused := mint()
+	status, connectionID := openTunnel(t, srv, credential.Credential)
+	if status != http.StatusOK {
+		t.Fatalf("expected the credential to open a tcp tunnel, got %d", status)
+	}
+
+	db.Model(&models.TunnelCredential{}).Where("id IN ?", []uint{credential.ID, unused.ID}).Update("expires_at", time.Now().Add(-time.Second))
+	if status, _ := openTunnel(t, srv, credential.Credential); status != http.StatusUnauthorized {
+		t.Fatalf("expected an expired credential to be refused, got %d", status)
+	}
+
+	deleted, err := services.NewTunnelCredentialService(db).Prune(context.Background(), time.Now())
+	if err != nil || deleted != 1 {
+		t.Fatalf("expected only the unused credential to be pruned, got %d, %v", deleted, err)
+	}
+	if err := db.First(&models.TunnelCredential{}, unused.ID).Error; err == nil {
+		t.Fatal("expected the unused credential to be deleted")
+	}
+	var connection models.Connection
+	if err := db.Preload("TunnelCredential").First(&connection, "id = ?", connectionID).Error; err != nil {
+		t.Fatalf("load connection: %v", err)
+	}
+	if connection.TunnelCredential == nil || connection.TunnelCredential.ID != credential.ID {
+		t.Fatalf("expected the connection to keep its credential, got %+v", connection.TunnelCredential)
+	}
+}
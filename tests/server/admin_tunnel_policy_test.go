@@ -0,0 +1,111 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+)
+
+func decodeTunnelPolicy(t *testing.T, response *http.Response) int64 {
+	t.Helper()
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", response.StatusCode)
+	}
+	var body struct {
+		MaxLifetimeSeconds int64 `json:"max_lifetime_seconds"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return body.MaxLifetimeSeconds
+}
+
+func TestTunnelPolicy(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	superuser := CreateTestUser(t, db, "policy-root@example.com", true)
+	team, _ := CreateTeamAndTeamUser(t, db, "Policy Team", superuser, models.RoleAdmin)
+	admin := CreateTestUser(t, db, "policy-admin@example.com", false)
+	createTeamMembership(t, db, admin, team, models.RoleAdmin)
+	superuserSession := CreateSessionForUser(t, db, superuser)
+	adminSession := CreateSessionForUser(t, db, admin)
+
+	if lifetime := decodeTunnelPolicy(t, reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodGet, "/api/v1/team/tunnel-policy", nil)); lifetime != 0 {
+		t.Fatalf("expected no lifetime cap by default, got %d", lifetime)
+	}
+
+	policy := map[string]any{"max_lifetime_seconds": 3600}
+	forbidden := reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodPut, "/api/v1/team/tunnel-policy", policy)
+	forbidden.Body.Close()
+	if forbidden.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected only superusers to cap tunnel lifetimes, got %d", forbidden.StatusCode)
+	}
+	for _, invalid := range []map[string]any{{"max_lifetime_seconds": -1}, {}} {
+		response := reservedSubdomainRequest(t, srv, superuserSession, team.Slug, http.MethodPut, "/api/v1/team/tunnel-policy", invalid)
+		response.Body.Close()
+		if response.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected %v to be rejected, got %d", invalid, response.StatusCode)
+		}
+	}
+	if lifetime := decodeTunnelPolicy(t, reservedSubdomainRequest(t, srv, superuserSession, team.Slug, http.MethodPut, "/api/v1/team/tunnel-policy", policy)); lifetime != 3600 {
+		t.Fatalf("expected the saved lifetime, got %d", lifetime)
+	}
+	if lifetime := decodeTunnelPolicy(t, reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodGet, "/api/v1/team/tunnel-policy", nil)); lifetime != 3600 {
+		t.Fatalf("expected members to see the lifetime cap, got %d", lifetime)
+	}
+}
+
+func TestCreateConnection_ExpiresIn(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	user := CreateTestUser(t, db, "expiring@example.com", false)
+	_, teamUser := CreateTeamAndTeamUser(t, db, "Expiring Team", user, models.RoleAdmin)
+
+	create := func(expiresIn any) *http.Response {
+		payload, _ := json.Marshal(map[string]any{
+			"secret_key":      teamUser.SecretKey,
+			"connection_type": "tcp",
+			"expires_in":      expiresIn,
+		})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/connections/", bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		return DoRequest(t, srv, req)
+	}
+
+	for _, invalid := range []int64{0, -5, 366 * 24 * 60 * 60} {
+		response := create(invalid)
+		response.Body.Close()
+		if response.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected expires_in %d to be rejected, got %d", invalid, response.StatusCode)
+		}
+	}
+
+	response := create(600)
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", response.StatusCode)
+	}
+	var body struct {
+		ConnectionID string `json:"connection_id"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	var connection models.Connection
+	if err := db.First(&connection, "id = ?", body.ConnectionID).Error; err != nil {
+		t.Fatalf("load connection: %v", err)
+	}
+	if connection.ExpiresAt == nil || time.Until(*connection.ExpiresAt) < 590*time.Second || time.Until(*connection.ExpiresAt) > 600*time.Second {
+		t.Fatalf("expected the connection to expire in 10 minutes, got %v", connection.ExpiresAt)
+	}
+}
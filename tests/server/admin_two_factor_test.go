@@ -0,0 +1,367 @@
+package server_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	serverAdmin "github.com/amalshaji/portr/internal/server/admin"
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	"gorm.io/gorm"
+)
+
+// currentTOTP computes the code an authenticator app shows for secret now.
+func currentTOTP(t *testing.T, secret string) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatalf("decode secret: %v", err)
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(time.Now().Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1_000_000)
+}
+
+// enableTwoFactor turns on two-factor authentication for user and returns
+// their recovery codes.
+func enableTwoFactor(t *testing.T, db *gorm.DB, user *models.User) []string {
+	t.Helper()
+	service := services.NewTwoFactorService(db)
+	enrollment, err := service.BeginEnrollment(context.Background(), user, "Portr")
+	if err != nil {
+		t.Fatalf("begin enrollment: %v", err)
+	}
+	codes, err := service.Enable(context.Background(), user, currentTOTP(t, enrollment.Secret))
+	if err != nil {
+		t.Fatalf("enable two-factor: %v", err)
+	}
+	if err := db.First(user, user.ID).Error; err != nil {
+		t.Fatalf("reload user: %v", err)
+	}
+	return codes
+}
+
+// passwordLogin posts the user's password and returns the response with the
+// login's session cookies.
+func passwordLogin(t *testing.T, srv *serverAdmin.Server, email string) (*http.Response, []*http.Cookie) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader(`{"email":"`+email+`","password":"password123"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := DoRequest(t, srv, req)
+	return resp, resp.Cookies()
+}
+
+func twoFactorLogin(t *testing.T, srv *serverAdmin.Server, cookies []*http.Cookie, code string) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login/two-factor", strings.NewReader(`{"code":"`+code+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	return DoRequest(t, srv, req)
+}
+
+func hasPortrSession(resp *http.Response) bool {
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "portr_session" && cookie.Value != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTwoFactorEnrollmentAndLogin(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	user := CreateTestUser(t, db, "totp@example.com", false)
+	team, _ := CreateTeamAndTeamUser(t, db, "TOTP Team", user, models.RoleMember)
+	session := CreateSessionForUser(t, db, user)
+
+	setup := reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodPost, "/api/v1/user/me/two-factor/setup", nil)
+	var enrollment struct {
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+	}
+	if err := json.NewDecoder(setup.Body).Decode(&enrollment); err != nil {
+		t.Fatalf("decode enrollment: %v", err)
+	}
+	setup.Body.Close()
+	if enrollment.Secret == "" || !strings.HasPrefix(enrollment.URI, "otpauth://totp/Portr:totp@example.com?") {
+		t.Fatalf("unexpected enrollment %+v", enrollment)
+	}
+
+	wrong := reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodPost, "/api/v1/user/me/two-factor/enable", map[string]any{"code": "12345x"})
+	wrong.Body.Close()
+	if wrong.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected a wrong code to be rejected, got %d", wrong.StatusCode)
+	}
+
+	code := currentTOTP(t, enrollment.Secret)
+	enable := reservedSubdomainRequest(t, srv, session, team.Slug, http.MethodPost, "/api/v1/user/me/two-factor/enable", map[string]any{"code": code})
+	var enabled struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	if err := json.NewDecoder(enable.Body).Decode(&enabled); err != nil {
+		t.Fatalf("decode recovery codes: %v", err)
+	}
+	enable.Body.Close()
+	if enable.StatusCode != http.StatusOK || len(enabled.RecoveryCodes) != models.RecoveryCodeCount {
+		t.Fatalf("expected %d recovery codes, got %d with status %d", models.RecoveryCodeCount, len(enabled.RecoveryCodes), enable.StatusCode)
+	}
+
+	login, cookies := passwordLogin(t, srv, user.Email)
+	var pending map[string]any
+	if err := json.NewDecoder(login.Body).Decode(&pending); err != nil {
+		t.Fatalf("decode login: %v", err)
+	}
+	login.Body.Close()
+	if pending["two_factor_required"] != true || hasPortrSession(login) {
+		t.Fatalf("expected the password alone not to sign in, got %v", pending)
+	}
+
+	replayed := twoFactorLogin(t, srv, cookies, code)
+	replayed.Body.Close()
+	if replayed.StatusCode != http.StatusBadRequest || hasPortrSession(replayed) {
+		t.Fatalf("expected the code used to enroll to be refused, got %d", replayed.StatusCode)
+	}
+
+	recovered := twoFactorLogin(t, srv, cookies, strings.ToUpper(enabled.RecoveryCodes[0]))
+	recovered.Body.Close()
+	if recovered.StatusCode != http.StatusOK || !hasPortrSession(recovered) {
+		t.Fatalf("expected a recovery code to sign in, got %d", recovered.StatusCode)
+	}
+
+	login, cookies = passwordLogin(t, srv, user.Email)
+	login.Body.Close()
+	reused := twoFactorLogin(t, srv, cookies, enabled.RecoveryCodes[0])
+	reused.Body.Close()
+	if reused.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected a used recovery code to be refused, got %d", reused.StatusCode)
+	}
+
+	var loginAudit models.AuditLog
+	if err := db.Where("action = ? AND actor_id = ?", models.AuditActionLogin, user.ID).First(&loginAudit).Error; err != nil {
+		t.Fatalf("expected the login to be audited: %v", err)
+	}
+	if loginAudit.Detail != "password, recovery_code" {
+		t.Fatalf("expected the login to name its second factor, got %q", loginAudit.Detail)
+	}
+}
+
+func TestTwoFactorLoginEndsAfterTooManyWrongCodes(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	user := CreateTestUser(t, db, "guessed@example.com", false)
+	CreateTeamAndTeamUser(t, db, "Guessed Team", user, models.RoleMember)
+	recoveryCodes := enableTwoFactor(t, db, user)
+
+	login, cookies := passwordLogin(t, srv, user.Email)
+	login.Body.Close()
+	for attempt := 1; attempt <= 5; attempt++ {
+		resp := twoFactorLogin(t, srv, cookies, "00000-00000")
+		resp.Body.Close()
+		want := http.StatusBadRequest
+		if attempt == 5 {
+			want = http.StatusUnauthorized
+		}
+		if resp.StatusCode != want {
+			t.Fatalf("attempt %d: expected %d, got %d", attempt, want, resp.StatusCode)
+		}
+	}
+
+	resp := twoFactorLogin(t, srv, cookies, recoveryCodes[0])
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || hasPortrSession(resp) {
+		t.Fatalf("expected the password to be needed again, got %d", resp.StatusCode)
+	}
+
+	withoutPassword := twoFactorLogin(t, srv, nil, recoveryCodes[0])
+	withoutPassword.Body.Close()
+	if withoutPassword.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected a code without a password to be refused, got %d", withoutPassword.StatusCode)
+	}
+}
+
+func TestTeamTwoFactorRequirement(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	superuser := CreateTestUser(t, db, "2fa-root@example.com", true)
+	team, _ := CreateTeamAndTeamUser(t, db, "Strict Team", superuser, models.RoleAdmin)
+	admin := CreateTestUser(t, db, "2fa-admin@example.com", false)
+	createTeamMembership(t, db, admin, team, models.RoleAdmin)
+	member := CreateTestUser(t, db, "2fa-member@example.com", false)
+	createTeamMembership(t, db, member, team, models.RoleMember)
+	superuserSession := CreateSessionForUser(t, db, superuser)
+	adminSession := CreateSessionForUser(t, db, admin)
+	memberSession := CreateSessionForUser(t, db, member)
+
+	require := map[string]any{"required": true}
+	forbidden := reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodPut, "/api/v1/team/two-factor", require)
+	forbidden.Body.Close()
+	if forbidden.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected only superusers to require two-factor, got %d", forbidden.StatusCode)
+	}
+	lockout := reservedSubdomainRequest(t, srv, superuserSession, team.Slug, http.MethodPut, "/api/v1/team/two-factor", require)
+	lockout.Body.Close()
+	if lockout.StatusCode != http.StatusConflict {
+		t.Fatalf("expected a superuser without two-factor to be refused, got %d", lockout.StatusCode)
+	}
+
+	recoveryCodes := enableTwoFactor(t, db, superuser)
+	saved := reservedSubdomainRequest(t, srv, superuserSession, team.Slug, http.MethodPut, "/api/v1/team/two-factor", require)
+	saved.Body.Close()
+	if saved.StatusCode != http.StatusOK {
+		t.Fatalf("expected the requirement to be saved, got %d", saved.StatusCode)
+	}
+
+	blocked := reservedSubdomainRequest(t, srv, memberSession, team.Slug, http.MethodGet, "/api/v1/connections/", nil)
+	var blockedBody map[string]any
+	_ = json.NewDecoder(blocked.Body).Decode(&blockedBody)
+	blocked.Body.Close()
+	if blocked.StatusCode != http.StatusForbidden || blockedBody["code"] != "two_factor_required" {
+		t.Fatalf("expected a member without two-factor to be kept out, got %d %v", blocked.StatusCode, blockedBody)
+	}
+	for _, path := range []string{"/api/v1/user/me", "/api/v1/user/me/two-factor"} {
+		resp := reservedSubdomainRequest(t, srv, memberSession, team.Slug, http.MethodGet, path, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected %s to stay open for setting up two-factor, got %d", path, resp.StatusCode)
+		}
+	}
+
+	enableTwoFactor(t, db, member)
+	allowed := reservedSubdomainRequest(t, srv, memberSession, team.Slug, http.MethodGet, "/api/v1/connections/", nil)
+	allowed.Body.Close()
+	if allowed.StatusCode != http.StatusOK {
+		t.Fatalf("expected a member with two-factor to be let in, got %d", allowed.StatusCode)
+	}
+
+	disable := reservedSubdomainRequest(t, srv, superuserSession, team.Slug, http.MethodPost, "/api/v1/user/me/two-factor/disable", map[string]any{"code": recoveryCodes[0]})
+	disable.Body.Close()
+	if disable.StatusCode != http.StatusConflict {
+		t.Fatalf("expected two-factor to stay on while a team requires it, got %d", disable.StatusCode)
+	}
+}
+
+func TestTeamTwoFactorRequirementCoversTokensAndSecretKeys(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewSecretKeyAuthTestServer(t, db)
+
+	admin := CreateTestUser(t, db, "2fa-token-admin@example.com", false)
+	team, membership := CreateTeamAndTeamUser(t, db, "Strict Token Team", admin, models.RoleAdmin)
+	session := CreateSessionForUser(t, db, admin)
+	reader := createAPIToken(t, srv, session, team.Slug, map[string]any{
+		"name":   "dashboards",
+		"scopes": []string{models.APITokenScopeConnectionsRead},
+	})
+	if err := db.Model(&team).Update("require_two_factor", true).Error; err != nil {
+		t.Fatalf("require two-factor: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/connections/", nil)
+	req.Header.Set("Authorization", "Bearer "+reader.Token)
+	resp := DoRequest(t, srv, req)
+	var body map[string]any
+	_ = json.NewDecoder(resp.Body).Decode(&body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden || body["code"] != "two_factor_required" {
+		t.Fatalf("expected a token created before the requirement to be kept out, got %d %v", resp.StatusCode, body)
+	}
+	if status := tokenRequest(t, srv, membership.SecretKey, http.MethodGet, "/api/v1/ssh-keys/", nil); status != http.StatusForbidden {
+		t.Fatalf("expected a secret key bearer to be kept out, got %d", status)
+	}
+
+	enableTwoFactor(t, db, admin)
+	if status := tokenRequest(t, srv, reader.Token, http.MethodGet, "/api/v1/connections/", nil); status != http.StatusOK {
+		t.Fatalf("expected the token to work once its owner has two-factor, got %d", status)
+	}
+	if status := tokenRequest(t, srv, membership.SecretKey, http.MethodGet, "/api/v1/ssh-keys/", nil); status != http.StatusOK {
+		t.Fatalf("expected the secret key to work once its owner has two-factor, got %d", status)
+	}
+}
+
+func TestResetUserTwoFactor(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	admin := CreateTestUser(t, db, "reset-admin@example.com", false)
+	team, _ := CreateTeamAndTeamUser(t, db, "Reset Team", admin, models.RoleAdmin)
+	member := CreateTestUser(t, db, "reset-member@example.com", false)
+	memberTeamUser := createTeamMembership(t, db, member, team, models.RoleMember)
+	superuser := CreateTestUser(t, db, "reset-root@example.com", true)
+	superuserTeamUser := createTeamMembership(t, db, superuser, team, models.RoleMember)
+	adminSession := CreateSessionForUser(t, db, admin)
+
+	resetPath := func(teamUser *models.TeamUser) string {
+		return fmt.Sprintf("/api/v1/team/users/%d/two-factor", teamUser.ID)
+	}
+
+	notEnabled := reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodDelete, resetPath(memberTeamUser), nil)
+	notEnabled.Body.Close()
+	if notEnabled.StatusCode != http.StatusConflict {
+		t.Fatalf("expected resetting a member without two-factor to conflict, got %d", notEnabled.StatusCode)
+	}
+
+	enableTwoFactor(t, db, member)
+	enableTwoFactor(t, db, superuser)
+
+	superuserReset := reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodDelete, resetPath(superuserTeamUser), nil)
+	superuserReset.Body.Close()
+	if superuserReset.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected an admin not to reset a superuser, got %d", superuserReset.StatusCode)
+	}
+
+	reset := reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodDelete, resetPath(memberTeamUser), nil)
+	reset.Body.Close()
+	if reset.StatusCode != http.StatusOK {
+		t.Fatalf("expected the reset to succeed, got %d", reset.StatusCode)
+	}
+
+	var reloaded models.User
+	if err := db.First(&reloaded, member.ID).Error; err != nil {
+		t.Fatalf("reload member: %v", err)
+	}
+	if reloaded.TwoFactorEnabled() || reloaded.TOTPSecret != nil {
+		t.Fatal("expected the member's two-factor to be off")
+	}
+	var codes int64
+	db.Model(&models.RecoveryCode{}).Where("user_id = ?", member.ID).Count(&codes)
+	if codes != 0 {
+		t.Fatalf("expected the member's recovery codes to be deleted, got %d", codes)
+	}
+	var entry models.AuditLog
+	if err := db.Where("action = ?", models.AuditActionTwoFactorReset).First(&entry).Error; err != nil {
+		t.Fatalf("expected the reset to be audited: %v", err)
+	}
+	if entry.ActorID == nil || *entry.ActorID != admin.ID || entry.Target != member.Email {
+		t.Fatalf("unexpected audit entry %+v", entry)
+	}
+
+	login, _ := passwordLogin(t, srv, member.Email)
+	login.Body.Close()
+	if !hasPortrSession(login) {
+		t.Fatal("expected the member to sign in with their password after the reset")
+	}
+}
@@ -33,7 +33,7 @@ type adminAddUserResponse struct {
 func TestAdminUsersAddDefaultsTeamAndReturnsPassword(t *testing.T) {
 	db, cleanup := NewTestDB(t)
 	defer cleanup()
-	srv := NewTestServer(t, db)
+	srv := NewSecretKeyAuthTestServer(t, db)
 
 	admin := CreateTestUser(t, db, "admin@example.com", false)
 	team, adminMembership := CreateTeamAndTeamUser(t, db, "Default Team", admin, models.RoleAdmin)
@@ -66,7 +66,7 @@ func TestAdminUsersAddDefaultsTeamAndReturnsPassword(t *testing.T) {
 func TestAdminUsersAddOmitsPasswordWhenAutoSignupEnabled(t *testing.T) {
 	db, cleanup := NewTestDB(t)
 	defer cleanup()
-	srv := NewTestServer(t, db)
+	srv := NewSecretKeyAuthTestServer(t, db)
 
 	admin := CreateTestUser(t, db, "admin@example.com", true)
 	_, adminMembership := CreateTeamAndTeamUser(t, db, "Default Team", admin, models.RoleAdmin)
@@ -122,7 +122,7 @@ func TestAdminUsersAddAuthorization(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			db, cleanup := NewTestDB(t)
 			defer cleanup()
-			srv := NewTestServer(t, db)
+			srv := NewSecretKeyAuthTestServer(t, db)
 			user := CreateTestUser(t, db, strings.ReplaceAll(tt.name, " ", "-")+"@example.com", false)
 			team := models.Team{Name: "Target Team"}
 			if err := db.Create(&team).Error; err != nil {
@@ -142,7 +142,7 @@ func TestAdminUsersAddAuthorization(t *testing.T) {
 func TestAdminUsersAddSuperuserCanTargetAnotherTeam(t *testing.T) {
 	db, cleanup := NewTestDB(t)
 	defer cleanup()
-	srv := NewTestServer(t, db)
+	srv := NewSecretKeyAuthTestServer(t, db)
 
 	superuser := CreateTestUser(t, db, "root@example.com", true)
 	_, credential := CreateTeamAndTeamUser(t, db, "Operators", superuser, models.RoleMember)
@@ -161,7 +161,7 @@ func TestAdminUsersAddSuperuserCanTargetAnotherTeam(t *testing.T) {
 func TestAdminUsersAddCannotUseAnotherTeamsCredential(t *testing.T) {
 	db, cleanup := NewTestDB(t)
 	defer cleanup()
-	srv := NewTestServer(t, db)
+	srv := NewSecretKeyAuthTestServer(t, db)
 
 	user := CreateTestUser(t, db, "scoped-admin@example.com", false)
 	_, sourceCredential := CreateTeamAndTeamUser(t, db, "Source Team", user, models.RoleMember)
@@ -181,7 +181,7 @@ func TestAdminUsersAddCannotUseAnotherTeamsCredential(t *testing.T) {
 func TestAdminUsersAddRejectsInvalidOrUnauthorizedRequests(t *testing.T) {
 	db, cleanup := NewTestDB(t)
 	defer cleanup()
-	srv := NewTestServer(t, db)
+	srv := NewSecretKeyAuthTestServer(t, db)
 	admin := CreateTestUser(t, db, "admin@example.com", false)
 	_, credential := CreateTeamAndTeamUser(t, db, "Default Team", admin, models.RoleAdmin)
 
@@ -212,7 +212,7 @@ func TestAdminUsersAddRejectsInvalidOrUnauthorizedRequests(t *testing.T) {
 func TestAdminUsersAddReturnsConflictForExistingMembership(t *testing.T) {
 	db, cleanup := NewTestDB(t)
 	defer cleanup()
-	srv := NewTestServer(t, db)
+	srv := NewSecretKeyAuthTestServer(t, db)
 	admin := CreateTestUser(t, db, "admin@example.com", false)
 	team, credential := CreateTeamAndTeamUser(t, db, "Default Team", admin, models.RoleAdmin)
 	existing := CreateTestUser(t, db, "existing@example.com", false)
@@ -0,0 +1,76 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+)
+
+func TestVisitorWarningToggleAndResolve(t *testing.T) {
+	db, cleanup := NewTestDB(t)
+	defer cleanup()
+	srv := NewTestServer(t, db)
+
+	admin := CreateTestUser(t, db, "warning-admin@example.com", false)
+	team, adminTeamUser := CreateTeamAndTeamUser(t, db, "Warning Team", admin, models.RoleAdmin)
+	member := CreateTestUser(t, db, "warning-member@example.com", false)
+	createTeamMembership(t, db, member, team, models.RoleMember)
+	outsider := CreateTestUser(t, db, "warning-outsider@example.com", false)
+	_, outsiderTeamUser := CreateTeamAndTeamUser(t, db, "Quiet Team", outsider, models.RoleAdmin)
+	adminSession := CreateSessionForUser(t, db, admin)
+	memberSession := CreateSessionForUser(t, db, member)
+
+	for _, reservation := range []models.SubdomainReservation{
+		{Subdomain: "demo", TeamID: adminTeamUser.TeamID, TeamUserID: &adminTeamUser.ID},
+		{Subdomain: "quiet", TeamID: outsiderTeamUser.TeamID, TeamUserID: &outsiderTeamUser.ID},
+	} {
+		if err := db.Create(&reservation).Error; err != nil {
+			t.Fatalf("create reservation: %v", err)
+		}
+	}
+
+	forbidden := reservedSubdomainRequest(t, srv, memberSession, team.Slug, http.MethodPut, "/api/v1/team/visitor-warning", map[string]any{"enabled": true})
+	forbidden.Body.Close()
+	if forbidden.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected members to be forbidden, got %d", forbidden.StatusCode)
+	}
+
+	invalid := reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodPut, "/api/v1/team/visitor-warning", map[string]any{})
+	invalid.Body.Close()
+	if invalid.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected a missing flag to be rejected, got %d", invalid.StatusCode)
+	}
+
+	enabled := reservedSubdomainRequest(t, srv, adminSession, team.Slug, http.MethodPut, "/api/v1/team/visitor-warning", map[string]any{"enabled": true})
+	enabled.Body.Close()
+	if enabled.StatusCode != http.StatusOK {
+		t.Fatalf("expected the warning to be enabled, got %d", enabled.StatusCode)
+	}
+
+	current := reservedSubdomainRequest(t, srv, memberSession, team.Slug, http.MethodGet, "/api/v1/team/visitor-warning", nil)
+	defer current.Body.Close()
+	var body struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(current.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if current.StatusCode != http.StatusOK || !body.Enabled {
+		t.Fatalf("expected members to see the warning enabled, got %d %+v", current.StatusCode, body)
+	}
+
+	warnings := services.NewVisitorWarningService(db)
+	warning, err := warnings.Resolve(context.Background(), "Demo")
+	if err != nil || warning == nil || warning.Owner != admin.Email || warning.Team != team.Name {
+		t.Fatalf("expected the team's warning for demo, got %+v %v", warning, err)
+	}
+	for _, subdomain := range []string{"quiet", "unknown"} {
+		if warning, err := warnings.Resolve(context.Background(), subdomain); err != nil || warning != nil {
+			t.Fatalf("expected no warning for %s, got %+v %v", subdomain, warning, err)
+		}
+	}
+}
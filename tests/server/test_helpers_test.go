@@ -52,6 +52,19 @@ func NewTestDB(t *testing.T) (*gorm.DB, func()) {
 		&models.AutoSignupSettings{},
 		&models.AutoSignupDomain{},
 		&models.SubdomainReservation{},
+		&models.SubdomainReservationMember{},
+		&models.SshKey{},
+		&models.ErrorPage{},
+		&models.MirrorRule{},
+		&models.SplitRoute{},
+		&models.AccessLog{},
+		&models.CachePurge{},
+		&models.BandwidthUsage{},
+		&models.AuditLog{},
+		&models.APIToken{},
+		&models.DeviceKey{},
+		&models.TunnelCredential{},
+		&models.RecoveryCode{},
 	); err != nil {
 		t.Fatalf("failed to auto migrate admin models: %v", err)
 	}
@@ -80,8 +93,20 @@ ON "subdomain_reservation" (LOWER("subdomain"))`).Error; err != nil {
 // NewTestServer creates an admin.Server configured for tests using the provided DB.
 func NewTestServer(t *testing.T, db *gorm.DB) *serverAdmin.Server {
 	t.Helper()
+	return serverAdmin.NewServer(testAdminConfig(), db)
+}
 
-	cfg := &serverConfig.AdminConfig{
+// NewSecretKeyAuthTestServer is NewTestServer with secret keys accepted as
+// bearer tokens, as PORTR_ADMIN_SECRET_KEY_AUTH allows.
+func NewSecretKeyAuthTestServer(t *testing.T, db *gorm.DB) *serverAdmin.Server {
+	t.Helper()
+	cfg := testAdminConfig()
+	cfg.SecretKeyAuth = true
+	return serverAdmin.NewServer(cfg, db)
+}
+
+func testAdminConfig() *serverConfig.AdminConfig {
+	return &serverConfig.AdminConfig{
 		Port:                   0,
 		Domain:                 "localhost:8000",
 		TunnelDomain:           "example.test",
@@ -94,9 +119,6 @@ func NewTestServer(t *testing.T, db *gorm.DB) *serverAdmin.Server {
 		SshURL:                 "localhost:2222",
 		Version:                "1.0.0",
 	}
-
-	srv := serverAdmin.NewServer(cfg, db)
-	return srv
 }
 
 func NewTestServerWithConfig(t *testing.T, db *gorm.DB, configure func(*serverConfig.AdminConfig)) *serverAdmin.Server {
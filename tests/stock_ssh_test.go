@@ -0,0 +1,461 @@
+package tests_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/amalshaji/portr/internal/server/admin/models"
+	"github.com/amalshaji/portr/internal/server/admin/services"
+	serverconfig "github.com/amalshaji/portr/internal/server/config"
+	serverdb "github.com/amalshaji/portr/internal/server/db"
+	"github.com/amalshaji/portr/internal/server/proxy"
+	"github.com/amalshaji/portr/internal/server/service"
+	gossh "golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
+)
+
+type forwardedChannelData struct {
+	DestAddr   string
+	DestPort   uint32
+	OriginAddr string
+	OriginPort uint32
+}
+
+func startStockSshServer(t *testing.T) (*gorm.DB, *proxy.Proxy, string) {
+	t.Helper()
+	database := openTestDatabase(t, "server",
+		&models.User{}, &models.Team{}, &models.TeamUser{},
+		&models.Connection{}, &models.SubdomainReservation{}, &models.SubdomainReservationMember{},
+		&models.SshKey{}, &models.AuditLog{}, &models.TunnelCredential{},
+	)
+	user := models.User{Email: "stock-ssh@example.test"}
+	if err := database.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	team := models.Team{Name: "Stock SSH"}
+	if err := database.Create(&team).Error; err != nil {
+		t.Fatalf("create team: %v", err)
+	}
+	teamUser := models.TeamUser{SecretKey: testSecretKey, Role: models.RoleMember, TeamID: team.ID, UserID: user.ID}
+	if err := database.Create(&teamUser).Error; err != nil {
+		t.Fatalf("create team user: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen for SSH server: %v", err)
+	}
+	serverConfig := &serverconfig.Config{
+		Ssh:    serverconfig.SshConfig{Host: "127.0.0.1"},
+		Proxy:  serverconfig.ProxyConfig{Host: "127.0.0.1"},
+		Domain: "example.test",
+	}
+	proxyServer, _ := startHandoffSshServer(t, serverConfig, service.New(&serverdb.Db{Conn: database}), listener)
+	t.Cleanup(func() { _ = listener.Close() })
+	return database, proxyServer, listener.Addr().String()
+}
+
+// dialStock connects the way OpenSSH does for `ssh -R <bindAddr>:80:...`,
+// serving forwarded connections from backendURL.
+func dialStock(t *testing.T, addr string, config *gossh.ClientConfig, bindAddr, backendURL string) *bufio.Reader {
+	t.Helper()
+	channel := openStockSession(t, addr, config, bindAddr, backendURL)
+	if ok, err := channel.SendRequest("shell", true, nil); err != nil || !ok {
+		t.Fatalf("start shell: ok=%v err=%v", ok, err)
+	}
+	return bufio.NewReader(channel)
+}
+
+// openStockSession sets up the forward and opens the session channel, but
+// does not start a shell or command on it.
+func openStockSession(t *testing.T, addr string, config *gossh.ClientConfig, bindAddr, backendURL string) gossh.Channel {
+	t.Helper()
+	config.HostKeyCallback = gossh.InsecureIgnoreHostKey()
+	config.Timeout = testTimeout
+	rawConn, err := net.DialTimeout("tcp", addr, testTimeout)
+	if err != nil {
+		t.Fatalf("dial SSH server: %v", err)
+	}
+	conn, channels, requests, err := gossh.NewClientConn(rawConn, addr, config)
+	if err != nil {
+		t.Fatalf("ssh handshake: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	go gossh.DiscardRequests(requests)
+
+	backendHost, backendPort := backendAddress(t, backendURL)
+	go func() {
+		for newChannel := range channels {
+			var data forwardedChannelData
+			if newChannel.ChannelType() != "forwarded-tcpip" || gossh.Unmarshal(newChannel.ExtraData(), &data) != nil ||
+				data.DestAddr != bindAddr || data.DestPort != 80 {
+				_ = newChannel.Reject(gossh.Prohibited, "unexpected forward")
+				continue
+			}
+			channel, channelRequests, err := newChannel.Accept()
+			if err != nil {
+				continue
+			}
+			go gossh.DiscardRequests(channelRequests)
+			go func() {
+				defer channel.Close()
+				local, err := net.Dial("tcp", net.JoinHostPort(backendHost, strconv.Itoa(backendPort)))
+				if err != nil {
+					return
+				}
+				defer local.Close()
+				go func() { _, _ = io.Copy(local, channel) }()
+				_, _ = io.Copy(channel, local)
+			}()
+		}
+	}()
+
+	ok, _, err := conn.SendRequest("tcpip-forward", true, gossh.Marshal(&struct {
+		BindAddr string
+		BindPort uint32
+	}{bindAddr, 80}))
+	if err != nil || !ok {
+		t.Fatalf("request remote forward: ok=%v err=%v", ok, err)
+	}
+
+	channel, channelRequests, err := conn.OpenChannel("session", nil)
+	if err != nil {
+		t.Fatalf("open session: %v", err)
+	}
+	go gossh.DiscardRequests(channelRequests)
+	return channel
+}
+
+func readTunnelURL(t *testing.T, stdout *bufio.Reader) string {
+	t.Helper()
+	text := readSessionLine(t, stdout)
+	url, ok := strings.CutPrefix(text, "Tunnel ready: ")
+	if !ok {
+		t.Fatalf("unexpected session output %q", text)
+	}
+	return url
+}
+
+func readSessionLine(t *testing.T, stdout *bufio.Reader) string {
+	t.Helper()
+	line := make(chan string, 1)
+	go func() {
+		text, _ := stdout.ReadString('\n')
+		line <- strings.TrimSpace(text)
+	}()
+	select {
+	case text := <-line:
+		return text
+	case <-time.After(testTimeout):
+		t.Fatal("timed out waiting for session output")
+		return ""
+	}
+}
+
+func requestHost(t *testing.T, proxyServer *proxy.Proxy, host string) string {
+	t.Helper()
+	publicServer := httptest.NewServer(proxyServer)
+	defer publicServer.Close()
+	request, err := http.NewRequest(http.MethodGet, publicServer.URL, nil)
+	if err != nil {
+		t.Fatalf("create public request: %v", err)
+	}
+	request.Host = host
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("send request through tunnel: %v", err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected response status %d: %s", response.StatusCode, body)
+	}
+	return string(body)
+}
+
+func TestStockSshClientOpensTunnelWithSecretKey(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "from-stock-ssh")
+	}))
+	defer backend.Close()
+	database, proxyServer, addr := startStockSshServer(t)
+
+	stdout := dialStock(t, addr, &gossh.ClientConfig{
+		User: testSecretKey,
+		Auth: []gossh.AuthMethod{gossh.KeyboardInteractive(func(string, string, []string, []bool) ([]string, error) {
+			t.Error("secret key username should not be prompted for")
+			return nil, io.EOF
+		})},
+	}, "stock-app", backend.URL)
+
+	if url := readTunnelURL(t, stdout); url != "https://stock-app.example.test" {
+		t.Fatalf("unexpected tunnel URL %q", url)
+	}
+	if body := requestHost(t, proxyServer, "stock-app.example.test"); body != "from-stock-ssh" {
+		t.Fatalf("unexpected response %q", body)
+	}
+
+	var connection models.Connection
+	if err := database.Preload("CreatedBy").First(&connection, "subdomain = ?", "stock-app").Error; err != nil {
+		t.Fatalf("load connection: %v", err)
+	}
+	if connection.Status != models.ConnectionStatusActive || connection.CreatedBy.SecretKey != testSecretKey || connection.TeamID == 0 {
+		t.Fatalf("unexpected connection %+v", connection)
+	}
+}
+
+func TestStockSshClientOpensTunnelWithRegisteredPublicKey(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "from-public-key")
+	}))
+	defer backend.Close()
+	database, proxyServer, addr := startStockSshServer(t)
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	signer, err := gossh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatalf("create signer: %v", err)
+	}
+	var teamUser models.TeamUser
+	if err := database.First(&teamUser, "secret_key = ?", testSecretKey).Error; err != nil {
+		t.Fatalf("load team user: %v", err)
+	}
+	if _, err := services.NewSshKeyService(database).Add(t.Context(), teamUser.ID, "laptop", string(gossh.MarshalAuthorizedKey(signer.PublicKey()))); err != nil {
+		t.Fatalf("register key: %v", err)
+	}
+
+	stdout := dialStock(t, addr, &gossh.ClientConfig{
+		User: "tunnel",
+		Auth: []gossh.AuthMethod{gossh.PublicKeys(signer)},
+	}, "localhost", backend.URL)
+
+	url := readTunnelURL(t, stdout)
+	subdomain, ok := strings.CutSuffix(strings.TrimPrefix(url, "https://"), ".example.test")
+	if !ok || subdomain == "" {
+		t.Fatalf("expected a generated subdomain, got %q", url)
+	}
+	if body := requestHost(t, proxyServer, subdomain+".example.test"); body != "from-public-key" {
+		t.Fatalf("unexpected response %q", body)
+	}
+
+	var key models.SshKey
+	if err := database.First(&key, "team_user_id = ?", teamUser.ID).Error; err != nil {
+		t.Fatalf("load key: %v", err)
+	}
+	if key.LastUsedAt == nil {
+		t.Fatal("expected key use to be recorded")
+	}
+}
+
+func TestStockSshClientClaimsTeamReservationAsAdmin(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "from-team-app")
+	}))
+	defer backend.Close()
+	database, proxyServer, addr := startStockSshServer(t)
+
+	var teamUser models.TeamUser
+	if err := database.First(&teamUser, "secret_key = ?", testSecretKey).Error; err != nil {
+		t.Fatalf("load team user: %v", err)
+	}
+	if err := database.Model(&teamUser).Update("role", models.RoleAdmin).Error; err != nil {
+		t.Fatalf("promote team user: %v", err)
+	}
+	// Nobody is on the reservation's allowed list, so only admins may claim it.
+	if err := database.Create(&models.SubdomainReservation{Subdomain: "team-app", TeamID: teamUser.TeamID}).Error; err != nil {
+		t.Fatalf("reserve subdomain: %v", err)
+	}
+
+	stdout := dialStock(t, addr, &gossh.ClientConfig{
+		User: testSecretKey,
+		Auth: []gossh.AuthMethod{gossh.Password(testSecretKey)},
+	}, "team-app", backend.URL)
+
+	if url := readTunnelURL(t, stdout); url != "https://team-app.example.test" {
+		t.Fatalf("unexpected tunnel URL %q", url)
+	}
+	if body := requestHost(t, proxyServer, "team-app.example.test"); body != "from-team-app" {
+		t.Fatalf("unexpected response %q", body)
+	}
+}
+
+func TestStockSshClientOpensTunnelWithTunnelCredential(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "from-credential")
+	}))
+	defer backend.Close()
+	database, proxyServer, addr := startStockSshServer(t)
+
+	var teamUser models.TeamUser
+	if err := database.First(&teamUser, "secret_key = ?", testSecretKey).Error; err != nil {
+		t.Fatalf("load team user: %v", err)
+	}
+	credential, secret, err := services.NewTunnelCredentialService(database).Mint(context.Background(), teamUser.ID, services.MintTunnelCredentialInput{
+		Name:             "ci",
+		ConnectionType:   models.ConnectionTypeHTTP,
+		SubdomainPattern: "pr-*",
+		MaxLifetime:      time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("mint tunnel credential: %v", err)
+	}
+
+	stdout := dialStock(t, addr, &gossh.ClientConfig{User: "ci", Auth: []gossh.AuthMethod{gossh.Password(secret)}}, "pr-7", backend.URL)
+	if url := readTunnelURL(t, stdout); url != "https://pr-7.example.test" {
+		t.Fatalf("unexpected tunnel URL %q", url)
+	}
+	if body := requestHost(t, proxyServer, "pr-7.example.test"); body != "from-credential" {
+		t.Fatalf("unexpected response %q", body)
+	}
+	var connection models.Connection
+	if err := database.First(&connection, "subdomain = ?", "pr-7").Error; err != nil {
+		t.Fatalf("load connection: %v", err)
+	}
+	if connection.TunnelCredentialID == nil || *connection.TunnelCredentialID != credential.ID {
+		t.Fatalf("expected the connection to record its credential, got %v", connection.TunnelCredentialID)
+	}
+	if connection.ExpiresAt == nil || connection.ExpiresAt.After(credential.ExpiresAt) {
+		t.Fatalf("expected the tunnel to expire with its credential at %s, got %v", credential.ExpiresAt, connection.ExpiresAt)
+	}
+
+	client, err := gossh.Dial("tcp", addr, &gossh.ClientConfig{
+		User:            "ci",
+		Auth:            []gossh.AuthMethod{gossh.Password(secret)},
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+		Timeout:         testTimeout,
+	})
+	if err != nil {
+		t.Fatalf("log in with tunnel credential: %v", err)
+	}
+	defer client.Close()
+	ok, _, err := client.SendRequest("tcpip-forward", true, gossh.Marshal(&struct {
+		BindAddr string
+		BindPort uint32
+	}{"other-app", 80}))
+	if err != nil || ok {
+		t.Fatalf("expected a subdomain outside the pattern to be refused: ok=%v err=%v", ok, err)
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatalf("open session: %v", err)
+	}
+	output, err := session.StdoutPipe()
+	if err != nil {
+		t.Fatalf("session stdout: %v", err)
+	}
+	if err := session.Shell(); err != nil {
+		t.Fatalf("start shell: %v", err)
+	}
+	if text := readSessionLine(t, bufio.NewReader(output)); text != "This credential only opens http tunnels on subdomains matching pr-*" {
+		t.Fatalf("unexpected session output %q", text)
+	}
+}
+
+func TestStockSshClientRefusesCommand(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+	defer backend.Close()
+	_, _, addr := startStockSshServer(t)
+
+	// `ssh -R 80:localhost:3000 <secret-key>@host myname`
+	channel := openStockSession(t, addr, &gossh.ClientConfig{
+		User: testSecretKey,
+		Auth: []gossh.AuthMethod{gossh.Password(testSecretKey)},
+	}, "localhost", backend.URL)
+	if ok, err := channel.SendRequest("exec", true, gossh.Marshal(&struct{ Command string }{"myname"})); err != nil || !ok {
+		t.Fatalf("run command: ok=%v err=%v", ok, err)
+	}
+
+	output := make(chan string, 1)
+	go func() {
+		text, _ := io.ReadAll(channel.Stderr())
+		output <- string(text)
+	}()
+	select {
+	case text := <-output:
+		if !strings.Contains(text, `"myname" was not used`) || !strings.Contains(text, "-R <subdomain>:80:") {
+			t.Fatalf("unexpected session output %q", text)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("timed out waiting for the command to be refused")
+	}
+}
+
+func TestStockSshClientRejectsUnknownSecretKey(t *testing.T) {
+	_, _, addr := startStockSshServer(t)
+	config := &gossh.ClientConfig{
+		User: "not-a-secret-key",
+		Auth: []gossh.AuthMethod{gossh.KeyboardInteractive(func(_, _ string, questions []string, _ []bool) ([]string, error) {
+			return make([]string, len(questions)), nil
+		})},
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+		Timeout:         testTimeout,
+	}
+	if client, err := gossh.Dial("tcp", addr, config); err == nil {
+		_ = client.Close()
+		t.Fatal("expected authentication to fail")
+	}
+}
+
+func TestStockSshClientSecretKeyGuessesAreThrottled(t *testing.T) {
+	database, _, addr := startStockSshServer(t)
+	login := func(auth gossh.AuthMethod) error {
+		config := &gossh.ClientConfig{
+			User:            "tunnel",
+			Auth:            []gossh.AuthMethod{auth},
+			HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+			Timeout:         testTimeout,
+		}
+		client, err := gossh.Dial("tcp", addr, config)
+		if err == nil {
+			_ = client.Close()
+		}
+		return err
+	}
+	answer := func(secretKey string) gossh.AuthMethod {
+		return gossh.KeyboardInteractive(func(_, _ string, questions []string, _ []bool) ([]string, error) {
+			answers := make([]string, len(questions))
+			for i := range answers {
+				answers[i] = secretKey
+			}
+			return answers, nil
+		})
+	}
+
+	// Each keyboard-interactive login looks the username up before asking,
+	// so it costs two attempts.
+	for i := 0; i < 10; i++ {
+		if login(answer("wrong-secret-key")) == nil {
+			t.Fatal("expected an unknown secret key to be refused")
+		}
+	}
+	if login(gossh.Password("wrong-secret-key")) == nil {
+		t.Fatal("expected an unknown secret key to be refused")
+	}
+	if login(gossh.Password(testSecretKey)) == nil {
+		t.Fatal("expected the address to be locked out after too many unknown secret keys")
+	}
+	if login(answer(testSecretKey)) == nil {
+		t.Fatal("expected keyboard-interactive logins to be locked out too")
+	}
+
+	var lockouts int64
+	if err := database.Model(&models.AuditLog{}).Where("action = ?", models.AuditActionLoginLocked).Count(&lockouts).Error; err != nil {
+		t.Fatalf("count lockouts: %v", err)
+	}
+	if lockouts != 1 {
+		t.Fatalf("expected the lockout in the audit log, got %d entries", lockouts)
+	}
+}
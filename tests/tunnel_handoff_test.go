@@ -0,0 +1,180 @@
+package tests_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	clientdb "github.com/amalshaji/portr/internal/client/db"
+	clientssh "github.com/amalshaji/portr/internal/client/ssh"
+	clientconfig "github.com/amalshaji/portr/internal/clientconfig"
+	"github.com/amalshaji/portr/internal/constants"
+	serverconfig "github.com/amalshaji/portr/internal/server/config"
+	serverdb "github.com/amalshaji/portr/internal/server/db"
+	"github.com/amalshaji/portr/internal/server/proxy"
+	"github.com/amalshaji/portr/internal/server/service"
+	sshd "github.com/amalshaji/portr/internal/server/ssh"
+)
+
+func startHandoffSshServer(t *testing.T, cfg *serverconfig.Config, tunnelService *service.Service, listener net.Listener) (*proxy.Proxy, *sshd.SshServer) {
+	t.Helper()
+	proxyServer := proxy.New(cfg)
+	sshServer := sshd.New(&cfg.Ssh, proxyServer, tunnelService)
+	if err := sshServer.Prepare(); err != nil {
+		t.Fatalf("prepare SSH server: %v", err)
+	}
+	go sshServer.Start(listener)
+	return proxyServer, sshServer
+}
+
+func requestThroughProxy(t *testing.T, proxyServer *proxy.Proxy) string {
+	t.Helper()
+	publicServer := httptest.NewServer(proxyServer)
+	defer publicServer.Close()
+
+	request, err := http.NewRequest(http.MethodGet, publicServer.URL, nil)
+	if err != nil {
+		t.Fatalf("create public request: %v", err)
+	}
+	request.Host = testPublicHost
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("send request through tunnel: %v", err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected response status %d: %s", response.StatusCode, body)
+	}
+	return string(body)
+}
+
+func TestTunnelDataFlowSurvivesServerHandoff(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "through-tunnel")
+	}))
+	defer backend.Close()
+
+	serverDatabase := openTestDatabase(t, "server", &serverdb.TeamUser{}, &serverdb.Connection{})
+	teamUser := serverdb.TeamUser{SecretKey: testSecretKey, Role: "member"}
+	if err := serverDatabase.Create(&teamUser).Error; err != nil {
+		t.Fatalf("create tunnel user: %v", err)
+	}
+	subdomain := testSubdomain
+	connection := serverdb.Connection{
+		ID:          testConnectionID,
+		Type:        string(constants.Http),
+		Subdomain:   &subdomain,
+		Status:      "reserved",
+		CreatedByID: teamUser.ID,
+	}
+	if err := serverDatabase.Create(&connection).Error; err != nil {
+		t.Fatalf("create reserved connection: %v", err)
+	}
+	tunnelService := service.New(&serverdb.Db{Conn: serverDatabase})
+
+	serverConfig := &serverconfig.Config{
+		Ssh:    serverconfig.SshConfig{Host: "127.0.0.1"},
+		Proxy:  serverconfig.ProxyConfig{Host: "127.0.0.1"},
+		Domain: "example.test",
+		Debug:  true,
+	}
+	oldListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen for SSH server: %v", err)
+	}
+	oldProxy, oldServer := startHandoffSshServer(t, serverConfig, tunnelService, oldListener)
+
+	backendHost, backendPort := backendAddress(t, backend.URL)
+	client := clientssh.New(clientconfig.ClientConfig{
+		SshUrl:                          oldListener.Addr().String(),
+		SecretKey:                       testSecretKey,
+		ConnectionID:                    testConnectionID,
+		HealthCheckInterval:             60,
+		HealthCheckMaxRetries:           1,
+		DisableTerminalLogs:             true,
+		InsecureSkipHostKeyVerification: true,
+		Tunnel: clientconfig.Tunnel{
+			Name:      "ci-handoff",
+			Subdomain: testSubdomain,
+			Host:      backendHost,
+			Port:      backendPort,
+			Type:      constants.Http,
+		},
+	}, &clientdb.Db{Conn: openTestDatabase(t, "client", &clientdb.Request{})}, nil, nil)
+
+	events := make(chan clientssh.EventType, 16)
+	client.SetEventHandler(func(event clientssh.Event) {
+		events <- event.Type
+	})
+	clientContext, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	clientErr := make(chan error, 1)
+	go func() {
+		clientErr <- client.Start(clientContext)
+	}()
+	waitForEvent := func(want clientssh.EventType) {
+		t.Helper()
+		for {
+			select {
+			case event := <-events:
+				if event == want {
+					return
+				}
+				if event == clientssh.EventUnhealthy || event == clientssh.EventFailed {
+					t.Fatalf("unexpected %s event while waiting for %s", event, want)
+				}
+			case err := <-clientErr:
+				t.Fatalf("tunnel client stopped while waiting for %s: %v", want, err)
+			case <-time.After(testTimeout):
+				t.Fatalf("timed out waiting for %s", want)
+			}
+		}
+	}
+	waitForEvent(clientssh.EventStarted)
+	if body := requestThroughProxy(t, oldProxy); body != "through-tunnel" {
+		t.Fatalf("unexpected response before handoff %q", body)
+	}
+
+	// Hand the listening socket to a second server, as a replacement process
+	// would receive it, then drain the first one.
+	file, err := oldListener.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("duplicate SSH listener: %v", err)
+	}
+	newListener, err := net.FileListener(file)
+	_ = file.Close()
+	if err != nil {
+		t.Fatalf("inherit SSH listener: %v", err)
+	}
+	newProxy, newServer := startHandoffSshServer(t, serverConfig, tunnelService, newListener)
+
+	drainContext, cancelDrain := context.WithTimeout(context.Background(), testTimeout)
+	defer cancelDrain()
+	oldServer.Drain(drainContext, "server restart")
+
+	waitForEvent(clientssh.EventReconnecting)
+	waitForEvent(clientssh.EventReconnected)
+	if body := requestThroughProxy(t, newProxy); body != "through-tunnel" {
+		t.Fatalf("unexpected response after handoff %q", body)
+	}
+
+	shutdownContext, cancelShutdown := context.WithTimeout(context.Background(), testTimeout)
+	defer cancelShutdown()
+	if err := client.Shutdown(shutdownContext); err != nil &&
+		!errors.Is(err, context.Canceled) &&
+		!strings.Contains(strings.ToLower(err.Error()), "closed network connection") {
+		t.Errorf("shut down tunnel client: %v", err)
+	}
+	cancel()
+	if err := <-clientErr; err != nil {
+		t.Errorf("tunnel client exited with error: %v", err)
+	}
+	newServer.Shutdown(shutdownContext)
+}